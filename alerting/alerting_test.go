@@ -0,0 +1,328 @@
+package alerting_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Danny19977/sr-api/alerting"
+	"github.com/Danny19977/sr-api/apptest"
+	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/repository"
+	"github.com/google/uuid"
+)
+
+func TestWebhookPostsAlert(t *testing.T) {
+	var got alerting.WebhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decoding payload: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	err := alerting.Webhook(server.URL).Send(alerting.Alert{
+		Level:      2,
+		Kind:       alerting.KindSlotMissing,
+		Compliance: &models.SlotCompliance{Day: time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC), TimeSlot: "8am", Status: models.ComplianceMissing},
+		Province:   models.Province{UUID: "p1", Name: "North"},
+		Recipients: []models.User{{UUID: "u1"}, {UUID: "u2"}},
+		Subject:    "Escalated",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Level != 2 || got.Day != "2024-03-04" || got.TimeSlot != "8am" || got.ProvinceName != "North" || len(got.Recipients) != 2 {
+		t.Errorf("unexpected payload %+v", got)
+	}
+}
+
+// notificationsOf counts the notifications of user
+func notificationsOf(t *testing.T, env *apptest.Env, user *models.User) int64 {
+	t.Helper()
+	var count int64
+	if err := env.App.DB.Model(&models.Notification{}).Where("user_uuid = ?", user.UUID).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestTickAlertsEscalatesAndResolves(t *testing.T) {
+	env := apptest.New(t)
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	// Every day is worked, so the test passes on any day
+	country := &models.Country{UUID: uuid.New().String(), Name: "Country", WorkingDays: "1,2,3,4,5,6,7"}
+	if err := env.App.Geography.CreateCountry(country); err != nil {
+		t.Fatal(err)
+	}
+	provinces := map[string]*models.Province{}
+	for _, name := range []string{"Punctual", "Catching up", "Silent"} {
+		provinces[name] = &models.Province{UUID: uuid.New().String(), Name: name, CountryUUID: country.UUID}
+		if err := env.App.Geography.CreateProvince(provinces[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sell := func(province *models.Province, at time.Time) {
+		t.Helper()
+		err := env.App.Sales.Create(&models.Sale{
+			UUID:         uuid.New().String(),
+			CreatedAt:    at,
+			ProvinceUUID: province.UUID,
+			ProductUUID:  uuid.New().String(),
+			UserUUID:     uuid.New().String(),
+			Quantity:     1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sell(provinces["Punctual"], today.Add(7*time.Hour))
+	lateASM := env.CreateUser("ASM", &provinces["Catching up"].UUID)
+	silentASM := env.CreateUser("ASM", &provinces["Silent"].UUID)
+	manager := env.CreateUser("Manager", nil)
+
+	engine := alerting.New(env.App, alerting.ConfiguredChannels(env.App))
+
+	// The 8am slot closed at 10:00
+	if err := engine.Tick(today.Add(10*time.Hour + 5*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if n := notificationsOf(t, env, silentASM); n != 1 {
+		t.Errorf("silent ASM has %d notifications after the slot closed, want 1", n)
+	}
+	if n := notificationsOf(t, env, manager); n != 0 {
+		t.Errorf("manager has %d notifications before the grace period, want 0", n)
+	}
+	if n := len(env.Mailer.Messages()); n != 2 {
+		t.Errorf("%d alert emails sent, want 2", n)
+	}
+
+	// One province catches up, the other stays silent past the grace period
+	sell(provinces["Catching up"], today.Add(10*time.Hour+30*time.Minute))
+	if err := engine.Tick(today.Add(11*time.Hour + 10*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Tick(today.Add(11*time.Hour + 20*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if n := notificationsOf(t, env, manager); n != 1 {
+		t.Errorf("manager has %d notifications after escalation, want 1", n)
+	}
+	if n := notificationsOf(t, env, lateASM); n != 1 {
+		t.Errorf("ASM who caught up has %d notifications, want 1", n)
+	}
+
+	var records []models.SlotCompliance
+	err := env.App.DB.Where("day = ? AND slot = 0", today.Format("2006-01-02")).Find(&records).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		provinces["Punctual"].UUID:    models.ComplianceOnTime,
+		provinces["Catching up"].UUID: models.ComplianceLate,
+		provinces["Silent"].UUID:      models.ComplianceMissing,
+	}
+	if len(records) != len(want) {
+		t.Fatalf("got %d records for the 8am slot, want %d", len(records), len(want))
+	}
+	for _, record := range records {
+		if record.Status != want[record.ProvinceUUID] {
+			t.Errorf("province %s is %s, want %s", record.ProvinceUUID, record.Status, want[record.ProvinceUUID])
+		}
+		if record.ProvinceUUID == provinces["Silent"].UUID && record.EscalatedAt == nil {
+			t.Error("silent province was not escalated")
+		}
+	}
+}
+
+func TestRulesFireOncePerCooldown(t *testing.T) {
+	env := apptest.New(t)
+	now := time.Now()
+
+	country := &models.Country{UUID: uuid.New().String(), Name: "Country"}
+	if err := env.App.Geography.CreateCountry(country); err != nil {
+		t.Fatal(err)
+	}
+	province := &models.Province{UUID: uuid.New().String(), Name: "Behind", CountryUUID: country.UUID}
+	if err := env.App.Geography.CreateProvince(province); err != nil {
+		t.Fatal(err)
+	}
+	asm := env.CreateUser("ASM", &province.UUID)
+
+	isoYear, week := now.ISOWeek()
+	year := &models.Year{UUID: uuid.New().String(), Year: strconv.Itoa(isoYear), Quantity: "100000"}
+	if err := env.App.DB.Create(year).Error; err != nil {
+		t.Fatal(err)
+	}
+	target := &models.Week{
+		UUID:         uuid.New().String(),
+		Week:         strconv.Itoa(week),
+		Quantity:     "1000",
+		Role:         "ASM",
+		ProvinceUUID: province.UUID,
+		YearUUID:     year.UUID,
+	}
+	if err := env.App.DB.Create(target).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	rule := &models.AlertRule{
+		UUID:            uuid.New().String(),
+		Name:            "Below 80% of the week",
+		Kind:            models.RuleTargetAchievement,
+		Period:          "week",
+		Threshold:       80,
+		FromDay:         1,
+		CooldownMinutes: 60,
+		Active:          true,
+	}
+	if err := env.App.AlertRules.Create(rule); err != nil {
+		t.Fatal(err)
+	}
+
+	engine := alerting.New(env.App, alerting.ConfiguredChannels(env.App))
+	for _, at := range []time.Time{now, now.Add(30 * time.Minute), now.Add(61 * time.Minute)} {
+		if err := engine.EvaluateRules(at); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	firings, total, err := env.App.AlertRules.Firings(rule.UUID, repository.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 {
+		t.Errorf("rule fired %d times, want 2 (before and after the cooldown)", total)
+	}
+	if len(firings) > 0 && firings[0].Value != 0 {
+		t.Errorf("achievement = %v, want 0", firings[0].Value)
+	}
+	if n := notificationsOf(t, env, asm); n != 2 {
+		t.Errorf("ASM has %d notifications, want 2", n)
+	}
+}
+
+func TestEscalationsFollowTheReportingLine(t *testing.T) {
+	env := apptest.New(t)
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	// Every day is worked, so the test passes on any day
+	country := &models.Country{UUID: uuid.New().String(), Name: "Country", WorkingDays: "1,2,3,4,5,6,7"}
+	if err := env.App.Geography.CreateCountry(country); err != nil {
+		t.Fatal(err)
+	}
+	province := &models.Province{UUID: uuid.New().String(), Name: "Silent", CountryUUID: country.UUID}
+	if err := env.App.Geography.CreateProvince(province); err != nil {
+		t.Fatal(err)
+	}
+	supervisor := env.CreateUser("Supervisor", nil)
+	asm := env.CreateUser("ASM", &province.UUID)
+	asm.ManagerUUID = &supervisor.UUID
+	if err := env.App.Users.Save(asm); err != nil {
+		t.Fatal(err)
+	}
+	manager := env.CreateUser("Manager", nil)
+
+	engine := alerting.New(env.App, alerting.ConfiguredChannels(env.App))
+	for _, at := range []time.Time{today.Add(10*time.Hour + 5*time.Minute), today.Add(11*time.Hour + 10*time.Minute)} {
+		if err := engine.Tick(at); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The supervisor of the ASM is told, not every holder of a manager role
+	if n := notificationsOf(t, env, supervisor); n != 1 {
+		t.Errorf("supervisor has %d notifications after escalation, want 1", n)
+	}
+	if n := notificationsOf(t, env, manager); n != 0 {
+		t.Errorf("manager outside the reporting line has %d notifications, want 0", n)
+	}
+	if n := notificationsOf(t, env, asm); n != 2 {
+		t.Errorf("ASM has %d notifications, want the alert and the escalation", n)
+	}
+}
+
+func TestNoSlotAlertsOnDaysOff(t *testing.T) {
+	env := apptest.New(t)
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	country := &models.Country{UUID: uuid.New().String(), Name: "Country", WorkingDays: "1,2,3,4,5,6,7"}
+	if err := env.App.Geography.CreateCountry(country); err != nil {
+		t.Fatal(err)
+	}
+	for _, day := range []time.Time{today.AddDate(0, 0, -1), today} {
+		holiday := &models.Holiday{
+			UUID:        uuid.New().String(),
+			CountryUUID: country.UUID,
+			Date:        time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC),
+			Name:        "Holiday",
+		}
+		if err := env.App.Geography.CreateHoliday(holiday); err != nil {
+			t.Fatal(err)
+		}
+	}
+	province := &models.Province{UUID: uuid.New().String(), Name: "Resting", CountryUUID: country.UUID}
+	if err := env.App.Geography.CreateProvince(province); err != nil {
+		t.Fatal(err)
+	}
+	asm := env.CreateUser("ASM", &province.UUID)
+
+	engine := alerting.New(env.App, alerting.ConfiguredChannels(env.App))
+	if err := engine.Tick(today.Add(23 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if n := notificationsOf(t, env, asm); n != 0 {
+		t.Errorf("ASM has %d notifications on holidays, want 0", n)
+	}
+	var records int64
+	if err := env.App.DB.Model(&models.SlotCompliance{}).Where("province_uuid = ?", province.UUID).Count(&records).Error; err != nil {
+		t.Fatal(err)
+	}
+	if records != 0 {
+		t.Errorf("%d slots recorded on holidays, want none", records)
+	}
+}
+
+func TestASMsOfATerritoryAreAlerted(t *testing.T) {
+	env := apptest.New(t)
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	country := &models.Country{UUID: uuid.New().String(), Name: "Country", WorkingDays: "1,2,3,4,5,6,7"}
+	if err := env.App.Geography.CreateCountry(country); err != nil {
+		t.Fatal(err)
+	}
+	province := &models.Province{UUID: uuid.New().String(), Name: "Silent", CountryUUID: country.UUID}
+	if err := env.App.Geography.CreateProvince(province); err != nil {
+		t.Fatal(err)
+	}
+	region := &models.Territory{UUID: uuid.New().String(), ParentUUID: &country.UUID, Level: models.TerritoryRegion, Name: "Coast"}
+	if err := env.App.Territories.Create(region); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.App.Territories.Move(&models.Territory{UUID: province.UUID}, region.UUID); err != nil {
+		t.Fatal(err)
+	}
+	asm := env.CreateUser("ASM", nil)
+	asm.TerritoryUUID = &region.UUID
+	if err := env.App.Users.Save(asm); err != nil {
+		t.Fatal(err)
+	}
+
+	engine := alerting.New(env.App, alerting.ConfiguredChannels(env.App))
+	if err := engine.Tick(today.Add(10*time.Hour + 5*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if n := notificationsOf(t, env, asm); n != 1 {
+		t.Errorf("ASM of the region has %d notifications, want 1", n)
+	}
+}
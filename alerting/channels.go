@@ -0,0 +1,225 @@
+package alerting
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"time"
+
+	"github.com/Danny19977/sr-api/app"
+	"github.com/Danny19977/sr-api/mailer"
+	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/repository"
+)
+
+// Alert kinds
+const (
+	KindSlotMissing = "slot_missing"
+	KindRule        = "threshold_rule"
+)
+
+// Alert is a missed time slot or a crossed threshold to report to its recipients
+type Alert struct {
+	Kind string
+	// Level is 1 when a slot is found missing and 2 when it escalates
+	Level      int
+	Province   models.Province
+	Recipients []models.User
+	Subject    string
+	Message    string
+
+	// Compliance is the missed slot of slot alerts
+	Compliance *models.SlotCompliance
+	// Rule and Firing describe the threshold crossed by rule alerts
+	Rule   *models.AlertRule
+	Firing *models.AlertRuleFiring
+}
+
+// Channel delivers alerts
+type Channel interface {
+	Name() string
+	Send(alert Alert) error
+}
+
+// ConfiguredChannels builds the channels listed in the alert configuration
+func ConfiguredChannels(a *app.App) []Channel {
+	var channels []Channel
+	for _, name := range a.Config.Alerts.Channels {
+		switch name {
+		case "inapp":
+			channels = append(channels, InApp(a.Notifications))
+		case "email":
+			channels = append(channels, Email(a.Mailer, a.Notifications))
+		case "webhook":
+			channels = append(channels, Webhook(a.Config.Alerts.WebhookURL))
+		}
+	}
+	return channels
+}
+
+// unmuted keeps the recipients whose preferences let the channel reach them
+func unmuted(notifications repository.NotificationRepository, recipients []models.User, muted func(models.NotificationPreference) bool) ([]models.User, error) {
+	uuids := make([]string, len(recipients))
+	for i, user := range recipients {
+		uuids[i] = user.UUID
+	}
+	preferences, err := notifications.Preferences(uuids)
+	if err != nil {
+		return nil, err
+	}
+
+	var kept []models.User
+	for _, user := range recipients {
+		if !muted(preferences[user.UUID]) {
+			kept = append(kept, user)
+		}
+	}
+	return kept, nil
+}
+
+type inAppChannel struct {
+	notifications repository.NotificationRepository
+}
+
+// InApp stores one notification per recipient who did not mute the inbox
+func InApp(notifications repository.NotificationRepository) Channel {
+	return &inAppChannel{notifications: notifications}
+}
+
+func (ch *inAppChannel) Name() string { return "inapp" }
+
+func (ch *inAppChannel) Send(alert Alert) error {
+	recipients, err := unmuted(ch.notifications, alert.Recipients, func(p models.NotificationPreference) bool { return p.MuteInApp })
+	if err != nil {
+		return err
+	}
+
+	kind := "warning"
+	if alert.Level > 1 || alert.Kind == KindRule {
+		kind = "error"
+	}
+
+	var notifications []*models.Notification
+	for _, user := range recipients {
+		notifications = append(notifications, &models.Notification{
+			Name:     alert.Subject,
+			Message:  alert.Message,
+			Type:     kind,
+			UserUUID: user.UUID,
+		})
+	}
+	return ch.notifications.Create(notifications...)
+}
+
+type emailChannel struct {
+	mailer        mailer.Mailer
+	notifications repository.NotificationRepository
+}
+
+// Email mails the alert to the recipients with an address who did not mute email
+func Email(m mailer.Mailer, notifications repository.NotificationRepository) Channel {
+	return &emailChannel{mailer: m, notifications: notifications}
+}
+
+func (ch *emailChannel) Name() string { return "email" }
+
+func (ch *emailChannel) Send(alert Alert) error {
+	recipients, err := unmuted(ch.notifications, alert.Recipients, func(p models.NotificationPreference) bool { return p.MuteEmail })
+	if err != nil {
+		return err
+	}
+
+	var to []string
+	for _, user := range recipients {
+		if user.Email != "" {
+			to = append(to, user.Email)
+		}
+	}
+	if len(to) == 0 {
+		return nil
+	}
+
+	return ch.mailer.Send(mailer.Message{
+		To:      to,
+		Subject: alert.Subject,
+		HTML:    "<p>" + html.EscapeString(alert.Message) + "</p>",
+	})
+}
+
+// WebhookPayload is the JSON body posted by the webhook channel
+type WebhookPayload struct {
+	Kind         string    `json:"kind"`
+	Level        int       `json:"level"`
+	Subject      string    `json:"subject"`
+	Message      string    `json:"message"`
+	ProvinceUUID string    `json:"province_uuid"`
+	ProvinceName string    `json:"province_name"`
+	Recipients   []string  `json:"recipients"` // UUIDs of the notified users
+	SentAt       time.Time `json:"sent_at"`
+
+	// Slot alerts
+	Day      string `json:"day,omitempty"`
+	TimeSlot string `json:"time_slot,omitempty"`
+	Status   string `json:"status,omitempty"`
+
+	// Rule alerts
+	RuleUUID  string   `json:"rule_uuid,omitempty"`
+	RuleKind  string   `json:"rule_kind,omitempty"`
+	Threshold *float64 `json:"threshold,omitempty"`
+	Value     *float64 `json:"value,omitempty"`
+}
+
+type webhookChannel struct {
+	url    string
+	client *http.Client
+}
+
+// Webhook posts the alert as JSON to url
+func Webhook(url string) Channel {
+	return &webhookChannel{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (ch *webhookChannel) Name() string { return "webhook" }
+
+func (ch *webhookChannel) Send(alert Alert) error {
+	payload := WebhookPayload{
+		Kind:         alert.Kind,
+		Level:        alert.Level,
+		Subject:      alert.Subject,
+		Message:      alert.Message,
+		ProvinceUUID: alert.Province.UUID,
+		ProvinceName: alert.Province.Name,
+		Recipients:   []string{},
+		SentAt:       time.Now(),
+	}
+	if c := alert.Compliance; c != nil {
+		payload.Day = c.Day.Format("2006-01-02")
+		payload.TimeSlot = c.TimeSlot
+		payload.Status = c.Status
+	}
+	if alert.Rule != nil && alert.Firing != nil {
+		payload.RuleUUID = alert.Rule.UUID
+		payload.RuleKind = alert.Rule.Kind
+		payload.Threshold = &alert.Rule.Threshold
+		payload.Value = &alert.Firing.Value
+	}
+	for _, user := range alert.Recipients {
+		payload.Recipients = append(payload.Recipients, user.UUID)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := ch.client.Post(ch.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
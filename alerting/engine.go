@@ -0,0 +1,341 @@
+// Package alerting watches the time slots of the daily monitor and the
+// threshold rules, and alerts the people responsible for a province when it
+// misses an entry or falls behind.
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Danny19977/sr-api/app"
+	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/repository"
+	"github.com/Danny19977/sr-api/workdays"
+	"github.com/google/uuid"
+)
+
+// action is what a check does with a time slot of a province
+type action int
+
+const (
+	actionNone action = iota
+	// actionOnTime records a slot that has entries
+	actionOnTime
+	// actionLate records a slot first seen after the province caught up
+	actionLate
+	// actionAlert records a missing slot and alerts the province's ASMs
+	actionAlert
+	// actionMissing records a missing slot found too late to alert anybody
+	actionMissing
+	// actionResolve marks an alerted slot late once the province catches up
+	actionResolve
+	// actionEscalate alerts the managers of a slot still missing after the grace period
+	actionEscalate
+)
+
+// slotActivity is what a province did in and after a closed time slot
+type slotActivity struct {
+	closedAt time.Time
+	// entries counts the sales made in the slot
+	entries int64
+	// enteredAfter is set when the province made a sale after the slot closed
+	enteredAfter bool
+}
+
+// decide picks the action for a slot, record is nil when the slot was never checked
+func decide(record *models.SlotCompliance, activity slotActivity, now time.Time, grace time.Duration) action {
+	if record == nil {
+		switch {
+		case activity.entries > 0:
+			return actionOnTime
+		case activity.enteredAfter:
+			return actionLate
+		case now.Sub(activity.closedAt) > grace:
+			// The checker was down when the slot closed, an alert would be stale
+			return actionMissing
+		default:
+			return actionAlert
+		}
+	}
+
+	if record.Status != models.ComplianceMissing || record.ResolvedAt != nil {
+		return actionNone
+	}
+	if activity.entries > 0 || activity.enteredAfter {
+		return actionResolve
+	}
+	if record.AlertedAt != nil && record.EscalatedAt == nil && now.Sub(*record.AlertedAt) >= grace {
+		return actionEscalate
+	}
+	return actionNone
+}
+
+// Engine checks every province once each time slot closes and against the
+// threshold rules
+type Engine struct {
+	app      *app.App
+	channels []Channel
+}
+
+// New creates an engine delivering its alerts through channels
+func New(a *app.App, channels []Channel) *Engine {
+	return &Engine{app: a, channels: channels}
+}
+
+// Run checks the slots every check interval and the threshold rules every
+// rule interval until ctx is done
+func (e *Engine) Run(ctx context.Context) {
+	slots := time.NewTicker(e.app.Config.Alerts.CheckInterval)
+	defer slots.Stop()
+	rules := time.NewTicker(e.app.Config.Alerts.RuleInterval)
+	defer rules.Stop()
+
+	check := func(run func(time.Time) error) {
+		if err := run(time.Now()); err != nil {
+			e.app.Logger.Printf("alerting: %v", err)
+		}
+	}
+	check(e.Tick)
+	check(e.EvaluateRules)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-slots.C:
+			check(e.Tick)
+		case <-rules.C:
+			check(e.EvaluateRules)
+		}
+	}
+}
+
+// slotRef identifies a time slot of a province, day counts from the check origin
+type slotRef struct {
+	day          int
+	provinceUUID string
+	slot         int
+}
+
+// after reports whether r comes later in time than other
+func (r slotRef) after(other slotRef) bool {
+	return r.day > other.day || (r.day == other.day && r.slot > other.slot)
+}
+
+// Tick checks the slots of yesterday and today that closed by now
+func (e *Engine) Tick(now time.Time) error {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	origin := today.AddDate(0, 0, -1)
+	const days = 2
+
+	totals, err := e.app.Dashboard.SlotTotals(origin, days, nil)
+	if err != nil {
+		return fmt.Errorf("reading slot totals: %w", err)
+	}
+	provinces, err := e.app.Geography.AllProvinces()
+	if err != nil {
+		return fmt.Errorf("listing provinces: %w", err)
+	}
+	records, err := e.app.Compliance.Between(dateOf(origin), dateOf(origin).AddDate(0, 0, days))
+	if err != nil {
+		return fmt.Errorf("reading compliance: %w", err)
+	}
+
+	entries := make(map[slotRef]int64)
+	latest := make(map[string]slotRef)
+	for _, row := range totals {
+		ref := slotRef{row.Day, row.ProvinceUUID, row.Slot}
+		entries[ref] += row.Entries
+		if last, ok := latest[row.ProvinceUUID]; !ok || ref.after(last) {
+			latest[row.ProvinceUUID] = ref
+		}
+	}
+
+	// Days off expect no entries, so their slots are neither recorded nor alerted
+	calendars := make(map[string]workdays.Calendar)
+	for _, province := range provinces {
+		if _, ok := calendars[province.CountryUUID]; ok {
+			continue
+		}
+		cal, err := e.app.Dashboard.Workdays([]string{province.UUID})
+		if err != nil {
+			return fmt.Errorf("reading the calendar of %s: %w", province.Name, err)
+		}
+		calendars[province.CountryUUID] = cal
+	}
+
+	recorded := make(map[string]*models.SlotCompliance, len(records))
+	for i := range records {
+		recorded[recordKey(records[i].Day, records[i].ProvinceUUID, records[i].Slot)] = &records[i]
+	}
+
+	for day := 0; day < days; day++ {
+		date := origin.AddDate(0, 0, day)
+		for slot, window := range repository.TimeSlots {
+			closedAt := time.Date(date.Year(), date.Month(), date.Day(), window.EndHour, 0, 0, 0, date.Location())
+			if closedAt.After(now) {
+				break
+			}
+
+			for _, province := range provinces {
+				if !calendars[province.CountryUUID].IsWorkingDay(date) {
+					continue
+				}
+				ref := slotRef{day, province.UUID, slot}
+				last, ok := latest[province.UUID]
+				activity := slotActivity{
+					closedAt:     closedAt,
+					entries:      entries[ref],
+					enteredAfter: ok && last.after(ref),
+				}
+				record := recorded[recordKey(dateOf(date), province.UUID, slot)]
+
+				e.apply(decide(record, activity, now, e.app.Config.Alerts.GracePeriod), record, province, dateOf(date), slot, activity, now)
+			}
+		}
+	}
+	return nil
+}
+
+// apply stores the outcome of a slot and sends the alerts it calls for
+func (e *Engine) apply(act action, record *models.SlotCompliance, province models.Province, day time.Time, slot int, activity slotActivity, now time.Time) {
+	switch act {
+	case actionNone:
+		return
+	case actionResolve:
+		record.Status = models.ComplianceLate
+		record.ResolvedAt = &now
+		e.save(record)
+		return
+	case actionEscalate:
+		record.EscalatedAt = &now
+		if e.save(record) {
+			e.send(2, *record, province)
+		}
+		return
+	}
+
+	record = &models.SlotCompliance{
+		UUID:         uuid.New().String(),
+		Day:          day,
+		Slot:         slot,
+		TimeSlot:     repository.TimeSlots[slot].Name,
+		ProvinceUUID: province.UUID,
+		Status:       models.ComplianceMissing,
+		Entries:      activity.entries,
+	}
+	switch act {
+	case actionOnTime:
+		record.Status = models.ComplianceOnTime
+	case actionLate:
+		record.Status = models.ComplianceLate
+		record.ResolvedAt = &now
+	case actionAlert:
+		record.AlertedAt = &now
+	}
+
+	if err := e.app.Compliance.Create(record); err != nil {
+		// Another instance may have recorded the slot first
+		e.app.Logger.Printf("alerting: recording %s %s of %s: %v", record.TimeSlot, day.Format("2006-01-02"), province.Name, err)
+		return
+	}
+	if act == actionAlert {
+		e.send(1, *record, province)
+	}
+}
+
+func (e *Engine) save(record *models.SlotCompliance) bool {
+	if err := e.app.Compliance.Save(record); err != nil {
+		e.app.Logger.Printf("alerting: updating %s %s of %s: %v", record.TimeSlot, record.Day.Format("2006-01-02"), record.ProvinceUUID, err)
+		return false
+	}
+	return true
+}
+
+// send delivers the slot alert of level through every channel. Level 1
+// reaches the ASMs of the province, level 2 adds their managers.
+func (e *Engine) send(level int, record models.SlotCompliance, province models.Province) {
+	window := repository.TimeSlots[record.Slot]
+	alert := Alert{
+		Kind:       KindSlotMissing,
+		Level:      level,
+		Compliance: &record,
+		Province:   province,
+		Recipients: e.recipients(province, level > 1),
+		Subject:    fmt.Sprintf("Missing entry: %s %s", province.Name, window.Name),
+		Message: fmt.Sprintf("No entry was recorded for %s in the %s slot (%02d:00-%02d:00) of %s.",
+			province.Name, window.Name, window.StartHour, window.EndHour, record.Day.Format("2006-01-02")),
+	}
+	if level > 1 {
+		alert.Subject = fmt.Sprintf("Escalated: %s %s still missing", province.Name, window.Name)
+		alert.Message += fmt.Sprintf(" It is still missing %s after the first alert.", e.app.Config.Alerts.GracePeriod)
+	}
+	e.deliver(alert)
+}
+
+// recipients returns the active ASMs of province, with their managers when
+// withManagers is set. ASMs without a manager escalate to the manager roles
+// of the country of the province.
+func (e *Engine) recipients(province models.Province, withManagers bool) []models.User {
+	recipients, err := e.app.Users.ActiveByRole([]string{"ASM"}, province.UUID, "")
+	if err != nil {
+		e.app.Logger.Printf("alerting: listing the ASMs of %s: %v", province.Name, err)
+	}
+	if !withManagers {
+		return recipients
+	}
+
+	var asms, unmanaged []string
+	for _, asm := range recipients {
+		asms = append(asms, asm.UUID)
+		if asm.ManagerUUID == nil {
+			unmanaged = append(unmanaged, asm.UUID)
+		}
+	}
+	managers, err := e.app.Users.ActiveManagers(asms)
+	if err != nil {
+		e.app.Logger.Printf("alerting: listing the managers of the ASMs of %s: %v", province.Name, err)
+	}
+	if len(managers) == 0 || len(unmanaged) > 0 {
+		byRole, err := e.app.Users.ActiveByRole(e.app.Config.Alerts.ManagerRoles, "", province.CountryUUID)
+		if err != nil {
+			e.app.Logger.Printf("alerting: listing the managers of %s: %v", province.Name, err)
+		}
+		managers = append(managers, byRole...)
+	}
+
+	// A manager may also be an ASM of the province or hold a manager role
+	seen := make(map[string]bool, len(recipients)+len(managers))
+	for _, user := range recipients {
+		seen[user.UUID] = true
+	}
+	for _, manager := range managers {
+		if !seen[manager.UUID] {
+			seen[manager.UUID] = true
+			recipients = append(recipients, manager)
+		}
+	}
+	return recipients
+}
+
+// deliver sends alert through every channel, failures are logged
+func (e *Engine) deliver(alert Alert) {
+	if len(alert.Recipients) == 0 {
+		return
+	}
+	for _, channel := range e.channels {
+		if err := channel.Send(alert); err != nil {
+			e.app.Logger.Printf("alerting: sending through %s: %v", channel.Name(), err)
+		}
+	}
+}
+
+// dateOf returns the calendar day of t as stored in date columns
+func dateOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func recordKey(day time.Time, provinceUUID string, slot int) string {
+	return fmt.Sprintf("%s|%s|%d", day.Format("2006-01-02"), provinceUUID, slot)
+}
@@ -0,0 +1,42 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Danny19977/sr-api/models"
+)
+
+func TestDecide(t *testing.T) {
+	closedAt := time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC)
+	grace := time.Hour
+	alertedAt := closedAt.Add(time.Minute)
+	missing := func() *models.SlotCompliance {
+		return &models.SlotCompliance{Status: models.ComplianceMissing, AlertedAt: &alertedAt}
+	}
+	escalated := missing()
+	escalated.EscalatedAt = &alertedAt
+
+	cases := []struct {
+		name     string
+		record   *models.SlotCompliance
+		activity slotActivity
+		now      time.Time
+		want     action
+	}{
+		{"entered in the slot", nil, slotActivity{closedAt: closedAt, entries: 2}, closedAt.Add(time.Minute), actionOnTime},
+		{"entered before the first check", nil, slotActivity{closedAt: closedAt, enteredAfter: true}, closedAt.Add(time.Minute), actionLate},
+		{"missing", nil, slotActivity{closedAt: closedAt}, closedAt.Add(time.Minute), actionAlert},
+		{"missing long ago", nil, slotActivity{closedAt: closedAt}, closedAt.Add(2 * time.Hour), actionMissing},
+		{"alerted within grace", missing(), slotActivity{closedAt: closedAt}, alertedAt.Add(30 * time.Minute), actionNone},
+		{"alerted then entered", missing(), slotActivity{closedAt: closedAt, enteredAfter: true}, alertedAt.Add(30 * time.Minute), actionResolve},
+		{"grace period over", missing(), slotActivity{closedAt: closedAt}, alertedAt.Add(grace), actionEscalate},
+		{"already escalated", escalated, slotActivity{closedAt: closedAt}, alertedAt.Add(3 * grace), actionNone},
+		{"already on time", &models.SlotCompliance{Status: models.ComplianceOnTime}, slotActivity{closedAt: closedAt}, alertedAt.Add(3 * grace), actionNone},
+	}
+	for _, tc := range cases {
+		if got := decide(tc.record, tc.activity, tc.now, grace); got != tc.want {
+			t.Errorf("%s: got action %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
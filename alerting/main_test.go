@@ -0,0 +1,9 @@
+package alerting_test
+
+import (
+	"testing"
+
+	"github.com/Danny19977/sr-api/apptest"
+)
+
+func TestMain(m *testing.M) { apptest.Main(m) }
@@ -0,0 +1,216 @@
+package alerting
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/Danny19977/sr-api/fiscal"
+	"github.com/Danny19977/sr-api/metrics"
+	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/repository"
+	"github.com/google/uuid"
+)
+
+// breach is a province beyond the threshold of a rule
+type breach struct {
+	// value is the achievement or the pace change, in percent
+	value float64
+	// sold and target are set by target rules
+	sold   int64
+	target int64
+}
+
+// ruleScope keeps the provinces a rule covers
+func ruleScope(rule models.AlertRule, provinces []models.Province) []models.Province {
+	var scope []models.Province
+	for _, province := range provinces {
+		if rule.ProvinceUUID != nil && *rule.ProvinceUUID != "" && *rule.ProvinceUUID != province.UUID {
+			continue
+		}
+		if rule.CountryUUID != nil && *rule.CountryUUID != "" && *rule.CountryUUID != province.CountryUUID {
+			continue
+		}
+		scope = append(scope, province)
+	}
+	return scope
+}
+
+// currentPeriod returns the fiscal week or month of a target rule holding now
+func currentPeriod(cal fiscal.Calendar, period string, now time.Time) fiscal.Period {
+	if period == "month" {
+		return cal.MonthOf(now)
+	}
+	return cal.WeekOf(now)
+}
+
+// dayOfPeriod numbers the day of now in the period of a target rule, from 1
+func dayOfPeriod(cal fiscal.Calendar, period string, now time.Time) int {
+	from := currentPeriod(cal, period, now).From
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	return int(math.Round(day.Sub(from).Hours()/24)) + 1
+}
+
+// achievementBreaches keeps the provinces that sold less than the threshold
+// of their target, provinces without a target are not judged
+func achievementBreaches(rule models.AlertRule, targets, sold map[string]int64) map[string]breach {
+	breaches := make(map[string]breach)
+	for uuid, target := range targets {
+		if target <= 0 {
+			continue
+		}
+		achievement := float64(sold[uuid]) * 100 / float64(target)
+		if achievement < rule.Threshold {
+			breaches[uuid] = breach{value: achievement, sold: sold[uuid], target: target}
+		}
+	}
+	return breaches
+}
+
+// paceBreaches keeps the provinces whose pace dropped by the threshold or more
+func paceBreaches(rule models.AlertRule, pace map[string]float64) map[string]breach {
+	breaches := make(map[string]breach)
+	for uuid, change := range pace {
+		if change <= -rule.Threshold {
+			breaches[uuid] = breach{value: change}
+		}
+	}
+	return breaches
+}
+
+// EvaluateRules checks every active threshold rule at now
+func (e *Engine) EvaluateRules(now time.Time) error {
+	rules, err := e.app.AlertRules.Active()
+	if err != nil {
+		return fmt.Errorf("listing alert rules: %w", err)
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	provinces, err := e.app.Geography.AllProvinces()
+	if err != nil {
+		return fmt.Errorf("listing provinces: %w", err)
+	}
+
+	for _, rule := range rules {
+		if err := e.evaluateRule(rule, ruleScope(rule, provinces), now); err != nil {
+			e.app.Logger.Printf("alerting: evaluating rule %q: %v", rule.Name, err)
+		}
+	}
+	return nil
+}
+
+// breaches returns the provinces of provinceUUIDs beyond the threshold of rule at now
+func (e *Engine) breaches(rule models.AlertRule, provinceUUIDs []string, now time.Time) (map[string]breach, error) {
+	switch rule.Kind {
+	case models.RuleTargetAchievement:
+		cal, err := e.app.Dashboard.Calendar(provinceUUIDs)
+		if err != nil {
+			return nil, err
+		}
+		if dayOfPeriod(cal, rule.Period, now) < rule.FromDay {
+			return nil, nil
+		}
+
+		targets, err := metrics.WeekTargets(e.app.Dashboard, cal, now, provinceUUIDs)
+		if rule.Period == "month" {
+			targets, err = metrics.MonthTargets(e.app.Dashboard, cal, now, provinceUUIDs)
+		}
+		if err != nil {
+			return nil, err
+		}
+		totals, err := e.app.Dashboard.ProvinceTotals(repository.TimeRange{From: targets.From, To: now}, provinceUUIDs)
+		if err != nil {
+			return nil, err
+		}
+		sold := make(map[string]int64, len(totals))
+		for _, total := range totals {
+			sold[total.UUID] = total.Total
+		}
+		return achievementBreaches(rule, targets.Targets, sold), nil
+
+	case models.RulePaceDrop:
+		// Too little of the day has passed before the first slot closes
+		if now.Hour() < repository.TimeSlots[0].EndHour {
+			return nil, nil
+		}
+		// Days off are not expected to keep the pace of working days
+		cal, err := e.app.Dashboard.Workdays(provinceUUIDs)
+		if err != nil || !cal.IsWorkingDay(now) {
+			return nil, err
+		}
+		pace, err := metrics.ProvincePace(e.app.Dashboard, cal, now, rule.BaselineDays, provinceUUIDs)
+		if err != nil {
+			return nil, err
+		}
+		return paceBreaches(rule, pace), nil
+	}
+	return nil, fmt.Errorf("unknown rule kind %q", rule.Kind)
+}
+
+// evaluateRule alerts the provinces beyond the threshold of rule that are not
+// cooling down from a previous firing
+func (e *Engine) evaluateRule(rule models.AlertRule, scope []models.Province, now time.Time) error {
+	if len(scope) == 0 {
+		return nil
+	}
+	provinceUUIDs := make([]string, len(scope))
+	for i, province := range scope {
+		provinceUUIDs[i] = province.UUID
+	}
+
+	breaches, err := e.breaches(rule, provinceUUIDs, now)
+	if err != nil || len(breaches) == 0 {
+		return err
+	}
+
+	cooling := map[string]time.Time{}
+	if rule.Cooldown() > 0 {
+		if cooling, err = e.app.AlertRules.LastFirings(rule.UUID, now.Add(-rule.Cooldown())); err != nil {
+			return err
+		}
+	}
+
+	for _, province := range scope {
+		b, ok := breaches[province.UUID]
+		if !ok {
+			continue
+		}
+		if _, ok := cooling[province.UUID]; ok {
+			continue
+		}
+
+		firing := &models.AlertRuleFiring{
+			UUID:         uuid.New().String(),
+			RuleUUID:     rule.UUID,
+			ProvinceUUID: province.UUID,
+			FiredAt:      now,
+			Value:        b.value,
+			Message:      ruleMessage(rule, province, b),
+		}
+		if err := e.app.AlertRules.RecordFiring(firing); err != nil {
+			return err
+		}
+
+		e.deliver(Alert{
+			Kind:       KindRule,
+			Level:      1,
+			Province:   province,
+			Recipients: e.recipients(province, true),
+			Subject:    fmt.Sprintf("%s: %s", rule.Name, province.Name),
+			Message:    firing.Message,
+			Rule:       &rule,
+			Firing:     firing,
+		})
+	}
+	return nil
+}
+
+func ruleMessage(rule models.AlertRule, province models.Province, b breach) string {
+	if rule.Kind == models.RulePaceDrop {
+		return fmt.Sprintf("%s sells %.0f%% below its %d-day average at this time of day, beyond the %.0f%% threshold of %q.",
+			province.Name, -b.value, rule.BaselineDays, rule.Threshold, rule.Name)
+	}
+	return fmt.Sprintf("%s reached %.0f%% of its %s target (%d of %d), below the %.0f%% threshold of %q.",
+		province.Name, b.value, rule.Period, b.sold, b.target, rule.Threshold, rule.Name)
+}
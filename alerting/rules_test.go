@@ -0,0 +1,78 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Danny19977/sr-api/fiscal"
+	"github.com/Danny19977/sr-api/models"
+)
+
+func TestAchievementBreaches(t *testing.T) {
+	rule := models.AlertRule{Kind: models.RuleTargetAchievement, Period: "week", Threshold: 80}
+	targets := map[string]int64{"behind": 1000, "ahead": 1000, "untargeted": 0}
+	sold := map[string]int64{"behind": 790, "ahead": 800, "untargeted": 5}
+
+	breaches := achievementBreaches(rule, targets, sold)
+	if len(breaches) != 1 {
+		t.Fatalf("got breaches %v, want behind only", breaches)
+	}
+	if b := breaches["behind"]; b.value != 79 || b.sold != 790 || b.target != 1000 {
+		t.Errorf("behind breach = %+v", b)
+	}
+}
+
+func TestPaceBreaches(t *testing.T) {
+	rule := models.AlertRule{Kind: models.RulePaceDrop, Threshold: 25}
+	breaches := paceBreaches(rule, map[string]float64{"slow": -25, "steady": -24.9, "fast": 40})
+	if _, ok := breaches["slow"]; !ok || len(breaches) != 1 {
+		t.Errorf("got breaches %v, want slow only", breaches)
+	}
+}
+
+func TestRuleScope(t *testing.T) {
+	north, south := "north", "south"
+	country := "c1"
+	provinces := []models.Province{
+		{UUID: north, CountryUUID: country},
+		{UUID: south, CountryUUID: "c2"},
+	}
+
+	cases := []struct {
+		name string
+		rule models.AlertRule
+		want int
+	}{
+		{"everywhere", models.AlertRule{}, 2},
+		{"country", models.AlertRule{CountryUUID: &country}, 1},
+		{"province", models.AlertRule{ProvinceUUID: &south}, 1},
+		{"province outside country", models.AlertRule{CountryUUID: &country, ProvinceUUID: &south}, 0},
+	}
+	for _, tc := range cases {
+		if got := ruleScope(tc.rule, provinces); len(got) != tc.want {
+			t.Errorf("%s: got %d provinces, want %d", tc.name, len(got), tc.want)
+		}
+	}
+}
+
+func TestDayOfPeriod(t *testing.T) {
+	thursday := time.Date(2024, 3, 7, 12, 0, 0, 0, time.UTC)
+	if got := dayOfPeriod(fiscal.Gregorian, "week", thursday); got != 4 {
+		t.Errorf("week day of a Thursday = %d, want 4", got)
+	}
+	if got := dayOfPeriod(fiscal.Gregorian, "week", thursday.AddDate(0, 0, 3)); got != 7 {
+		t.Errorf("week day of a Sunday = %d, want 7", got)
+	}
+	if got := dayOfPeriod(fiscal.Gregorian, "month", thursday); got != 7 {
+		t.Errorf("month day = %d, want 7", got)
+	}
+
+	// Sunday weeks and 4-4-5 months starting on the Sunday nearest February 1st
+	retail := fiscal.Calendar{StartMonth: time.February, Pattern: "4-4-5", WeekStart: time.Sunday}
+	if got := dayOfPeriod(retail, "week", thursday); got != 5 {
+		t.Errorf("retail week day of a Thursday = %d, want 5", got)
+	}
+	if got := dayOfPeriod(retail, "month", thursday.AddDate(0, 0, 7)); got != 12 {
+		t.Errorf("retail month day = %d, want 12", got)
+	}
+}
@@ -0,0 +1,125 @@
+// Package anomaly screens the quantity of a sale against the recent sales of
+// its province and product in the same time slot, so typos such as an extra
+// zero are caught at entry time instead of distorting every chart.
+package anomaly
+
+import (
+	"math"
+	"slices"
+	"time"
+
+	"github.com/Danny19977/sr-api/app"
+	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/repository"
+)
+
+// madScale turns a median absolute deviation into the standard deviation of
+// normally distributed data, meanScale does the same for a mean absolute
+// deviation
+const (
+	madScale  = 1.4826
+	meanScale = 1.2533
+)
+
+// minSpread is the smallest scale as a share of the median, so flat histories
+// still tolerate ordinary swings
+const minSpread = 0.25
+
+// Baseline describes the recent quantities of a province, product and slot
+type Baseline struct {
+	Median  float64
+	Scale   float64
+	Samples int
+}
+
+// NewBaseline returns the median of quantities and a robust estimate of
+// their spread around it
+func NewBaseline(quantities []int64) Baseline {
+	if len(quantities) == 0 {
+		return Baseline{}
+	}
+	values := make([]float64, len(quantities))
+	for i, q := range quantities {
+		values[i] = float64(q)
+	}
+	median := medianOf(values)
+
+	deviations := make([]float64, len(values))
+	var total float64
+	for i, v := range values {
+		deviations[i] = math.Abs(v - median)
+		total += deviations[i]
+	}
+	scale := madScale * medianOf(deviations)
+	if scale == 0 {
+		// More than half the quantities are the median
+		scale = meanScale * total / float64(len(values))
+	}
+	scale = math.Max(scale, math.Max(minSpread*math.Abs(median), 1))
+	return Baseline{Median: median, Scale: scale, Samples: len(values)}
+}
+
+// Score returns how many robust standard deviations quantity lies from the
+// median, negative below it
+func (b Baseline) Score(quantity int64) float64 {
+	if b.Samples == 0 {
+		return 0
+	}
+	return (float64(quantity) - b.Median) / b.Scale
+}
+
+// medianOf sorts values and returns their median
+func medianOf(values []float64) float64 {
+	slices.Sort(values)
+	n := len(values)
+	if n%2 == 1 {
+		return values[n/2]
+	}
+	return (values[n/2-1] + values[n/2]) / 2
+}
+
+// Result is the outcome of the check of a sale
+type Result struct {
+	// Score is 0 when fewer than the minimum samples were found
+	Score   float64 `json:"score"`
+	Median  float64 `json:"median"`
+	Samples int     `json:"samples"`
+	Outlier bool    `json:"outlier"`
+}
+
+// Detector checks new sales with the settings of the application
+type Detector struct {
+	app *app.App
+}
+
+// New creates a detector reading the sales of a
+func New(a *app.App) *Detector {
+	return &Detector{app: a}
+}
+
+// Check scores the quantity of sale, made at at, against the unflagged sales
+// of its province and product in the same time slot over the window
+func (d *Detector) Check(sale *models.Sale, at time.Time) (Result, error) {
+	cfg := d.app.Config.Anomaly
+	recent, err := d.app.Sales.Recent(sale.ProvinceUUID, sale.ProductUUID, at.Add(-cfg.Window), at)
+	if err != nil {
+		return Result{}, err
+	}
+
+	slot := repository.SlotOf(at)
+	var quantities []int64
+	for _, s := range recent {
+		if s.UUID != sale.UUID && repository.SlotOf(s.CreatedAt.In(at.Location())) == slot {
+			quantities = append(quantities, s.Quantity)
+		}
+	}
+
+	baseline := NewBaseline(quantities)
+	result := Result{Median: baseline.Median, Samples: baseline.Samples}
+	if baseline.Samples < cfg.MinSamples {
+		return result, nil
+	}
+	result.Score = math.Round(baseline.Score(sale.Quantity)*100) / 100
+	result.Outlier = math.Abs(result.Score) >= cfg.Threshold
+	return result, nil
+}
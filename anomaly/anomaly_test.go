@@ -0,0 +1,94 @@
+package anomaly_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Danny19977/sr-api/apptest"
+	"github.com/Danny19977/sr-api/models"
+	"github.com/google/uuid"
+)
+
+func TestOutliersNeedConfirmationAndAreFlagged(t *testing.T) {
+	env := apptest.New(t)
+	country := &models.Country{UUID: uuid.New().String(), Name: "Country"}
+	if err := env.App.Geography.CreateCountry(country); err != nil {
+		t.Fatal(err)
+	}
+	north := &models.Province{UUID: uuid.New().String(), Name: "North", CountryUUID: country.UUID}
+	if err := env.App.Geography.CreateProvince(north); err != nil {
+		t.Fatal(err)
+	}
+	admin := env.CreateUser("Admin", nil)
+	token := env.Token(admin)
+	product := uuid.New().String()
+
+	// A week of 8am entries around 100
+	today := time.Now()
+	at := time.Date(today.Year(), today.Month(), today.Day(), 9, 0, 0, 0, time.Local)
+	var history []models.Sale
+	for day := 1; day <= 7; day++ {
+		history = append(history, models.Sale{
+			UUID:         uuid.New().String(),
+			CreatedAt:    at.AddDate(0, 0, -day),
+			ProvinceUUID: north.UUID,
+			ProductUUID:  product,
+			UserUUID:     admin.UUID,
+			Quantity:     int64(95 + day),
+		})
+	}
+	if err := env.App.Sales.CreateBatch(history, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	sale := map[string]interface{}{
+		"created_at":    at,
+		"province_uuid": north.UUID,
+		"product_uuid":  product,
+		"user_uuid":     admin.UUID,
+		"quantity":      1000,
+	}
+	if res := env.Do("POST", "/api/sales/create", token, sale); res.Status != 409 {
+		t.Fatalf("an unconfirmed outlier: got %d %s, want 409", res.Status, res.Body)
+	}
+
+	res := env.Do("POST", "/api/sales/create?confirm=true", token, sale)
+	var created struct {
+		Data models.Sale `json:"data"`
+	}
+	if err := res.JSON(&created); err != nil || res.Status != 200 {
+		t.Fatalf("a confirmed outlier: got %d %s", res.Status, res.Body)
+	}
+	if !created.Data.Flagged || created.Data.AnomalyScore < 3.5 {
+		t.Errorf("got flagged %v with score %v", created.Data.Flagged, created.Data.AnomalyScore)
+	}
+
+	// It shows in the daily anomalies and the entry table
+	var flagged struct {
+		Data []models.Sale `json:"data"`
+	}
+	if err := env.Do("GET", "/api/sales/anomalies?date="+at.Format("2006-01-02"), token, nil).JSON(&flagged); err != nil {
+		t.Fatal(err)
+	}
+	if len(flagged.Data) != 1 || flagged.Data[0].UUID != created.Data.UUID {
+		t.Errorf("got %d flagged sales, want the confirmed outlier", len(flagged.Data))
+	}
+	var monitor struct {
+		DailyEntryTable []struct {
+			ProvinceUUID string   `json:"province_uuid"`
+			FlaggedSlots []string `json:"flagged_slots"`
+		} `json:"daily_entry_table"`
+	}
+	if err := env.Do("GET", "/api/dashboard/daily-monitor?date="+at.Format("2006-01-02"), token, nil).JSON(&monitor); err != nil {
+		t.Fatal(err)
+	}
+	if len(monitor.DailyEntryTable) != 1 || len(monitor.DailyEntryTable[0].FlaggedSlots) != 1 || monitor.DailyEntryTable[0].FlaggedSlots[0] != "8am" {
+		t.Errorf("got entry table %+v, want the 8am slot flagged", monitor.DailyEntryTable)
+	}
+
+	// An ordinary quantity needs no confirmation
+	sale["quantity"] = 101
+	if res := env.Do("POST", "/api/sales/create", token, sale); res.Status != 200 {
+		t.Errorf("an ordinary quantity: got %d %s", res.Status, res.Body)
+	}
+}
@@ -0,0 +1,42 @@
+package anomaly
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBaselineCatchesAnExtraZero(t *testing.T) {
+	b := NewBaseline([]int64{98, 102, 100, 95, 110, 104, 99})
+	if b.Median != 100 || b.Samples != 7 {
+		t.Fatalf("got %+v, want a median of 100 over 7 samples", b)
+	}
+	if score := b.Score(1000); score < 10 {
+		t.Errorf("an extra zero scores %.2f", score)
+	}
+	if score := b.Score(10); score > -3.5 {
+		t.Errorf("a missing zero scores %.2f", score)
+	}
+	if score := math.Abs(b.Score(108)); score >= 3.5 {
+		t.Errorf("an ordinary quantity scores %.2f", score)
+	}
+}
+
+func TestBaselineOfAFlatHistory(t *testing.T) {
+	// Without spread the scale falls back to a share of the median
+	b := NewBaseline([]int64{40, 40, 40, 40, 40})
+	if b.Scale != 10 {
+		t.Fatalf("got a scale of %v, want 10", b.Scale)
+	}
+	if score := b.Score(50); score != 1 {
+		t.Errorf("got %v, want 1", score)
+	}
+	if score := b.Score(400); score != 36 {
+		t.Errorf("got %v, want 36", score)
+	}
+}
+
+func TestEmptyBaseline(t *testing.T) {
+	if score := NewBaseline(nil).Score(1000); score != 0 {
+		t.Errorf("got %v without history, want 0", score)
+	}
+}
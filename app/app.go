@@ -0,0 +1,134 @@
+package app
+
+import (
+	"log"
+	"os"
+
+	"github.com/Danny19977/sr-api/cache"
+	"github.com/Danny19977/sr-api/config"
+	"github.com/Danny19977/sr-api/events"
+	"github.com/Danny19977/sr-api/mailer"
+	"github.com/Danny19977/sr-api/repository"
+	"gorm.io/gorm"
+)
+
+// App is the application container handed to every controller. It carries
+// the shared dependencies so handlers never reach for package globals.
+type App struct {
+	Config *config.Config
+	DB     *gorm.DB
+	Logger *log.Logger
+	Mailer mailer.Mailer
+	Events *events.Bus
+	// Cache holds rendered dashboard responses
+	Cache cache.Store
+
+	Sales     repository.SaleRepository
+	Targets   repository.TargetRepository
+	Users     repository.UserRepository
+	Geography repository.GeographyRepository
+	Dashboard repository.DashboardRepository
+	Rollups   repository.RollupRepository
+	// Compliance keeps the outcome of every time slot checked by the alerting engine
+	Compliance repository.ComplianceRepository
+	// AlertRules holds the target and pace thresholds checked by the alerting engine
+	AlertRules repository.AlertRuleRepository
+	// Notifications holds the user inboxes and their preferences
+	Notifications repository.NotificationRepository
+	// Webhooks holds the webhook subscriptions, the event outbox and the delivery log
+	Webhooks repository.WebhookRepository
+	// Reports holds the scheduled report subscriptions and their runs
+	Reports repository.ReportRepository
+	// Analytics runs the ad-hoc aggregations of the sales
+	Analytics repository.AnalyticsRepository
+	// Territories holds the territory tree the countries and provinces are mirrored into
+	Territories repository.TerritoryRepository
+	// Outlets holds the points of sale
+	Outlets repository.OutletRepository
+}
+
+// Option customizes the container built by New
+type Option func(*App)
+
+// WithMailer replaces the SMTP mailer, e.g. by a mailer.MemoryMailer in tests
+func WithMailer(m mailer.Mailer) Option {
+	return func(a *App) {
+		a.Mailer = m
+	}
+}
+
+// WithLogger replaces the default standard error logger
+func WithLogger(l *log.Logger) Option {
+	return func(a *App) {
+		a.Logger = l
+	}
+}
+
+// WithCache replaces the cache store selected by the configuration
+func WithCache(store cache.Store) Option {
+	return func(a *App) {
+		a.Cache = store
+	}
+}
+
+// newCache builds the cache store selected by cfg
+func newCache(cfg config.CacheConfig) cache.Store {
+	switch cfg.Backend {
+	case "redis":
+		return cache.NewRedis(cache.RedisOptions{
+			Addr:     cfg.RedisAddr,
+			Password: cfg.RedisPassword,
+			DB:       cfg.RedisDB,
+			Prefix:   cfg.RedisPrefix,
+		})
+	case "off":
+		return cache.Nop()
+	default:
+		return cache.NewLRU(cfg.Size)
+	}
+}
+
+// New builds the container around an open database connection
+func New(cfg *config.Config, db *gorm.DB, opts ...Option) *App {
+	bus := events.NewBus()
+	a := &App{
+		Config: cfg,
+		DB:     db,
+		Logger: log.New(os.Stderr, "sr-api ", log.LstdFlags),
+		Mailer: mailer.NewSMTPMailer(cfg.SMTP),
+		Events: bus,
+		Cache:  newCache(cfg.Cache),
+
+		Sales:     repository.NewSaleRepository(db, bus),
+		Targets:   repository.NewTargetRepository(db, bus),
+		Users:     repository.NewUserRepository(db),
+		Geography: repository.NewGeographyRepository(db, bus),
+		Dashboard: repository.NewDashboardRepository(db),
+		Rollups:   repository.NewRollupRepository(db),
+
+		Compliance: repository.NewComplianceRepository(db),
+		AlertRules: repository.NewAlertRuleRepository(db),
+
+		Notifications: repository.NewNotificationRepository(db, cfg.NotificationTTL),
+		Webhooks:      repository.NewWebhookRepository(db),
+		Reports:       repository.NewReportRepository(db),
+		Analytics:     repository.NewAnalyticsRepository(db),
+		Territories:   repository.NewTerritoryRepository(db, bus),
+		Outlets:       repository.NewOutletRepository(db, bus),
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	// Writes drop the cached dashboards they make stale
+	bus.Subscribe(func(e events.Event) {
+		for _, scope := range e.Scopes {
+			if err := a.Cache.Invalidate(cache.ChangeTags(scope)...); err != nil {
+				a.Logger.Printf("cache: invalidating after %s: %v", e.Kind, err)
+			}
+		}
+	})
+
+	return a
+}
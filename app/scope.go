@@ -0,0 +1,44 @@
+package app
+
+import "slices"
+
+// ScopeProvinces returns the provinces the user of userUUID may see: for an
+// ASM those of their territory, or else their province, with [""] standing
+// for none at all. Other roles get nil and see every province.
+func (a *App) ScopeProvinces(userUUID string) []string {
+	user, err := a.Users.FindByUUID(userUUID)
+	if err != nil || user.Role != "ASM" {
+		return nil
+	}
+	if user.TerritoryUUID != nil {
+		provinces, err := a.Territories.Provinces(*user.TerritoryUUID)
+		if err != nil || len(provinces) == 0 {
+			return []string{""}
+		}
+		return provinces
+	}
+	if user.ProvinceUUID == nil {
+		// An ASM without a province sees no province at all
+		return []string{""}
+	}
+	return []string{*user.ProvinceUUID}
+}
+
+// NarrowProvinces keeps the provinces of requested inside scope, as returned
+// by ScopeProvinces. An empty request keeps the whole scope, and a request
+// reaching outside it keeps nothing, [""].
+func NarrowProvinces(scope, requested []string) []string {
+	if scope == nil {
+		return requested
+	}
+	if len(requested) == 0 {
+		return scope
+	}
+	narrowed := slices.DeleteFunc(slices.Clone(requested), func(uuid string) bool {
+		return !slices.Contains(scope, uuid)
+	})
+	if len(narrowed) == 0 {
+		return []string{""}
+	}
+	return narrowed
+}
@@ -0,0 +1,152 @@
+package apptest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// PGBinEnv is the environment variable naming the directory of the
+// PostgreSQL binaries used for a throwaway cluster, PATH by default
+const PGBinEnv = "PG_BIN"
+
+// cluster is the throwaway PostgreSQL server of the test process, started on
+// first use when TEST_DATABASE_DSN is not set
+var cluster struct {
+	once sync.Once
+	dir  string
+	cmd  *exec.Cmd
+	// exited receives the outcome of the server once it stops
+	exited chan error
+	logs   bytes.Buffer
+	dsn    string
+	err    error
+}
+
+// errNoPostgres is returned when no PostgreSQL binaries are found
+var errNoPostgres = errors.New("initdb and postgres not found on PATH or in " + PGBinEnv)
+
+// testDSN returns TEST_DATABASE_DSN, or else the DSN of a throwaway cluster.
+// Without either, the test is skipped, or failed when CI is set so a pipeline
+// never passes without running the database tests.
+func testDSN(tb testing.TB) string {
+	tb.Helper()
+
+	if dsn := os.Getenv(DSNEnv); dsn != "" {
+		return dsn
+	}
+	cluster.once.Do(func() {
+		cluster.dsn, cluster.err = startCluster()
+	})
+	switch {
+	case cluster.err == nil:
+		return cluster.dsn
+	case errors.Is(cluster.err, errNoPostgres) && os.Getenv("CI") == "":
+		tb.Skipf("%s is not set and %v, skipping database test", DSNEnv, cluster.err)
+	default:
+		tb.Fatalf("%s is not set and no throwaway PostgreSQL could be started: %v", DSNEnv, cluster.err)
+	}
+	return ""
+}
+
+// pgBinary finds the PostgreSQL program name
+func pgBinary(name string) (string, error) {
+	if dir := os.Getenv(PGBinEnv); dir != "" {
+		return exec.LookPath(filepath.Join(dir, name))
+	}
+	return exec.LookPath(name)
+}
+
+// startCluster initializes a cluster in a temporary directory and serves it
+// on a free local port, trusting every connection
+func startCluster() (string, error) {
+	initdb, err := pgBinary("initdb")
+	if err != nil {
+		return "", errNoPostgres
+	}
+	postgres, err := pgBinary("postgres")
+	if err != nil {
+		return "", errNoPostgres
+	}
+
+	dir, err := os.MkdirTemp("", "apptest-pg-")
+	if err != nil {
+		return "", err
+	}
+	cluster.dir = dir
+	data := filepath.Join(dir, "data")
+	out, err := exec.Command(initdb, "-D", data, "-U", "postgres", "-A", "trust", "-E", "UTF8", "--no-sync").CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("initdb: %v: %s", err, out)
+	}
+
+	port, err := freePort()
+	if err != nil {
+		return "", err
+	}
+	cluster.cmd = exec.Command(postgres, "-D", data, "-p", strconv.Itoa(port), "-k", dir,
+		"-c", "listen_addresses=127.0.0.1", "-c", "fsync=off", "-c", "full_page_writes=off")
+	cluster.cmd.Stdout, cluster.cmd.Stderr = &cluster.logs, &cluster.logs
+	if err := cluster.cmd.Start(); err != nil {
+		return "", fmt.Errorf("postgres: %w", err)
+	}
+	cluster.exited = make(chan error, 1)
+	go func() { cluster.exited <- cluster.cmd.Wait() }()
+
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	for deadline := time.Now().Add(30 * time.Second); ; time.Sleep(100 * time.Millisecond) {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			break
+		}
+		select {
+		case err := <-cluster.exited:
+			cluster.cmd = nil
+			return "", fmt.Errorf("postgres exited: %v: %s", err, cluster.logs.String())
+		default:
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("postgres did not accept connections on %s", addr)
+		}
+	}
+	return fmt.Sprintf("host=127.0.0.1 port=%d user=postgres dbname=postgres sslmode=disable", port), nil
+}
+
+// freePort returns a local TCP port nothing listens on
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// stopCluster stops the throwaway cluster, if any, and removes its files
+func stopCluster() {
+	if cluster.cmd != nil {
+		cluster.cmd.Process.Signal(os.Interrupt)
+		<-cluster.exited
+	}
+	if cluster.dir != "" {
+		os.RemoveAll(cluster.dir)
+	}
+}
+
+// Main runs the tests of a package and then stops the throwaway cluster they
+// may have started. Packages using New call it from TestMain:
+//
+//	func TestMain(m *testing.M) { apptest.Main(m) }
+func Main(m *testing.M) {
+	code := m.Run()
+	stopCluster()
+	os.Exit(code)
+}
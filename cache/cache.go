@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/Danny19977/sr-api/events"
+)
+
+// Entry is a cached response body with its validators
+type Entry struct {
+	Body         []byte    `json:"body"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// Store keeps entries by key and drops them by tag
+type Store interface {
+	// Get returns the entry stored under key, nil when missing or expired
+	Get(key string) (*Entry, error)
+	// Set stores entry under key for ttl and attaches it to tags
+	Set(key string, entry *Entry, tags []string, ttl time.Duration) error
+	// Invalidate drops every entry attached to one of tags
+	Invalidate(tags ...string) error
+}
+
+// nopStore caches nothing
+type nopStore struct{}
+
+// Nop returns a Store that never holds an entry, used when caching is disabled
+func Nop() Store {
+	return nopStore{}
+}
+
+func (nopStore) Get(string) (*Entry, error)                        { return nil, nil }
+func (nopStore) Set(string, *Entry, []string, time.Duration) error { return nil }
+func (nopStore) Invalidate(...string) error                        { return nil }
+
+// tagAll is attached to every entry so an unbounded change drops them all
+const tagAll = "all"
+
+// allProvinces is the scope tag of entries computed over every province
+const allProvinces = "*"
+
+// months lists the UTC months overlapped by from and to, padded by a day on
+// both sides so local day boundaries never fall outside of the tagged months
+func months(from, to time.Time) []string {
+	from, to = from.UTC().AddDate(0, 0, -1), to.UTC().AddDate(0, 0, 1)
+
+	var out []string
+	month := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for !month.After(to) {
+		out = append(out, month.Format("2006-01"))
+		month = month.AddDate(0, 1, 0)
+	}
+	return out
+}
+
+// EntryTags are the tags of an entry computed from the data of provinceUUIDs
+// (every province when empty) between from and to
+func EntryTags(provinceUUIDs []string, from, to time.Time) []string {
+	scopes := provinceUUIDs
+	if len(scopes) == 0 {
+		scopes = []string{allProvinces}
+	}
+
+	tags := []string{tagAll}
+	for _, month := range months(from, to) {
+		tags = append(tags, month)
+		for _, scope := range scopes {
+			tags = append(tags, scope+":"+month)
+		}
+	}
+	return tags
+}
+
+// ChangeTags are the tags of the entries made stale by a write to scope
+func ChangeTags(scope events.Scope) []string {
+	if scope.From.IsZero() || scope.To.IsZero() {
+		return []string{tagAll}
+	}
+
+	var tags []string
+	for _, month := range months(scope.From, scope.To) {
+		if scope.ProvinceUUID == "" {
+			tags = append(tags, month)
+			continue
+		}
+		tags = append(tags, scope.ProvinceUUID+":"+month, allProvinces+":"+month)
+	}
+	return tags
+}
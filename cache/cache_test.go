@@ -0,0 +1,189 @@
+package cache
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Danny19977/sr-api/events"
+)
+
+func entry(body string) *Entry {
+	return &Entry{Body: []byte(body), ETag: `"` + body + `"`, LastModified: time.Unix(0, 0).UTC()}
+}
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	store := NewLRU(2)
+	store.Set("a", entry("a"), nil, time.Minute)
+	store.Set("b", entry("b"), nil, time.Minute)
+	store.Get("a")
+	store.Set("c", entry("c"), nil, time.Minute)
+
+	if got, _ := store.Get("b"); got != nil {
+		t.Errorf("b should have been evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if got, _ := store.Get(key); got == nil {
+			t.Errorf("%s should still be cached", key)
+		}
+	}
+}
+
+func TestLRUExpiresEntries(t *testing.T) {
+	store := NewLRU(2)
+	store.Set("a", entry("a"), nil, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	if got, _ := store.Get("a"); got != nil {
+		t.Errorf("expired entry was returned")
+	}
+}
+
+func TestChangesDropOnlyOverlappingEntries(t *testing.T) {
+	march := time.Date(2025, time.March, 10, 12, 0, 0, 0, time.UTC)
+	july := time.Date(2025, time.July, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		scope   events.Scope
+		dropped []string
+	}{
+		{"sale of the filtered province", events.Scope{ProvinceUUID: "p1", From: march, To: march}, []string{"all-march", "p1-march"}},
+		{"sale of another province", events.Scope{ProvinceUUID: "p2", From: march, To: march}, []string{"all-march"}},
+		{"sale of another month", events.Scope{ProvinceUUID: "p1", From: july, To: july}, nil},
+		{"target of every province", events.Scope{From: march, To: march}, []string{"all-march", "p1-march"}},
+		{"unbounded change", events.Scope{ProvinceUUID: "p2"}, []string{"all-march", "p1-march"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewLRU(10)
+			store.Set("all-march", entry("all"), EntryTags(nil, march, march), time.Minute)
+			store.Set("p1-march", entry("p1"), EntryTags([]string{"p1"}, march, march), time.Minute)
+
+			store.Invalidate(ChangeTags(tt.scope)...)
+
+			dropped := map[string]bool{}
+			for _, key := range tt.dropped {
+				dropped[key] = true
+			}
+			for _, key := range []string{"all-march", "p1-march"} {
+				got, _ := store.Get(key)
+				if dropped[key] && got != nil {
+					t.Errorf("%s should have been dropped", key)
+				}
+				if !dropped[key] && got == nil {
+					t.Errorf("%s should have been kept", key)
+				}
+			}
+		})
+	}
+}
+
+// fakeRedis serves the commands used by redisStore from memory
+type fakeRedis struct {
+	mu     sync.Mutex
+	values map[string]string
+	sets   map[string]map[string]bool
+}
+
+func (f *fakeRedis) serve(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			r := bufio.NewReader(conn)
+			for {
+				reply, err := readReply(r)
+				if err != nil {
+					return
+				}
+				var args []string
+				for _, arg := range reply.([]interface{}) {
+					args = append(args, string(arg.([]byte)))
+				}
+				conn.Write([]byte(f.exec(args)))
+			}
+		}()
+	}
+}
+
+func (f *fakeRedis) exec(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		value, ok := f.values[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return "$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"
+	case "SET":
+		f.values[args[1]] = args[2]
+		return "+OK\r\n"
+	case "SADD":
+		if f.sets[args[1]] == nil {
+			f.sets[args[1]] = map[string]bool{}
+		}
+		f.sets[args[1]][args[2]] = true
+		return ":1\r\n"
+	case "PEXPIRE":
+		return ":1\r\n"
+	case "SMEMBERS":
+		out := "*" + strconv.Itoa(len(f.sets[args[1]])) + "\r\n"
+		for member := range f.sets[args[1]] {
+			out += "$" + strconv.Itoa(len(member)) + "\r\n" + member + "\r\n"
+		}
+		return out
+	case "DEL":
+		for _, key := range args[1:] {
+			delete(f.values, key)
+			delete(f.sets, key)
+		}
+		return ":" + strconv.Itoa(len(args)-1) + "\r\n"
+	default:
+		return "-ERR unknown command\r\n"
+	}
+}
+
+func TestRedisStoreRoundTrip(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	defer listener.Close()
+
+	fake := &fakeRedis{values: map[string]string{}, sets: map[string]map[string]bool{}}
+	go fake.serve(listener)
+
+	store := NewRedis(RedisOptions{Addr: listener.Addr().String(), Prefix: "test:"})
+	if err := store.Set("a", entry("a"), []string{"x", "y"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("b", entry("b"), []string{"y"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.Get("a")
+	if err != nil || got == nil || string(got.Body) != "a" || got.ETag != `"a"` {
+		t.Fatalf("Get(a) = %+v, %v", got, err)
+	}
+
+	if err := store.Invalidate("x"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := store.Get("a"); got != nil {
+		t.Errorf("a should have been dropped with tag x")
+	}
+	if got, _ := store.Get("b"); got == nil {
+		t.Errorf("b should have been kept")
+	}
+}
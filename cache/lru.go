@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lruStore is an in-process Store evicting the least recently used entry
+// once it holds capacity entries
+type lruStore struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	items    map[string]*list.Element
+	tags     map[string]map[string]struct{}
+}
+
+type lruItem struct {
+	key     string
+	entry   *Entry
+	tags    []string
+	expires time.Time
+}
+
+// NewLRU creates an in-process Store holding at most capacity entries
+func NewLRU(capacity int) Store {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &lruStore{
+		capacity: capacity,
+		order:    list.New(),
+		items:    map[string]*list.Element{},
+		tags:     map[string]map[string]struct{}{},
+	}
+}
+
+func (s *lruStore) Get(key string) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.items[key]
+	if !ok {
+		return nil, nil
+	}
+	item := element.Value.(*lruItem)
+	if time.Now().After(item.expires) {
+		s.remove(element)
+		return nil, nil
+	}
+
+	s.order.MoveToFront(element)
+	return item.entry, nil
+}
+
+func (s *lruStore) Set(key string, entry *Entry, tags []string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.items[key]; ok {
+		s.remove(element)
+	}
+
+	s.items[key] = s.order.PushFront(&lruItem{key: key, entry: entry, tags: tags, expires: time.Now().Add(ttl)})
+	for _, tag := range tags {
+		if s.tags[tag] == nil {
+			s.tags[tag] = map[string]struct{}{}
+		}
+		s.tags[tag][key] = struct{}{}
+	}
+
+	for s.order.Len() > s.capacity {
+		s.remove(s.order.Back())
+	}
+	return nil
+}
+
+func (s *lruStore) Invalidate(tags ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, tag := range tags {
+		for key := range s.tags[tag] {
+			if element, ok := s.items[key]; ok {
+				s.remove(element)
+			}
+		}
+	}
+	return nil
+}
+
+// remove drops element from the list, the key index and the tag index
+func (s *lruStore) remove(element *list.Element) {
+	item := element.Value.(*lruItem)
+	s.order.Remove(element)
+	delete(s.items, item.key)
+	for _, tag := range item.tags {
+		delete(s.tags[tag], item.key)
+		if len(s.tags[tag]) == 0 {
+			delete(s.tags, tag)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// RedisOptions locate a Redis-compatible server
+type RedisOptions struct {
+	Addr     string
+	Password string
+	DB       int
+	// Prefix namespaces the keys of this application
+	Prefix string
+	// PoolSize is the number of idle connections kept open
+	PoolSize int
+	Timeout  time.Duration
+}
+
+// redisStore is a Store on a Redis-compatible server. It speaks the RESP
+// protocol directly and keeps one set of entry keys per tag.
+type redisStore struct {
+	opts RedisOptions
+	pool chan *respConn
+}
+
+// NewRedis creates a Store on the server described by opts. Connections are
+// opened on first use, so an unreachable server surfaces on Get and Set.
+func NewRedis(opts RedisOptions) Store {
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = 4
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 2 * time.Second
+	}
+	return &redisStore{opts: opts, pool: make(chan *respConn, opts.PoolSize)}
+}
+
+func (s *redisStore) entryKey(key string) string {
+	return s.opts.Prefix + "entry:" + key
+}
+
+func (s *redisStore) tagKey(tag string) string {
+	return s.opts.Prefix + "tag:" + tag
+}
+
+func (s *redisStore) Get(key string) (*Entry, error) {
+	replies, err := s.do([]string{"GET", s.entryKey(key)})
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := replies[0].([]byte)
+	if !ok {
+		return nil, nil
+	}
+
+	entry := &Entry{}
+	if err := json.Unmarshal(raw, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (s *redisStore) Set(key string, entry *Entry, tags []string, ttl time.Duration) error {
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	ms := strconv.FormatInt(ttl.Milliseconds(), 10)
+	commands := [][]string{{"SET", s.entryKey(key), string(raw), "PX", ms}}
+	for _, tag := range tags {
+		commands = append(commands,
+			[]string{"SADD", s.tagKey(tag), key},
+			[]string{"PEXPIRE", s.tagKey(tag), ms},
+		)
+	}
+
+	_, err = s.do(commands...)
+	return err
+}
+
+func (s *redisStore) Invalidate(tags ...string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	commands := make([][]string, len(tags))
+	for i, tag := range tags {
+		commands[i] = []string{"SMEMBERS", s.tagKey(tag)}
+	}
+	replies, err := s.do(commands...)
+	if err != nil {
+		return err
+	}
+
+	del := []string{"DEL"}
+	for i, reply := range replies {
+		members, _ := reply.([]interface{})
+		for _, member := range members {
+			if key, ok := member.([]byte); ok {
+				del = append(del, s.entryKey(string(key)))
+			}
+		}
+		del = append(del, s.tagKey(tags[i]))
+	}
+
+	_, err = s.do(del)
+	return err
+}
+
+// do pipelines commands on a pooled connection and returns one reply each
+func (s *redisStore) do(commands ...[]string) ([]interface{}, error) {
+	conn, err := s.acquire()
+	if err != nil {
+		return nil, err
+	}
+
+	replies, err := conn.pipeline(s.opts.Timeout, commands...)
+	if err != nil {
+		var serverErr redisError
+		if !errors.As(err, &serverErr) {
+			// The connection state is unknown after an I/O error
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	select {
+	case s.pool <- conn:
+	default:
+		conn.Close()
+	}
+	return replies, err
+}
+
+func (s *redisStore) acquire() (*respConn, error) {
+	select {
+	case conn := <-s.pool:
+		return conn, nil
+	default:
+	}
+
+	netConn, err := net.DialTimeout("tcp", s.opts.Addr, s.opts.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("cache: connecting to %s: %w", s.opts.Addr, err)
+	}
+	conn := &respConn{Conn: netConn, reader: bufio.NewReader(netConn)}
+
+	var setup [][]string
+	if s.opts.Password != "" {
+		setup = append(setup, []string{"AUTH", s.opts.Password})
+	}
+	if s.opts.DB != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(s.opts.DB)})
+	}
+	if len(setup) > 0 {
+		if _, err := conn.pipeline(s.opts.Timeout, setup...); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("cache: preparing connection: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// redisError is an error reply of the server
+type redisError string
+
+func (e redisError) Error() string {
+	return "cache: server replied " + string(e)
+}
+
+// respConn is a connection speaking RESP
+type respConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// pipeline writes every command then reads their replies in order. The first
+// error reply is returned after all replies have been read.
+func (c *respConn) pipeline(timeout time.Duration, commands ...[]string) ([]interface{}, error) {
+	if err := c.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	w := bufio.NewWriter(c.Conn)
+	for _, command := range commands {
+		fmt.Fprintf(w, "*%d\r\n", len(command))
+		for _, arg := range command {
+			fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+
+	var firstErr error
+	replies := make([]interface{}, len(commands))
+	for i := range commands {
+		reply, err := readReply(c.reader)
+		if serverErr, ok := err.(redisError); ok {
+			if firstErr == nil {
+				firstErr = serverErr
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = reply
+	}
+	return replies, firstErr
+}
+
+// readReply decodes one RESP value: strings and integers as string and
+// int64, bulk strings as []byte, arrays as []interface{} and nulls as nil
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("cache: malformed reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		size, err := strconv.Atoi(body)
+		if err != nil || size < 0 {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:size], nil
+	case '*':
+		count, err := strconv.Atoi(body)
+		if err != nil || count < 0 {
+			return nil, err
+		}
+		values := make([]interface{}, count)
+		for i := range values {
+			// Error replies nested in arrays are kept as values
+			value, err := readReply(r)
+			if serverErr, ok := err.(redisError); ok {
+				value, err = serverErr, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("cache: unknown reply type %q", kind)
+	}
+}
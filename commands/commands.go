@@ -0,0 +1,107 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Danny19977/sr-api/app"
+	"github.com/Danny19977/sr-api/config"
+	"github.com/Danny19977/sr-api/database"
+	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/utils"
+)
+
+// Command describes a subcommand of the sr-api binary
+type Command struct {
+	Name    string
+	Summary string
+	Run     func(args []string) error
+}
+
+// defaultCommand runs when the binary is started without a subcommand,
+// so existing deployments that only execute the binary keep serving HTTP
+const defaultCommand = "serve"
+
+func registry() []Command {
+	return []Command{
+		{Name: "serve", Summary: "Start the HTTP API server", Run: Serve},
+		{Name: "migrate", Summary: "Apply the database schema", Run: Migrate},
+		{Name: "seed", Summary: "Load countries, provinces, products and years from a YAML/JSON fixture", Run: Seed},
+		{Name: "create-admin", Summary: "Create an administrator account", Run: CreateAdmin},
+		{Name: "import-sales", Summary: "Bulk import sales from a CSV or JSON file", Run: ImportSales},
+		{Name: "export", Summary: "Bulk export an entity to CSV or JSON", Run: Export},
+		{Name: "rebuild-rollups", Summary: "Recompute the sales rollup tables", Run: RebuildRollups},
+		{Name: "purge-notifications", Summary: "Delete the notifications past their expiry", Run: PurgeNotifications},
+	}
+}
+
+// Run dispatches args (without the program name) to the matching subcommand
+func Run(args []string) error {
+	name := defaultCommand
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name = args[0]
+		args = args[1:]
+	}
+
+	if name == "help" || name == "-h" || name == "--help" {
+		Usage(os.Stdout)
+		return nil
+	}
+
+	for _, cmd := range registry() {
+		if cmd.Name == name {
+			return cmd.Run(args)
+		}
+	}
+
+	Usage(os.Stderr)
+	return fmt.Errorf("unknown command %q", name)
+}
+
+// Usage prints the list of available subcommands
+func Usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: sr-api <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range registry() {
+		fmt.Fprintf(w, "  %-20s %s\n", cmd.Name, cmd.Summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'sr-api <command> -h' for the flags of a command.")
+}
+
+// bootstrap loads and validates the configuration once, connects the shared
+// database and builds the application container every subcommand works with
+func bootstrap(flags *config.Flags) (*app.App, error) {
+	cfg, err := config.Load(flags)
+	if err != nil {
+		return nil, err
+	}
+
+	utils.ConfigureJWT(cfg.Auth.SecretKey, cfg.Auth.TokenTTL)
+	db, err := database.Connect(cfg.Database)
+	if err != nil {
+		return nil, err
+	}
+
+	return app.New(cfg, db), nil
+}
+
+// migrate applies the schema, mirrors the countries and provinces into the
+// territory tree and backfills the sales rollups the first time their tables
+// are created
+func migrate(a *app.App) error {
+	backfill := !a.DB.Migrator().HasTable(&models.SalesMonthlyRollup{})
+	if err := database.Migrate(a.DB); err != nil {
+		return err
+	}
+	if err := a.Territories.Sync(); err != nil {
+		return err
+	}
+	if backfill {
+		return a.Rollups.Rebuild(nil)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/Danny19977/sr-api/config"
+	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/utils"
+)
+
+// CreateAdmin creates an active administrator without going through the
+// public register route
+func CreateAdmin(args []string) error {
+	fs := flag.NewFlagSet("create-admin", flag.ExitOnError)
+	cfgFlags := config.BindFlags(fs)
+	fullname := fs.String("fullname", "Administrator", "full name of the administrator")
+	email := fs.String("email", "", "login email (required)")
+	phone := fs.String("phone", "", "login phone number")
+	password := fs.String("password", "", "initial password (required)")
+	role := fs.String("role", "Admin", "role assigned to the account")
+	permission := fs.String("permission", "ALL", "permission assigned to the account")
+	fs.Parse(args)
+
+	if *email == "" || *password == "" {
+		return fmt.Errorf("create-admin: -email and -password are required")
+	}
+
+	a, err := bootstrap(cfgFlags)
+	if err != nil {
+		return err
+	}
+	if err := migrate(a); err != nil {
+		return err
+	}
+
+	var existing int64
+	a.DB.Model(&models.User{}).Where("email = ?", *email).Count(&existing)
+	if existing > 0 {
+		return fmt.Errorf("create-admin: a user with email %s already exists", *email)
+	}
+
+	u := &models.User{
+		UUID:       utils.GenerateUUID(),
+		Fullname:   *fullname,
+		Email:      *email,
+		Phone:      *phone,
+		Role:       *role,
+		Permission: *permission,
+		Status:     true,
+		Signature:  "create-admin",
+	}
+
+	if err := a.Users.Create(u, *password); err != nil {
+		return fmt.Errorf("create-admin: %w", err)
+	}
+
+	fmt.Printf("Admin %s created with uuid %s 🎉!\n", u.Email, u.UUID)
+	return nil
+}
@@ -0,0 +1,192 @@
+package commands
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/Danny19977/sr-api/config"
+)
+
+// exportTables maps the exportable entities to their table and the columns
+// that must never leave the database
+var exportTables = map[string]struct {
+	table   string
+	omitted []string
+}{
+	"sales":     {table: "sales"},
+	"countries": {table: "countries"},
+	"provinces": {table: "provinces"},
+	"products":  {table: "products"},
+	"users":     {table: "users", omitted: []string{"password", "conform_password"}},
+	"years":     {table: "years"},
+	"months":    {table: "months"},
+	"weeks":     {table: "weeks"},
+}
+
+// Export streams every row of an entity to a CSV or JSON file
+func Export(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	cfgFlags := config.BindFlags(fs)
+	entity := fs.String("entity", "sales", "entity to export: sales, countries, provinces, products, users, years, months, weeks")
+	format := fs.String("format", "csv", "output format: csv or json")
+	out := fs.String("out", "", "output file (defaults to stdout)")
+	from := fs.String("from", "", "only rows created on or after this date (YYYY-MM-DD)")
+	to := fs.String("to", "", "only rows created before this date (YYYY-MM-DD)")
+	fs.Parse(args)
+
+	spec, ok := exportTables[*entity]
+	if !ok {
+		return fmt.Errorf("export: unknown entity %q", *entity)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	a, err := bootstrap(cfgFlags)
+	if err != nil {
+		return err
+	}
+
+	query := a.DB.Table(spec.table).Order("created_at")
+	if *from != "" {
+		start, err := time.Parse("2006-01-02", *from)
+		if err != nil {
+			return fmt.Errorf("export: invalid -from: %w", err)
+		}
+		query = query.Where("created_at >= ?", start)
+	}
+	if *to != "" {
+		end, err := time.Parse("2006-01-02", *to)
+		if err != nil {
+			return fmt.Errorf("export: invalid -to: %w", err)
+		}
+		query = query.Where("created_at < ?", end)
+	}
+
+	rows, err := query.Rows()
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	defer rows.Close()
+
+	switch *format {
+	case "csv":
+		err = writeRowsCSV(w, rows, spec.omitted)
+	case "json":
+		err = writeRowsJSON(w, rows, spec.omitted)
+	default:
+		return fmt.Errorf("export: unknown format %q", *format)
+	}
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+
+	if *out != "" {
+		fmt.Fprintf(os.Stderr, "%s exported to %s 🎉!\n", *entity, *out)
+	}
+	return nil
+}
+
+// scanRow reads the current row into strings keyed by column, skipping omitted columns
+func scanRow(rows *sql.Rows, columns []string, omitted map[string]bool) ([]string, []string, error) {
+	values := make([]sql.NullString, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return nil, nil, err
+	}
+
+	var names, out []string
+	for i, col := range columns {
+		if omitted[col] {
+			continue
+		}
+		names = append(names, col)
+		out = append(out, values[i].String)
+	}
+	return names, out, nil
+}
+
+func omittedSet(omitted []string) map[string]bool {
+	set := map[string]bool{}
+	for _, col := range omitted {
+		set[col] = true
+	}
+	return set
+}
+
+func writeRowsCSV(w io.Writer, rows *sql.Rows, omitted []string) error {
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	skip := omittedSet(omitted)
+
+	cw := csv.NewWriter(w)
+	headerWritten := false
+	for rows.Next() {
+		names, values, err := scanRow(rows, columns, skip)
+		if err != nil {
+			return err
+		}
+		if !headerWritten {
+			if err := cw.Write(names); err != nil {
+				return err
+			}
+			headerWritten = true
+		}
+		if err := cw.Write(values); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeRowsJSON(w io.Writer, rows *sql.Rows, omitted []string) error {
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	skip := omittedSet(omitted)
+
+	io.WriteString(w, "[")
+	first := true
+	for rows.Next() {
+		names, values, err := scanRow(rows, columns, skip)
+		if err != nil {
+			return err
+		}
+		obj := make(map[string]string, len(names))
+		for i, name := range names {
+			obj[name] = values[i]
+		}
+		line, err := json.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		if !first {
+			io.WriteString(w, ",")
+		}
+		io.WriteString(w, "\n  ")
+		w.Write(line)
+		first = false
+	}
+	_, err = io.WriteString(w, "\n]\n")
+	return err
+}
@@ -0,0 +1,256 @@
+package commands
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Danny19977/sr-api/config"
+	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/utils"
+	"gorm.io/gorm"
+)
+
+// SaleRecord is one row of an import file. Province, product and user may be
+// given either by UUID or by name (email for users). Country, by UUID or
+// name, picks the province among those of the same name in several countries.
+type SaleRecord struct {
+	Country   string `json:"country"`
+	Province  string `json:"province"`
+	Product   string `json:"product"`
+	User      string `json:"user"`
+	Quantity  int64  `json:"quantity"`
+	CreatedAt string `json:"created_at"`
+}
+
+// ImportSales bulk loads sales from a CSV (with header) or JSON array file
+func ImportSales(args []string) error {
+	fs := flag.NewFlagSet("import-sales", flag.ExitOnError)
+	cfgFlags := config.BindFlags(fs)
+	file := fs.String("file", "", "path to a .csv or .json file")
+	batch := fs.Int("batch", 500, "rows inserted per batch")
+	dryRun := fs.Bool("dry-run", false, "validate the file without writing")
+	fs.Parse(args)
+
+	if *file == "" {
+		return fmt.Errorf("import-sales: -file is required")
+	}
+
+	records, err := readSaleRecords(*file)
+	if err != nil {
+		return err
+	}
+
+	a, err := bootstrap(cfgFlags)
+	if err != nil {
+		return err
+	}
+
+	resolver := newReferenceResolver(a.DB)
+	sales := make([]models.Sale, 0, len(records))
+	for i, r := range records {
+		s, err := resolver.toSale(r)
+		if err != nil {
+			return fmt.Errorf("import-sales: row %d: %w", i+1, err)
+		}
+		sales = append(sales, s)
+	}
+
+	if *dryRun {
+		fmt.Printf("%d sales are valid, nothing written (dry run)\n", len(sales))
+		return nil
+	}
+
+	if err := a.Sales.CreateBatch(sales, max(*batch, 1)); err != nil {
+		return fmt.Errorf("import-sales: %w", err)
+	}
+
+	fmt.Printf("%d sales imported 🎉!\n", len(sales))
+	return nil
+}
+
+func readSaleRecords(path string) ([]SaleRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		var records []SaleRecord
+		if err := json.NewDecoder(f).Decode(&records); err != nil {
+			return nil, fmt.Errorf("invalid JSON in %s: %w", path, err)
+		}
+		return records, nil
+	case ".csv":
+		return readSaleCSV(f)
+	default:
+		return nil, fmt.Errorf("unsupported import format %q", filepath.Ext(path))
+	}
+}
+
+func readSaleCSV(r io.Reader) ([]SaleRecord, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("missing CSV header: %w", err)
+	}
+
+	columns := map[string]int{}
+	for i, h := range header {
+		columns[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	for _, required := range []string{"province", "product", "user", "quantity"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("missing CSV column %q", required)
+		}
+	}
+
+	get := func(row []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	var records []SaleRecord
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		quantity, err := strconv.ParseInt(get(row, "quantity"), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid quantity", line)
+		}
+
+		records = append(records, SaleRecord{
+			Country:   get(row, "country"),
+			Province:  get(row, "province"),
+			Product:   get(row, "product"),
+			User:      get(row, "user"),
+			Quantity:  quantity,
+			CreatedAt: get(row, "created_at"),
+		})
+	}
+
+	return records, nil
+}
+
+// referenceResolver caches lookups of provinces, products and users by name
+type referenceResolver struct {
+	db        *gorm.DB
+	provinces map[string]string
+	products  map[string]string
+	users     map[string]string
+}
+
+func newReferenceResolver(db *gorm.DB) *referenceResolver {
+	return &referenceResolver{
+		db:        db,
+		provinces: map[string]string{},
+		products:  map[string]string{},
+		users:     map[string]string{},
+	}
+}
+
+// errAmbiguous is returned for a name shared by several rows
+var errAmbiguous = errors.New("ambiguous reference")
+
+// lookup resolves key to the UUID of the row of query whose UUID or column
+// equals key, caching it under cacheKey. A key matching several rows is
+// refused rather than resolved to one of them.
+func (r *referenceResolver) lookup(cache map[string]string, cacheKey string, query *gorm.DB, column, key string) (string, error) {
+	if uuid, ok := cache[cacheKey]; ok {
+		return uuid, nil
+	}
+
+	var uuids []string
+	err := query.Where("uuid = ? OR "+column+" = ?", key, key).Limit(2).Pluck("uuid", &uuids).Error
+	if err != nil {
+		return "", err
+	}
+	switch len(uuids) {
+	case 0:
+		return "", fmt.Errorf("unknown reference %q", key)
+	case 1:
+		cache[cacheKey] = uuids[0]
+		return uuids[0], nil
+	default:
+		return "", fmt.Errorf("%w %q", errAmbiguous, key)
+	}
+}
+
+// province resolves a province, within country when given
+func (r *referenceResolver) province(key, country string) (string, error) {
+	query := r.db.Model(&models.Province{})
+	if country != "" {
+		query = query.Where("country_uuid IN (?)",
+			r.db.Model(&models.Country{}).Select("uuid").Where("uuid = ? OR name = ?", country, country))
+	}
+	uuid, err := r.lookup(r.provinces, country+"\x00"+key, query, "name", key)
+	if errors.Is(err, errAmbiguous) && country == "" {
+		return "", fmt.Errorf("%w, give its country", err)
+	}
+	return uuid, err
+}
+
+func (r *referenceResolver) toSale(rec SaleRecord) (models.Sale, error) {
+	provinceUUID, err := r.province(rec.Province, rec.Country)
+	if err != nil {
+		return models.Sale{}, fmt.Errorf("province: %w", err)
+	}
+	productUUID, err := r.lookup(r.products, rec.Product, r.db.Model(&models.Product{}), "name", rec.Product)
+	if err != nil {
+		return models.Sale{}, fmt.Errorf("product: %w", err)
+	}
+	userUUID, err := r.lookup(r.users, rec.User, r.db.Model(&models.User{}), "email", rec.User)
+	if err != nil {
+		return models.Sale{}, fmt.Errorf("user: %w", err)
+	}
+	if rec.Quantity < 0 {
+		return models.Sale{}, fmt.Errorf("quantity must not be negative")
+	}
+
+	s := models.Sale{
+		UUID:         utils.GenerateUUID(),
+		ProvinceUUID: provinceUUID,
+		ProductUUID:  productUUID,
+		UserUUID:     userUUID,
+		Quantity:     rec.Quantity,
+		Signature:    "import-sales",
+	}
+
+	if rec.CreatedAt != "" {
+		createdAt, err := parseImportTime(rec.CreatedAt)
+		if err != nil {
+			return models.Sale{}, fmt.Errorf("created_at: %w", err)
+		}
+		s.CreatedAt = createdAt
+		s.UpdatedAt = createdAt
+	}
+
+	return s, nil
+}
+
+func parseImportTime(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unsupported time %q", value)
+}
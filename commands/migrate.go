@@ -0,0 +1,26 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/Danny19977/sr-api/config"
+)
+
+// Migrate applies the schema of every model without starting the server
+func Migrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	cfgFlags := config.BindFlags(fs)
+	fs.Parse(args)
+
+	a, err := bootstrap(cfgFlags)
+	if err != nil {
+		return err
+	}
+	if err := migrate(a); err != nil {
+		return fmt.Errorf("migration failed: %w", err)
+	}
+
+	fmt.Println("Migrations applied 🎉!")
+	return nil
+}
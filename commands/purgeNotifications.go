@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/Danny19977/sr-api/app"
+	"github.com/Danny19977/sr-api/config"
+)
+
+// notificationPurgeInterval is how often the server deletes expired notifications
+const notificationPurgeInterval = time.Hour
+
+// PurgeNotifications deletes the notifications past their expiry once
+func PurgeNotifications(args []string) error {
+	fs := flag.NewFlagSet("purge-notifications", flag.ExitOnError)
+	cfgFlags := config.BindFlags(fs)
+	fs.Parse(args)
+
+	a, err := bootstrap(cfgFlags)
+	if err != nil {
+		return err
+	}
+	purged, err := a.Notifications.Purge(time.Now())
+	if err != nil {
+		return fmt.Errorf("purge-notifications: %w", err)
+	}
+
+	fmt.Printf("%d expired notifications purged 🎉!\n", purged)
+	return nil
+}
+
+// purgeNotificationsEvery deletes the expired notifications every interval until ctx is done
+func purgeNotificationsEvery(ctx context.Context, a *app.App, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := a.Notifications.Purge(time.Now()); err != nil {
+			a.Logger.Printf("notifications: purging: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Danny19977/sr-api/config"
+)
+
+// RebuildRollups recomputes the sales rollup tables from the sales table,
+// e.g. after sales were written outside of the API
+func RebuildRollups(args []string) error {
+	fs := flag.NewFlagSet("rebuild-rollups", flag.ExitOnError)
+	cfgFlags := config.BindFlags(fs)
+	yearsFlag := fs.String("years", "", "comma-separated UTC years to rebuild (default: all)")
+	fs.Parse(args)
+
+	var years []int
+	for _, part := range strings.Split(*yearsFlag, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		year, err := strconv.Atoi(part)
+		if err != nil {
+			return fmt.Errorf("rebuild-rollups: invalid year %q", part)
+		}
+		years = append(years, year)
+	}
+
+	a, err := bootstrap(cfgFlags)
+	if err != nil {
+		return err
+	}
+	if err := a.Rollups.Rebuild(years); err != nil {
+		return fmt.Errorf("rebuild-rollups: %w", err)
+	}
+
+	fmt.Println("Sales rollups rebuilt 🎉!")
+	return nil
+}
@@ -0,0 +1,302 @@
+package commands
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Danny19977/sr-api/config"
+	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/utils"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// SeedFixture is the document accepted by the seed command
+type SeedFixture struct {
+	Countries []SeedCountry `json:"countries" yaml:"countries"`
+	Products  []string      `json:"products" yaml:"products"`
+	Years     []SeedYear    `json:"years" yaml:"years"`
+}
+
+type SeedCountry struct {
+	Name      string   `json:"name" yaml:"name"`
+	Provinces []string `json:"provinces" yaml:"provinces"`
+}
+
+type SeedYear struct {
+	Year     string      `json:"year" yaml:"year"`
+	Quantity string      `json:"quantity" yaml:"quantity"`
+	Months   []SeedMonth `json:"months" yaml:"months"`
+	Weeks    []SeedWeek  `json:"weeks" yaml:"weeks"`
+}
+
+// SeedMonth is a monthly target of a province, Month is the English month
+// name. Country is needed when the province name is used in several countries.
+type SeedMonth struct {
+	Month    string `json:"month" yaml:"month"`
+	Country  string `json:"country" yaml:"country"`
+	Province string `json:"province" yaml:"province"`
+	Product  string `json:"product" yaml:"product"`
+	Quantity string `json:"quantity" yaml:"quantity"`
+	Role     string `json:"role" yaml:"role"`
+}
+
+// SeedWeek is a weekly target of a province, Week is the ISO week number.
+// Country is needed when the province name is used in several countries.
+type SeedWeek struct {
+	Week     string `json:"week" yaml:"week"`
+	Month    string `json:"month" yaml:"month"`
+	Country  string `json:"country" yaml:"country"`
+	Province string `json:"province" yaml:"province"`
+	Product  string `json:"product" yaml:"product"`
+	Quantity string `json:"quantity" yaml:"quantity"`
+	Role     string `json:"role" yaml:"role"`
+}
+
+// Seed loads reference data from a fixture file. Existing rows are matched by
+// name so the command can be run repeatedly against the same database.
+func Seed(args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ExitOnError)
+	cfgFlags := config.BindFlags(fs)
+	file := fs.String("file", "", "path to a .yaml, .yml or .json fixture")
+	fs.Parse(args)
+
+	if *file == "" {
+		return fmt.Errorf("seed: -file is required")
+	}
+
+	fixture, err := loadSeedFixture(*file)
+	if err != nil {
+		return err
+	}
+
+	a, err := bootstrap(cfgFlags)
+	if err != nil {
+		return err
+	}
+	if err := migrate(a); err != nil {
+		return err
+	}
+
+	err = a.DB.Transaction(func(tx *gorm.DB) error {
+		return applySeedFixture(tx, fixture)
+	})
+	if err != nil {
+		return fmt.Errorf("seed failed: %w", err)
+	}
+	if err := a.Territories.Sync(); err != nil {
+		return fmt.Errorf("seed failed: %w", err)
+	}
+
+	fmt.Println("Seed completed 🎉!")
+	return nil
+}
+
+func loadSeedFixture(path string) (*SeedFixture, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fixture := &SeedFixture{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(raw, fixture)
+	case ".json":
+		err = json.Unmarshal(raw, fixture)
+	default:
+		return nil, fmt.Errorf("unsupported fixture format %q", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid fixture %s: %w", path, err)
+	}
+
+	return fixture, nil
+}
+
+func applySeedFixture(tx *gorm.DB, fixture *SeedFixture) error {
+	for _, sc := range fixture.Countries {
+		country := models.Country{}
+		if err := tx.Where("name = ?", sc.Name).Limit(1).Find(&country).Error; err != nil {
+			return err
+		}
+		if country.UUID == "" {
+			country = models.Country{UUID: utils.GenerateUUID(), Name: sc.Name, Signature: "seed"}
+			if err := tx.Create(&country).Error; err != nil {
+				return err
+			}
+			fmt.Printf("  + country %s\n", sc.Name)
+		}
+
+		for _, name := range sc.Provinces {
+			province := models.Province{}
+			if err := tx.Where("name = ? AND country_uuid = ?", name, country.UUID).Limit(1).Find(&province).Error; err != nil {
+				return err
+			}
+			if province.UUID == "" {
+				province = models.Province{UUID: utils.GenerateUUID(), Name: name, CountryUUID: country.UUID, Signature: "seed"}
+				if err := tx.Create(&province).Error; err != nil {
+					return err
+				}
+				fmt.Printf("  + province %s\n", name)
+			}
+		}
+	}
+
+	for _, name := range fixture.Products {
+		product := models.Product{}
+		if err := tx.Where("name = ?", name).Limit(1).Find(&product).Error; err != nil {
+			return err
+		}
+		if product.UUID == "" {
+			product = models.Product{UUID: utils.GenerateUUID(), Name: name, Signature: "seed"}
+			if err := tx.Create(&product).Error; err != nil {
+				return err
+			}
+			fmt.Printf("  + product %s\n", name)
+		}
+	}
+
+	for _, sy := range fixture.Years {
+		year := models.Year{}
+		if err := tx.Where("year = ?", sy.Year).Limit(1).Find(&year).Error; err != nil {
+			return err
+		}
+		if year.UUID == "" {
+			year = models.Year{UUID: utils.GenerateUUID(), Year: sy.Year, Quantity: sy.Quantity, Signature: "seed"}
+			if err := tx.Create(&year).Error; err != nil {
+				return err
+			}
+			fmt.Printf("  + year %s\n", sy.Year)
+		}
+
+		for _, sm := range sy.Months {
+			province, err := seedProvince(tx, sm.Province, sm.Country)
+			if err != nil {
+				return fmt.Errorf("month %s: %w", sm.Month, err)
+			}
+			productUUID, err := seedProduct(tx, sm.Product)
+			if err != nil {
+				return fmt.Errorf("month %s: %w", sm.Month, err)
+			}
+
+			month := models.Month{}
+			if err := tx.Where("month = ? AND province_uuid = ? AND product_uuid = ? AND year_uuid = ?", sm.Month, province.UUID, productUUID, year.UUID).Limit(1).Find(&month).Error; err != nil {
+				return err
+			}
+			if month.UUID == "" {
+				month = models.Month{
+					UUID:         utils.GenerateUUID(),
+					Month:        sm.Month,
+					Quantity:     sm.Quantity,
+					Role:         defaultString(sm.Role, "ASM"),
+					CountryUUID:  province.CountryUUID,
+					ProvinceUUID: province.UUID,
+					ProductUUID:  productUUID,
+					YearUUID:     year.UUID,
+					Signature:    "seed",
+				}
+				if err := tx.Create(&month).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, sw := range sy.Weeks {
+			province, err := seedProvince(tx, sw.Province, sw.Country)
+			if err != nil {
+				return fmt.Errorf("week %s: %w", sw.Week, err)
+			}
+			productUUID, err := seedProduct(tx, sw.Product)
+			if err != nil {
+				return fmt.Errorf("week %s: %w", sw.Week, err)
+			}
+			var monthUUID string
+			if sw.Month != "" {
+				month := models.Month{}
+				if err := tx.Where("month = ? AND province_uuid = ? AND product_uuid = ? AND year_uuid = ?", sw.Month, province.UUID, productUUID, year.UUID).Limit(1).Find(&month).Error; err != nil {
+					return err
+				}
+				if month.UUID == "" {
+					return fmt.Errorf("week %s: unknown month %q of %s for product %q in %s", sw.Week, sw.Month, sw.Province, sw.Product, sy.Year)
+				}
+				monthUUID = month.UUID
+			}
+
+			week := models.Week{}
+			if err := tx.Where("week = ? AND province_uuid = ? AND product_uuid = ? AND year_uuid = ?", sw.Week, province.UUID, productUUID, year.UUID).Limit(1).Find(&week).Error; err != nil {
+				return err
+			}
+			if week.UUID == "" {
+				week = models.Week{
+					UUID:         utils.GenerateUUID(),
+					Week:         sw.Week,
+					Quantity:     sw.Quantity,
+					Role:         defaultString(sw.Role, "ASM"),
+					CountryUUID:  province.CountryUUID,
+					ProvinceUUID: province.UUID,
+					ProductUUID:  productUUID,
+					MonthUUID:    monthUUID,
+					YearUUID:     year.UUID,
+					Signature:    "seed",
+				}
+				if err := tx.Create(&week).Error; err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// seedProvince finds the province called name, in the country called country
+// when given. A name shared by provinces of several countries needs its
+// country.
+func seedProvince(tx *gorm.DB, name, country string) (models.Province, error) {
+	query := tx.Model(&models.Province{}).Where("provinces.name = ?", name)
+	if country != "" {
+		query = query.Joins("JOIN countries ON countries.uuid = provinces.country_uuid").
+			Where("countries.name = ?", country)
+	}
+	var found []models.Province
+	if err := query.Limit(2).Find(&found).Error; err != nil {
+		return models.Province{}, err
+	}
+	switch {
+	case len(found) == 0 && country != "":
+		return models.Province{}, fmt.Errorf("unknown province %q in %q", name, country)
+	case len(found) == 0:
+		return models.Province{}, fmt.Errorf("unknown province %q", name)
+	case len(found) > 1:
+		return models.Province{}, fmt.Errorf("province %q exists in several countries, give its country", name)
+	}
+	return found[0], nil
+}
+
+// seedProduct finds the UUID of the product called name, empty for a target
+// covering every product
+func seedProduct(tx *gorm.DB, name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	product := models.Product{}
+	if err := tx.Where("name = ?", name).Limit(1).Find(&product).Error; err != nil {
+		return "", err
+	}
+	if product.UUID == "" {
+		return "", fmt.Errorf("unknown product %q", name)
+	}
+	return product.UUID, nil
+}
+
+func defaultString(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
@@ -0,0 +1,52 @@
+package commands
+
+import (
+	"context"
+	"flag"
+
+	"github.com/Danny19977/sr-api/alerting"
+	"github.com/Danny19977/sr-api/config"
+	"github.com/Danny19977/sr-api/reporting"
+	"github.com/Danny19977/sr-api/routes"
+	"github.com/Danny19977/sr-api/webhooks"
+)
+
+// Serve connects to the database, applies migrations and starts the HTTP server
+func Serve(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	cfgFlags := config.BindFlags(fs)
+	addr := fs.String("addr", "", "address to listen on (defaults to :PORT)")
+	skipMigrate := fs.Bool("skip-migrate", false, "do not apply migrations on startup")
+	fs.Parse(args)
+
+	a, err := bootstrap(cfgFlags)
+	if err != nil {
+		return err
+	}
+	if *addr != "" {
+		a.Config.Server.Addr = *addr
+	}
+
+	if !*skipMigrate {
+		if err := migrate(a); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if a.Config.Alerts.Enabled {
+		go alerting.New(a, alerting.ConfiguredChannels(a)).Run(ctx)
+	}
+	if a.Config.Webhooks.Enabled {
+		go webhooks.New(a).Run(ctx)
+	}
+	if a.Config.Reports.Enabled {
+		go reporting.New(a).Run(ctx)
+	}
+	if a.Config.NotificationTTL > 0 {
+		go purgeNotificationsEvery(ctx, a, notificationPurgeInterval)
+	}
+
+	return routes.NewServer(a).Listen(a.Config.Server.Addr)
+}
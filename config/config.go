@@ -0,0 +1,479 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// Config is the typed application configuration. It is loaded once at
+// startup and handed to every component that needs it.
+type Config struct {
+	Server   ServerConfig
+	Database DatabaseConfig
+	Auth     AuthConfig
+	SMTP     SMTPConfig
+	Cache    CacheConfig
+	Alerts   AlertConfig
+	Webhooks WebhookConfig
+	Reports  ReportConfig
+	Anomaly  AnomalyConfig
+	Geofence GeofenceConfig
+	// NotificationTTL is how long notifications are kept, forever when 0
+	NotificationTTL time.Duration
+}
+
+type ServerConfig struct {
+	Addr        string
+	CORSOrigins []string
+}
+
+type DatabaseConfig struct {
+	Host            string
+	Port            int
+	User            string
+	Password        string
+	Name            string
+	SSLMode         string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// DSN returns the PostgreSQL connection string, each value quoted so spaces
+// and quotes in a password survive
+func (d DatabaseConfig) DSN() string {
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		dsnValue(d.Host), d.Port, dsnValue(d.User), dsnValue(d.Password), dsnValue(d.Name), dsnValue(d.SSLMode))
+}
+
+// dsnValue quotes value as the key/value syntax of libpq requires, escaping
+// its backslashes and single quotes
+func dsnValue(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+type AuthConfig struct {
+	SecretKey     string
+	TokenTTL      time.Duration
+	ResetTokenTTL time.Duration
+}
+
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	ResetURL string
+}
+
+// Addr returns the host:port of the SMTP server
+func (s SMTPConfig) Addr() string {
+	return fmt.Sprintf("%s:%d", s.Host, s.Port)
+}
+
+// Enabled reports whether enough settings are present to send mail
+func (s SMTPConfig) Enabled() bool {
+	return s.Host != "" && s.Port > 0 && s.From != ""
+}
+
+// CacheConfig selects where dashboard responses are cached
+type CacheConfig struct {
+	// Backend is "memory", "redis" or "off"
+	Backend string
+	Size    int
+	TTL     time.Duration
+
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
+	RedisPrefix   string
+}
+
+// AlertConfig drives the missed-entry alerting engine
+type AlertConfig struct {
+	Enabled bool
+	// CheckInterval is how often closed slots are checked
+	CheckInterval time.Duration
+	// GracePeriod is how long a missed slot waits before escalating
+	GracePeriod time.Duration
+	// RuleInterval is how often the threshold rules are checked
+	RuleInterval time.Duration
+	// Channels lists the delivery channels: inapp, email and webhook
+	Channels   []string
+	WebhookURL string
+	// ManagerRoles are the roles notified when an alert escalates for ASMs
+	// without a manager
+	ManagerRoles []string
+}
+
+// WebhookConfig drives the dispatcher delivering the outbox events to the
+// webhook subscriptions
+type WebhookConfig struct {
+	Enabled bool
+	// PollInterval is how often the outbox and the due deliveries are checked
+	PollInterval time.Duration
+	// Timeout bounds every delivery request
+	Timeout time.Duration
+	// MaxAttempts is the number of attempts before a delivery fails
+	MaxAttempts int
+	// Retention is how long dispatched events and finished deliveries are kept, forever when 0
+	Retention time.Duration
+}
+
+// ReportConfig drives the scheduler mailing the report subscriptions
+type ReportConfig struct {
+	Enabled bool
+	// CheckInterval is how often due subscriptions are looked for
+	CheckInterval time.Duration
+}
+
+// AnomalyConfig drives the screening of new sales against the recent sales
+// of their province, product and time slot
+type AnomalyConfig struct {
+	// Threshold is the robust z-score from which a quantity is an outlier
+	Threshold float64
+	// Window is how far back the recent sales go
+	Window time.Duration
+	// MinSamples is the number of recent sales needed to judge a quantity
+	MinSamples int
+}
+
+// GeofenceConfig drives the check of the device position sent with a sale
+// against its outlet or the boundary of its province
+type GeofenceConfig struct {
+	// Policy is off to keep the position only, flag to record where the sale
+	// stands, or reject to refuse the sales made out of the area
+	Policy string
+	// RequireLocation refuses the sales sent without a position
+	RequireLocation bool
+	// OutletRadius is the radius in metres of an outlet without its own
+	OutletRadius float64
+}
+
+const defaultCORSOrigins = "http://localhost:3000,http://192.168.0.70:3000,http://192.168.0.16:3000,http://192.168.39.144:3000,http://192.168.0.70.229:3000,http://192.168.39.229:3000"
+
+// Flags holds the command line options shared by every subcommand
+type Flags struct {
+	File      string
+	Overrides overrideList
+}
+
+// overrideList collects repeated -set KEY=VALUE flags
+type overrideList map[string]string
+
+func (o overrideList) String() string {
+	var parts []string
+	for k, v := range o {
+		parts = append(parts, k+"="+v)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (o overrideList) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected KEY=VALUE, got %q", value)
+	}
+	o[strings.TrimSpace(key)] = val
+	return nil
+}
+
+// BindFlags registers -config and -set on fs
+func BindFlags(fs *flag.FlagSet) *Flags {
+	f := &Flags{Overrides: overrideList{}}
+	fs.StringVar(&f.File, "config", ".env", "dotenv file with configuration values")
+	fs.Var(f.Overrides, "set", "override a configuration key, e.g. -set DB_HOST=localhost (repeatable)")
+	return f
+}
+
+// source resolves keys with the precedence flags > environment > file
+type source struct {
+	file      map[string]string
+	overrides map[string]string
+}
+
+func (s source) get(key, fallback string) string {
+	if v, ok := s.overrides[key]; ok {
+		return v
+	}
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	if v, ok := s.file[key]; ok {
+		return v
+	}
+	return fallback
+}
+
+func (s source) getInt(key string, fallback int, errs *[]error) int {
+	raw := s.get(key, "")
+	if raw == "" {
+		return fallback
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		*errs = append(*errs, fmt.Errorf("%s must be an integer, got %q", key, raw))
+		return fallback
+	}
+	return v
+}
+
+func (s source) getFloat(key string, fallback float64, errs *[]error) float64 {
+	raw := s.get(key, "")
+	if raw == "" {
+		return fallback
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		*errs = append(*errs, fmt.Errorf("%s must be a number, got %q", key, raw))
+		return fallback
+	}
+	return v
+}
+
+func (s source) getBool(key string, fallback bool, errs *[]error) bool {
+	raw := s.get(key, "")
+	if raw == "" {
+		return fallback
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		*errs = append(*errs, fmt.Errorf("%s must be true or false, got %q", key, raw))
+		return fallback
+	}
+	return v
+}
+
+func (s source) getDuration(key string, fallback time.Duration, errs *[]error) time.Duration {
+	raw := s.get(key, "")
+	if raw == "" {
+		return fallback
+	}
+	v, err := time.ParseDuration(raw)
+	if err != nil {
+		*errs = append(*errs, fmt.Errorf("%s must be a duration such as 72h, got %q", key, raw))
+		return fallback
+	}
+	return v
+}
+
+// Load reads the configuration from the dotenv file, the environment and the
+// flag overrides, then validates it
+func Load(flags *Flags) (*Config, error) {
+	if flags == nil {
+		flags = &Flags{File: ".env"}
+	}
+
+	src := source{file: map[string]string{}, overrides: flags.Overrides}
+	if flags.File != "" {
+		values, err := godotenv.Read(flags.File)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("reading %s: %w", flags.File, err)
+		}
+		if values != nil {
+			src.file = values
+		}
+	}
+
+	var errs []error
+
+	port := src.get("PORT", "8000")
+	cfg := &Config{
+		Server: ServerConfig{
+			Addr:        ":" + strings.TrimPrefix(port, ":"),
+			CORSOrigins: splitList(src.get("CORS_ORIGINS", defaultCORSOrigins)),
+		},
+		Database: DatabaseConfig{
+			Host:            src.get("DB_HOST", "localhost"),
+			Port:            src.getInt("DB_PORT", 5432, &errs),
+			User:            src.get("DB_USER", ""),
+			Password:        src.get("DB_PASSWORD", ""),
+			Name:            src.get("DB_NAME", ""),
+			SSLMode:         src.get("DB_SSLMODE", "disable"),
+			MaxOpenConns:    src.getInt("DB_MAX_OPEN_CONNS", 25, &errs),
+			MaxIdleConns:    src.getInt("DB_MAX_IDLE_CONNS", 5, &errs),
+			ConnMaxLifetime: src.getDuration("DB_CONN_MAX_LIFETIME", 30*time.Minute, &errs),
+		},
+		Auth: AuthConfig{
+			SecretKey:     src.get("SECRET_KEY", ""),
+			TokenTTL:      src.getDuration("TOKEN_TTL", 72*time.Hour, &errs),
+			ResetTokenTTL: src.getDuration("RESET_TOKEN_TTL", 3*time.Hour, &errs),
+		},
+		SMTP: SMTPConfig{
+			Host:     src.get("EMAIL_HOST", ""),
+			Port:     src.getInt("EMAIL_PORT", 587, &errs),
+			Username: src.get("EMAIL_USERNAME", ""),
+			Password: src.get("EMAIL_PASSWORD", ""),
+			From:     src.get("EMAIL_FROM", ""),
+			ResetURL: src.get("RESET_URL", ""),
+		},
+		Cache: CacheConfig{
+			Backend:       strings.ToLower(src.get("CACHE_BACKEND", "memory")),
+			Size:          src.getInt("CACHE_SIZE", 512, &errs),
+			TTL:           src.getDuration("CACHE_TTL", 5*time.Minute, &errs),
+			RedisAddr:     src.get("REDIS_ADDR", ""),
+			RedisPassword: src.get("REDIS_PASSWORD", ""),
+			RedisDB:       src.getInt("REDIS_DB", 0, &errs),
+			RedisPrefix:   src.get("REDIS_PREFIX", "sr-api:"),
+		},
+		NotificationTTL: src.getDuration("NOTIFICATION_TTL", 90*24*time.Hour, &errs),
+		Alerts: AlertConfig{
+			Enabled:       src.getBool("ALERTS_ENABLED", true, &errs),
+			CheckInterval: src.getDuration("ALERT_CHECK_INTERVAL", time.Minute, &errs),
+			GracePeriod:   src.getDuration("ALERT_GRACE_PERIOD", time.Hour, &errs),
+			RuleInterval:  src.getDuration("ALERT_RULE_INTERVAL", 15*time.Minute, &errs),
+			Channels:      splitList(strings.ToLower(src.get("ALERT_CHANNELS", "inapp,email"))),
+			WebhookURL:    src.get("ALERT_WEBHOOK_URL", ""),
+			ManagerRoles:  splitList(src.get("ALERT_MANAGER_ROLES", "Manager,Admin")),
+		},
+		Webhooks: WebhookConfig{
+			Enabled:      src.getBool("WEBHOOKS_ENABLED", true, &errs),
+			PollInterval: src.getDuration("WEBHOOK_POLL_INTERVAL", 5*time.Second, &errs),
+			Timeout:      src.getDuration("WEBHOOK_TIMEOUT", 10*time.Second, &errs),
+			MaxAttempts:  src.getInt("WEBHOOK_MAX_ATTEMPTS", 10, &errs),
+			Retention:    src.getDuration("WEBHOOK_RETENTION", 30*24*time.Hour, &errs),
+		},
+		Reports: ReportConfig{
+			Enabled:       src.getBool("REPORTS_ENABLED", true, &errs),
+			CheckInterval: src.getDuration("REPORT_CHECK_INTERVAL", time.Minute, &errs),
+		},
+		Anomaly: AnomalyConfig{
+			Threshold:  src.getFloat("ANOMALY_THRESHOLD", 3.5, &errs),
+			Window:     src.getDuration("ANOMALY_WINDOW", 28*24*time.Hour, &errs),
+			MinSamples: src.getInt("ANOMALY_MIN_SAMPLES", 5, &errs),
+		},
+		Geofence: GeofenceConfig{
+			Policy:          strings.ToLower(src.get("GEOFENCE_POLICY", "flag")),
+			RequireLocation: src.getBool("GEOFENCE_REQUIRE_LOCATION", false, &errs),
+			OutletRadius:    src.getFloat("GEOFENCE_OUTLET_RADIUS", 200, &errs),
+		},
+	}
+
+	errs = append(errs, cfg.Validate()...)
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+
+	return cfg, nil
+}
+
+// Validate reports every setting that prevents the application from starting
+func (c *Config) Validate() []error {
+	var errs []error
+
+	if strings.TrimSpace(c.Auth.SecretKey) == "" {
+		errs = append(errs, errors.New("SECRET_KEY must not be empty"))
+	}
+	if c.Auth.TokenTTL <= 0 {
+		errs = append(errs, errors.New("TOKEN_TTL must be positive"))
+	}
+	if c.Auth.ResetTokenTTL <= 0 {
+		errs = append(errs, errors.New("RESET_TOKEN_TTL must be positive"))
+	}
+	if c.Database.Name == "" {
+		errs = append(errs, errors.New("DB_NAME must not be empty"))
+	}
+	if c.Database.User == "" {
+		errs = append(errs, errors.New("DB_USER must not be empty"))
+	}
+	if c.Database.Port <= 0 || c.Database.Port > 65535 {
+		errs = append(errs, fmt.Errorf("DB_PORT %d is out of range", c.Database.Port))
+	}
+	if c.Database.MaxOpenConns < 0 || c.Database.MaxIdleConns < 0 {
+		errs = append(errs, errors.New("DB pool sizes must not be negative"))
+	}
+	switch c.Cache.Backend {
+	case "memory", "off", "":
+	case "redis":
+		if c.Cache.RedisAddr == "" {
+			errs = append(errs, errors.New("REDIS_ADDR must be set when CACHE_BACKEND is redis"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("CACHE_BACKEND must be memory, redis or off, got %q", c.Cache.Backend))
+	}
+	if c.Cache.Backend != "off" && c.Cache.TTL <= 0 {
+		errs = append(errs, errors.New("CACHE_TTL must be positive"))
+	}
+	if c.Alerts.Enabled {
+		if c.Alerts.CheckInterval <= 0 {
+			errs = append(errs, errors.New("ALERT_CHECK_INTERVAL must be positive"))
+		}
+		if c.Alerts.GracePeriod <= 0 {
+			errs = append(errs, errors.New("ALERT_GRACE_PERIOD must be positive"))
+		}
+		if c.Alerts.RuleInterval <= 0 {
+			errs = append(errs, errors.New("ALERT_RULE_INTERVAL must be positive"))
+		}
+		for _, channel := range c.Alerts.Channels {
+			switch channel {
+			case "inapp", "email":
+			case "webhook":
+				if c.Alerts.WebhookURL == "" {
+					errs = append(errs, errors.New("ALERT_WEBHOOK_URL must be set when ALERT_CHANNELS includes webhook"))
+				}
+			default:
+				errs = append(errs, fmt.Errorf("ALERT_CHANNELS entries must be inapp, email or webhook, got %q", channel))
+			}
+		}
+	}
+	if c.Webhooks.Enabled {
+		if c.Webhooks.PollInterval <= 0 {
+			errs = append(errs, errors.New("WEBHOOK_POLL_INTERVAL must be positive"))
+		}
+		if c.Webhooks.Timeout <= 0 {
+			errs = append(errs, errors.New("WEBHOOK_TIMEOUT must be positive"))
+		}
+		if c.Webhooks.MaxAttempts <= 0 {
+			errs = append(errs, errors.New("WEBHOOK_MAX_ATTEMPTS must be positive"))
+		}
+		if c.Webhooks.Retention < 0 {
+			errs = append(errs, errors.New("WEBHOOK_RETENTION must not be negative"))
+		}
+	}
+	if c.Reports.Enabled && c.Reports.CheckInterval <= 0 {
+		errs = append(errs, errors.New("REPORT_CHECK_INTERVAL must be positive"))
+	}
+	if c.Anomaly.Threshold <= 0 {
+		errs = append(errs, errors.New("ANOMALY_THRESHOLD must be positive"))
+	}
+	if c.Anomaly.Window <= 0 {
+		errs = append(errs, errors.New("ANOMALY_WINDOW must be positive"))
+	}
+	if c.Anomaly.MinSamples < 3 {
+		errs = append(errs, errors.New("ANOMALY_MIN_SAMPLES must be at least 3"))
+	}
+	switch c.Geofence.Policy {
+	case "off", "flag", "reject":
+	default:
+		errs = append(errs, fmt.Errorf("GEOFENCE_POLICY must be off, flag or reject, got %q", c.Geofence.Policy))
+	}
+	if c.Geofence.OutletRadius <= 0 {
+		errs = append(errs, errors.New("GEOFENCE_OUTLET_RADIUS must be positive"))
+	}
+	if c.NotificationTTL < 0 {
+		errs = append(errs, errors.New("NOTIFICATION_TTL must not be negative"))
+	}
+	if len(c.Server.CORSOrigins) == 0 {
+		errs = append(errs, errors.New("CORS_ORIGINS must list at least one origin"))
+	}
+
+	return errs
+}
+
+func splitList(value string) []string {
+	var out []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
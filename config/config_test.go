@@ -0,0 +1,29 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestDSNQuotesValues(t *testing.T) {
+	d := DatabaseConfig{
+		Host:     "db.example.com",
+		Port:     5433,
+		User:     "sales team",
+		Password: `it's a \secret`,
+		Name:     "sr",
+		SSLMode:  "disable",
+	}
+
+	parsed, err := pgconn.ParseConfig(d.DSN())
+	if err != nil {
+		t.Fatalf("parsing %s: %v", d.DSN(), err)
+	}
+	if parsed.Host != d.Host || parsed.Port != uint16(d.Port) || parsed.Database != d.Name {
+		t.Errorf("got %s:%d/%s, want %s:%d/%s", parsed.Host, parsed.Port, parsed.Database, d.Host, d.Port, d.Name)
+	}
+	if parsed.User != d.User || parsed.Password != d.Password {
+		t.Errorf("got user %q password %q, want %q and %q", parsed.User, parsed.Password, d.User, d.Password)
+	}
+}
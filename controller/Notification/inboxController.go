@@ -0,0 +1,283 @@
+package notification
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/repository"
+	"github.com/gofiber/fiber/v2"
+)
+
+// unauthenticated answers a request whose token matches no user
+func unauthenticated(c *fiber.Ctx) error {
+	return c.Status(401).JSON(fiber.Map{
+		"status":  "error",
+		"message": "Unauthenticated",
+	})
+}
+
+// Paginate the inbox of the caller, with its unread count
+func (ctl *Controller) GetMyNotifications(c *fiber.Ctx) error {
+	user, err := ctl.caller(c)
+	if err != nil {
+		return unauthenticated(c)
+	}
+
+	page, err := strconv.Atoi(c.Query("page", "1"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(c.Query("limit", "15"))
+	if err != nil || limit <= 0 {
+		limit = 15
+	}
+	now := time.Now()
+
+	dataList, totalRecords, err := ctl.Notifications.List(repository.NotificationListOptions{
+		ListOptions: repository.ListOptions{Search: c.Query("search", ""), Offset: (page - 1) * limit, Limit: limit},
+		UserUUID:    user.UUID,
+		Status:      c.Query("status"),
+		Now:         now,
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to fetch notifications",
+			"error":   err.Error(),
+		})
+	}
+	unread, err := ctl.Notifications.UnreadCount(user.UUID, now)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to count unread notifications",
+			"error":   err.Error(),
+		})
+	}
+
+	totalPages := int((totalRecords + int64(limit) - 1) / int64(limit))
+	pagination := map[string]interface{}{
+		"total_records": totalRecords,
+		"total_pages":   totalPages,
+		"current_page":  page,
+		"page_size":     limit,
+	}
+
+	return c.JSON(fiber.Map{
+		"status":       "success",
+		"message":      "Get my notifications success",
+		"data":         dataList,
+		"unread_count": unread,
+		"pagination":   pagination,
+	})
+}
+
+// Count the unread notifications of the caller
+func (ctl *Controller) GetUnreadCount(c *fiber.Ctx) error {
+	user, err := ctl.caller(c)
+	if err != nil {
+		return unauthenticated(c)
+	}
+
+	unread, err := ctl.Notifications.UnreadCount(user.UUID, time.Now())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to count unread notifications",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Unread notifications counted",
+		"data":    fiber.Map{"unread_count": unread},
+	})
+}
+
+// Mark one notification of the caller as read
+func (ctl *Controller) MarkRead(c *fiber.Ctx) error {
+	user, err := ctl.caller(c)
+	if err != nil {
+		return unauthenticated(c)
+	}
+
+	notification, err := ctl.Notifications.Find(c.Params("uuid"))
+	if err != nil || notification.UserUUID != user.UUID {
+		return c.Status(404).JSON(fiber.Map{
+			"status":  "error",
+			"message": "No Notification found",
+			"data":    nil,
+		})
+	}
+
+	if _, err := ctl.Notifications.MarkRead(user.UUID, []string{notification.UUID}, time.Now()); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to mark the notification as read",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Notification marked as read",
+		"data":    nil,
+	})
+}
+
+// Mark every notification of the caller as read
+func (ctl *Controller) MarkAllRead(c *fiber.Ctx) error {
+	user, err := ctl.caller(c)
+	if err != nil {
+		return unauthenticated(c)
+	}
+
+	updated, err := ctl.Notifications.MarkRead(user.UUID, nil, time.Now())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to mark the notifications as read",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Notifications marked as read",
+		"data":    fiber.Map{"updated": updated},
+	})
+}
+
+// Broadcast a notification to a role, a province or a country
+func (ctl *Controller) Broadcast(c *fiber.Ctx) error {
+	user, err := ctl.caller(c)
+	if err != nil {
+		return unauthenticated(c)
+	}
+
+	var body struct {
+		Name      string     `json:"name"`
+		Message   string     `json:"message"`
+		Type      string     `json:"type"`
+		ExpiresAt *time.Time `json:"expires_at"`
+		repository.Audience
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid request body",
+			"error":   err.Error(),
+		})
+	}
+	if body.Name == "" || body.Message == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "name and message are required",
+		})
+	}
+	if body.Type == "" {
+		body.Type = "info"
+	}
+
+	// An ASM reaches their own province only
+	if user.Role == "ASM" {
+		body.Audience.CountryUUID = ""
+		body.Audience.ProvinceUUID = ""
+		if user.ProvinceUUID != nil {
+			body.Audience.ProvinceUUID = *user.ProvinceUUID
+		}
+		if body.Audience.ProvinceUUID == "" {
+			return c.Status(403).JSON(fiber.Map{
+				"status":  "error",
+				"message": "An ASM without a province cannot broadcast",
+			})
+		}
+	}
+
+	sent, err := ctl.Notifications.Broadcast(models.Notification{
+		Name:      body.Name,
+		Message:   body.Message,
+		Type:      body.Type,
+		ExpiresAt: body.ExpiresAt,
+	}, body.Audience)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to broadcast the notification",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Notification broadcast",
+		"data":    fiber.Map{"recipients": sent},
+	})
+}
+
+// Get the notification preferences of the caller
+func (ctl *Controller) GetPreferences(c *fiber.Ctx) error {
+	user, err := ctl.caller(c)
+	if err != nil {
+		return unauthenticated(c)
+	}
+
+	preference, err := ctl.Notifications.Preference(user.UUID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to fetch notification preferences",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Notification preferences found",
+		"data":    preference,
+	})
+}
+
+// Update the notification preferences of the caller
+func (ctl *Controller) UpdatePreferences(c *fiber.Ctx) error {
+	user, err := ctl.caller(c)
+	if err != nil {
+		return unauthenticated(c)
+	}
+
+	preference, err := ctl.Notifications.Preference(user.UUID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to fetch notification preferences",
+			"error":   err.Error(),
+		})
+	}
+
+	// Fields left out of the body keep their current value
+	if err := c.BodyParser(preference); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid request body",
+			"error":   err.Error(),
+		})
+	}
+	preference.UserUUID = user.UUID
+	preference.UpdatedAt = time.Now()
+
+	if err := ctl.Notifications.SavePreference(preference); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to save notification preferences",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Notification preferences updated",
+		"data":    preference,
+	})
+}
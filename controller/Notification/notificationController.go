@@ -3,17 +3,30 @@ package notification
 import (
 	"strconv"
 
-	"github.com/Danny19977/sr-api/database"
 	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/repository"
 	"github.com/Danny19977/sr-api/utils"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 )
 
-// Paginate Notifications
-func GetPaginatedNotification(c *fiber.Ctx) error {
-	db := database.DB
+// caller returns the authenticated user
+func (ctl *Controller) caller(c *fiber.Ctx) (*models.User, error) {
+	userUUID, err := utils.GetUserUUIDFromToken(c)
+	if err != nil {
+		return nil, err
+	}
+	return ctl.Users.FindByUUID(userUUID)
+}
+
+// visibleTo reports whether user may read or change notification: admins
+// reach every inbox, other users their own
+func visibleTo(user *models.User, notification *models.Notification) bool {
+	return user.Role == "Admin" || notification.UserUUID == user.UUID
+}
 
+// Paginate Notifications
+func (ctl *Controller) GetPaginatedNotification(c *fiber.Ctx) error {
 	page, err := strconv.Atoi(c.Query("page", "1"))
 	if err != nil || page <= 0 {
 		page = 1
@@ -26,23 +39,20 @@ func GetPaginatedNotification(c *fiber.Ctx) error {
 
 	search := c.Query("search", "")
 
-	var dataList []models.Notification
-	var totalRecords int64
-
-	userUUID, _ := utils.GetUserUUIDFromToken(c)
-	var requestingUser models.User
-	database.DB.Where("uuid = ?", userUUID).First(&requestingUser)
-
-	query := db.Model(&models.Notification{})
-	if requestingUser.Role == "ASM" {
-		query = query.Where("province_uuid = ?", requestingUser.ProvinceUUID)
+	opts := repository.NotificationListOptions{
+		ListOptions: repository.ListOptions{Search: search, Offset: offset, Limit: limit},
 	}
-	query = query.Where("name ILIKE ?", "%"+search+"%")
-	query.Count(&totalRecords)
 
-	query = query.Offset(offset).Limit(limit).Order("updated_at DESC")
-	err = query.Find(&dataList).Error
+	// Only admins see every inbox
+	requestingUser, err := ctl.caller(c)
+	if err != nil {
+		return unauthenticated(c)
+	}
+	if requestingUser.Role != "Admin" {
+		opts.UserUUID = requestingUser.UUID
+	}
 
+	dataList, totalRecords, err := ctl.Notifications.List(opts)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
@@ -68,10 +78,18 @@ func GetPaginatedNotification(c *fiber.Ctx) error {
 }
 
 // Get All Notifications
-func GetAllNotifications(c *fiber.Ctx) error {
-	db := database.DB
-	var data []models.Notification
-	db.Find(&data)
+func (ctl *Controller) GetAllNotifications(c *fiber.Ctx) error {
+	requestingUser, err := ctl.caller(c)
+	if err != nil {
+		return unauthenticated(c)
+	}
+
+	var opts repository.NotificationListOptions
+	if requestingUser.Role != "Admin" {
+		opts.UserUUID = requestingUser.UUID
+	}
+	data, _, _ := ctl.Notifications.List(opts)
+
 	return c.JSON(fiber.Map{
 		"status":  "success",
 		"message": "All notifications support",
@@ -80,12 +98,10 @@ func GetAllNotifications(c *fiber.Ctx) error {
 }
 
 // Get one Notification by UUID
-func GetNotification(c *fiber.Ctx) error {
-	uuid := c.Params("uuid")
-	db := database.DB
-	var notification models.Notification
-	db.Where("uuid = ?", uuid).First(&notification)
-	if notification.Name == "" {
+func (ctl *Controller) GetNotification(c *fiber.Ctx) error {
+	notification, err := ctl.Notifications.Find(c.Params("uuid"))
+	requestingUser, callerErr := ctl.caller(c)
+	if err != nil || callerErr != nil || !visibleTo(requestingUser, notification) {
 		return c.Status(404).JSON(
 			fiber.Map{
 				"status":  "error",
@@ -103,13 +119,20 @@ func GetNotification(c *fiber.Ctx) error {
 	)
 }
 
-// Get one Notification by title string
-func GetNotificationByTitleString(c *fiber.Ctx) error {
-	nameStr := c.Params("title")
-	db := database.DB
-	var notification models.Notification
-	db.Where("name = ?", nameStr).First(&notification)
-	if notification.Name == "" {
+// Get the latest Notification of the caller with a title
+func (ctl *Controller) GetNotificationByTitleString(c *fiber.Ctx) error {
+	requestingUser, err := ctl.caller(c)
+	if err != nil {
+		return unauthenticated(c)
+	}
+
+	// Titles are no longer unique, the latest notification wins
+	notifications, _, err := ctl.Notifications.List(repository.NotificationListOptions{
+		ListOptions: repository.ListOptions{Limit: 1},
+		UserUUID:    requestingUser.UUID,
+		Title:       c.Params("title"),
+	})
+	if err != nil || len(notifications) == 0 {
 		return c.Status(404).JSON(
 			fiber.Map{
 				"status":  "error",
@@ -122,13 +145,13 @@ func GetNotificationByTitleString(c *fiber.Ctx) error {
 		fiber.Map{
 			"status":  "success",
 			"message": "Notification found",
-			"data":    notification,
+			"data":    notifications[0],
 		},
 	)
 }
 
 // Create Notification
-func CreateNotification(c *fiber.Ctx) error {
+func (ctl *Controller) CreateNotification(c *fiber.Ctx) error {
 	p := &models.Notification{}
 
 	if err := c.BodyParser(&p); err != nil {
@@ -136,7 +159,13 @@ func CreateNotification(c *fiber.Ctx) error {
 	}
 
 	p.UUID = uuid.New().String()
-	database.DB.Create(p)
+	if err := ctl.Notifications.Create(p); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to create notification",
+			"error":   err.Error(),
+		})
+	}
 
 	return c.JSON(
 		fiber.Map{
@@ -148,10 +177,7 @@ func CreateNotification(c *fiber.Ctx) error {
 }
 
 // Update Notification
-func UpdateNotification(c *fiber.Ctx) error {
-	uuid := c.Params("uuid")
-	db := database.DB
-
+func (ctl *Controller) UpdateNotification(c *fiber.Ctx) error {
 	type UpdateData struct {
 		UUID     string `json:"uuid"`
 		Name     string `json:"name"`
@@ -173,14 +199,23 @@ func UpdateNotification(c *fiber.Ctx) error {
 		)
 	}
 
-	notification := new(models.Notification)
-	db.Where("uuid = ?", uuid).First(&notification)
+	notification, err := ctl.Notifications.Find(c.Params("uuid"))
+	requestingUser, callerErr := ctl.caller(c)
+	if err != nil || callerErr != nil || !visibleTo(requestingUser, notification) {
+		return c.Status(404).JSON(
+			fiber.Map{
+				"status":  "error",
+				"message": "No Notification found",
+				"data":    nil,
+			},
+		)
+	}
 	notification.Name = updateData.Name
 	notification.Message = updateData.Message
 	notification.Type = updateData.Type
 	notification.Status = updateData.Status
 	notification.UserUUID = updateData.UserUUID
-	db.Save(&notification)
+	ctl.Notifications.Save(notification)
 
 	return c.JSON(
 		fiber.Map{
@@ -192,13 +227,10 @@ func UpdateNotification(c *fiber.Ctx) error {
 }
 
 // Delete Notification
-func DeleteNotification(c *fiber.Ctx) error {
-	uuid := c.Params("uuid")
-	db := database.DB
-
-	var notification models.Notification
-	db.Where("uuid = ?", uuid).First(&notification)
-	if notification.Name == "" {
+func (ctl *Controller) DeleteNotification(c *fiber.Ctx) error {
+	notification, err := ctl.Notifications.Find(c.Params("uuid"))
+	requestingUser, callerErr := ctl.caller(c)
+	if err != nil || callerErr != nil || !visibleTo(requestingUser, notification) {
 		return c.Status(404).JSON(
 			fiber.Map{
 				"status":  "error",
@@ -207,7 +239,7 @@ func DeleteNotification(c *fiber.Ctx) error {
 			},
 		)
 	}
-	db.Delete(&notification)
+	ctl.Notifications.Delete(notification)
 
 	return c.JSON(
 		fiber.Map{
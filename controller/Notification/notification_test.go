@@ -0,0 +1,117 @@
+package notification_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Danny19977/sr-api/apptest"
+	"github.com/Danny19977/sr-api/models"
+	"github.com/google/uuid"
+)
+
+type inbox struct {
+	Data []struct {
+		UUID   string `json:"uuid"`
+		Name   string `json:"name"`
+		Status string `json:"status"`
+	} `json:"data"`
+	UnreadCount int64 `json:"unread_count"`
+}
+
+func myInbox(t *testing.T, env *apptest.Env, token string) inbox {
+	t.Helper()
+	var box inbox
+	resp := env.Do(http.MethodGet, "/api/notifications/me", token, nil)
+	if err := resp.JSON(&box); err != nil || resp.Status != http.StatusOK {
+		t.Fatalf("inbox: status %d: %s", resp.Status, resp.Body)
+	}
+	return box
+}
+
+func TestBroadcastInboxAndReadState(t *testing.T) {
+	env := apptest.New(t)
+
+	country := &models.Country{UUID: uuid.New().String(), Name: "Country"}
+	if err := env.App.Geography.CreateCountry(country); err != nil {
+		t.Fatal(err)
+	}
+	north := &models.Province{UUID: uuid.New().String(), Name: "North", CountryUUID: country.UUID}
+	if err := env.App.Geography.CreateProvince(north); err != nil {
+		t.Fatal(err)
+	}
+
+	admin := env.Token(env.CreateUser("Admin", nil))
+	asm := env.CreateUser("ASM", &north.UUID)
+	muted := env.CreateUser("ASM", &north.UUID)
+	if err := env.App.Notifications.SavePreference(&models.NotificationPreference{UserUUID: muted.UUID, MuteInApp: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The same notification can go out twice
+	for i := 0; i < 2; i++ {
+		resp := env.Do(http.MethodPost, "/api/notifications/broadcast", admin, map[string]any{
+			"name":          "Stock count tomorrow",
+			"message":       "Please count the stock before 10am.",
+			"province_uuid": north.UUID,
+		})
+		if resp.Status != http.StatusOK {
+			t.Fatalf("broadcast: status %d: %s", resp.Status, resp.Body)
+		}
+	}
+
+	asmToken := env.Token(asm)
+	box := myInbox(t, env, asmToken)
+	if len(box.Data) != 2 || box.UnreadCount != 2 {
+		t.Fatalf("ASM inbox has %d notifications, %d unread, want 2 and 2", len(box.Data), box.UnreadCount)
+	}
+	if box := myInbox(t, env, env.Token(muted)); len(box.Data) != 0 {
+		t.Errorf("muted ASM received %d notifications", len(box.Data))
+	}
+
+	if resp := env.Do(http.MethodPut, "/api/notifications/me/read/"+box.Data[0].UUID, asmToken, nil); resp.Status != http.StatusOK {
+		t.Fatalf("mark read: status %d: %s", resp.Status, resp.Body)
+	}
+	if box := myInbox(t, env, asmToken); box.UnreadCount != 1 {
+		t.Errorf("unread count after marking one = %d, want 1", box.UnreadCount)
+	}
+	if resp := env.Do(http.MethodPut, "/api/notifications/me/read-all", asmToken, nil); resp.Status != http.StatusOK {
+		t.Fatalf("mark all read: status %d: %s", resp.Status, resp.Body)
+	}
+	if box := myInbox(t, env, asmToken); box.UnreadCount != 0 {
+		t.Errorf("unread count after marking all = %d, want 0", box.UnreadCount)
+	}
+
+	// Other users' notifications stay out of reach
+	other := env.Token(env.CreateUser("ASM", &north.UUID))
+	if resp := env.Do(http.MethodPut, "/api/notifications/me/read/"+box.Data[0].UUID, other, nil); resp.Status != http.StatusNotFound {
+		t.Errorf("marking another user's notification: status %d, want 404", resp.Status)
+	}
+	var page inbox
+	if err := env.Do(http.MethodGet, "/api/notifications/all/paginate", other, nil).JSON(&page); err != nil || len(page.Data) != 0 {
+		t.Errorf("ASM paginates %d notifications of others", len(page.Data))
+	}
+}
+
+func TestExpiredNotificationsArePurged(t *testing.T) {
+	env := apptest.New(t)
+	user := env.CreateUser("ASM", nil)
+
+	past := time.Now().Add(-time.Minute)
+	expired := &models.Notification{Name: "Old", Message: "Old", Type: "info", UserUUID: user.UUID, ExpiresAt: &past}
+	current := &models.Notification{Name: "New", Message: "New", Type: "info", UserUUID: user.UUID}
+	if err := env.App.Notifications.Create(expired, current); err != nil {
+		t.Fatal(err)
+	}
+	if current.ExpiresAt == nil {
+		t.Error("new notification got no expiry from the configured TTL")
+	}
+
+	if box := myInbox(t, env, env.Token(user)); len(box.Data) != 1 {
+		t.Errorf("inbox shows %d notifications, want the unexpired one", len(box.Data))
+	}
+	purged, err := env.App.Notifications.Purge(time.Now())
+	if err != nil || purged != 1 {
+		t.Errorf("purged %d notifications (%v), want 1", purged, err)
+	}
+}
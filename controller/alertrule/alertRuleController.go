@@ -0,0 +1,246 @@
+package alertrule
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/repository"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// pageParams reads the page and limit query parameters
+func pageParams(c *fiber.Ctx) (int, int) {
+	page, err := strconv.Atoi(c.Query("page", "1"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(c.Query("limit", "15"))
+	if err != nil || limit <= 0 {
+		limit = 15
+	}
+	return page, limit
+}
+
+func pagination(totalRecords int64, page, limit int) map[string]interface{} {
+	return map[string]interface{}{
+		"total_records": totalRecords,
+		"total_pages":   int((totalRecords + int64(limit) - 1) / int64(limit)),
+		"current_page":  page,
+		"page_size":     limit,
+	}
+}
+
+// Paginate Alert Rules
+func (ctl *Controller) GetPaginatedAlertRules(c *fiber.Ctx) error {
+	page, limit := pageParams(c)
+	opts := repository.ListOptions{Search: c.Query("search", ""), Offset: (page - 1) * limit, Limit: limit}
+
+	dataList, totalRecords, err := ctl.AlertRules.List(opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to fetch alert rules",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":     "success",
+		"message":    "Get all alert rules paginate success",
+		"data":       dataList,
+		"pagination": pagination(totalRecords, page, limit),
+	})
+}
+
+// Get one Alert Rule
+func (ctl *Controller) GetAlertRule(c *fiber.Ctx) error {
+	rule, err := ctl.AlertRules.Find(c.Params("uuid"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"status":  "error",
+			"message": "No alert rule found",
+			"data":    nil,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Alert rule found",
+		"data":    rule,
+	})
+}
+
+// Paginate the firings of an Alert Rule
+func (ctl *Controller) GetAlertRuleFirings(c *fiber.Ctx) error {
+	page, limit := pageParams(c)
+	opts := repository.ListOptions{Offset: (page - 1) * limit, Limit: limit}
+	if provinceUUID := c.Query("province_uuid"); provinceUUID != "" {
+		opts.ProvinceUUID = &provinceUUID
+	}
+
+	dataList, totalRecords, err := ctl.AlertRules.Firings(c.Params("uuid"), opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to fetch alert rule firings",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":     "success",
+		"message":    "Get alert rule firings success",
+		"data":       dataList,
+		"pagination": pagination(totalRecords, page, limit),
+	})
+}
+
+// checkScope verifies that the country and province of rule exist
+func (ctl *Controller) checkScope(rule *models.AlertRule) error {
+	if rule.CountryUUID != nil && *rule.CountryUUID == "" {
+		rule.CountryUUID = nil
+	}
+	if rule.ProvinceUUID != nil && *rule.ProvinceUUID == "" {
+		rule.ProvinceUUID = nil
+	}
+	if rule.CountryUUID != nil {
+		if _, err := ctl.Geography.FindCountry(*rule.CountryUUID); err != nil {
+			return errors.New("country_uuid matches no country")
+		}
+	}
+	if rule.ProvinceUUID != nil {
+		if _, err := ctl.Geography.FindProvince(*rule.ProvinceUUID); err != nil {
+			return errors.New("province_uuid matches no province")
+		}
+	}
+	return nil
+}
+
+// Create Alert Rule
+func (ctl *Controller) CreateAlertRule(c *fiber.Ctx) error {
+	// Fields left out of the body keep these defaults
+	p := &models.AlertRule{
+		FromDay:         1,
+		BaselineDays:    7,
+		CooldownMinutes: 24 * 60,
+		Active:          true,
+	}
+
+	if err := c.BodyParser(p); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid request body",
+			"error":   err.Error(),
+		})
+	}
+	p.UUID = uuid.New().String()
+
+	if err := p.Validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid alert rule",
+			"error":   err.Error(),
+		})
+	}
+	if err := ctl.checkScope(p); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid alert rule",
+			"error":   err.Error(),
+		})
+	}
+
+	if err := ctl.AlertRules.Create(p); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to create alert rule",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Alert rule created success",
+		"data":    p,
+	})
+}
+
+// Update Alert Rule
+func (ctl *Controller) UpdateAlertRule(c *fiber.Ctx) error {
+	rule, err := ctl.AlertRules.Find(c.Params("uuid"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"status":  "error",
+			"message": "No alert rule found",
+			"data":    nil,
+		})
+	}
+
+	// Fields left out of the body keep their current value
+	uuid, createdAt := rule.UUID, rule.CreatedAt
+	if err := c.BodyParser(rule); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Review your input",
+			"error":   err.Error(),
+		})
+	}
+	rule.UUID, rule.CreatedAt = uuid, createdAt
+
+	if err := rule.Validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid alert rule",
+			"error":   err.Error(),
+		})
+	}
+	if err := ctl.checkScope(rule); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid alert rule",
+			"error":   err.Error(),
+		})
+	}
+
+	if err := ctl.AlertRules.Save(rule); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to update alert rule",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Alert rule updated success",
+		"data":    rule,
+	})
+}
+
+// Delete Alert Rule
+func (ctl *Controller) DeleteAlertRule(c *fiber.Ctx) error {
+	rule, err := ctl.AlertRules.Find(c.Params("uuid"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"status":  "error",
+			"message": "No alert rule found",
+			"data":    nil,
+		})
+	}
+
+	if err := ctl.AlertRules.Delete(rule); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to delete alert rule",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Alert rule deleted success",
+		"data":    nil,
+	})
+}
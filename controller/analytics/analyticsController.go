@@ -0,0 +1,77 @@
+package analytics
+
+import (
+	"time"
+
+	"github.com/Danny19977/sr-api/repository"
+	"github.com/Danny19977/sr-api/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// QueryRequest is an analytics spec with the dates it covers, the current
+// fiscal month by default
+type QueryRequest struct {
+	repository.AnalyticsSpec
+	StartDate string `json:"start_date"` // 2006-01-02
+	EndDate   string `json:"end_date"`   // 2006-01-02, included
+}
+
+// Run an ad-hoc aggregation of the sales described by a JSON spec. Filters
+// narrow the provinces an ASM may see, they never widen them.
+func (ctl *Controller) Query(c *fiber.Ctx) error {
+	var request QueryRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Review your input",
+			"error":   err.Error(),
+		})
+	}
+
+	userUUID, _ := utils.GetUserUUIDFromToken(c)
+	provinceUUIDs := ctl.ScopeProvinces(userUUID)
+	cal, err := ctl.Dashboard.Calendar(provinceUUIDs)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to run the query",
+			"error":   err.Error(),
+		})
+	}
+
+	month := cal.MonthOf(time.Now())
+	from, to := month.From, month.To
+	if request.StartDate != "" || request.EndDate != "" {
+		start, startErr := time.ParseInLocation("2006-01-02", request.StartDate, time.Local)
+		end, endErr := time.ParseInLocation("2006-01-02", request.EndDate, time.Local)
+		if startErr != nil || endErr != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid date format. Use YYYY-MM-DD for start_date and end_date",
+			})
+		}
+		from, to = start, end.AddDate(0, 0, 1)
+	}
+	if err := request.Validate(from, to); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid query",
+			"error":   err.Error(),
+		})
+	}
+
+	result, err := ctl.Analytics.Query(request.AnalyticsSpec, cal, from, to, provinceUUIDs)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to run the query",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Query results",
+		"data":    result,
+	})
+}
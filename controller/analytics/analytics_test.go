@@ -0,0 +1,91 @@
+package analytics_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Danny19977/sr-api/apptest"
+	"github.com/Danny19977/sr-api/models"
+	"github.com/google/uuid"
+)
+
+type queryResult struct {
+	Data struct {
+		Rows      []map[string]interface{} `json:"rows"`
+		Truncated bool                     `json:"truncated"`
+	} `json:"data"`
+}
+
+func TestQueryAggregatesWithinScope(t *testing.T) {
+	env := apptest.New(t)
+	db := env.App.DB
+	today := time.Now().Format("2006-01-02")
+
+	country := models.Country{UUID: uuid.New().String(), Name: "Country " + uuid.New().String()[:8]}
+	provinces := []models.Province{
+		{UUID: uuid.New().String(), Name: "North", CountryUUID: country.UUID},
+		{UUID: uuid.New().String(), Name: "South", CountryUUID: country.UUID},
+	}
+	products := []models.Product{
+		{UUID: uuid.New().String(), Name: "Cola", Price: 2},
+		{UUID: uuid.New().String(), Name: "Water", Price: 0.5},
+	}
+	for _, rows := range []interface{}{&country, &provinces, &products} {
+		if err := db.Create(rows).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	asm := env.CreateUser("ASM", &provinces[0].UUID)
+
+	var sales []models.Sale
+	for _, province := range provinces {
+		for _, product := range products {
+			sales = append(sales, models.Sale{
+				UUID:         uuid.New().String(),
+				CreatedAt:    time.Now(),
+				ProvinceUUID: province.UUID,
+				ProductUUID:  product.UUID,
+				UserUUID:     asm.UUID,
+				Quantity:     10,
+			})
+		}
+	}
+	if err := env.App.Sales.CreateBatch(sales, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := map[string]interface{}{
+		"start_date": today,
+		"end_date":   today,
+		"measures":   []map[string]string{{"func": "sum", "field": "quantity"}, {"func": "sum", "field": "value"}},
+		"dimensions": []string{"province", "product"},
+		"filters":    []map[string]interface{}{{"field": "country", "op": "eq", "value": country.UUID}},
+		"sort":       []map[string]interface{}{{"field": "sum_value", "desc": true}},
+	}
+
+	var result queryResult
+	resp := env.Do(http.MethodPost, "/api/analytics/query", env.Token(env.CreateUser("Admin", nil)), spec)
+	if err := resp.JSON(&result); err != nil || resp.Status != http.StatusOK {
+		t.Fatalf("got status %d: %s", resp.Status, resp.Body)
+	}
+	if len(result.Data.Rows) != 4 || result.Data.Rows[0]["sum_value"] != 20.0 || result.Data.Rows[0]["product"] != "Cola" {
+		t.Errorf("got %v, want four rows led by 20 worth of Cola", result.Data.Rows)
+	}
+
+	// The ASM only sees their province whatever the filters
+	spec["filters"] = []map[string]interface{}{{"field": "province", "op": "in", "value": []string{provinces[0].UUID, provinces[1].UUID}}}
+	spec["limit"] = 1
+	resp = env.Do(http.MethodPost, "/api/analytics/query", env.Token(asm), spec)
+	if err := resp.JSON(&result); err != nil || resp.Status != http.StatusOK {
+		t.Fatalf("got status %d: %s", resp.Status, resp.Body)
+	}
+	if len(result.Data.Rows) != 1 || !result.Data.Truncated || result.Data.Rows[0]["province"] != "North" {
+		t.Errorf("got %v (truncated %v), want the first row of North only", result.Data.Rows, result.Data.Truncated)
+	}
+
+	spec["dimensions"] = []string{"province; DROP TABLE sales"}
+	if resp := env.Do(http.MethodPost, "/api/analytics/query", env.Token(asm), spec); resp.Status != http.StatusBadRequest {
+		t.Errorf("got status %d for an unknown dimension, want 400", resp.Status)
+	}
+}
@@ -0,0 +1,9 @@
+package analytics_test
+
+import (
+	"testing"
+
+	"github.com/Danny19977/sr-api/apptest"
+)
+
+func TestMain(m *testing.M) { apptest.Main(m) }
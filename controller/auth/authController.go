@@ -1,22 +1,34 @@
 package auth
 
 import (
-	"os"
+	"errors"
 	"strconv"
 
-	"github.com/Danny19977/sr-api/database"
 	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/repository"
 	"github.com/Danny19977/sr-api/utils"
 	"github.com/gofiber/fiber/v2"
 )
 
-var SECRET_KEY string = os.Getenv("SECRET_KEY")
+// registeredRole is the role of every self-registered account. Admins are
+// created with the create-admin command or by another admin.
+const registeredRole = "ASM"
 
-func Register(c *fiber.Ctx) error {
+func (ctl *Controller) Register(c *fiber.Ctx) error {
 
 	type RegisterInput struct {
-		models.User
-		PasswordConfirm string `json:"password_confirm"`
+		Fullname        string  `json:"fullname"`
+		Email           string  `json:"email"`
+		Phone           string  `json:"phone"`
+		Title           string  `json:"title"`
+		Password        string  `json:"password"`
+		PasswordConfirm string  `json:"password_confirm"`
+		Permission      string  `json:"permission"`
+		Image           string  `json:"profile_image"`
+		Status          bool    `json:"status"`
+		CountryUUID     *string `json:"country_uuid"`
+		ProvinceUUID    *string `json:"province_uuid"`
+		Signature       string  `json:"signature"`
 	}
 
 	nu := new(RegisterInput)
@@ -40,7 +52,7 @@ func Register(c *fiber.Ctx) error {
 		Email:        nu.Email,
 		Title:        nu.Title,
 		Phone:        nu.Phone,
-		Role:         nu.Role,
+		Role:         registeredRole,
 		Permission:   nu.Permission,
 		Image:        nu.Image,
 		Status:       nu.Status,
@@ -49,8 +61,6 @@ func Register(c *fiber.Ctx) error {
 		ProvinceUUID: nu.ProvinceUUID,
 	}
 
-	u.SetPassword(nu.Password)
-
 	if err := utils.ValidateStruct(*u); err != nil {
 		c.Status(400)
 		return c.JSON(err)
@@ -58,17 +68,21 @@ func Register(c *fiber.Ctx) error {
 
 	u.UUID = utils.GenerateUUID()
 
-	database.DB.Create(u)
-
-	// }
+	if err := ctl.Users.Create(u, nu.Password); err != nil {
+		c.Status(500)
+		return c.JSON(fiber.Map{
+			"message": "could not create the user account",
+			"error":   err.Error(),
+		})
+	}
 
 	return c.JSON(fiber.Map{
 		"message": "user account created",
-		"data":    u,
+		"data":    u.ToUserResponse(),
 	})
 }
 
-func Login(c *fiber.Ctx) error {
+func (ctl *Controller) Login(c *fiber.Ctx) error {
 
 	lu := new(models.Login)
 
@@ -84,17 +98,16 @@ func Login(c *fiber.Ctx) error {
 		return c.JSON(err)
 	}
 
-	u := &models.User{}
-
-	phoneNumber, err := strconv.Atoi(lu.Identifier)
-	if err != nil {
-		database.DB.Where("email = ?", lu.Identifier).First(&u)
+	var u *models.User
+	var err error
+	if _, convErr := strconv.Atoi(lu.Identifier); convErr != nil {
+		u, err = ctl.Users.FindByEmail(lu.Identifier)
 	} else {
-		database.DB.Where("email = ? OR phone = ?", lu.Identifier, phoneNumber).First(&u)
+		u, err = ctl.Users.FindByIdentifier(lu.Identifier)
 	}
 
-	if u.UUID == "" {
-		utils.LogErrorWithDB(database.DB, c, "login_failed", "Invalid email or phone", map[string]interface{}{
+	if err != nil {
+		utils.LogErrorWithDB(ctl.DB, c, "login_failed", "Invalid email or phone", map[string]interface{}{
 			"identifier": lu.Identifier,
 			"ip_address": c.IP(),
 			"user_agent": c.Get("User-Agent"),
@@ -106,8 +119,8 @@ func Login(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := u.ComparePassword(lu.Password); err != nil {
-		utils.LogErrorWithDB(database.DB, c, "login_failed", "Incorrect password", map[string]interface{}{
+	if err := ctl.Users.CheckPassword(u.UUID, lu.Password); errors.Is(err, repository.ErrWrongPassword) {
+		utils.LogErrorWithDB(ctl.DB, c, "login_failed", "Incorrect password", map[string]interface{}{
 			"user_uuid":  u.UUID,
 			"identifier": lu.Identifier,
 			"ip_address": c.IP(),
@@ -118,10 +131,12 @@ func Login(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{
 			"message": "mot de passe incorrect! 😰",
 		})
+	} else if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
 	}
 
 	if !u.Status {
-		utils.LogErrorWithDB(database.DB, c, "login_unauthorized", "User account is disabled", map[string]interface{}{
+		utils.LogErrorWithDB(ctl.DB, c, "login_unauthorized", "User account is disabled", map[string]interface{}{
 			"user_uuid":  u.UUID,
 			"identifier": lu.Identifier,
 			"ip_address": c.IP(),
@@ -139,7 +154,7 @@ func Login(c *fiber.Ctx) error {
 		return c.SendStatus(fiber.StatusInternalServerError)
 	}
 
-	utils.LogLoginWithDB(database.DB, c, u.UUID, map[string]interface{}{
+	utils.LogLoginWithDB(ctl.DB, c, u.UUID, map[string]interface{}{
 		"fullname": u.Fullname,
 		"email":    u.Email,
 		"role":     u.Role,
@@ -153,7 +168,7 @@ func Login(c *fiber.Ctx) error {
 
 }
 
-func AuthUser(c *fiber.Ctx) error {
+func (ctl *Controller) AuthUser(c *fiber.Ctx) error {
 
 	userUUID, err := utils.GetUserUUIDFromToken(c)
 	if err != nil {
@@ -163,12 +178,13 @@ func AuthUser(c *fiber.Ctx) error {
 		})
 	}
 
-	u := models.User{}
-	database.DB.
-		Where("users.uuid = ?", userUUID).
-		Preload("Country").
-		Preload("Province").
-		First(&u)
+	u, err := ctl.Users.FindByUUID(userUUID)
+	if err != nil {
+		c.Status(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"message": "user not found",
+		})
+	}
 
 	// Create a debug response that shows more information about the user
 	response := fiber.Map{
@@ -210,14 +226,14 @@ func AuthUser(c *fiber.Ctx) error {
 	return c.JSON(response)
 }
 
-func Logout(c *fiber.Ctx) error {
+func (ctl *Controller) Logout(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{
 		"message": "successfully logged out",
 		"info":    "please discard your token on the client side",
 	})
 }
 
-func UpdateInfo(c *fiber.Ctx) error {
+func (ctl *Controller) UpdateInfo(c *fiber.Ctx) error {
 	type UpdateDataInput struct {
 		Fullname  string `json:"fullname"`
 		Email     string `json:"email"`
@@ -242,27 +258,29 @@ func UpdateInfo(c *fiber.Ctx) error {
 		})
 	}
 
-	user := new(models.User)
-
-	db := database.DB
-
-	db.Where("uuid = ?", userUUID).First(&user)
+	user, err := ctl.Users.FindByUUID(userUUID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "User not found",
+		})
+	}
 	user.Fullname = updateData.Fullname
 	user.Email = updateData.Email
 	user.Phone = updateData.Phone
 	user.Signature = updateData.Signature
 
-	db.Save(&user)
+	ctl.Users.Save(user)
 
 	return c.JSON(fiber.Map{
 		"status":  "success",
 		"message": "User successfully updated",
-		"data":    user,
+		"data":    user.ToUserResponse(),
 	})
 
 }
 
-func ChangePassword(c *fiber.Ctx) error {
+func (ctl *Controller) ChangePassword(c *fiber.Ctx) error {
 	type UpdateDataInput struct {
 		OldPassword     string `json:"old_password"`
 		Password        string `json:"password"`
@@ -286,15 +304,21 @@ func ChangePassword(c *fiber.Ctx) error {
 		})
 	}
 
-	user := new(models.User)
-
-	database.DB.Where("uuid = ?", userUUID).First(&user)
+	user, err := ctl.Users.FindByUUID(userUUID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "User not found",
+		})
+	}
 
-	if err := user.ComparePassword(updateData.OldPassword); err != nil {
+	if err := ctl.Users.CheckPassword(user.UUID, updateData.OldPassword); errors.Is(err, repository.ErrWrongPassword) {
 		c.Status(400)
 		return c.JSON(fiber.Map{
 			"message": "votre mot de passe n'est pas correct! 😰",
 		})
+	} else if err != nil {
+		return err
 	}
 
 	if updateData.Password != updateData.PasswordConfirm {
@@ -304,22 +328,14 @@ func ChangePassword(c *fiber.Ctx) error {
 		})
 	}
 
-	p, err := utils.HashPassword(updateData.Password)
-	if err != nil {
+	if err := ctl.Users.SetPassword(user.UUID, updateData.Password); err != nil {
 		return err
 	}
 
-	db := database.DB
-
-	db.First(&user, user.UUID)
-	user.Password = p
-
-	db.Save(&user)
-
 	return c.JSON(fiber.Map{
 		"status":  "success",
 		"message": "Password successfully updated",
-		"data":    user,
+		"data":    user.ToUserResponse(),
 	})
 
 }
@@ -1,19 +1,16 @@
 package auth
 
 import (
-	"net/smtp"
 	"time"
 
-	"github.com/Danny19977/sr-api/database"
+	"github.com/Danny19977/sr-api/mailer"
 	"github.com/Danny19977/sr-api/models"
 	"github.com/Danny19977/sr-api/utils"
 	"github.com/gofiber/fiber/v2"
-	"github.com/joho/godotenv"
-	"golang.org/x/crypto/bcrypt"
 )
 
-func Forgot(c *fiber.Ctx) error {
-	godotenv.Load()
+func (ctl *Controller) Forgot(c *fiber.Ctx) error {
+	cfg := ctl.Config
 	u := new(models.PasswordReset)
 
 	if err := c.BodyParser(&u); err != nil {
@@ -30,37 +27,27 @@ func Forgot(c *fiber.Ctx) error {
 	}
 
 	// search for the email in the database, if the user exist
-	um := &models.User{}
-
-	database.DB.Where("email = ?", u.Email).First(um)
-
-	if um.UUID == "" {
+	if _, err := ctl.Users.FindByEmail(u.Email); err != nil {
 		c.Status(400)
 		return c.JSON(fiber.Map{
 			"message": "invalid email address 😰",
 		})
 	}
 
-	// token expiration time is 3hr
-	pr.ExpirationTime = time.Now().Add(time.Hour * time.Duration(3))
+	pr.ExpirationTime = time.Now().Add(cfg.Auth.ResetTokenTTL)
 	pr.CreatedAt = time.Now()
 
-	database.DB.Create(pr)
-
-	from := utils.Env("EMAIL_FROM")
-
-	to := []string{
-		u.Email,
-	}
-
-	auth := smtp.PlainAuth("", utils.Env("EMAIL_USERNAME"), utils.Env("EMAIL_PASSWORD"), utils.Env("EMAIL_HOST"))
+	ctl.DB.Create(pr)
 
-	url := utils.Env("RESET_URL") + token
+	url := cfg.SMTP.ResetURL + token
 
-	msg := []byte("Click <a href=\"" + url + "\">here</a> to reset your password!")
-
-	err := smtp.SendMail(utils.Env("EMAIL_HOST")+":"+utils.Env("EMAIL_PORT"), auth, from, to, msg)
+	err := ctl.Mailer.Send(mailer.Message{
+		To:      []string{u.Email},
+		Subject: "Password reset",
+		HTML:    "Click <a href=\"" + url + "\">here</a> to reset your password!",
+	})
 	if err != nil {
+		ctl.Logger.Printf("password reset mail to %s failed: %v", u.Email, err)
 		c.Status(400)
 		return c.JSON(fiber.Map{
 			"message": "email was not sent 😰",
@@ -73,11 +60,11 @@ func Forgot(c *fiber.Ctx) error {
 
 }
 
-func ResetPassword(c *fiber.Ctx) error {
+func (ctl *Controller) ResetPassword(c *fiber.Ctx) error {
 
 	rp := &models.PasswordReset{}
 
-	if err := database.DB.Where("token = ?", c.Params("token")).Last(rp); err.Error != nil {
+	if err := ctl.DB.Where("token = ?", c.Params("token")).Last(rp); err.Error != nil {
 		c.Status(400)
 		return c.JSON(fiber.Map{
 			"message": "invalid token",
@@ -102,6 +89,13 @@ func ResetPassword(c *fiber.Ctx) error {
 
 	r := new(models.Reset)
 
+	if err := c.BodyParser(r); err != nil {
+		c.Status(400)
+		return c.JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
 	if r.Password != r.PasswordConfirm {
 		c.Status(400)
 		return c.JSON(fiber.Map{
@@ -109,8 +103,16 @@ func ResetPassword(c *fiber.Ctx) error {
 		})
 	}
 
-	password, _ := bcrypt.GenerateFromPassword([]byte(r.Password), 14)
-	database.DB.Model(&models.User{}).Where("email = ?", rp.Email).Update("password", password)
+	u, err := ctl.Users.FindByEmail(rp.Email)
+	if err != nil {
+		c.Status(400)
+		return c.JSON(fiber.Map{
+			"message": "invalid token",
+		})
+	}
+	if err := ctl.Users.SetPassword(u.UUID, r.Password); err != nil {
+		return err
+	}
 
 	return c.JSON(fiber.Map{
 		"message": "success",
@@ -0,0 +1,151 @@
+package compliance
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Danny19977/sr-api/app"
+	"github.com/Danny19977/sr-api/repository"
+	"github.com/Danny19977/sr-api/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ProvinceCompliance is the compliance summary of a province over a period
+type ProvinceCompliance struct {
+	ProvinceUUID string  `json:"province_uuid"`
+	ProvinceName string  `json:"province_name"`
+	OnTime       int64   `json:"on_time"`
+	Late         int64   `json:"late"`
+	Missing      int64   `json:"missing"`
+	Escalated    int64   `json:"escalated"`
+	Rate         float64 `json:"compliance_rate"` // Share of the slots entered on time, in percent
+}
+
+// scopeProvinces returns the provinces of the province_uuid query, narrowed
+// to those an ASM caller may see; nil keeps every province
+func (ctl *Controller) scopeProvinces(c *fiber.Ctx) []string {
+	var requested []string
+	if provinceUUID := c.Query("province_uuid"); provinceUUID != "" {
+		requested = []string{provinceUUID}
+	}
+	userUUID, _ := utils.GetUserUUIDFromToken(c)
+	return app.NarrowProvinces(ctl.ScopeProvinces(userUUID), requested)
+}
+
+// parsePeriod reads start_date and end_date, defaulting to the last 30 days
+func parsePeriod(c *fiber.Ctx) (time.Time, time.Time, error) {
+	now := time.Now()
+	end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	start := end.AddDate(0, 0, -29)
+
+	var err error
+	if value := c.Query("start_date"); value != "" {
+		if start, err = time.Parse("2006-01-02", value); err != nil {
+			return start, end, err
+		}
+	}
+	if value := c.Query("end_date"); value != "" {
+		if end, err = time.Parse("2006-01-02", value); err != nil {
+			return start, end, err
+		}
+	}
+	return start, end, nil
+}
+
+// Paginate the compliance history
+func (ctl *Controller) GetPaginatedHistory(c *fiber.Ctx) error {
+	page, err := strconv.Atoi(c.Query("page", "1"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(c.Query("limit", "15"))
+	if err != nil || limit <= 0 {
+		limit = 15
+	}
+	offset := (page - 1) * limit
+
+	start, end, err := parsePeriod(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid date format. Use YYYY-MM-DD",
+			"error":   err.Error(),
+		})
+	}
+
+	opts := repository.ComplianceListOptions{
+		ListOptions: repository.ListOptions{Offset: offset, Limit: limit},
+		From:        start,
+		To:          end,
+		Status:      c.Query("status"),
+	}
+	opts.ProvinceUUIDs = ctl.scopeProvinces(c)
+
+	dataList, totalRecords, err := ctl.Compliance.History(opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to fetch compliance history",
+			"error":   err.Error(),
+		})
+	}
+
+	totalPages := int((totalRecords + int64(limit) - 1) / int64(limit))
+
+	pagination := map[string]interface{}{
+		"total_records": totalRecords,
+		"total_pages":   totalPages,
+		"current_page":  page,
+		"page_size":     limit,
+	}
+
+	return c.JSON(fiber.Map{
+		"status":     "success",
+		"message":    "Get compliance history success",
+		"data":       dataList,
+		"pagination": pagination,
+	})
+}
+
+// Get the compliance summary of each province
+func (ctl *Controller) GetSummary(c *fiber.Ctx) error {
+	start, end, err := parsePeriod(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid date format. Use YYYY-MM-DD",
+			"error":   err.Error(),
+		})
+	}
+
+	summaries, err := ctl.Compliance.Summary(start, end, ctl.scopeProvinces(c))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to fetch compliance summary",
+			"error":   err.Error(),
+		})
+	}
+
+	data := make([]ProvinceCompliance, 0, len(summaries))
+	for _, s := range summaries {
+		item := ProvinceCompliance{
+			ProvinceUUID: s.ProvinceUUID,
+			ProvinceName: s.ProvinceName,
+			OnTime:       s.OnTime,
+			Late:         s.Late,
+			Missing:      s.Missing,
+			Escalated:    s.Escalated,
+		}
+		if total := s.OnTime + s.Late + s.Missing; total > 0 {
+			item.Rate = float64(s.OnTime) * 100 / float64(total)
+		}
+		data = append(data, item)
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Compliance summary fetched",
+		"data":    data,
+	})
+}
@@ -0,0 +1,118 @@
+package country
+
+import (
+	"time"
+
+	"github.com/Danny19977/sr-api/fiscal"
+	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/workdays"
+	"github.com/gofiber/fiber/v2"
+)
+
+// CalendarResponse is the fiscal calendar of a country with its current periods
+type CalendarResponse struct {
+	FiscalYearStart int             `json:"fiscal_year_start"`
+	FiscalPattern   string          `json:"fiscal_pattern"`
+	FiscalWeekStart int             `json:"fiscal_week_start"`
+	WorkingDays     string          `json:"working_days"`
+	Calendar        fiscal.Calendar `json:"calendar"`
+	Year            fiscal.Period   `json:"year"`
+	Quarters        []fiscal.Period `json:"quarters"`
+	Months          []fiscal.Period `json:"months"`
+	Week            fiscal.Period   `json:"week"`
+}
+
+// calendarResponse describes the current fiscal year of country
+func calendarResponse(country *models.Country) CalendarResponse {
+	now := time.Now()
+	cal := country.Calendar()
+	year := cal.YearOf(now)
+	workingDays := country.WorkingDays
+	if workingDays == "" {
+		workingDays = workdays.DefaultWeekdays
+	}
+	return CalendarResponse{
+		FiscalYearStart: country.FiscalYearStart,
+		FiscalPattern:   country.FiscalPattern,
+		FiscalWeekStart: country.FiscalWeekStart,
+		WorkingDays:     workingDays,
+		Calendar:        cal,
+		Year:            cal.Year(year, now.Location()),
+		Quarters:        cal.Quarters(year, now.Location()),
+		Months:          cal.Months(year, now.Location()),
+		Week:            cal.WeekOf(now),
+	}
+}
+
+// Get the fiscal calendar of a country
+func (ctl *Controller) GetCountryCalendar(c *fiber.Ctx) error {
+	country, err := ctl.Geography.FindCountry(c.Params("uuid"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"status":  "error",
+			"message": "No Country name found",
+			"data":    nil,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Fiscal calendar found",
+		"data":    calendarResponse(country),
+	})
+}
+
+// Update the fiscal calendar and the working days of a country. The
+// dashboards are recomputed with them.
+func (ctl *Controller) UpdateCountryCalendar(c *fiber.Ctx) error {
+	type UpdateData struct {
+		FiscalYearStart int    `json:"fiscal_year_start"`
+		FiscalPattern   string `json:"fiscal_pattern"`
+		FiscalWeekStart int    `json:"fiscal_week_start"`
+		WorkingDays     string `json:"working_days"`
+	}
+
+	var updateData UpdateData
+	if err := c.BodyParser(&updateData); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Review your input",
+			"error":   err.Error(),
+		})
+	}
+
+	country, err := ctl.Geography.FindCountry(c.Params("uuid"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"status":  "error",
+			"message": "No Country name found",
+			"data":    nil,
+		})
+	}
+	country.FiscalYearStart = updateData.FiscalYearStart
+	country.FiscalPattern = updateData.FiscalPattern
+	country.FiscalWeekStart = updateData.FiscalWeekStart
+	country.WorkingDays = updateData.WorkingDays
+
+	if err := country.ValidateCalendar(); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid fiscal calendar",
+			"error":   err.Error(),
+		})
+	}
+
+	if err := ctl.Geography.SaveCalendar(country); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to update the fiscal calendar",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Fiscal calendar updated",
+		"data":    calendarResponse(country),
+	})
+}
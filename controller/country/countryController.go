@@ -3,17 +3,15 @@ package country
 import (
 	"strconv"
 
-	"github.com/Danny19977/sr-api/database"
 	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/repository"
 	"github.com/Danny19977/sr-api/utils"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 )
 
 // Paginate
-func GetPaginatedCountry(c *fiber.Ctx) error {
-	db := database.DB
-
+func (ctl *Controller) GetPaginatedCountry(c *fiber.Ctx) error {
 	// Parse query parameters for pagination
 	page, err := strconv.Atoi(c.Query("page", "1"))
 	if err != nil || page <= 0 {
@@ -28,22 +26,17 @@ func GetPaginatedCountry(c *fiber.Ctx) error {
 	// Parse search query
 	search := c.Query("search", "")
 
-	var countries []models.Country
-	var totalRecords int64
+	opts := repository.ListOptions{Search: search, Offset: offset, Limit: limit}
 
 	userUUID, _ := utils.GetUserUUIDFromToken(c)
-	var requestingUser models.User
-	db.Where("uuid = ?", userUUID).First(&requestingUser)
-
-	query := db.Model(&models.Country{})
-	if requestingUser.Role == "ASM" {
-		query = query.Where("uuid IN (SELECT country_uuid FROM users WHERE uuid = ?)", userUUID)
+	if requestingUser, err := ctl.Users.FindByUUID(userUUID); err == nil && requestingUser.Role == "ASM" {
+		opts.ProvinceUUID = requestingUser.ProvinceUUID
+		if opts.ProvinceUUID == nil {
+			opts.ProvinceUUID = new(string)
+		}
 	}
-	query = query.Where("name ILIKE ?", "%"+search+"%")
-	query.Count(&totalRecords)
 
-	query = query.Offset(offset).Limit(limit).Order("updated_at DESC")
-	err = query.Find(&countries).Error
+	countries, totalRecords, err := ctl.Geography.ListCountries(opts, userUUID)
 
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
@@ -74,10 +67,8 @@ func GetPaginatedCountry(c *fiber.Ctx) error {
 }
 
 // Get All data
-func GetAllCountry(c *fiber.Ctx) error {
-	db := database.DB
-	var data []models.Country
-	db.Find(&data)
+func (ctl *Controller) GetAllCountry(c *fiber.Ctx) error {
+	data, _ := ctl.Geography.AllCountries()
 	return c.JSON(fiber.Map{
 		"status":  "success",
 		"message": "All Countries",
@@ -86,12 +77,10 @@ func GetAllCountry(c *fiber.Ctx) error {
 }
 
 // Get one data
-func GetCountry(c *fiber.Ctx) error {
+func (ctl *Controller) GetCountry(c *fiber.Ctx) error {
 	uuid := c.Params("uuid")
-	db := database.DB
-	var Country models.Country
-	db.Where("uuid = ?", uuid).First(&Country)
-	if Country.Name == "" {
+	Country, err := ctl.Geography.FindCountry(uuid)
+	if err != nil {
 		return c.Status(404).JSON(
 			fiber.Map{
 				"status":  "error",
@@ -110,15 +99,23 @@ func GetCountry(c *fiber.Ctx) error {
 }
 
 // Create data
-func CreateCountry(c *fiber.Ctx) error {
+func (ctl *Controller) CreateCountry(c *fiber.Ctx) error {
 	p := &models.Country{}
 
 	if err := c.BodyParser(&p); err != nil {
 		return err
 	}
 
+	if err := p.ValidateCalendar(); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid fiscal calendar",
+			"error":   err.Error(),
+		})
+	}
+
 	p.UUID = uuid.New().String()
-	database.DB.Create(p)
+	ctl.Geography.CreateCountry(p)
 
 	return c.JSON(
 		fiber.Map{
@@ -130,9 +127,8 @@ func CreateCountry(c *fiber.Ctx) error {
 }
 
 // Update data
-func UpdateCountry(c *fiber.Ctx) error {
+func (ctl *Controller) UpdateCountry(c *fiber.Ctx) error {
 	uuid := c.Params("uuid")
-	db := database.DB
 
 	type UpdateData struct {
 		UUID      string `json:"uuid"`
@@ -152,13 +148,20 @@ func UpdateCountry(c *fiber.Ctx) error {
 		)
 	}
 
-	country := new(models.Country)
-
-	db.Where("uuid = ?", uuid).First(&country)
+	country, err := ctl.Geography.FindCountry(uuid)
+	if err != nil {
+		return c.Status(404).JSON(
+			fiber.Map{
+				"status":  "error",
+				"message": "No Country name found",
+				"data":    nil,
+			},
+		)
+	}
 	country.Name = updateData.Name
 	country.Signature = updateData.Signature
 
-	db.Save(&country)
+	ctl.Geography.SaveCountry(country)
 
 	return c.JSON(
 		fiber.Map{
@@ -171,14 +174,11 @@ func UpdateCountry(c *fiber.Ctx) error {
 }
 
 // Delete data
-func DeleteCountry(c *fiber.Ctx) error {
+func (ctl *Controller) DeleteCountry(c *fiber.Ctx) error {
 	uuid := c.Params("uuid")
 
-	db := database.DB
-
-	var country models.Country
-	db.Where("uuid = ?", uuid).First(&country)
-	if country.Name == "" {
+	country, err := ctl.Geography.FindCountry(uuid)
+	if err != nil {
 		return c.Status(404).JSON(
 			fiber.Map{
 				"status":  "error",
@@ -188,7 +188,7 @@ func DeleteCountry(c *fiber.Ctx) error {
 		)
 	}
 
-	db.Delete(&country)
+	ctl.Geography.DeleteCountry(country)
 
 	return c.JSON(
 		fiber.Map{
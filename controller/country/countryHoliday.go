@@ -0,0 +1,138 @@
+package country
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Danny19977/sr-api/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Get the holidays of a country, of the year given by the year query when set
+func (ctl *Controller) GetCountryHolidays(c *fiber.Ctx) error {
+	country, err := ctl.Geography.FindCountry(c.Params("uuid"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"status":  "error",
+			"message": "No Country name found",
+			"data":    nil,
+		})
+	}
+
+	year := 0
+	if value := c.Query("year"); value != "" {
+		if year, err = strconv.Atoi(value); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid year",
+				"error":   err.Error(),
+			})
+		}
+	}
+
+	holidays, err := ctl.Geography.Holidays(country.UUID, year)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to fetch holidays",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "All Holidays",
+		"data":    holidays,
+	})
+}
+
+// Add a holiday to a country. The dashboards no longer count it as a working
+// day.
+func (ctl *Controller) CreateCountryHoliday(c *fiber.Ctx) error {
+	type CreateData struct {
+		Date string `json:"date"` // 2006-01-02
+		Name string `json:"name"`
+	}
+
+	var createData CreateData
+	if err := c.BodyParser(&createData); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Review your input",
+			"error":   err.Error(),
+		})
+	}
+
+	country, err := ctl.Geography.FindCountry(c.Params("uuid"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"status":  "error",
+			"message": "No Country name found",
+			"data":    nil,
+		})
+	}
+
+	date, err := time.Parse("2006-01-02", createData.Date)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid date format. Use YYYY-MM-DD",
+			"error":   err.Error(),
+		})
+	}
+
+	holiday := &models.Holiday{
+		UUID:        uuid.New().String(),
+		CountryUUID: country.UUID,
+		Date:        date,
+		Name:        createData.Name,
+	}
+	if err := holiday.Validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid holiday",
+			"error":   err.Error(),
+		})
+	}
+
+	if err := ctl.Geography.CreateHoliday(holiday); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to create the holiday",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Holiday created success",
+		"data":    holiday,
+	})
+}
+
+// Delete a holiday
+func (ctl *Controller) DeleteCountryHoliday(c *fiber.Ctx) error {
+	holiday, err := ctl.Geography.FindHoliday(c.Params("uuid"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"status":  "error",
+			"message": "No holiday found",
+			"data":    nil,
+		})
+	}
+
+	if err := ctl.Geography.DeleteHoliday(holiday); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to delete the holiday",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Holiday deleted success",
+		"data":    nil,
+	})
+}
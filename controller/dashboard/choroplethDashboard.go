@@ -0,0 +1,113 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Danny19977/sr-api/fiscal"
+	"github.com/Danny19977/sr-api/geo"
+	"github.com/Danny19977/sr-api/repository"
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetChoropleth returns the provinces as a GeoJSON feature collection of
+// their boundaries, each with its sales, target and achievement over the date
+// range, the map form of the heatmaps. The target sums the fiscal weeks or
+// months of the period query overlapping the range, months by default.
+// Provinces without a boundary are left out.
+func (ctl *Controller) GetChoropleth(c *fiber.Ctx) error {
+	provinceUUIDs := ctl.scopeProvinces(c, parseProvinces(c))
+	period := c.Query("period", "month")
+	if period != "month" && period != "week" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid period",
+			"error":   "period must be week or month",
+		})
+	}
+
+	cal, err := ctl.Dashboard.Calendar(provinceUUIDs)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Error fetching choropleth",
+			"error":   err.Error(),
+		})
+	}
+	startDate, endDate := c.Query("start_date"), c.Query("end_date")
+	if startDate == "" || endDate == "" {
+		// Default to the current fiscal month if no date range provided
+		now := time.Now()
+		startDate = cal.MonthOf(now).From.Format("2006-01-02")
+		endDate = now.Format("2006-01-02")
+	}
+	dateRange, err := parseDateRange(startDate, endDate)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid date range",
+			"error":   err.Error(),
+		})
+	}
+
+	query := dashboardQuery{
+		endpoint:  "choropleth",
+		params:    map[string]string{"start_date": startDate, "end_date": endDate, "period": period},
+		provinces: provinceUUIDs,
+		from:      dateRange.StartDate,
+		to:        dateRange.EndDate,
+	}
+	return ctl.respond(c, query, "Error fetching choropleth", func() (interface{}, error) {
+		return ctl.getChoropleth(cal, period, dateRange, provinceUUIDs)
+	})
+}
+
+func (ctl *Controller) getChoropleth(cal fiscal.Calendar, period string, dateRange DateRange, provinceUUIDs []string) (geo.FeatureCollection, error) {
+	provinces, err := ctl.Geography.Provinces(provinceUUIDs)
+	if err != nil {
+		return geo.FeatureCollection{}, err
+	}
+
+	rg := repository.TimeRange{From: dateRange.StartDate, To: dateRange.EndDate.AddDate(0, 0, 1).Add(-time.Microsecond)}
+	totalRows, err := ctl.Dashboard.ProvinceTotals(rg, provinceUUIDs)
+	if err != nil {
+		return geo.FeatureCollection{}, err
+	}
+	totals := make(map[string]int64, len(totalRows))
+	for _, row := range totalRows {
+		totals[row.UUID] = row.Total
+	}
+
+	periods := fiscalPeriods(cal, period, dateRange)
+	var targetRows []repository.TargetRow
+	if period == "week" {
+		targetRows, err = ctl.Dashboard.WeeklyTargets(nil, provinceUUIDs)
+	} else {
+		targetRows, err = ctl.Dashboard.MonthlyTargets(nil, provinceUUIDs)
+		targetRows = fiscalMonthTargets(cal, targetRows)
+	}
+	if err != nil {
+		return geo.FeatureCollection{}, err
+	}
+	targets := sumPeriodTargets(targetRows, periods)
+
+	var features []geo.Feature
+	for _, province := range provinces {
+		if province.Boundary == "" {
+			continue
+		}
+		var geometry geo.Geometry
+		if err := json.Unmarshal([]byte(province.Boundary), &geometry); err != nil {
+			return geo.FeatureCollection{}, err
+		}
+		features = append(features, geo.Feature{
+			Type:     "Feature",
+			ID:       province.UUID,
+			Geometry: geometry,
+			Properties: map[string]interface{}{
+				"name":        province.Name,
+				"sales":       totals[province.UUID],
+				"target":      targets[province.UUID],
+				"achievement": achievementOf(float64(totals[province.UUID]), targets[province.UUID]),
+			},
+		})
+	}
+	return geo.NewFeatureCollection(features), nil
+}
@@ -0,0 +1,67 @@
+package dashboard_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Danny19977/sr-api/apptest"
+	"github.com/Danny19977/sr-api/geo"
+	"github.com/Danny19977/sr-api/repository"
+)
+
+func TestChoroplethOfTheUploadedBoundaries(t *testing.T) {
+	env := apptest.New(t)
+	now := time.Now()
+	seedProvinces(t, env, 2, now)
+	admin := env.CreateUser("Admin", nil)
+	token := env.Token(admin)
+
+	provinces, err := env.App.Geography.AllProvinces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var first string
+	for _, province := range provinces {
+		if strings.HasPrefix(province.Name, "Province 0 ") {
+			first = province.Name
+		}
+	}
+
+	square := [][][]float64{{{15, -5}, {16, -5}, {16, -4}, {15, -4}, {15, -5}}}
+	upload := func(name string) *apptest.Response {
+		return env.Do(http.MethodPost, "/api/provinces/boundaries?name_property=NAME_1", token, map[string]interface{}{
+			"type": "FeatureCollection",
+			"features": []map[string]interface{}{{
+				"type":       "Feature",
+				"properties": map[string]interface{}{"NAME_1": name},
+				"geometry":   map[string]interface{}{"type": "Polygon", "coordinates": square},
+			}},
+		})
+	}
+	if resp := upload("Atlantis"); resp.Status != http.StatusBadRequest {
+		t.Errorf("got status %d for an unknown province, want 400", resp.Status)
+	}
+	if resp := upload(strings.ToUpper(first)); resp.Status != http.StatusOK {
+		t.Fatalf("got status %d: %s", resp.Status, resp.Body)
+	}
+
+	var collection geo.FeatureCollection
+	today := now.Format("2006-01-02")
+	resp := env.Do(http.MethodGet, "/api/dashboard/choropleth?period=week&start_date="+today+"&end_date="+today, token, nil)
+	if err := resp.JSON(&collection); err != nil || resp.Status != http.StatusOK {
+		t.Fatalf("got status %d: %s", resp.Status, resp.Body)
+	}
+
+	// Only the province with a boundary is drawn, with its sales of the day
+	// against the target of its week
+	if len(collection.Features) != 1 || collection.Features[0].Geometry.Type != "Polygon" {
+		t.Fatalf("got %+v, want the one outlined province", collection.Features)
+	}
+	properties := collection.Features[0].Properties
+	sales := float64(10 * len(repository.TimeSlots))
+	if properties["name"] != first || properties["sales"] != sales || properties["target"] != 700.0 || properties["achievement"] != sales/7 {
+		t.Errorf("got %v, want %v sold against 700", properties, sales)
+	}
+}
@@ -0,0 +1,51 @@
+package dashboard
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Danny19977/sr-api/workdays"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Comparison is the period a dashboard compares the selected days against
+type Comparison struct {
+	Mode string    `json:"mode"` // "previous_period", "last_year" or "same_weekday"
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"` // Start of the day after the period
+	// WorkingDays is the number of working days in the period, the same as
+	// in the selected days
+	WorkingDays int `json:"working_days"`
+}
+
+// parseComparison reads the comparison mode of a request, the previous
+// period by default
+func parseComparison(c *fiber.Ctx) (string, error) {
+	mode := c.Query("compare", workdays.PreviousPeriod)
+	if !workdays.ValidMode(mode) {
+		return "", fmt.Errorf("compare must be %s", strings.Join(workdays.Modes, ", "))
+	}
+	return mode, nil
+}
+
+// compareTo returns the days the days [from, to) are compared against in mode
+func compareTo(cal workdays.Calendar, mode string, from, to time.Time) (Comparison, error) {
+	start, end, err := cal.Comparable(mode, from, to)
+	if err != nil {
+		return Comparison{}, err
+	}
+	return Comparison{Mode: mode, From: start, To: end, WorkingDays: cal.Count(start, end)}, nil
+}
+
+// dailyComparison resolves the working days of provinceUUIDs and the day the
+// day of selectedDate is compared against in mode
+func (ctl *Controller) dailyComparison(mode string, selectedDate time.Time, provinceUUIDs []string) (workdays.Calendar, Comparison, error) {
+	cal, err := ctl.Dashboard.Workdays(provinceUUIDs)
+	if err != nil {
+		return cal, Comparison{}, err
+	}
+	startOfDay := time.Date(selectedDate.Year(), selectedDate.Month(), selectedDate.Day(), 0, 0, 0, 0, selectedDate.Location())
+	comparison, err := compareTo(cal, mode, startOfDay, startOfDay.AddDate(0, 0, 1))
+	return cal, comparison, err
+}
@@ -0,0 +1,307 @@
+package dashboard
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Danny19977/sr-api/events"
+	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/repository"
+	"github.com/gofiber/fiber/v2"
+)
+
+// streamHeartbeat is how often an idle stream sends a comment line, so
+// proxies keep the connection open and closed clients are noticed
+const streamHeartbeat = 15 * time.Second
+
+// streamBuffer is the number of pending writes a slow stream may lag behind.
+// Further notifications are dropped; the next recomputation catches up.
+const streamBuffer = 64
+
+// StreamEntry is the payload of an "entry" event
+type StreamEntry struct {
+	Action       string    `json:"action"` // "created", "updated" or "deleted"
+	SaleUUID     string    `json:"sale_uuid"`
+	ProvinceUUID string    `json:"province_uuid"`
+	ProductUUID  string    `json:"product_uuid"`
+	Quantity     int64     `json:"quantity"`
+	TimeSlot     string    `json:"time_slot"` // Empty outside of the reporting windows
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// StreamSlotCompleted is the payload of a "slot_completed" event, sent when a
+// province records its first entry of a time slot
+type StreamSlotCompleted struct {
+	ProvinceUUID string `json:"province_uuid"`
+	TimeSlot     string `json:"time_slot"`
+}
+
+// StreamTotals is the payload of a "totals" event
+type StreamTotals struct {
+	TotalSalesToday int64            `json:"total_sales_today"`
+	Provinces       map[string]int64 `json:"provinces"`  // Daily total per province
+	TimeSlots       map[string]int64 `json:"time_slots"` // Total per time slot
+}
+
+// streamEvent is one server-sent event
+type streamEvent struct {
+	name string
+	data interface{}
+}
+
+// slotKey identifies the entries of a province in a time slot
+type slotKey struct {
+	provinceUUID string
+	slot         int
+}
+
+// streamState is what a daily monitor stream has told its client
+type streamState struct {
+	totals  StreamTotals
+	entries map[slotKey]int64
+}
+
+func buildStreamState(today []repository.SlotTotal) streamState {
+	state := streamState{
+		totals: StreamTotals{
+			TotalSalesToday: sumSlotTotals(today),
+			Provinces:       provinceDayTotals(today),
+			TimeSlots:       make(map[string]int64, len(repository.TimeSlots)),
+		},
+		entries: make(map[slotKey]int64),
+	}
+	for i, total := range slotDayTotals(today) {
+		state.totals.TimeSlots[repository.TimeSlots[i].Name] = total
+	}
+	for _, row := range today {
+		if inTimeSlot(row.Slot) {
+			state.entries[slotKey{row.ProvinceUUID, row.Slot}] += row.Entries
+		}
+	}
+	return state
+}
+
+// diffStreamState lists the events moving a client from prev to next
+func diffStreamState(prev, next streamState) []streamEvent {
+	var out []streamEvent
+
+	for key, entries := range next.entries {
+		if entries > 0 && prev.entries[key] == 0 {
+			out = append(out, streamEvent{"slot_completed", StreamSlotCompleted{
+				ProvinceUUID: key.provinceUUID,
+				TimeSlot:     repository.TimeSlots[key.slot].Name,
+			}})
+		}
+	}
+
+	changed := prev.totals.TotalSalesToday != next.totals.TotalSalesToday ||
+		len(prev.totals.Provinces) != len(next.totals.Provinces)
+	for uuid, total := range next.totals.Provinces {
+		changed = changed || prev.totals.Provinces[uuid] != total
+	}
+	for name, total := range next.totals.TimeSlots {
+		changed = changed || prev.totals.TimeSlots[name] != total
+	}
+	if changed {
+		out = append(out, streamEvent{"totals", next.totals})
+	}
+
+	return out
+}
+
+// dailyStream follows the writes touching one day of a set of provinces
+type dailyStream struct {
+	startOfDay    time.Time
+	provinceUUIDs map[string]bool
+	notifications chan events.Event
+}
+
+// matches reports whether scope touches the day and provinces of the stream
+func (s *dailyStream) matches(scope events.Scope) bool {
+	if len(s.provinceUUIDs) > 0 && scope.ProvinceUUID != "" && !s.provinceUUIDs[scope.ProvinceUUID] {
+		return false
+	}
+	if scope.From.IsZero() || scope.To.IsZero() {
+		return true
+	}
+	return scope.From.Before(s.startOfDay.AddDate(0, 0, 1)) && !scope.To.Before(s.startOfDay)
+}
+
+// notify runs in the writer's goroutine and must never block it
+func (s *dailyStream) notify(e events.Event) {
+	switch e.Kind {
+	case events.SaleCreated, events.SaleUpdated, events.SaleDeleted, events.SalesImported:
+	default:
+		return
+	}
+
+	for _, scope := range e.Scopes {
+		if s.matches(scope) {
+			select {
+			case s.notifications <- e:
+			default:
+			}
+			return
+		}
+	}
+}
+
+// entryEvent describes a sale of the stream's day, ok is false for other sales
+func (s *dailyStream) entryEvent(kind events.Kind, sale *models.Sale) (streamEvent, bool) {
+	if sale == nil || !s.matches(events.SaleScope(sale)) {
+		return streamEvent{}, false
+	}
+
+	actions := map[events.Kind]string{
+		events.SaleCreated: "created",
+		events.SaleUpdated: "updated",
+		events.SaleDeleted: "deleted",
+	}
+	entry := StreamEntry{
+		Action:       actions[kind],
+		SaleUUID:     sale.UUID,
+		ProvinceUUID: sale.ProvinceUUID,
+		ProductUUID:  sale.ProductUUID,
+		Quantity:     sale.Quantity,
+		CreatedAt:    sale.CreatedAt,
+	}
+	if slot := repository.SlotOf(sale.CreatedAt.In(s.startOfDay.Location())); inTimeSlot(slot) {
+		entry.TimeSlot = repository.TimeSlots[slot].Name
+	}
+	return streamEvent{"entry", entry}, true
+}
+
+// StreamDailyMonitor pushes the daily monitor of a date and a set of provinces
+// as server-sent events: a "snapshot" with the full dashboard, then "entry",
+// "slot_completed" and "totals" events as sales are committed
+func (ctl *Controller) StreamDailyMonitor(c *fiber.Ctx) error {
+	selectedDate, provinceUUIDs, err := parseDailyMonitorParams(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid date format. Use YYYY-MM-DD",
+			"error":   err.Error(),
+		})
+	}
+	mode, err := parseComparison(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid comparison",
+			"error":   err.Error(),
+		})
+	}
+	provinceUUIDs = ctl.scopeProvinces(c, provinceUUIDs)
+	work, comparison, err := ctl.dailyComparison(mode, selectedDate, provinceUUIDs)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Error fetching daily monitor data",
+			"error":   err.Error(),
+		})
+	}
+
+	stream := &dailyStream{
+		startOfDay:    time.Date(selectedDate.Year(), selectedDate.Month(), selectedDate.Day(), 0, 0, 0, 0, selectedDate.Location()),
+		provinceUUIDs: make(map[string]bool, len(provinceUUIDs)),
+		notifications: make(chan events.Event, streamBuffer),
+	}
+	for _, uuid := range provinceUUIDs {
+		stream.provinceUUIDs[uuid] = true
+	}
+
+	// Subscribe before the snapshot so no write falls in between
+	unsubscribe := ctl.Events.Subscribe(stream.notify)
+
+	snapshot, err := ctl.getDailyMonitorData(work, comparison, selectedDate, provinceUUIDs)
+	if err != nil {
+		unsubscribe()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Error fetching daily monitor data",
+			"error":   err.Error(),
+		})
+	}
+	today, err := ctl.Dashboard.SlotTotals(stream.startOfDay, 1, provinceUUIDs)
+	if err != nil {
+		unsubscribe()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Error fetching daily monitor data",
+			"error":   err.Error(),
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer unsubscribe()
+		ctl.runDailyStream(w, stream, snapshot, buildStreamState(today), provinceUUIDs)
+	})
+	return nil
+}
+
+// runDailyStream writes events until the client goes away
+func (ctl *Controller) runDailyStream(w *bufio.Writer, stream *dailyStream, snapshot DailyMonitorResponse, state streamState, provinceUUIDs []string) {
+	id := 0
+	send := func(out ...streamEvent) error {
+		for _, e := range out {
+			data, err := json.Marshal(e.data)
+			if err != nil {
+				return err
+			}
+			id++
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, e.name, data)
+		}
+		return w.Flush()
+	}
+
+	if err := send(streamEvent{"snapshot", snapshot}); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case e := <-stream.notifications:
+			// Coalesce a burst of writes into one recomputation
+			batch := []events.Event{e}
+		drain:
+			for {
+				select {
+				case next := <-stream.notifications:
+					batch = append(batch, next)
+				default:
+					break drain
+				}
+			}
+
+			var out []streamEvent
+			for _, e := range batch {
+				if entry, ok := stream.entryEvent(e.Kind, e.Sale); ok {
+					out = append(out, entry)
+				}
+			}
+
+			today, err := ctl.Dashboard.SlotTotals(stream.startOfDay, 1, provinceUUIDs)
+			if err != nil {
+				ctl.Logger.Printf("daily monitor stream: %v", err)
+			} else {
+				next := buildStreamState(today)
+				out = append(out, diffStreamState(state, next)...)
+				state = next
+			}
+
+			if err := send(out...); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
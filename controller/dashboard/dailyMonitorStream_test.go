@@ -0,0 +1,58 @@
+package dashboard
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Danny19977/sr-api/events"
+	"github.com/Danny19977/sr-api/repository"
+)
+
+func TestDiffStreamState(t *testing.T) {
+	before := buildStreamState([]repository.SlotTotal{
+		{ProvinceUUID: "p1", Slot: 0, Total: 10, Entries: 1},
+	})
+	after := buildStreamState([]repository.SlotTotal{
+		{ProvinceUUID: "p1", Slot: 0, Total: 15, Entries: 2},
+		{ProvinceUUID: "p1", Slot: 1, Total: 4, Entries: 1},
+	})
+
+	got := diffStreamState(before, after)
+	if len(got) != 2 {
+		t.Fatalf("got %d events, want slot_completed and totals: %+v", len(got), got)
+	}
+	completed, ok := got[0].data.(StreamSlotCompleted)
+	if got[0].name != "slot_completed" || !ok || completed.ProvinceUUID != "p1" || completed.TimeSlot != repository.TimeSlots[1].Name {
+		t.Errorf("first event = %+v, want p1 completing %s", got[0], repository.TimeSlots[1].Name)
+	}
+	totals, ok := got[1].data.(StreamTotals)
+	if got[1].name != "totals" || !ok || totals.TotalSalesToday != 19 || totals.Provinces["p1"] != 19 {
+		t.Errorf("second event = %+v, want totals of 19", got[1])
+	}
+
+	if unchanged := diffStreamState(after, after); len(unchanged) != 0 {
+		t.Errorf("identical states produced %+v", unchanged)
+	}
+}
+
+func TestDailyStreamMatches(t *testing.T) {
+	day := time.Date(2025, time.March, 10, 0, 0, 0, 0, time.UTC)
+	stream := &dailyStream{startOfDay: day, provinceUUIDs: map[string]bool{"p1": true}}
+
+	tests := []struct {
+		name  string
+		scope events.Scope
+		want  bool
+	}{
+		{"same day and province", events.Scope{ProvinceUUID: "p1", From: day.Add(9 * time.Hour), To: day.Add(9 * time.Hour)}, true},
+		{"other province", events.Scope{ProvinceUUID: "p2", From: day.Add(9 * time.Hour), To: day.Add(9 * time.Hour)}, false},
+		{"next day", events.Scope{ProvinceUUID: "p1", From: day.AddDate(0, 0, 1), To: day.AddDate(0, 0, 1)}, false},
+		{"import spanning the day", events.Scope{ProvinceUUID: "p1", From: day.AddDate(0, 0, -3), To: day.AddDate(0, 0, 3)}, true},
+		{"every province", events.Scope{From: day, To: day}, true},
+	}
+	for _, tt := range tests {
+		if got := stream.matches(tt.scope); got != tt.want {
+			t.Errorf("%s: matches = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
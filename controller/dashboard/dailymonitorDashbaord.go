@@ -5,8 +5,9 @@ import (
 	"strings"
 	"time"
 
-	"github.com/Danny19977/sr-api/database"
-	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/metrics"
+	"github.com/Danny19977/sr-api/repository"
+	"github.com/Danny19977/sr-api/workdays"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -14,7 +15,8 @@ type DailyMonitorResponse struct {
 	TotalSalesToday      int64                 `json:"total_sales_today"`
 	TargetForToday       int64                 `json:"target_for_today"`    // Added: Target from Week table
 	AchievementPercent   float64               `json:"achievement_percent"` // Added: % of target achieved
-	PaceVsYesterday      float64               `json:"pace_vs_yesterday"`   // Percentage comparison
+	PaceVsYesterday      float64               `json:"pace_vs_yesterday"`   // Percentage comparison with the comparison day
+	Comparison           Comparison            `json:"comparison"`
 	LastEntryStatus      []ProvinceEntryStatus `json:"last_entry_status"`
 	CumulativeSalesChart CumulativeSalesData   `json:"cumulative_sales_chart"`
 	DailyEntryTable      []DailyEntryRow       `json:"daily_entry_table"`
@@ -61,7 +63,7 @@ type CumulativeSalesData struct {
 	TimeSlots      []string `json:"time_slots"`      // ["8am", "12pm", "3pm", "8pm"]
 	TodaySales     []int64  `json:"today_sales"`     // Cumulative for today
 	YesterdaySales []int64  `json:"yesterday_sales"` // Cumulative for yesterday
-	AverageSales   []int64  `json:"average_sales"`   // Cumulative average (last 7 days)
+	AverageSales   []int64  `json:"average_sales"`   // Cumulative average (working days of the last 7 days)
 }
 
 type DailyEntryRow struct {
@@ -72,27 +74,76 @@ type DailyEntryRow struct {
 	Entry3pm     int64  `json:"entry_3pm"`
 	Entry8pm     int64  `json:"entry_8pm"`
 	DailyTotal   int64  `json:"daily_total"`
+	// FlaggedSlots names the time slots holding entries flagged as anomalies
+	FlaggedSlots []string `json:"flagged_slots"`
 }
 
 // GetDailyMonitor handles the daily operations monitor dashboard data retrieval
-func GetDailyMonitor(c *fiber.Ctx) error {
-	// Parse date from query parameter (defaults to today)
+func (ctl *Controller) GetDailyMonitor(c *fiber.Ctx) error {
+	selectedDate, provinceUUIDs, err := parseDailyMonitorParams(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid date format. Use YYYY-MM-DD",
+			"error":   err.Error(),
+		})
+	}
+
+	mode, err := parseComparison(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid comparison",
+			"error":   err.Error(),
+		})
+	}
+
+	provinceUUIDs = ctl.scopeProvinces(c, provinceUUIDs)
+	work, comparison, err := ctl.dailyComparison(mode, selectedDate, provinceUUIDs)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Error fetching daily monitor data",
+			"error":   err.Error(),
+		})
+	}
+
+	// The payload covers the days of the average and the comparison day up
+	// to the selected day
+	startOfDay := time.Date(selectedDate.Year(), selectedDate.Month(), selectedDate.Day(), 0, 0, 0, 0, selectedDate.Location())
+	query := dashboardQuery{
+		endpoint:  "daily-monitor",
+		params:    map[string]string{"date": selectedDate.Format("2006-01-02"), "compare": mode},
+		provinces: provinceUUIDs,
+		from:      startOfDay.AddDate(0, 0, -averageDays),
+		to:        startOfDay.AddDate(0, 0, 1),
+	}
+	if comparison.From.Before(query.from) {
+		query.from = comparison.From
+	}
+	// Today's pace moves with the clock, not only with new sales
+	if now := time.Now(); selectedDate.Year() == now.Year() && selectedDate.YearDay() == now.YearDay() {
+		query.ttl = time.Minute
+	}
+	compute := func() (interface{}, error) {
+		return ctl.getDailyMonitorData(work, comparison, selectedDate, provinceUUIDs)
+	}
+	if format := c.Query("format"); format != "" {
+		return ctl.export(c, query, format, compute)
+	}
+	return ctl.respond(c, query, "Error fetching daily monitor data", compute)
+}
+
+// parseDailyMonitorParams reads the selected date (today by default) and the
+// province filter of a daily monitor request
+func parseDailyMonitorParams(c *fiber.Ctx) (time.Time, []string, error) {
 	dateParam := c.Query("date")
 	provincesParam := c.Query("provinces")     // Comma-separated list
 	singleProvince := c.Query("province_uuid") // Single province for compatibility
 
-	var selectedDate time.Time
-	if dateParam == "" {
-		// Default to today
-		selectedDate = time.Now()
-	} else {
+	selectedDate := time.Now()
+	if dateParam != "" {
 		var err error
 		selectedDate, err = time.Parse("2006-01-02", dateParam)
 		if err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"message": "Invalid date format. Use YYYY-MM-DD",
-				"error":   err.Error(),
-			})
+			return time.Time{}, nil, err
 		}
 	}
 
@@ -115,86 +166,58 @@ func GetDailyMonitor(c *fiber.Ctx) error {
 		}
 	}
 
-	// Get all the required data
-	response, err := getDailyMonitorData(selectedDate, provinceUUIDs)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Error fetching daily monitor data",
-			"error":   err.Error(),
-		})
-	}
-
-	return c.JSON(response)
+	return selectedDate, provinceUUIDs, nil
 }
 
-func getDailyMonitorData(selectedDate time.Time, provinceUUIDs []string) (DailyMonitorResponse, error) {
+// averageDays is the number of past days averaged by the cumulative sales chart
+const averageDays = 7
+
+func (ctl *Controller) getDailyMonitorData(work workdays.Calendar, comparison Comparison, selectedDate time.Time, provinceUUIDs []string) (DailyMonitorResponse, error) {
 	// Normalize to start of day
 	startOfDay := time.Date(selectedDate.Year(), selectedDate.Month(), selectedDate.Day(), 0, 0, 0, 0, selectedDate.Location())
-	endOfDay := startOfDay.Add(24 * time.Hour)
-
-	// Get today's total sales
-	totalSalesToday, err := getTotalSalesForDay(startOfDay, endOfDay, provinceUUIDs)
-	if err != nil {
-		return DailyMonitorResponse{}, err
-	}
 
-	// Get target for today from Week table
-	_, weekNum := selectedDate.ISOWeek()
-	targetForToday, err := getDailyTargetFromWeek(selectedDate.Year(), weekNum, provinceUUIDs)
+	provinces, err := ctl.Dashboard.Provinces(provinceUUIDs)
 	if err != nil {
 		return DailyMonitorResponse{}, err
 	}
 
-	// Calculate achievement percentage
-	var achievementPercent float64
-	if targetForToday > 0 {
-		achievementPercent = float64(totalSalesToday) / float64(targetForToday) * 100
-	}
-
-	// Get pace vs yesterday
-	paceVsYesterday, err := getPaceVsYesterday(selectedDate, provinceUUIDs)
+	// One grouped query covers the selected day and the days of the average;
+	// day averageDays is the selected day, averageDays-1 the day before
+	firstDay := startOfDay.AddDate(0, 0, -averageDays)
+	slotTotals, err := ctl.Dashboard.SlotTotals(firstDay, averageDays+1, provinceUUIDs)
 	if err != nil {
 		return DailyMonitorResponse{}, err
 	}
+	today := slotTotalsOfDay(slotTotals, averageDays)
 
-	// Get last entry status for each province
-	lastEntryStatus, err := getLastEntryStatus(startOfDay, endOfDay, provinceUUIDs)
-	if err != nil {
-		return DailyMonitorResponse{}, err
-	}
-
-	// Get cumulative sales chart data
-	cumulativeSalesChart, err := getCumulativeSalesChart(selectedDate, provinceUUIDs)
-	if err != nil {
-		return DailyMonitorResponse{}, err
-	}
+	// Get today's total sales
+	totalSalesToday := sumSlotTotals(today)
 
-	// Get daily entry table data
-	dailyEntryTable, err := getDailyEntryTable(startOfDay, endOfDay, provinceUUIDs)
+	// Get target for today from Week table
+	cal, err := ctl.Dashboard.Calendar(provinceUUIDs)
 	if err != nil {
 		return DailyMonitorResponse{}, err
 	}
-
-	// Get province bar chart data (today's sales by province)
-	provinceBarChart, err := getProvinceBarChart(startOfDay, endOfDay, provinceUUIDs)
+	week := cal.WeekOf(selectedDate)
+	targetForToday, err := ctl.getDailyTargetFromWeek(week.Year, week.Index, provinceUUIDs)
 	if err != nil {
 		return DailyMonitorResponse{}, err
 	}
 
-	// Get time slot bar chart data (today's sales by time slot)
-	timeSlotBarChart, err := getTimeSlotBarChart(startOfDay, endOfDay, provinceUUIDs)
-	if err != nil {
-		return DailyMonitorResponse{}, err
+	// Calculate achievement percentage
+	var achievementPercent float64
+	if targetForToday > 0 {
+		achievementPercent = float64(totalSalesToday) / float64(targetForToday) * 100
 	}
 
-	// Get province pie chart data (province contribution %)
-	provincePieChart, err := getProvincePieChart(startOfDay, endOfDay, provinceUUIDs, totalSalesToday)
+	// Get pace vs the comparison day
+	paceVsYesterday, err := ctl.getPaceVsYesterday(selectedDate, comparison, provinceUUIDs, totalSalesToday)
 	if err != nil {
 		return DailyMonitorResponse{}, err
 	}
 
-	// Get time slot pie chart data (time slot distribution %)
-	timeSlotPieChart, err := getTimeSlotPieChart(startOfDay, endOfDay, provinceUUIDs, totalSalesToday)
+	// Get cumulative sales chart data
+	cumulativeSalesChart, err := ctl.getCumulativeSalesChart(work, firstDay, provinceUUIDs)
 	if err != nil {
 		return DailyMonitorResponse{}, err
 	}
@@ -204,114 +227,83 @@ func getDailyMonitorData(selectedDate time.Time, provinceUUIDs []string) (DailyM
 		TargetForToday:       targetForToday,
 		AchievementPercent:   achievementPercent,
 		PaceVsYesterday:      paceVsYesterday,
-		LastEntryStatus:      lastEntryStatus,
+		Comparison:           comparison,
+		LastEntryStatus:      getLastEntryStatus(startOfDay, provinces, today),
 		CumulativeSalesChart: cumulativeSalesChart,
-		DailyEntryTable:      dailyEntryTable,
-		ProvinceBarChart:     provinceBarChart,
-		TimeSlotBarChart:     timeSlotBarChart,
-		ProvincePieChart:     provincePieChart,
-		TimeSlotPieChart:     timeSlotPieChart,
+		DailyEntryTable:      getDailyEntryTable(provinces, today),
+		ProvinceBarChart:     getProvinceBarChart(provinces, today),
+		TimeSlotBarChart:     getTimeSlotBarChart(today),
+		ProvincePieChart:     getProvincePieChart(provinces, today, totalSalesToday),
+		TimeSlotPieChart:     getTimeSlotPieChart(today, totalSalesToday),
 	}, nil
 }
 
-// getTotalSalesForDay returns total sales for the specified day
-func getTotalSalesForDay(startOfDay, endOfDay time.Time, provinceUUIDs []string) (int64, error) {
-	db := database.DB
-	query := db.Model(&models.Sale{}).
-		Where("created_at BETWEEN ? AND ?", startOfDay, endOfDay)
-
-	if len(provinceUUIDs) > 0 {
-		query = query.Where("province_uuid IN ?", provinceUUIDs)
+// slotTotalsOfDay keeps the rows of one day of a SlotTotals result
+func slotTotalsOfDay(rows []repository.SlotTotal, day int) []repository.SlotTotal {
+	var result []repository.SlotTotal
+	for _, row := range rows {
+		if row.Day == day {
+			result = append(result, row)
+		}
 	}
+	return result
+}
 
+// sumSlotTotals returns the quantity sold in rows, inside and outside the time slots
+func sumSlotTotals(rows []repository.SlotTotal) int64 {
 	var total int64
-	err := query.Select("COALESCE(SUM(quantity), 0)").Row().Scan(&total)
-	return total, err
+	for _, row := range rows {
+		total += row.Total
+	}
+	return total
 }
 
-// getPaceVsYesterday calculates the pace comparison with yesterday at the same time
-func getPaceVsYesterday(selectedDate time.Time, provinceUUIDs []string) (float64, error) {
-	db := database.DB
+// inTimeSlot reports whether a slot index is one of the reporting windows
+func inTimeSlot(slot int) bool {
+	return slot >= 0 && slot < len(repository.TimeSlots)
+}
+
+// getPaceVsYesterday calculates the pace comparison with the comparison day,
+// the previous working day by default, at the same time
+func (ctl *Controller) getPaceVsYesterday(selectedDate time.Time, comparison Comparison, provinceUUIDs []string, todayTotal int64) (float64, error) {
 	now := time.Now()
 
 	// Only compare pace if looking at today
 	if selectedDate.Year() != now.Year() || selectedDate.YearDay() != now.YearDay() {
 		// For historical dates, compare full day totals
-		startOfSelectedDay := time.Date(selectedDate.Year(), selectedDate.Month(), selectedDate.Day(), 0, 0, 0, 0, selectedDate.Location())
-		endOfSelectedDay := startOfSelectedDay.Add(24 * time.Hour)
-
-		yesterday := selectedDate.AddDate(0, 0, -1)
-		startOfYesterday := time.Date(yesterday.Year(), yesterday.Month(), yesterday.Day(), 0, 0, 0, 0, yesterday.Location())
-		endOfYesterday := startOfYesterday.Add(24 * time.Hour)
-
-		todayTotal, _ := getTotalSalesForDay(startOfSelectedDay, endOfSelectedDay, provinceUUIDs)
-		yesterdayTotal, _ := getTotalSalesForDay(startOfYesterday, endOfYesterday, provinceUUIDs)
-
-		if yesterdayTotal == 0 {
-			return 0, nil
+		totals, err := ctl.Dashboard.RangeTotals(provinceUUIDs, repository.TimeRange{From: comparison.From, To: comparison.To.Add(-time.Microsecond)})
+		if err != nil {
+			return 0, err
 		}
-		return float64(todayTotal-yesterdayTotal) / float64(yesterdayTotal) * 100, nil
+		return metrics.PaceChange(todayTotal, totals), nil
 	}
 
 	// For today: compare up to current time
 	startOfToday := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-
-	yesterday := now.AddDate(0, 0, -1)
-	startOfYesterday := time.Date(yesterday.Year(), yesterday.Month(), yesterday.Day(), 0, 0, 0, 0, yesterday.Location())
-	yesterdaySameTime := startOfYesterday.Add(time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute)
-
-	// Today's sales so far
-	query := db.Model(&models.Sale{}).
-		Where("created_at BETWEEN ? AND ?", startOfToday, now)
-	if len(provinceUUIDs) > 0 {
-		query = query.Where("province_uuid IN ?", provinceUUIDs)
-	}
-	var todaySoFar int64
-	query.Select("COALESCE(SUM(quantity), 0)").Row().Scan(&todaySoFar)
-
-	// Yesterday at the same time
-	queryYesterday := db.Model(&models.Sale{}).
-		Where("created_at BETWEEN ? AND ?", startOfYesterday, yesterdaySameTime)
-	if len(provinceUUIDs) > 0 {
-		queryYesterday = queryYesterday.Where("province_uuid IN ?", provinceUUIDs)
-	}
-	var yesterdaySameTimeSales int64
-	queryYesterday.Select("COALESCE(SUM(quantity), 0)").Row().Scan(&yesterdaySameTimeSales)
-
-	if yesterdaySameTimeSales == 0 {
-		return 0, nil
+	totals, err := ctl.Dashboard.RangeTotals(provinceUUIDs, repository.TimeRange{From: startOfToday, To: now}, metrics.SameTimeOf(comparison.From, now))
+	if err != nil {
+		return 0, err
 	}
-
-	return float64(todaySoFar-yesterdaySameTimeSales) / float64(yesterdaySameTimeSales) * 100, nil
+	return metrics.PaceChange(totals[0], totals[1:]), nil
 }
 
 // getLastEntryStatus returns the last entry status for each province
-func getLastEntryStatus(startOfDay, endOfDay time.Time, provinceUUIDs []string) ([]ProvinceEntryStatus, error) {
-	db := database.DB
+func getLastEntryStatus(startOfDay time.Time, provinces []repository.ProvinceRef, today []repository.SlotTotal) []ProvinceEntryStatus {
 	var result []ProvinceEntryStatus
 
-	// Get provinces
-	var provinces []models.Province
-	provinceQuery := db.Model(&models.Province{})
-	if len(provinceUUIDs) > 0 {
-		provinceQuery = provinceQuery.Where("uuid IN ?", provinceUUIDs)
-	}
-	if err := provinceQuery.Find(&provinces).Error; err != nil {
-		return nil, err
-	}
-
-	// Time slots in order
-	timeSlots := []struct {
-		name      string
-		startHour int
-		endHour   int
-	}{
-		{"8am", 6, 10},
-		{"12pm", 10, 14},
-		{"3pm", 14, 18},
-		{"8pm", 18, 22},
+	// Index the slots each province reported in
+	reported := make(map[string]map[int]repository.SlotTotal)
+	for _, row := range today {
+		if !inTimeSlot(row.Slot) || row.Entries == 0 {
+			continue
+		}
+		if reported[row.ProvinceUUID] == nil {
+			reported[row.ProvinceUUID] = make(map[int]repository.SlotTotal)
+		}
+		reported[row.ProvinceUUID][row.Slot] = row
 	}
 
+	now := time.Now()
 	for _, province := range provinces {
 		status := ProvinceEntryStatus{
 			ProvinceUUID:   province.UUID,
@@ -323,35 +315,19 @@ func getLastEntryStatus(startOfDay, endOfDay time.Time, provinceUUIDs []string)
 		var lastSlot string
 
 		// Check each time slot
-		for _, slot := range timeSlots {
-			slotStart := time.Date(startOfDay.Year(), startOfDay.Month(), startOfDay.Day(), slot.startHour, 0, 0, 0, startOfDay.Location())
-			slotEnd := time.Date(startOfDay.Year(), startOfDay.Month(), startOfDay.Day(), slot.endHour, 0, 0, 0, startOfDay.Location())
-
-			var count int64
-			err := db.Model(&models.Sale{}).
-				Where("province_uuid = ? AND created_at BETWEEN ? AND ?", province.UUID, slotStart, slotEnd).
-				Count(&count).Error
-			if err != nil {
-				return nil, err
+		for i, slot := range repository.TimeSlots {
+			if entry, ok := reported[province.UUID][i]; ok {
+				if entry.LastEntryAt.After(lastEntry) {
+					lastEntry = entry.LastEntryAt
+					lastSlot = slot.Name
+				}
+				continue
 			}
 
-			if count > 0 {
-				// Get the latest entry in this slot
-				var latestEntry models.Sale
-				db.Model(&models.Sale{}).
-					Where("province_uuid = ? AND created_at BETWEEN ? AND ?", province.UUID, slotStart, slotEnd).
-					Order("created_at DESC").
-					First(&latestEntry)
-
-				if latestEntry.CreatedAt.After(lastEntry) {
-					lastEntry = latestEntry.CreatedAt
-					lastSlot = slot.name
-				}
-			} else {
-				// Only mark as missing if the time has passed
-				if time.Now().After(slotEnd) {
-					status.MissingEntries = append(status.MissingEntries, slot.name)
-				}
+			// Only mark as missing if the time has passed
+			slotEnd := time.Date(startOfDay.Year(), startOfDay.Month(), startOfDay.Day(), slot.EndHour, 0, 0, 0, startOfDay.Location())
+			if now.After(slotEnd) {
+				status.MissingEntries = append(status.MissingEntries, slot.Name)
 			}
 		}
 
@@ -370,148 +346,98 @@ func getLastEntryStatus(startOfDay, endOfDay time.Time, provinceUUIDs []string)
 		result = append(result, status)
 	}
 
-	return result, nil
+	return result
 }
 
 // getCumulativeSalesChart returns cumulative sales data for today, yesterday, and 7-day average
-func getCumulativeSalesChart(selectedDate time.Time, provinceUUIDs []string) (CumulativeSalesData, error) {
-	db := database.DB
+func (ctl *Controller) getCumulativeSalesChart(work workdays.Calendar, firstDay time.Time, provinceUUIDs []string) (CumulativeSalesData, error) {
+	slotCount := len(repository.TimeSlots)
 
-	timeSlots := []string{"8am", "12pm", "3pm", "8pm"}
-	slotHours := map[string][]int{
-		"8am":  {6, 10},
-		"12pm": {10, 14},
-		"3pm":  {14, 18},
-		"8pm":  {18, 22},
+	rows, err := ctl.Dashboard.CumulativeSlots(firstDay, averageDays+1, provinceUUIDs)
+	if err != nil {
+		return CumulativeSalesData{}, err
 	}
 
-	startOfDay := time.Date(selectedDate.Year(), selectedDate.Month(), selectedDate.Day(), 0, 0, 0, 0, selectedDate.Location())
-
-	// Get today's cumulative sales
-	todaySales := make([]int64, 4)
-	var cumulative int64
-	for i, slot := range timeSlots {
-		hours := slotHours[slot]
-		slotEnd := time.Date(startOfDay.Year(), startOfDay.Month(), startOfDay.Day(), hours[1], 0, 0, 0, startOfDay.Location())
-
-		query := db.Model(&models.Sale{}).
-			Where("created_at BETWEEN ? AND ?", startOfDay, slotEnd)
-		if len(provinceUUIDs) > 0 {
-			query = query.Where("province_uuid IN ?", provinceUUIDs)
+	// cumulative[day][slot] is the running total at the end of the slot. Rows
+	// come ordered by slot, so each one also covers the later slots of its day
+	// until a row of a later slot replaces it.
+	cumulative := make([][]int64, averageDays+1)
+	for day := range cumulative {
+		cumulative[day] = make([]int64, slotCount)
+	}
+	for _, row := range rows {
+		if row.Day < 0 || row.Day > averageDays {
+			continue
+		}
+		for slot := max(row.Slot, 0); slot < slotCount; slot++ {
+			cumulative[row.Day][slot] = row.Cumulative
 		}
+	}
 
-		var total int64
-		query.Select("COALESCE(SUM(quantity), 0)").Row().Scan(&total)
-		cumulative = total
-		todaySales[i] = cumulative
-	}
-
-	// Get yesterday's cumulative sales
-	yesterday := selectedDate.AddDate(0, 0, -1)
-	startOfYesterday := time.Date(yesterday.Year(), yesterday.Month(), yesterday.Day(), 0, 0, 0, 0, yesterday.Location())
-	yesterdaySales := make([]int64, 4)
-	cumulative = 0
-	for i, slot := range timeSlots {
-		hours := slotHours[slot]
-		slotEnd := time.Date(startOfYesterday.Year(), startOfYesterday.Month(), startOfYesterday.Day(), hours[1], 0, 0, 0, startOfYesterday.Location())
-
-		query := db.Model(&models.Sale{}).
-			Where("created_at BETWEEN ? AND ?", startOfYesterday, slotEnd)
-		if len(provinceUUIDs) > 0 {
-			query = query.Where("province_uuid IN ?", provinceUUIDs)
+	// The average covers the working days, every day when none was worked
+	var days []int
+	for day := 0; day < averageDays; day++ {
+		if work.IsWorkingDay(firstDay.AddDate(0, 0, day)) {
+			days = append(days, day)
 		}
+	}
+	if len(days) == 0 {
+		for day := 0; day < averageDays; day++ {
+			days = append(days, day)
+		}
+	}
 
-		var total int64
-		query.Select("COALESCE(SUM(quantity), 0)").Row().Scan(&total)
-		cumulative = total
-		yesterdaySales[i] = cumulative
-	}
-
-	// Get 7-day average cumulative sales
-	averageSales := make([]int64, 4)
-	for i, slot := range timeSlots {
-		hours := slotHours[slot]
-		var total int64 = 0
-
-		// Sum across last 7 days
-		for d := 1; d <= 7; d++ {
-			pastDay := selectedDate.AddDate(0, 0, -d)
-			startOfPastDay := time.Date(pastDay.Year(), pastDay.Month(), pastDay.Day(), 0, 0, 0, 0, pastDay.Location())
-			slotEnd := time.Date(startOfPastDay.Year(), startOfPastDay.Month(), startOfPastDay.Day(), hours[1], 0, 0, 0, startOfPastDay.Location())
-
-			query := db.Model(&models.Sale{}).
-				Where("created_at BETWEEN ? AND ?", startOfPastDay, slotEnd)
-			if len(provinceUUIDs) > 0 {
-				query = query.Where("province_uuid IN ?", provinceUUIDs)
-			}
+	timeSlots := make([]string, slotCount)
+	averageSales := make([]int64, slotCount)
+	for i, slot := range repository.TimeSlots {
+		timeSlots[i] = slot.Name
 
-			var dayTotal int64
-			query.Select("COALESCE(SUM(quantity), 0)").Row().Scan(&dayTotal)
-			total += dayTotal
+		var total int64
+		for _, day := range days {
+			total += cumulative[day][i]
 		}
-
-		averageSales[i] = total / 7
+		averageSales[i] = total / int64(len(days))
 	}
 
 	return CumulativeSalesData{
 		TimeSlots:      timeSlots,
-		TodaySales:     todaySales,
-		YesterdaySales: yesterdaySales,
+		TodaySales:     cumulative[averageDays],
+		YesterdaySales: cumulative[averageDays-1],
 		AverageSales:   averageSales,
 	}, nil
 }
 
 // getDailyEntryTable returns the raw entry data for each province by time slot
-func getDailyEntryTable(startOfDay, endOfDay time.Time, provinceUUIDs []string) ([]DailyEntryRow, error) {
-	db := database.DB
+func getDailyEntryTable(provinces []repository.ProvinceRef, today []repository.SlotTotal) []DailyEntryRow {
 	var result []DailyEntryRow
 
-	// Get provinces
-	var provinces []models.Province
-	provinceQuery := db.Model(&models.Province{})
-	if len(provinceUUIDs) > 0 {
-		provinceQuery = provinceQuery.Where("uuid IN ?", provinceUUIDs)
-	}
-	if err := provinceQuery.Find(&provinces).Error; err != nil {
-		return nil, err
-	}
-
-	// Time slots
-	timeSlots := map[string][]int{
-		"8am":  {6, 10},
-		"12pm": {10, 14},
-		"3pm":  {14, 18},
-		"8pm":  {18, 22},
+	slotSales := make(map[string][]int64)
+	flagged := make(map[string][]string)
+	for _, row := range today {
+		if !inTimeSlot(row.Slot) {
+			continue
+		}
+		if slotSales[row.ProvinceUUID] == nil {
+			slotSales[row.ProvinceUUID] = make([]int64, len(repository.TimeSlots))
+		}
+		slotSales[row.ProvinceUUID][row.Slot] += row.Total
+		if row.Flagged > 0 {
+			flagged[row.ProvinceUUID] = append(flagged[row.ProvinceUUID], repository.TimeSlots[row.Slot].Name)
+		}
 	}
 
 	for _, province := range provinces {
 		row := DailyEntryRow{
 			ProvinceUUID: province.UUID,
 			ProvinceName: province.Name,
+			FlaggedSlots: flagged[province.UUID],
 		}
 
-		// Get sales for each time slot
-		for slotName, hours := range timeSlots {
-			slotStart := time.Date(startOfDay.Year(), startOfDay.Month(), startOfDay.Day(), hours[0], 0, 0, 0, startOfDay.Location())
-			slotEnd := time.Date(startOfDay.Year(), startOfDay.Month(), startOfDay.Day(), hours[1], 0, 0, 0, startOfDay.Location())
-
-			var sales int64
-			db.Model(&models.Sale{}).
-				Where("province_uuid = ? AND created_at BETWEEN ? AND ?", province.UUID, slotStart, slotEnd).
-				Select("COALESCE(SUM(quantity), 0)").
-				Row().
-				Scan(&sales)
-
-			switch slotName {
-			case "8am":
-				row.Entry8am = sales
-			case "12pm":
-				row.Entry12pm = sales
-			case "3pm":
-				row.Entry3pm = sales
-			case "8pm":
-				row.Entry8pm = sales
-			}
+		if sales := slotSales[province.UUID]; sales != nil {
+			row.Entry8am = sales[0]
+			row.Entry12pm = sales[1]
+			row.Entry3pm = sales[2]
+			row.Entry8pm = sales[3]
 		}
 
 		// Calculate daily total
@@ -520,106 +446,67 @@ func getDailyEntryTable(startOfDay, endOfDay time.Time, provinceUUIDs []string)
 		result = append(result, row)
 	}
 
-	return result, nil
+	return result
 }
 
-// getProvinceBarChart returns sales by province for bar chart visualization
-func getProvinceBarChart(startOfDay, endOfDay time.Time, provinceUUIDs []string) ([]ProvinceBarData, error) {
-	db := database.DB
-	var result []ProvinceBarData
-
-	// Get provinces
-	var provinces []models.Province
-	provinceQuery := db.Model(&models.Province{})
-	if len(provinceUUIDs) > 0 {
-		provinceQuery = provinceQuery.Where("uuid IN ?", provinceUUIDs)
+// provinceDayTotals sums the whole day of each province, inside and outside the slots
+func provinceDayTotals(today []repository.SlotTotal) map[string]int64 {
+	totals := make(map[string]int64)
+	for _, row := range today {
+		totals[row.ProvinceUUID] += row.Total
 	}
-	if err := provinceQuery.Find(&provinces).Error; err != nil {
-		return nil, err
+	return totals
+}
+
+// slotDayTotals sums each time slot over every province
+func slotDayTotals(today []repository.SlotTotal) []int64 {
+	totals := make([]int64, len(repository.TimeSlots))
+	for _, row := range today {
+		if inTimeSlot(row.Slot) {
+			totals[row.Slot] += row.Total
+		}
 	}
+	return totals
+}
 
-	// Get sales for each province
-	for _, province := range provinces {
-		var totalSales int64
-		db.Model(&models.Sale{}).
-			Where("province_uuid = ? AND created_at BETWEEN ? AND ?", province.UUID, startOfDay, endOfDay).
-			Select("COALESCE(SUM(quantity), 0)").
-			Row().
-			Scan(&totalSales)
+// getProvinceBarChart returns sales by province for bar chart visualization
+func getProvinceBarChart(provinces []repository.ProvinceRef, today []repository.SlotTotal) []ProvinceBarData {
+	var result []ProvinceBarData
 
+	totals := provinceDayTotals(today)
+	for _, province := range provinces {
 		result = append(result, ProvinceBarData{
 			ProvinceUUID: province.UUID,
 			ProvinceName: province.Name,
-			TotalSales:   totalSales,
+			TotalSales:   totals[province.UUID],
 		})
 	}
 
-	return result, nil
+	return result
 }
 
 // getTimeSlotBarChart returns sales by time slot for bar chart visualization
-func getTimeSlotBarChart(startOfDay, endOfDay time.Time, provinceUUIDs []string) ([]TimeSlotBarData, error) {
-	db := database.DB
+func getTimeSlotBarChart(today []repository.SlotTotal) []TimeSlotBarData {
 	var result []TimeSlotBarData
 
-	// Time slots
-	timeSlots := []struct {
-		name  string
-		hours []int
-	}{
-		{"8am", []int{6, 10}},
-		{"12pm", []int{10, 14}},
-		{"3pm", []int{14, 18}},
-		{"8pm", []int{18, 22}},
-	}
-
-	// Get sales for each time slot
-	for _, slot := range timeSlots {
-		slotStart := time.Date(startOfDay.Year(), startOfDay.Month(), startOfDay.Day(), slot.hours[0], 0, 0, 0, startOfDay.Location())
-		slotEnd := time.Date(startOfDay.Year(), startOfDay.Month(), startOfDay.Day(), slot.hours[1], 0, 0, 0, startOfDay.Location())
-
-		query := db.Model(&models.Sale{}).
-			Where("created_at BETWEEN ? AND ?", slotStart, slotEnd)
-
-		if len(provinceUUIDs) > 0 {
-			query = query.Where("province_uuid IN ?", provinceUUIDs)
-		}
-
-		var totalSales int64
-		query.Select("COALESCE(SUM(quantity), 0)").Row().Scan(&totalSales)
-
+	totals := slotDayTotals(today)
+	for i, slot := range repository.TimeSlots {
 		result = append(result, TimeSlotBarData{
-			TimeSlot:   slot.name,
-			TotalSales: totalSales,
+			TimeSlot:   slot.Name,
+			TotalSales: totals[i],
 		})
 	}
 
-	return result, nil
+	return result
 }
 
 // getProvincePieChart returns province contribution percentages for pie chart
-func getProvincePieChart(startOfDay, endOfDay time.Time, provinceUUIDs []string, totalSales int64) ([]ProvincePieData, error) {
-	db := database.DB
+func getProvincePieChart(provinces []repository.ProvinceRef, today []repository.SlotTotal, totalSales int64) []ProvincePieData {
 	var result []ProvincePieData
 
-	// Get provinces
-	var provinces []models.Province
-	provinceQuery := db.Model(&models.Province{})
-	if len(provinceUUIDs) > 0 {
-		provinceQuery = provinceQuery.Where("uuid IN ?", provinceUUIDs)
-	}
-	if err := provinceQuery.Find(&provinces).Error; err != nil {
-		return nil, err
-	}
-
-	// Get sales for each province with percentage
+	totals := provinceDayTotals(today)
 	for _, province := range provinces {
-		var provinceSales int64
-		db.Model(&models.Sale{}).
-			Where("province_uuid = ? AND created_at BETWEEN ? AND ?", province.UUID, startOfDay, endOfDay).
-			Select("COALESCE(SUM(quantity), 0)").
-			Row().
-			Scan(&provinceSales)
+		provinceSales := totals[province.UUID]
 
 		var percentage float64
 		if totalSales > 0 {
@@ -634,83 +521,34 @@ func getProvincePieChart(startOfDay, endOfDay time.Time, provinceUUIDs []string,
 		})
 	}
 
-	return result, nil
+	return result
 }
 
 // getTimeSlotPieChart returns time slot distribution percentages for pie chart
-func getTimeSlotPieChart(startOfDay, endOfDay time.Time, provinceUUIDs []string, totalSales int64) ([]TimeSlotPieData, error) {
-	db := database.DB
+func getTimeSlotPieChart(today []repository.SlotTotal, totalSales int64) []TimeSlotPieData {
 	var result []TimeSlotPieData
 
-	// Time slots
-	timeSlots := []struct {
-		name  string
-		hours []int
-	}{
-		{"8am", []int{6, 10}},
-		{"12pm", []int{10, 14}},
-		{"3pm", []int{14, 18}},
-		{"8pm", []int{18, 22}},
-	}
-
-	// Get sales for each time slot with percentage
-	for _, slot := range timeSlots {
-		slotStart := time.Date(startOfDay.Year(), startOfDay.Month(), startOfDay.Day(), slot.hours[0], 0, 0, 0, startOfDay.Location())
-		slotEnd := time.Date(startOfDay.Year(), startOfDay.Month(), startOfDay.Day(), slot.hours[1], 0, 0, 0, startOfDay.Location())
-
-		query := db.Model(&models.Sale{}).
-			Where("created_at BETWEEN ? AND ?", slotStart, slotEnd)
-
-		if len(provinceUUIDs) > 0 {
-			query = query.Where("province_uuid IN ?", provinceUUIDs)
-		}
-
-		var slotSales int64
-		query.Select("COALESCE(SUM(quantity), 0)").Row().Scan(&slotSales)
-
+	totals := slotDayTotals(today)
+	for i, slot := range repository.TimeSlots {
 		var percentage float64
 		if totalSales > 0 {
-			percentage = float64(slotSales) / float64(totalSales) * 100
+			percentage = float64(totals[i]) / float64(totalSales) * 100
 		}
 
 		result = append(result, TimeSlotPieData{
-			TimeSlot:   slot.name,
-			Sales:      slotSales,
+			TimeSlot:   slot.Name,
+			Sales:      totals[i],
 			Percentage: percentage,
 		})
 	}
 
-	return result, nil
+	return result
 }
 
 // getDailyTargetFromWeek calculates the daily target from weekly targets
 // Weekly target is divided by 7 to get daily target, then aggregated for all filtered provinces
-func getDailyTargetFromWeek(year int, weekNum int, provinceUUIDs []string) (int64, error) {
-	db := database.DB
-
-	// Get year record
-	yearStr := strconv.Itoa(year)
-	var yearRecord models.Year
-	err := db.Model(&models.Year{}).
-		Where("year = ?", yearStr).
-		First(&yearRecord).Error
-
-	if err != nil {
-		return 0, nil // No year record, no target
-	}
-
-	weekStr := strconv.Itoa(weekNum)
-
-	// Build query for week records
-	query := db.Model(&models.Week{}).
-		Where("week = ? AND year_uuid = ?", weekStr, yearRecord.UUID)
-
-	if len(provinceUUIDs) > 0 {
-		query = query.Where("province_uuid IN ?", provinceUUIDs)
-	}
-
-	var weekRecords []models.Week
-	err = query.Find(&weekRecords).Error
+func (ctl *Controller) getDailyTargetFromWeek(year int, weekNum int, provinceUUIDs []string) (int64, error) {
+	weekRecords, err := ctl.Targets.WeeklyTargets(year, weekNum, provinceUUIDs)
 	if err != nil {
 		return 0, nil
 	}
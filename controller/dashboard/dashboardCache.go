@@ -0,0 +1,140 @@
+package dashboard
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Danny19977/sr-api/app"
+	"github.com/Danny19977/sr-api/cache"
+	"github.com/Danny19977/sr-api/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// dashboardQuery identifies a dashboard payload in the cache
+type dashboardQuery struct {
+	endpoint string
+	// params are the normalized request parameters
+	params map[string]string
+	// provinces is the effective province scope, empty for every province
+	provinces []string
+	// from and to bound the sales and targets the payload reads
+	from time.Time
+	to   time.Time
+	// ttl shortens the configured lifetime when set
+	ttl time.Duration
+}
+
+func (q dashboardQuery) key() string {
+	names := make([]string, 0, len(q.params))
+	for name := range q.params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	provinces := append([]string(nil), q.provinces...)
+	sort.Strings(provinces)
+
+	var b strings.Builder
+	b.WriteString("dashboard:" + q.endpoint + "?")
+	for _, name := range names {
+		b.WriteString(name + "=" + q.params[name] + "&")
+	}
+	b.WriteString("provinces=" + strings.Join(provinces, ","))
+	return b.String()
+}
+
+// scopeProvinces narrows the requested filter to the provinces of the
+// territory_uuid query when set. An ASM caller is restricted to the territory,
+// or else the province, of their account; other roles keep the filter.
+func (ctl *Controller) scopeProvinces(c *fiber.Ctx, requested []string) []string {
+	if territoryUUID := c.Query("territory_uuid"); territoryUUID != "" {
+		requested = ctl.territoryProvinces(territoryUUID, requested)
+	}
+
+	userUUID, _ := utils.GetUserUUIDFromToken(c)
+	return app.NarrowProvinces(ctl.ScopeProvinces(userUUID), requested)
+}
+
+// respond serves the payload of q from the cache, computing and caching it
+// on a miss. Clients revalidate with If-None-Match or If-Modified-Since.
+func (ctl *Controller) respond(c *fiber.Ctx, q dashboardQuery, errorMessage string, compute func() (interface{}, error)) error {
+	key := q.key()
+
+	entry, err := ctl.Cache.Get(key)
+	if err != nil {
+		ctl.Logger.Printf("cache: reading %s: %v", key, err)
+	}
+
+	c.Set("X-Cache", "HIT")
+	if entry == nil {
+		c.Set("X-Cache", "MISS")
+
+		payload, err := compute()
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": errorMessage,
+				"error":   err.Error(),
+			})
+		}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": errorMessage,
+				"error":   err.Error(),
+			})
+		}
+
+		sum := sha256.Sum256(body)
+		entry = &cache.Entry{
+			Body:         body,
+			ETag:         `"` + hex.EncodeToString(sum[:16]) + `"`,
+			LastModified: time.Now().UTC().Truncate(time.Second),
+		}
+
+		ttl := ctl.Config.Cache.TTL
+		if q.ttl > 0 && q.ttl < ttl {
+			ttl = q.ttl
+		}
+		if err := ctl.Cache.Set(key, entry, cache.EntryTags(q.provinces, q.from, q.to), ttl); err != nil {
+			ctl.Logger.Printf("cache: storing %s: %v", key, err)
+		}
+	}
+
+	c.Set(fiber.HeaderETag, entry.ETag)
+	c.Set(fiber.HeaderLastModified, entry.LastModified.Format(http.TimeFormat))
+	c.Set(fiber.HeaderCacheControl, "private, no-cache")
+	c.Set(fiber.HeaderVary, fiber.HeaderAuthorization)
+
+	if notModified(c, entry) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Send(entry.Body)
+}
+
+// notModified evaluates the conditional headers of the request against entry,
+// If-None-Match taking precedence over If-Modified-Since
+func notModified(c *fiber.Ctx, entry *cache.Entry) bool {
+	if match := c.Get(fiber.HeaderIfNoneMatch); match != "" {
+		for _, tag := range strings.Split(match, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == entry.ETag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if since := c.Get(fiber.HeaderIfModifiedSince); since != "" {
+		if t, err := http.ParseTime(since); err == nil && !entry.LastModified.After(t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package dashboard
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Danny19977/sr-api/report"
+	"github.com/Danny19977/sr-api/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// exportWidget is a dashboard widget exported as a table
+type exportWidget struct {
+	columns []string
+	rows    func(payload interface{}) [][]interface{}
+}
+
+// exportWidgets lists the exportable widgets of each dashboard by name
+var exportWidgets = map[string]map[string]exportWidget{
+	"daily-monitor": {
+		"daily-entry-table": {
+			columns: []string{"province_uuid", "province_name", "entry_8am", "entry_12pm", "entry_3pm", "entry_8pm", "daily_total", "flagged_slots"},
+			rows: func(payload interface{}) [][]interface{} {
+				var rows [][]interface{}
+				for _, r := range payload.(DailyMonitorResponse).DailyEntryTable {
+					rows = append(rows, []interface{}{r.ProvinceUUID, r.ProvinceName, r.Entry8am, r.Entry12pm, r.Entry3pm, r.Entry8pm, r.DailyTotal, strings.Join(r.FlaggedSlots, " ")})
+				}
+				return rows
+			},
+		},
+	},
+	"global-overview": {
+		"province-performance": {
+			columns: []string{"province_uuid", "province_name", "total_sales", "target", "achievement"},
+			rows: func(payload interface{}) [][]interface{} {
+				var rows [][]interface{}
+				for _, p := range payload.(GlobalOverviewResponse).ProvincialSales {
+					rows = append(rows, []interface{}{p.UUID, p.Name, p.TotalSales, p.Target, p.Achievement})
+				}
+				return rows
+			},
+		},
+	},
+	"historical-trends": {
+		"yoy-heatmap": {
+			columns: []string{"province_uuid", "province_name", "period", "current_sales", "previous_sales", "growth_percent"},
+			rows: func(payload interface{}) [][]interface{} {
+				var rows [][]interface{}
+				for _, p := range payload.(HistoricalTrendsResponse).YoYGrowthHeatmap {
+					for _, g := range p.PeriodGrowth {
+						rows = append(rows, []interface{}{p.ProvinceUUID, p.ProvinceName, g.Period, g.CurrentSales, g.PreviousSales, g.GrowthPercent})
+					}
+				}
+				return rows
+			},
+		},
+	},
+	"leaderboard": {
+		"leaderboard": {
+			columns: []string{"rank", "user_uuid", "fullname", "province_name", "total", "target_share", "achievement", "slots_entered", "compliance_rate", "minutes_after_open"},
+			rows: func(payload interface{}) [][]interface{} {
+				var rows [][]interface{}
+				for _, r := range payload.(LeaderboardResponse).Rows {
+					rows = append(rows, []interface{}{r.Rank, r.UserUUID, r.Fullname, r.ProvinceName, r.Total, r.TargetShare, r.Achievement, r.SlotsEntered, r.ComplianceRate, r.MinutesAfterOpen})
+				}
+				return rows
+			},
+		},
+	},
+	"provincial-analysis": {
+		"targets-achievement": {
+			columns: []string{"province_uuid", "province_name", "target", "actual", "achievement"},
+			rows: func(payload interface{}) [][]interface{} {
+				var rows [][]interface{}
+				for _, t := range payload.(ProvincialAnalysisResponse).ProvinceTargets {
+					rows = append(rows, []interface{}{t.ProvinceUUID, t.ProvinceName, t.Target, t.Actual, t.Achievement})
+				}
+				return rows
+			},
+		},
+	},
+}
+
+// defaultWidgets is the widget exported when a request names none
+var defaultWidgets = map[string]string{
+	"daily-monitor":       "daily-entry-table",
+	"global-overview":     "province-performance",
+	"historical-trends":   "yoy-heatmap",
+	"leaderboard":         "leaderboard",
+	"provincial-analysis": "targets-achievement",
+}
+
+// export sends the widget named by the widget query parameter of the
+// dashboard of q as a file in format. The export is always computed afresh
+// and logged with its filters.
+func (ctl *Controller) export(c *fiber.Ctx, q dashboardQuery, format string, compute func() (interface{}, error)) error {
+	if !slices.Contains(report.ExportFormats, format) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid export format",
+			"error":   fmt.Sprintf("format must be one of %s", strings.Join(report.ExportFormats, ", ")),
+		})
+	}
+	name := c.Query("widget", defaultWidgets[q.endpoint])
+	widget, ok := exportWidgets[q.endpoint][name]
+	if !ok {
+		var names []string
+		for name := range exportWidgets[q.endpoint] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid export widget",
+			"error":   fmt.Sprintf("widget must be one of %s", strings.Join(names, ", ")),
+		})
+	}
+
+	payload, err := compute()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Error exporting " + name,
+			"error":   err.Error(),
+		})
+	}
+
+	filters := make(map[string]interface{}, len(q.params)+1)
+	for key, value := range q.params {
+		filters[key] = value
+	}
+	filters["provinces"] = q.provinces
+	utils.LogExportWithDB(ctl.DB, c, strings.ReplaceAll(name, "-", "_"), format, filters)
+
+	c.Set(fiber.HeaderContentType, report.ContentType(format))
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s-%s.%s"`, name, time.Now().Format("2006-01-02"), format))
+
+	table, err := report.NewTableWriter(c.Response().BodyWriter(), format, name, widget.columns)
+	if err != nil {
+		return err
+	}
+	for _, row := range widget.rows(payload) {
+		if err := table.WriteRow(row); err != nil {
+			return err
+		}
+	}
+	return table.Close()
+}
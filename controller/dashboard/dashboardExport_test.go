@@ -0,0 +1,30 @@
+package dashboard
+
+import "testing"
+
+func TestExportWidgetRowsMatchColumns(t *testing.T) {
+	payloads := map[string]interface{}{
+		"daily-monitor":       DailyMonitorResponse{DailyEntryTable: []DailyEntryRow{{ProvinceName: "North"}}},
+		"global-overview":     GlobalOverviewResponse{ProvincialSales: []ProvincePerformance{{Name: "North"}}},
+		"historical-trends":   HistoricalTrendsResponse{YoYGrowthHeatmap: []ProvinceYoYGrowth{{ProvinceName: "North", PeriodGrowth: []PeriodGrowthData{{Period: "Jan"}, {Period: "Feb"}}}}},
+		"leaderboard":         LeaderboardResponse{Rows: []PerformanceRow{{Rank: 1, Fullname: "Jane"}}},
+		"provincial-analysis": ProvincialAnalysisResponse{ProvinceTargets: []ProvinceTarget{{ProvinceName: "North"}}},
+	}
+
+	for endpoint, widgets := range exportWidgets {
+		if _, ok := widgets[defaultWidgets[endpoint]]; !ok {
+			t.Errorf("%s: default widget %q is not exportable", endpoint, defaultWidgets[endpoint])
+		}
+		for name, widget := range widgets {
+			rows := widget.rows(payloads[endpoint])
+			if len(rows) == 0 {
+				t.Errorf("%s/%s: no rows", endpoint, name)
+			}
+			for _, row := range rows {
+				if len(row) != len(widget.columns) {
+					t.Errorf("%s/%s: row of %d cells for %d columns", endpoint, name, len(row), len(widget.columns))
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package dashboard
+
+import (
+	"fmt"
+
+	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/report"
+	"github.com/Danny19977/sr-api/repository"
+	"github.com/Danny19977/sr-api/workdays"
+)
+
+// Report lays the data of a dashboard over dateRange out as a document, for
+// the scheduled report emails
+func (ctl *Controller) Report(dashboard string, dateRange DateRange, provinceUUIDs []string) (*report.Document, error) {
+	var doc *report.Document
+	switch dashboard {
+	case models.ReportGlobalOverview:
+		work, err := ctl.Dashboard.Workdays(provinceUUIDs)
+		if err != nil {
+			return nil, err
+		}
+		comparison, err := compareTo(work, workdays.PreviousPeriod, dateRange.StartDate, dateRange.EndDate)
+		if err != nil {
+			return nil, err
+		}
+		data, err := ctl.getOverviewData(work, comparison, dateRange, provinceUUIDs)
+		if err != nil {
+			return nil, err
+		}
+		doc = overviewDocument(data)
+	case models.ReportProvincialAnalysis:
+		data, err := ctl.getProvincialAnalysisData(dateRange, provinceUUIDs)
+		if err != nil {
+			return nil, err
+		}
+		doc = provincialAnalysisDocument(data)
+	case models.ReportAnomalies:
+		sales, err := ctl.Sales.Flagged(dateRange.StartDate, dateRange.EndDate, provinceUUIDs)
+		if err != nil {
+			return nil, err
+		}
+		doc = anomaliesDocument(sales)
+	default:
+		return nil, fmt.Errorf("unknown dashboard %q", dashboard)
+	}
+
+	doc.Subtitle = fmt.Sprintf("%s to %s", dateRange.StartDate.Format("2006-01-02 15:04"), dateRange.EndDate.Format("2006-01-02 15:04"))
+	return doc, nil
+}
+
+func overviewDocument(data GlobalOverviewResponse) *report.Document {
+	summary := report.Section{
+		Title:   "Summary",
+		Columns: []string{"Metric", "Value"},
+		Rows: [][]interface{}{
+			{"Total sales", data.TotalSales},
+			{"Change from the previous period (%)", data.PreviousPeriodChange},
+			{"Average sales per working day", data.AverageDailySales},
+		},
+	}
+	if data.BestProvince.UUID != "" {
+		summary.Rows = append(summary.Rows,
+			[]interface{}{"Best province", fmt.Sprintf("%s (%.1f%% of target)", data.BestProvince.Name, data.BestProvince.Achievement)},
+			[]interface{}{"Worst province", fmt.Sprintf("%s (%.1f%% of target)", data.WorstProvince.Name, data.WorstProvince.Achievement)},
+		)
+	}
+
+	provinces := report.Section{Title: "Provincial sales", Columns: []string{"Province", "Sales", "Target", "Achievement (%)"}}
+	for _, p := range data.ProvincialSales {
+		provinces.Rows = append(provinces.Rows, []interface{}{p.Name, p.TotalSales, p.Target, p.Achievement})
+	}
+
+	trend := report.Section{Title: "Sales trend", Columns: []string{"Period (" + data.SalesTrend.Interval + ")", "Sales"}}
+	for i, label := range data.SalesTrend.Labels {
+		trend.Rows = append(trend.Rows, []interface{}{label, data.SalesTrend.Values[i]})
+	}
+
+	heatmap := report.Section{Title: "Sales against targets", Columns: []string{"Province", "Period", "Sales", "Deviation from target (%)"}}
+	for _, p := range data.SalesHeatmap {
+		for _, period := range p.PeriodData {
+			heatmap.Rows = append(heatmap.Rows, []interface{}{p.ProvinceName, period.Period, period.Sales, period.Deviation})
+		}
+	}
+
+	return &report.Document{
+		Title:    "Global overview",
+		Sections: []report.Section{summary, provinces, trend, heatmap},
+	}
+}
+
+func provincialAnalysisDocument(data ProvincialAnalysisResponse) *report.Document {
+	targets := report.Section{Title: "Targets", Columns: []string{"Province", "Target", "Actual", "Achievement (%)"}}
+	for _, t := range data.ProvinceTargets {
+		targets.Rows = append(targets.Rows, []interface{}{t.ProvinceName, t.Target, t.Actual, t.Achievement})
+	}
+
+	comparison := report.Section{Title: "Provincial comparison", Columns: []string{"Province", "Period (" + data.TimeGranularity + ")", "Sales"}}
+	for _, series := range data.ProvincialComparison {
+		for _, point := range series.DataPoints {
+			comparison.Rows = append(comparison.Rows, []interface{}{series.ProvinceName, point.Label, point.Value})
+		}
+	}
+
+	contribution := report.Section{Title: "Contribution", Columns: []string{"Period", "Province", "Sales", "Share (%)"}}
+	for _, point := range data.ContributionData {
+		for _, p := range point.Provinces {
+			contribution.Rows = append(contribution.Rows, []interface{}{point.Label, p.ProvinceName, p.Sales, p.Percentage})
+		}
+	}
+
+	intraDay := report.Section{Title: "Average sale by time slot", Columns: []string{"Province"}}
+	for _, slot := range repository.TimeSlots {
+		intraDay.Columns = append(intraDay.Columns, slot.Name)
+	}
+	for _, p := range data.IntraDayPattern {
+		row := []interface{}{p.ProvinceName}
+		for _, slot := range repository.TimeSlots {
+			row = append(row, p.TimeSlots[slot.Name])
+		}
+		intraDay.Rows = append(intraDay.Rows, row)
+	}
+
+	return &report.Document{
+		Title:    "Provincial analysis",
+		Sections: []report.Section{targets, comparison, contribution, intraDay},
+	}
+}
+
+func anomaliesDocument(sales []models.Sale) *report.Document {
+	flagged := report.Section{
+		Title:   "Flagged entries",
+		Columns: []string{"Time", "Province", "Product", "Time slot", "Quantity", "Anomaly score", "Entered by"},
+	}
+	for _, s := range sales {
+		var province, product, user string
+		if s.Province != nil {
+			province = s.Province.Name
+		}
+		if s.Product != nil {
+			product = s.Product.Name
+		}
+		if s.User != nil {
+			user = s.User.Fullname
+		}
+		slot := "Outside the slots"
+		if i := repository.SlotOf(s.CreatedAt.Local()); i >= 0 && i < len(repository.TimeSlots) {
+			slot = repository.TimeSlots[i].Name
+		}
+		flagged.Rows = append(flagged.Rows, []interface{}{
+			s.CreatedAt.Local().Format("2006-01-02 15:04"), province, product, slot, s.Quantity, s.AnomalyScore, user,
+		})
+	}
+	return &report.Document{
+		Title:    "Anomalies",
+		Sections: []report.Section{flagged},
+	}
+}
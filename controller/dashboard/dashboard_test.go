@@ -0,0 +1,559 @@
+package dashboard_test
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Danny19977/sr-api/app"
+	"github.com/Danny19977/sr-api/apptest"
+	"github.com/Danny19977/sr-api/cache"
+	"github.com/Danny19977/sr-api/fiscal"
+	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/repository"
+	"github.com/google/uuid"
+)
+
+// seedProvinces creates n provinces with a sale in every time slot of the
+// last eight days, plus month and week targets for the current year
+func seedProvinces(tb testing.TB, env *apptest.Env, n int, now time.Time) {
+	tb.Helper()
+	db := env.App.DB
+
+	country := models.Country{UUID: uuid.New().String(), Name: "Country " + uuid.New().String()[:8]}
+	if err := db.Create(&country).Error; err != nil {
+		tb.Fatal(err)
+	}
+
+	year := models.Year{}
+	err := db.Where(models.Year{Year: strconv.Itoa(now.Year())}).
+		Attrs(models.Year{UUID: uuid.New().String(), Quantity: "1000000"}).
+		FirstOrCreate(&year).Error
+	if err != nil {
+		tb.Fatal(err)
+	}
+	_, week := now.ISOWeek()
+
+	var provinces []models.Province
+	var sales []models.Sale
+	var months []models.Month
+	var weeks []models.Week
+	for i := 0; i < n; i++ {
+		province := models.Province{
+			UUID:        uuid.New().String(),
+			Name:        fmt.Sprintf("Province %d %s", i, uuid.New().String()[:8]),
+			CountryUUID: country.UUID,
+		}
+		provinces = append(provinces, province)
+
+		for day := 0; day < 8; day++ {
+			date := now.AddDate(0, 0, -day)
+			for _, slot := range repository.TimeSlots {
+				sales = append(sales, models.Sale{
+					UUID:         uuid.New().String(),
+					CreatedAt:    time.Date(date.Year(), date.Month(), date.Day(), slot.StartHour+1, 0, 0, 0, date.Location()),
+					ProvinceUUID: province.UUID,
+					ProductUUID:  uuid.New().String(),
+					UserUUID:     uuid.New().String(),
+					Quantity:     int64(10 + i),
+				})
+			}
+		}
+
+		for _, name := range repository.MonthNames {
+			months = append(months, models.Month{
+				UUID:         uuid.New().String(),
+				Month:        name,
+				Quantity:     "3000",
+				Role:         "ASM",
+				ProvinceUUID: province.UUID,
+				YearUUID:     year.UUID,
+			})
+		}
+		weeks = append(weeks, models.Week{
+			UUID:         uuid.New().String(),
+			Week:         strconv.Itoa(week),
+			Quantity:     "700",
+			Role:         "ASM",
+			ProvinceUUID: province.UUID,
+			YearUUID:     year.UUID,
+		})
+	}
+
+	for _, batch := range []interface{}{&provinces, &months, &weeks} {
+		if err := db.CreateInBatches(batch, 500).Error; err != nil {
+			tb.Fatal(err)
+		}
+	}
+	if err := env.App.Sales.CreateBatch(sales, 500); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// dashboardPaths lists one request per dashboard covering the seeded data
+func dashboardPaths(now time.Time) map[string]string {
+	start := now.AddDate(0, 0, -30).Format("2006-01-02")
+	end := now.AddDate(0, 0, 1).Format("2006-01-02")
+	years := fmt.Sprintf("%d,%d", now.Year(), now.Year()-1)
+
+	return map[string]string{
+		"daily-monitor":       "/api/dashboard/daily-monitor?date=" + now.Format("2006-01-02"),
+		"global-overview":     "/api/dashboard/global-overview?start_date=" + start + "&end_date=" + end,
+		"provincial-analysis": "/api/dashboard/provincial-analysis?start_date=" + start + "&end_date=" + end,
+		"historical-trends":   "/api/dashboard/historical-trends?years=" + years,
+		"forecast":            "/api/dashboard/forecast?period=month&group_by=product",
+	}
+}
+
+// countDashboardQueries returns the number of statements each dashboard sends
+func countDashboardQueries(t *testing.T, env *apptest.Env, token string, now time.Time) map[string]int64 {
+	t.Helper()
+
+	counts := make(map[string]int64)
+	for name, path := range dashboardPaths(now) {
+		counts[name] = env.CountQueries(func() {
+			resp := env.Do(http.MethodGet, path, token, nil)
+			if resp.Status != http.StatusOK {
+				t.Fatalf("%s: got status %d: %s", name, resp.Status, resp.Body)
+			}
+		})
+	}
+	return counts
+}
+
+func TestDashboardQueriesDoNotGrowWithProvinces(t *testing.T) {
+	env := apptest.New(t)
+	token := env.Token(env.CreateUser("Admin", nil))
+	now := time.Now()
+
+	seedProvinces(t, env, 3, now)
+	few := countDashboardQueries(t, env, token, now)
+
+	seedProvinces(t, env, 30, now)
+	many := countDashboardQueries(t, env, token, now)
+
+	for name, count := range few {
+		if many[name] != count {
+			t.Errorf("%s: %d queries with 3 provinces, %d with 33", name, count, many[name])
+		}
+	}
+}
+
+func TestDailyMonitorTotals(t *testing.T) {
+	env := apptest.New(t)
+	token := env.Token(env.CreateUser("Admin", nil))
+	now := time.Now()
+
+	seedProvinces(t, env, 2, now)
+
+	var monitor struct {
+		TotalSalesToday  int64 `json:"total_sales_today"`
+		TimeSlotBarChart []struct {
+			TimeSlot   string `json:"time_slot"`
+			TotalSales int64  `json:"total_sales"`
+		} `json:"time_slot_bar_chart"`
+		CumulativeSalesChart struct {
+			TodaySales   []int64 `json:"today_sales"`
+			AverageSales []int64 `json:"average_sales"`
+		} `json:"cumulative_sales_chart"`
+	}
+	resp := env.Do(http.MethodGet, dashboardPaths(now)["daily-monitor"], token, nil)
+	if err := resp.JSON(&monitor); err != nil {
+		t.Fatalf("decoding %s: %v", resp.Body, err)
+	}
+
+	// Provinces sell 10 and 11 in each of the 4 slots
+	if monitor.TotalSalesToday != 84 {
+		t.Errorf("total sales today = %d, want 84", monitor.TotalSalesToday)
+	}
+	for _, slot := range monitor.TimeSlotBarChart {
+		if slot.TotalSales != 21 {
+			t.Errorf("slot %s = %d, want 21", slot.TimeSlot, slot.TotalSales)
+		}
+	}
+	want := []int64{21, 42, 63, 84}
+	for i, value := range want {
+		if monitor.CumulativeSalesChart.TodaySales[i] != value {
+			t.Errorf("cumulative today = %v, want %v", monitor.CumulativeSalesChart.TodaySales, want)
+			break
+		}
+		if monitor.CumulativeSalesChart.AverageSales[i] != value {
+			t.Errorf("cumulative average = %v, want %v", monitor.CumulativeSalesChart.AverageSales, want)
+			break
+		}
+	}
+}
+
+func TestDashboardCacheRevalidation(t *testing.T) {
+	env := apptest.New(t)
+	token := env.Token(env.CreateUser("Admin", nil))
+	now := time.Now()
+
+	seedProvinces(t, env, 2, now)
+	path := dashboardPaths(now)["global-overview"]
+
+	first := env.Do(http.MethodGet, path, token, nil)
+	etag := first.Header.Get("ETag")
+	if first.Status != http.StatusOK || etag == "" || first.Header.Get("X-Cache") != "MISS" {
+		t.Fatalf("first request: status %d, ETag %q, X-Cache %q", first.Status, etag, first.Header.Get("X-Cache"))
+	}
+
+	conditional := func() *apptest.Response {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("If-None-Match", etag)
+		return env.Send(req)
+	}
+
+	if resp := conditional(); resp.Status != http.StatusNotModified || resp.Header.Get("X-Cache") != "HIT" {
+		t.Errorf("unchanged data: status %d, X-Cache %q, want 304 from the cache", resp.Status, resp.Header.Get("X-Cache"))
+	}
+
+	// A new sale of a dashboard province drops the cached payload
+	var province models.Province
+	env.App.DB.First(&province)
+	sale := &models.Sale{
+		UUID:         uuid.New().String(),
+		ProvinceUUID: province.UUID,
+		ProductUUID:  uuid.New().String(),
+		UserUUID:     uuid.New().String(),
+		Quantity:     5,
+	}
+	if err := env.App.Sales.Create(sale); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := conditional()
+	if resp.Status != http.StatusOK || resp.Header.Get("X-Cache") != "MISS" || resp.Header.Get("ETag") == etag {
+		t.Errorf("after a sale: status %d, X-Cache %q, ETag %q, want a fresh payload", resp.Status, resp.Header.Get("X-Cache"), resp.Header.Get("ETag"))
+	}
+}
+
+// readEvent returns the name and data of the next server-sent event
+func readEvent(t *testing.T, r *bufio.Reader) (string, string) {
+	t.Helper()
+
+	var name, data string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading stream: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "" && name != "":
+			return name, data
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestDailyMonitorStreamPushesNewEntries(t *testing.T) {
+	env := apptest.New(t)
+	token := env.Token(env.CreateUser("Admin", nil))
+	now := time.Now()
+	seedProvinces(t, env, 1, now)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	go env.Server.Listener(listener)
+	defer env.Server.ShutdownWithTimeout(time.Second)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://"+listener.Addr().String()+"/api/dashboard/daily-monitor/stream", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	stream := bufio.NewReader(resp.Body)
+
+	if name, _ := readEvent(t, stream); name != "snapshot" {
+		t.Fatalf("first event = %s, want snapshot", name)
+	}
+
+	var province models.Province
+	env.App.DB.First(&province)
+	sale := &models.Sale{
+		UUID:         uuid.New().String(),
+		ProvinceUUID: province.UUID,
+		ProductUUID:  uuid.New().String(),
+		UserUUID:     uuid.New().String(),
+		Quantity:     3,
+	}
+	if err := env.App.Sales.Create(sale); err != nil {
+		t.Fatal(err)
+	}
+
+	name, data := readEvent(t, stream)
+	if name != "entry" || !strings.Contains(data, sale.UUID) {
+		t.Errorf("got %s %s, want the entry of %s", name, data, sale.UUID)
+	}
+	if name, _ := readEvent(t, stream); name != "totals" {
+		t.Errorf("got %s, want totals", name)
+	}
+}
+
+func TestForecastProjectsTheMonth(t *testing.T) {
+	env := apptest.New(t)
+	token := env.Token(env.CreateUser("Admin", nil))
+	now := time.Now()
+	seedProvinces(t, env, 2, now)
+
+	var forecast struct {
+		Total struct {
+			Actual               int64   `json:"actual"`
+			Projected            float64 `json:"projected"`
+			Lower                float64 `json:"lower"`
+			Upper                float64 `json:"upper"`
+			Target               int64   `json:"target"`
+			ProjectedAchievement float64 `json:"projected_achievement"`
+		} `json:"total"`
+		Rows []struct {
+			UUID   string `json:"uuid"`
+			Target int64  `json:"target"`
+		} `json:"rows"`
+	}
+	for _, method := range []string{"run_rate", "last_year", "seasonal"} {
+		resp := env.Do(http.MethodGet, "/api/dashboard/forecast?period=month&method="+method, token, nil)
+		if err := resp.JSON(&forecast); err != nil {
+			t.Fatalf("decoding %s: %v", resp.Body, err)
+		}
+		total := forecast.Total
+		if total.Projected < float64(total.Actual) || total.Lower > total.Projected || total.Upper < total.Projected {
+			t.Errorf("%s: got actual %d, projected %v in [%v, %v]", method, total.Actual, total.Projected, total.Lower, total.Upper)
+		}
+		if len(forecast.Rows) != 2 || total.Target != 6000 || total.ProjectedAchievement <= 0 {
+			t.Errorf("%s: got %d rows, target %d, projected achievement %v", method, len(forecast.Rows), total.Target, total.ProjectedAchievement)
+		}
+	}
+
+	if resp := env.Do(http.MethodGet, "/api/dashboard/forecast?period=decade", token, nil); resp.Status != http.StatusBadRequest {
+		t.Errorf("got status %d for an unknown period, want 400", resp.Status)
+	}
+}
+
+func TestFiscalCalendarMovesThePeriods(t *testing.T) {
+	env := apptest.New(t)
+	token := env.Token(env.CreateUser("Admin", nil))
+	now := time.Now()
+	seedProvinces(t, env, 1, now)
+
+	var province models.Province
+	if err := env.App.DB.Order("created_at DESC").First(&province).Error; err != nil {
+		t.Fatal(err)
+	}
+	path := "/api/countries/calendar/" + province.CountryUUID
+	if resp := env.Do(http.MethodPut, path, token, map[string]interface{}{"fiscal_year_start": 13}); resp.Status != http.StatusBadRequest {
+		t.Errorf("got status %d for month 13, want 400", resp.Status)
+	}
+	resp := env.Do(http.MethodPut, path, token, map[string]interface{}{"fiscal_year_start": 7, "fiscal_pattern": "4-4-5", "fiscal_week_start": 7})
+	if resp.Status != http.StatusOK {
+		t.Fatalf("got status %d: %s", resp.Status, resp.Body)
+	}
+
+	cal := fiscal.Calendar{StartMonth: time.July, Pattern: "4-4-5", WeekStart: time.Sunday}
+	var trends struct {
+		SelectedYears         []int `json:"selected_years"`
+		CumulativeYearlySales []struct {
+			DataPoints []struct {
+				Period string `json:"period"`
+			} `json:"data_points"`
+		} `json:"cumulative_yearly_sales"`
+	}
+	resp = env.Do(http.MethodGet, "/api/dashboard/historical-trends?province_uuid="+province.UUID, token, nil)
+	if err := resp.JSON(&trends); err != nil {
+		t.Fatalf("decoding %s: %v", resp.Body, err)
+	}
+	if years := trends.SelectedYears; len(years) == 0 || years[0] != cal.YearOf(now) {
+		t.Errorf("got years %v, want fiscal year %d first", years, cal.YearOf(now))
+	}
+	if series := trends.CumulativeYearlySales; len(series) == 0 || series[0].DataPoints[0].Period != "Jul" {
+		t.Errorf("got %+v, want the series to start in July", series)
+	}
+}
+
+func TestComparisonSkipsHolidays(t *testing.T) {
+	env := apptest.New(t)
+	token := env.Token(env.CreateUser("Admin", nil))
+	now := time.Now()
+	seedProvinces(t, env, 1, now)
+
+	var province models.Province
+	if err := env.App.DB.Order("created_at DESC").First(&province).Error; err != nil {
+		t.Fatal(err)
+	}
+	// Every day is worked but yesterday, a holiday
+	yesterday := now.AddDate(0, 0, -1)
+	if resp := env.Do(http.MethodPut, "/api/countries/calendar/"+province.CountryUUID, token, map[string]interface{}{"working_days": "1,2,3,4,5,6,7"}); resp.Status != http.StatusOK {
+		t.Fatalf("got status %d: %s", resp.Status, resp.Body)
+	}
+	resp := env.Do(http.MethodPost, "/api/countries/holidays/"+province.CountryUUID, token, map[string]interface{}{"date": yesterday.Format("2006-01-02"), "name": "Holiday"})
+	if resp.Status != http.StatusOK {
+		t.Fatalf("got status %d: %s", resp.Status, resp.Body)
+	}
+
+	if resp := env.Do(http.MethodGet, "/api/dashboard/daily-monitor?compare=yesterday", token, nil); resp.Status != http.StatusBadRequest {
+		t.Errorf("got status %d for an unknown comparison, want 400", resp.Status)
+	}
+	var monitor struct {
+		Comparison struct {
+			Mode string    `json:"mode"`
+			From time.Time `json:"from"`
+		} `json:"comparison"`
+	}
+	resp = env.Do(http.MethodGet, "/api/dashboard/daily-monitor?province_uuid="+province.UUID, token, nil)
+	if err := resp.JSON(&monitor); err != nil {
+		t.Fatalf("decoding %s: %v", resp.Body, err)
+	}
+	want := now.AddDate(0, 0, -2).Format("2006-01-02")
+	if got := monitor.Comparison.From.Format("2006-01-02"); monitor.Comparison.Mode != "previous_period" || got != want {
+		t.Errorf("got %s compared against %s, want previous_period against %s", monitor.Comparison.Mode, got, want)
+	}
+}
+
+func TestLeaderboardAndScorecard(t *testing.T) {
+	env := apptest.New(t)
+	db := env.App.DB
+	now := time.Now()
+
+	country := models.Country{UUID: uuid.New().String(), Name: "Country " + uuid.New().String()[:8]}
+	province := models.Province{UUID: uuid.New().String(), Name: "Province " + uuid.New().String()[:8], CountryUUID: country.UUID}
+	for _, row := range []interface{}{&country, &province} {
+		if err := db.Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	best := env.CreateUser("ASM", &province.UUID)
+	second := env.CreateUser("ASM", &province.UUID)
+
+	// The best seller enters 20 minutes after the 8am slot opens, the other
+	// one an hour after
+	open := time.Date(now.Year(), now.Month(), now.Day(), repository.TimeSlots[0].StartHour, 0, 0, 0, now.Location())
+	sales := []models.Sale{
+		{UUID: uuid.New().String(), CreatedAt: open.Add(20 * time.Minute), ProvinceUUID: province.UUID, ProductUUID: uuid.New().String(), UserUUID: best.UUID, Quantity: 50},
+		{UUID: uuid.New().String(), CreatedAt: open.Add(time.Hour), ProvinceUUID: province.UUID, ProductUUID: uuid.New().String(), UserUUID: second.UUID, Quantity: 10},
+	}
+	if err := env.App.Sales.CreateBatch(sales, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	var leaderboard struct {
+		Rows []struct {
+			Rank             int     `json:"rank"`
+			UserUUID         string  `json:"user_uuid"`
+			Total            int64   `json:"total"`
+			MinutesAfterOpen float64 `json:"minutes_after_open"`
+		} `json:"rows"`
+	}
+	date := now.Format("2006-01-02")
+	resp := env.Do(http.MethodGet, "/api/dashboard/leaderboard?period=week&metric=timeliness&date="+date+"&country_uuid="+country.UUID, env.Token(env.CreateUser("Admin", nil)), nil)
+	if err := resp.JSON(&leaderboard); err != nil || resp.Status != http.StatusOK {
+		t.Fatalf("got status %d: %s", resp.Status, resp.Body)
+	}
+	rows := leaderboard.Rows
+	if len(rows) != 2 || rows[0].UserUUID != best.UUID || rows[0].MinutesAfterOpen != 20 || rows[1].MinutesAfterOpen != 60 {
+		t.Errorf("got %+v, want the best seller first, 20 minutes after the opening", rows)
+	}
+
+	var scorecard struct {
+		Performance struct {
+			Rank  int   `json:"rank"`
+			Total int64 `json:"total"`
+		} `json:"performance"`
+		Participants int `json:"participants"`
+	}
+	resp = env.Do(http.MethodGet, "/api/dashboard/scorecard?period=week&date="+date, env.Token(second), nil)
+	if err := resp.JSON(&scorecard); err != nil || resp.Status != http.StatusOK {
+		t.Fatalf("got status %d: %s", resp.Status, resp.Body)
+	}
+	if scorecard.Performance.Rank != 2 || scorecard.Performance.Total != 10 || scorecard.Participants != 2 {
+		t.Errorf("got %+v, want rank 2 of 2 with 10 sold", scorecard)
+	}
+}
+
+func BenchmarkDashboards(b *testing.B) {
+	now := time.Now()
+
+	for _, provinces := range []int{5, 30, 100} {
+		b.Run(fmt.Sprintf("provinces=%d", provinces), func(b *testing.B) {
+			// Measure the computation, not the cache
+			env := apptest.New(b, app.WithCache(cache.Nop()))
+			token := env.Token(env.CreateUser("Admin", nil))
+			seedProvinces(b, env, provinces, now)
+
+			for name, path := range dashboardPaths(now) {
+				b.Run(name, func(b *testing.B) {
+					var queries int64
+					for i := 0; i < b.N; i++ {
+						queries += env.CountQueries(func() {
+							if resp := env.Do(http.MethodGet, path, token, nil); resp.Status != http.StatusOK {
+								b.Fatalf("got status %d: %s", resp.Status, resp.Body)
+							}
+						})
+					}
+					b.ReportMetric(float64(queries)/float64(b.N), "queries/op")
+				})
+			}
+		})
+	}
+}
+
+func TestExportsRespectProvinceScope(t *testing.T) {
+	env := apptest.New(t)
+	now := time.Now()
+	seedProvinces(t, env, 2, now)
+
+	var province models.Province
+	env.App.DB.Order("name").First(&province)
+	asm := env.CreateUser("ASM", &province.UUID)
+	token := env.Token(asm)
+
+	// Every sale of the province, beyond the page size
+	resp := env.Do(http.MethodGet, "/api/sales/all/paginate?limit=5&format=csv", token, nil)
+	if resp.Status != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/csv") {
+		t.Fatalf("sales export: status %d, content type %q", resp.Status, resp.Header.Get("Content-Type"))
+	}
+	lines := strings.Split(strings.TrimSpace(string(resp.Body)), "\n")
+	if len(lines) != 1+8*len(repository.TimeSlots) {
+		t.Errorf("sales export has %d lines, want a header and %d sales", len(lines), 8*len(repository.TimeSlots))
+	}
+	for _, line := range lines[1:] {
+		if !strings.Contains(line, province.UUID) {
+			t.Fatalf("sales export leaks another province: %s", line)
+		}
+	}
+
+	resp = env.Do(http.MethodGet, dashboardPaths(now)["daily-monitor"]+"&format=jsonl", token, nil)
+	if resp.Status != http.StatusOK {
+		t.Fatalf("daily entry table export: status %d: %s", resp.Status, resp.Body)
+	}
+	rows := strings.Split(strings.TrimSpace(string(resp.Body)), "\n")
+	if len(rows) != 1 || !strings.Contains(rows[0], `"province_uuid":"`+province.UUID+`"`) || !strings.Contains(rows[0], `"daily_total":`) {
+		t.Errorf("daily entry table export = %q, want the row of the ASM province", resp.Body)
+	}
+
+	if resp := env.Do(http.MethodGet, dashboardPaths(now)["global-overview"]+"&format=pdf", token, nil); resp.Status != http.StatusBadRequest {
+		t.Errorf("exporting as pdf: got %d, want 400", resp.Status)
+	}
+	if resp := env.Do(http.MethodGet, dashboardPaths(now)["global-overview"]+"&format=csv&widget=nope", token, nil); resp.Status != http.StatusBadRequest {
+		t.Errorf("exporting an unknown widget: got %d, want 400", resp.Status)
+	}
+
+	var logged int64
+	env.App.DB.Model(&models.UserLogs{}).Where("user_uuid = ? AND action = ?", asm.UUID, "EXPORT").Count(&logged)
+	if logged != 2 {
+		t.Errorf("%d exports logged, want 2", logged)
+	}
+}
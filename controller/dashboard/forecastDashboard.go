@@ -0,0 +1,238 @@
+package dashboard
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Danny19977/sr-api/fiscal"
+	"github.com/Danny19977/sr-api/forecast"
+	"github.com/Danny19977/sr-api/metrics"
+	"github.com/gofiber/fiber/v2"
+)
+
+type ForecastResponse struct {
+	Period      string        `json:"period"` // "week", "month" or "year"
+	PeriodStart time.Time     `json:"period_start"`
+	PeriodEnd   time.Time     `json:"period_end"` // Start of the next period
+	AsOf        time.Time     `json:"as_of"`
+	GroupBy     string        `json:"group_by"` // "province" or "product"
+	Method      string        `json:"method"`
+	Confidence  float64       `json:"confidence"` // Probability of the final total falling between lower and upper
+	Total       ForecastRow   `json:"total"`
+	Rows        []ForecastRow `json:"rows"`
+}
+
+type ForecastRow struct {
+	forecast.Row
+	Target               int64   `json:"target"`                // Provinces only
+	ProjectedAchievement float64 `json:"projected_achievement"` // Percentage of the target expected at the end of the period
+}
+
+// GetForecast projects the sales of the week, month or year holding date to
+// its end, by province or by product
+func (ctl *Controller) GetForecast(c *fiber.Ctx) error {
+	period := c.Query("period", forecast.Month)
+	now := time.Now()
+	asOf := now
+	if value := c.Query("date"); value != "" {
+		date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Invalid date format. Use YYYY-MM-DD",
+				"error":   err.Error(),
+			})
+		}
+		// A past day is projected from its end
+		if end := date.AddDate(0, 0, 1); end.Before(now) {
+			asOf = end
+		}
+	}
+	confidence, err := strconv.ParseFloat(c.Query("confidence", "0.8"), 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid confidence",
+			"error":   err.Error(),
+		})
+	}
+
+	provinceUUIDs := ctl.scopeProvinces(c, parseProvinces(c))
+	cal, err := ctl.Dashboard.Calendar(provinceUUIDs)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Error forecasting sales",
+			"error":   err.Error(),
+		})
+	}
+	bounds, err := forecast.PeriodBounds(cal, period, asOf.Add(-time.Nanosecond))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid period",
+			"error":   err.Error(),
+		})
+	}
+	req := forecast.Request{
+		From:          bounds.From,
+		To:            bounds.To,
+		AsOf:          asOf,
+		By:            c.Query("group_by", "province"),
+		Method:        c.Query("method", forecast.Seasonal),
+		Confidence:    confidence,
+		ProvinceUUIDs: provinceUUIDs,
+	}
+	if err := req.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid forecast",
+			"error":   err.Error(),
+		})
+	}
+
+	query := dashboardQuery{
+		endpoint: "forecast",
+		params: map[string]string{
+			"period":     period,
+			"as_of":      asOf.Format("2006-01-02"),
+			"group_by":   req.By,
+			"method":     req.Method,
+			"confidence": strconv.FormatFloat(confidence, 'f', -1, 64),
+		},
+		provinces: req.ProvinceUUIDs,
+		// Last year's period and the history before the period are read too
+		from: bounds.From.AddDate(-1, 0, -8*7),
+		to:   bounds.To,
+	}
+	// The projection of the current period moves with the clock
+	if asOf.Equal(now) {
+		query.ttl = time.Minute
+	}
+	return ctl.respond(c, query, "Error forecasting sales", func() (interface{}, error) {
+		return ctl.getForecastData(cal, period, bounds, req)
+	})
+}
+
+// parseProvinces reads the comma separated provinces filter, or the single
+// province_uuid
+func parseProvinces(c *fiber.Ctx) []string {
+	var provinceUUIDs []string
+	for _, p := range strings.Split(c.Query("provinces"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			provinceUUIDs = append(provinceUUIDs, p)
+		}
+	}
+	if single := strings.TrimSpace(c.Query("province_uuid")); len(provinceUUIDs) == 0 && single != "" {
+		provinceUUIDs = []string{single}
+	}
+	return provinceUUIDs
+}
+
+func (ctl *Controller) getForecastData(cal fiscal.Calendar, period string, bounds fiscal.Period, req forecast.Request) (ForecastResponse, error) {
+	result, err := forecast.Run(ctl.Dashboard, req)
+	if err != nil {
+		return ForecastResponse{}, err
+	}
+
+	response := ForecastResponse{
+		Period:      period,
+		PeriodStart: req.From,
+		PeriodEnd:   req.To,
+		AsOf:        req.AsOf,
+		GroupBy:     req.By,
+		Method:      req.Method,
+		Confidence:  req.Confidence,
+		Total:       ForecastRow{Row: forecast.Row{Projection: result.Total}},
+	}
+
+	// Targets are set by province
+	targets := map[string]int64{}
+	if req.By == "province" {
+		if targets, err = ctl.getPeriodTargets(cal, period, bounds, req.ProvinceUUIDs); err != nil {
+			return ForecastResponse{}, err
+		}
+	}
+	for _, row := range result.Rows {
+		target := targets[row.UUID]
+		response.Rows = append(response.Rows, ForecastRow{Row: row, Target: target, ProjectedAchievement: achievementOf(row.Projected, target)})
+		response.Total.Target += target
+	}
+	response.Total.ProjectedAchievement = achievementOf(result.Total.Projected, response.Total.Target)
+	return response, nil
+}
+
+// getPeriodTargets returns the target of each province for the fiscal week,
+// month, quarter or year p
+func (ctl *Controller) getPeriodTargets(cal fiscal.Calendar, period string, p fiscal.Period, provinceUUIDs []string) (map[string]int64, error) {
+	switch period {
+	case "quarter":
+		return ctl.getQuarterlyTargets(cal, p.Year, p.Index, provinceUUIDs)
+	case forecast.Week:
+		target, err := metrics.WeekTargets(ctl.Dashboard, cal, p.From, provinceUUIDs)
+		return target.Targets, err
+	case forecast.Month:
+		target, err := metrics.MonthTargets(ctl.Dashboard, cal, p.From, provinceUUIDs)
+		return target.Targets, err
+	}
+
+	// A yearly target is shared by the provinces, otherwise the month targets add up
+	yearTargets, err := ctl.Dashboard.YearTargets([]int{p.Year})
+	if err != nil {
+		return nil, err
+	}
+	if yearTarget, ok := yearTargets[p.Year]; ok && yearTarget > 0 {
+		provinces, err := ctl.Dashboard.Provinces(provinceUUIDs)
+		if err != nil {
+			return nil, err
+		}
+		return distributeYearlyTarget(yearTarget, provinces), nil
+	}
+	rows, err := ctl.Dashboard.MonthlyTargets([]int{p.Year}, provinceUUIDs)
+	if err != nil {
+		return nil, err
+	}
+	targets := make(map[string]int64)
+	for _, row := range rows {
+		targets[row.ProvinceUUID] += row.Target
+	}
+	return targets, nil
+}
+
+// remainingSales returns the sales the seasonal method still expects from
+// now to the end of [from, to) by province, under "" for all of them. Ended
+// ranges expect nothing and cost no query.
+func (ctl *Controller) remainingSales(from, to time.Time, provinceUUIDs []string) (map[string]float64, error) {
+	remaining := map[string]float64{}
+	now := time.Now()
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, from.Location())
+	if end := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, to.Location()); end.Before(to) {
+		to = end.AddDate(0, 0, 1)
+	} else {
+		to = end
+	}
+	if !from.Before(to) || !now.Before(to) {
+		return remaining, nil
+	}
+
+	result, err := forecast.Run(ctl.Dashboard, forecast.Request{
+		From:          from,
+		To:            to,
+		AsOf:          now,
+		By:            "province",
+		Method:        forecast.Seasonal,
+		ProvinceUUIDs: provinceUUIDs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	remaining[""] = result.Total.Projected - float64(result.Total.Actual)
+	for _, row := range result.Rows {
+		remaining[row.UUID] = row.Projected - float64(row.Actual)
+	}
+	return remaining, nil
+}
+
+// achievementOf returns value as a percentage of target, 0 without target
+func achievementOf(value float64, target int64) float64 {
+	if target <= 0 {
+		return 0
+	}
+	return value / float64(target) * 100
+}
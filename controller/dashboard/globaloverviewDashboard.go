@@ -1,12 +1,12 @@
 package dashboard
 
 import (
-	"fmt"
 	"sort"
 	"time"
 
-	"github.com/Danny19977/sr-api/database"
-	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/fiscal"
+	"github.com/Danny19977/sr-api/repository"
+	"github.com/Danny19977/sr-api/workdays"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -17,8 +17,10 @@ type DateRange struct {
 
 type GlobalOverviewResponse struct {
 	TotalSales           int64                 `json:"total_sales"`
-	PreviousPeriodChange float64               `json:"previous_period_change"`
-	AverageDailySales    float64               `json:"average_daily_sales"`
+	PreviousPeriodChange float64               `json:"previous_period_change"` // Change from the comparison period
+	Comparison           Comparison            `json:"comparison"`
+	WorkingDays          int                   `json:"working_days"`
+	AverageDailySales    float64               `json:"average_daily_sales"` // Per working day
 	BestProvince         ProvincePerformance   `json:"best_province"`
 	WorstProvince        ProvincePerformance   `json:"worst_province"`
 	SalesTrend           SalesTrendData        `json:"sales_trend"`
@@ -59,17 +61,30 @@ type PeriodSales struct {
 }
 
 // GetGlobalOverview handles the dashboard data retrieval
-func GetGlobalOverview(c *fiber.Ctx) error {
+func (ctl *Controller) GetGlobalOverview(c *fiber.Ctx) error {
 	// Parse date range from query parameters
 	startDate := c.Query("start_date")
 	endDate := c.Query("end_date")
 	provinceUUID := c.Query("province_uuid") // Get optional province filter
 
+	// Optional province filter shared by every widget
+	var provinceFilter []string
+	if provinceUUID != "" {
+		provinceFilter = []string{provinceUUID}
+	}
+	provinceFilter = ctl.scopeProvinces(c, provinceFilter)
+
 	if startDate == "" || endDate == "" {
-		// Default to current month if no date range provided
+		// Default to the current fiscal month if no date range provided
+		cal, err := ctl.Dashboard.Calendar(provinceFilter)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Error fetching dashboard data",
+				"error":   err.Error(),
+			})
+		}
 		now := time.Now()
-		startOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
-		startDate = startOfMonth.Format("2006-01-02")
+		startDate = cal.MonthOf(now).From.Format("2006-01-02")
 		endDate = now.Format("2006-01-02")
 	}
 
@@ -80,17 +95,45 @@ func GetGlobalOverview(c *fiber.Ctx) error {
 			"error":   err.Error(),
 		})
 	}
+	mode, err := parseComparison(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid comparison",
+			"error":   err.Error(),
+		})
+	}
 
-	// Get all the required data
-	response, err := getOverviewData(dateRange, provinceUUID)
+	// The comparison period holds as many working days as the range
+	work, err := ctl.Dashboard.Workdays(provinceFilter)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Error fetching dashboard data",
 			"error":   err.Error(),
 		})
 	}
+	comparison, err := compareTo(work, mode, dateRange.StartDate, dateRange.EndDate)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid comparison",
+			"error":   err.Error(),
+		})
+	}
 
-	return c.JSON(response)
+	// The comparison period is read too
+	query := dashboardQuery{
+		endpoint:  "global-overview",
+		params:    map[string]string{"start_date": startDate, "end_date": endDate, "compare": mode},
+		provinces: provinceFilter,
+		from:      comparison.From,
+		to:        dateRange.EndDate,
+	}
+	compute := func() (interface{}, error) {
+		return ctl.getOverviewData(work, comparison, dateRange, provinceFilter)
+	}
+	if format := c.Query("format"); format != "" {
+		return ctl.export(c, query, format, compute)
+	}
+	return ctl.respond(c, query, "Error fetching dashboard data", compute)
 }
 
 func parseDateRange(startDate, endDate string) (DateRange, error) {
@@ -110,48 +153,20 @@ func parseDateRange(startDate, endDate string) (DateRange, error) {
 	}, nil
 }
 
-func getOverviewData(dateRange DateRange, provinceUUID string) (GlobalOverviewResponse, error) {
-	db := database.DB
-
-	// Build base query with optional province filter
-	baseQuery := db.Model(&models.Sale{}).
-		Where("created_at BETWEEN ? AND ?", dateRange.StartDate, dateRange.EndDate)
-
-	if provinceUUID != "" {
-		baseQuery = baseQuery.Where("province_uuid = ?", provinceUUID)
-	}
-
-	// Get total sales for current period
-	var totalSales int64
-	err := baseQuery.
-		Select("COALESCE(SUM(quantity), 0)").
-		Row().
-		Scan(&totalSales)
+func (ctl *Controller) getOverviewData(work workdays.Calendar, comparison Comparison, dateRange DateRange, provinceFilter []string) (GlobalOverviewResponse, error) {
+	cal, err := ctl.Dashboard.Calendar(provinceFilter)
 	if err != nil {
 		return GlobalOverviewResponse{}, err
 	}
+	current := repository.TimeRange{From: dateRange.StartDate, To: dateRange.EndDate}
+	previous := repository.TimeRange{From: comparison.From, To: comparison.To}
 
-	// Calculate previous period
-	periodDuration := dateRange.EndDate.Sub(dateRange.StartDate)
-	previousStart := dateRange.StartDate.Add(-periodDuration)
-	previousEnd := dateRange.StartDate
-
-	// Get previous period sales with same province filter
-	previousQuery := db.Model(&models.Sale{}).
-		Where("created_at BETWEEN ? AND ?", previousStart, previousEnd)
-
-	if provinceUUID != "" {
-		previousQuery = previousQuery.Where("province_uuid = ?", provinceUUID)
-	}
-
-	var previousSales int64
-	err = previousQuery.
-		Select("COALESCE(SUM(quantity), 0)").
-		Row().
-		Scan(&previousSales)
+	// Get total sales for the current and the previous period
+	totals, err := ctl.Dashboard.RangeTotals(provinceFilter, current, previous)
 	if err != nil {
 		return GlobalOverviewResponse{}, err
 	}
+	totalSales, previousSales := totals[0], totals[1]
 
 	// Calculate percentage change
 	var percentageChange float64
@@ -159,28 +174,30 @@ func getOverviewData(dateRange DateRange, provinceUUID string) (GlobalOverviewRe
 		percentageChange = float64(totalSales-previousSales) / float64(previousSales) * 100
 	}
 
-	// Calculate average daily sales
-	days := dateRange.EndDate.Sub(dateRange.StartDate).Hours() / 24
-	averageDailySales := float64(totalSales) / days
-
-	// Get provincial performance with optional filter
-	var provincialPerformance []ProvincePerformance
-	provincialQuery := db.Model(&models.Sale{}).
-		Select("provinces.uuid, provinces.name, COALESCE(SUM(sales.quantity), 0) as total_sales").
-		Joins("JOIN provinces ON provinces.uuid = sales.province_uuid").
-		Where("sales.created_at BETWEEN ? AND ?", dateRange.StartDate, dateRange.EndDate)
-
-	if provinceUUID != "" {
-		provincialQuery = provincialQuery.Where("sales.province_uuid = ?", provinceUUID)
+	// Calculate average sales per working day, per day when none was worked
+	workingDays := work.Count(dateRange.StartDate, dateRange.EndDate)
+	days := float64(workingDays)
+	if days == 0 {
+		days = dateRange.EndDate.Sub(dateRange.StartDate).Hours() / 24
+	}
+	var averageDailySales float64
+	if days > 0 {
+		averageDailySales = float64(totalSales) / days
 	}
 
-	err = provincialQuery.
-		Group("provinces.uuid, provinces.name").
-		Order("total_sales DESC").
-		Find(&provincialPerformance).Error
+	// Get provincial performance with optional filter
+	provinceTotals, err := ctl.Dashboard.ProvinceTotals(current, provinceFilter)
 	if err != nil {
 		return GlobalOverviewResponse{}, err
 	}
+	var provincialPerformance []ProvincePerformance
+	for _, total := range provinceTotals {
+		provincialPerformance = append(provincialPerformance, ProvincePerformance{
+			UUID:       total.UUID,
+			Name:       total.Name,
+			TotalSales: total.Total,
+		})
+	}
 
 	// Determine time granularity based on date range
 	duration := dateRange.EndDate.Sub(dateRange.StartDate)
@@ -192,7 +209,7 @@ func getOverviewData(dateRange DateRange, provinceUUID string) (GlobalOverviewRe
 	}
 
 	// Get sales trend based on granularity
-	salesTrend, err := getSalesTrend(dateRange, timeGranularity, provinceUUID)
+	salesTrend, err := ctl.getSalesTrend(dateRange, timeGranularity, provinceFilter)
 	if err != nil {
 		return GlobalOverviewResponse{}, err
 	}
@@ -201,11 +218,7 @@ func getOverviewData(dateRange DateRange, provinceUUID string) (GlobalOverviewRe
 	var bestProvince, worstProvince ProvincePerformance
 	if len(provincialPerformance) > 0 {
 		// Get real targets from Year/Month/Week tables based on date range
-		var provinceFilter []string
-		if provinceUUID != "" {
-			provinceFilter = []string{provinceUUID}
-		}
-		targets, err := getTargetsForDateRange(dateRange, provinceFilter)
+		targets, err := ctl.getTargetsForDateRange(cal, dateRange, provinceFilter)
 		if err != nil {
 			return GlobalOverviewResponse{}, err
 		}
@@ -226,9 +239,9 @@ func getOverviewData(dateRange DateRange, provinceUUID string) (GlobalOverviewRe
 	// Get weekly/monthly heatmap data
 	var heatmap []ProvinceHeatmap
 	if timeGranularity == "daily" || timeGranularity == "weekly" {
-		heatmap, err = getWeeklyHeatmap(dateRange, provinceUUID)
+		heatmap, err = ctl.getWeeklyHeatmap(cal, dateRange, provinceFilter)
 	} else {
-		heatmap, err = getMonthlyHeatmap(dateRange, provinceUUID)
+		heatmap, err = ctl.getMonthlyHeatmap(cal, dateRange, provinceFilter)
 	}
 	if err != nil {
 		return GlobalOverviewResponse{}, err
@@ -242,6 +255,8 @@ func getOverviewData(dateRange DateRange, provinceUUID string) (GlobalOverviewRe
 	return GlobalOverviewResponse{
 		TotalSales:           totalSales,
 		PreviousPeriodChange: percentageChange,
+		Comparison:           comparison,
+		WorkingDays:          workingDays,
 		AverageDailySales:    averageDailySales,
 		BestProvince:         bestProvince,
 		WorstProvince:        worstProvince,
@@ -252,64 +267,105 @@ func getOverviewData(dateRange DateRange, provinceUUID string) (GlobalOverviewRe
 	}, nil
 }
 
-func getWeeklyHeatmap(dateRange DateRange, provinceUUID string) ([]ProvinceHeatmap, error) {
-	db := database.DB
+// periodKey identifies a province in a numbered period (week or month) of a year
+type periodKey struct {
+	ProvinceUUID string
+	Year         int
+	Period       int
+}
+
+// indexTargets sums target rows by province, year and period
+func indexTargets(rows []repository.TargetRow) map[periodKey]int64 {
+	index := make(map[periodKey]int64, len(rows))
+	for _, row := range rows {
+		index[periodKey{row.ProvinceUUID, row.Year, row.Period}] += row.Target
+	}
+	return index
+}
+
+// fiscalYearsOf lists the fiscal years of periods, in order
+func fiscalYearsOf(periods []fiscal.Period) []int {
+	var years []int
+	for _, p := range periods {
+		if len(years) == 0 || years[len(years)-1] != p.Year {
+			years = append(years, p.Year)
+		}
+	}
+	return years
+}
+
+func (ctl *Controller) getWeeklyHeatmap(cal fiscal.Calendar, dateRange DateRange, provinceFilter []string) ([]ProvinceHeatmap, error) {
+	weeks := fiscalPeriods(cal, "week", dateRange)
+	targets, err := ctl.Dashboard.WeeklyTargets(fiscalYearsOf(weeks), provinceFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	return ctl.getPeriodHeatmap(weeks, dateRange, provinceFilter, targets, func(week fiscal.Period) string {
+		return week.Name
+	})
+}
+
+func (ctl *Controller) getMonthlyHeatmap(cal fiscal.Calendar, dateRange DateRange, provinceFilter []string) ([]ProvinceHeatmap, error) {
+	months := fiscalPeriods(cal, "month", dateRange)
+	targets, err := ctl.Dashboard.MonthlyTargets(fiscalYearsOf(months), provinceFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	return ctl.getPeriodHeatmap(months, dateRange, provinceFilter, fiscalMonthTargets(cal, targets), func(month fiscal.Period) string {
+		return cal.CalendarMonth(month.Index).String()
+	})
+}
+
+// getPeriodHeatmap builds the heatmap of every province from one grouped
+// query, comparing the sales of each fiscal week or month within dateRange
+// to its target
+func (ctl *Controller) getPeriodHeatmap(periods []fiscal.Period, dateRange DateRange, provinceFilter []string, targetRows []repository.TargetRow, label func(fiscal.Period) string) ([]ProvinceHeatmap, error) {
 	var heatmap []ProvinceHeatmap
 
 	// Get provinces based on filter
-	var provinces []models.Province
-	provinceQuery := db.Model(&models.Province{})
-	if provinceUUID != "" {
-		provinceQuery = provinceQuery.Where("uuid = ?", provinceUUID)
-	}
-	if err := provinceQuery.Find(&provinces).Error; err != nil {
+	provinces, err := ctl.Dashboard.Provinces(provinceFilter)
+	if err != nil {
 		return nil, err
 	}
 
-	for _, province := range provinces {
-		var periodData []PeriodSales
-
-		// Get weekly sales data for the province
-		rows, err := db.Model(&models.Sale{}).
-			Select("EXTRACT(WEEK FROM created_at) as week_num, EXTRACT(YEAR FROM created_at) as year_num, COALESCE(SUM(quantity), 0) as sales").
-			Where("province_uuid = ? AND created_at BETWEEN ? AND ?",
-				province.UUID, dateRange.StartDate, dateRange.EndDate).
-			Group("week_num, year_num").
-			Order("year_num, week_num").
-			Rows()
-		if err != nil {
-			return nil, err
-		}
-		defer rows.Close()
-
-		for rows.Next() {
-			var weekNum int
-			var yearNum int
-			var sales int64
-			if err := rows.Scan(&weekNum, &yearNum, &sales); err != nil {
-				return nil, err
-			}
+	// The first and last periods are cut to the range
+	bounds := []time.Time{dateRange.StartDate}
+	for i := 1; i < len(periods); i++ {
+		bounds = append(bounds, periods[i].From)
+	}
+	bounds = append(bounds, dateRange.EndDate.AddDate(0, 0, 1))
 
-			// Get target for this week from Week table
-			target, _ := getWeeklyTargetByProvince(province.UUID, yearNum, weekNum)
+	totals, err := ctl.Dashboard.PeriodTotals(bounds, provinceFilter)
+	if err != nil {
+		return nil, err
+	}
+	targets := indexTargets(targetRows)
 
-			// Calculate deviation from target
-			var deviation float64
-			if target > 0 {
-				deviation = float64(sales-target) / float64(target) * 100
-			}
+	periodData := make(map[string][]PeriodSales)
+	for _, total := range totals {
+		p := periods[total.Period]
+		target := targets[periodKey{total.ProvinceUUID, p.Year, p.Index}]
 
-			periodData = append(periodData, PeriodSales{
-				Period:    fmt.Sprintf("Week %d", weekNum),
-				Sales:     sales,
-				Deviation: deviation,
-			})
+		// Calculate deviation from target
+		var deviation float64
+		if target > 0 {
+			deviation = float64(total.Total-target) / float64(target) * 100
 		}
 
+		periodData[total.ProvinceUUID] = append(periodData[total.ProvinceUUID], PeriodSales{
+			Period:    label(p),
+			Sales:     total.Total,
+			Deviation: deviation,
+		})
+	}
+
+	for _, province := range provinces {
 		heatmap = append(heatmap, ProvinceHeatmap{
 			ProvinceUUID: province.UUID,
 			ProvinceName: province.Name,
-			PeriodData:   periodData,
+			PeriodData:   periodData[province.UUID],
 		})
 	}
 
@@ -317,84 +373,18 @@ func getWeeklyHeatmap(dateRange DateRange, provinceUUID string) ([]ProvinceHeatm
 }
 
 // getSalesTrend returns sales trend data with appropriate time granularity
-func getSalesTrend(dateRange DateRange, granularity string, provinceUUID string) (SalesTrendData, error) {
-	db := database.DB
+func (ctl *Controller) getSalesTrend(dateRange DateRange, granularity string, provinceFilter []string) (SalesTrendData, error) {
 	var result SalesTrendData
 	result.Interval = granularity
 
-	var query string
-	var args []interface{}
-
-	// Build WHERE clause for province filter
-	provinceFilter := ""
-	if provinceUUID != "" {
-		provinceFilter = "AND province_uuid = ?"
-	}
-
-	switch granularity {
-	case "daily":
-		query = `
-			SELECT 
-				TO_CHAR(DATE(created_at), 'YYYY-MM-DD') as label,
-				COALESCE(SUM(quantity), 0) as sales
-			FROM sales 
-			WHERE created_at BETWEEN ? AND ? ` + provinceFilter + `
-			GROUP BY DATE(created_at)
-			ORDER BY DATE(created_at)
-		`
-		if provinceUUID != "" {
-			args = []interface{}{dateRange.StartDate, dateRange.EndDate, provinceUUID}
-		} else {
-			args = []interface{}{dateRange.StartDate, dateRange.EndDate}
-		}
-
-	case "weekly":
-		query = `
-			SELECT 
-				CONCAT('Week ', EXTRACT(WEEK FROM created_at)) as label,
-				COALESCE(SUM(quantity), 0) as sales
-			FROM sales 
-			WHERE created_at BETWEEN ? AND ? ` + provinceFilter + `
-			GROUP BY EXTRACT(WEEK FROM created_at)
-			ORDER BY EXTRACT(WEEK FROM created_at)
-		`
-		if provinceUUID != "" {
-			args = []interface{}{dateRange.StartDate, dateRange.EndDate, provinceUUID}
-		} else {
-			args = []interface{}{dateRange.StartDate, dateRange.EndDate}
-		}
-
-	case "monthly":
-		query = `
-			SELECT 
-				TO_CHAR(created_at, 'Month YYYY') as label,
-				COALESCE(SUM(quantity), 0) as sales
-			FROM sales 
-			WHERE created_at BETWEEN ? AND ? ` + provinceFilter + `
-			GROUP BY TO_CHAR(created_at, 'Month YYYY'), EXTRACT(YEAR FROM created_at), EXTRACT(MONTH FROM created_at)
-			ORDER BY EXTRACT(YEAR FROM created_at), EXTRACT(MONTH FROM created_at)
-		`
-		if provinceUUID != "" {
-			args = []interface{}{dateRange.StartDate, dateRange.EndDate, provinceUUID}
-		} else {
-			args = []interface{}{dateRange.StartDate, dateRange.EndDate}
-		}
-	}
-
-	rows, err := db.Raw(query, args...).Rows()
+	totals, err := ctl.Dashboard.SalesTrend(granularity, repository.TimeRange{From: dateRange.StartDate, To: dateRange.EndDate}, provinceFilter)
 	if err != nil {
 		return result, err
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var label string
-		var sales int64
-		if err := rows.Scan(&label, &sales); err != nil {
-			return result, err
-		}
-		result.Labels = append(result.Labels, label)
-		result.Values = append(result.Values, sales)
+	for _, total := range totals {
+		result.Labels = append(result.Labels, total.Label)
+		result.Values = append(result.Values, total.Total)
 	}
 
 	return result, nil
@@ -402,75 +392,14 @@ func getSalesTrend(dateRange DateRange, granularity string, provinceUUID string)
 
 // getProvincialTargets has been replaced by getTargetsForDateRange in targetHelpers.go
 // This function is deprecated and kept only for backwards compatibility
-func getProvincialTargets(dateRange DateRange, provinceUUID string) (map[string]int64, error) {
+func (ctl *Controller) getProvincialTargets(dateRange DateRange, provinceUUID string) (map[string]int64, error) {
 	var provinceFilter []string
 	if provinceUUID != "" {
 		provinceFilter = []string{provinceUUID}
 	}
-	return getTargetsForDateRange(dateRange, provinceFilter)
-}
-
-func getMonthlyHeatmap(dateRange DateRange, provinceUUID string) ([]ProvinceHeatmap, error) {
-	db := database.DB
-	var heatmap []ProvinceHeatmap
-
-	// Get provinces based on filter
-	var provinces []models.Province
-	provinceQuery := db.Model(&models.Province{})
-	if provinceUUID != "" {
-		provinceQuery = provinceQuery.Where("uuid = ?", provinceUUID)
-	}
-	if err := provinceQuery.Find(&provinces).Error; err != nil {
+	cal, err := ctl.Dashboard.Calendar(provinceFilter)
+	if err != nil {
 		return nil, err
 	}
-
-	for _, province := range provinces {
-		var periodData []PeriodSales
-
-		// Get monthly sales data for the province
-		rows, err := db.Model(&models.Sale{}).
-			Select("TO_CHAR(created_at, 'Month') as month_name, EXTRACT(MONTH FROM created_at) as month_num, EXTRACT(YEAR FROM created_at) as year_num, COALESCE(SUM(quantity), 0) as sales").
-			Where("province_uuid = ? AND created_at BETWEEN ? AND ?",
-				province.UUID, dateRange.StartDate, dateRange.EndDate).
-			Group("month_name, month_num, year_num").
-			Order("year_num, month_num").
-			Rows()
-		if err != nil {
-			return nil, err
-		}
-		defer rows.Close()
-
-		for rows.Next() {
-			var monthName string
-			var monthNum int
-			var yearNum int
-			var sales int64
-			if err := rows.Scan(&monthName, &monthNum, &yearNum, &sales); err != nil {
-				return nil, err
-			}
-
-			// Get target for this month from Month table
-			target, _ := getMonthlyTargetByProvince(province.UUID, yearNum, monthNum)
-
-			// Calculate deviation from target
-			var deviation float64
-			if target > 0 {
-				deviation = float64(sales-target) / float64(target) * 100
-			}
-
-			periodData = append(periodData, PeriodSales{
-				Period:    monthName,
-				Sales:     sales,
-				Deviation: deviation,
-			})
-		}
-
-		heatmap = append(heatmap, ProvinceHeatmap{
-			ProvinceUUID: province.UUID,
-			ProvinceName: province.Name,
-			PeriodData:   periodData,
-		})
-	}
-
-	return heatmap, nil
+	return ctl.getTargetsForDateRange(cal, dateRange, provinceFilter)
 }
@@ -2,11 +2,13 @@ package dashboard
 
 import (
 	"fmt"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/Danny19977/sr-api/database"
-	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/fiscal"
+	"github.com/Danny19977/sr-api/repository"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -24,6 +26,10 @@ type YearlyTargetData struct {
 	Target             int64   `json:"target"`
 	Actual             int64   `json:"actual"`
 	AchievementPercent float64 `json:"achievement_percent"`
+	// Projected is the expected sales at the end of the year, the actual
+	// sales of past years
+	Projected            float64 `json:"projected"`
+	ProjectedAchievement float64 `json:"projected_achievement"`
 }
 
 type YearlyCumulativeSeries struct {
@@ -65,7 +71,7 @@ type PeriodGrowthData struct {
 }
 
 // GetHistoricalTrends handles the historical trends dashboard data retrieval
-func GetHistoricalTrends(c *fiber.Ctx) error {
+func (ctl *Controller) GetHistoricalTrends(c *fiber.Ctx) error {
 	// Parse query parameters
 	yearsParam := c.Query("years")         // Comma-separated years: "2025,2024,2023"
 	provincesParam := c.Query("provinces") // Comma-separated province UUIDs
@@ -90,10 +96,6 @@ func GetHistoricalTrends(c *fiber.Ctx) error {
 			}
 		}
 	}
-	if len(years) == 0 {
-		currentYear := time.Now().Year()
-		years = []int{currentYear, currentYear - 1, currentYear - 2}
-	}
 
 	// Parse province filter
 	var provinceUUIDs []string
@@ -113,58 +115,165 @@ func GetHistoricalTrends(c *fiber.Ctx) error {
 		}
 	}
 
-	// Get all the required data
-	response, err := getHistoricalTrendsData(years, provinceUUIDs, viewBy)
+	provinceUUIDs = ctl.scopeProvinces(c, provinceUUIDs)
+
+	// Years are fiscal years
+	cal, err := ctl.Dashboard.Calendar(provinceUUIDs)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Error fetching historical trends data",
 			"error":   err.Error(),
 		})
 	}
+	if len(years) == 0 {
+		currentYear := cal.YearOf(time.Now())
+		years = []int{currentYear, currentYear - 1, currentYear - 2}
+	}
 
-	return c.JSON(response)
+	first, last := years[0], years[0]
+	labels := make([]string, len(years))
+	for i, year := range years {
+		first, last = min(first, year), max(last, year)
+		labels[i] = strconv.Itoa(year)
+	}
+	query := dashboardQuery{
+		endpoint:  "historical-trends",
+		params:    map[string]string{"years": strings.Join(labels, ","), "view_by": viewBy},
+		provinces: provinceUUIDs,
+		from:      cal.Year(first, time.UTC).From,
+		to:        cal.Year(last, time.UTC).To.Add(-time.Second),
+	}
+	compute := func() (interface{}, error) {
+		return ctl.getHistoricalTrendsData(cal, years, provinceUUIDs, viewBy)
+	}
+	if format := c.Query("format"); format != "" {
+		return ctl.export(c, query, format, compute)
+	}
+	return ctl.respond(c, query, "Error fetching historical trends data", compute)
 }
 
-func getHistoricalTrendsData(years []int, provinceUUIDs []string, viewBy string) (HistoricalTrendsResponse, error) {
-	// Get cumulative yearly sales (horse race chart)
-	cumulativeYearlySales, err := getCumulativeYearlySales(years, provinceUUIDs, viewBy)
+// calendarPeriod is a month or a quarter, index being its last month. Months
+// are numbered in the fiscal year.
+type calendarPeriod struct {
+	name   string
+	index  int
+	months []int
+}
+
+// quarters groups the months of a fiscal year
+var quarters = []calendarPeriod{
+	{"Q1", 3, []int{1, 2, 3}},
+	{"Q2", 6, []int{4, 5, 6}},
+	{"Q3", 9, []int{7, 8, 9}},
+	{"Q4", 12, []int{10, 11, 12}},
+}
+
+var shortMonthNames = []string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"}
+
+func (ctl *Controller) getHistoricalTrendsData(cal fiscal.Calendar, years []int, provinceUUIDs []string, viewBy string) (HistoricalTrendsResponse, error) {
+	provinces, err := ctl.Dashboard.Provinces(provinceUUIDs)
 	if err != nil {
 		return HistoricalTrendsResponse{}, err
 	}
 
-	// Get annual sales by province (grouped bar chart)
-	annualSalesByProvince, err := getAnnualSalesByProvince(years, provinceUUIDs)
+	// Sales of each province by fiscal month of the selected years, shared by the widgets
+	bounds, months := fiscalMonthBounds(cal, years)
+	monthTotals, err := ctl.Dashboard.RollupPeriodTotals(bounds, provinceUUIDs)
 	if err != nil {
 		return HistoricalTrendsResponse{}, err
 	}
+	sales := make(map[periodKey]int64, len(monthTotals))
+	for _, total := range monthTotals {
+		if month := months[total.Period]; month.Year != 0 {
+			sales[periodKey{total.ProvinceUUID, month.Year, month.Index}] += total.Total
+		}
+	}
 
-	// Get YoY growth heatmap
-	yoyGrowthHeatmap, err := getYoYGrowthHeatmap(years, provinceUUIDs, viewBy)
+	// Month targets of the selected years
+	monthTargets, err := ctl.Dashboard.MonthlyTargets(years, provinceUUIDs)
 	if err != nil {
 		return HistoricalTrendsResponse{}, err
 	}
+	targets := indexTargets(fiscalMonthTargets(cal, monthTargets))
 
 	// Get yearly targets and achievement
-	yearlyTargets, err := getYearlyTargetsWithAchievement(years, provinceUUIDs)
+	yearlyTargets, err := ctl.getYearlyTargetsWithAchievement(cal, years, provinces, provinceUUIDs, sales, targets)
 	if err != nil {
 		return HistoricalTrendsResponse{}, err
 	}
 
 	return HistoricalTrendsResponse{
-		CumulativeYearlySales: cumulativeYearlySales,
-		AnnualSalesByProvince: annualSalesByProvince,
-		YoYGrowthHeatmap:      yoyGrowthHeatmap,
+		CumulativeYearlySales: getCumulativeYearlySales(cal, years, sales, viewBy),
+		AnnualSalesByProvince: getAnnualSalesByProvince(years, provinces, sales, targets),
+		YoYGrowthHeatmap:      getYoYGrowthHeatmap(cal, years, provinces, sales, viewBy),
 		YearlyTargets:         yearlyTargets,
 		SelectedYears:         years,
 		ViewBy:                viewBy,
 	}, nil
 }
 
-// getCumulativeYearlySales returns cumulative sales for each year (horse race chart)
-func getCumulativeYearlySales(years []int, provinceUUIDs []string, viewBy string) ([]YearlyCumulativeSeries, error) {
-	db := database.DB
+// sumMonths adds the values of a province for months of a year
+func sumMonths(values map[periodKey]int64, provinceUUID string, year int, months ...int) int64 {
+	var total int64
+	for _, month := range months {
+		total += values[periodKey{provinceUUID, year, month}]
+	}
+	return total
+}
+
+var allMonths = []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+
+// fiscalMonthBounds returns the bounds of the fiscal months of years, in
+// order, and the month between each bound and the next. Gaps between years
+// that do not follow each other are zero periods.
+func fiscalMonthBounds(cal fiscal.Calendar, years []int) ([]time.Time, []fiscal.Period) {
+	sorted := slices.Clone(years)
+	slices.Sort(sorted)
+
+	var bounds []time.Time
+	var months []fiscal.Period
+	for _, year := range slices.Compact(sorted) {
+		yearMonths := cal.Months(year, time.UTC)
+		switch {
+		case len(bounds) == 0:
+			bounds = append(bounds, yearMonths[0].From)
+		case !bounds[len(bounds)-1].Equal(yearMonths[0].From):
+			months = append(months, fiscal.Period{})
+			bounds = append(bounds, yearMonths[0].From)
+		}
+		for _, month := range yearMonths {
+			months = append(months, month)
+			bounds = append(bounds, month.To)
+		}
+	}
+	return bounds, months
+}
+
+// getCumulativeYearlySales returns cumulative sales for each fiscal year (horse race chart)
+func getCumulativeYearlySales(cal fiscal.Calendar, years []int, sales map[periodKey]int64, viewBy string) []YearlyCumulativeSeries {
 	var result []YearlyCumulativeSeries
 
+	// Running total of each year at the end of each month; months without
+	// sales keep the total of the month before
+	cumulative := make(map[int][]int64, len(years))
+	for _, year := range years {
+		cumulative[year] = make([]int64, 13)
+	}
+	monthly := make(map[int][]int64, len(years))
+	for key, total := range sales {
+		if _, ok := cumulative[key.Year]; ok {
+			if monthly[key.Year] == nil {
+				monthly[key.Year] = make([]int64, 13)
+			}
+			monthly[key.Year][key.Period] += total
+		}
+	}
+	for year, totals := range monthly {
+		for m := 1; m <= 12; m++ {
+			cumulative[year][m] = cumulative[year][m-1] + totals[m]
+		}
+	}
+
 	for _, year := range years {
 		series := YearlyCumulativeSeries{
 			Year:       year,
@@ -173,64 +282,20 @@ func getCumulativeYearlySales(years []int, provinceUUIDs []string, viewBy string
 
 		if viewBy == "quarterly" {
 			// Quarterly view
-			quarters := []struct {
-				name   string
-				index  int
-				months []int
-			}{
-				{"Q1", 3, []int{1, 2, 3}},
-				{"Q2", 6, []int{4, 5, 6}},
-				{"Q3", 9, []int{7, 8, 9}},
-				{"Q4", 12, []int{10, 11, 12}},
-			}
-
-			var cumulative int64 = 0
 			for _, quarter := range quarters {
-				var quarterSales int64
-
-				startDate := time.Date(year, time.Month(quarter.months[0]), 1, 0, 0, 0, 0, time.UTC)
-				endDate := time.Date(year, time.Month(quarter.months[len(quarter.months)-1]+1), 1, 0, 0, 0, 0, time.UTC)
-
-				query := db.Model(&models.Sale{}).
-					Where("created_at >= ? AND created_at < ?", startDate, endDate)
-
-				if len(provinceUUIDs) > 0 {
-					query = query.Where("province_uuid IN ?", provinceUUIDs)
-				}
-
-				query.Select("COALESCE(SUM(quantity), 0)").Row().Scan(&quarterSales)
-				cumulative += quarterSales
-
 				series.DataPoints = append(series.DataPoints, TimeValue{
 					Period:     quarter.name,
 					MonthIndex: quarter.index,
-					Value:      cumulative,
+					Value:      cumulative[year][quarter.index],
 				})
 			}
 		} else {
 			// Monthly view
-			monthNames := []string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"}
-			var cumulative int64 = 0
-
 			for monthNum := 1; monthNum <= 12; monthNum++ {
-				startDate := time.Date(year, time.Month(monthNum), 1, 0, 0, 0, 0, time.UTC)
-				endDate := time.Date(year, time.Month(monthNum+1), 1, 0, 0, 0, 0, time.UTC)
-
-				query := db.Model(&models.Sale{}).
-					Where("created_at >= ? AND created_at < ?", startDate, endDate)
-
-				if len(provinceUUIDs) > 0 {
-					query = query.Where("province_uuid IN ?", provinceUUIDs)
-				}
-
-				var monthSales int64
-				query.Select("COALESCE(SUM(quantity), 0)").Row().Scan(&monthSales)
-				cumulative += monthSales
-
 				series.DataPoints = append(series.DataPoints, TimeValue{
-					Period:     monthNames[monthNum-1],
+					Period:     shortMonthNames[cal.CalendarMonth(monthNum)-1],
 					MonthIndex: monthNum,
-					Value:      cumulative,
+					Value:      cumulative[year][monthNum],
 				})
 			}
 		}
@@ -238,24 +303,13 @@ func getCumulativeYearlySales(years []int, provinceUUIDs []string, viewBy string
 		result = append(result, series)
 	}
 
-	return result, nil
+	return result
 }
 
 // getAnnualSalesByProvince returns total annual sales for each province (grouped bar chart)
-func getAnnualSalesByProvince(years []int, provinceUUIDs []string) ([]ProvinceAnnualData, error) {
-	db := database.DB
+func getAnnualSalesByProvince(years []int, provinces []repository.ProvinceRef, sales, targets map[periodKey]int64) []ProvinceAnnualData {
 	var result []ProvinceAnnualData
 
-	// Get provinces
-	var provinces []models.Province
-	provinceQuery := db.Model(&models.Province{})
-	if len(provinceUUIDs) > 0 {
-		provinceQuery = provinceQuery.Where("uuid IN ?", provinceUUIDs)
-	}
-	if err := provinceQuery.Find(&provinces).Error; err != nil {
-		return nil, err
-	}
-
 	// For each province, get sales for each year
 	for _, province := range provinces {
 		provinceData := ProvinceAnnualData{
@@ -265,23 +319,10 @@ func getAnnualSalesByProvince(years []int, provinceUUIDs []string) ([]ProvinceAn
 		}
 
 		for _, year := range years {
-			startDate := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
-			endDate := time.Date(year+1, 1, 1, 0, 0, 0, 0, time.UTC)
-
-			var totalSales int64
-			db.Model(&models.Sale{}).
-				Where("province_uuid = ? AND created_at >= ? AND created_at < ?",
-					province.UUID, startDate, endDate).
-				Select("COALESCE(SUM(quantity), 0)").
-				Row().
-				Scan(&totalSales)
+			totalSales := sumMonths(sales, province.UUID, year, allMonths...)
 
 			// Get yearly target from Month table (sum all 12 months)
-			var yearTarget int64
-			for monthNum := 1; monthNum <= 12; monthNum++ {
-				monthTarget, _ := getMonthlyTargetByProvince(province.UUID, year, monthNum)
-				yearTarget += monthTarget
-			}
+			yearTarget := sumMonths(targets, province.UUID, year, allMonths...)
 
 			// Calculate achievement percentage
 			var achievementPercent float64
@@ -300,17 +341,17 @@ func getAnnualSalesByProvince(years []int, provinceUUIDs []string) ([]ProvinceAn
 		result = append(result, provinceData)
 	}
 
-	return result, nil
+	return result
 }
 
-// getYoYGrowthHeatmap returns YoY growth percentages for each province by period
-func getYoYGrowthHeatmap(years []int, provinceUUIDs []string, viewBy string) ([]ProvinceYoYGrowth, error) {
-	db := database.DB
+// getYoYGrowthHeatmap returns YoY growth percentages for each province by
+// fiscal month or quarter
+func getYoYGrowthHeatmap(cal fiscal.Calendar, years []int, provinces []repository.ProvinceRef, sales map[periodKey]int64, viewBy string) []ProvinceYoYGrowth {
 	var result []ProvinceYoYGrowth
 
 	// We need at least 2 years to calculate YoY growth
 	if len(years) < 2 {
-		return result, nil
+		return result
 	}
 
 	// Sort years to get current and previous
@@ -322,14 +363,13 @@ func getYoYGrowthHeatmap(years []int, provinceUUIDs []string, viewBy string) ([]
 		previousYear = years[0]
 	}
 
-	// Get provinces
-	var provinces []models.Province
-	provinceQuery := db.Model(&models.Province{})
-	if len(provinceUUIDs) > 0 {
-		provinceQuery = provinceQuery.Where("uuid IN ?", provinceUUIDs)
-	}
-	if err := provinceQuery.Find(&provinces).Error; err != nil {
-		return nil, err
+	// Monthly or quarterly periods to compare
+	periods := quarters
+	if viewBy != "quarterly" {
+		periods = nil
+		for monthNum := 1; monthNum <= 12; monthNum++ {
+			periods = append(periods, calendarPeriod{shortMonthNames[cal.CalendarMonth(monthNum)-1], monthNum, []int{monthNum}})
+		}
 	}
 
 	for _, province := range provinces {
@@ -339,167 +379,83 @@ func getYoYGrowthHeatmap(years []int, provinceUUIDs []string, viewBy string) ([]
 			PeriodGrowth: []PeriodGrowthData{},
 		}
 
-		if viewBy == "quarterly" {
-			// Quarterly YoY growth
-			quarters := []struct {
-				name   string
-				index  int
-				months []int
-			}{
-				{"Q1", 3, []int{1, 2, 3}},
-				{"Q2", 6, []int{4, 5, 6}},
-				{"Q3", 9, []int{7, 8, 9}},
-				{"Q4", 12, []int{10, 11, 12}},
-			}
+		for _, period := range periods {
+			currentSales := sumMonths(sales, province.UUID, currentYear, period.months...)
+			previousSales := sumMonths(sales, province.UUID, previousYear, period.months...)
 
-			for _, quarter := range quarters {
-				// Current year quarter
-				currentStart := time.Date(currentYear, time.Month(quarter.months[0]), 1, 0, 0, 0, 0, time.UTC)
-				currentEnd := time.Date(currentYear, time.Month(quarter.months[len(quarter.months)-1]+1), 1, 0, 0, 0, 0, time.UTC)
-
-				var currentSales int64
-				db.Model(&models.Sale{}).
-					Where("province_uuid = ? AND created_at >= ? AND created_at < ?",
-						province.UUID, currentStart, currentEnd).
-					Select("COALESCE(SUM(quantity), 0)").
-					Row().
-					Scan(&currentSales)
-
-				// Previous year quarter
-				previousStart := time.Date(previousYear, time.Month(quarter.months[0]), 1, 0, 0, 0, 0, time.UTC)
-				previousEnd := time.Date(previousYear, time.Month(quarter.months[len(quarter.months)-1]+1), 1, 0, 0, 0, 0, time.UTC)
-
-				var previousSales int64
-				db.Model(&models.Sale{}).
-					Where("province_uuid = ? AND created_at >= ? AND created_at < ?",
-						province.UUID, previousStart, previousEnd).
-					Select("COALESCE(SUM(quantity), 0)").
-					Row().
-					Scan(&previousSales)
-
-				// Calculate growth %
-				var growthPercent float64
-				if previousSales > 0 {
-					growthPercent = float64(currentSales-previousSales) / float64(previousSales) * 100
-				}
-
-				provinceGrowth.PeriodGrowth = append(provinceGrowth.PeriodGrowth, PeriodGrowthData{
-					Period:        quarter.name,
-					MonthIndex:    quarter.index,
-					CurrentSales:  currentSales,
-					PreviousSales: previousSales,
-					GrowthPercent: growthPercent,
-				})
+			// Calculate growth %
+			var growthPercent float64
+			if previousSales > 0 {
+				growthPercent = float64(currentSales-previousSales) / float64(previousSales) * 100
 			}
-		} else {
-			// Monthly YoY growth
-			monthNames := []string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"}
 
-			for monthNum := 1; monthNum <= 12; monthNum++ {
-				// Current year month
-				currentStart := time.Date(currentYear, time.Month(monthNum), 1, 0, 0, 0, 0, time.UTC)
-				currentEnd := time.Date(currentYear, time.Month(monthNum+1), 1, 0, 0, 0, 0, time.UTC)
-
-				var currentSales int64
-				db.Model(&models.Sale{}).
-					Where("province_uuid = ? AND created_at >= ? AND created_at < ?",
-						province.UUID, currentStart, currentEnd).
-					Select("COALESCE(SUM(quantity), 0)").
-					Row().
-					Scan(&currentSales)
-
-				// Previous year month
-				previousStart := time.Date(previousYear, time.Month(monthNum), 1, 0, 0, 0, 0, time.UTC)
-				previousEnd := time.Date(previousYear, time.Month(monthNum+1), 1, 0, 0, 0, 0, time.UTC)
-
-				var previousSales int64
-				db.Model(&models.Sale{}).
-					Where("province_uuid = ? AND created_at >= ? AND created_at < ?",
-						province.UUID, previousStart, previousEnd).
-					Select("COALESCE(SUM(quantity), 0)").
-					Row().
-					Scan(&previousSales)
-
-				// Calculate growth %
-				var growthPercent float64
-				if previousSales > 0 {
-					growthPercent = float64(currentSales-previousSales) / float64(previousSales) * 100
-				}
-
-				provinceGrowth.PeriodGrowth = append(provinceGrowth.PeriodGrowth, PeriodGrowthData{
-					Period:        monthNames[monthNum-1],
-					MonthIndex:    monthNum,
-					CurrentSales:  currentSales,
-					PreviousSales: previousSales,
-					GrowthPercent: growthPercent,
-				})
-			}
+			provinceGrowth.PeriodGrowth = append(provinceGrowth.PeriodGrowth, PeriodGrowthData{
+				Period:        period.name,
+				MonthIndex:    period.index,
+				CurrentSales:  currentSales,
+				PreviousSales: previousSales,
+				GrowthPercent: growthPercent,
+			})
 		}
 
 		result = append(result, provinceGrowth)
 	}
 
-	return result, nil
+	return result
 }
 
 // getYearlyTargetsWithAchievement fetches yearly targets and calculates achievement
-func getYearlyTargetsWithAchievement(years []int, provinceUUIDs []string) ([]YearlyTargetData, error) {
-	db := database.DB
+func (ctl *Controller) getYearlyTargetsWithAchievement(cal fiscal.Calendar, years []int, provinces []repository.ProvinceRef, provinceUUIDs []string, sales, monthTargets map[periodKey]int64) ([]YearlyTargetData, error) {
 	var result []YearlyTargetData
 
-	for _, year := range years {
-		startDate := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
-		endDate := time.Date(year+1, 1, 1, 0, 0, 0, 0, time.UTC)
-
-		// Get actual sales for the year
-		query := db.Model(&models.Sale{}).
-			Where("created_at >= ? AND created_at < ?", startDate, endDate)
-
-		if len(provinceUUIDs) > 0 {
-			query = query.Where("province_uuid IN ?", provinceUUIDs)
-		}
-
-		var actualSales int64
-		query.Select("COALESCE(SUM(quantity), 0)").Row().Scan(&actualSales)
+	// Get targets from the Year table
+	yearTargets, err := ctl.Dashboard.YearTargets(years)
+	if err != nil {
+		return nil, err
+	}
 
-		// Get targets from Year or Month tables
-		targets, _ := getYearlyTargets(year, provinceUUIDs)
+	// Get actual sales for each year
+	actual := make(map[int]int64, len(years))
+	for key, total := range sales {
+		actual[key.Year] += total
+	}
 
+	for _, year := range years {
 		var totalTarget int64
-		for _, target := range targets {
-			totalTarget += target
+		if yearlyTarget, ok := yearTargets[year]; ok {
+			for _, target := range distributeYearlyTarget(yearlyTarget, provinces) {
+				totalTarget += target
+			}
 		}
 
-		// If no yearly targets, try to sum monthly targets
+		// If no yearly targets, sum monthly targets for all 12 months for each province
 		if totalTarget == 0 {
-			// Get all provinces
-			var provinces []models.Province
-			provinceQuery := db.Model(&models.Province{})
-			if len(provinceUUIDs) > 0 {
-				provinceQuery = provinceQuery.Where("uuid IN ?", provinceUUIDs)
-			}
-			provinceQuery.Find(&provinces)
-
-			// Sum monthly targets for all 12 months for each province
 			for _, province := range provinces {
-				for monthNum := 1; monthNum <= 12; monthNum++ {
-					monthTarget, _ := getMonthlyTargetByProvince(province.UUID, year, monthNum)
-					totalTarget += monthTarget
-				}
+				totalTarget += sumMonths(monthTargets, province.UUID, year, allMonths...)
 			}
 		}
 
 		// Calculate achievement percentage
 		var achievementPercent float64
 		if totalTarget > 0 {
-			achievementPercent = float64(actualSales) / float64(totalTarget) * 100
+			achievementPercent = float64(actual[year]) / float64(totalTarget) * 100
+		}
+
+		// Sales still expected before the end of the year
+		fy := cal.Year(year, time.Local)
+		remaining, err := ctl.remainingSales(fy.From, fy.To, provinceUUIDs)
+		if err != nil {
+			return nil, err
 		}
+		projected := float64(actual[year]) + remaining[""]
 
 		result = append(result, YearlyTargetData{
-			Year:               year,
-			Target:             totalTarget,
-			Actual:             actualSales,
-			AchievementPercent: achievementPercent,
+			Year:                 year,
+			Target:               totalTarget,
+			Actual:               actual[year],
+			AchievementPercent:   achievementPercent,
+			Projected:            projected,
+			ProjectedAchievement: achievementOf(projected, totalTarget),
 		})
 	}
 
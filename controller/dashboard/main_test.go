@@ -0,0 +1,9 @@
+package dashboard_test
+
+import (
+	"testing"
+
+	"github.com/Danny19977/sr-api/apptest"
+)
+
+func TestMain(m *testing.M) { apptest.Main(m) }
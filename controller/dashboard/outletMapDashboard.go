@@ -0,0 +1,83 @@
+package dashboard
+
+import (
+	"time"
+
+	"github.com/Danny19977/sr-api/geo"
+	"github.com/Danny19977/sr-api/repository"
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetOutletMap returns the outlets as a GeoJSON feature collection of
+// points, each with what it sold over the date range. Outlets without sales
+// are kept so the map shows the under-served ones.
+func (ctl *Controller) GetOutletMap(c *fiber.Ctx) error {
+	provinceUUIDs := ctl.scopeProvinces(c, parseProvinces(c))
+
+	filter := repository.OutletFilter{ProvinceUUIDs: provinceUUIDs, Type: c.Query("type")}
+	if value := c.Query("bbox"); value != "" {
+		box, err := geo.ParseBox(value)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Invalid bounding box",
+				"error":   err.Error(),
+			})
+		}
+		filter.Box = &box
+	}
+
+	startDate, endDate := c.Query("start_date"), c.Query("end_date")
+	if startDate == "" || endDate == "" {
+		// Default to the current fiscal month if no date range provided
+		cal, err := ctl.Dashboard.Calendar(provinceUUIDs)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Error fetching outlet map",
+				"error":   err.Error(),
+			})
+		}
+		now := time.Now()
+		startDate = cal.MonthOf(now).From.Format("2006-01-02")
+		endDate = now.Format("2006-01-02")
+	}
+	dateRange, err := parseDateRange(startDate, endDate)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid date range",
+			"error":   err.Error(),
+		})
+	}
+
+	query := dashboardQuery{
+		endpoint: "outlet-map",
+		params: map[string]string{
+			"start_date": startDate,
+			"end_date":   endDate,
+			"type":       filter.Type,
+			"bbox":       c.Query("bbox"),
+		},
+		provinces: provinceUUIDs,
+		from:      dateRange.StartDate,
+		to:        dateRange.EndDate,
+	}
+	return ctl.respond(c, query, "Error fetching outlet map", func() (interface{}, error) {
+		rg := repository.TimeRange{From: dateRange.StartDate, To: dateRange.EndDate.AddDate(0, 0, 1).Add(-time.Microsecond)}
+		outlets, err := ctl.Outlets.Sales(rg, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		features := make([]geo.Feature, len(outlets))
+		for i, outlet := range outlets {
+			features[i] = geo.PointFeature(outlet.UUID, outlet.Position(), map[string]interface{}{
+				"name":          outlet.Name,
+				"type":          outlet.Type,
+				"owner_name":    outlet.OwnerName,
+				"province_uuid": outlet.ProvinceUUID,
+				"total":         outlet.Total,
+				"entries":       outlet.Entries,
+			})
+		}
+		return geo.NewFeatureCollection(features), nil
+	})
+}
@@ -0,0 +1,408 @@
+package dashboard
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Danny19977/sr-api/fiscal"
+	"github.com/Danny19977/sr-api/forecast"
+	"github.com/Danny19977/sr-api/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Leaderboard metrics
+var performanceMetrics = []string{"total", "achievement", "compliance", "timeliness"}
+
+// PerformanceRow is what a user achieved over a period
+type PerformanceRow struct {
+	Rank         int    `json:"rank"`
+	UserUUID     string `json:"user_uuid"`
+	Fullname     string `json:"fullname"`
+	Role         string `json:"role"`
+	ProvinceUUID string `json:"province_uuid"` // Province the user is assigned to
+	ProvinceName string `json:"province_name"`
+	Total        int64  `json:"total"`
+	Entries      int64  `json:"entries"`
+	// TargetShare is the target of the province of the user divided among
+	// its users
+	TargetShare int64   `json:"target_share"`
+	Achievement float64 `json:"achievement"` // Percentage of the target share
+	// SlotsEntered counts the time slots of the period the user entered in
+	SlotsEntered int64 `json:"slots_entered"`
+	// ComplianceRate is the share of the slots of the province entered on
+	// time, in percent
+	ComplianceRate float64 `json:"compliance_rate"`
+	// MinutesAfterOpen is the average delay of the first entry of a slot
+	// after the slot opened, 0 without any
+	MinutesAfterOpen float64 `json:"minutes_after_open"`
+}
+
+type LeaderboardResponse struct {
+	Period      string           `json:"period"` // "week", "month", "quarter" or "year"
+	PeriodName  string           `json:"period_name"`
+	PeriodStart time.Time        `json:"period_start"`
+	PeriodEnd   time.Time        `json:"period_end"` // Start of the next period
+	Metric      string           `json:"metric"`
+	CountryUUID string           `json:"country_uuid"`
+	Rows        []PerformanceRow `json:"rows"`
+}
+
+type ScorecardResponse struct {
+	Period      string         `json:"period"`
+	PeriodName  string         `json:"period_name"`
+	PeriodStart time.Time      `json:"period_start"`
+	PeriodEnd   time.Time      `json:"period_end"`
+	Performance PerformanceRow `json:"performance"` // Rank is by total within the country
+	// Participants is the number of users ranked in the country
+	Participants int `json:"participants"`
+	// CountryAverage averages the figures of the participants
+	CountryAverage PerformanceRow `json:"country_average"`
+}
+
+// parsePerformancePeriod reads the fiscal week, month, quarter or year
+// holding the date query parameter, today by default
+func parsePerformancePeriod(c *fiber.Ctx, cal fiscal.Calendar) (string, fiscal.Period, error) {
+	period := c.Query("period", forecast.Month)
+	date := time.Now()
+	if value := c.Query("date"); value != "" {
+		var err error
+		if date, err = time.ParseInLocation("2006-01-02", value, time.Local); err != nil {
+			return period, fiscal.Period{}, fmt.Errorf("invalid date format, use YYYY-MM-DD")
+		}
+	}
+
+	if period == "quarter" {
+		for _, quarter := range cal.Quarters(cal.YearOf(date), date.Location()) {
+			if quarter.Contains(date) {
+				return period, quarter, nil
+			}
+		}
+	}
+	p, err := forecast.PeriodBounds(cal, period, date)
+	if err != nil {
+		return period, p, fmt.Errorf("period must be week, month, quarter or year")
+	}
+	return period, p, nil
+}
+
+// periodName names a fiscal period for the performance dashboards
+func periodName(p fiscal.Period) string {
+	if p.Index == 0 {
+		return strconv.Itoa(p.Year)
+	}
+	return fmt.Sprintf("%d %s", p.Year, p.Name)
+}
+
+// rankPerformance orders rows by metric, best first, and numbers them.
+// Users without any slot entered come last by timeliness.
+func rankPerformance(rows []PerformanceRow, metric string) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		switch metric {
+		case "achievement":
+			return a.Achievement > b.Achievement
+		case "compliance":
+			return a.ComplianceRate > b.ComplianceRate
+		case "timeliness":
+			if (a.SlotsEntered == 0) != (b.SlotsEntered == 0) {
+				return b.SlotsEntered == 0
+			}
+			return a.MinutesAfterOpen < b.MinutesAfterOpen
+		}
+		return a.Total > b.Total
+	})
+	for i := range rows {
+		rows[i].Rank = i + 1
+	}
+}
+
+// getPerformance computes the figures of the users of provinceUUIDs, every
+// province when empty, over the fiscal period p
+func (ctl *Controller) getPerformance(cal fiscal.Calendar, period string, p fiscal.Period, provinceUUIDs []string) ([]PerformanceRow, error) {
+	activity, err := ctl.Dashboard.UserActivity(p.From, p.To, provinceUUIDs)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := ctl.getPeriodTargets(cal, period, p, provinceUUIDs)
+	if err != nil {
+		return nil, err
+	}
+	summaries, err := ctl.Compliance.Summary(p.From, p.To.AddDate(0, 0, -1), provinceUUIDs)
+	if err != nil {
+		return nil, err
+	}
+	provinces, err := ctl.Dashboard.Provinces(provinceUUIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]string, len(provinces))
+	for _, province := range provinces {
+		names[province.UUID] = province.Name
+	}
+	compliance := make(map[string]float64, len(summaries))
+	for _, s := range summaries {
+		if slots := s.OnTime + s.Late + s.Missing; slots > 0 {
+			compliance[s.ProvinceUUID] = float64(s.OnTime) / float64(slots) * 100
+		}
+	}
+	// The target of a province is shared by the users assigned to it
+	users := make(map[string]int64)
+	for _, a := range activity {
+		users[a.ProvinceUUID]++
+	}
+
+	rows := make([]PerformanceRow, len(activity))
+	for i, a := range activity {
+		rows[i] = PerformanceRow{
+			UserUUID:         a.UserUUID,
+			Fullname:         a.Fullname,
+			Role:             a.Role,
+			ProvinceUUID:     a.ProvinceUUID,
+			ProvinceName:     names[a.ProvinceUUID],
+			Total:            a.Total,
+			Entries:          a.Entries,
+			SlotsEntered:     a.Slots,
+			ComplianceRate:   compliance[a.ProvinceUUID],
+			MinutesAfterOpen: a.MinutesAfterOpen,
+		}
+		if target, ok := targets[a.ProvinceUUID]; ok && a.ProvinceUUID != "" {
+			rows[i].TargetShare = target / users[a.ProvinceUUID]
+			rows[i].Achievement = achievementOf(float64(a.Total), rows[i].TargetShare)
+		}
+	}
+	return rows, nil
+}
+
+// countryProvinces returns the provinces of a country, a province matching
+// nothing when it has none
+func (ctl *Controller) countryProvinces(countryUUID string) ([]string, error) {
+	provinces, err := ctl.Geography.ProvincesByCountry(countryUUID)
+	if err != nil {
+		return nil, err
+	}
+	if len(provinces) == 0 {
+		return []string{""}, nil
+	}
+	provinceUUIDs := make([]string, len(provinces))
+	for i, province := range provinces {
+		provinceUUIDs[i] = province.UUID
+	}
+	return provinceUUIDs, nil
+}
+
+// GetLeaderboard ranks the users of a country, or of the provinces filter,
+// over a fiscal period by metric: "total" (default), "achievement",
+// "compliance" or "timeliness". An ASM only sees their province, and
+// team=true keeps the users reporting to the caller.
+func (ctl *Controller) GetLeaderboard(c *fiber.Ctx) error {
+	metric := c.Query("metric", "total")
+	if !slices.Contains(performanceMetrics, metric) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid metric",
+			"error":   "metric must be " + strings.Join(performanceMetrics, ", "),
+		})
+	}
+	limit, err := strconv.Atoi(c.Query("limit", "0"))
+	if err != nil || limit < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid limit",
+			"error":   "limit must be a positive number",
+		})
+	}
+
+	countryUUID := c.Query("country_uuid")
+	provinceUUIDs := parseProvinces(c)
+	if countryUUID != "" {
+		if provinceUUIDs, err = ctl.countryProvinces(countryUUID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Error fetching leaderboard",
+				"error":   err.Error(),
+			})
+		}
+	}
+	provinceUUIDs = ctl.scopeProvinces(c, provinceUUIDs)
+
+	// The members are part of the key, so a change of team reads afresh
+	var team []string
+	if c.QueryBool("team") {
+		userUUID, _ := utils.GetUserUUIDFromToken(c)
+		if team, err = ctl.Users.Team(userUUID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Error fetching leaderboard",
+				"error":   err.Error(),
+			})
+		}
+		slices.Sort(team)
+	}
+
+	cal, err := ctl.Dashboard.Calendar(provinceUUIDs)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Error fetching leaderboard",
+			"error":   err.Error(),
+		})
+	}
+	period, p, err := parsePerformancePeriod(c, cal)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid period",
+			"error":   err.Error(),
+		})
+	}
+
+	query := dashboardQuery{
+		endpoint: "leaderboard",
+		params: map[string]string{
+			"period":  period,
+			"from":    p.From.Format("2006-01-02"),
+			"metric":  metric,
+			"country": countryUUID,
+			"limit":   strconv.Itoa(limit),
+		},
+		provinces: provinceUUIDs,
+		from:      p.From,
+		to:        p.To,
+	}
+	if team != nil {
+		query.params["team"] = "[" + strings.Join(team, ",") + "]"
+	}
+	// Slot compliance is recorded without invalidating the cache
+	if p.Contains(time.Now()) {
+		query.ttl = time.Minute
+	}
+	compute := func() (interface{}, error) {
+		rows, err := ctl.getPerformance(cal, period, p, provinceUUIDs)
+		if err != nil {
+			return nil, err
+		}
+		if team != nil {
+			rows = slices.DeleteFunc(rows, func(row PerformanceRow) bool {
+				_, member := slices.BinarySearch(team, row.UserUUID)
+				return !member
+			})
+		}
+		rankPerformance(rows, metric)
+		if limit > 0 && len(rows) > limit {
+			rows = rows[:limit]
+		}
+		return LeaderboardResponse{
+			Period:      period,
+			PeriodName:  periodName(p),
+			PeriodStart: p.From,
+			PeriodEnd:   p.To,
+			Metric:      metric,
+			CountryUUID: countryUUID,
+			Rows:        rows,
+		}, nil
+	}
+	if format := c.Query("format"); format != "" {
+		return ctl.export(c, query, format, compute)
+	}
+	return ctl.respond(c, query, "Error fetching leaderboard", compute)
+}
+
+// GetScorecard returns the performance of the logged-in user over a fiscal
+// period with their rank by total among the users of their country
+func (ctl *Controller) GetScorecard(c *fiber.Ctx) error {
+	userUUID, _ := utils.GetUserUUIDFromToken(c)
+	user, err := ctl.Users.FindByUUID(userUUID)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Unauthenticated",
+			"error":   err.Error(),
+		})
+	}
+
+	// The user is ranked among the users of their country
+	var provinceUUIDs []string
+	if user.ProvinceUUID != nil {
+		province, err := ctl.Geography.FindProvince(*user.ProvinceUUID)
+		if err == nil {
+			provinceUUIDs, err = ctl.countryProvinces(province.CountryUUID)
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Error fetching scorecard",
+				"error":   err.Error(),
+			})
+		}
+	}
+
+	cal, err := ctl.Dashboard.Calendar(provinceUUIDs)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Error fetching scorecard",
+			"error":   err.Error(),
+		})
+	}
+	period, p, err := parsePerformancePeriod(c, cal)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid period",
+			"error":   err.Error(),
+		})
+	}
+
+	query := dashboardQuery{
+		endpoint:  "scorecard",
+		params:    map[string]string{"period": period, "from": p.From.Format("2006-01-02"), "user": user.UUID},
+		provinces: provinceUUIDs,
+		from:      p.From,
+		to:        p.To,
+	}
+	if p.Contains(time.Now()) {
+		query.ttl = time.Minute
+	}
+	return ctl.respond(c, query, "Error fetching scorecard", func() (interface{}, error) {
+		rows, err := ctl.getPerformance(cal, period, p, provinceUUIDs)
+		if err != nil {
+			return nil, err
+		}
+		rankPerformance(rows, "total")
+
+		scorecard := ScorecardResponse{
+			Period:       period,
+			PeriodName:   periodName(p),
+			PeriodStart:  p.From,
+			PeriodEnd:    p.To,
+			Performance:  PerformanceRow{UserUUID: user.UUID, Fullname: user.Fullname, Role: user.Role},
+			Participants: len(rows),
+		}
+		var average PerformanceRow
+		var timely int
+		for _, row := range rows {
+			if row.UserUUID == user.UUID {
+				scorecard.Performance = row
+			}
+			average.Total += row.Total
+			average.Entries += row.Entries
+			average.TargetShare += row.TargetShare
+			average.SlotsEntered += row.SlotsEntered
+			average.Achievement += row.Achievement
+			average.ComplianceRate += row.ComplianceRate
+			// Timeliness averages the users who entered in a slot
+			if row.SlotsEntered > 0 {
+				average.MinutesAfterOpen += row.MinutesAfterOpen
+				timely++
+			}
+		}
+		if n := len(rows); n > 0 {
+			average.Total /= int64(n)
+			average.Entries /= int64(n)
+			average.TargetShare /= int64(n)
+			average.SlotsEntered /= int64(n)
+			average.Achievement /= float64(n)
+			average.ComplianceRate /= float64(n)
+		}
+		if timely > 0 {
+			average.MinutesAfterOpen /= float64(timely)
+		}
+		scorecard.CountryAverage = average
+		return scorecard, nil
+	})
+}
@@ -2,11 +2,12 @@ package dashboard
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
-	"github.com/Danny19977/sr-api/database"
-	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/fiscal"
+	"github.com/Danny19977/sr-api/repository"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -24,6 +25,10 @@ type ProvinceTarget struct {
 	Target       int64   `json:"target"`
 	Actual       int64   `json:"actual"`
 	Achievement  float64 `json:"achievement"` // Percentage
+	// Projected is the expected sales at the end of the range and
+	// ProjectedAchievement its percentage of the target
+	Projected            float64 `json:"projected"`
+	ProjectedAchievement float64 `json:"projected_achievement"`
 }
 
 type ProvinceTimeSeries struct {
@@ -58,29 +63,13 @@ type IntraDayHeatmap struct {
 }
 
 // GetProvincialAnalysis handles the provincial analysis dashboard data retrieval
-func GetProvincialAnalysis(c *fiber.Ctx) error {
+func (ctl *Controller) GetProvincialAnalysis(c *fiber.Ctx) error {
 	// Parse date range from query parameters
 	startDate := c.Query("start_date")
 	endDate := c.Query("end_date")
 	provincesParam := c.Query("provinces")     // Comma-separated list of province UUIDs
 	singleProvince := c.Query("province_uuid") // Optional single province for compatibility
 
-	if startDate == "" || endDate == "" {
-		// Default to current month if no date range provided
-		now := time.Now()
-		startOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
-		startDate = startOfMonth.Format("2006-01-02")
-		endDate = now.Format("2006-01-02")
-	}
-
-	dateRange, err := parseDateRange(startDate, endDate)
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Invalid date range",
-			"error":   err.Error(),
-		})
-	}
-
 	// Parse province filter
 	var provinceUUIDs []string
 	if provincesParam != "" {
@@ -100,19 +89,47 @@ func GetProvincialAnalysis(c *fiber.Ctx) error {
 		}
 	}
 
-	// Get all the required data
-	response, err := getProvincialAnalysisData(dateRange, provinceUUIDs)
+	provinceUUIDs = ctl.scopeProvinces(c, provinceUUIDs)
+
+	if startDate == "" || endDate == "" {
+		// Default to the current fiscal month if no date range provided
+		cal, err := ctl.Dashboard.Calendar(provinceUUIDs)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Error fetching provincial analysis data",
+				"error":   err.Error(),
+			})
+		}
+		now := time.Now()
+		startDate = cal.MonthOf(now).From.Format("2006-01-02")
+		endDate = now.Format("2006-01-02")
+	}
+
+	dateRange, err := parseDateRange(startDate, endDate)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Error fetching provincial analysis data",
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid date range",
 			"error":   err.Error(),
 		})
 	}
 
-	return c.JSON(response)
+	query := dashboardQuery{
+		endpoint:  "provincial-analysis",
+		params:    map[string]string{"start_date": startDate, "end_date": endDate},
+		provinces: provinceUUIDs,
+		from:      dateRange.StartDate,
+		to:        dateRange.EndDate,
+	}
+	compute := func() (interface{}, error) {
+		return ctl.getProvincialAnalysisData(dateRange, provinceUUIDs)
+	}
+	if format := c.Query("format"); format != "" {
+		return ctl.export(c, query, format, compute)
+	}
+	return ctl.respond(c, query, "Error fetching provincial analysis data", compute)
 }
 
-func getProvincialAnalysisData(dateRange DateRange, provinceUUIDs []string) (ProvincialAnalysisResponse, error) {
+func (ctl *Controller) getProvincialAnalysisData(dateRange DateRange, provinceUUIDs []string) (ProvincialAnalysisResponse, error) {
 	// Determine time granularity based on date range
 	duration := dateRange.EndDate.Sub(dateRange.StartDate)
 	timeGranularity := "daily"
@@ -122,255 +139,145 @@ func getProvincialAnalysisData(dateRange DateRange, provinceUUIDs []string) (Pro
 		timeGranularity = "weekly"
 	}
 
-	// Get provincial comparison data (multi-line chart)
-	provincialComparison, err := getProvincialComparison(dateRange, timeGranularity, provinceUUIDs)
+	// Get provinces based on filter
+	provinces, err := ctl.Dashboard.Provinces(provinceUUIDs)
+	if err != nil {
+		return ProvincialAnalysisResponse{}, err
+	}
+	cal, err := ctl.Dashboard.Calendar(provinceUUIDs)
 	if err != nil {
 		return ProvincialAnalysisResponse{}, err
 	}
 
-	// Get contribution data (stacked area chart)
-	contributionData, err := getContributionData(dateRange, timeGranularity, provinceUUIDs)
+	// One grouped query feeds both the comparison and the contribution charts
+	current := repository.TimeRange{From: dateRange.StartDate, To: dateRange.EndDate}
+	buckets, err := ctl.getBucketTotals(cal, timeGranularity, dateRange, provinceUUIDs)
 	if err != nil {
 		return ProvincialAnalysisResponse{}, err
 	}
 
 	// Get intra-day pattern data (heatmap)
-	intraDayPattern, err := getIntraDayPattern(dateRange, provinceUUIDs)
+	intraDayPattern, err := ctl.getIntraDayPattern(current, provinces, provinceUUIDs)
 	if err != nil {
 		return ProvincialAnalysisResponse{}, err
 	}
 
 	// Get targets and calculate achievement
-	provinceTargets, err := getProvinceTargetsWithAchievement(dateRange, provinceUUIDs)
+	provinceTargets, err := ctl.getProvinceTargetsWithAchievement(cal, dateRange, provinces, provinceUUIDs)
 	if err != nil {
 		return ProvincialAnalysisResponse{}, err
 	}
 
 	return ProvincialAnalysisResponse{
-		ProvincialComparison: provincialComparison,
-		ContributionData:     contributionData,
+		ProvincialComparison: getProvincialComparison(cal, timeGranularity, provinces, buckets),
+		ContributionData:     getContributionData(cal, timeGranularity, provinces, buckets),
 		IntraDayPattern:      intraDayPattern,
 		TimeGranularity:      timeGranularity,
 		ProvinceTargets:      provinceTargets,
 	}, nil
 }
 
-// getProvincialComparison returns time series data for each province
-func getProvincialComparison(dateRange DateRange, granularity string, provinceUUIDs []string) ([]ProvinceTimeSeries, error) {
-	db := database.DB
-	var result []ProvinceTimeSeries
+// getBucketTotals groups the sales of dateRange by province and by day, or by
+// fiscal week or month of cal. Buckets start at the start of their period.
+func (ctl *Controller) getBucketTotals(cal fiscal.Calendar, granularity string, dateRange DateRange, provinceUUIDs []string) ([]repository.BucketTotal, error) {
+	if granularity == "daily" {
+		return ctl.Dashboard.BucketTotals("day", repository.TimeRange{From: dateRange.StartDate, To: dateRange.EndDate}, provinceUUIDs)
+	}
 
-	// Get provinces based on filter
-	var provinces []models.Province
-	provinceQuery := db.Model(&models.Province{})
-	if len(provinceUUIDs) > 0 {
-		provinceQuery = provinceQuery.Where("uuid IN ?", provinceUUIDs)
+	period := "week"
+	if granularity == "monthly" {
+		period = "month"
 	}
-	if err := provinceQuery.Find(&provinces).Error; err != nil {
+	periods := fiscalPeriods(cal, period, dateRange)
+	bounds := []time.Time{dateRange.StartDate}
+	for i := 1; i < len(periods); i++ {
+		bounds = append(bounds, periods[i].From)
+	}
+	bounds = append(bounds, dateRange.EndDate.AddDate(0, 0, 1))
+
+	totals, err := ctl.Dashboard.PeriodTotals(bounds, provinceUUIDs)
+	if err != nil {
 		return nil, err
 	}
+	// Order by time like the daily buckets
+	sort.SliceStable(totals, func(i, j int) bool { return totals[i].Period < totals[j].Period })
 
-	// For each province, get time series data
-	for _, province := range provinces {
-		var dataPoints []TimePoint
-
-		var query string
-		var args []interface{}
-
-		switch granularity {
-		case "daily":
-			query = `
-				SELECT 
-					TO_CHAR(DATE(created_at), 'YYYY-MM-DD') as label,
-					COALESCE(SUM(quantity), 0) as sales
-				FROM sales 
-				WHERE province_uuid = ? AND created_at BETWEEN ? AND ?
-				GROUP BY DATE(created_at)
-				ORDER BY DATE(created_at)
-			`
-			args = []interface{}{province.UUID, dateRange.StartDate, dateRange.EndDate}
-
-		case "weekly":
-			query = `
-				SELECT 
-					CONCAT('Week ', EXTRACT(WEEK FROM created_at)) as label,
-					COALESCE(SUM(quantity), 0) as sales
-				FROM sales 
-				WHERE province_uuid = ? AND created_at BETWEEN ? AND ?
-				GROUP BY EXTRACT(WEEK FROM created_at), EXTRACT(YEAR FROM created_at)
-				ORDER BY EXTRACT(YEAR FROM created_at), EXTRACT(WEEK FROM created_at)
-			`
-			args = []interface{}{province.UUID, dateRange.StartDate, dateRange.EndDate}
-
-		case "monthly":
-			query = `
-				SELECT 
-					TO_CHAR(created_at, 'Mon YYYY') as label,
-					COALESCE(SUM(quantity), 0) as sales
-				FROM sales 
-				WHERE province_uuid = ? AND created_at BETWEEN ? AND ?
-				GROUP BY TO_CHAR(created_at, 'Mon YYYY'), EXTRACT(YEAR FROM created_at), EXTRACT(MONTH FROM created_at)
-				ORDER BY EXTRACT(YEAR FROM created_at), EXTRACT(MONTH FROM created_at)
-			`
-			args = []interface{}{province.UUID, dateRange.StartDate, dateRange.EndDate}
-		}
+	buckets := make([]repository.BucketTotal, len(totals))
+	for i, total := range totals {
+		buckets[i] = repository.BucketTotal{ProvinceUUID: total.ProvinceUUID, Bucket: periods[total.Period].From, Total: total.Total}
+	}
+	return buckets, nil
+}
 
-		rows, err := db.Raw(query, args...).Rows()
-		if err != nil {
-			return nil, err
-		}
+// bucketLabel formats the start of a period for the charts
+func bucketLabel(cal fiscal.Calendar, granularity string, bucket time.Time) string {
+	switch granularity {
+	case "weekly":
+		return cal.WeekOf(bucket).Name
+	case "monthly":
+		// Retail months may start in the last days of the previous month
+		month := cal.MonthOf(bucket)
+		return fmt.Sprintf("%s %d", month.Name, month.From.AddDate(0, 0, 14).Year())
+	default:
+		return bucket.Format("2006-01-02")
+	}
+}
 
-		for rows.Next() {
-			var label string
-			var sales int64
-			if err := rows.Scan(&label, &sales); err != nil {
-				rows.Close()
-				return nil, err
-			}
-			dataPoints = append(dataPoints, TimePoint{
-				Label: label,
-				Value: sales,
-			})
-		}
-		rows.Close()
+// getProvincialComparison returns time series data for each province
+func getProvincialComparison(cal fiscal.Calendar, granularity string, provinces []repository.ProvinceRef, buckets []repository.BucketTotal) []ProvinceTimeSeries {
+	var result []ProvinceTimeSeries
+
+	// Buckets come ordered by time, so each series is in order too
+	dataPoints := make(map[string][]TimePoint)
+	for _, bucket := range buckets {
+		dataPoints[bucket.ProvinceUUID] = append(dataPoints[bucket.ProvinceUUID], TimePoint{
+			Label: bucketLabel(cal, granularity, bucket.Bucket),
+			Value: bucket.Total,
+		})
+	}
 
+	for _, province := range provinces {
 		result = append(result, ProvinceTimeSeries{
 			ProvinceUUID: province.UUID,
 			ProvinceName: province.Name,
-			DataPoints:   dataPoints,
+			DataPoints:   dataPoints[province.UUID],
 		})
 	}
 
-	return result, nil
+	return result
 }
 
 // getContributionData returns stacked area chart data showing each province's contribution over time
-func getContributionData(dateRange DateRange, granularity string, provinceUUIDs []string) ([]ContributionPoint, error) {
-	db := database.DB
+func getContributionData(cal fiscal.Calendar, granularity string, provinces []repository.ProvinceRef, buckets []repository.BucketTotal) []ContributionPoint {
 	var result []ContributionPoint
 
-	// Get provinces based on filter
-	var provinces []models.Province
-	provinceQuery := db.Model(&models.Province{})
-	if len(provinceUUIDs) > 0 {
-		provinceQuery = provinceQuery.Where("uuid IN ?", provinceUUIDs)
-	}
-	if err := provinceQuery.Find(&provinces).Error; err != nil {
-		return nil, err
-	}
-
 	// Create a map for quick province lookup
 	provinceMap := make(map[string]string)
 	for _, p := range provinces {
 		provinceMap[p.UUID] = p.Name
 	}
 
-	// Build query based on granularity
-	var query string
-	var args []interface{}
-
-	provinceFilter := ""
-	if len(provinceUUIDs) > 0 {
-		provinceFilter = "AND province_uuid IN ?"
-	}
-
-	switch granularity {
-	case "daily":
-		query = `
-			SELECT 
-				DATE(created_at) as date,
-				province_uuid,
-				COALESCE(SUM(quantity), 0) as sales
-			FROM sales 
-			WHERE created_at BETWEEN ? AND ? ` + provinceFilter + `
-			GROUP BY DATE(created_at), province_uuid
-			ORDER BY DATE(created_at), province_uuid
-		`
-		if len(provinceUUIDs) > 0 {
-			args = []interface{}{dateRange.StartDate, dateRange.EndDate, provinceUUIDs}
-		} else {
-			args = []interface{}{dateRange.StartDate, dateRange.EndDate}
-		}
-
-	case "weekly":
-		query = `
-			SELECT 
-				DATE_TRUNC('week', created_at) as date,
-				province_uuid,
-				COALESCE(SUM(quantity), 0) as sales
-			FROM sales 
-			WHERE created_at BETWEEN ? AND ? ` + provinceFilter + `
-			GROUP BY DATE_TRUNC('week', created_at), province_uuid
-			ORDER BY DATE_TRUNC('week', created_at), province_uuid
-		`
-		if len(provinceUUIDs) > 0 {
-			args = []interface{}{dateRange.StartDate, dateRange.EndDate, provinceUUIDs}
-		} else {
-			args = []interface{}{dateRange.StartDate, dateRange.EndDate}
-		}
-
-	case "monthly":
-		query = `
-			SELECT 
-				DATE_TRUNC('month', created_at) as date,
-				province_uuid,
-				COALESCE(SUM(quantity), 0) as sales
-			FROM sales 
-			WHERE created_at BETWEEN ? AND ? ` + provinceFilter + `
-			GROUP BY DATE_TRUNC('month', created_at), province_uuid
-			ORDER BY DATE_TRUNC('month', created_at), province_uuid
-		`
-		if len(provinceUUIDs) > 0 {
-			args = []interface{}{dateRange.StartDate, dateRange.EndDate, provinceUUIDs}
-		} else {
-			args = []interface{}{dateRange.StartDate, dateRange.EndDate}
-		}
-	}
-
-	rows, err := db.Raw(query, args...).Rows()
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
 	// Group results by time period
 	contributionMap := make(map[string]*ContributionPoint)
-	for rows.Next() {
-		var date time.Time
-		var provinceUUID string
-		var sales int64
-
-		if err := rows.Scan(&date, &provinceUUID, &sales); err != nil {
-			return nil, err
-		}
-
-		// Create label based on granularity
-		var label string
-		switch granularity {
-		case "daily":
-			label = date.Format("2006-01-02")
-		case "weekly":
-			label = fmt.Sprintf("Week %d", getWeekNumber(date))
-		case "monthly":
-			label = date.Format("Jan 2006")
-		}
+	for _, bucket := range buckets {
+		label := bucketLabel(cal, granularity, bucket.Bucket)
 
 		// Get or create contribution point for this time period
 		if contributionMap[label] == nil {
 			contributionMap[label] = &ContributionPoint{
 				Label:     label,
-				Timestamp: date,
+				Timestamp: bucket.Bucket,
 				Provinces: []ProvinceContribution{},
 				Total:     0,
 			}
 		}
 
 		contributionMap[label].Provinces = append(contributionMap[label].Provinces, ProvinceContribution{
-			ProvinceUUID: provinceUUID,
-			ProvinceName: provinceMap[provinceUUID],
-			Sales:        sales,
+			ProvinceUUID: bucket.ProvinceUUID,
+			ProvinceName: provinceMap[bucket.ProvinceUUID],
+			Sales:        bucket.Total,
 		})
-		contributionMap[label].Total += sales
+		contributionMap[label].Total += bucket.Total
 	}
 
 	// Calculate percentages and convert map to slice
@@ -384,38 +291,28 @@ func getContributionData(dateRange DateRange, granularity string, provinceUUIDs
 	}
 
 	// Sort by timestamp
-	for i := 0; i < len(result); i++ {
-		for j := i + 1; j < len(result); j++ {
-			if result[i].Timestamp.After(result[j].Timestamp) {
-				result[i], result[j] = result[j], result[i]
-			}
-		}
-	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Timestamp.Before(result[j].Timestamp)
+	})
 
-	return result, nil
+	return result
 }
 
 // getIntraDayPattern returns heatmap data showing average sales by time of day for each province
-func getIntraDayPattern(dateRange DateRange, provinceUUIDs []string) ([]IntraDayHeatmap, error) {
-	db := database.DB
+func (ctl *Controller) getIntraDayPattern(current repository.TimeRange, provinces []repository.ProvinceRef, provinceUUIDs []string) ([]IntraDayHeatmap, error) {
 	var result []IntraDayHeatmap
 
-	// Get provinces based on filter
-	var provinces []models.Province
-	provinceQuery := db.Model(&models.Province{})
-	if len(provinceUUIDs) > 0 {
-		provinceQuery = provinceQuery.Where("uuid IN ?", provinceUUIDs)
-	}
-	if err := provinceQuery.Find(&provinces).Error; err != nil {
+	averages, err := ctl.Dashboard.SlotAverages(current, provinceUUIDs)
+	if err != nil {
 		return nil, err
 	}
 
-	// Time slots: 8am (6-10), 12pm (10-14), 3pm (14-18), 8pm (18-22)
-	timeSlots := map[string][]int{
-		"8am":  {6, 10},
-		"12pm": {10, 14},
-		"3pm":  {14, 18},
-		"8pm":  {18, 22},
+	slotAverages := make(map[string]map[int]float64)
+	for _, average := range averages {
+		if slotAverages[average.ProvinceUUID] == nil {
+			slotAverages[average.ProvinceUUID] = make(map[int]float64)
+		}
+		slotAverages[average.ProvinceUUID][average.Slot] = average.Average
 	}
 
 	for _, province := range provinces {
@@ -425,25 +322,9 @@ func getIntraDayPattern(dateRange DateRange, provinceUUIDs []string) ([]IntraDay
 			TimeSlots:    make(map[string]float64),
 		}
 
-		// For each time slot, calculate average sales
-		for slotName, hours := range timeSlots {
-			var avgSales float64
-			err := db.Raw(`
-				SELECT COALESCE(AVG(quantity), 0)
-				FROM sales
-				WHERE province_uuid = ?
-					AND created_at BETWEEN ? AND ?
-					AND EXTRACT(HOUR FROM created_at) >= ?
-					AND EXTRACT(HOUR FROM created_at) < ?
-			`, province.UUID, dateRange.StartDate, dateRange.EndDate, hours[0], hours[1]).
-				Row().
-				Scan(&avgSales)
-
-			if err != nil {
-				return nil, err
-			}
-
-			heatmap.TimeSlots[slotName] = avgSales
+		// Slots without sales average to 0
+		for i, slot := range repository.TimeSlots {
+			heatmap.TimeSlots[slot.Name] = slotAverages[province.UUID][i]
 		}
 
 		result = append(result, heatmap)
@@ -452,45 +333,34 @@ func getIntraDayPattern(dateRange DateRange, provinceUUIDs []string) ([]IntraDay
 	return result, nil
 }
 
-// Helper function to get week number from date
-func getWeekNumber(date time.Time) int {
-	_, week := date.ISOWeek()
-	return week
-}
-
 // getProvinceTargetsWithAchievement fetches targets and calculates achievement percentage
-func getProvinceTargetsWithAchievement(dateRange DateRange, provinceUUIDs []string) ([]ProvinceTarget, error) {
-	db := database.DB
+func (ctl *Controller) getProvinceTargetsWithAchievement(cal fiscal.Calendar, dateRange DateRange, provinces []repository.ProvinceRef, provinceUUIDs []string) ([]ProvinceTarget, error) {
 	var result []ProvinceTarget
 
 	// Get targets from Year/Month/Week tables
-	targets, err := getTargetsForDateRange(dateRange, provinceUUIDs)
+	targets, err := ctl.getTargetsForDateRange(cal, dateRange, provinceUUIDs)
 	if err != nil {
 		return nil, err
 	}
 
 	// Get actual sales for each province
-	var provinces []models.Province
-	provinceQuery := db.Model(&models.Province{})
-	if len(provinceUUIDs) > 0 {
-		provinceQuery = provinceQuery.Where("uuid IN ?", provinceUUIDs)
+	totals, err := ctl.Dashboard.ProvinceTotals(repository.TimeRange{From: dateRange.StartDate, To: dateRange.EndDate}, provinceUUIDs)
+	if err != nil {
+		return nil, err
+	}
+	actual := make(map[string]int64, len(totals))
+	for _, total := range totals {
+		actual[total.UUID] = total.Total
 	}
-	if err := provinceQuery.Find(&provinces).Error; err != nil {
+
+	// Sales still expected before the end of the range
+	remaining, err := ctl.remainingSales(dateRange.StartDate, dateRange.EndDate, provinceUUIDs)
+	if err != nil {
 		return nil, err
 	}
 
 	for _, province := range provinces {
-		var actualSales int64
-		err := db.Model(&models.Sale{}).
-			Where("province_uuid = ? AND created_at BETWEEN ? AND ?",
-				province.UUID, dateRange.StartDate, dateRange.EndDate).
-			Select("COALESCE(SUM(quantity), 0)").
-			Row().
-			Scan(&actualSales)
-
-		if err != nil {
-			continue
-		}
+		actualSales := actual[province.UUID]
 
 		target := targets[province.UUID]
 		var achievement float64
@@ -498,12 +368,15 @@ func getProvinceTargetsWithAchievement(dateRange DateRange, provinceUUIDs []stri
 			achievement = float64(actualSales) / float64(target) * 100
 		}
 
+		projected := float64(actualSales) + remaining[province.UUID]
 		result = append(result, ProvinceTarget{
-			ProvinceUUID: province.UUID,
-			ProvinceName: province.Name,
-			Target:       target,
-			Actual:       actualSales,
-			Achievement:  achievement,
+			ProvinceUUID:         province.UUID,
+			ProvinceName:         province.Name,
+			Target:               target,
+			Actual:               actualSales,
+			Achievement:          achievement,
+			Projected:            projected,
+			ProjectedAchievement: achievementOf(projected, target),
 		})
 	}
 
@@ -1,11 +1,10 @@
 package dashboard
 
 import (
-	"strconv"
 	"time"
 
-	"github.com/Danny19977/sr-api/database"
-	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/fiscal"
+	"github.com/Danny19977/sr-api/repository"
 )
 
 // TargetData represents aggregated target information
@@ -15,330 +14,119 @@ type TargetData struct {
 	Period       string // For identification (year, month, week)
 }
 
-// getYearlyTargets fetches yearly targets for provinces within a year
-func getYearlyTargets(year int, provinceUUIDs []string) (map[string]int64, error) {
-	db := database.DB
+// distributeYearlyTarget splits a yearly target equally among provinces
+func distributeYearlyTarget(yearlyTarget int64, provinces []repository.ProvinceRef) map[string]int64 {
 	targets := make(map[string]int64)
-
-	yearStr := strconv.Itoa(year)
-
-	// Query Year table to get the yearly target
-	var yearRecord models.Year
-	result := db.Model(&models.Year{}).
-		Where("year = ?", yearStr).
-		Limit(1).
-		Find(&yearRecord)
-
-	if result.RowsAffected == 0 {
-		// Silently return empty map if no year record exists
-		return targets, nil
+	if len(provinces) == 0 {
+		return targets
 	}
 
-	// Convert quantity string to int64
-	yearlyTarget, err := strconv.ParseInt(yearRecord.Quantity, 10, 64)
-	if err != nil {
-		// Return empty map if quantity is invalid
-		return targets, nil
+	// Distribute yearly target equally among provinces (or use another strategy)
+	targetPerProvince := yearlyTarget / int64(len(provinces))
+	for _, province := range provinces {
+		targets[province.UUID] = targetPerProvince
 	}
+	return targets
+}
 
-	// If no province filter, return the global yearly target for all provinces
-	if len(provinceUUIDs) == 0 {
-		// Get all provinces and distribute target
-		var provinces []models.Province
-		if err := db.Find(&provinces).Error; err != nil {
-			return targets, nil
-		}
-
-		if len(provinces) == 0 {
-			return targets, nil
-		}
-
-		// Distribute yearly target equally among provinces (or use another strategy)
-		targetPerProvince := yearlyTarget / int64(len(provinces))
-		for _, province := range provinces {
-			targets[province.UUID] = targetPerProvince
-		}
-	} else {
-		// Distribute target among filtered provinces
-		if len(provinceUUIDs) > 0 {
-			targetPerProvince := yearlyTarget / int64(len(provinceUUIDs))
-			for _, uuid := range provinceUUIDs {
-				targets[uuid] = targetPerProvince
-			}
-		}
+// fiscalPeriods returns the fiscal weeks or months of cal overlapping
+// dateRange, its end day included
+func fiscalPeriods(cal fiscal.Calendar, period string, dateRange DateRange) []fiscal.Period {
+	to := dateRange.EndDate.AddDate(0, 0, 1)
+	if period == "month" {
+		return cal.MonthsBetween(dateRange.StartDate, to)
 	}
+	return cal.Weeks(dateRange.StartDate, to)
+}
 
-	return targets, nil
-} // getMonthlyTargets fetches monthly targets for provinces within a date range
-func getMonthlyTargets(dateRange DateRange, provinceUUIDs []string) (map[string]int64, error) {
-	db := database.DB
-	targets := make(map[string]int64)
-
-	// Extract year and months from date range
-	startYear := dateRange.StartDate.Year()
-	endYear := dateRange.EndDate.Year()
-	startMonth := int(dateRange.StartDate.Month())
-	endMonth := int(dateRange.EndDate.Month())
-
-	// Get all months within the date range
-	monthNames := []string{"January", "February", "March", "April", "May", "June",
-		"July", "August", "September", "October", "November", "December"}
-
-	// Build query for month records
-	query := db.Model(&models.Month{})
-
-	// Add province filter if provided
-	if len(provinceUUIDs) > 0 {
-		query = query.Where("province_uuid IN ?", provinceUUIDs)
+// fiscalMonthTargets numbers month target rows by their month in the fiscal
+// year of cal instead of the calendar month they are named after
+func fiscalMonthTargets(cal fiscal.Calendar, rows []repository.TargetRow) []repository.TargetRow {
+	for i := range rows {
+		rows[i].Period = cal.MonthIndex(time.Month(rows[i].Period))
 	}
+	return rows
+}
 
-	var monthRecords []models.Month
-	err := query.Find(&monthRecords).Error
-	if err != nil {
-		// Return empty map if query fails
-		return targets, nil
+// sumPeriodTargets adds up the target rows of periods by province. Targets
+// not linked to a year count for the period of that number in every year.
+func sumPeriodTargets(rows []repository.TargetRow, periods []fiscal.Period) map[string]int64 {
+	type yearPeriod struct{ year, index int }
+	included := make(map[yearPeriod]bool, 2*len(periods))
+	for _, p := range periods {
+		included[yearPeriod{p.Year, p.Index}] = true
+		included[yearPeriod{0, p.Index}] = true
 	}
 
-	// Aggregate targets by province
-	for _, monthRecord := range monthRecords {
-		// Parse month name to check if it's in our date range
-		monthIndex := -1
-		for i, name := range monthNames {
-			if monthRecord.Month == name {
-				monthIndex = i + 1
-				break
-			}
-		}
-
-		if monthIndex == -1 {
-			continue
-		}
-
-		// Check if this month falls within our date range
-		// This is a simplified check - you may need more sophisticated logic
-		if startYear == endYear {
-			if monthIndex >= startMonth && monthIndex <= endMonth {
-				quantity, err := strconv.ParseInt(monthRecord.Quantity, 10, 64)
-				if err != nil {
-					continue
-				}
-				targets[monthRecord.ProvinceUUID] += quantity
-			}
-		} else {
-			// Handle multi-year ranges
-			quantity, err := strconv.ParseInt(monthRecord.Quantity, 10, 64)
-			if err != nil {
-				continue
-			}
-			targets[monthRecord.ProvinceUUID] += quantity
+	targets := make(map[string]int64)
+	for _, row := range rows {
+		if included[yearPeriod{row.Year, row.Period}] {
+			targets[row.ProvinceUUID] += row.Target
 		}
 	}
-
-	return targets, nil
+	return targets
 }
 
-// getWeeklyTargets fetches weekly targets for provinces within a date range
-func getWeeklyTargets(dateRange DateRange, provinceUUIDs []string) (map[string]int64, error) {
-	db := database.DB
-	targets := make(map[string]int64)
-
-	// Build query for week records
-	query := db.Model(&models.Week{})
-
-	// Add province filter if provided
-	if len(provinceUUIDs) > 0 {
-		query = query.Where("province_uuid IN ?", provinceUUIDs)
-	}
-
-	var weekRecords []models.Week
-	err := query.Find(&weekRecords).Error
+// getMonthlyTargets fetches the targets of the fiscal months overlapping a
+// date range for provinces
+func (ctl *Controller) getMonthlyTargets(cal fiscal.Calendar, dateRange DateRange, provinceUUIDs []string) (map[string]int64, error) {
+	monthRecords, err := ctl.Dashboard.MonthlyTargets(nil, provinceUUIDs)
 	if err != nil {
 		// Return empty map if query fails
-		return targets, nil
+		return make(map[string]int64), nil
 	}
+	return sumPeriodTargets(fiscalMonthTargets(cal, monthRecords), fiscalPeriods(cal, "month", dateRange)), nil
+}
 
-	// Aggregate targets by province
-	// Note: You may want to filter by week number based on date range
-	for _, weekRecord := range weekRecords {
-		quantity, err := strconv.ParseInt(weekRecord.Quantity, 10, 64)
-		if err != nil {
-			continue
-		}
-		targets[weekRecord.ProvinceUUID] += quantity
+// getWeeklyTargets fetches the targets of the fiscal weeks overlapping a date
+// range for provinces
+func (ctl *Controller) getWeeklyTargets(cal fiscal.Calendar, dateRange DateRange, provinceUUIDs []string) (map[string]int64, error) {
+	weekRecords, err := ctl.Dashboard.WeeklyTargets(nil, provinceUUIDs)
+	if err != nil {
+		// Return empty map if query fails
+		return make(map[string]int64), nil
 	}
-
-	return targets, nil
+	return sumPeriodTargets(weekRecords, fiscalPeriods(cal, "week", dateRange)), nil
 }
 
 // getTargetsForDateRange fetches appropriate targets based on date range duration
 // Automatically selects yearly, monthly, or weekly targets based on the time span
-func getTargetsForDateRange(dateRange DateRange, provinceUUIDs []string) (map[string]int64, error) {
+func (ctl *Controller) getTargetsForDateRange(cal fiscal.Calendar, dateRange DateRange, provinceUUIDs []string) (map[string]int64, error) {
 	duration := dateRange.EndDate.Sub(dateRange.StartDate)
 
 	// For ranges > 90 days, use monthly targets
 	if duration > 90*24*time.Hour {
-		return getMonthlyTargets(dateRange, provinceUUIDs)
+		return ctl.getMonthlyTargets(cal, dateRange, provinceUUIDs)
 	}
 
 	// For ranges > 31 days, use weekly targets
 	if duration > 31*24*time.Hour {
-		return getWeeklyTargets(dateRange, provinceUUIDs)
+		return ctl.getWeeklyTargets(cal, dateRange, provinceUUIDs)
 	}
 
 	// For shorter ranges, use weekly targets
-	return getWeeklyTargets(dateRange, provinceUUIDs)
+	return ctl.getWeeklyTargets(cal, dateRange, provinceUUIDs)
 }
 
-// getMonthlyTargetByProvince fetches the target for a specific province and month
-func getMonthlyTargetByProvince(provinceUUID string, year int, monthNum int) (int64, error) {
-	db := database.DB
-
-	monthNames := []string{"January", "February", "March", "April", "May", "June",
-		"July", "August", "September", "October", "November", "December"}
-
-	if monthNum < 1 || monthNum > 12 {
-		return 0, nil
-	}
-
-	monthName := monthNames[monthNum-1]
-
-	// Get year record first
-	yearStr := strconv.Itoa(year)
-	var yearRecord models.Year
-	result := db.Model(&models.Year{}).
-		Where("year = ?", yearStr).
-		Limit(1).
-		Find(&yearRecord)
-
-	if result.RowsAffected == 0 {
-		// Silently return 0 if no year record exists
-		return 0, nil
-	}
-
-	// Get month record
-	var monthRecord models.Month
-	result = db.Model(&models.Month{}).
-		Where("province_uuid = ? AND month = ? AND year_uuid = ?",
-			provinceUUID, monthName, yearRecord.UUID).
-		Limit(1).
-		Find(&monthRecord)
-
-	if result.RowsAffected == 0 {
-		// Silently return 0 if no month target found
-		return 0, nil
-	}
-
-	// Convert quantity string to int64
-	target, err := strconv.ParseInt(monthRecord.Quantity, 10, 64)
-	if err != nil {
-		// Return 0 if quantity is invalid
-		return 0, nil
-	}
-
-	return target, nil
-}
-
-// getWeeklyTargetByProvince fetches the target for a specific province and week
-func getWeeklyTargetByProvince(provinceUUID string, year int, weekNum int) (int64, error) {
-	db := database.DB
-
-	// Get year record first
-	yearStr := strconv.Itoa(year)
-	var yearRecord models.Year
-	result := db.Model(&models.Year{}).
-		Where("year = ?", yearStr).
-		Limit(1).
-		Find(&yearRecord)
-
-	if result.RowsAffected == 0 {
-		// Silently return 0 if no year record exists
-		return 0, nil
-	}
-
-	weekStr := strconv.Itoa(weekNum)
-
-	// Get week record
-	var weekRecord models.Week
-	result = db.Model(&models.Week{}).
-		Where("province_uuid = ? AND week = ? AND year_uuid = ?",
-			provinceUUID, weekStr, yearRecord.UUID).
-		Limit(1).
-		Find(&weekRecord)
-
-	if result.RowsAffected == 0 {
-		// Silently return 0 if no week target found
-		return 0, nil
-	}
-
-	// Convert quantity string to int64
-	target, err := strconv.ParseInt(weekRecord.Quantity, 10, 64)
-	if err != nil {
-		// Return 0 if quantity is invalid
-		return 0, nil
-	}
-
-	return target, nil
-}
-
-// getQuarterlyTargets fetches quarterly targets (sum of 3 months) for provinces
-func getQuarterlyTargets(year int, quarter int, provinceUUIDs []string) (map[string]int64, error) {
-	db := database.DB
+// getQuarterlyTargets fetches the targets of a quarter of a fiscal year (sum
+// of 3 months) for provinces
+func (ctl *Controller) getQuarterlyTargets(cal fiscal.Calendar, year int, quarter int, provinceUUIDs []string) (map[string]int64, error) {
 	targets := make(map[string]int64)
-
-	// Define quarter months
-	quarterMonths := map[int][]int{
-		1: {1, 2, 3},
-		2: {4, 5, 6},
-		3: {7, 8, 9},
-		4: {10, 11, 12},
-	}
-
-	months := quarterMonths[quarter]
-	monthNames := []string{"January", "February", "March", "April", "May", "June",
-		"July", "August", "September", "October", "November", "December"}
-
-	// Get year record
-	yearStr := strconv.Itoa(year)
-	var yearRecord models.Year
-	result := db.Model(&models.Year{}).
-		Where("year = ?", yearStr).
-		Limit(1).
-		Find(&yearRecord)
-
-	if result.RowsAffected == 0 {
+	if quarter < 1 || quarter > 4 {
 		return targets, nil
 	}
 
-	// Build query for the 3 months in the quarter
-	query := db.Model(&models.Month{}).
-		Where("year_uuid = ?", yearRecord.UUID)
-
-	// Filter by provinces if provided
-	if len(provinceUUIDs) > 0 {
-		query = query.Where("province_uuid IN ?", provinceUUIDs)
-	}
-
-	// Filter by quarter months
-	quarterMonthNames := []string{
-		monthNames[months[0]-1],
-		monthNames[months[1]-1],
-		monthNames[months[2]-1],
-	}
-	query = query.Where("month IN ?", quarterMonthNames)
-
-	var monthRecords []models.Month
-	err := query.Find(&monthRecords).Error
+	monthRecords, err := ctl.Dashboard.MonthlyTargets([]int{year}, provinceUUIDs)
 	if err != nil {
 		return targets, nil
 	}
 
-	// Aggregate targets by province
-	for _, monthRecord := range monthRecords {
-		quantity, err := strconv.ParseInt(monthRecord.Quantity, 10, 64)
-		if err != nil {
-			continue
+	// Aggregate the 3 months of the quarter by province
+	firstMonth := (quarter-1)*3 + 1
+	for _, monthRecord := range fiscalMonthTargets(cal, monthRecords) {
+		if monthRecord.Period >= firstMonth && monthRecord.Period < firstMonth+3 {
+			targets[monthRecord.ProvinceUUID] += monthRecord.Target
 		}
-		targets[monthRecord.ProvinceUUID] += quantity
 	}
 
 	return targets, nil
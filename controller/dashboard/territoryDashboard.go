@@ -0,0 +1,193 @@
+package dashboard
+
+import (
+	"slices"
+	"time"
+
+	"github.com/Danny19977/sr-api/fiscal"
+	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/repository"
+	"github.com/Danny19977/sr-api/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// TerritoryRollup is what a node of the territory tree and the nodes below
+// it sold over a date range
+type TerritoryRollup struct {
+	UUID        string  `json:"uuid"`
+	Name        string  `json:"name"`
+	Level       string  `json:"level"`
+	Total       int64   `json:"total"`
+	Target      int64   `json:"target"`
+	Achievement float64 `json:"achievement"` // Percentage of the target
+}
+
+type TerritoryRollupResponse struct {
+	DateRange DateRange `json:"date_range"`
+	// Territory is the node drilled into, nil at the top of the tree
+	Territory *TerritoryRollup   `json:"territory"`
+	Ancestors []models.Territory `json:"ancestors"` // The root first
+	Children  []TerritoryRollup  `json:"children"`
+}
+
+// territoryProvinces returns the provinces of requested, every province when
+// empty, that lie in a territory. A territory without any matches no province.
+func (ctl *Controller) territoryProvinces(territoryUUID string, requested []string) []string {
+	provinces, err := ctl.Territories.Provinces(territoryUUID)
+	if err != nil {
+		provinces = nil
+	}
+	if len(requested) > 0 {
+		provinces = slices.DeleteFunc(provinces, func(uuid string) bool {
+			return !slices.Contains(requested, uuid)
+		})
+	}
+	if len(provinces) == 0 {
+		return []string{""}
+	}
+	return provinces
+}
+
+// asmTerritory returns the node an ASM caller is restricted to, their
+// territory or else their province, and whether the caller is an ASM
+func (ctl *Controller) asmTerritory(c *fiber.Ctx) (string, bool) {
+	userUUID, _ := utils.GetUserUUIDFromToken(c)
+	user, err := ctl.Users.FindByUUID(userUUID)
+	if err != nil || user.Role != "ASM" {
+		return "", false
+	}
+	if user.TerritoryUUID != nil {
+		return *user.TerritoryUUID, true
+	}
+	if user.ProvinceUUID != nil {
+		return *user.ProvinceUUID, true
+	}
+	return "", true
+}
+
+// GetTerritoryRollup rolls the sales and month targets up to the node of the
+// territory_uuid query and each of its children, the countries when unset.
+// An ASM drills down from their own territory only.
+func (ctl *Controller) GetTerritoryRollup(c *fiber.Ctx) error {
+	territoryUUID := c.Query("territory_uuid")
+
+	scope, isASM := ctl.asmTerritory(c)
+	if isASM && territoryUUID == "" {
+		territoryUUID = scope
+	}
+
+	var territory *models.Territory
+	var ancestors []models.Territory
+	var provinceUUIDs []string
+	if territoryUUID != "" {
+		var err error
+		if territory, err = ctl.Territories.Find(territoryUUID); err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": "Territory not found",
+				"error":   err.Error(),
+			})
+		}
+		if ancestors, err = ctl.Territories.Ancestors(territory.UUID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Error fetching territory rollup",
+				"error":   err.Error(),
+			})
+		}
+		provinceUUIDs = ctl.territoryProvinces(territory.UUID, nil)
+	}
+	if isASM && (territory == nil || territory.UUID != scope && !slices.ContainsFunc(ancestors, func(t models.Territory) bool { return t.UUID == scope })) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": "Territory outside your scope",
+			"error":   "an ASM only sees their own territory and the territories below it",
+		})
+	}
+
+	cal, err := ctl.Dashboard.Calendar(provinceUUIDs)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Error fetching territory rollup",
+			"error":   err.Error(),
+		})
+	}
+	startDate, endDate := c.Query("start_date"), c.Query("end_date")
+	if startDate == "" || endDate == "" {
+		// Default to the current fiscal month if no date range provided
+		now := time.Now()
+		startDate = cal.MonthOf(now).From.Format("2006-01-02")
+		endDate = now.Format("2006-01-02")
+	}
+	dateRange, err := parseDateRange(startDate, endDate)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid date range",
+			"error":   err.Error(),
+		})
+	}
+
+	query := dashboardQuery{
+		endpoint:  "territory",
+		params:    map[string]string{"territory_uuid": territoryUUID, "start_date": startDate, "end_date": endDate},
+		provinces: provinceUUIDs,
+		from:      dateRange.StartDate,
+		to:        dateRange.EndDate,
+	}
+	return ctl.respond(c, query, "Error fetching territory rollup", func() (interface{}, error) {
+		return ctl.getTerritoryRollup(cal, dateRange, territory, ancestors)
+	})
+}
+
+func (ctl *Controller) getTerritoryRollup(cal fiscal.Calendar, dateRange DateRange, territory *models.Territory, ancestors []models.Territory) (TerritoryRollupResponse, error) {
+	response := TerritoryRollupResponse{DateRange: dateRange, Ancestors: ancestors}
+
+	parentUUID := ""
+	if territory != nil {
+		parentUUID = territory.UUID
+	}
+	children, err := ctl.Territories.Children(parentUUID)
+	if err != nil {
+		return response, err
+	}
+
+	nodes := children
+	if territory != nil {
+		nodes = append([]models.Territory{*territory}, children...)
+	}
+	uuids := make([]string, len(nodes))
+	for i, node := range nodes {
+		uuids[i] = node.UUID
+	}
+
+	rg := repository.TimeRange{From: dateRange.StartDate, To: dateRange.EndDate.AddDate(0, 0, 1).Add(-time.Microsecond)}
+	totalRows, err := ctl.Territories.Totals(rg, uuids)
+	if err != nil {
+		return response, err
+	}
+	totals := make(map[string]int64, len(totalRows))
+	for _, row := range totalRows {
+		totals[row.TerritoryUUID] = row.Total
+	}
+	targetRows, err := ctl.Territories.MonthlyTargets(uuids)
+	if err != nil {
+		return response, err
+	}
+	targets := sumPeriodTargets(fiscalMonthTargets(cal, targetRows), fiscalPeriods(cal, "month", dateRange))
+
+	rollups := make([]TerritoryRollup, len(nodes))
+	for i, node := range nodes {
+		rollups[i] = TerritoryRollup{
+			UUID:        node.UUID,
+			Name:        node.Name,
+			Level:       node.Level,
+			Total:       totals[node.UUID],
+			Target:      targets[node.UUID],
+			Achievement: achievementOf(float64(totals[node.UUID]), targets[node.UUID]),
+		}
+	}
+
+	if territory != nil {
+		response.Territory = &rollups[0]
+		rollups = rollups[1:]
+	}
+	response.Children = rollups
+	return response, nil
+}
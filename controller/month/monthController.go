@@ -3,17 +3,15 @@ package month
 import (
 	"strconv"
 
-	"github.com/Danny19977/sr-api/database"
 	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/repository"
 	"github.com/Danny19977/sr-api/utils"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 )
 
 // Paginate Months
-func GetPaginatedMonth(c *fiber.Ctx) error {
-	db := database.DB
-
+func (ctl *Controller) GetPaginatedMonth(c *fiber.Ctx) error {
 	page, err := strconv.Atoi(c.Query("page", "1"))
 	if err != nil || page <= 0 {
 		page = 1
@@ -26,22 +24,17 @@ func GetPaginatedMonth(c *fiber.Ctx) error {
 
 	search := c.Query("search", "")
 
-	var dataList []models.Month
-	var totalRecords int64
+	opts := repository.ListOptions{Search: search, Offset: offset, Limit: limit}
 
 	userUUID, _ := utils.GetUserUUIDFromToken(c)
-	var requestingUser models.User
-	database.DB.Where("uuid = ?", userUUID).First(&requestingUser)
-
-	query := db.Model(&models.Month{})
-	if requestingUser.Role == "ASM" {
-		query = query.Where("province_uuid = ?", requestingUser.ProvinceUUID)
+	if requestingUser, err := ctl.Users.FindByUUID(userUUID); err == nil && requestingUser.Role == "ASM" {
+		opts.ProvinceUUID = requestingUser.ProvinceUUID
+		if opts.ProvinceUUID == nil {
+			opts.ProvinceUUID = new(string)
+		}
 	}
-	query = query.Where("month ILIKE ?", "%"+search+"%")
-	query.Count(&totalRecords)
 
-	query = query.Offset(offset).Limit(limit).Order("updated_at DESC")
-	err = query.Preload("Country").Preload("Province").Find(&dataList).Error
+	dataList, totalRecords, err := ctl.Targets.ListMonths(opts)
 
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
@@ -68,10 +61,8 @@ func GetPaginatedMonth(c *fiber.Ctx) error {
 }
 
 // Get All Months
-func GetAllMonths(c *fiber.Ctx) error {
-	db := database.DB
-	var data []models.Month
-	db.Preload("Country").Preload("Province").Find(&data)
+func (ctl *Controller) GetAllMonths(c *fiber.Ctx) error {
+	data, _ := ctl.Targets.AllMonths()
 	return c.JSON(fiber.Map{
 		"status":  "success",
 		"message": "All months support",
@@ -80,12 +71,10 @@ func GetAllMonths(c *fiber.Ctx) error {
 }
 
 // Get one Month by UUID
-func GetMonth(c *fiber.Ctx) error {
+func (ctl *Controller) GetMonth(c *fiber.Ctx) error {
 	uuid := c.Params("uuid")
-	db := database.DB
-	var month models.Month
-	db.Preload("Country").Preload("Province").Where("uuid = ?", uuid).First(&month)
-	if month.Month == "" {
+	month, err := ctl.Targets.FindMonth(uuid)
+	if err != nil {
 		return c.Status(404).JSON(
 			fiber.Map{
 				"status":  "error",
@@ -104,12 +93,10 @@ func GetMonth(c *fiber.Ctx) error {
 }
 
 // Get one Month by month string
-func GetMonthByMonthString(c *fiber.Ctx) error {
+func (ctl *Controller) GetMonthByMonthString(c *fiber.Ctx) error {
 	monthStr := c.Params("month")
-	db := database.DB
-	var month models.Month
-	db.Preload("Country").Preload("Province").Where("month = ?", monthStr).First(&month)
-	if month.Month == "" {
+	month, err := ctl.Targets.FindMonthByName(monthStr)
+	if err != nil {
 		return c.Status(404).JSON(
 			fiber.Map{
 				"status":  "error",
@@ -128,7 +115,7 @@ func GetMonthByMonthString(c *fiber.Ctx) error {
 }
 
 // Create Month
-func CreateMonth(c *fiber.Ctx) error {
+func (ctl *Controller) CreateMonth(c *fiber.Ctx) error {
 	p := &models.Month{}
 
 	if err := c.BodyParser(&p); err != nil {
@@ -136,7 +123,7 @@ func CreateMonth(c *fiber.Ctx) error {
 	}
 
 	p.UUID = uuid.New().String()
-	database.DB.Create(p)
+	ctl.Targets.CreateMonth(p)
 
 	return c.JSON(
 		fiber.Map{
@@ -148,9 +135,8 @@ func CreateMonth(c *fiber.Ctx) error {
 }
 
 // Update Month
-func UpdateMonth(c *fiber.Ctx) error {
+func (ctl *Controller) UpdateMonth(c *fiber.Ctx) error {
 	uuid := c.Params("uuid")
-	db := database.DB
 
 	type UpdateData struct {
 		UUID         string `json:"uuid"`
@@ -176,8 +162,16 @@ func UpdateMonth(c *fiber.Ctx) error {
 		)
 	}
 
-	month := new(models.Month)
-	db.Where("uuid = ?", uuid).First(&month)
+	month, err := ctl.Targets.FindMonth(uuid)
+	if err != nil {
+		return c.Status(404).JSON(
+			fiber.Map{
+				"status":  "error",
+				"message": "No Month found",
+				"data":    nil,
+			},
+		)
+	}
 	month.Month = updateData.Month
 	month.Quantity = updateData.Quantity
 	month.Role = updateData.Role
@@ -186,7 +180,7 @@ func UpdateMonth(c *fiber.Ctx) error {
 	month.ProductUUID = updateData.ProductUUID
 	month.YearUUID = updateData.YearUUID
 	month.Signature = updateData.Signature
-	db.Save(&month)
+	ctl.Targets.SaveMonth(month)
 
 	return c.JSON(
 		fiber.Map{
@@ -198,13 +192,11 @@ func UpdateMonth(c *fiber.Ctx) error {
 }
 
 // Delete Month
-func DeleteMonth(c *fiber.Ctx) error {
+func (ctl *Controller) DeleteMonth(c *fiber.Ctx) error {
 	uuid := c.Params("uuid")
-	db := database.DB
 
-	var month models.Month
-	db.Where("uuid = ?", uuid).First(&month)
-	if month.Month == "" {
+	month, err := ctl.Targets.FindMonth(uuid)
+	if err != nil {
 		return c.Status(404).JSON(
 			fiber.Map{
 				"status":  "error",
@@ -213,7 +205,7 @@ func DeleteMonth(c *fiber.Ctx) error {
 			},
 		)
 	}
-	db.Delete(&month)
+	ctl.Targets.DeleteMonth(month)
 
 	return c.JSON(
 		fiber.Map{
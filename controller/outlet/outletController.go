@@ -0,0 +1,314 @@
+package outlet
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Danny19977/sr-api/geo"
+	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/repository"
+	"github.com/Danny19977/sr-api/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// maxRadiusKm bounds the radius of a search around a point
+const maxRadiusKm = 500
+
+// parseFilter reads the search, type, province_uuid, lat, lng, radius_km
+// and bbox query parameters
+func parseFilter(c *fiber.Ctx) (repository.OutletFilter, error) {
+	filter := repository.OutletFilter{Type: c.Query("type")}
+	filter.Search = c.Query("search", "")
+	if province := c.Query("province_uuid"); province != "" {
+		filter.ProvinceUUIDs = []string{province}
+	}
+
+	if value := c.Query("bbox"); value != "" {
+		box, err := geo.ParseBox(value)
+		if err != nil {
+			return filter, err
+		}
+		filter.Box = &box
+	}
+
+	lat, lng, radius := c.Query("lat"), c.Query("lng"), c.Query("radius_km")
+	if lat == "" && lng == "" && radius == "" {
+		return filter, nil
+	}
+	var center geo.Point
+	var err error
+	if center.Latitude, err = strconv.ParseFloat(lat, 64); err != nil {
+		return filter, fmt.Errorf("lat, lng and radius_km go together")
+	}
+	if center.Longitude, err = strconv.ParseFloat(lng, 64); err != nil {
+		return filter, fmt.Errorf("lat, lng and radius_km go together")
+	}
+	if filter.RadiusKm, err = strconv.ParseFloat(radius, 64); err != nil {
+		return filter, fmt.Errorf("lat, lng and radius_km go together")
+	}
+	if !center.Valid() || filter.RadiusKm <= 0 || filter.RadiusKm > maxRadiusKm {
+		return filter, fmt.Errorf("lat and lng must be valid coordinates and radius_km between 0 and %d", maxRadiusKm)
+	}
+	filter.Near = &center
+	return filter, nil
+}
+
+// scopeFilter narrows the provinces of filter to those an ASM caller may see
+func (ctl *Controller) scopeFilter(c *fiber.Ctx, filter *repository.OutletFilter) {
+	userUUID, _ := utils.GetUserUUIDFromToken(c)
+	scope := ctl.ScopeProvinces(userUUID)
+	if scope == nil {
+		return
+	}
+	if len(filter.ProvinceUUIDs) == 1 && slices.Contains(scope, filter.ProvinceUUIDs[0]) {
+		return
+	}
+	filter.ProvinceUUIDs = scope
+}
+
+// Paginate, search by name or owner, by radius around lat and lng, or inside a bbox
+func (ctl *Controller) GetPaginatedOutlets(c *fiber.Ctx) error {
+	page, err := strconv.Atoi(c.Query("page", "1"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(c.Query("limit", "15"))
+	if err != nil || limit <= 0 {
+		limit = 15
+	}
+
+	filter, err := parseFilter(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid search",
+			"error":   err.Error(),
+		})
+	}
+	ctl.scopeFilter(c, &filter)
+	filter.Offset = (page - 1) * limit
+	filter.Limit = limit
+
+	outlets, totalRecords, err := ctl.Outlets.List(filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to fetch outlets",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Outlets retrieved successfully",
+		"data":    outlets,
+		"pagination": map[string]interface{}{
+			"total_records": totalRecords,
+			"total_pages":   int((totalRecords + int64(limit) - 1) / int64(limit)),
+			"current_page":  page,
+			"page_size":     limit,
+		},
+	})
+}
+
+// Get one outlet
+func (ctl *Controller) GetOutlet(c *fiber.Ctx) error {
+	outlet, err := ctl.Outlets.Find(c.Params("uuid"))
+	if err != nil || !ctl.visible(c, outlet) {
+		return c.Status(404).JSON(fiber.Map{
+			"status":  "error",
+			"message": "No Outlet found",
+			"data":    nil,
+		})
+	}
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Outlet found",
+		"data":    outlet,
+	})
+}
+
+// visible reports whether the caller may see outlet
+func (ctl *Controller) visible(c *fiber.Ctx, outlet *models.Outlet) bool {
+	userUUID, _ := utils.GetUserUUIDFromToken(c)
+	scope := ctl.ScopeProvinces(userUUID)
+	return scope == nil || slices.Contains(scope, outlet.ProvinceUUID)
+}
+
+// OutletInput is the body of the create and update routes
+type OutletInput struct {
+	Name           string  `json:"name"`
+	Type           string  `json:"type"`
+	OwnerName      string  `json:"owner_name"`
+	OwnerPhone     string  `json:"owner_phone"`
+	OwnerEmail     string  `json:"owner_email"`
+	Latitude       float64 `json:"latitude"`
+	Longitude      float64 `json:"longitude"`
+	GeofenceRadius float64 `json:"geofence_radius"`
+	ProvinceUUID   string  `json:"province_uuid"`
+	TerritoryUUID  string  `json:"territory_uuid"`
+	Signature      string  `json:"signature"`
+}
+
+// apply copies input to outlet and checks it. A territory must be a
+// district of the province of the outlet.
+func (ctl *Controller) apply(input OutletInput, outlet *models.Outlet) error {
+	outlet.Name = input.Name
+	outlet.Type = input.Type
+	outlet.OwnerName = strings.TrimSpace(input.OwnerName)
+	outlet.OwnerPhone = strings.TrimSpace(input.OwnerPhone)
+	outlet.OwnerEmail = strings.TrimSpace(input.OwnerEmail)
+	outlet.Latitude = input.Latitude
+	outlet.Longitude = input.Longitude
+	outlet.GeofenceRadius = input.GeofenceRadius
+	outlet.ProvinceUUID = input.ProvinceUUID
+	outlet.TerritoryUUID = nil
+	outlet.Signature = input.Signature
+	if err := outlet.Validate(); err != nil {
+		return err
+	}
+
+	if _, err := ctl.Geography.FindProvince(outlet.ProvinceUUID); err != nil {
+		return fmt.Errorf("no province %s", outlet.ProvinceUUID)
+	}
+	if input.TerritoryUUID == "" {
+		return nil
+	}
+	district, err := ctl.Territories.Find(input.TerritoryUUID)
+	if err != nil || district.Level != models.TerritoryDistrict {
+		return fmt.Errorf("territory_uuid must be a district")
+	}
+	provinces, err := ctl.Territories.Provinces(district.UUID)
+	if err != nil || len(provinces) != 1 || provinces[0] != outlet.ProvinceUUID {
+		return fmt.Errorf("the district is outside the province of the outlet")
+	}
+	outlet.TerritoryUUID = &district.UUID
+	return nil
+}
+
+// Create an outlet
+func (ctl *Controller) CreateOutlet(c *fiber.Ctx) error {
+	var input OutletInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Review your input",
+			"error":   err.Error(),
+		})
+	}
+
+	outlet := &models.Outlet{UUID: uuid.New().String()}
+	if err := ctl.apply(input, outlet); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid outlet",
+			"error":   err.Error(),
+		})
+	}
+	if !ctl.visible(c, outlet) {
+		return c.Status(403).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Outlet outside your province",
+			"data":    nil,
+		})
+	}
+
+	if err := ctl.Outlets.Create(outlet); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to create outlet",
+			"error":   err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Outlet created success",
+		"data":    outlet,
+	})
+}
+
+// Update an outlet
+func (ctl *Controller) UpdateOutlet(c *fiber.Ctx) error {
+	var input OutletInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Review your input",
+			"error":   err.Error(),
+		})
+	}
+
+	outlet, err := ctl.Outlets.Find(c.Params("uuid"))
+	if err != nil || !ctl.visible(c, outlet) {
+		return c.Status(404).JSON(fiber.Map{
+			"status":  "error",
+			"message": "No Outlet found",
+			"data":    nil,
+		})
+	}
+	if err := ctl.apply(input, outlet); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid outlet",
+			"error":   err.Error(),
+		})
+	}
+	if !ctl.visible(c, outlet) {
+		return c.Status(403).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Outlet outside your province",
+			"data":    nil,
+		})
+	}
+
+	outlet.Province = nil
+	if err := ctl.Outlets.Save(outlet); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to update outlet",
+			"error":   err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Outlet updated success",
+		"data":    outlet,
+	})
+}
+
+// Delete an outlet no sale was made at
+func (ctl *Controller) DeleteOutlet(c *fiber.Ctx) error {
+	outlet, err := ctl.Outlets.Find(c.Params("uuid"))
+	if err != nil || !ctl.visible(c, outlet) {
+		return c.Status(404).JSON(fiber.Map{
+			"status":  "error",
+			"message": "No Outlet found",
+			"data":    nil,
+		})
+	}
+
+	err = ctl.Outlets.Delete(outlet)
+	if errors.Is(err, repository.ErrOutletInUse) {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid outlet",
+			"error":   err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to delete outlet",
+			"error":   err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Outlet deleted success",
+		"data":    nil,
+	})
+}
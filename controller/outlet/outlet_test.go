@@ -0,0 +1,99 @@
+package outlet_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Danny19977/sr-api/apptest"
+	"github.com/Danny19977/sr-api/geo"
+	"github.com/Danny19977/sr-api/models"
+	"github.com/google/uuid"
+)
+
+type outletList struct {
+	Data []models.Outlet `json:"data"`
+}
+
+func TestOutletSearchAndMap(t *testing.T) {
+	env := apptest.New(t)
+	admin := env.Token(env.CreateUser("Admin", nil))
+
+	country := &models.Country{UUID: uuid.New().String(), Name: "Country " + uuid.New().String()[:8]}
+	if err := env.App.Geography.CreateCountry(country); err != nil {
+		t.Fatal(err)
+	}
+	province := &models.Province{UUID: uuid.New().String(), Name: "Kinshasa " + uuid.New().String()[:8], CountryUUID: country.UUID}
+	if err := env.App.Geography.CreateProvince(province); err != nil {
+		t.Fatal(err)
+	}
+
+	// Gombe and Limete are about 8 km apart, Kisantu about 100 km away
+	positions := map[string][2]float64{"Gombe": {-4.3050, 15.3000}, "Limete": {-4.3550, 15.3550}, "Kisantu": {-5.1300, 15.0600}}
+	outlets := map[string]models.Outlet{}
+	for name, position := range positions {
+		var created struct {
+			Data models.Outlet `json:"data"`
+		}
+		body := map[string]interface{}{"name": name, "type": "kiosk", "latitude": position[0], "longitude": position[1], "province_uuid": province.UUID}
+		resp := env.Do(http.MethodPost, "/api/outlets/create", admin, body)
+		if err := resp.JSON(&created); err != nil || resp.Status != http.StatusOK {
+			t.Fatalf("got status %d: %s", resp.Status, resp.Body)
+		}
+		outlets[name] = created.Data
+	}
+	if resp := env.Do(http.MethodPost, "/api/outlets/create", admin, map[string]interface{}{"name": "Nowhere", "latitude": 91, "province_uuid": province.UUID}); resp.Status != http.StatusBadRequest {
+		t.Errorf("got status %d for a latitude of 91, want 400", resp.Status)
+	}
+
+	var list outletList
+	resp := env.Do(http.MethodGet, "/api/outlets/all/paginate?lat=-4.3217&lng=15.3126&radius_km=20", admin, nil)
+	if err := resp.JSON(&list); err != nil || resp.Status != http.StatusOK {
+		t.Fatalf("got status %d: %s", resp.Status, resp.Body)
+	}
+	if len(list.Data) != 2 || list.Data[0].Name != "Gombe" {
+		t.Errorf("got %v, want Gombe then Limete within 20 km", list.Data)
+	}
+	resp = env.Do(http.MethodGet, "/api/outlets/all/paginate?bbox=15.0,-5.2,15.1,-5.0", admin, nil)
+	if err := resp.JSON(&list); err != nil || len(list.Data) != 1 || list.Data[0].Name != "Kisantu" {
+		t.Errorf("got %v, want Kisantu alone in the box", list.Data)
+	}
+
+	// A sale at an outlet lands in its province and on the map
+	product := models.Product{UUID: uuid.New().String(), Name: "Cola"}
+	if err := env.App.DB.Create(&product).Error; err != nil {
+		t.Fatal(err)
+	}
+	user := env.CreateUser("Admin", nil)
+	sale := map[string]interface{}{"product_uuid": product.UUID, "user_uuid": user.UUID, "quantity": 12, "outlet_uuid": outlets["Limete"].UUID}
+	if resp := env.Do(http.MethodPost, "/api/sales/create?confirm=true", admin, sale); resp.Status != http.StatusOK {
+		t.Fatalf("got status %d: %s", resp.Status, resp.Body)
+	}
+
+	var collection geo.FeatureCollection
+	resp = env.Do(http.MethodGet, "/api/dashboard/outlet-map?provinces="+province.UUID, admin, nil)
+	if err := resp.JSON(&collection); err != nil || resp.Status != http.StatusOK {
+		t.Fatalf("got status %d: %s", resp.Status, resp.Body)
+	}
+	if len(collection.Features) != 3 {
+		t.Fatalf("got %d features, want the three outlets", len(collection.Features))
+	}
+	for _, feature := range collection.Features {
+		want := 0.0
+		if feature.ID == outlets["Limete"].UUID {
+			want = 12
+		}
+		if feature.Properties["total"] != want {
+			t.Errorf("%s sold %v, want %v", feature.Properties["name"], feature.Properties["total"], want)
+		}
+	}
+
+	if resp := env.Do(http.MethodDelete, "/api/outlets/delete/"+outlets["Limete"].UUID, admin, nil); resp.Status != http.StatusBadRequest {
+		t.Errorf("got status %d deleting an outlet with sales, want 400", resp.Status)
+	}
+	if resp := env.Do(http.MethodDelete, "/api/outlets/delete/"+outlets["Kisantu"].UUID, admin, nil); resp.Status != http.StatusOK {
+		t.Errorf("got status %d deleting an outlet without sales", resp.Status)
+	}
+	if _, err := env.App.Territories.Find(outlets["Kisantu"].UUID); err == nil {
+		t.Error("the node of a deleted outlet was kept")
+	}
+}
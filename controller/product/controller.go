@@ -0,0 +1,13 @@
+package product
+
+import "github.com/Danny19977/sr-api/app"
+
+// Controller serves the product routes on top of the application container
+type Controller struct {
+	*app.App
+}
+
+// New creates the controller
+func New(a *app.App) *Controller {
+	return &Controller{App: a}
+}
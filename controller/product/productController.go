@@ -3,15 +3,14 @@ package product
 import (
 	"strconv"
 
-	"github.com/Danny19977/sr-api/database"
 	"github.com/Danny19977/sr-api/models"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 )
 
 // Paginate
-func GetPaginatedProducts(c *fiber.Ctx) error {
-	db := database.DB
+func (ctl *Controller) GetPaginatedProducts(c *fiber.Ctx) error {
+	db := ctl.DB
 
 	// Parse query parameters for pagination
 	page, err := strconv.Atoi(c.Query("page", "1"))
@@ -72,8 +71,8 @@ func GetPaginatedProducts(c *fiber.Ctx) error {
 }
 
 // Get All data
-func GetAllProducts(c *fiber.Ctx) error {
-	db := database.DB
+func (ctl *Controller) GetAllProducts(c *fiber.Ctx) error {
+	db := ctl.DB
 	var data []models.Product
 	db.Preload("Sales").Find(&data)
 	return c.JSON(fiber.Map{
@@ -84,9 +83,9 @@ func GetAllProducts(c *fiber.Ctx) error {
 }
 
 // Get one data
-func GetProduct(c *fiber.Ctx) error {
+func (ctl *Controller) GetProduct(c *fiber.Ctx) error {
 	uuid := c.Params("uuid")
-	db := database.DB
+	db := ctl.DB
 	var product models.Product
 	db.Preload("Sales").Where("uuid = ?", uuid).First(&product)
 	if product.Name == "" {
@@ -108,9 +107,9 @@ func GetProduct(c *fiber.Ctx) error {
 }
 
 // Get one data by name
-func GetProductByName(c *fiber.Ctx) error {
+func (ctl *Controller) GetProductByName(c *fiber.Ctx) error {
 	name := c.Params("name")
-	db := database.DB
+	db := ctl.DB
 	var product models.Product
 	db.Preload("Sales").Where("name = ?", name).First(&product)
 	if product.Name == "" {
@@ -132,7 +131,7 @@ func GetProductByName(c *fiber.Ctx) error {
 }
 
 // Create data
-func CreateProduct(c *fiber.Ctx) error {
+func (ctl *Controller) CreateProduct(c *fiber.Ctx) error {
 	p := &models.Product{}
 
 	if err := c.BodyParser(&p); err != nil {
@@ -140,7 +139,7 @@ func CreateProduct(c *fiber.Ctx) error {
 	}
 
 	p.UUID = uuid.New().String()
-	database.DB.Create(p)
+	ctl.DB.Create(p)
 
 	return c.JSON(
 		fiber.Map{
@@ -152,15 +151,16 @@ func CreateProduct(c *fiber.Ctx) error {
 }
 
 // Update data
-func UpdateProduct(c *fiber.Ctx) error {
+func (ctl *Controller) UpdateProduct(c *fiber.Ctx) error {
 	uuid := c.Params("uuid")
-	db := database.DB
+	db := ctl.DB
 
 	type UpdateData struct {
 		UUID string `json:"uuid"`
 
-		Name      string `json:"name"`
-		Signature string `json:"signature"`
+		Name      string  `json:"name"`
+		Signature string  `json:"signature"`
+		Price     float64 `json:"price"`
 	}
 
 	var updateData UpdateData
@@ -180,6 +180,7 @@ func UpdateProduct(c *fiber.Ctx) error {
 	db.Where("uuid = ?", uuid).First(&product)
 	product.Name = updateData.Name
 	product.Signature = updateData.Signature
+	product.Price = updateData.Price
 
 	db.Save(&product)
 
@@ -194,10 +195,10 @@ func UpdateProduct(c *fiber.Ctx) error {
 }
 
 // Delete data
-func DeleteProduct(c *fiber.Ctx) error {
+func (ctl *Controller) DeleteProduct(c *fiber.Ctx) error {
 	uuid := c.Params("uuid")
 
-	db := database.DB
+	db := ctl.DB
 
 	var product models.Product
 	db.Where("uuid = ?", uuid).First(&product)
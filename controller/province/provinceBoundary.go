@@ -0,0 +1,170 @@
+package province
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Danny19977/sr-api/geo"
+	"github.com/Danny19977/sr-api/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// encodeShape returns the GeoJSON geometry stored for shape
+func encodeShape(shape geo.Shape) (string, error) {
+	data, err := json.Marshal(shape.Geometry())
+	return string(data), err
+}
+
+// Get the outline of a province as a GeoJSON Feature
+func (ctl *Controller) GetProvinceBoundary(c *fiber.Ctx) error {
+	province, err := ctl.Geography.FindProvince(c.Params("uuid"))
+	if err != nil || province.Boundary == "" {
+		return c.Status(404).JSON(fiber.Map{
+			"status":  "error",
+			"message": "No boundary found for this province",
+			"data":    nil,
+		})
+	}
+
+	var geometry geo.Geometry
+	if err := json.Unmarshal([]byte(province.Boundary), &geometry); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to read the boundary",
+			"error":   err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Province boundary found",
+		"data": geo.Feature{
+			Type:       "Feature",
+			ID:         province.UUID,
+			Geometry:   geometry,
+			Properties: map[string]interface{}{"name": province.Name},
+		},
+	})
+}
+
+// Set the outline of a province from a GeoJSON Polygon or MultiPolygon, bare
+// or as a Feature. Sales sent from outside it fail their geofence check.
+func (ctl *Controller) SetProvinceBoundary(c *fiber.Ctx) error {
+	province, err := ctl.Geography.FindProvince(c.Params("uuid"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"status":  "error",
+			"message": "No Province name found",
+			"data":    nil,
+		})
+	}
+
+	shape, err := geo.ParseShape(c.Body())
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid boundary",
+			"error":   err.Error(),
+		})
+	}
+	boundary, err := encodeShape(shape)
+	if err == nil {
+		err = ctl.Geography.SetProvinceBoundaries(map[string]string{province.UUID: boundary})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to set the boundary",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Province boundary set",
+		"data":    json.RawMessage(boundary),
+	})
+}
+
+// matchProvince finds the province a feature outlines: by its id or uuid
+// property, or else by the name held in the nameProperty property
+func matchProvince(feature geo.ShapeFeature, provinces []models.Province, nameProperty string) (*models.Province, bool) {
+	uuid, _ := feature.Properties["uuid"].(string)
+	name, _ := feature.Properties[nameProperty].(string)
+	for i, province := range provinces {
+		if feature.ID != "" && feature.ID == province.UUID || uuid != "" && uuid == province.UUID {
+			return &provinces[i], true
+		}
+	}
+	for i, province := range provinces {
+		if name != "" && strings.EqualFold(strings.TrimSpace(name), province.Name) {
+			return &provinces[i], true
+		}
+	}
+	return nil, false
+}
+
+// Upload the outlines of several provinces from a GeoJSON FeatureCollection,
+// each feature naming its province by id, uuid property, or the name
+// property given by name_property ("name" by default). Nothing is stored
+// unless every feature matches a province.
+func (ctl *Controller) UploadProvinceBoundaries(c *fiber.Ctx) error {
+	features, err := geo.ParseShapes(c.Body())
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid boundaries",
+			"error":   err.Error(),
+		})
+	}
+	provinces, err := ctl.Geography.AllProvinces()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to set the boundaries",
+			"error":   err.Error(),
+		})
+	}
+
+	nameProperty := c.Query("name_property", "name")
+	boundaries := make(map[string]string, len(features))
+	updated := make([]fiber.Map, 0, len(features))
+	for i, feature := range features {
+		province, ok := matchProvince(feature, provinces, nameProperty)
+		if !ok {
+			return c.Status(400).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid boundaries",
+				"error":   fmt.Sprintf("feature %d matches no province by id, uuid or %s", i, nameProperty),
+			})
+		}
+		if _, seen := boundaries[province.UUID]; seen {
+			return c.Status(400).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid boundaries",
+				"error":   fmt.Sprintf("feature %d outlines %s a second time", i, province.Name),
+			})
+		}
+		if boundaries[province.UUID], err = encodeShape(feature.Shape); err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Failed to set the boundaries",
+				"error":   err.Error(),
+			})
+		}
+		updated = append(updated, fiber.Map{"uuid": province.UUID, "name": province.Name})
+	}
+
+	if err := ctl.Geography.SetProvinceBoundaries(boundaries); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to set the boundaries",
+			"error":   err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Province boundaries set",
+		"data":    updated,
+	})
+}
@@ -3,17 +3,15 @@ package province
 import (
 	"strconv"
 
-	"github.com/Danny19977/sr-api/database"
 	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/repository"
 	"github.com/Danny19977/sr-api/utils"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 )
 
 // Paginate
-func GetPaginatedProvince(c *fiber.Ctx) error {
-	db := database.DB
-
+func (ctl *Controller) GetPaginatedProvince(c *fiber.Ctx) error {
 	// Parse query parameters for pagination
 	page, err := strconv.Atoi(c.Query("page", "1"))
 	if err != nil || page <= 0 {
@@ -28,22 +26,17 @@ func GetPaginatedProvince(c *fiber.Ctx) error {
 	// Parse search query
 	search := c.Query("search", "")
 
-	var dataList []models.Province
-	var totalRecords int64
+	opts := repository.ListOptions{Search: search, Offset: offset, Limit: limit}
 
 	userUUID, _ := utils.GetUserUUIDFromToken(c)
-	var requestingUser models.User
-	db.Where("uuid = ?", userUUID).First(&requestingUser)
-
-	query := db.Model(&models.Province{})
-	if requestingUser.Role == "ASM" {
-		query = query.Where("uuid = ?", requestingUser.ProvinceUUID)
+	if requestingUser, err := ctl.Users.FindByUUID(userUUID); err == nil && requestingUser.Role == "ASM" {
+		opts.ProvinceUUID = requestingUser.ProvinceUUID
+		if opts.ProvinceUUID == nil {
+			opts.ProvinceUUID = new(string)
+		}
 	}
-	query = query.Where("name ILIKE ?", "%"+search+"%")
-	query.Count(&totalRecords)
 
-	query = query.Offset(offset).Limit(limit).Order("updated_at DESC").Preload("Country").Preload("Users")
-	err = query.Find(&dataList).Error
+	dataList, totalRecords, err := ctl.Geography.ListProvinces(opts)
 
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
@@ -74,9 +67,7 @@ func GetPaginatedProvince(c *fiber.Ctx) error {
 }
 
 // Paginate Query ASM
-func GetPaginatedASM(c *fiber.Ctx) error {
-	db := database.DB
-
+func (ctl *Controller) GetPaginatedASM(c *fiber.Ctx) error {
 	ProvinceUUID := c.Params("province_uuid")
 
 	// Parse query parameters for pagination
@@ -93,25 +84,12 @@ func GetPaginatedASM(c *fiber.Ctx) error {
 	// Parse search query
 	search := c.Query("search", "")
 
-	var dataList []models.Province
-	var totalRecords int64
-
-	// Count total records matching the search query
-	db.Model(&models.Province{}).
-		Where("uuid = ?", ProvinceUUID).
-		Where("name ILIKE ?", "%"+search+"%").
-		Count(&totalRecords)
-
-	// Fetch paginated data
-	err = db.
-		Where("uuid = ?", ProvinceUUID).
-		Where("name ILIKE ?", "%"+search+"%").
-		Offset(offset).
-		Limit(limit).
-		Order("updated_at DESC").
-		Preload("Country").
-		Preload("Users").
-		Find(&dataList).Error
+	dataList, totalRecords, err := ctl.Geography.ListProvinces(repository.ListOptions{
+		Search:       search,
+		Offset:       offset,
+		Limit:        limit,
+		ProvinceUUID: &ProvinceUUID,
+	})
 
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
@@ -142,12 +120,8 @@ func GetPaginatedASM(c *fiber.Ctx) error {
 }
 
 // Get All data
-func GetAllProvinces(c *fiber.Ctx) error {
-	db := database.DB
-	var data []models.Province
-	db.Preload("Country").
-		Preload("Users").
-		Find(&data)
+func (ctl *Controller) GetAllProvinces(c *fiber.Ctx) error {
+	data, _ := ctl.Geography.AllProvinces()
 	return c.JSON(fiber.Map{
 		"status":  "success",
 		"message": "All provinces support",
@@ -156,17 +130,10 @@ func GetAllProvinces(c *fiber.Ctx) error {
 }
 
 // Get All data by country Dashboard
-func GetAllProvinceByCountry(c *fiber.Ctx) error {
-	db := database.DB
-
+func (ctl *Controller) GetAllProvinceByCountry(c *fiber.Ctx) error {
 	countryUUID := c.Params("country_uuid")
 
-	var data []models.Province
-
-	db.Preload("Country").
-		Preload("Users").
-		Where("country_uuid = ?", countryUUID).
-		Find(&data)
+	data, _ := ctl.Geography.ProvincesByCountry(countryUUID)
 	return c.JSON(fiber.Map{
 		"status":  "success",
 		"message": "All province by country",
@@ -175,14 +142,10 @@ func GetAllProvinceByCountry(c *fiber.Ctx) error {
 }
 
 // Get one data
-func GetProvince(c *fiber.Ctx) error {
+func (ctl *Controller) GetProvince(c *fiber.Ctx) error {
 	uuid := c.Params("uuid")
-	db := database.DB
-	var province models.Province
-	db.Preload("Country").
-		Preload("Users").
-		Where("uuid = ?", uuid).First(&province)
-	if province.Name == "" {
+	province, err := ctl.Geography.FindProvince(uuid)
+	if err != nil {
 		return c.Status(404).JSON(
 			fiber.Map{
 				"status":  "error",
@@ -201,14 +164,10 @@ func GetProvince(c *fiber.Ctx) error {
 }
 
 // Get one data by name
-func GetProvinceByName(c *fiber.Ctx) error {
+func (ctl *Controller) GetProvinceByName(c *fiber.Ctx) error {
 	name := c.Params("name")
-	db := database.DB
-	var province models.Province
-	db.Preload("Country").
-		Preload("Users").
-		Where("name = ?", name).First(&province)
-	if province.Name == "" {
+	province, err := ctl.Geography.FindProvinceByName(name)
+	if err != nil {
 		return c.Status(404).JSON(
 			fiber.Map{
 				"status":  "error",
@@ -227,7 +186,7 @@ func GetProvinceByName(c *fiber.Ctx) error {
 }
 
 // Create data
-func CreateProvince(c *fiber.Ctx) error {
+func (ctl *Controller) CreateProvince(c *fiber.Ctx) error {
 	p := &models.Province{}
 
 	if err := c.BodyParser(&p); err != nil {
@@ -235,7 +194,7 @@ func CreateProvince(c *fiber.Ctx) error {
 	}
 
 	p.UUID = uuid.New().String()
-	database.DB.Create(p)
+	ctl.Geography.CreateProvince(p)
 
 	return c.JSON(
 		fiber.Map{
@@ -247,9 +206,8 @@ func CreateProvince(c *fiber.Ctx) error {
 }
 
 // Update data
-func UpdateProvince(c *fiber.Ctx) error {
+func (ctl *Controller) UpdateProvince(c *fiber.Ctx) error {
 	uuid := c.Params("uuid")
-	db := database.DB
 
 	type UpdateData struct {
 		UUID string `json:"uuid"`
@@ -271,14 +229,21 @@ func UpdateProvince(c *fiber.Ctx) error {
 		)
 	}
 
-	province := new(models.Province)
-
-	db.Where("uuid = ?", uuid).First(&province)
+	province, err := ctl.Geography.FindProvince(uuid)
+	if err != nil {
+		return c.Status(404).JSON(
+			fiber.Map{
+				"status":  "error",
+				"message": "No Province name found",
+				"data":    nil,
+			},
+		)
+	}
 	province.Name = updateData.Name
 	province.CountryUUID = updateData.CountryUUID
 	province.Signature = updateData.Signature
 
-	db.Save(&province)
+	ctl.Geography.SaveProvince(province)
 
 	return c.JSON(
 		fiber.Map{
@@ -291,14 +256,11 @@ func UpdateProvince(c *fiber.Ctx) error {
 }
 
 // Delete data
-func DeleteProvince(c *fiber.Ctx) error {
+func (ctl *Controller) DeleteProvince(c *fiber.Ctx) error {
 	uuid := c.Params("uuid")
 
-	db := database.DB
-
-	var province models.Province
-	db.Where("uuid = ?", uuid).First(&province)
-	if province.Name == "" {
+	province, err := ctl.Geography.FindProvince(uuid)
+	if err != nil {
 		return c.Status(404).JSON(
 			fiber.Map{
 				"status":  "error",
@@ -308,7 +270,7 @@ func DeleteProvince(c *fiber.Ctx) error {
 		)
 	}
 
-	db.Delete(&province)
+	ctl.Geography.DeleteProvince(province)
 
 	return c.JSON(
 		fiber.Map{
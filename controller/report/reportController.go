@@ -0,0 +1,397 @@
+package report
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/report"
+	"github.com/Danny19977/sr-api/reporting"
+	"github.com/Danny19977/sr-api/repository"
+	"github.com/Danny19977/sr-api/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// reportInput is the body of the create and update requests, fields left
+// out keep their current value on update
+type reportInput struct {
+	Name          *string  `json:"name"`
+	Dashboard     *string  `json:"dashboard"`
+	Period        *string  `json:"period"`
+	ProvinceUUIDs []string `json:"province_uuids"`
+	Recipients    []string `json:"recipients"`
+	Schedule      *string  `json:"schedule"`
+	Format        *string  `json:"format"`
+	Active        *bool    `json:"active"`
+}
+
+func (in reportInput) apply(subscription *models.ReportSubscription) {
+	if in.Name != nil {
+		subscription.Name = strings.TrimSpace(*in.Name)
+	}
+	if in.Dashboard != nil {
+		subscription.Dashboard = *in.Dashboard
+	}
+	if in.Period != nil {
+		subscription.Period = *in.Period
+	}
+	if in.ProvinceUUIDs != nil {
+		subscription.ProvinceUUIDs = strings.Join(in.ProvinceUUIDs, ",")
+	}
+	if in.Recipients != nil {
+		subscription.Recipients = strings.Join(in.Recipients, ",")
+	}
+	if in.Schedule != nil {
+		subscription.Schedule = strings.TrimSpace(*in.Schedule)
+	}
+	if in.Format != nil {
+		subscription.Format = strings.ToLower(*in.Format)
+	}
+	if in.Active != nil {
+		subscription.Active = *in.Active
+	}
+}
+
+// caller returns the authenticated user
+func (ctl *Controller) caller(c *fiber.Ctx) (*models.User, error) {
+	userUUID, err := utils.GetUserUUIDFromToken(c)
+	if err != nil {
+		return nil, err
+	}
+	return ctl.Users.FindByUUID(userUUID)
+}
+
+// find returns the subscription of the uuid route parameter when the caller
+// may see it: admins see every subscription, other users their own
+func (ctl *Controller) find(c *fiber.Ctx, user *models.User) (*models.ReportSubscription, error) {
+	subscription, err := ctl.Reports.Find(c.Params("uuid"))
+	if err != nil {
+		return nil, err
+	}
+	if user.Role != "Admin" && subscription.OwnerUUID != user.UUID {
+		return nil, repository.ErrNotFound
+	}
+	return subscription, nil
+}
+
+// scope restricts the report of an ASM to the province of their account
+func scope(user *models.User, subscription *models.ReportSubscription) {
+	if user.Role != "ASM" {
+		return
+	}
+	subscription.ProvinceUUIDs = ""
+	if user.ProvinceUUID != nil {
+		subscription.ProvinceUUIDs = *user.ProvinceUUID
+	}
+}
+
+// pageParams reads the page and limit query parameters
+func pageParams(c *fiber.Ctx) (int, int) {
+	page, err := strconv.Atoi(c.Query("page", "1"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(c.Query("limit", "15"))
+	if err != nil || limit <= 0 {
+		limit = 15
+	}
+	return page, limit
+}
+
+func pagination(totalRecords int64, page, limit int) map[string]interface{} {
+	return map[string]interface{}{
+		"total_records": totalRecords,
+		"total_pages":   int((totalRecords + int64(limit) - 1) / int64(limit)),
+		"current_page":  page,
+		"page_size":     limit,
+	}
+}
+
+func unauthenticated(c *fiber.Ctx) error {
+	return c.Status(401).JSON(fiber.Map{
+		"status":  "error",
+		"message": "Unauthenticated",
+	})
+}
+
+func notFound(c *fiber.Ctx) error {
+	return c.Status(404).JSON(fiber.Map{
+		"status":  "error",
+		"message": "No report found",
+		"data":    nil,
+	})
+}
+
+// Get the dashboards, periods and formats a report may use
+func (ctl *Controller) GetOptions(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Report options",
+		"data": fiber.Map{
+			"dashboards": models.ReportDashboards,
+			"periods":    report.Periods,
+			"formats":    []string{report.FormatPDF, report.FormatXLSX},
+		},
+	})
+}
+
+// Paginate Reports, users other than admins only see their own
+func (ctl *Controller) GetPaginatedReports(c *fiber.Ctx) error {
+	user, err := ctl.caller(c)
+	if err != nil {
+		return unauthenticated(c)
+	}
+
+	page, limit := pageParams(c)
+	opts := repository.ReportListOptions{
+		ListOptions: repository.ListOptions{Search: c.Query("search", ""), Offset: (page - 1) * limit, Limit: limit},
+	}
+	if user.Role != "Admin" {
+		opts.OwnerUUID = user.UUID
+	}
+
+	dataList, totalRecords, err := ctl.Reports.List(opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to fetch reports",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":     "success",
+		"message":    "Get all reports paginate success",
+		"data":       dataList,
+		"pagination": pagination(totalRecords, page, limit),
+	})
+}
+
+// Get one Report
+func (ctl *Controller) GetReport(c *fiber.Ctx) error {
+	user, err := ctl.caller(c)
+	if err != nil {
+		return unauthenticated(c)
+	}
+	subscription, err := ctl.find(c, user)
+	if err != nil {
+		return notFound(c)
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Report found",
+		"data":    subscription,
+	})
+}
+
+// Create Report
+func (ctl *Controller) CreateReport(c *fiber.Ctx) error {
+	user, err := ctl.caller(c)
+	if err != nil {
+		return unauthenticated(c)
+	}
+
+	var input reportInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid request body",
+			"error":   err.Error(),
+		})
+	}
+
+	p := &models.ReportSubscription{
+		UUID:      uuid.New().String(),
+		Format:    report.FormatPDF,
+		Active:    true,
+		OwnerUUID: user.UUID,
+	}
+	input.apply(p)
+	scope(user, p)
+	if err := p.Validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid report",
+			"error":   err.Error(),
+		})
+	}
+	p.ScheduleNext(time.Now())
+
+	if err := ctl.Reports.Create(p); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to create report",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Report created success",
+		"data":    p,
+	})
+}
+
+// Update Report, its next run follows the new schedule
+func (ctl *Controller) UpdateReport(c *fiber.Ctx) error {
+	user, err := ctl.caller(c)
+	if err != nil {
+		return unauthenticated(c)
+	}
+	subscription, err := ctl.find(c, user)
+	if err != nil {
+		return notFound(c)
+	}
+
+	var input reportInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Review your input",
+			"error":   err.Error(),
+		})
+	}
+	input.apply(subscription)
+	scope(user, subscription)
+	if err := subscription.Validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid report",
+			"error":   err.Error(),
+		})
+	}
+	subscription.ScheduleNext(time.Now())
+
+	if err := ctl.Reports.Save(subscription); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to update report",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Report updated success",
+		"data":    subscription,
+	})
+}
+
+// Delete Report with its runs
+func (ctl *Controller) DeleteReport(c *fiber.Ctx) error {
+	user, err := ctl.caller(c)
+	if err != nil {
+		return unauthenticated(c)
+	}
+	subscription, err := ctl.find(c, user)
+	if err != nil {
+		return notFound(c)
+	}
+
+	if err := ctl.Reports.Delete(subscription); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to delete report",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Report deleted success",
+		"data":    nil,
+	})
+}
+
+// Run a Report now, outside of its schedule
+func (ctl *Controller) RunReport(c *fiber.Ctx) error {
+	user, err := ctl.caller(c)
+	if err != nil {
+		return unauthenticated(c)
+	}
+	subscription, err := ctl.find(c, user)
+	if err != nil {
+		return notFound(c)
+	}
+
+	run, err := reporting.New(ctl.App).Execute(subscription, time.Now(), true)
+	if run == nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to run report",
+			"error":   err.Error(),
+		})
+	}
+	if err != nil {
+		// The failed run is recorded with its error
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Report run failed",
+			"error":   err.Error(),
+			"data":    run,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Report sent",
+		"data":    run,
+	})
+}
+
+// Paginate the runs of a Report, latest first
+func (ctl *Controller) GetReportRuns(c *fiber.Ctx) error {
+	user, err := ctl.caller(c)
+	if err != nil {
+		return unauthenticated(c)
+	}
+	subscription, err := ctl.find(c, user)
+	if err != nil {
+		return notFound(c)
+	}
+
+	page, limit := pageParams(c)
+	dataList, totalRecords, err := ctl.Reports.Runs(subscription.UUID, repository.ListOptions{Offset: (page - 1) * limit, Limit: limit})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to fetch report runs",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":     "success",
+		"message":    "Get report runs success",
+		"data":       dataList,
+		"pagination": pagination(totalRecords, page, limit),
+	})
+}
+
+// Download the file of a report run
+func (ctl *Controller) DownloadRun(c *fiber.Ctx) error {
+	user, err := ctl.caller(c)
+	if err != nil {
+		return unauthenticated(c)
+	}
+	run, err := ctl.Reports.FindRun(c.Params("uuid"))
+	if err != nil || len(run.Output) == 0 {
+		return c.Status(404).JSON(fiber.Map{
+			"status":  "error",
+			"message": "No report file found",
+			"data":    nil,
+		})
+	}
+	subscription, err := ctl.Reports.Find(run.SubscriptionUUID)
+	if err != nil || (user.Role != "Admin" && subscription.OwnerUUID != user.UUID) {
+		return notFound(c)
+	}
+
+	c.Set(fiber.HeaderContentType, run.ContentType)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", run.FileName))
+	return c.Send(run.Output)
+}
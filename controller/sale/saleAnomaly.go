@@ -0,0 +1,66 @@
+package Sale
+
+import (
+	"time"
+
+	"github.com/Danny19977/sr-api/anomaly"
+	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// screen scores the quantity of sale, made at at, and flags it when it is an
+// outlier. It answers the request and returns false when the outlier was not
+// confirmed with ?confirm=true, or when the check failed.
+func (ctl *Controller) screen(c *fiber.Ctx, sale *models.Sale, at time.Time) (bool, error) {
+	result, err := anomaly.New(ctl.App).Check(sale, at)
+	if err != nil {
+		return false, c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to check the quantity",
+			"error":   err.Error(),
+		})
+	}
+
+	if result.Outlier && !c.QueryBool("confirm") {
+		return false, c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status":  "warning",
+			"message": "The quantity is unusual for this province, product and time slot. Check it and send it again with confirm=true to save it",
+			"data":    result,
+		})
+	}
+	sale.AnomalyScore = result.Score
+	sale.Flagged = result.Outlier
+	return true, nil
+}
+
+// Get the flagged sales of a day, today by default
+func (ctl *Controller) GetAnomalies(c *fiber.Ctx) error {
+	day := time.Now()
+	if value := c.Query("date"); value != "" {
+		var err error
+		if day, err = time.ParseInLocation("2006-01-02", value, time.Local); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid date format. Use YYYY-MM-DD",
+				"error":   err.Error(),
+			})
+		}
+	}
+	from := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local)
+
+	userUUID, _ := utils.GetUserUUIDFromToken(c)
+	data, err := ctl.Sales.Flagged(from, from.AddDate(0, 0, 1), ctl.ScopeProvinces(userUUID))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to fetch the flagged sales",
+			"error":   err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Flagged sales fetched",
+		"data":    data,
+	})
+}
@@ -3,18 +3,17 @@ package Sale
 import (
 	"fmt"
 	"strconv"
+	"time"
 
-	"github.com/Danny19977/sr-api/database"
 	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/repository"
 	"github.com/Danny19977/sr-api/utils"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 )
 
-// Paginate Sale
-func GetPaginatedSale(c *fiber.Ctx) error {
-	db := database.DB
-
+// Paginate Sale, or export every matching sale when format is csv, xlsx or jsonl
+func (ctl *Controller) GetPaginatedSale(c *fiber.Ctx) error {
 	page, err := strconv.Atoi(c.Query("page", "1"))
 	if err != nil || page <= 0 {
 		page = 1
@@ -27,28 +26,26 @@ func GetPaginatedSale(c *fiber.Ctx) error {
 
 	search := c.Query("search", "")
 
-	var dataList []models.Sale
-	var totalRecords int64
+	opts := repository.ListOptions{Search: search, Offset: offset, Limit: limit}
 
 	userUUID, _ := utils.GetUserUUIDFromToken(c)
-	var requestingUser models.User
-	db.Preload("Country").Preload("Province").Where("uuid = ?", userUUID).First(&requestingUser)
+	opts.ProvinceUUIDs = ctl.ScopeProvinces(userUUID)
+	// team=true keeps the sales of the users reporting to the caller
+	if c.QueryBool("team") {
+		if opts.UserUUIDs, err = ctl.Users.Team(userUUID); err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Failed to fetch Sale",
+				"error":   err.Error(),
+			})
+		}
+	}
 
-	countQuery := db.Model(&models.Sale{})
-	query := db.Model(&models.Sale{})
-	if requestingUser.Role == "ASM" {
-		countQuery = countQuery.Where("province_uuid = ?", requestingUser.ProvinceUUID)
-		query = query.Where("province_uuid = ?", requestingUser.ProvinceUUID)
+	if format := c.Query("format"); format != "" {
+		return ctl.exportSales(c, opts, format)
 	}
-	countQuery = countQuery.Where("user_uuid ILIKE ?", "%"+search+"%")
-	countQuery.Count(&totalRecords)
 
-	query = query.Where("user_uuid ILIKE ?", "%"+search+"%")
-	query = query.Offset(offset)
-	query = query.Limit(limit)
-	query = query.Order("updated_at DESC")
-	query = query.Preload("Province").Preload("Product").Preload("User.Country").Preload("User.Province").Preload("Year").Preload("Month").Preload("Week")
-	err = query.Find(&dataList).Error
+	dataList, totalRecords, err := ctl.Sales.List(opts)
 
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
@@ -76,10 +73,8 @@ func GetPaginatedSale(c *fiber.Ctx) error {
 }
 
 // Get All Sale
-func GetAllSale(c *fiber.Ctx) error {
-	db := database.DB
-	var data []models.Sale
-	db.Preload("Province").Preload("Product").Preload("User.Country").Preload("User.Province").Preload("Year").Preload("Month").Preload("Week").Find(&data)
+func (ctl *Controller) GetAllSale(c *fiber.Ctx) error {
+	data, _ := ctl.Sales.All()
 	return c.JSON(fiber.Map{
 		"status":  "success",
 		"message": "All Sale fetched",
@@ -88,11 +83,9 @@ func GetAllSale(c *fiber.Ctx) error {
 }
 
 // Get Sale by Province
-func GetSaleByProvince(c *fiber.Ctx) error {
-	db := database.DB
+func (ctl *Controller) GetSaleByProvince(c *fiber.Ctx) error {
 	provinceUUID := c.Params("province_uuid")
-	var data []models.Sale
-	db.Preload("Province").Preload("Product").Preload("User.Country").Preload("User.Province").Preload("Year").Preload("Month").Preload("Week").Where("province_uuid = ?", provinceUUID).Find(&data)
+	data, _ := ctl.Sales.ByProvince(provinceUUID)
 	return c.JSON(fiber.Map{
 		"status":  "success",
 		"message": "Sale by province fetched",
@@ -101,12 +94,10 @@ func GetSaleByProvince(c *fiber.Ctx) error {
 }
 
 // Get one Sale
-func GetSale(c *fiber.Ctx) error {
+func (ctl *Controller) GetSale(c *fiber.Ctx) error {
 	uuid := c.Params("uuid")
-	db := database.DB
-	var sale models.Sale
-	db.Preload("Province").Preload("Product").Preload("User.Country").Preload("User.Province").Preload("Year").Preload("Month").Preload("Week").Where("uuid = ?", uuid).First(&sale)
-	if sale.UUID == "" {
+	sale, err := ctl.Sales.FindByUUID(uuid)
+	if err != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"status":  "error",
 			"message": "No Sale found",
@@ -121,7 +112,7 @@ func GetSale(c *fiber.Ctx) error {
 }
 
 // Create Sale
-func CreateSale(c *fiber.Ctx) error {
+func (ctl *Controller) CreateSale(c *fiber.Ctx) error {
 	// Debug: Print request headers
 	fmt.Printf("DEBUG: Content-Type: %s\n", c.Get("Content-Type"))
 	fmt.Printf("DEBUG: Request Method: %s\n", c.Method())
@@ -153,7 +144,26 @@ func CreateSale(c *fiber.Ctx) error {
 	fmt.Printf("DEBUG: Signature: '%s'\n", s.Signature)
 
 	s.UUID = uuid.New().String()
-	database.DB.Create(s)
+	if ok, err := ctl.place(c, s); !ok {
+		return err
+	}
+	if ok, err := ctl.fence(c, s); !ok {
+		return err
+	}
+	at := s.CreatedAt
+	if at.IsZero() {
+		at = time.Now()
+	}
+	if ok, err := ctl.screen(c, s, at); !ok {
+		return err
+	}
+	if err := ctl.Sales.Create(s); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to create Sale",
+			"error":   err.Error(),
+		})
+	}
 	return c.JSON(fiber.Map{
 		"status":  "success",
 		"message": "Sale created successfully",
@@ -162,9 +172,8 @@ func CreateSale(c *fiber.Ctx) error {
 }
 
 // Update Sale
-func UpdateSale(c *fiber.Ctx) error {
+func (ctl *Controller) UpdateSale(c *fiber.Ctx) error {
 	uuid := c.Params("uuid")
-	db := database.DB
 
 	type UpdateData struct {
 		UUID         string `json:"uuid"`
@@ -172,6 +181,9 @@ func UpdateSale(c *fiber.Ctx) error {
 		ProductUUID  string `json:"product_uuid"`
 		UserUUID     string `json:"user_uuid"`
 		Quantity     int64  `json:"quantity"`
+		// OutletUUID and TerritoryUUID keep their value when left out
+		OutletUUID    *string `json:"outlet_uuid"`
+		TerritoryUUID *string `json:"territory_uuid"`
 	}
 
 	var updateData UpdateData
@@ -183,14 +195,56 @@ func UpdateSale(c *fiber.Ctx) error {
 		})
 	}
 
-	sale := new(models.Sale)
-	db.Where("uuid = ?", uuid).First(&sale)
+	sale, err := ctl.Sales.FindByUUID(uuid)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"status":  "error",
+			"message": "No Sale found",
+			"data":    nil,
+		})
+	}
+	moved := sale.ProvinceUUID != updateData.ProvinceUUID ||
+		updateData.OutletUUID != nil && deref(updateData.OutletUUID) != deref(sale.OutletUUID) ||
+		updateData.TerritoryUUID != nil && deref(updateData.TerritoryUUID) != deref(sale.TerritoryUUID)
+	changed := moved || sale.ProductUUID != updateData.ProductUUID || sale.Quantity != updateData.Quantity
+	if updateData.OutletUUID != nil {
+		sale.OutletUUID = updateData.OutletUUID
+		// The territory of a sale at an outlet follows the outlet
+		if updateData.TerritoryUUID == nil {
+			sale.TerritoryUUID = nil
+		}
+	}
+	if updateData.TerritoryUUID != nil {
+		sale.TerritoryUUID = updateData.TerritoryUUID
+	}
 	sale.ProvinceUUID = updateData.ProvinceUUID
 	sale.ProductUUID = updateData.ProductUUID
 	sale.UserUUID = updateData.UserUUID
 	sale.Quantity = updateData.Quantity
 
-	db.Save(&sale)
+	// A sale moved elsewhere is placed and fenced again, as on creation
+	if moved {
+		if ok, err := ctl.place(c, sale); !ok {
+			return err
+		}
+		if ok, err := ctl.fence(c, sale); !ok {
+			return err
+		}
+	}
+	// A corrected quantity is checked again and loses its flag when usual
+	if changed {
+		if ok, err := ctl.screen(c, sale, sale.CreatedAt.In(time.Local)); !ok {
+			return err
+		}
+	}
+
+	if err := ctl.Sales.Save(sale); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to update Sale",
+			"error":   err.Error(),
+		})
+	}
 
 	return c.JSON(fiber.Map{
 		"status":  "success",
@@ -200,19 +254,17 @@ func UpdateSale(c *fiber.Ctx) error {
 }
 
 // Delete Sale
-func DeleteSale(c *fiber.Ctx) error {
+func (ctl *Controller) DeleteSale(c *fiber.Ctx) error {
 	uuid := c.Params("uuid")
-	db := database.DB
-	var sale models.Sale
-	db.Where("uuid = ?", uuid).First(&sale)
-	if sale.UUID == "" {
+	sale, err := ctl.Sales.FindByUUID(uuid)
+	if err != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"status":  "error",
 			"message": "No Sale found",
 			"data":    nil,
 		})
 	}
-	db.Delete(&sale)
+	ctl.Sales.Delete(sale)
 	return c.JSON(fiber.Map{
 		"status":  "success",
 		"message": "Sale deleted successfully",
@@ -0,0 +1,92 @@
+package Sale
+
+import (
+	"bufio"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/report"
+	"github.com/Danny19977/sr-api/repository"
+	"github.com/Danny19977/sr-api/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// exportBatch is the number of sales an export reads at a time
+const exportBatch = 500
+
+// saleColumns are the columns of the sales exports
+var saleColumns = []string{
+	"uuid", "created_at", "province_uuid", "province", "product_uuid", "product",
+	"user_uuid", "user", "quantity",
+}
+
+func saleRow(sale *models.Sale) []interface{} {
+	var province, product, user string
+	if sale.Province != nil {
+		province = sale.Province.Name
+	}
+	if sale.Product != nil {
+		product = sale.Product.Name
+	}
+	if sale.User != nil {
+		user = sale.User.Fullname
+	}
+	return []interface{}{
+		sale.UUID, sale.CreatedAt.Format(time.RFC3339), sale.ProvinceUUID, province,
+		sale.ProductUUID, product, sale.UserUUID, user, sale.Quantity,
+	}
+}
+
+// exportSales streams every sale matching opts as a file in format, page and
+// limit are ignored
+func (ctl *Controller) exportSales(c *fiber.Ctx, opts repository.ListOptions, format string) error {
+	if !slices.Contains(report.ExportFormats, format) {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid export format",
+			"error":   fmt.Sprintf("format must be one of %s", strings.Join(report.ExportFormats, ", ")),
+		})
+	}
+
+	filters := map[string]interface{}{"search": opts.Search}
+	if opts.ProvinceUUIDs != nil {
+		filters["province_uuids"] = opts.ProvinceUUIDs
+	}
+	utils.LogExportWithDB(ctl.DB, c, "sales", format, filters)
+
+	c.Set(fiber.HeaderContentType, report.ContentType(format))
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="sales-%s.%s"`, time.Now().Format("2006-01-02"), format))
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		// The status is sent already, a failure truncates the file
+		if err := ctl.writeSales(w, opts, format); err != nil {
+			ctl.Logger.Printf("exporting sales: %v", err)
+		}
+	})
+	return nil
+}
+
+// writeSales writes the sales export to w, flushing after every batch
+func (ctl *Controller) writeSales(w *bufio.Writer, opts repository.ListOptions, format string) error {
+	table, err := report.NewTableWriter(w, format, "Sales", saleColumns)
+	if err != nil {
+		return err
+	}
+	err = ctl.Sales.Each(opts, exportBatch, func(sales []models.Sale) error {
+		for i := range sales {
+			if err := table.WriteRow(saleRow(&sales[i])); err != nil {
+				return err
+			}
+		}
+		return w.Flush()
+	})
+	if err != nil {
+		return err
+	}
+	if err := table.Close(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
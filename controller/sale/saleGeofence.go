@@ -0,0 +1,106 @@
+package Sale
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Danny19977/sr-api/geo"
+	"github.com/Danny19977/sr-api/geofence"
+	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// fence checks the device position sent with sale against its outlet or its
+// province and records the outcome. It answers the request and returns false
+// when the position is invalid, missing while required, or out of the area
+// under the reject policy.
+func (ctl *Controller) fence(c *fiber.Ctx, sale *models.Sale) (bool, error) {
+	cfg := ctl.Config.Geofence
+	if (sale.Latitude == nil) != (sale.Longitude == nil) ||
+		sale.Latitude != nil && !(geo.Point{Latitude: *sale.Latitude, Longitude: *sale.Longitude}).Valid() ||
+		sale.Accuracy != nil && *sale.Accuracy < 0 {
+		return false, c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid location",
+			"error":   "latitude and longitude go together within range, and accuracy must not be negative",
+		})
+	}
+	if sale.Latitude == nil && cfg.RequireLocation {
+		return false, c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid location",
+			"error":   "sales must be sent with the latitude and longitude of the device",
+		})
+	}
+
+	result, err := geofence.New(ctl.App).Check(sale)
+	if err != nil {
+		return false, c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to check the location",
+			"error":   err.Error(),
+		})
+	}
+	if result.Status == geofence.Outside && cfg.Policy == "reject" {
+		return false, c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"status":  "error",
+			"message": "The sale was sent from outside its " + result.Against,
+			"data":    result,
+		})
+	}
+	sale.GeofenceStatus = result.Status
+	sale.GeofenceDistance = result.Distance
+	return true, nil
+}
+
+// Get the sales that failed their geofence check from start_date to end_date,
+// today by default. status lists the statuses to report, outside by default.
+func (ctl *Controller) GetGeofenceFailures(c *fiber.Ctx) error {
+	today := time.Now().Format("2006-01-02")
+	from, err := time.ParseInLocation("2006-01-02", c.Query("start_date", today), time.Local)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid date format. Use YYYY-MM-DD",
+			"error":   err.Error(),
+		})
+	}
+	to, err := time.ParseInLocation("2006-01-02", c.Query("end_date", c.Query("start_date", today)), time.Local)
+	if err != nil || to.Before(from) {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid date format. Use YYYY-MM-DD",
+			"error":   "end_date must be a date on or after start_date",
+		})
+	}
+
+	var statuses []string
+	for _, status := range strings.Split(c.Query("status", geofence.Outside), ",") {
+		switch status = strings.TrimSpace(status); status {
+		case geofence.Outside, geofence.Missing, geofence.Unchecked:
+			statuses = append(statuses, status)
+		default:
+			return c.Status(400).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid status",
+				"error":   "status lists outside, missing or unchecked",
+			})
+		}
+	}
+
+	userUUID, _ := utils.GetUserUUIDFromToken(c)
+	data, err := ctl.Sales.GeofenceFailures(from, to.AddDate(0, 0, 1), statuses, ctl.ScopeProvinces(userUUID))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to fetch the geofence failures",
+			"error":   err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Geofence failures fetched",
+		"data":    data,
+	})
+}
@@ -0,0 +1,89 @@
+package Sale
+
+import (
+	"github.com/Danny19977/sr-api/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// place resolves the territory of sale: a province stands for itself, a
+// district or an outlet sets the province above it, and the outlet of the
+// sale is its territory. It answers the request and returns false when the
+// outlet or the territory is unknown, above the provinces or outside the
+// province of the sale.
+func (ctl *Controller) place(c *fiber.Ctx, sale *models.Sale) (bool, error) {
+	if sale.OutletUUID != nil && *sale.OutletUUID == "" {
+		sale.OutletUUID = nil
+	}
+	if sale.OutletUUID != nil {
+		outlet, err := ctl.Outlets.Find(*sale.OutletUUID)
+		if err != nil {
+			return false, c.Status(400).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid outlet",
+				"error":   "no outlet " + *sale.OutletUUID,
+			})
+		}
+		if sale.TerritoryUUID != nil && *sale.TerritoryUUID != "" && *sale.TerritoryUUID != outlet.UUID {
+			return false, c.Status(400).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid territory",
+				"error":   "the territory of a sale at an outlet is the outlet",
+			})
+		}
+		sale.TerritoryUUID = &outlet.UUID
+	}
+
+	if sale.TerritoryUUID == nil || *sale.TerritoryUUID == "" {
+		sale.TerritoryUUID = nil
+		return true, nil
+	}
+
+	territory, err := ctl.Territories.Find(*sale.TerritoryUUID)
+	if err != nil {
+		return false, c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid territory",
+			"error":   "no territory " + *sale.TerritoryUUID,
+		})
+	}
+	provinceUUID := territory.UUID
+	if territory.Level != models.TerritoryProvince {
+		provinces, err := ctl.Territories.Provinces(territory.UUID)
+		if err != nil {
+			return false, c.Status(500).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Failed to resolve the territory",
+				"error":   err.Error(),
+			})
+		}
+		if territory.Level != models.TerritoryDistrict && territory.Level != models.TerritoryOutlet || len(provinces) != 1 {
+			return false, c.Status(400).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid territory",
+				"error":   "a sale is placed on a province, a district or an outlet",
+			})
+		}
+		provinceUUID = provinces[0]
+	}
+
+	if sale.ProvinceUUID != "" && sale.ProvinceUUID != provinceUUID {
+		return false, c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid territory",
+			"error":   "the territory is outside the province of the sale",
+		})
+	}
+	sale.ProvinceUUID = provinceUUID
+	if territory.Level == models.TerritoryProvince {
+		sale.TerritoryUUID = nil
+	}
+	return true, nil
+}
+
+// deref returns the string s points to, empty when nil
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
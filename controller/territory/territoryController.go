@@ -0,0 +1,345 @@
+package territory
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/repository"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// TerritoryDetail is a node with the path leading to it from its country
+type TerritoryDetail struct {
+	models.Territory
+	Ancestors []models.Territory `json:"ancestors"` // The root first
+	Children  []models.Territory `json:"children"`
+}
+
+// parentOf returns the parent of a node to be placed below parentUUID, nil
+// for a root
+func (ctl *Controller) parentOf(parentUUID string) (*models.Territory, error) {
+	if parentUUID == "" {
+		return nil, nil
+	}
+	return ctl.Territories.Find(parentUUID)
+}
+
+// Get the nodes right below the parent_uuid query, the countries when unset
+func (ctl *Controller) GetChildren(c *fiber.Ctx) error {
+	children, err := ctl.Territories.Children(c.Query("parent_uuid"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to fetch territories",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "All Territories",
+		"data":    children,
+	})
+}
+
+// Get one node with its ancestors and children
+func (ctl *Controller) GetTerritory(c *fiber.Ctx) error {
+	territory, err := ctl.Territories.Find(c.Params("uuid"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"status":  "error",
+			"message": "No Territory found",
+			"data":    nil,
+		})
+	}
+
+	ancestors, err := ctl.Territories.Ancestors(territory.UUID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to fetch territory",
+			"error":   err.Error(),
+		})
+	}
+	children, err := ctl.Territories.Children(territory.UUID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to fetch territory",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Territory found",
+		"data":    TerritoryDetail{Territory: *territory, Ancestors: ancestors, Children: children},
+	})
+}
+
+// Create a region or a district. Countries, provinces and outlets are
+// created through their own routes.
+func (ctl *Controller) CreateTerritory(c *fiber.Ctx) error {
+	type CreateData struct {
+		ParentUUID string `json:"parent_uuid"`
+		Level      string `json:"level"`
+		Name       string `json:"name"`
+	}
+
+	var createData CreateData
+	if err := c.BodyParser(&createData); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Review your input",
+			"error":   err.Error(),
+		})
+	}
+
+	territory := &models.Territory{Level: createData.Level, Name: createData.Name}
+	if territory.Mirrored() {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid territory",
+			"error":   "countries, provinces and outlets are managed through their own routes",
+		})
+	}
+	parent, err := ctl.parentOf(createData.ParentUUID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"status":  "error",
+			"message": "No parent Territory found",
+			"data":    nil,
+		})
+	}
+	if err := territory.Validate(parent); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid territory",
+			"error":   err.Error(),
+		})
+	}
+
+	territory.UUID = uuid.New().String()
+	territory.ParentUUID = &parent.UUID
+	if err := ctl.Territories.Create(territory); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to create territory",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Territory created success",
+		"data":    territory,
+	})
+}
+
+// Rename a region or a district
+func (ctl *Controller) UpdateTerritory(c *fiber.Ctx) error {
+	type UpdateData struct {
+		Name string `json:"name"`
+	}
+
+	var updateData UpdateData
+	if err := c.BodyParser(&updateData); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Review your input",
+			"error":   err.Error(),
+		})
+	}
+
+	territory, err := ctl.Territories.Find(c.Params("uuid"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"status":  "error",
+			"message": "No Territory found",
+			"data":    nil,
+		})
+	}
+	if territory.Mirrored() {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid territory",
+			"error":   "countries, provinces and outlets are renamed through their own routes",
+		})
+	}
+
+	territory.Name = updateData.Name
+	if territory.Name == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid territory",
+			"error":   "name is required",
+		})
+	}
+	if err := ctl.Territories.Save(territory); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to update territory",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Territory updated success",
+		"data":    territory,
+	})
+}
+
+// Move a node and its subtree below another parent. A province only moves
+// within its country and a district within its province.
+func (ctl *Controller) MoveTerritory(c *fiber.Ctx) error {
+	type MoveData struct {
+		ParentUUID string `json:"parent_uuid"`
+	}
+
+	var moveData MoveData
+	if err := c.BodyParser(&moveData); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Review your input",
+			"error":   err.Error(),
+		})
+	}
+
+	territory, err := ctl.Territories.Find(c.Params("uuid"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"status":  "error",
+			"message": "No Territory found",
+			"data":    nil,
+		})
+	}
+	if territory.Level == models.TerritoryCountry || territory.Level == models.TerritoryOutlet {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid move",
+			"error":   "countries have no parent and outlets move through their own routes",
+		})
+	}
+	parent, err := ctl.parentOf(moveData.ParentUUID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"status":  "error",
+			"message": "No parent Territory found",
+			"data":    nil,
+		})
+	}
+	if err := territory.Validate(parent); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid move",
+			"error":   err.Error(),
+		})
+	}
+	if territory.Level == models.TerritoryProvince || territory.Level == models.TerritoryDistrict {
+		if err := ctl.staysIn(territory, parent); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid move",
+				"error":   err.Error(),
+			})
+		}
+	}
+
+	err = ctl.Territories.Move(territory, parent.UUID)
+	if errors.Is(err, repository.ErrTerritoryCycle) {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid move",
+			"error":   err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to move territory",
+			"error":   err.Error(),
+		})
+	}
+
+	territory.ParentUUID = &parent.UUID
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Territory moved success",
+		"data":    territory,
+	})
+}
+
+// staysIn checks that parent lies in the country of a province, or in the
+// province of a district
+func (ctl *Controller) staysIn(territory, parent *models.Territory) error {
+	level := models.TerritoryCountry
+	if territory.Level == models.TerritoryDistrict {
+		level = models.TerritoryProvince
+	}
+
+	ancestors, err := ctl.Territories.Ancestors(territory.UUID)
+	if err != nil {
+		return err
+	}
+	destination, err := ctl.Territories.Ancestors(parent.UUID)
+	if err != nil {
+		return err
+	}
+	destination = append(destination, *parent)
+
+	for _, ancestor := range ancestors {
+		if ancestor.Level != level {
+			continue
+		}
+		for _, node := range destination {
+			if node.UUID == ancestor.UUID {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("a %s stays in its %s", territory.Level, level)
+}
+
+// Delete a region or a district without children
+func (ctl *Controller) DeleteTerritory(c *fiber.Ctx) error {
+	territory, err := ctl.Territories.Find(c.Params("uuid"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"status":  "error",
+			"message": "No Territory found",
+			"data":    nil,
+		})
+	}
+	if territory.Mirrored() {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid territory",
+			"error":   "countries, provinces and outlets are deleted through their own routes",
+		})
+	}
+
+	err = ctl.Territories.Delete(territory)
+	if errors.Is(err, repository.ErrTerritoryNotLeaf) {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid territory",
+			"error":   err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to delete territory",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Territory deleted success",
+		"data":    nil,
+	})
+}
@@ -0,0 +1,111 @@
+package territory_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Danny19977/sr-api/apptest"
+	"github.com/Danny19977/sr-api/models"
+	"github.com/google/uuid"
+)
+
+type territoryResult struct {
+	Data models.Territory `json:"data"`
+}
+
+type rollupResult struct {
+	Territory struct {
+		Total int64 `json:"total"`
+	} `json:"territory"`
+	Children []struct {
+		UUID  string `json:"uuid"`
+		Level string `json:"level"`
+		Total int64  `json:"total"`
+	} `json:"children"`
+}
+
+func TestTerritoryTreeRollsUpSales(t *testing.T) {
+	env := apptest.New(t)
+	admin := env.Token(env.CreateUser("Admin", nil))
+
+	country := &models.Country{UUID: uuid.New().String(), Name: "Country " + uuid.New().String()[:8]}
+	if err := env.App.Geography.CreateCountry(country); err != nil {
+		t.Fatal(err)
+	}
+	north := &models.Province{UUID: uuid.New().String(), Name: "North " + uuid.New().String()[:8], CountryUUID: country.UUID}
+	south := &models.Province{UUID: uuid.New().String(), Name: "South " + uuid.New().String()[:8], CountryUUID: country.UUID}
+	for _, province := range []*models.Province{north, south} {
+		if err := env.App.Geography.CreateProvince(province); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var region, district territoryResult
+	resp := env.Do(http.MethodPost, "/api/territories/create", admin, map[string]string{"parent_uuid": country.UUID, "level": "region", "name": "Upland"})
+	if err := resp.JSON(&region); err != nil || resp.Status != http.StatusOK {
+		t.Fatalf("got status %d: %s", resp.Status, resp.Body)
+	}
+	if resp := env.Do(http.MethodPut, "/api/territories/move/"+north.UUID, admin, map[string]string{"parent_uuid": region.Data.UUID}); resp.Status != http.StatusOK {
+		t.Fatalf("got status %d moving the province: %s", resp.Status, resp.Body)
+	}
+	resp = env.Do(http.MethodPost, "/api/territories/create", admin, map[string]string{"parent_uuid": north.UUID, "level": "district", "name": "Harbour"})
+	if err := resp.JSON(&district); err != nil || resp.Status != http.StatusOK {
+		t.Fatalf("got status %d: %s", resp.Status, resp.Body)
+	}
+
+	// A region cannot go below a district, nor a country below anything
+	if resp := env.Do(http.MethodPut, "/api/territories/move/"+region.Data.UUID, admin, map[string]string{"parent_uuid": district.Data.UUID}); resp.Status != http.StatusBadRequest {
+		t.Errorf("got status %d moving a region below a district, want 400", resp.Status)
+	}
+	if resp := env.Do(http.MethodDelete, "/api/territories/delete/"+region.Data.UUID, admin, nil); resp.Status != http.StatusBadRequest {
+		t.Errorf("got status %d deleting a region with children, want 400", resp.Status)
+	}
+
+	product := models.Product{UUID: uuid.New().String(), Name: "Cola"}
+	if err := env.App.DB.Create(&product).Error; err != nil {
+		t.Fatal(err)
+	}
+	user := env.CreateUser("Admin", nil)
+	// The sale on the district is placed in its province
+	sale := map[string]interface{}{"product_uuid": product.UUID, "user_uuid": user.UUID, "quantity": 7, "territory_uuid": district.Data.UUID}
+	if resp := env.Do(http.MethodPost, "/api/sales/create?confirm=true", admin, sale); resp.Status != http.StatusOK {
+		t.Fatalf("got status %d: %s", resp.Status, resp.Body)
+	}
+	sale = map[string]interface{}{"product_uuid": product.UUID, "user_uuid": user.UUID, "quantity": 3, "province_uuid": south.UUID, "territory_uuid": district.Data.UUID}
+	if resp := env.Do(http.MethodPost, "/api/sales/create?confirm=true", admin, sale); resp.Status != http.StatusBadRequest {
+		t.Errorf("got status %d placing a sale outside its province, want 400", resp.Status)
+	}
+	if err := env.App.Sales.Create(&models.Sale{UUID: uuid.New().String(), CreatedAt: time.Now(), ProvinceUUID: south.UUID, ProductUUID: product.UUID, UserUUID: user.UUID, Quantity: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	today := time.Now().Format("2006-01-02")
+	var rollup rollupResult
+	resp = env.Do(http.MethodGet, "/api/dashboard/territory?territory_uuid="+country.UUID+"&start_date="+today+"&end_date="+today, admin, nil)
+	if err := resp.JSON(&rollup); err != nil || resp.Status != http.StatusOK {
+		t.Fatalf("got status %d: %s", resp.Status, resp.Body)
+	}
+	if rollup.Territory.Total != 10 || len(rollup.Children) != 2 {
+		t.Fatalf("got %+v, want 10 sold in the country and two children", rollup)
+	}
+	for _, child := range rollup.Children {
+		if child.Level == "region" && child.Total != 7 || child.Level == "province" && child.Total != 3 {
+			t.Errorf("got %d sold in the %s, want the district sale in the region and the rest in South", child.Total, child.Level)
+		}
+	}
+
+	// An ASM of South cannot drill into the region
+	asm := env.Token(env.CreateUser("ASM", &south.UUID))
+	if resp := env.Do(http.MethodGet, "/api/dashboard/territory?territory_uuid="+region.Data.UUID, asm, nil); resp.Status != http.StatusForbidden {
+		t.Errorf("got status %d for an ASM outside the region, want 403", resp.Status)
+	}
+
+	// Removing the province drops its subtree
+	if err := env.App.Geography.DeleteProvince(north); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.App.Territories.Find(district.Data.UUID); err == nil {
+		t.Error("the district of a deleted province was kept")
+	}
+}
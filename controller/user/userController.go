@@ -1,18 +1,17 @@
 package user
 
 import (
+	"errors"
 	"strconv"
 
-	"github.com/Danny19977/sr-api/database"
 	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/repository"
 	"github.com/Danny19977/sr-api/utils"
 	"github.com/gofiber/fiber/v2"
 )
 
 // Paginate
-func GetPaginatedUsers(c *fiber.Ctx) error {
-	db := database.DB
-
+func (ctl *Controller) GetPaginatedUsers(c *fiber.Ctx) error {
 	// Parse query parameters for pagination
 	page, err := strconv.Atoi(c.Query("page", "1"))
 	if err != nil || page <= 0 {
@@ -27,38 +26,29 @@ func GetPaginatedUsers(c *fiber.Ctx) error {
 	// Parse search query
 	search := c.Query("search", "")
 
-	var users []models.User
-	var totalRecords int64
+	opts := repository.ListOptions{Search: search, Offset: offset, Limit: limit}
 
-	// Get user UUID from JWT
+	// Get user UUID from JWT; ASM only see the users of their province
 	userUUID, _ := utils.GetUserUUIDFromToken(c)
-	var requestingUser models.User
-	db.Preload("Country").Preload("Province").Where("uuid = ?", userUUID).First(&requestingUser)
-
-	query := db.Model(&models.User{})
-	if requestingUser.Role == "ASM" {
-		query = query.Where("province_uuid = ?", requestingUser.ProvinceUUID)
+	if requestingUser, err := ctl.Users.FindByUUID(userUUID); err == nil && requestingUser.Role == "ASM" {
+		opts.ProvinceUUID = requestingUser.ProvinceUUID
+		if opts.ProvinceUUID == nil {
+			opts.ProvinceUUID = new(string)
+		}
 	}
-	query = query.Where("fullname ILIKE ? OR title ILIKE ?", "%"+search+"%", "%"+search+"%")
-	query.Count(&totalRecords)
-
-	// Use the same query for fetching users
-	query = query.Preload("Country").Preload("Province").
-		Offset(offset).
-		Limit(limit).
-		Order("users.updated_at DESC")
-	err = query.Find(&users).Error
-	// If ASM, filter users by province
-	if requestingUser.Role == "ASM" {
-		filtered := []models.User{}
-		for _, u := range users {
-			if u.ProvinceUUID != nil && requestingUser.ProvinceUUID != nil && *u.ProvinceUUID == *requestingUser.ProvinceUUID {
-				filtered = append(filtered, u)
-			}
+	// team=true keeps the users reporting to the caller
+	if c.QueryBool("team") {
+		if opts.UserUUIDs, err = ctl.Users.Team(userUUID); err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Failed to fetch Users",
+				"error":   err.Error(),
+			})
 		}
-		users = filtered
 	}
 
+	users, totalRecords, err := ctl.Users.List(opts)
+
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
@@ -82,14 +72,12 @@ func GetPaginatedUsers(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{
 		"status":     "success",
 		"message":    "Users retrieved successfully",
-		"data":       users,
+		"data":       models.ToUserPaginates(users),
 		"pagination": pagination,
 	})
 }
 
-func GetPaginatedNoSerach(c *fiber.Ctx) error {
-	db := database.DB
-
+func (ctl *Controller) GetPaginatedNoSerach(c *fiber.Ctx) error {
 	// Parse query parameters for pagination
 	page, err := strconv.Atoi(c.Query("page", "1"))
 	if err != nil || page <= 0 {
@@ -100,19 +88,8 @@ func GetPaginatedNoSerach(c *fiber.Ctx) error {
 		limit = 15
 	}
 	offset := (page - 1) * limit
-	var users []models.User
-	var totalRecords int64
 
-	// Count total records matching the search query
-	db.Model(&models.User{}).
-		Count(&totalRecords)
-
-	err = db.
-		Preload("Country").Preload("Province").
-		Offset(offset).
-		Limit(limit).
-		Order("users.updated_at DESC").
-		Find(&users).Error
+	users, totalRecords, err := ctl.Users.List(repository.ListOptions{Offset: offset, Limit: limit})
 
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
@@ -137,30 +114,26 @@ func GetPaginatedNoSerach(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{
 		"status":     "success",
 		"message":    "Users retrieved successfully",
-		"data":       users,
+		"data":       models.ToUserPaginates(users),
 		"pagination": pagination,
 	})
 }
 
 // query all data
-func GetAllUsers(c *fiber.Ctx) error {
-	db := database.DB
-	var users []models.User
-	db.Preload("Country").Preload("Province").Find(&users)
+func (ctl *Controller) GetAllUsers(c *fiber.Ctx) error {
+	users, _ := ctl.Users.All()
 	return c.JSON(fiber.Map{
 		"status":  "success",
 		"message": "All users",
-		"data":    users,
+		"data":    models.ToUserResponses(users),
 	})
 }
 
 // Get one data
-func GetUser(c *fiber.Ctx) error {
+func (ctl *Controller) GetUser(c *fiber.Ctx) error {
 	uuid := c.Params("uuid")
-	db := database.DB
-	var user models.User
-	db.Preload("Country").Preload("Province").Where("uuid = ?", uuid).First(&user)
-	if user.Fullname == "" {
+	user, err := ctl.Users.FindByUUID(uuid)
+	if err != nil {
 		return c.Status(404).JSON(
 			fiber.Map{
 				"status":  "error",
@@ -173,13 +146,13 @@ func GetUser(c *fiber.Ctx) error {
 		fiber.Map{
 			"status":  "success",
 			"message": "User found",
-			"data":    user,
+			"data":    user.ToUserResponse(),
 		},
 	)
 }
 
 // Create data
-func CreateUser(c *fiber.Ctx) error {
+func (ctl *Controller) CreateUser(c *fiber.Ctx) error {
 	type UserInput struct {
 		FullName        string `json:"fullname"`
 		Email           string `json:"email"`
@@ -194,6 +167,8 @@ func CreateUser(c *fiber.Ctx) error {
 		CountryUUID     string `json:"country_uuid"`
 		ProvinceUUID    string `json:"province_uuid"`
 		AreaUUID        string `json:"area_uuid"`
+		TerritoryUUID   string `json:"territory_uuid"`
+		ManagerUUID     string `json:"manager_uuid"`
 
 		HeadUUID string `json:"head_uuid"`
 
@@ -223,19 +198,29 @@ func CreateUser(c *fiber.Ctx) error {
 		})
 	}
 
-	user := &models.User{
-		Fullname:     p.FullName,
-		Email:        p.Email,
-		Phone:        p.Phone,
-		Role:         p.Role,
-		Permission:   p.Permission,
-		Status:       p.Status,
-		CountryUUID:  stringToPointer(p.CountryUUID),
-		ProvinceUUID: stringToPointer(p.ProvinceUUID),
-		Signature:    p.Signature,
+	if p.Role == "Admin" && !ctl.callerIsAdmin(c) {
+		return c.Status(403).JSON(
+			fiber.Map{
+				"status":  "error",
+				"message": "Only admins grant the Admin role",
+				"data":    nil,
+			},
+		)
 	}
 
-	user.SetPassword(p.Password)
+	user := &models.User{
+		Fullname:      p.FullName,
+		Email:         p.Email,
+		Phone:         p.Phone,
+		Role:          p.Role,
+		Permission:    p.Permission,
+		Status:        p.Status,
+		CountryUUID:   stringToPointer(p.CountryUUID),
+		ProvinceUUID:  stringToPointer(p.ProvinceUUID),
+		TerritoryUUID: stringToPointer(p.TerritoryUUID),
+		ManagerUUID:   stringToPointer(p.ManagerUUID),
+		Signature:     p.Signature,
+	}
 
 	if err := utils.ValidateStruct(*user); err != nil {
 		c.Status(400)
@@ -246,22 +231,46 @@ func CreateUser(c *fiber.Ctx) error {
 
 	user.Sync = true
 
-	database.DB.Create(user)
+	if err := ctl.Users.Create(user, p.Password); errors.Is(err, repository.ErrManagerCycle) || errors.Is(err, repository.ErrManagerNotFound) {
+		return c.Status(400).JSON(
+			fiber.Map{
+				"status":  "error",
+				"message": "Invalid manager",
+				"error":   err.Error(),
+			},
+		)
+	} else if err != nil {
+		return c.Status(500).JSON(
+			fiber.Map{
+				"status":  "error",
+				"message": "Failed to create User",
+				"error":   err.Error(),
+			},
+		)
+	}
 
 	// Log user creation activity
-	utils.LogCreateWithDB(database.DB, c, "user", user.Fullname, user.UUID)
-
-	// }
+	utils.LogCreateWithDB(ctl.DB, c, "user", user.Fullname, user.UUID)
 
 	return c.JSON(
 		fiber.Map{
 			"status":  "success",
 			"message": "User Created success",
-			"data":    user,
+			"data":    user.ToUserResponse(),
 		},
 	)
 }
 
+// callerIsAdmin reports whether the user of the request token is an admin
+func (ctl *Controller) callerIsAdmin(c *fiber.Ctx) bool {
+	userUUID, err := utils.GetUserUUIDFromToken(c)
+	if err != nil {
+		return false
+	}
+	caller, err := ctl.Users.FindByUUID(userUUID)
+	return err == nil && caller.Role == "Admin"
+}
+
 // Helper function to convert string to *string (handles empty strings as nil)
 func stringToPointer(s string) *string {
 	if s == "" {
@@ -271,9 +280,8 @@ func stringToPointer(s string) *string {
 }
 
 // Update data
-func UpdateUser(c *fiber.Ctx) error {
+func (ctl *Controller) UpdateUser(c *fiber.Ctx) error {
 	uuid := c.Params("uuid")
-	db := database.DB
 
 	type UpdateDataInput struct {
 		FullName        string `json:"fullname"`
@@ -289,6 +297,8 @@ func UpdateUser(c *fiber.Ctx) error {
 		CountryUUID     string `json:"country_uuid"`
 		ProvinceUUID    string `json:"province_uuid"`
 		AreaUUID        string `json:"area_uuid"`
+		TerritoryUUID   string `json:"territory_uuid"`
+		ManagerUUID     string `json:"manager_uuid"`
 		HeadUUID        string `json:"head_uuid"`
 		Signature       string `json:"signature"`
 	}
@@ -305,9 +315,25 @@ func UpdateUser(c *fiber.Ctx) error {
 		)
 	}
 
-	user := new(models.User)
-
-	db.Where("uuid = ?", uuid).First(&user)
+	user, err := ctl.Users.FindByUUID(uuid)
+	if err != nil {
+		return c.Status(404).JSON(
+			fiber.Map{
+				"status":  "error",
+				"message": "No User name found",
+				"data":    nil,
+			},
+		)
+	}
+	if updateData.Role != user.Role && (updateData.Role == "Admin" || user.Role == "Admin") && !ctl.callerIsAdmin(c) {
+		return c.Status(403).JSON(
+			fiber.Map{
+				"status":  "error",
+				"message": "Only admins grant or revoke the Admin role",
+				"data":    nil,
+			},
+		)
+	}
 	user.Fullname = updateData.FullName
 	user.Email = updateData.Email
 	user.Phone = updateData.Phone
@@ -317,28 +343,43 @@ func UpdateUser(c *fiber.Ctx) error {
 	user.Status = updateData.Status
 	user.CountryUUID = stringToPointer(updateData.CountryUUID)
 	user.ProvinceUUID = stringToPointer(updateData.ProvinceUUID)
+	user.TerritoryUUID = stringToPointer(updateData.TerritoryUUID)
+	user.ManagerUUID = stringToPointer(updateData.ManagerUUID)
 	user.Signature = updateData.Signature
 
-	db.Save(&user)
+	if err := ctl.Users.Save(user); errors.Is(err, repository.ErrManagerCycle) || errors.Is(err, repository.ErrManagerNotFound) {
+		return c.Status(400).JSON(
+			fiber.Map{
+				"status":  "error",
+				"message": "Invalid manager",
+				"error":   err.Error(),
+			},
+		)
+	} else if err != nil {
+		return c.Status(500).JSON(
+			fiber.Map{
+				"status":  "error",
+				"message": "Failed to update User",
+				"error":   err.Error(),
+			},
+		)
+	}
 
 	return c.JSON(
 		fiber.Map{
 			"status":  "success",
 			"message": "User updated success",
-			"data":    user,
+			"data":    user.ToUserResponse(),
 		},
 	)
 }
 
 // Delete data
-func DeleteUser(c *fiber.Ctx) error {
+func (ctl *Controller) DeleteUser(c *fiber.Ctx) error {
 	uuid := c.Params("uuid")
 
-	db := database.DB
-
-	var User models.User
-	db.Where("uuid = ?", uuid).First(&User)
-	if User.Fullname == "" {
+	User, err := ctl.Users.FindByUUID(uuid)
+	if err != nil {
 		return c.Status(404).JSON(
 			fiber.Map{
 				"status":  "error",
@@ -348,7 +389,7 @@ func DeleteUser(c *fiber.Ctx) error {
 		)
 	}
 
-	db.Delete(&User)
+	ctl.Users.Delete(User)
 
 	return c.JSON(
 		fiber.Map{
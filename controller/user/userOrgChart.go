@@ -0,0 +1,127 @@
+package user
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// OrgNode is a user of the org chart with the users reporting to them
+type OrgNode struct {
+	UUID         string    `json:"uuid"`
+	Fullname     string    `json:"fullname"`
+	Title        string    `json:"title"`
+	Role         string    `json:"role"`
+	ProvinceUUID *string   `json:"province_uuid"`
+	Status       bool      `json:"status"`
+	Reports      []OrgNode `json:"reports"`
+}
+
+// orgTree builds the node of user and the nodes below it from the reports
+// of each manager, skipping the users already placed
+func orgTree(user models.User, reports map[string][]models.User, placed map[string]bool) OrgNode {
+	placed[user.UUID] = true
+	node := OrgNode{
+		UUID:         user.UUID,
+		Fullname:     user.Fullname,
+		Title:        user.Title,
+		Role:         user.Role,
+		ProvinceUUID: user.ProvinceUUID,
+		Status:       user.Status,
+		Reports:      []OrgNode{},
+	}
+	for _, report := range reports[user.UUID] {
+		if !placed[report.UUID] {
+			node.Reports = append(node.Reports, orgTree(report, reports, placed))
+		}
+	}
+	return node
+}
+
+// Get the org chart from the users at the top of the hierarchy, or from the
+// user of root_uuid. An ASM sees their own team only.
+func (ctl *Controller) GetOrgChart(c *fiber.Ctx) error {
+	rootUUID := c.Query("root_uuid")
+
+	userUUID, _ := utils.GetUserUUIDFromToken(c)
+	if requestingUser, err := ctl.Users.FindByUUID(userUUID); err == nil && requestingUser.Role == "ASM" {
+		if rootUUID == "" {
+			rootUUID = requestingUser.UUID
+		}
+		team, err := ctl.Users.Team(requestingUser.UUID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Failed to fetch the org chart",
+				"error":   err.Error(),
+			})
+		}
+		if rootUUID != requestingUser.UUID && !slices.Contains(team, rootUUID) {
+			return c.Status(403).JSON(fiber.Map{
+				"status":  "error",
+				"message": "User outside your team",
+				"data":    nil,
+			})
+		}
+	}
+
+	users, err := ctl.Users.All()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to fetch the org chart",
+			"error":   err.Error(),
+		})
+	}
+	slices.SortFunc(users, func(a, b models.User) int {
+		return strings.Compare(a.Fullname, b.Fullname)
+	})
+
+	byUUID := make(map[string]models.User, len(users))
+	for _, user := range users {
+		byUUID[user.UUID] = user
+	}
+	reports := make(map[string][]models.User)
+	for _, user := range users {
+		if user.ManagerUUID != nil {
+			reports[*user.ManagerUUID] = append(reports[*user.ManagerUUID], user)
+		}
+	}
+
+	placed := make(map[string]bool, len(users))
+	chart := []OrgNode{}
+	if rootUUID != "" {
+		root, ok := byUUID[rootUUID]
+		if !ok {
+			return c.Status(404).JSON(fiber.Map{
+				"status":  "error",
+				"message": "No User name found",
+				"data":    nil,
+			})
+		}
+		chart = append(chart, orgTree(root, reports, placed))
+	} else {
+		for _, user := range users {
+			if _, managed := byUUID[deref(user.ManagerUUID)]; !managed {
+				chart = append(chart, orgTree(user, reports, placed))
+			}
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Org chart",
+		"data":    chart,
+	})
+}
+
+// deref returns the string s points to, empty when nil
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
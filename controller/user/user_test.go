@@ -0,0 +1,101 @@
+package user_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Danny19977/sr-api/apptest"
+	"github.com/Danny19977/sr-api/controller/user"
+	"github.com/Danny19977/sr-api/models"
+	"github.com/google/uuid"
+)
+
+// reportTo makes report report to manager through the update route
+func reportTo(t *testing.T, env *apptest.Env, token string, report, manager *models.User) *apptest.Response {
+	t.Helper()
+	return env.Do(http.MethodPut, "/api/users/update/"+report.UUID, token, map[string]interface{}{
+		"fullname":     report.Fullname,
+		"email":        report.Email,
+		"role":         report.Role,
+		"status":       true,
+		"manager_uuid": manager.UUID,
+	})
+}
+
+func TestReportingLinesAndTeams(t *testing.T) {
+	env := apptest.New(t)
+	admin := env.CreateUser("Admin", nil)
+	token := env.Token(admin)
+
+	head := env.CreateUser("Manager", nil)
+	lead := env.CreateUser("Supervisor", nil)
+	asm := env.CreateUser("ASM", nil)
+	outsider := env.CreateUser("ASM", nil)
+	for _, line := range [][2]*models.User{{lead, head}, {asm, lead}} {
+		if resp := reportTo(t, env, token, line[0], line[1]); resp.Status != http.StatusOK {
+			t.Fatalf("got status %d: %s", resp.Status, resp.Body)
+		}
+	}
+
+	// The head cannot report to someone below them, nor anyone to a stranger
+	if resp := reportTo(t, env, token, head, asm); resp.Status != http.StatusBadRequest {
+		t.Errorf("got status %d for a cycle, want 400", resp.Status)
+	}
+	if resp := reportTo(t, env, token, head, head); resp.Status != http.StatusBadRequest {
+		t.Errorf("got status %d for a user reporting to themselves, want 400", resp.Status)
+	}
+	if resp := reportTo(t, env, token, head, &models.User{UUID: uuid.New().String()}); resp.Status != http.StatusBadRequest {
+		t.Errorf("got status %d for an unknown manager, want 400", resp.Status)
+	}
+
+	var chart struct {
+		Data []user.OrgNode `json:"data"`
+	}
+	if err := env.Do(http.MethodGet, "/api/users/org-chart?root_uuid="+head.UUID, token, nil).JSON(&chart); err != nil {
+		t.Fatal(err)
+	}
+	if len(chart.Data) != 1 || len(chart.Data[0].Reports) != 1 || chart.Data[0].Reports[0].UUID != lead.UUID ||
+		len(chart.Data[0].Reports[0].Reports) != 1 || chart.Data[0].Reports[0].Reports[0].UUID != asm.UUID {
+		t.Errorf("got %+v, want head > lead > asm", chart.Data)
+	}
+	if resp := env.Do(http.MethodGet, "/api/users/org-chart?root_uuid="+head.UUID, env.Token(asm), nil); resp.Status != http.StatusForbidden {
+		t.Errorf("got status %d for an ASM reading above them, want 403", resp.Status)
+	}
+
+	// The team of the head reaches the ASM through the lead
+	headToken := env.Token(head)
+	var users struct {
+		Data []models.UserPaginate `json:"data"`
+	}
+	if err := env.Do(http.MethodGet, "/api/users/all/paginate?team=true", headToken, nil).JSON(&users); err != nil {
+		t.Fatal(err)
+	}
+	if len(users.Data) != 2 {
+		t.Errorf("got %d users in the team, want the lead and the ASM", len(users.Data))
+	}
+
+	for _, seller := range []*models.User{asm, outsider} {
+		err := env.App.Sales.Create(&models.Sale{UUID: uuid.New().String(), ProvinceUUID: uuid.New().String(), ProductUUID: uuid.New().String(), UserUUID: seller.UUID, Quantity: 5})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var sales struct {
+		Data []models.Sale `json:"data"`
+	}
+	if err := env.Do(http.MethodGet, "/api/sales/all/paginate?team=true", headToken, nil).JSON(&sales); err != nil {
+		t.Fatal(err)
+	}
+	if len(sales.Data) != 1 || sales.Data[0].UserUUID != asm.UUID {
+		t.Errorf("got %d sales, want the sale of the ASM alone", len(sales.Data))
+	}
+
+	// Deleting the lead hands the ASM over to the head
+	if resp := env.Do(http.MethodDelete, "/api/users/delete/"+lead.UUID, token, nil); resp.Status != http.StatusOK {
+		t.Fatalf("got status %d: %s", resp.Status, resp.Body)
+	}
+	moved, err := env.App.Users.FindByUUID(asm.UUID)
+	if err != nil || moved.ManagerUUID == nil || *moved.ManagerUUID != head.UUID {
+		t.Errorf("got manager %v, want the head", moved.ManagerUUID)
+	}
+}
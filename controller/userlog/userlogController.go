@@ -3,15 +3,14 @@ package userlog
 import (
 	"strconv"
 
-	"github.com/Danny19977/sr-api/database"
 	"github.com/Danny19977/sr-api/models"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 )
 
 // Paginate
-func GetPaginatedUserLogs(c *fiber.Ctx) error {
-	db := database.DB
+func (ctl *Controller) GetPaginatedUserLogs(c *fiber.Ctx) error {
+	db := ctl.DB
 
 	// Parse query parameters for pagination
 	page, err := strconv.Atoi(c.Query("page", "1"))
@@ -71,8 +70,8 @@ func GetPaginatedUserLogs(c *fiber.Ctx) error {
 }
 
 // query data
-func GetUserLogByID(c *fiber.Ctx) error {
-	db := database.DB
+func (ctl *Controller) GetUserLogByID(c *fiber.Ctx) error {
+	db := ctl.DB
 	UserUUID := c.Params("user_uuid")
 
 	// Parse query parameters for pagination
@@ -138,9 +137,9 @@ func GetUserLogByID(c *fiber.Ctx) error {
 }
 
 // Get All data
-func GetUserLogs(c *fiber.Ctx) error {
+func (ctl *Controller) GetUserLogs(c *fiber.Ctx) error {
 
-	db := database.DB
+	db := ctl.DB
 	var data []models.UserLogs
 	db.Find(&data)
 	return c.JSON(fiber.Map{
@@ -151,9 +150,9 @@ func GetUserLogs(c *fiber.Ctx) error {
 }
 
 // Get one data
-func GetUserLog(c *fiber.Ctx) error {
+func (ctl *Controller) GetUserLog(c *fiber.Ctx) error {
 	uuid := c.Params("uuid")
-	db := database.DB
+	db := ctl.DB
 	var user_logs models.UserLogs
 	db.Where("uuid = ?", uuid).First(&user_logs)
 	if user_logs.Name == "" {
@@ -175,7 +174,7 @@ func GetUserLog(c *fiber.Ctx) error {
 }
 
 // Create data
-func CreateUserLog(c *fiber.Ctx) error {
+func (ctl *Controller) CreateUserLog(c *fiber.Ctx) error {
 	p := &models.UserLogs{}
 
 	if err := c.BodyParser(&p); err != nil {
@@ -183,7 +182,7 @@ func CreateUserLog(c *fiber.Ctx) error {
 	}
 
 	p.UUID = uuid.New().String()
-	database.DB.Create(p)
+	ctl.DB.Create(p)
 
 	return c.JSON(
 		fiber.Map{
@@ -195,9 +194,9 @@ func CreateUserLog(c *fiber.Ctx) error {
 }
 
 // Update data
-func UpdateUserLog(c *fiber.Ctx) error {
+func (ctl *Controller) UpdateUserLog(c *fiber.Ctx) error {
 	uuid := c.Params("uuid")
-	db := database.DB
+	db := ctl.DB
 
 	type UpdateData struct {
 		UUID string `json:"uuid"`
@@ -243,10 +242,10 @@ func UpdateUserLog(c *fiber.Ctx) error {
 }
 
 // Delete data
-func DeleteUserLog(c *fiber.Ctx) error {
+func (ctl *Controller) DeleteUserLog(c *fiber.Ctx) error {
 	uuid := c.Params("uuid")
 
-	db := database.DB
+	db := ctl.DB
 
 	var user_logs models.UserLogs
 	db.Where("uuid = ?", uuid).First(&user_logs)
@@ -0,0 +1,314 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/repository"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// webhookInput is the body of the create and update requests, fields left
+// out keep their current value on update
+type webhookInput struct {
+	Name       *string  `json:"name"`
+	URL        *string  `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Active     *bool    `json:"active"`
+}
+
+func (in webhookInput) apply(subscription *models.WebhookSubscription) {
+	if in.Name != nil {
+		subscription.Name = strings.TrimSpace(*in.Name)
+	}
+	if in.URL != nil {
+		subscription.URL = strings.TrimSpace(*in.URL)
+	}
+	if in.EventTypes != nil {
+		subscription.EventTypes = strings.Join(in.EventTypes, ",")
+	}
+	if in.Active != nil {
+		subscription.Active = *in.Active
+	}
+}
+
+// newSecret returns a random signing secret
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// pageParams reads the page and limit query parameters
+func pageParams(c *fiber.Ctx) (int, int) {
+	page, err := strconv.Atoi(c.Query("page", "1"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(c.Query("limit", "15"))
+	if err != nil || limit <= 0 {
+		limit = 15
+	}
+	return page, limit
+}
+
+func pagination(totalRecords int64, page, limit int) map[string]interface{} {
+	return map[string]interface{}{
+		"total_records": totalRecords,
+		"total_pages":   int((totalRecords + int64(limit) - 1) / int64(limit)),
+		"current_page":  page,
+		"page_size":     limit,
+	}
+}
+
+// Get the event types a subscription may ask for
+func (ctl *Controller) GetEventTypes(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Webhook event types",
+		"data":    models.WebhookEventTypes,
+	})
+}
+
+// Paginate Webhooks
+func (ctl *Controller) GetPaginatedWebhooks(c *fiber.Ctx) error {
+	page, limit := pageParams(c)
+	opts := repository.ListOptions{Search: c.Query("search", ""), Offset: (page - 1) * limit, Limit: limit}
+
+	dataList, totalRecords, err := ctl.Webhooks.ListSubscriptions(opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to fetch webhooks",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":     "success",
+		"message":    "Get all webhooks paginate success",
+		"data":       dataList,
+		"pagination": pagination(totalRecords, page, limit),
+	})
+}
+
+// Get one Webhook
+func (ctl *Controller) GetWebhook(c *fiber.Ctx) error {
+	subscription, err := ctl.Webhooks.FindSubscription(c.Params("uuid"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"status":  "error",
+			"message": "No webhook found",
+			"data":    nil,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Webhook found",
+		"data":    subscription,
+	})
+}
+
+// Create Webhook, the signing secret is only returned here
+func (ctl *Controller) CreateWebhook(c *fiber.Ctx) error {
+	var input webhookInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid request body",
+			"error":   err.Error(),
+		})
+	}
+
+	p := &models.WebhookSubscription{UUID: uuid.New().String(), Active: true}
+	input.apply(p)
+	if err := p.Validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid webhook",
+			"error":   err.Error(),
+		})
+	}
+
+	secret, err := newSecret()
+	if err == nil {
+		p.Secret = secret
+		err = ctl.Webhooks.CreateSubscription(p)
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to create webhook",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Webhook created success",
+		"data":    p,
+		"secret":  p.Secret,
+	})
+}
+
+// Update Webhook
+func (ctl *Controller) UpdateWebhook(c *fiber.Ctx) error {
+	subscription, err := ctl.Webhooks.FindSubscription(c.Params("uuid"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"status":  "error",
+			"message": "No webhook found",
+			"data":    nil,
+		})
+	}
+
+	var input webhookInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Review your input",
+			"error":   err.Error(),
+		})
+	}
+	input.apply(subscription)
+	if err := subscription.Validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid webhook",
+			"error":   err.Error(),
+		})
+	}
+
+	if err := ctl.Webhooks.SaveSubscription(subscription); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to update webhook",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Webhook updated success",
+		"data":    subscription,
+	})
+}
+
+// Rotate the signing secret of a Webhook
+func (ctl *Controller) RotateSecret(c *fiber.Ctx) error {
+	subscription, err := ctl.Webhooks.FindSubscription(c.Params("uuid"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"status":  "error",
+			"message": "No webhook found",
+			"data":    nil,
+		})
+	}
+
+	secret, err := newSecret()
+	if err == nil {
+		subscription.Secret = secret
+		err = ctl.Webhooks.SaveSubscription(subscription)
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to rotate the webhook secret",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Webhook secret rotated",
+		"data":    subscription,
+		"secret":  subscription.Secret,
+	})
+}
+
+// Delete Webhook with its delivery log
+func (ctl *Controller) DeleteWebhook(c *fiber.Ctx) error {
+	subscription, err := ctl.Webhooks.FindSubscription(c.Params("uuid"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"status":  "error",
+			"message": "No webhook found",
+			"data":    nil,
+		})
+	}
+
+	if err := ctl.Webhooks.DeleteSubscription(subscription); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to delete webhook",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Webhook deleted success",
+		"data":    nil,
+	})
+}
+
+// Paginate the delivery log of a Webhook
+func (ctl *Controller) GetWebhookDeliveries(c *fiber.Ctx) error {
+	page, limit := pageParams(c)
+	opts := repository.DeliveryListOptions{
+		ListOptions: repository.ListOptions{Offset: (page - 1) * limit, Limit: limit},
+		Status:      c.Query("status"),
+		EventType:   c.Query("event_type"),
+	}
+
+	dataList, totalRecords, err := ctl.Webhooks.Deliveries(c.Params("uuid"), opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to fetch webhook deliveries",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":     "success",
+		"message":    "Get webhook deliveries success",
+		"data":       dataList,
+		"pagination": pagination(totalRecords, page, limit),
+	})
+}
+
+// Replay a delivery, the payload is sent again as a new delivery
+func (ctl *Controller) ReplayDelivery(c *fiber.Ctx) error {
+	delivery, err := ctl.Webhooks.FindDelivery(c.Params("uuid"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"status":  "error",
+			"message": "No webhook delivery found",
+			"data":    nil,
+		})
+	}
+
+	replay, err := ctl.Webhooks.Replay(delivery, time.Now())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to replay the webhook delivery",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Webhook delivery queued again",
+		"data":    replay,
+	})
+}
@@ -4,17 +4,15 @@ import (
 	"fmt"
 	"strconv"
 
-	"github.com/Danny19977/sr-api/database"
 	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/repository"
 	"github.com/Danny19977/sr-api/utils"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 )
 
 // Paginate Weeks
-func GetPaginatedWeek(c *fiber.Ctx) error {
-	db := database.DB
-
+func (ctl *Controller) GetPaginatedWeek(c *fiber.Ctx) error {
 	page, err := strconv.Atoi(c.Query("page", "1"))
 	if err != nil || page <= 0 {
 		page = 1
@@ -27,22 +25,17 @@ func GetPaginatedWeek(c *fiber.Ctx) error {
 
 	search := c.Query("search", "")
 
-	var dataList []models.Week
-	var totalRecords int64
+	opts := repository.ListOptions{Search: search, Offset: offset, Limit: limit}
 
 	userUUID, _ := utils.GetUserUUIDFromToken(c)
-	var requestingUser models.User
-	db.Where("uuid = ?", userUUID).First(&requestingUser)
-
-	query := db.Model(&models.Week{})
-	if requestingUser.Role == "ASM" {
-		query = query.Where("province_uuid = ?", requestingUser.ProvinceUUID)
+	if requestingUser, err := ctl.Users.FindByUUID(userUUID); err == nil && requestingUser.Role == "ASM" {
+		opts.ProvinceUUID = requestingUser.ProvinceUUID
+		if opts.ProvinceUUID == nil {
+			opts.ProvinceUUID = new(string)
+		}
 	}
-	query = query.Where("week ILIKE ?", "%"+search+"%")
-	query.Count(&totalRecords)
 
-	query = query.Offset(offset).Limit(limit).Order("updated_at DESC")
-	err = query.Preload("Country").Preload("Province").Find(&dataList).Error
+	dataList, totalRecords, err := ctl.Targets.ListWeeks(opts)
 
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
@@ -69,10 +62,8 @@ func GetPaginatedWeek(c *fiber.Ctx) error {
 }
 
 // Get All Weeks
-func GetAllWeeks(c *fiber.Ctx) error {
-	db := database.DB
-	var data []models.Week
-	db.Preload("Country").Preload("Province").Find(&data)
+func (ctl *Controller) GetAllWeeks(c *fiber.Ctx) error {
+	data, _ := ctl.Targets.AllWeeks()
 	return c.JSON(fiber.Map{
 		"status":  "success",
 		"message": "All weeks support",
@@ -81,12 +72,10 @@ func GetAllWeeks(c *fiber.Ctx) error {
 }
 
 // Get one Week by UUID
-func GetWeek(c *fiber.Ctx) error {
+func (ctl *Controller) GetWeek(c *fiber.Ctx) error {
 	uuid := c.Params("uuid")
-	db := database.DB
-	var week models.Week
-	db.Preload("Country").Preload("Province").Where("uuid = ?", uuid).First(&week)
-	if week.Week == "" {
+	week, err := ctl.Targets.FindWeek(uuid)
+	if err != nil {
 		return c.Status(404).JSON(
 			fiber.Map{
 				"status":  "error",
@@ -105,12 +94,10 @@ func GetWeek(c *fiber.Ctx) error {
 }
 
 // Get one Week by week string
-func GetWeekByWeekString(c *fiber.Ctx) error {
+func (ctl *Controller) GetWeekByWeekString(c *fiber.Ctx) error {
 	weekStr := c.Params("week")
-	db := database.DB
-	var week models.Week
-	db.Preload("Country").Preload("Province").Where("week = ?", weekStr).First(&week)
-	if week.Week == "" {
+	week, err := ctl.Targets.FindWeekByNumber(weekStr)
+	if err != nil {
 		return c.Status(404).JSON(
 			fiber.Map{
 				"status":  "error",
@@ -129,7 +116,7 @@ func GetWeekByWeekString(c *fiber.Ctx) error {
 }
 
 // Create Week
-func CreateWeek(c *fiber.Ctx) error {
+func (ctl *Controller) CreateWeek(c *fiber.Ctx) error {
 	p := &models.Week{}
 
 	if err := c.BodyParser(&p); err != nil {
@@ -145,12 +132,11 @@ func CreateWeek(c *fiber.Ctx) error {
 	// Log the parsed struct for diagnostics
 	fmt.Printf("Parsed week struct: %+v\n", p)
 
-	result := database.DB.Create(p)
-	if result.Error != nil {
+	if err := ctl.Targets.CreateWeek(p); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to create week",
-			"error":   result.Error.Error(),
+			"error":   err.Error(),
 			"data":    p,
 		})
 	}
@@ -165,9 +151,8 @@ func CreateWeek(c *fiber.Ctx) error {
 }
 
 // Update Week
-func UpdateWeek(c *fiber.Ctx) error {
+func (ctl *Controller) UpdateWeek(c *fiber.Ctx) error {
 	uuid := c.Params("uuid")
-	db := database.DB
 
 	type UpdateData struct {
 		UUID         string `json:"uuid"`
@@ -193,8 +178,16 @@ func UpdateWeek(c *fiber.Ctx) error {
 		)
 	}
 
-	week := new(models.Week)
-	db.Where("uuid = ?", uuid).First(&week)
+	week, err := ctl.Targets.FindWeek(uuid)
+	if err != nil {
+		return c.Status(404).JSON(
+			fiber.Map{
+				"status":  "error",
+				"message": "No Week found",
+				"data":    nil,
+			},
+		)
+	}
 	week.Week = updateData.Week
 	week.Quantity = updateData.Quantity
 	week.Role = updateData.Role
@@ -203,7 +196,7 @@ func UpdateWeek(c *fiber.Ctx) error {
 	week.MonthUUID = updateData.MonthUUID
 	week.YearUUID = updateData.YearUUID
 	week.Signature = updateData.Signature
-	db.Save(&week)
+	ctl.Targets.SaveWeek(week)
 
 	return c.JSON(
 		fiber.Map{
@@ -215,13 +208,11 @@ func UpdateWeek(c *fiber.Ctx) error {
 }
 
 // Delete Week
-func DeleteWeek(c *fiber.Ctx) error {
+func (ctl *Controller) DeleteWeek(c *fiber.Ctx) error {
 	uuid := c.Params("uuid")
-	db := database.DB
 
-	var week models.Week
-	db.Where("uuid = ?", uuid).First(&week)
-	if week.Week == "" {
+	week, err := ctl.Targets.FindWeek(uuid)
+	if err != nil {
 		return c.Status(404).JSON(
 			fiber.Map{
 				"status":  "error",
@@ -230,7 +221,7 @@ func DeleteWeek(c *fiber.Ctx) error {
 			},
 		)
 	}
-	db.Delete(&week)
+	ctl.Targets.DeleteWeek(week)
 
 	return c.JSON(
 		fiber.Map{
@@ -0,0 +1,13 @@
+package year
+
+import "github.com/Danny19977/sr-api/app"
+
+// Controller serves the year routes on top of the application container
+type Controller struct {
+	*app.App
+}
+
+// New creates the controller
+func New(a *app.App) *Controller {
+	return &Controller{App: a}
+}
@@ -4,16 +4,14 @@ package year
 import (
 	"strconv"
 
-	"github.com/Danny19977/sr-api/database"
 	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/repository"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 )
 
 // Paginate Years
-func GetPaginatedYear(c *fiber.Ctx) error {
-	db := database.DB
-
+func (ctl *Controller) GetPaginatedYear(c *fiber.Ctx) error {
 	// Parse query parameters for pagination
 	page, err := strconv.Atoi(c.Query("page", "1"))
 	if err != nil || page <= 0 {
@@ -28,15 +26,11 @@ func GetPaginatedYear(c *fiber.Ctx) error {
 	// Parse search query
 	search := c.Query("search", "")
 
-	var dataList []models.Year
-	var totalRecords int64
-
-	db.Model(&models.Year{}).
-		Where("year ILIKE ?", "%"+search+"%").
-		Count(&totalRecords)
-
-	err = db.Where("year ILIKE ?", "%"+search+"%").Offset(offset).Limit(limit).Order("updated_at DESC").
-		Find(&dataList).Error
+	dataList, totalRecords, err := ctl.Targets.ListYears(repository.ListOptions{
+		Search: search,
+		Offset: offset,
+		Limit:  limit,
+	})
 
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
@@ -63,10 +57,8 @@ func GetPaginatedYear(c *fiber.Ctx) error {
 }
 
 // Get All Years
-func GetAllYears(c *fiber.Ctx) error {
-	db := database.DB
-	var data []models.Year
-	db.Find(&data)
+func (ctl *Controller) GetAllYears(c *fiber.Ctx) error {
+	data, _ := ctl.Targets.AllYears()
 	return c.JSON(fiber.Map{
 		"status":  "success",
 		"message": "All years support",
@@ -75,12 +67,10 @@ func GetAllYears(c *fiber.Ctx) error {
 }
 
 // Get one Year by UUID
-func GetYear(c *fiber.Ctx) error {
+func (ctl *Controller) GetYear(c *fiber.Ctx) error {
 	uuid := c.Params("uuid")
-	db := database.DB
-	var year models.Year
-	db.Where("uuid = ?", uuid).First(&year)
-	if year.Year == "" {
+	year, err := ctl.Targets.FindYear(uuid)
+	if err != nil {
 		return c.Status(404).JSON(
 			fiber.Map{
 				"status":  "error",
@@ -99,12 +89,10 @@ func GetYear(c *fiber.Ctx) error {
 }
 
 // Get one Year by year string
-func GetYearByYearString(c *fiber.Ctx) error {
+func (ctl *Controller) GetYearByYearString(c *fiber.Ctx) error {
 	yearStr := c.Params("year")
-	db := database.DB
-	var year models.Year
-	db.Where("year = ?", yearStr).First(&year)
-	if year.Year == "" {
+	year, err := ctl.Targets.FindYearByNumber(yearStr)
+	if err != nil {
 		return c.Status(404).JSON(
 			fiber.Map{
 				"status":  "error",
@@ -123,7 +111,7 @@ func GetYearByYearString(c *fiber.Ctx) error {
 }
 
 // Create Year
-func CreateYear(c *fiber.Ctx) error {
+func (ctl *Controller) CreateYear(c *fiber.Ctx) error {
 	p := &models.Year{}
 
 	if err := c.BodyParser(&p); err != nil {
@@ -131,7 +119,7 @@ func CreateYear(c *fiber.Ctx) error {
 	}
 
 	p.UUID = uuid.New().String()
-	database.DB.Create(p)
+	ctl.Targets.CreateYear(p)
 
 	return c.JSON(
 		fiber.Map{
@@ -143,9 +131,8 @@ func CreateYear(c *fiber.Ctx) error {
 }
 
 // Update Year
-func UpdateYear(c *fiber.Ctx) error {
+func (ctl *Controller) UpdateYear(c *fiber.Ctx) error {
 	uuid := c.Params("uuid")
-	db := database.DB
 
 	type UpdateData struct {
 		UUID      string `json:"uuid"`
@@ -166,12 +153,20 @@ func UpdateYear(c *fiber.Ctx) error {
 		)
 	}
 
-	year := new(models.Year)
-	db.Where("uuid = ?", uuid).First(&year)
+	year, err := ctl.Targets.FindYear(uuid)
+	if err != nil {
+		return c.Status(404).JSON(
+			fiber.Map{
+				"status":  "error",
+				"message": "No Year found",
+				"data":    nil,
+			},
+		)
+	}
 	year.Year = updateData.Year
 	year.Quantity = updateData.Quantity
 	year.Signature = updateData.Signature
-	db.Save(&year)
+	ctl.Targets.SaveYear(year)
 
 	return c.JSON(
 		fiber.Map{
@@ -183,13 +178,11 @@ func UpdateYear(c *fiber.Ctx) error {
 }
 
 // Delete Year
-func DeleteYear(c *fiber.Ctx) error {
+func (ctl *Controller) DeleteYear(c *fiber.Ctx) error {
 	uuid := c.Params("uuid")
-	db := database.DB
 
-	var year models.Year
-	db.Where("uuid = ?", uuid).First(&year)
-	if year.Year == "" {
+	year, err := ctl.Targets.FindYear(uuid)
+	if err != nil {
 		return c.Status(404).JSON(
 			fiber.Map{
 				"status":  "error",
@@ -198,7 +191,7 @@ func DeleteYear(c *fiber.Ctx) error {
 			},
 		)
 	}
-	db.Delete(&year)
+	ctl.Targets.DeleteYear(year)
 
 	return c.JSON(
 		fiber.Map{
@@ -2,46 +2,100 @@ package database
 
 import (
 	"fmt"
-	"strconv"
 
+	"github.com/Danny19977/sr-api/config"
 	"github.com/Danny19977/sr-api/models"
-	"github.com/Danny19977/sr-api/utils"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-var DB *gorm.DB
+// Connect opens the PostgreSQL connection pool described by cfg
+func Connect(cfg config.DatabaseConfig) (*gorm.DB, error) {
+	return Open(cfg.DSN(), cfg)
+}
 
-func Connect() {
-	p := utils.Env("DB_PORT")
-	port, err := strconv.ParseUint(p, 10, 32)
+// Open connects to dsn and applies the pool settings of cfg
+func Open(dsn string, cfg config.DatabaseConfig) (*gorm.DB, error) {
+	connection, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+		DisableForeignKeyConstraintWhenMigrating: true,
+	})
 	if err != nil {
-		panic("failed to parse database port 😵!")
+		return nil, fmt.Errorf("could not connect to the database 😰: %w", err)
 	}
 
-	DNS := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable", utils.Env("DB_HOST"), port, utils.Env("DB_USER"), utils.Env("DB_PASSWORD"), utils.Env("DB_NAME"))
-	connection, err := gorm.Open(postgres.Open(DNS), &gorm.Config{
-		DisableForeignKeyConstraintWhenMigrating: true,
-	})
+	sqlDB, err := connection.DB()
 	if err != nil {
-		panic("Could not connect to the database 😰!")
+		return nil, fmt.Errorf("could not configure the database pool 😰: %w", err)
 	}
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 
-	DB = connection
 	fmt.Println("Database Connected 🎉!")
+	return connection, nil
+}
+
+// Migrate applies the schema for every model to db
+func Migrate(db *gorm.DB) error {
+	// Notification names used to be unique, whichever name the constraint
+	// was given by the GORM version that created it
+	for _, constraint := range []string{"uni_notifications_name", "notifications_name_key"} {
+		if err := db.Exec(`ALTER TABLE IF EXISTS notifications DROP CONSTRAINT IF EXISTS ` + constraint).Error; err != nil {
+			return err
+		}
+	}
 
 	// Migrate in proper order - parent tables first, then child tables
-	connection.AutoMigrate(
+	err := db.AutoMigrate(
 		&models.Country{},
+		&models.Holiday{},
 		&models.Province{},
+		&models.Territory{},
+		&models.TerritoryPath{},
+		&models.Outlet{},
 		&models.Product{},
 		&models.Sale{},
 		&models.User{},
+		&models.Credential{},
 		&models.UserLogs{},
 		&models.Notification{},
+		&models.NotificationPreference{},
 		&models.PasswordReset{},
 		&models.Year{},
 		&models.Month{},
 		&models.Week{},
+		&models.SalesDailyRollup{},
+		&models.SalesMonthlyRollup{},
+		&models.SlotCompliance{},
+		&models.AlertRule{},
+		&models.AlertRuleFiring{},
+		&models.OutboxEvent{},
+		&models.WebhookSubscription{},
+		&models.WebhookDelivery{},
+		&models.ReportSubscription{},
+		&models.ReportRun{},
 	)
+	if err != nil {
+		return err
+	}
+	return moveCredentials(db)
+}
+
+// moveCredentials carries the password hashes the users table used to hold
+// over to the credentials table, then drops the password columns
+func moveCredentials(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&models.User{}, "password") {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`
+			INSERT INTO credentials (user_uuid, password_hash, updated_at)
+			SELECT uuid, password, NOW() FROM users
+			WHERE password IS NOT NULL AND password <> ''
+			ON CONFLICT (user_uuid) DO NOTHING`).Error
+		if err != nil {
+			return err
+		}
+		return tx.Exec(`ALTER TABLE users DROP COLUMN IF EXISTS password, DROP COLUMN IF EXISTS conform_password`).Error
+	})
 }
@@ -0,0 +1,96 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Danny19977/sr-api/models"
+)
+
+// Kind names what happened
+type Kind string
+
+const (
+	SaleCreated   Kind = "sale.created"
+	SaleUpdated   Kind = "sale.updated"
+	SaleDeleted   Kind = "sale.deleted"
+	SalesImported Kind = "sales.imported"
+	TargetChanged Kind = "target.changed"
+	// CalendarChanged follows a change of the fiscal calendar of a country
+	CalendarChanged Kind = "calendar.changed"
+	// TerritoryChanged follows a change of the territory tree
+	TerritoryChanged Kind = "territory.changed"
+	// BoundaryChanged follows the upload of province boundaries
+	BoundaryChanged Kind = "boundary.changed"
+)
+
+// Scope is the data of a province during a period that a write changed.
+// An empty ProvinceUUID stands for every province and a zero period for all time.
+type Scope struct {
+	ProvinceUUID string
+	From         time.Time
+	To           time.Time
+}
+
+// Event is published once a write is committed
+type Event struct {
+	Kind   Kind
+	Scopes []Scope
+	// Sale is the stored sale of sale.created, sale.updated and sale.deleted events
+	Sale *models.Sale
+}
+
+// Handler reacts to an event. Handlers run synchronously in the writer's
+// goroutine, so slow work belongs in a goroutine of its own.
+type Handler func(Event)
+
+// Bus fans events out to every subscribed handler
+type Bus struct {
+	mu       sync.RWMutex
+	next     int
+	handlers map[int]Handler
+}
+
+// NewBus creates a bus without subscribers
+func NewBus() *Bus {
+	return &Bus{handlers: map[int]Handler{}}
+}
+
+// Subscribe registers fn and returns the function removing it again
+func (b *Bus) Subscribe(fn Handler) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.next
+	b.next++
+	b.handlers[id] = fn
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.handlers, id)
+	}
+}
+
+// Publish hands e to every handler. A nil bus drops the event.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+
+	b.mu.RLock()
+	handlers := make([]Handler, 0, len(b.handlers))
+	for _, fn := range b.handlers {
+		handlers = append(handlers, fn)
+	}
+	b.mu.RUnlock()
+
+	for _, fn := range handlers {
+		fn(e)
+	}
+}
+
+// SaleScope is the scope of a single sale
+func SaleScope(sale *models.Sale) Scope {
+	return Scope{ProvinceUUID: sale.ProvinceUUID, From: sale.CreatedAt, To: sale.CreatedAt}
+}
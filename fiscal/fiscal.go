@@ -0,0 +1,257 @@
+// Package fiscal resolves the years, months, quarters and weeks the
+// dashboards and the targets are reported in. A fiscal year may start in any
+// month and split into calendar months or into 4-4-5 style retail periods of
+// whole weeks.
+//
+// A fiscal year is named after the calendar year it ends in, so with the
+// default January start it is the calendar year and its weeks are ISO weeks.
+package fiscal
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Retail patterns give the weeks of the three months of every quarter
+var Patterns = map[string][3]int{
+	"4-4-5": {4, 4, 5},
+	"4-5-4": {4, 5, 4},
+	"5-4-4": {5, 4, 4},
+}
+
+// Calendar describes how a country divides its fiscal year
+type Calendar struct {
+	// StartMonth is the month the fiscal year starts in
+	StartMonth time.Month `json:"start_month"`
+	// Pattern is "" for calendar months, otherwise one of Patterns. Retail
+	// years start on the WeekStart nearest to the first of StartMonth and
+	// the 53rd week of long years goes to the last month.
+	Pattern string `json:"pattern"`
+	// WeekStart is the first day of the weeks. Week 1 is the first week
+	// holding at least four days of the fiscal year.
+	WeekStart time.Weekday `json:"week_start"`
+}
+
+// Gregorian is the calendar year with ISO weeks
+var Gregorian = Calendar{StartMonth: time.January, WeekStart: time.Monday}
+
+// Period is a year, quarter, month or week of a fiscal calendar
+type Period struct {
+	// Year is the fiscal year holding the period
+	Year int `json:"year"`
+	// Index numbers the period within its year from 1, 0 for a year
+	Index int    `json:"index"`
+	Name  string `json:"name"`
+	// From is the first day of the period, To the first day after it
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// Contains reports whether t falls in the period
+func (p Period) Contains(t time.Time) bool {
+	return !t.Before(p.From) && t.Before(p.To)
+}
+
+// Overlaps reports whether the period shares time with [from, to)
+func (p Period) Overlaps(from, to time.Time) bool {
+	return p.From.Before(to) && from.Before(p.To)
+}
+
+var shortMonthNames = []string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"}
+
+// Validate reports the first setting preventing the calendar from being used
+func (c Calendar) Validate() error {
+	if c.StartMonth < time.January || c.StartMonth > time.December {
+		return fmt.Errorf("start month must be between 1 and 12")
+	}
+	if _, ok := Patterns[c.Pattern]; c.Pattern != "" && !ok {
+		return fmt.Errorf("pattern must be empty, 4-4-5, 4-5-4 or 5-4-4")
+	}
+	if c.WeekStart < time.Sunday || c.WeekStart > time.Saturday {
+		return fmt.Errorf("week start must be between 0 (Sunday) and 6")
+	}
+	return nil
+}
+
+// Retail reports whether the months are made of whole weeks
+func (c Calendar) Retail() bool {
+	return c.Pattern != ""
+}
+
+// startOfDay returns the midnight before t
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// days counts the days from a to b, both midnights, across daylight saving
+// changes
+func days(a, b time.Time) int {
+	return int(math.Round(b.Sub(a).Hours() / 24))
+}
+
+// weekFloor returns the start of the week holding day
+func (c Calendar) weekFloor(day time.Time) time.Time {
+	return day.AddDate(0, 0, -((int(day.Weekday())-int(c.WeekStart))+7)%7)
+}
+
+// yearStart returns the first day of the fiscal year
+func (c Calendar) yearStart(year int, loc *time.Location) time.Time {
+	calendarYear := year
+	if c.StartMonth != time.January {
+		calendarYear--
+	}
+	first := time.Date(calendarYear, c.StartMonth, 1, 0, 0, 0, 0, loc)
+	if !c.Retail() {
+		return first
+	}
+
+	// The week start nearest to the first of the month
+	offset := (int(c.WeekStart) - int(first.Weekday()) + 7) % 7
+	if offset > 3 {
+		offset -= 7
+	}
+	return first.AddDate(0, 0, offset)
+}
+
+// Year returns the bounds of a fiscal year
+func (c Calendar) Year(year int, loc *time.Location) Period {
+	return Period{
+		Year: year,
+		Name: fmt.Sprintf("FY%d", year),
+		From: c.yearStart(year, loc),
+		To:   c.yearStart(year+1, loc),
+	}
+}
+
+// YearOf returns the fiscal year holding t
+func (c Calendar) YearOf(t time.Time) int {
+	year := t.Year()
+	if c.StartMonth != time.January && t.Month() >= c.StartMonth {
+		year++
+	}
+	// Retail years may start a few days either side of the month
+	switch {
+	case t.Before(c.yearStart(year, t.Location())):
+		year--
+	case !t.Before(c.yearStart(year+1, t.Location())):
+		year++
+	}
+	return year
+}
+
+// Months returns the twelve months of a fiscal year. They are named after
+// the calendar month they start, or mostly fall, in.
+func (c Calendar) Months(year int, loc *time.Location) []Period {
+	fy := c.Year(year, loc)
+	months := make([]Period, 12)
+	from := fy.From
+	for i := range months {
+		months[i] = Period{
+			Year:  year,
+			Index: i + 1,
+			Name:  shortMonthNames[c.CalendarMonth(i+1)-1],
+			From:  from,
+		}
+		if c.Retail() {
+			from = from.AddDate(0, 0, 7*Patterns[c.Pattern][i%3])
+		} else {
+			from = from.AddDate(0, 1, 0)
+		}
+		months[i].To = from
+	}
+	// A 53 week retail year ends a week after the pattern
+	months[11].To = fy.To
+	return months
+}
+
+// Quarters returns the four quarters of a fiscal year
+func (c Calendar) Quarters(year int, loc *time.Location) []Period {
+	months := c.Months(year, loc)
+	quarters := make([]Period, 4)
+	for i := range quarters {
+		quarters[i] = Period{
+			Year:  year,
+			Index: i + 1,
+			Name:  fmt.Sprintf("Q%d", i+1),
+			From:  months[3*i].From,
+			To:    months[3*i+2].To,
+		}
+	}
+	return quarters
+}
+
+// MonthOf returns the fiscal month holding t
+func (c Calendar) MonthOf(t time.Time) Period {
+	months := c.Months(c.YearOf(t), t.Location())
+	for _, month := range months {
+		if month.Contains(t) {
+			return month
+		}
+	}
+	return months[11]
+}
+
+// MonthIndex returns the index in the fiscal year of the month named after
+// the calendar month m, the months targets are stored by
+func (c Calendar) MonthIndex(m time.Month) int {
+	return (int(m)-int(c.StartMonth)+12)%12 + 1
+}
+
+// CalendarMonth returns the calendar month the fiscal month index is named
+// after, the inverse of MonthIndex
+func (c Calendar) CalendarMonth(index int) time.Month {
+	return time.Month((int(c.StartMonth)+index-2)%12 + 1)
+}
+
+// firstWeek returns the start of week 1 of a fiscal year
+func (c Calendar) firstWeek(year int, loc *time.Location) time.Time {
+	start := c.yearStart(year, loc)
+	if c.Retail() {
+		return start
+	}
+	return c.weekFloor(start.AddDate(0, 0, 3))
+}
+
+// Week returns week number week of a fiscal year
+func (c Calendar) Week(year, week int, loc *time.Location) Period {
+	from := c.firstWeek(year, loc).AddDate(0, 0, 7*(week-1))
+	return Period{
+		Year:  year,
+		Index: week,
+		Name:  fmt.Sprintf("Week %d", week),
+		From:  from,
+		To:    from.AddDate(0, 0, 7),
+	}
+}
+
+// WeekOf returns the fiscal week holding t
+func (c Calendar) WeekOf(t time.Time) Period {
+	day := startOfDay(t)
+	year := c.YearOf(day)
+	switch {
+	case day.Before(c.firstWeek(year, t.Location())):
+		year--
+	case !day.Before(c.firstWeek(year+1, t.Location())):
+		year++
+	}
+	return c.Week(year, days(c.firstWeek(year, t.Location()), day)/7+1, t.Location())
+}
+
+// Weeks returns the fiscal weeks overlapping [from, to)
+func (c Calendar) Weeks(from, to time.Time) []Period {
+	var weeks []Period
+	for week := c.WeekOf(from); week.From.Before(to); week = c.WeekOf(week.To) {
+		weeks = append(weeks, week)
+	}
+	return weeks
+}
+
+// MonthsBetween returns the fiscal months overlapping [from, to)
+func (c Calendar) MonthsBetween(from, to time.Time) []Period {
+	var months []Period
+	for month := c.MonthOf(from); month.From.Before(to); month = c.MonthOf(month.To) {
+		months = append(months, month)
+	}
+	return months
+}
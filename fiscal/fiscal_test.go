@@ -0,0 +1,109 @@
+package fiscal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGregorianMatchesISOWeeksAndCalendarMonths(t *testing.T) {
+	for day := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC); day.Year() < 2031; day = day.AddDate(0, 0, 1) {
+		year, week := day.ISOWeek()
+		if got := Gregorian.WeekOf(day.Add(13 * time.Hour)); got.Year != year || got.Index != week {
+			t.Fatalf("%s: got week %d of %d, want ISO week %d of %d", day.Format("2006-01-02"), got.Index, got.Year, week, year)
+		}
+		month := Gregorian.MonthOf(day)
+		if month.Year != day.Year() || month.Index != int(day.Month()) || month.From.Day() != 1 {
+			t.Fatalf("%s: got month %+v", day.Format("2006-01-02"), month)
+		}
+	}
+}
+
+func TestJulyStart(t *testing.T) {
+	cal := Calendar{StartMonth: time.July, WeekStart: time.Monday}
+
+	fy := cal.Year(2026, time.UTC)
+	if fy.From != time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC) || fy.To != time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC) {
+		t.Errorf("FY2026 runs %s to %s", fy.From, fy.To)
+	}
+	if year := cal.YearOf(time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)); year != 2027 {
+		t.Errorf("October 2026 is in FY%d, want FY2027", year)
+	}
+	q1 := cal.Quarters(2027, time.UTC)[0]
+	if q1.From != time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC) || q1.To != time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC) {
+		t.Errorf("Q1 runs %s to %s", q1.From, q1.To)
+	}
+	if month := cal.MonthOf(time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)); month.Index != 7 || month.Name != "Jan" {
+		t.Errorf("got %+v for January", month)
+	}
+	if index := cal.MonthIndex(time.June); index != 12 {
+		t.Errorf("June is month %d, want 12", index)
+	}
+	if month := cal.CalendarMonth(12); month != time.June {
+		t.Errorf("month 12 is %s, want June", month)
+	}
+}
+
+func TestRetailPeriods(t *testing.T) {
+	cal := Calendar{StartMonth: time.February, Pattern: "4-4-5", WeekStart: time.Sunday}
+
+	for year := 2020; year <= 2035; year++ {
+		fy := cal.Year(year, time.UTC)
+		if fy.From.Weekday() != time.Sunday {
+			t.Fatalf("FY%d starts on a %s", year, fy.From.Weekday())
+		}
+		weeks := days(fy.From, fy.To) / 7
+		if weeks != 52 && weeks != 53 {
+			t.Fatalf("FY%d has %d weeks", year, weeks)
+		}
+
+		months := cal.Months(year, time.UTC)
+		if months[0].From != fy.From || months[11].To != fy.To {
+			t.Fatalf("the months of FY%d do not cover it", year)
+		}
+		for i, month := range months {
+			want := 7 * Patterns["4-4-5"][i%3]
+			if i == 11 && weeks == 53 {
+				want += 7
+			}
+			if got := days(month.From, month.To); got != want {
+				t.Fatalf("month %d of FY%d has %d days, want %d", i+1, year, got, want)
+			}
+			if i > 0 && month.From != months[i-1].To {
+				t.Fatalf("month %d of FY%d does not follow the previous one", i+1, year)
+			}
+		}
+
+		// Every day maps back into its year, month and week
+		for day := fy.From; day.Before(fy.To); day = day.AddDate(0, 0, 1) {
+			if cal.YearOf(day) != year || !cal.MonthOf(day).Contains(day) {
+				t.Fatalf("%s is not in FY%d", day.Format("2006-01-02"), year)
+			}
+			week := cal.WeekOf(day)
+			if week.Year != year || week.Index != days(fy.From, day)/7+1 {
+				t.Fatalf("%s: got week %d of FY%d", day.Format("2006-01-02"), week.Index, week.Year)
+			}
+		}
+	}
+}
+
+func TestWeeksBetween(t *testing.T) {
+	from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	weeks := Gregorian.Weeks(from, from.AddDate(0, 1, 0))
+	if len(weeks) != 5 || !weeks[0].Contains(from) || weeks[0].Index != 40 {
+		t.Fatalf("got %d weeks starting with %+v", len(weeks), weeks[0])
+	}
+	if months := Gregorian.MonthsBetween(from, from.AddDate(0, 3, 0)); len(months) != 3 {
+		t.Errorf("got %d months, want 3", len(months))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, cal := range []Calendar{{StartMonth: 0}, {StartMonth: 13}, {StartMonth: 1, Pattern: "4-4-4"}, {StartMonth: 1, WeekStart: 7}} {
+		if cal.Validate() == nil {
+			t.Errorf("%+v is valid", cal)
+		}
+	}
+	if err := Gregorian.Validate(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,253 @@
+// Package forecast projects the sales of a week, a month, a year or any
+// period to its end, per province or per product, from the daily history of
+// the sales.
+package forecast
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Danny19977/sr-api/fiscal"
+	"github.com/Danny19977/sr-api/repository"
+)
+
+// Periods a forecast covers
+const (
+	Week  = "week"
+	Month = "month"
+	Year  = "year"
+)
+
+// historyDays is how many days before the period the seasonal method and
+// the noise estimate learn from
+const historyDays = 8 * season
+
+// PeriodBounds returns the fiscal week, month or year of cal holding t
+func PeriodBounds(cal fiscal.Calendar, period string, t time.Time) (fiscal.Period, error) {
+	switch period {
+	case Week:
+		return cal.WeekOf(t), nil
+	case Month:
+		return cal.MonthOf(t), nil
+	case Year:
+		return cal.Year(cal.YearOf(t), t.Location()), nil
+	}
+	return fiscal.Period{}, fmt.Errorf("period must be %s, %s or %s", Week, Month, Year)
+}
+
+// Request describes a forecast
+type Request struct {
+	// From and To bound the period, To excluded. Both are midnights.
+	From time.Time
+	To   time.Time
+	// AsOf is the time the forecast is made at, usually now
+	AsOf time.Time
+	// By is "province" or "product"
+	By     string
+	Method string
+	// Confidence is the probability the final total falls in the band, 0.8
+	// when zero
+	Confidence    float64
+	ProvinceUUIDs []string
+}
+
+// Row is the projection of one province or product
+type Row struct {
+	UUID string `json:"uuid"`
+	Name string `json:"name"`
+	Projection
+}
+
+// Result is the projection of every series of a request and of their total
+type Result struct {
+	Total Projection
+	Rows  []Row
+}
+
+// Validate reports the first setting preventing the request from running
+func (r Request) Validate() error {
+	if r.By != "province" && r.By != "product" {
+		return fmt.Errorf("group_by must be province or product")
+	}
+	if !slices.Contains(Methods, r.Method) {
+		return fmt.Errorf("method must be one of %s", strings.Join(Methods, ", "))
+	}
+	if r.Confidence != 0 && (r.Confidence < 0.5 || r.Confidence >= 1) {
+		return fmt.Errorf("confidence must be at least 0.5 and below 1")
+	}
+	if !r.From.Before(r.To) {
+		return fmt.Errorf("the period must end after it starts")
+	}
+	return nil
+}
+
+// z returns the half width of the two-sided band of the request, in
+// standard errors
+func (r Request) z() float64 {
+	confidence := r.Confidence
+	if confidence == 0 {
+		confidence = 0.8
+	}
+	return math.Sqrt2 * math.Erfinv(confidence)
+}
+
+// startOfDay returns the midnight before t
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// days counts the days from a to b, both midnights, across daylight saving
+// changes
+func days(a, b time.Time) int {
+	return int(math.Round(b.Sub(a).Hours() / 24))
+}
+
+// lastYear returns the start of the same period a year before from. A week
+// goes back 52 weeks to compare the same weekdays.
+func lastYear(from, to time.Time) time.Time {
+	if days(from, to) == 7 {
+		return from.AddDate(0, 0, -364)
+	}
+	return from.AddDate(-1, 0, 0)
+}
+
+// series is the daily sales of a key from the origin of a forecast
+type series map[string][]float64
+
+func (s series) add(key string, day int, total int64, length int) {
+	if day < 0 || day >= length {
+		return
+	}
+	if s[key] == nil {
+		s[key] = make([]float64, length)
+	}
+	s[key][day] += float64(total)
+}
+
+// Run projects the sales of the period of req, reading the history with two
+// grouped queries whatever the number of series
+func Run(d repository.DashboardRepository, req Request) (Result, error) {
+	if err := req.Validate(); err != nil {
+		return Result{}, err
+	}
+
+	// The history stops at the end of the period, past periods are complete
+	asOf := req.AsOf
+	if asOf.After(req.To) {
+		asOf = req.To
+	}
+	today := startOfDay(asOf)
+	origin := req.From
+	if today.Before(origin) {
+		origin = today
+	}
+	origin = origin.AddDate(0, 0, -historyDays)
+
+	start, end, asOfDay := days(origin, req.From), days(origin, req.To), days(origin, today)
+	length := asOfDay + 1
+
+	totals, err := d.DayTotals(req.By, origin, asOf, req.ProvinceUUIDs)
+	if err != nil {
+		return Result{}, err
+	}
+	history := series{}
+	for _, t := range totals {
+		history.add(t.Key, t.Day, t.Total, length)
+		history.add("", t.Day, t.Total, length)
+	}
+
+	periodDays := end - start
+	previous := series{}
+	if req.Method == LastYear {
+		from := lastYear(req.From, req.To)
+		totals, err := d.DayTotals(req.By, from, from.AddDate(0, 0, periodDays), req.ProvinceUUIDs)
+		if err != nil {
+			return Result{}, err
+		}
+		for _, t := range totals {
+			previous.add(t.Key, t.Day, t.Total, periodDays)
+			previous.add("", t.Day, t.Total, periodDays)
+		}
+	}
+
+	// The days from the as-of day on still to come in the period
+	var ahead []float64
+	var fraction float64
+	if asOfDay < end {
+		ahead = make([]float64, end-asOfDay)
+		for i := range ahead {
+			if asOfDay+i >= start {
+				ahead[i] = 1
+			}
+		}
+		if asOfDay >= start {
+			fraction = math.Min(asOf.Sub(today).Hours()/24, 1)
+			ahead[0] = 1 - fraction
+		}
+	}
+
+	project := func(key string) Projection {
+		values := history[key]
+		if values == nil {
+			values = make([]float64, length)
+		}
+		in := Input{
+			History:  values[:asOfDay],
+			Elapsed:  min(max(asOfDay-start, 0), periodDays),
+			Ahead:    ahead,
+			LastYear: previous[key],
+		}
+		if in.LastYear == nil {
+			in.LastYear = make([]float64, periodDays)
+		}
+		if asOfDay >= start && asOfDay < end {
+			in.Today, in.Fraction = values[asOfDay], fraction
+		}
+
+		switch req.Method {
+		case LastYear:
+			return ProjectLastYear(in, req.z())
+		case Seasonal:
+			return ProjectSeasonal(in, req.z())
+		}
+		return ProjectRunRate(in, req.z())
+	}
+
+	result := Result{Total: project("")}
+	if req.By == "province" {
+		provinces, err := d.Provinces(req.ProvinceUUIDs)
+		if err != nil {
+			return Result{}, err
+		}
+		for _, p := range provinces {
+			result.Rows = append(result.Rows, Row{UUID: p.UUID, Name: p.Name, Projection: project(p.UUID)})
+		}
+		return result, nil
+	}
+
+	// Products are listed when they sold over the history
+	var keys []string
+	for key := range history {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	products, err := d.Products(keys)
+	if err != nil {
+		return Result{}, err
+	}
+	names := make(map[string]string, len(products))
+	for _, p := range products {
+		names[p.UUID] = p.Name
+	}
+	for _, key := range keys {
+		result.Rows = append(result.Rows, Row{UUID: key, Name: names[key], Projection: project(key)})
+	}
+	slices.SortFunc(result.Rows, func(a, b Row) int {
+		return strings.Compare(a.Name+"\x00"+a.UUID, b.Name+"\x00"+b.UUID)
+	})
+	return result, nil
+}
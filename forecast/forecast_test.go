@@ -0,0 +1,166 @@
+package forecast
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Danny19977/sr-api/fiscal"
+	"github.com/Danny19977/sr-api/repository"
+)
+
+func repeat(value float64, n int) []float64 {
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = value
+	}
+	return values
+}
+
+func TestRunRate(t *testing.T) {
+	in := Input{History: repeat(10, 28), Elapsed: 10, Ahead: repeat(1, 20)}
+	got := ProjectRunRate(in, 1.28)
+	if got.Method != RunRate || got.Actual != 100 || got.Projected != 300 || got.Lower != 300 || got.Upper != 300 {
+		t.Errorf("got %+v, want 300 with no spread", got)
+	}
+
+	// Before the period starts the recent days give the rate
+	in = Input{History: repeat(4, 28), Ahead: append([]float64{0, 0}, repeat(1, 5)...)}
+	if got := ProjectRunRate(in, 1.28); got.Actual != 0 || got.Projected != 20 {
+		t.Errorf("period ahead: got %+v, want 20", got)
+	}
+}
+
+func TestLastYearScales(t *testing.T) {
+	in := Input{
+		History:  append(repeat(3, 20), repeat(10, 10)...),
+		Elapsed:  10,
+		Ahead:    repeat(1, 20),
+		LastYear: repeat(5, 30),
+	}
+	got := ProjectLastYear(in, 1.28)
+	if got.Method != LastYear || got.Projected != 300 {
+		t.Errorf("got %+v, want last year doubled to 300", got)
+	}
+
+	in.LastYear = repeat(0, 30)
+	if got := ProjectLastYear(in, 1.28); got.Method != RunRate {
+		t.Errorf("without last year: method %s, want %s", got.Method, RunRate)
+	}
+}
+
+func TestSeasonalLearnsTheWeek(t *testing.T) {
+	// Five days at 10 then a weekend without sales, for eight weeks
+	var history []float64
+	for week := 0; week < 8; week++ {
+		history = append(history, 10, 10, 10, 10, 10, 0, 0)
+	}
+	in := Input{History: history, Ahead: repeat(1, 7)}
+	got := ProjectSeasonal(in, 1.28)
+	if got.Method != Seasonal || math.Abs(got.Projected-50) > 2 {
+		t.Errorf("got %+v, want about 50", got)
+	}
+	if got.Lower > got.Projected || got.Upper < got.Projected {
+		t.Errorf("band %v-%v does not hold %v", got.Lower, got.Upper, got.Projected)
+	}
+
+	// A run rate would expect 7 days at the average of 50/7
+	in.History = history[:10]
+	if got := ProjectSeasonal(in, 1.28); got.Method != RunRate {
+		t.Errorf("short history: method %s, want %s", got.Method, RunRate)
+	}
+}
+
+func TestConfidenceWidensTheBand(t *testing.T) {
+	in := Input{History: []float64{8, 12, 9, 11, 10, 10, 7, 13}, Elapsed: 4, Ahead: repeat(1, 10)}
+	narrow, wide := ProjectRunRate(in, Request{Confidence: 0.5}.z()), ProjectRunRate(in, Request{Confidence: 0.95}.z())
+	if !(wide.Upper > narrow.Upper && narrow.Upper > narrow.Projected) {
+		t.Errorf("50%% band %+v, 95%% band %+v", narrow, wide)
+	}
+}
+
+// stubDashboard serves the daily totals of a forecast from memory
+type stubDashboard struct {
+	repository.DashboardRepository
+	sales map[time.Time]map[string]int64 // By day and province
+}
+
+func (s stubDashboard) DayTotals(by string, origin, until time.Time, provinceUUIDs []string) ([]repository.DayTotal, error) {
+	var totals []repository.DayTotal
+	for day, provinces := range s.sales {
+		if day.Before(origin) || !day.Before(until) {
+			continue
+		}
+		for province, total := range provinces {
+			totals = append(totals, repository.DayTotal{Day: days(origin, day), Key: province, Total: total})
+		}
+	}
+	return totals, nil
+}
+
+func (s stubDashboard) Provinces(provinceUUIDs []string) ([]repository.ProvinceRef, error) {
+	return []repository.ProvinceRef{{UUID: "east", Name: "East"}, {UUID: "west", Name: "West"}}, nil
+}
+
+func TestRun(t *testing.T) {
+	d := stubDashboard{sales: map[time.Time]map[string]int64{}}
+	for day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC); day.Month() == 5; day = day.AddDate(0, 0, 1) {
+		d.sales[day] = map[string]int64{"east": 10, "west": 5}
+	}
+
+	month, err := PeriodBounds(fiscal.Gregorian, Month, time.Date(2024, 5, 20, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := Request{From: month.From, To: month.To, By: "province", Method: RunRate, AsOf: time.Date(2024, 5, 11, 0, 0, 0, 0, time.UTC)}
+	result, err := Run(d, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Total.Actual != 150 || result.Total.Projected != 465 {
+		t.Errorf("total %+v, want 150 sold and 465 projected over 31 days", result.Total)
+	}
+	if len(result.Rows) != 2 || result.Rows[0].Name != "East" || result.Rows[0].Projected != 310 || result.Rows[1].Projected != 155 {
+		t.Errorf("rows %+v", result.Rows)
+	}
+
+	// Once the period is over the projection is the actual total
+	req.AsOf = time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC)
+	if result, err = Run(d, req); err != nil {
+		t.Fatal(err)
+	}
+	if got := result.Total; got.Actual != 465 || got.Projected != 465 || got.Lower != 465 || got.Upper != 465 {
+		t.Errorf("complete period: %+v, want 465", got)
+	}
+
+	req.Method = "magic"
+	if _, err := Run(d, req); err == nil {
+		t.Error("an unknown method ran")
+	}
+}
+
+func TestPeriodBounds(t *testing.T) {
+	day := time.Date(2024, 2, 29, 15, 0, 0, 0, time.UTC)
+	july := fiscal.Calendar{StartMonth: time.July, WeekStart: time.Monday}
+	for _, tc := range []struct {
+		cal    fiscal.Calendar
+		period string
+		want   [2]string
+	}{
+		{fiscal.Gregorian, Week, [2]string{"2024-02-26", "2024-03-04"}},
+		{fiscal.Gregorian, Month, [2]string{"2024-02-01", "2024-03-01"}},
+		{fiscal.Gregorian, Year, [2]string{"2024-01-01", "2025-01-01"}},
+		{july, Year, [2]string{"2023-07-01", "2024-07-01"}},
+	} {
+		p, err := PeriodBounds(tc.cal, tc.period, day)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.From.Format("2006-01-02") != tc.want[0] || p.To.Format("2006-01-02") != tc.want[1] {
+			t.Errorf("%s starting in %s: %v to %v, want %v", tc.period, tc.cal.StartMonth, p.From, p.To, tc.want)
+		}
+	}
+	if _, err := PeriodBounds(fiscal.Gregorian, "decade", day); err == nil {
+		t.Error("an unknown period was accepted")
+	}
+}
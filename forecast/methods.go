@@ -0,0 +1,206 @@
+package forecast
+
+import "math"
+
+// Forecasting methods
+const (
+	// RunRate extends the daily rate of the period so far
+	RunRate = "run_rate"
+	// LastYear scales the same period last year by how the period compares
+	// with it so far
+	LastYear = "last_year"
+	// Seasonal runs Holt-Winters exponential smoothing with a weekly season
+	// over the recent days
+	Seasonal = "seasonal"
+)
+
+// Methods lists the forecasting methods
+var Methods = []string{RunRate, LastYear, Seasonal}
+
+// season is the length of the sales cycle the seasonal method learns, a week
+const season = 7
+
+// recentDays is how many days of history estimate the daily noise
+const recentDays = 28
+
+// Smoothing factors of the level, trend and season, and the damping of the
+// trend so long horizons do not run away
+const (
+	alpha = 0.3
+	beta  = 0.05
+	gamma = 0.2
+	phi   = 0.9
+)
+
+// Input is the daily sales of one series around the projected period
+type Input struct {
+	// History holds the totals of the complete days before the as-of day,
+	// oldest first. Its last Elapsed days fall in the period.
+	History []float64
+	Elapsed int
+	// Today is the quantity sold on the as-of day so far and Fraction the
+	// share of that day gone, both 0 when the day is outside the period
+	Today    float64
+	Fraction float64
+	// Ahead holds, for each day from the as-of day on, the share of it still
+	// to come within the period
+	Ahead []float64
+	// LastYear holds the daily totals of the same period a year earlier
+	LastYear []float64
+}
+
+// Projection is the expected total of a period with its confidence band
+type Projection struct {
+	// Method is the method used, run_rate when the requested one lacked history
+	Method string `json:"method"`
+	// Actual is the quantity sold in the period so far
+	Actual int64 `json:"actual"`
+	// Projected is the expected total at the end of the period
+	Projected float64 `json:"projected"`
+	Lower     float64 `json:"lower"`
+	Upper     float64 `json:"upper"`
+}
+
+func sum(values []float64) float64 {
+	var total float64
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
+
+// actual returns the quantity sold in the period so far
+func (in Input) actual() float64 {
+	return sum(in.History[len(in.History)-in.Elapsed:]) + in.Today
+}
+
+// recent returns the last recentDays days of history
+func (in Input) recent() []float64 {
+	return in.History[max(0, len(in.History)-recentDays):]
+}
+
+// rms returns the root mean square of errors
+func rms(errors []float64) float64 {
+	if len(errors) == 0 {
+		return 0
+	}
+	var squares float64
+	for _, e := range errors {
+		squares += e * e
+	}
+	return math.Sqrt(squares / float64(len(errors)))
+}
+
+// project returns the projection of a method expecting remaining more sales
+// with a daily error of sigma, z being the half width of the band in errors
+func (in Input) project(method string, remaining, sigma, z float64) Projection {
+	actual := in.actual()
+	spread := z * sigma * math.Sqrt(sum(in.Ahead))
+	projected := actual + math.Max(remaining, 0)
+	return Projection{
+		Method:    method,
+		Actual:    int64(math.Round(actual)),
+		Projected: math.Round(projected),
+		Lower:     math.Round(math.Max(actual, projected-spread)),
+		Upper:     math.Round(projected + spread),
+	}
+}
+
+// runRate returns the daily rate of the period so far, or of the recent
+// days before the period starts, with the daily error around it
+func (in Input) runRate() (float64, float64) {
+	days := float64(in.Elapsed) + in.Fraction
+	var rate float64
+	switch {
+	case days >= 1:
+		rate = in.actual() / days
+	case len(in.recent()) > 0:
+		rate = sum(in.recent()) / float64(len(in.recent()))
+	}
+
+	var errors []float64
+	for _, v := range in.recent() {
+		errors = append(errors, v-rate)
+	}
+	return rate, rms(errors)
+}
+
+// ProjectRunRate extends the daily rate of the period so far
+func ProjectRunRate(in Input, z float64) Projection {
+	rate, sigma := in.runRate()
+	return in.project(RunRate, rate*sum(in.Ahead), sigma, z)
+}
+
+// ProjectLastYear scales the same period last year by the ratio of the
+// period so far to the same days last year. It runs the run rate when last
+// year sold nothing over those days.
+func ProjectLastYear(in Input, z float64) Projection {
+	elapsed := min(in.Elapsed, len(in.LastYear))
+	toDate := sum(in.LastYear[:elapsed])
+	if elapsed < len(in.LastYear) {
+		toDate += in.Fraction * in.LastYear[elapsed]
+	}
+	if toDate <= 0 {
+		return ProjectRunRate(in, z)
+	}
+	ratio := in.actual() / toDate
+
+	// The error of the scaled last year over the days gone
+	period := in.History[len(in.History)-in.Elapsed:]
+	var errors []float64
+	for i := 0; i < elapsed; i++ {
+		errors = append(errors, period[i]-ratio*in.LastYear[i])
+	}
+	sigma := rms(errors)
+	if len(errors) < 2 {
+		_, sigma = in.runRate()
+	}
+	return in.project(LastYear, ratio*sum(in.LastYear)-in.actual(), sigma, z)
+}
+
+// ProjectSeasonal forecasts every day left with additive Holt-Winters
+// smoothing and a damped trend. It runs the run rate with less than two
+// weeks of history.
+func ProjectSeasonal(in Input, z float64) Projection {
+	if len(in.History) < 2*season {
+		return ProjectRunRate(in, z)
+	}
+
+	forecasts, sigma := holtWinters(in.History, len(in.Ahead))
+	var remaining float64
+	for h, share := range in.Ahead {
+		remaining += share * math.Max(forecasts[h], 0)
+	}
+	return in.project(Seasonal, remaining, sigma, z)
+}
+
+// holtWinters fits series and returns the forecasts of the horizon days
+// following it with the root mean square of the one-step errors
+func holtWinters(series []float64, horizon int) ([]float64, float64) {
+	first, second := sum(series[:season])/season, sum(series[season:2*season])/season
+	level, trend := first, (second-first)/season
+	seasonal := make([]float64, season)
+	for i := range seasonal {
+		seasonal[i] = series[i] - first
+	}
+
+	var errors []float64
+	for t := season; t < len(series); t++ {
+		s := seasonal[t%season]
+		predicted := level + phi*trend + s
+		errors = append(errors, series[t]-predicted)
+
+		previous := level
+		level = alpha*(series[t]-s) + (1-alpha)*(previous+phi*trend)
+		trend = beta*(level-previous) + (1-beta)*phi*trend
+		seasonal[t%season] = gamma*(series[t]-level) + (1-gamma)*s
+	}
+
+	forecasts := make([]float64, horizon)
+	damping := 0.0
+	for h := 1; h <= horizon; h++ {
+		damping += math.Pow(phi, float64(h))
+		forecasts[h-1] = level + damping*trend + seasonal[(len(series)+h-1)%season]
+	}
+	return forecasts, rms(errors)
+}
@@ -0,0 +1,93 @@
+// Package geo measures distances between GPS coordinates, bounds searches
+// around them and writes GeoJSON.
+package geo
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// EarthRadiusKm is the mean radius of the Earth
+const EarthRadiusKm = 6371.0
+
+// Point is a WGS 84 position in degrees
+type Point struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Valid reports whether p lies within the ranges of latitudes and longitudes
+func (p Point) Valid() bool {
+	return p.Latitude >= -90 && p.Latitude <= 90 && p.Longitude >= -180 && p.Longitude <= 180
+}
+
+// Box is a bounding box, its corners South West and North East
+type Box struct {
+	MinLatitude  float64
+	MinLongitude float64
+	MaxLatitude  float64
+	MaxLongitude float64
+}
+
+// Contains reports whether p lies in b
+func (b Box) Contains(p Point) bool {
+	return p.Latitude >= b.MinLatitude && p.Latitude <= b.MaxLatitude &&
+		p.Longitude >= b.MinLongitude && p.Longitude <= b.MaxLongitude
+}
+
+// ParseBox reads a box written as GeoJSON does, min_lng,min_lat,max_lng,max_lat
+func ParseBox(value string) (Box, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return Box{}, fmt.Errorf("bbox must be min_lng,min_lat,max_lng,max_lat")
+	}
+	var coords [4]float64
+	for i, part := range parts {
+		coord, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return Box{}, fmt.Errorf("bbox must be min_lng,min_lat,max_lng,max_lat")
+		}
+		coords[i] = coord
+	}
+	box := Box{MinLongitude: coords[0], MinLatitude: coords[1], MaxLongitude: coords[2], MaxLatitude: coords[3]}
+	sw := Point{Latitude: box.MinLatitude, Longitude: box.MinLongitude}
+	ne := Point{Latitude: box.MaxLatitude, Longitude: box.MaxLongitude}
+	if !sw.Valid() || !ne.Valid() || box.MinLatitude > box.MaxLatitude || box.MinLongitude > box.MaxLongitude {
+		return Box{}, fmt.Errorf("bbox is out of range or inverted")
+	}
+	return box, nil
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+// Distance returns the great circle distance from a to b in kilometres
+func Distance(a, b Point) float64 {
+	dLat := radians(b.Latitude - a.Latitude)
+	dLng := radians(b.Longitude - a.Longitude)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(radians(a.Latitude))*math.Cos(radians(b.Latitude))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * EarthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Around returns the box holding every point within radiusKm of center. It
+// spans every longitude near the poles.
+func Around(center Point, radiusKm float64) Box {
+	dLat := radiusKm / EarthRadiusKm * 180 / math.Pi
+	box := Box{
+		MinLatitude:  math.Max(-90, center.Latitude-dLat),
+		MaxLatitude:  math.Min(90, center.Latitude+dLat),
+		MinLongitude: -180,
+		MaxLongitude: 180,
+	}
+	if cos := math.Cos(radians(center.Latitude)); cos > 1e-6 {
+		if dLng := dLat / cos; dLng < 180 {
+			box.MinLongitude = math.Max(-180, center.Longitude-dLng)
+			box.MaxLongitude = math.Min(180, center.Longitude+dLng)
+		}
+	}
+	return box
+}
@@ -0,0 +1,112 @@
+package geo
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestDistance(t *testing.T) {
+	kinshasa := Point{Latitude: -4.3217, Longitude: 15.3126}
+	lubumbashi := Point{Latitude: -11.6647, Longitude: 27.4794}
+
+	// About 1,570 km as the crow flies
+	if d := Distance(kinshasa, lubumbashi); math.Abs(d-1570) > 15 {
+		t.Errorf("got %.0f km, want about 1570", d)
+	}
+	if d := Distance(kinshasa, kinshasa); d != 0 {
+		t.Errorf("got %f km from a point to itself", d)
+	}
+}
+
+func TestAround(t *testing.T) {
+	center := Point{Latitude: -4.3217, Longitude: 15.3126}
+	box := Around(center, 10)
+
+	// Points 10 km away due North and due East lie on the box
+	north := Point{Latitude: center.Latitude + 10/EarthRadiusKm*180/math.Pi, Longitude: center.Longitude}
+	if !box.Contains(center) || math.Abs(box.MaxLatitude-north.Latitude) > 1e-9 {
+		t.Errorf("got %+v, want a box reaching %f North", box, north.Latitude)
+	}
+	east := Point{Latitude: center.Latitude, Longitude: box.MaxLongitude}
+	if d := Distance(center, east); math.Abs(d-10) > 0.01 {
+		t.Errorf("the East edge is %.3f km away, want 10", d)
+	}
+
+	if polar := Around(Point{Latitude: 89.99, Longitude: 0}, 50); polar.MinLongitude != -180 || polar.MaxLongitude != 180 {
+		t.Errorf("got %+v, want every longitude near the pole", polar)
+	}
+}
+
+func TestParseBox(t *testing.T) {
+	box, err := ParseBox("15.2,-4.5,15.4,-4.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !box.Contains(Point{Latitude: -4.3217, Longitude: 15.3126}) || box.Contains(Point{Latitude: -4.1, Longitude: 15.3}) {
+		t.Errorf("got %+v, want Kinshasa inside and a point further North outside", box)
+	}
+
+	for _, value := range []string{"1,2,3", "15.4,-4.5,15.2,-4.2", "a,b,c,d", "0,-91,1,0"} {
+		if _, err := ParseBox(value); err == nil {
+			t.Errorf("%q was accepted", value)
+		}
+	}
+}
+
+func TestShape(t *testing.T) {
+	// A square of one degree with a hole of a tenth of a degree in its middle
+	shape, err := ParseShape([]byte(`{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [
+		[[15, -5], [16, -5], [16, -4], [15, -4], [15, -5]],
+		[[15.45, -4.55], [15.55, -4.55], [15.55, -4.45], [15.45, -4.45], [15.45, -4.55]]
+	]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !shape.Contains(Point{Latitude: -4.2, Longitude: 15.2}) {
+		t.Error("a point of the square was outside")
+	}
+	if shape.Contains(Point{Latitude: -4.5, Longitude: 15.5}) {
+		t.Error("a point of the hole was inside")
+	}
+	if d := shape.DistanceKm(Point{Latitude: -4.2, Longitude: 15.2}); d != 0 {
+		t.Errorf("got %f km for a point inside", d)
+	}
+	// A tenth of a degree East of the square, about 11 km at this latitude
+	if d := shape.DistanceKm(Point{Latitude: -4.5, Longitude: 16.1}); math.Abs(d-11.08) > 0.1 {
+		t.Errorf("got %.2f km, want about 11.08", d)
+	}
+
+	geometry := shape.Geometry()
+	if data, _ := json.Marshal(geometry); geometry.Type != "Polygon" || !strings.HasPrefix(string(data), `{"type":"Polygon","coordinates":[[[15,-5],[16,-5]`) {
+		t.Errorf("got %s, want the square back", data)
+	}
+
+	for _, value := range []string{`{"type": "Point", "coordinates": [15, -4]}`, `{"type": "Polygon", "coordinates": [[[15, -5], [16, -5]]]}`, `not json`} {
+		if _, err := ParseShape([]byte(value)); err == nil {
+			t.Errorf("%s was accepted", value)
+		}
+	}
+}
+
+func TestParseShapes(t *testing.T) {
+	features, err := ParseShapes([]byte(`{"type": "FeatureCollection", "features": [
+		{"type": "Feature", "id": 7, "properties": {"name": "North"}, "geometry": {"type": "Polygon", "coordinates": [[[15, -5], [16, -5], [16, -4], [15, -5]]]}},
+		{"type": "Feature", "id": "south", "properties": null, "geometry": {"type": "MultiPolygon", "coordinates": [[[[15, -6], [16, -6], [16, -5], [15, -6]]], [[[17, -6], [18, -6], [18, -5], [17, -6]]]]}}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(features) != 2 || features[0].ID != "7" || features[0].Properties["name"] != "North" || features[1].ID != "south" || len(features[1].Shape.Polygons) != 2 {
+		t.Errorf("got %+v", features)
+	}
+
+	if _, err := ParseShapes([]byte(`{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[15, -5], [16, -5], [16, -4], [15, -5]]]}}`)); err == nil {
+		t.Error("a lone feature was accepted")
+	}
+	if _, err := ParseShapes([]byte(`{"type": "FeatureCollection", "features": [{"type": "Feature", "geometry": null}]}`)); err == nil {
+		t.Error("a feature without geometry was accepted")
+	}
+}
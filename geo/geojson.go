@@ -0,0 +1,40 @@
+package geo
+
+// FeatureCollection is a GeoJSON feature collection
+type FeatureCollection struct {
+	Type     string    `json:"type"` // Always "FeatureCollection"
+	Features []Feature `json:"features"`
+}
+
+// Feature is a GeoJSON feature
+type Feature struct {
+	Type       string                 `json:"type"` // Always "Feature"
+	ID         string                 `json:"id,omitempty"`
+	Geometry   Geometry               `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// Geometry is a GeoJSON geometry. Coordinates nest as the type requires,
+// longitude first.
+type Geometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// NewFeatureCollection wraps features, never leaving them null
+func NewFeatureCollection(features []Feature) FeatureCollection {
+	if features == nil {
+		features = []Feature{}
+	}
+	return FeatureCollection{Type: "FeatureCollection", Features: features}
+}
+
+// PointFeature places properties at p
+func PointFeature(id string, p Point, properties map[string]interface{}) Feature {
+	return Feature{
+		Type:       "Feature",
+		ID:         id,
+		Geometry:   Geometry{Type: "Point", Coordinates: []float64{p.Longitude, p.Latitude}},
+		Properties: properties,
+	}
+}
@@ -0,0 +1,207 @@
+package geo
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// Shape is an area made of polygons, each an outer ring followed by its holes
+type Shape struct {
+	Polygons [][][]Point
+}
+
+// geoJSONShape reads a GeoJSON geometry, or the geometry of a feature
+type geoJSONShape struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+	Geometry    *geoJSONShape   `json:"geometry"`
+}
+
+// ParseShape reads a GeoJSON Polygon or MultiPolygon, bare or as the
+// geometry of a Feature
+func ParseShape(data []byte) (Shape, error) {
+	var raw geoJSONShape
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return Shape{}, fmt.Errorf("invalid GeoJSON: %w", err)
+	}
+	if raw.Type == "Feature" {
+		if raw.Geometry == nil {
+			return Shape{}, fmt.Errorf("the feature has no geometry")
+		}
+		raw = *raw.Geometry
+	}
+
+	var polygons [][][][]float64
+	switch raw.Type {
+	case "Polygon":
+		var polygon [][][]float64
+		if err := json.Unmarshal(raw.Coordinates, &polygon); err != nil {
+			return Shape{}, fmt.Errorf("invalid Polygon coordinates: %w", err)
+		}
+		polygons = [][][][]float64{polygon}
+	case "MultiPolygon":
+		if err := json.Unmarshal(raw.Coordinates, &polygons); err != nil {
+			return Shape{}, fmt.Errorf("invalid MultiPolygon coordinates: %w", err)
+		}
+	default:
+		return Shape{}, fmt.Errorf("the geometry must be a Polygon or a MultiPolygon, got %q", raw.Type)
+	}
+
+	shape := Shape{Polygons: make([][][]Point, len(polygons))}
+	for i, polygon := range polygons {
+		if len(polygon) == 0 {
+			return Shape{}, fmt.Errorf("polygon %d has no ring", i)
+		}
+		shape.Polygons[i] = make([][]Point, len(polygon))
+		for j, ring := range polygon {
+			if len(ring) < 4 {
+				return Shape{}, fmt.Errorf("ring %d of polygon %d needs at least 4 positions", j, i)
+			}
+			points := make([]Point, len(ring))
+			for k, position := range ring {
+				if len(position) < 2 {
+					return Shape{}, fmt.Errorf("positions need a longitude and a latitude")
+				}
+				points[k] = Point{Latitude: position[1], Longitude: position[0]}
+				if !points[k].Valid() {
+					return Shape{}, fmt.Errorf("position %v is out of range", position)
+				}
+			}
+			shape.Polygons[i][j] = points
+		}
+	}
+	return shape, nil
+}
+
+// ShapeFeature is a feature of a collection read by ParseShapes
+type ShapeFeature struct {
+	// ID is the id of the feature, numbers written out as text
+	ID         string
+	Properties map[string]interface{}
+	Shape      Shape
+}
+
+// ParseShapes reads a GeoJSON FeatureCollection of Polygons and MultiPolygons
+func ParseShapes(data []byte) ([]ShapeFeature, error) {
+	var collection struct {
+		Type     string            `json:"type"`
+		Features []json.RawMessage `json:"features"`
+	}
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return nil, fmt.Errorf("invalid GeoJSON: %w", err)
+	}
+	if collection.Type != "FeatureCollection" {
+		return nil, fmt.Errorf("expected a FeatureCollection, got %q", collection.Type)
+	}
+
+	features := make([]ShapeFeature, len(collection.Features))
+	for i, raw := range collection.Features {
+		var feature struct {
+			ID         json.RawMessage        `json:"id"`
+			Properties map[string]interface{} `json:"properties"`
+		}
+		if err := json.Unmarshal(raw, &feature); err != nil {
+			return nil, fmt.Errorf("feature %d: %w", i, err)
+		}
+		shape, err := ParseShape(raw)
+		if err != nil {
+			return nil, fmt.Errorf("feature %d: %w", i, err)
+		}
+		id := string(feature.ID)
+		var text string
+		if json.Unmarshal(feature.ID, &text) == nil {
+			id = text
+		}
+		features[i] = ShapeFeature{ID: id, Properties: feature.Properties, Shape: shape}
+	}
+	return features, nil
+}
+
+// Geometry returns s as a GeoJSON Polygon, or a MultiPolygon when it has
+// several
+func (s Shape) Geometry() Geometry {
+	polygons := make([][][][]float64, len(s.Polygons))
+	for i, polygon := range s.Polygons {
+		polygons[i] = make([][][]float64, len(polygon))
+		for j, ring := range polygon {
+			polygons[i][j] = make([][]float64, len(ring))
+			for k, p := range ring {
+				polygons[i][j][k] = []float64{p.Longitude, p.Latitude}
+			}
+		}
+	}
+	if len(polygons) == 1 {
+		return Geometry{Type: "Polygon", Coordinates: polygons[0]}
+	}
+	return Geometry{Type: "MultiPolygon", Coordinates: polygons}
+}
+
+// inRing reports whether p lies inside ring, by the even-odd rule
+func inRing(p Point, ring []Point) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a.Latitude > p.Latitude) != (b.Latitude > p.Latitude) &&
+			p.Longitude < (b.Longitude-a.Longitude)*(p.Latitude-a.Latitude)/(b.Latitude-a.Latitude)+a.Longitude {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// Contains reports whether p lies inside a polygon of s, out of its holes
+func (s Shape) Contains(p Point) bool {
+	for _, polygon := range s.Polygons {
+		if !inRing(p, polygon[0]) {
+			continue
+		}
+		inHole := false
+		for _, hole := range polygon[1:] {
+			if inRing(p, hole) {
+				inHole = true
+				break
+			}
+		}
+		if !inHole {
+			return true
+		}
+	}
+	return false
+}
+
+// DistanceKm returns how far p lies from s in kilometres, 0 inside it. The
+// edges are measured on a plane tangent at p, close enough over the width of
+// a province.
+func (s Shape) DistanceKm(p Point) float64 {
+	if s.Contains(p) {
+		return 0
+	}
+	kmPerDegree := EarthRadiusKm * math.Pi / 180
+	cos := math.Cos(radians(p.Latitude))
+	project := func(q Point) (float64, float64) {
+		return (q.Longitude - p.Longitude) * cos * kmPerDegree, (q.Latitude - p.Latitude) * kmPerDegree
+	}
+
+	best := math.Inf(1)
+	for _, polygon := range s.Polygons {
+		for _, ring := range polygon {
+			for i := 1; i < len(ring); i++ {
+				ax, ay := project(ring[i-1])
+				bx, by := project(ring[i])
+				best = math.Min(best, segmentDistance(ax, ay, bx, by))
+			}
+		}
+	}
+	return best
+}
+
+// segmentDistance returns the distance from the origin to the segment [a, b]
+func segmentDistance(ax, ay, bx, by float64) float64 {
+	dx, dy := bx-ax, by-ay
+	t := 0.0
+	if length := dx*dx + dy*dy; length > 0 {
+		t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/length))
+	}
+	return math.Hypot(ax+t*dx, ay+t*dy)
+}
@@ -0,0 +1,109 @@
+// Package geofence checks the device position sent with a sale against the
+// outlet it was made at, or else the boundary of its province, so reports
+// filed far from the field stand out.
+package geofence
+
+import (
+	"math"
+
+	"github.com/Danny19977/sr-api/app"
+	"github.com/Danny19977/sr-api/geo"
+	"github.com/Danny19977/sr-api/models"
+)
+
+// The statuses of a sale. Unchecked sales had a position but no outlet or
+// boundary to hold it against, or were sent while the policy was off.
+const (
+	Inside    = "inside"
+	Outside   = "outside"
+	Missing   = "missing"
+	Unchecked = "unchecked"
+)
+
+// maxAccuracy caps in metres the benefit of the doubt given to a coarse fix,
+// so a position reported as accurate to a few kilometres clears nothing
+const maxAccuracy = 1000
+
+// Result is the outcome of the check of a sale
+type Result struct {
+	Status string `json:"status"`
+	// Against is outlet or province, empty when nothing was checked
+	Against string `json:"against,omitempty"`
+	// Distance is how many metres the position lies out of the area
+	Distance float64 `json:"distance"`
+}
+
+// NearOutlet checks position, accurate to accuracy metres, against a circle
+// of radius metres around outlet
+func NearOutlet(position geo.Point, accuracy float64, outlet *models.Outlet, radius float64) Result {
+	if outlet.GeofenceRadius > 0 {
+		radius = outlet.GeofenceRadius
+	}
+	out := geo.Distance(position, outlet.Position())*1000 - radius
+	return judge("outlet", out, accuracy)
+}
+
+// InShape checks position, accurate to accuracy metres, against the boundary
+// of a province
+func InShape(position geo.Point, accuracy float64, boundary geo.Shape) Result {
+	return judge("province", boundary.DistanceKm(position)*1000, accuracy)
+}
+
+// judge turns the metres out of an area into a result, the accuracy of the
+// fix counting in favour of the sale
+func judge(against string, out, accuracy float64) Result {
+	out = math.Max(0, out-math.Min(accuracy, maxAccuracy))
+	if out == 0 {
+		return Result{Status: Inside, Against: against}
+	}
+	return Result{Status: Outside, Against: against, Distance: math.Round(out)}
+}
+
+// Checker checks new sales with the settings of the application
+type Checker struct {
+	app *app.App
+}
+
+// New creates a checker reading the outlets and provinces of a
+func New(a *app.App) *Checker {
+	return &Checker{app: a}
+}
+
+// Check places the position of sale against its outlet when it has one, or
+// else the boundary of its province
+func (g *Checker) Check(sale *models.Sale) (Result, error) {
+	if sale.Latitude == nil || sale.Longitude == nil {
+		return Result{Status: Missing}, nil
+	}
+	cfg := g.app.Config.Geofence
+	if cfg.Policy == "off" {
+		return Result{Status: Unchecked}, nil
+	}
+
+	position := geo.Point{Latitude: *sale.Latitude, Longitude: *sale.Longitude}
+	var accuracy float64
+	if sale.Accuracy != nil {
+		accuracy = *sale.Accuracy
+	}
+
+	if sale.OutletUUID != nil {
+		outlet, err := g.app.Outlets.Find(*sale.OutletUUID)
+		if err != nil {
+			return Result{}, err
+		}
+		return NearOutlet(position, accuracy, outlet, cfg.OutletRadius), nil
+	}
+
+	province, err := g.app.Geography.FindProvince(sale.ProvinceUUID)
+	if err != nil {
+		return Result{}, err
+	}
+	if province.Boundary == "" {
+		return Result{Status: Unchecked}, nil
+	}
+	boundary, err := geo.ParseShape([]byte(province.Boundary))
+	if err != nil {
+		return Result{}, err
+	}
+	return InShape(position, accuracy, boundary), nil
+}
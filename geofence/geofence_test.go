@@ -0,0 +1,101 @@
+package geofence_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Danny19977/sr-api/apptest"
+	"github.com/Danny19977/sr-api/models"
+	"github.com/google/uuid"
+)
+
+func TestSalesAreCheckedAgainstTheProvinceAndTheOutlet(t *testing.T) {
+	env := apptest.New(t)
+	country := &models.Country{UUID: uuid.New().String(), Name: "Country"}
+	if err := env.App.Geography.CreateCountry(country); err != nil {
+		t.Fatal(err)
+	}
+	north := &models.Province{UUID: uuid.New().String(), Name: "North", CountryUUID: country.UUID}
+	if err := env.App.Geography.CreateProvince(north); err != nil {
+		t.Fatal(err)
+	}
+	admin := env.CreateUser("Admin", nil)
+	token := env.Token(admin)
+
+	boundary := map[string]interface{}{
+		"type":        "Polygon",
+		"coordinates": [][][]float64{{{15, -5}, {16, -5}, {16, -4}, {15, -4}, {15, -5}}},
+	}
+	if res := env.Do("PUT", "/api/provinces/boundary/"+north.UUID, env.Token(env.CreateUser("ASM", &north.UUID)), boundary); res.Status != 403 {
+		t.Fatalf("an ASM setting a boundary: got %d %s, want 403", res.Status, res.Body)
+	}
+	if res := env.Do("PUT", "/api/provinces/boundary/"+north.UUID, token, boundary); res.Status != 200 {
+		t.Fatalf("setting the boundary: got %d %s", res.Status, res.Body)
+	}
+	outlet := &models.Outlet{UUID: uuid.New().String(), Name: "Kiosk", Type: "kiosk", Latitude: -4.5, Longitude: 15.5, ProvinceUUID: north.UUID}
+	if err := env.App.Outlets.Create(outlet); err != nil {
+		t.Fatal(err)
+	}
+
+	create := func(position map[string]interface{}) (int, models.Sale) {
+		sale := map[string]interface{}{
+			"province_uuid": north.UUID,
+			"product_uuid":  uuid.New().String(),
+			"user_uuid":     admin.UUID,
+			"quantity":      10,
+		}
+		for k, v := range position {
+			sale[k] = v
+		}
+		var created struct {
+			Data models.Sale `json:"data"`
+		}
+		res := env.Do("POST", "/api/sales/create", token, sale)
+		res.JSON(&created)
+		return res.Status, created.Data
+	}
+
+	if _, sale := create(map[string]interface{}{"latitude": -4.2, "longitude": 15.2, "accuracy": 20}); sale.GeofenceStatus != "inside" {
+		t.Errorf("a sale within the province: got %q", sale.GeofenceStatus)
+	}
+	status, home := create(map[string]interface{}{"latitude": -4.5, "longitude": 16.1})
+	if status != 200 || home.GeofenceStatus != "outside" || home.GeofenceDistance < 10000 {
+		t.Errorf("a sale 11 km out of the province: got %d %q %v m", status, home.GeofenceStatus, home.GeofenceDistance)
+	}
+	// The outlet is inside the province but the position is 1 km from it
+	if _, sale := create(map[string]interface{}{"outlet_uuid": outlet.UUID, "latitude": -4.509, "longitude": 15.5}); sale.GeofenceStatus != "outside" {
+		t.Errorf("a sale away from its outlet: got %q", sale.GeofenceStatus)
+	}
+	if _, sale := create(nil); sale.GeofenceStatus != "missing" {
+		t.Errorf("a sale without position: got %q", sale.GeofenceStatus)
+	}
+	if status, _ := create(map[string]interface{}{"latitude": -4.2}); status != 400 {
+		t.Errorf("a latitude without longitude: got %d, want 400", status)
+	}
+
+	env.App.Config.Geofence.Policy = "reject"
+	if status, _ := create(map[string]interface{}{"latitude": -4.5, "longitude": 16.1}); status != 422 {
+		t.Errorf("a sale out of the province under the reject policy: got %d, want 422", status)
+	}
+	env.App.Config.Geofence.RequireLocation = true
+	if status, _ := create(nil); status != 400 {
+		t.Errorf("a sale without position when required: got %d, want 400", status)
+	}
+
+	var report struct {
+		Data []models.Sale `json:"data"`
+	}
+	today := time.Now().Format("2006-01-02")
+	if err := env.Do("GET", "/api/sales/geofence?start_date="+today, token, nil).JSON(&report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Data) != 2 || report.Data[0].UUID != home.UUID {
+		t.Errorf("got %d sales outside, want the sale from home and the one away from its outlet", len(report.Data))
+	}
+	if err := env.Do("GET", "/api/sales/geofence?status=outside,missing", token, nil).JSON(&report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Data) != 3 {
+		t.Errorf("got %d sales outside or without position, want 3", len(report.Data))
+	}
+}
@@ -0,0 +1,41 @@
+package geofence
+
+import (
+	"testing"
+
+	"github.com/Danny19977/sr-api/geo"
+	"github.com/Danny19977/sr-api/models"
+)
+
+func TestNearOutlet(t *testing.T) {
+	outlet := &models.Outlet{Latitude: -4.3217, Longitude: 15.3126}
+	// About 333 m North of the outlet
+	position := geo.Point{Latitude: -4.3187, Longitude: 15.3126}
+
+	if r := NearOutlet(position, 0, outlet, 200); r.Status != Outside || r.Against != "outlet" || r.Distance < 130 || r.Distance > 136 {
+		t.Errorf("got %+v, want about 133 m outside the outlet", r)
+	}
+	if r := NearOutlet(position, 150, outlet, 200); r.Status != Inside {
+		t.Errorf("got %+v, want the accuracy of the fix to clear it", r)
+	}
+	outlet.GeofenceRadius = 400
+	if r := NearOutlet(position, 0, outlet, 200); r.Status != Inside {
+		t.Errorf("got %+v, want the radius of the outlet to clear it", r)
+	}
+}
+
+func TestInShape(t *testing.T) {
+	square, err := geo.ParseShape([]byte(`{"type": "Polygon", "coordinates": [[[15, -5], [16, -5], [16, -4], [15, -4], [15, -5]]]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r := InShape(geo.Point{Latitude: -4.5, Longitude: 15.5}, 0, square); r.Status != Inside || r.Distance != 0 {
+		t.Errorf("got %+v, want inside", r)
+	}
+	// About 11 km East of the square: a coarse fix earns at most maxAccuracy
+	r := InShape(geo.Point{Latitude: -4.5, Longitude: 16.1}, 50000, square)
+	if r.Status != Outside || r.Against != "province" || r.Distance < 9900 || r.Distance > 10300 {
+		t.Errorf("got %+v, want about 10 km outside the province", r)
+	}
+}
@@ -0,0 +1,126 @@
+package mailer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"sync"
+
+	"github.com/Danny19977/sr-api/config"
+)
+
+// Message is an email ready to be delivered
+type Message struct {
+	To          []string
+	Subject     string
+	HTML        string
+	Attachments []Attachment
+}
+
+// Attachment is a file sent along with a message
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Mailer delivers email messages
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// SMTPMailer sends messages through the SMTP server of the configuration
+type SMTPMailer struct {
+	cfg config.SMTPConfig
+}
+
+// NewSMTPMailer creates a mailer for the given SMTP settings
+func NewSMTPMailer(cfg config.SMTPConfig) *SMTPMailer {
+	return &SMTPMailer{cfg: cfg}
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	if !m.cfg.Enabled() {
+		return fmt.Errorf("smtp is not configured")
+	}
+
+	auth := smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", m.cfg.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(msg.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	if len(msg.Attachments) == 0 {
+		b.WriteString("Content-Type: text/html; charset=\"UTF-8\"\r\n\r\n")
+		b.WriteString(msg.HTML)
+	} else if err := writeMultipart(&b, msg); err != nil {
+		return err
+	}
+
+	return smtp.SendMail(m.cfg.Addr(), auth, m.cfg.From, msg.To, []byte(b.String()))
+}
+
+// writeMultipart writes the HTML body and the attachments of msg as a
+// multipart/mixed entity
+func writeMultipart(b *strings.Builder, msg Message) error {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	fmt.Fprintf(b, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", w.Boundary())
+
+	part, err := w.CreatePart(textproto.MIMEHeader{"Content-Type": {`text/html; charset="UTF-8"`}})
+	if err != nil {
+		return err
+	}
+	part.Write([]byte(msg.HTML))
+
+	for _, attachment := range msg.Attachments {
+		part, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {attachment.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})},
+		})
+		if err != nil {
+			return err
+		}
+		// Lines of base64 must not exceed 76 characters
+		encoded := base64.StdEncoding.EncodeToString(attachment.Data)
+		for len(encoded) > 76 {
+			part.Write([]byte(encoded[:76] + "\r\n"))
+			encoded = encoded[76:]
+		}
+		part.Write([]byte(encoded + "\r\n"))
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	b.Write(body.Bytes())
+	return nil
+}
+
+// MemoryMailer keeps messages in memory instead of sending them, for tests
+// and for running without an SMTP server
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (m *MemoryMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns a copy of every message sent so far
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
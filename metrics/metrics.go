@@ -0,0 +1,120 @@
+// Package metrics computes the sales indicators shared by the dashboards and
+// the background jobs, on top of the dashboard repository.
+package metrics
+
+import (
+	"time"
+
+	"github.com/Danny19977/sr-api/fiscal"
+	"github.com/Danny19977/sr-api/repository"
+	"github.com/Danny19977/sr-api/workdays"
+)
+
+// SameTimeRanges returns today from midnight to now, followed by the same
+// span of each of the days previous working days of cal, the closest first
+func SameTimeRanges(cal workdays.Calendar, now time.Time, days int) []repository.TimeRange {
+	startOfToday := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	ranges := []repository.TimeRange{{From: startOfToday, To: now}}
+	for _, day := range cal.Previous(now, days) {
+		ranges = append(ranges, SameTimeOf(day, now))
+	}
+	return ranges
+}
+
+// SameTimeOf returns the span of day from midnight to the time of day of now,
+// to the minute
+func SameTimeOf(day, now time.Time) repository.TimeRange {
+	elapsed := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, now.Location())
+	return repository.TimeRange{From: start, To: start.Add(elapsed)}
+}
+
+// PaceChange returns how much current differs from the average of baseline,
+// in percent. It is 0 when the baseline sold nothing.
+func PaceChange(current int64, baseline []int64) float64 {
+	var total int64
+	for _, value := range baseline {
+		total += value
+	}
+	if len(baseline) == 0 || total == 0 {
+		return 0
+	}
+	average := float64(total) / float64(len(baseline))
+	return (float64(current) - average) / average * 100
+}
+
+// ProvincePace returns the PaceChange of each province selling today or in
+// the days previous working days at the same time of day
+func ProvincePace(d repository.DashboardRepository, cal workdays.Calendar, now time.Time, days int, provinceUUIDs []string) (map[string]float64, error) {
+	ranges := SameTimeRanges(cal, now, days)
+	days = len(ranges) - 1
+
+	current := make(map[string]int64)
+	baseline := make(map[string][]int64)
+	for i, r := range ranges {
+		totals, err := d.ProvinceTotals(r, provinceUUIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, total := range totals {
+			if i == 0 {
+				current[total.UUID] = total.Total
+				continue
+			}
+			if baseline[total.UUID] == nil {
+				baseline[total.UUID] = make([]int64, days)
+			}
+			baseline[total.UUID][i-1] = total.Total
+		}
+	}
+
+	pace := make(map[string]float64, len(baseline))
+	for uuid, values := range baseline {
+		pace[uuid] = PaceChange(current[uuid], values)
+	}
+	return pace, nil
+}
+
+// PeriodTarget is the target of a province for the week or month holding a date
+type PeriodTarget struct {
+	// From is the start of the period, To the start of the next one
+	From time.Time
+	To   time.Time
+	// Targets maps each province to its target for the period
+	Targets map[string]int64
+}
+
+// WeekTargets returns the targets of the fiscal week holding t
+func WeekTargets(d repository.DashboardRepository, cal fiscal.Calendar, t time.Time, provinceUUIDs []string) (PeriodTarget, error) {
+	week := cal.WeekOf(t)
+	target := PeriodTarget{From: week.From, To: week.To, Targets: make(map[string]int64)}
+
+	rows, err := d.WeeklyTargets([]int{week.Year}, provinceUUIDs)
+	if err != nil {
+		return target, err
+	}
+	for _, row := range rows {
+		if row.Period == week.Index {
+			target.Targets[row.ProvinceUUID] += row.Target
+		}
+	}
+	return target, nil
+}
+
+// MonthTargets returns the targets of the fiscal month holding t
+func MonthTargets(d repository.DashboardRepository, cal fiscal.Calendar, t time.Time, provinceUUIDs []string) (PeriodTarget, error) {
+	month := cal.MonthOf(t)
+	target := PeriodTarget{From: month.From, To: month.To, Targets: make(map[string]int64)}
+
+	rows, err := d.MonthlyTargets([]int{month.Year}, provinceUUIDs)
+	if err != nil {
+		return target, err
+	}
+	for _, row := range rows {
+		if cal.MonthIndex(time.Month(row.Period)) == month.Index {
+			target.Targets[row.ProvinceUUID] += row.Target
+		}
+	}
+	return target, nil
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Danny19977/sr-api/workdays"
+)
+
+func TestSameTimeRanges(t *testing.T) {
+	now := time.Date(2024, 3, 7, 15, 30, 45, 0, time.UTC)
+	ranges := SameTimeRanges(workdays.Default, now, 2)
+
+	if len(ranges) != 3 {
+		t.Fatalf("got %d ranges, want 3", len(ranges))
+	}
+	if !ranges[0].From.Equal(time.Date(2024, 3, 7, 0, 0, 0, 0, time.UTC)) || !ranges[0].To.Equal(now) {
+		t.Errorf("today = %v", ranges[0])
+	}
+	if want := time.Date(2024, 3, 5, 15, 30, 0, 0, time.UTC); !ranges[2].To.Equal(want) {
+		t.Errorf("two days ago ends at %v, want %v", ranges[2].To, want)
+	}
+
+	// Monday is compared with Saturday and Friday, past Sunday and the holiday
+	cal, _ := workdays.New("1,2,3,4,5,6", map[string]string{"2024-03-08": "Women's Day"})
+	monday := time.Date(2024, 3, 11, 10, 0, 0, 0, time.UTC)
+	ranges = SameTimeRanges(cal, monday, 2)
+	if len(ranges) != 3 || ranges[1].From.Day() != 9 || ranges[2].From.Day() != 7 {
+		t.Errorf("got %v, want March 9th and 7th", ranges)
+	}
+}
+
+func TestPaceChange(t *testing.T) {
+	cases := []struct {
+		current  int64
+		baseline []int64
+		want     float64
+	}{
+		{75, []int64{100}, -25},
+		{150, []int64{50, 150}, 50},
+		{10, []int64{0, 0}, 0},
+		{10, nil, 0},
+	}
+	for _, tc := range cases {
+		if got := PaceChange(tc.current, tc.baseline); got != tc.want {
+			t.Errorf("PaceChange(%d, %v) = %v, want %v", tc.current, tc.baseline, got, tc.want)
+		}
+	}
+}
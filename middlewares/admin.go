@@ -0,0 +1,30 @@
+package middlewares
+
+import (
+	"github.com/Danny19977/sr-api/repository"
+	"github.com/Danny19977/sr-api/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireAdmin guards the routes changing settings shared by every province,
+// such as calendars, territories and alert rules, so only admins reach them.
+// It runs after IsAuthenticated.
+func RequireAdmin(users repository.UserRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userUUID, err := utils.GetUserUUIDFromToken(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Unauthenticated",
+			})
+		}
+		user, err := users.FindByUUID(userUUID)
+		if err != nil || user.Role != "Admin" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Only admins change this setting",
+			})
+		}
+		return c.Next()
+	}
+}
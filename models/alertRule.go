@@ -0,0 +1,98 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// Alert rule kinds
+const (
+	// RuleTargetAchievement fires when a province sold less than Threshold
+	// percent of its week or month target by day FromDay of the period
+	RuleTargetAchievement = "target_achievement"
+	// RulePaceDrop fires when today's sales so far are more than Threshold
+	// percent below the average of the BaselineDays previous working days at the
+	// same time
+	RulePaceDrop = "pace_drop"
+)
+
+// AlertRule is a threshold on target achievement or daily pace, checked for
+// every province of its scope by the alerting engine
+type AlertRule struct {
+	UUID      string    `json:"uuid" gorm:"primaryKey;unique;not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Name string `json:"name" gorm:"not null"`
+	Kind string `json:"kind" gorm:"type:varchar(30);not null"`
+	// Period is "week" or "month" for target rules
+	Period    string  `json:"period" gorm:"type:varchar(10)"`
+	Threshold float64 `json:"threshold" gorm:"not null"` // In percent
+	// FromDay is the first day of the fiscal week or month the rule is
+	// checked on, 1 being the first day of the period
+	FromDay int `json:"from_day"`
+	// BaselineDays is the number of previous working days pace rules compare
+	// against
+	BaselineDays int `json:"baseline_days"`
+
+	// The rule covers a province, every province of a country, or every
+	// province when both are empty
+	CountryUUID  *string `json:"country_uuid" gorm:"type:varchar(255);index"`
+	ProvinceUUID *string `json:"province_uuid" gorm:"type:varchar(255);index"`
+
+	// CooldownMinutes is the quiet time after a rule fires for a province
+	CooldownMinutes int  `json:"cooldown_minutes"`
+	Active          bool `json:"active"`
+}
+
+// Cooldown returns the quiet time after the rule fires for a province
+func (r *AlertRule) Cooldown() time.Duration {
+	return time.Duration(r.CooldownMinutes) * time.Minute
+}
+
+// Validate reports the first setting that prevents the rule from being checked
+func (r *AlertRule) Validate() error {
+	if r.Name == "" {
+		return errors.New("name is required")
+	}
+	switch r.Kind {
+	case RuleTargetAchievement:
+		switch r.Period {
+		case "week":
+			if r.FromDay < 1 || r.FromDay > 7 {
+				return errors.New("from_day must be between 1 (Monday) and 7 (Sunday) on weekly rules")
+			}
+		case "month":
+			if r.FromDay < 1 || r.FromDay > 31 {
+				return errors.New("from_day must be between 1 and 31 on monthly rules")
+			}
+		default:
+			return errors.New("period must be week or month")
+		}
+	case RulePaceDrop:
+		if r.BaselineDays < 1 || r.BaselineDays > 90 {
+			return errors.New("baseline_days must be between 1 and 90")
+		}
+	default:
+		return errors.New("kind must be target_achievement or pace_drop")
+	}
+	if r.Threshold <= 0 {
+		return errors.New("threshold must be positive")
+	}
+	if r.CooldownMinutes < 0 {
+		return errors.New("cooldown_minutes must not be negative")
+	}
+	return nil
+}
+
+// AlertRuleFiring records a rule firing for a province, for the cooldown and
+// for reporting
+type AlertRuleFiring struct {
+	UUID         string    `json:"uuid" gorm:"primaryKey;unique;not null"`
+	RuleUUID     string    `json:"rule_uuid" gorm:"type:varchar(255);not null;index:idx_rule_firing_lookup"`
+	ProvinceUUID string    `json:"province_uuid" gorm:"type:varchar(255);not null;index:idx_rule_firing_lookup"`
+	FiredAt      time.Time `json:"fired_at" gorm:"not null;index:idx_rule_firing_lookup"`
+	// Value is the achievement or the pace change that crossed the threshold, in percent
+	Value   float64 `json:"value"`
+	Message string  `json:"message"`
+}
@@ -1,7 +1,11 @@
 package models
 
 import (
+	"fmt"
 	"time"
+
+	"github.com/Danny19977/sr-api/fiscal"
+	"github.com/Danny19977/sr-api/workdays"
 )
 
 type Country struct {
@@ -13,7 +17,59 @@ type Country struct {
 	Name      string `json:"name"`
 	Signature string `json:"signature"`
 
+	// Fiscal calendar of the dashboards and targets, calendar years with ISO
+	// weeks when unset. FiscalYearStart is the first month (1-12),
+	// FiscalPattern "", "4-4-5", "4-5-4" or "5-4-4" and FiscalWeekStart the
+	// ISO day the weeks start on (1 is Monday, 7 Sunday).
+	FiscalYearStart int    `json:"fiscal_year_start"`
+	FiscalPattern   string `json:"fiscal_pattern" gorm:"type:varchar(10)"`
+	FiscalWeekStart int    `json:"fiscal_week_start"`
+	// WorkingDays lists the ISO days worked, "1,2,3,4,5,6" when empty
+	WorkingDays string `json:"working_days" gorm:"type:varchar(20)"`
+
 	// Use slices, not pointer to slices, for GORM relations
 	Users     []User     `gorm:"foreignKey:CountryUUID;references:UUID"`
 	Provinces []Province `gorm:"foreignKey:CountryUUID;references:UUID"`
+	Holidays  []Holiday  `gorm:"foreignKey:CountryUUID;references:UUID" json:"-"`
+}
+
+// ValidateCalendar reports the first fiscal setting of the country that
+// cannot be used
+func (c *Country) ValidateCalendar() error {
+	if c.FiscalYearStart < 0 || c.FiscalYearStart > 12 {
+		return fmt.Errorf("fiscal year start must be a month between 1 and 12")
+	}
+	if c.FiscalWeekStart < 0 || c.FiscalWeekStart > 7 {
+		return fmt.Errorf("fiscal week start must be a day between 1 (Monday) and 7 (Sunday)")
+	}
+	if _, err := workdays.ParseWeekdays(c.WorkingDays); err != nil {
+		return err
+	}
+	return c.Calendar().Validate()
+}
+
+// Calendar returns the fiscal calendar of the country
+func (c *Country) Calendar() fiscal.Calendar {
+	cal := fiscal.Gregorian
+	if c.FiscalYearStart != 0 {
+		cal.StartMonth = time.Month(c.FiscalYearStart)
+	}
+	cal.Pattern = c.FiscalPattern
+	if c.FiscalWeekStart != 0 {
+		cal.WeekStart = time.Weekday(c.FiscalWeekStart % 7)
+	}
+	return cal
+}
+
+// Workdays returns the working-day calendar of the country with holidays
+func (c *Country) Workdays(holidays []Holiday) workdays.Calendar {
+	dates := make(map[string]string, len(holidays))
+	for _, holiday := range holidays {
+		dates[holiday.Date.Format("2006-01-02")] = holiday.Name
+	}
+	cal, err := workdays.New(c.WorkingDays, dates)
+	if err != nil {
+		cal.Holidays = dates
+	}
+	return cal
 }
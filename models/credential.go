@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Credential holds the password hash of a user, kept out of the users table
+// so that no query or serialization of a user carries it
+type Credential struct {
+	UserUUID     string    `json:"-" gorm:"primaryKey;type:varchar(255)"`
+	PasswordHash string    `json:"-" gorm:"not null"`
+	UpdatedAt    time.Time `json:"-"`
+}
+
+// NewCredential hashes password for the user of userUUID
+func NewCredential(userUUID, password string) (*Credential, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+	if err != nil {
+		return nil, err
+	}
+	return &Credential{UserUUID: userUUID, PasswordHash: string(hash)}, nil
+}
+
+// Compare returns nil when password matches the hash
+func (c *Credential) Compare(password string) error {
+	return bcrypt.CompareHashAndPassword([]byte(c.PasswordHash), []byte(password))
+}
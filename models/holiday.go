@@ -0,0 +1,31 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Holiday is a public holiday of a country. The dashboards do not count it as
+// a working day.
+type Holiday struct {
+	UUID      string    `json:"uuid" gorm:"primaryKey;unique;not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	CountryUUID string    `json:"country_uuid" gorm:"type:varchar(255);not null;uniqueIndex:idx_holiday_day"`
+	Date        time.Time `json:"date" gorm:"type:date;not null;uniqueIndex:idx_holiday_day"`
+	Name        string    `json:"name" gorm:"not null"`
+}
+
+// Validate checks a holiday before it is saved
+func (h *Holiday) Validate() error {
+	h.Name = strings.TrimSpace(h.Name)
+	if h.Name == "" {
+		return errors.New("name is required")
+	}
+	if h.Date.IsZero() {
+		return errors.New("date is required")
+	}
+	return nil
+}
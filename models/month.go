@@ -19,4 +19,8 @@ type Month struct {
 	Province     Province `json:"province" gorm:"foreignKey:ProvinceUUID;references:UUID"`
 	ProductUUID  string   `json:"product_uuid" gorm:"type:varchar(255)"`
 	YearUUID     string   `json:"year_uuid" gorm:"type:varchar(255)"`
+
+	// TerritoryUUID attaches the target to a node of the territory tree
+	// other than a province
+	TerritoryUUID *string `json:"territory_uuid" gorm:"type:varchar(255)"`
 }
@@ -6,12 +6,30 @@ import (
 
 type Notification struct {
 	UUID      string    `gorm:"primaryKey;not null;unique" json:"uuid"`
-	Name      string    `json:"name" gorm:"unique;not null"`
+	Name      string    `json:"name" gorm:"not null"`
 	Message   string    `json:"message" gorm:"not null"`
-	Type      string    `json:"type" gorm:"not null"`           // e.g., "info", "warning", "error"
-	Status    string    `json:"status" gorm:"default:'unread'"` // e.g., "read", "unread"
-	UserUUID  string    `json:"user_uuid" gorm:"not null"`      // UUID of the recipient
+	Type      string    `json:"type" gorm:"not null"`                                                    // e.g., "info", "warning", "error"
+	Status    string    `json:"status" gorm:"default:'unread';index:idx_notifications_inbox,priority:2"` // e.g., "read", "unread"
+	UserUUID  string    `json:"user_uuid" gorm:"not null;index:idx_notifications_inbox,priority:1"`      // UUID of the recipient
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	DeletedAt time.Time `json:"deleted_at" gorm:"index"`
+
+	ReadAt *time.Time `json:"read_at"`
+	// ExpiresAt is when the notification is purged, never when nil
+	ExpiresAt *time.Time `json:"expires_at" gorm:"index"`
+	// BroadcastUUID groups the copies of a notification sent to an audience
+	BroadcastUUID *string `json:"broadcast_uuid" gorm:"type:varchar(255);index"`
+}
+
+// NotificationPreference holds what a user agreed to receive. A user without
+// preferences receives everything.
+type NotificationPreference struct {
+	UserUUID  string    `json:"user_uuid" gorm:"primaryKey;type:varchar(255)"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// MuteInApp stops alerts and broadcasts from reaching the inbox
+	MuteInApp bool `json:"mute_in_app"`
+	// MuteEmail stops alerts from being mailed
+	MuteEmail bool `json:"mute_email"`
 }
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Danny19977/sr-api/geo"
+)
+
+// OutletTypes lists the kinds of point of sale
+var OutletTypes = []string{"shop", "kiosk", "supermarket", "wholesaler", "bar", "restaurant", "other"}
+
+// Outlet is a point of sale. Its node in the territory tree, of the same
+// UUID, sits below its district or else its province.
+type Outlet struct {
+	UUID      string    `json:"uuid" gorm:"primaryKey;unique;not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Name string `json:"name" gorm:"not null"`
+	Type string `json:"type" gorm:"type:varchar(20);not null"`
+
+	OwnerName  string `json:"owner_name"`
+	OwnerPhone string `json:"owner_phone"`
+	OwnerEmail string `json:"owner_email"`
+
+	Latitude  float64 `json:"latitude" gorm:"index:idx_outlets_position"`
+	Longitude float64 `json:"longitude" gorm:"index:idx_outlets_position"`
+	// GeofenceRadius is how many metres around the outlet its sales may be
+	// sent from, the configured default when 0
+	GeofenceRadius float64 `json:"geofence_radius"`
+
+	ProvinceUUID string    `json:"province_uuid" gorm:"type:varchar(255);not null;index"`
+	Province     *Province `json:"province,omitempty" gorm:"foreignKey:ProvinceUUID;references:UUID"`
+	// TerritoryUUID places the outlet in a district of its province when set
+	TerritoryUUID *string `json:"territory_uuid" gorm:"type:varchar(255)"`
+
+	Signature string `json:"signature"`
+}
+
+// Position returns the GPS coordinates of the outlet
+func (o *Outlet) Position() geo.Point {
+	return geo.Point{Latitude: o.Latitude, Longitude: o.Longitude}
+}
+
+// Validate checks the name, type and coordinates of the outlet
+func (o *Outlet) Validate() error {
+	o.Name = strings.TrimSpace(o.Name)
+	if o.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if o.Type == "" {
+		o.Type = "shop"
+	}
+	if !slices.Contains(OutletTypes, o.Type) {
+		return fmt.Errorf("type must be one of %s", strings.Join(OutletTypes, ", "))
+	}
+	if o.ProvinceUUID == "" {
+		return fmt.Errorf("province_uuid is required")
+	}
+	if !o.Position().Valid() {
+		return fmt.Errorf("latitude must lie between -90 and 90 and longitude between -180 and 180")
+	}
+	if o.GeofenceRadius < 0 {
+		return fmt.Errorf("geofence_radius must not be negative")
+	}
+	return nil
+}
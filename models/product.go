@@ -9,6 +9,9 @@ type Product struct {
 	DeletedAt time.Time `json:"deleted_at" gorm:"autoDeleteTime"`
 	Name      string    `json:"name" gorm:"not null"`
 	Signature string    `json:"signature"`
+	// Price is the unit price, the value of a sale being its quantity times
+	// the price
+	Price float64 `json:"price"`
 
 	// Relationships
 	Sales []Sale `json:"sales" gorm:"foreignKey:ProductUUID;references:UUID"`
@@ -16,5 +16,9 @@ type Province struct {
 
 	Signature string `json:"signature_uuid"`
 
+	// Boundary is the outline of the province as a GeoJSON Polygon or
+	// MultiPolygon, empty until uploaded
+	Boundary string `json:"-" gorm:"type:text"`
+
 	Users   []User   `gorm:"foreignKey:ProvinceUUID;references:UUID"`
 }
@@ -0,0 +1,148 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Danny19977/sr-api/report"
+)
+
+// Dashboards a report subscription may render
+const (
+	ReportGlobalOverview     = "global-overview"
+	ReportProvincialAnalysis = "provincial-analysis"
+	// ReportAnomalies lists the flagged sales of the period
+	ReportAnomalies = "anomalies"
+)
+
+// ReportDashboards lists the dashboards a report subscription may render
+var ReportDashboards = []string{ReportGlobalOverview, ReportProvincialAnalysis, ReportAnomalies}
+
+// Report run statuses
+const (
+	ReportRunning   = "running"
+	ReportSucceeded = "succeeded"
+	ReportFailed    = "failed"
+)
+
+// ReportSubscription mails a dashboard as a PDF or XLSX file on a cron schedule
+type ReportSubscription struct {
+	UUID      string    `json:"uuid" gorm:"primaryKey;unique;not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Name string `json:"name" gorm:"not null"`
+	// Dashboard is "global-overview", "provincial-analysis" or "anomalies"
+	Dashboard string `json:"dashboard" gorm:"type:varchar(50);not null"`
+	// Period is the period covered relative to the run, e.g. "previous_week"
+	Period string `json:"period" gorm:"type:varchar(30);not null"`
+	// ProvinceUUIDs is the comma separated list of the provinces covered, all when empty
+	ProvinceUUIDs string `json:"province_uuids"`
+	// Recipients is the comma separated list of the email addresses
+	Recipients string `json:"recipients" gorm:"not null"`
+	// Schedule is a cron expression read in the server time zone, e.g.
+	// "0 7 * * 1" for every Monday at 7am
+	Schedule string `json:"schedule" gorm:"not null"`
+	// Format is "pdf" or "xlsx"
+	Format string `json:"format" gorm:"type:varchar(10);not null"`
+	Active bool   `json:"active"`
+
+	// OwnerUUID is the user who created the subscription
+	OwnerUUID string     `json:"owner_uuid" gorm:"type:varchar(255);index"`
+	NextRunAt *time.Time `json:"next_run_at" gorm:"index"`
+	LastRunAt *time.Time `json:"last_run_at"`
+}
+
+// splitCommaList returns the trimmed non-empty items of a comma separated list
+func splitCommaList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Provinces returns the provinces covered, nil for all of them
+func (s *ReportSubscription) Provinces() []string {
+	return splitCommaList(s.ProvinceUUIDs)
+}
+
+// RecipientList returns the email addresses the report is sent to
+func (s *ReportSubscription) RecipientList() []string {
+	return splitCommaList(s.Recipients)
+}
+
+// Validate reports the first setting that prevents the report from running
+func (s *ReportSubscription) Validate() error {
+	if s.Name == "" {
+		return errors.New("name is required")
+	}
+	if !slices.Contains(ReportDashboards, s.Dashboard) {
+		return fmt.Errorf("dashboard must be one of %s", strings.Join(ReportDashboards, ", "))
+	}
+	if _, _, err := report.PeriodRange(s.Period, time.Now()); err != nil {
+		return fmt.Errorf("period must be one of %s", strings.Join(report.Periods, ", "))
+	}
+	if s.Format != report.FormatPDF && s.Format != report.FormatXLSX {
+		return fmt.Errorf("format must be %s or %s", report.FormatPDF, report.FormatXLSX)
+	}
+	if _, err := report.ParseSchedule(s.Schedule); err != nil {
+		return err
+	}
+	recipients := s.RecipientList()
+	if len(recipients) == 0 {
+		return errors.New("recipients must list at least one email address")
+	}
+	for _, recipient := range recipients {
+		if _, err := mail.ParseAddress(recipient); err != nil {
+			return fmt.Errorf("recipient %q is not an email address", recipient)
+		}
+	}
+	return nil
+}
+
+// ScheduleNext sets NextRunAt to the first run after after, or clears it when
+// the subscription is inactive or its schedule never runs
+func (s *ReportSubscription) ScheduleNext(after time.Time) {
+	s.NextRunAt = nil
+	if !s.Active {
+		return
+	}
+	schedule, err := report.ParseSchedule(s.Schedule)
+	if err != nil {
+		return
+	}
+	if next := schedule.Next(after); !next.IsZero() {
+		s.NextRunAt = &next
+	}
+}
+
+// ReportRun is one rendering of a report subscription, its file is kept
+type ReportRun struct {
+	UUID             string `json:"uuid" gorm:"primaryKey;unique;not null"`
+	SubscriptionUUID string `json:"subscription_uuid" gorm:"type:varchar(255);not null;index"`
+
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	// Status is "running", "succeeded" or "failed"
+	Status string `json:"status" gorm:"type:varchar(20);not null"`
+	Error  string `json:"error"`
+	// PeriodStart and PeriodEnd bound the data reported
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+	Recipients  string    `json:"recipients"`
+	// Manual is set on the runs requested through the API
+	Manual bool `json:"manual"`
+
+	Format      string `json:"format" gorm:"type:varchar(10)"`
+	FileName    string `json:"file_name"`
+	ContentType string `json:"content_type"`
+	Size        int    `json:"size"`
+	Output      []byte `json:"-"`
+}
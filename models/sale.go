@@ -14,10 +14,31 @@ type Sale struct {
 	MonthUUID    string `json:"month_uuid"`
 	WeekUUID     string `json:"week_uuid"`
 
+	// TerritoryUUID places the sale on a district or an outlet of the
+	// province when set
+	TerritoryUUID *string `json:"territory_uuid" gorm:"type:varchar(255);index"`
+	// OutletUUID is the point of sale the sale was made at, if known
+	OutletUUID *string `json:"outlet_uuid" gorm:"type:varchar(255);index"`
+
 	UserUUID  string `json:"user_uuid" gorm:"not null"`
 	Quantity  int64  `json:"quantity" gorm:"not null"`
 	Signature string `json:"signature"`
 
+	// AnomalyScore is the robust z-score of the quantity against the recent
+	// sales of the province, product and time slot, 0 without enough of them.
+	// Flagged marks an outlier saved after confirmation.
+	AnomalyScore float64 `json:"anomaly_score"`
+	Flagged      bool    `json:"flagged" gorm:"index"`
+
+	// Latitude, Longitude and Accuracy in metres locate the device the sale
+	// was sent from. GeofenceStatus tells whether it stood inside the outlet
+	// or the province of the sale, GeofenceDistance how many metres outside.
+	Latitude         *float64 `json:"latitude"`
+	Longitude        *float64 `json:"longitude"`
+	Accuracy         *float64 `json:"accuracy"`
+	GeofenceStatus   string   `json:"geofence_status" gorm:"type:varchar(10);index"`
+	GeofenceDistance float64  `json:"geofence_distance"`
+
 	// Relationships
 	Province *Province `json:"province" gorm:"foreignKey:ProvinceUUID;references:UUID"`
 	Product  *Product  `json:"product" gorm:"foreignKey:ProductUUID;references:UUID"`
@@ -25,4 +46,5 @@ type Sale struct {
 	Year     *Year     `json:"year" gorm:"foreignKey:YearUUID;references:UUID"`
 	Month    *Month    `json:"month" gorm:"foreignKey:MonthUUID;references:UUID"`
 	Week     *Week     `json:"week" gorm:"foreignKey:WeekUUID;references:UUID"`
+	Outlet   *Outlet   `json:"outlet,omitempty" gorm:"foreignKey:OutletUUID;references:UUID"`
 }
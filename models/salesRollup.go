@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// SalesDailyRollup is the quantity sold by a province for a product during
+// one time slot of a UTC day. It is kept in step with the sales table.
+type SalesDailyRollup struct {
+	Day          time.Time `json:"day" gorm:"primaryKey;type:date"`
+	ProvinceUUID string    `json:"province_uuid" gorm:"primaryKey;type:varchar(255)"`
+	ProductUUID  string    `json:"product_uuid" gorm:"primaryKey;type:varchar(255)"`
+	Slot         int       `json:"slot" gorm:"primaryKey;autoIncrement:false"`
+
+	Quantity int64 `json:"quantity" gorm:"not null;default:0"`
+	Entries  int64 `json:"entries" gorm:"not null;default:0"`
+}
+
+// SalesMonthlyRollup is the quantity sold by a province for a product during
+// one UTC calendar month. It is kept in step with the sales table.
+type SalesMonthlyRollup struct {
+	Year         int    `json:"year" gorm:"primaryKey;autoIncrement:false"`
+	Month        int    `json:"month" gorm:"primaryKey;autoIncrement:false"`
+	ProvinceUUID string `json:"province_uuid" gorm:"primaryKey;type:varchar(255)"`
+	ProductUUID  string `json:"product_uuid" gorm:"primaryKey;type:varchar(255)"`
+
+	Quantity int64 `json:"quantity" gorm:"not null;default:0"`
+	Entries  int64 `json:"entries" gorm:"not null;default:0"`
+}
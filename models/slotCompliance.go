@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// SlotCompliance records whether a province submitted its entry for a time
+// slot of a day. It is written when the slot closes and kept for reporting.
+type SlotCompliance struct {
+	UUID      string    `json:"uuid" gorm:"primaryKey;unique;not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+
+	Day          time.Time `json:"day" gorm:"type:date;not null;uniqueIndex:idx_slot_compliance_key"`
+	Slot         int       `json:"slot" gorm:"not null;uniqueIndex:idx_slot_compliance_key"`
+	TimeSlot     string    `json:"time_slot" gorm:"not null"`
+	ProvinceUUID string    `json:"province_uuid" gorm:"type:varchar(255);not null;uniqueIndex:idx_slot_compliance_key"`
+	Province     *Province `json:"province,omitempty" gorm:"foreignKey:ProvinceUUID;references:UUID"`
+
+	// Status is "on_time", "missing" or "late" (entered after the alert)
+	Status  string `json:"status" gorm:"type:varchar(20);not null;index"`
+	Entries int64  `json:"entries"`
+
+	AlertedAt   *time.Time `json:"alerted_at"`
+	EscalatedAt *time.Time `json:"escalated_at"`
+	ResolvedAt  *time.Time `json:"resolved_at"`
+}
+
+const (
+	ComplianceOnTime  = "on_time"
+	ComplianceMissing = "missing"
+	ComplianceLate    = "late"
+)
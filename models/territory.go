@@ -0,0 +1,79 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Territory levels, from the root of the tree down
+const (
+	TerritoryCountry  = "country"
+	TerritoryRegion   = "region"
+	TerritoryProvince = "province"
+	TerritoryDistrict = "district"
+	TerritoryOutlet   = "outlet"
+)
+
+// TerritoryLevels lists the levels in order, a node only having parents of
+// an earlier level
+var TerritoryLevels = []string{TerritoryCountry, TerritoryRegion, TerritoryProvince, TerritoryDistrict, TerritoryOutlet}
+
+// provinceRank is the index of provinces in TerritoryLevels. The levels
+// below always sit in a province.
+var provinceRank = slices.Index(TerritoryLevels, TerritoryProvince)
+
+// Territory is a node of the sales territory tree. Every country, province
+// and outlet has the node of the same UUID, kept in sync with it; regions
+// sit between countries and provinces, districts below provinces.
+type Territory struct {
+	UUID      string    `json:"uuid" gorm:"primaryKey;unique;not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// ParentUUID is nil for countries, the roots of the tree
+	ParentUUID *string `json:"parent_uuid" gorm:"type:varchar(255);index"`
+	Level      string  `json:"level" gorm:"type:varchar(20);not null;index"`
+	Name       string  `json:"name" gorm:"not null"`
+}
+
+// TerritoryPath is a row of the closure table of the tree: Descendant is
+// Depth levels below Ancestor. Every node is its own ancestor at depth 0.
+type TerritoryPath struct {
+	AncestorUUID   string `json:"ancestor_uuid" gorm:"type:varchar(255);primaryKey"`
+	DescendantUUID string `json:"descendant_uuid" gorm:"type:varchar(255);primaryKey;index"`
+	Depth          int    `json:"depth" gorm:"not null"`
+}
+
+// Mirrored reports whether the node mirrors a country, a province or an
+// outlet, which are managed through their own endpoints
+func (t *Territory) Mirrored() bool {
+	return t.Level == TerritoryCountry || t.Level == TerritoryProvince || t.Level == TerritoryOutlet
+}
+
+// Validate checks a node against its parent, nil for a root
+func (t *Territory) Validate(parent *Territory) error {
+	t.Name = strings.TrimSpace(t.Name)
+	if t.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	rank := slices.Index(TerritoryLevels, t.Level)
+	if rank < 0 {
+		return fmt.Errorf("level must be one of %s", strings.Join(TerritoryLevels, ", "))
+	}
+	if parent == nil {
+		if t.Level != TerritoryCountry {
+			return fmt.Errorf("a %s needs a parent", t.Level)
+		}
+		return nil
+	}
+	if t.Level == TerritoryCountry {
+		return fmt.Errorf("a country has no parent")
+	}
+	parentRank := slices.Index(TerritoryLevels, parent.Level)
+	if parentRank >= rank || rank > provinceRank && parentRank < provinceRank {
+		return fmt.Errorf("a %s cannot be placed under a %s", t.Level, parent.Level)
+	}
+	return nil
+}
@@ -3,7 +3,6 @@ package models
 import (
 	"time"
 
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
@@ -11,22 +10,26 @@ type User struct {
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 
-	UUID            string    `gorm:"primaryKey;not null;unique" json:"uuid"`
-	Sync            bool      `json:"sync" gorm:"default:false"`
-	Fullname        string    `json:"fullname"`
-	Email           string    `json:"email"`
-	Phone           string    `json:"phone"`
-	Title           string    `json:"title"`
-	Password        string    `json:"password"`
-	ConformPassword string    `json:"confirm_password"`
-	Role            string    `json:"role"`
-	Permission      string    `json:"permission"`
-	Image           string    `json:"profile_image"`
-	Status          bool      `json:"status"`
-	CountryUUID     *string   `json:"country_uuid" gorm:"type:varchar(255)"`
-	Country         *Country  `gorm:"foreignKey:CountryUUID;references:UUID"`
-	ProvinceUUID    *string   `json:"province_uuid" gorm:"type:varchar(255)"`
-	Province        *Province `gorm:"foreignKey:ProvinceUUID;references:UUID"`
+	UUID         string    `gorm:"primaryKey;not null;unique" json:"uuid"`
+	Sync         bool      `json:"sync" gorm:"default:false"`
+	Fullname     string    `json:"fullname"`
+	Email        string    `json:"email"`
+	Phone        string    `json:"phone"`
+	Title        string    `json:"title"`
+	Role         string    `json:"role"`
+	Permission   string    `json:"permission"`
+	Image        string    `json:"profile_image"`
+	Status       bool      `json:"status"`
+	CountryUUID  *string   `json:"country_uuid" gorm:"type:varchar(255)"`
+	Country      *Country  `gorm:"foreignKey:CountryUUID;references:UUID"`
+	ProvinceUUID *string   `json:"province_uuid" gorm:"type:varchar(255)"`
+	Province     *Province `gorm:"foreignKey:ProvinceUUID;references:UUID"`
+	// TerritoryUUID attaches the user to a node of the territory tree, whose
+	// provinces the dashboards of an ASM cover instead of their province
+	TerritoryUUID *string `json:"territory_uuid" gorm:"type:varchar(255)"`
+	// ManagerUUID is the user this user reports to, nil at the top of the
+	// hierarchy
+	ManagerUUID *string `json:"manager_uuid" gorm:"type:varchar(255);index"`
 
 	Signature string `json:"signature"`
 
@@ -34,6 +37,8 @@ type User struct {
 	// Deli []Deli `gorm:"foreignKey:UserUUID;references:UUID"`
 }
 
+// UserResponse is the form in which the API serves a user, with its country
+// and province in full
 type UserResponse struct {
 	UUID       string    `json:"uuid"`
 	Fullname   string    `json:"fullname"`
@@ -48,6 +53,14 @@ type UserResponse struct {
 	Signature  string    `json:"signature"`
 	CreatedAt  time.Time `json:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at"`
+
+	// The references and picture of the user, so clients editing a user
+	// find every field they may send back
+	Image         string  `json:"profile_image"`
+	CountryUUID   *string `json:"country_uuid"`
+	ProvinceUUID  *string `json:"province_uuid"`
+	TerritoryUUID *string `json:"territory_uuid"`
+	ManagerUUID   *string `json:"manager_uuid"`
 }
 
 // Helper to convert User to UserResponse with full related objects
@@ -61,22 +74,38 @@ func (u *User) ToUserResponse() UserResponse {
 		province = *u.Province
 	}
 	return UserResponse{
-		UUID:       u.UUID,
-		Fullname:   u.Fullname,
-		Email:      u.Email,
-		Phone:      u.Phone,
-		Title:      u.Title,
-		Role:       u.Role,
-		Country:    country,
-		Province:   province,
-		Permission: u.Permission,
-		Status:     u.Status,
-		Signature:  u.Signature,
-		CreatedAt:  u.CreatedAt,
-		UpdatedAt:  u.UpdatedAt,
+		UUID:          u.UUID,
+		Fullname:      u.Fullname,
+		Email:         u.Email,
+		Phone:         u.Phone,
+		Title:         u.Title,
+		Role:          u.Role,
+		Country:       country,
+		Province:      province,
+		Permission:    u.Permission,
+		Status:        u.Status,
+		Signature:     u.Signature,
+		CreatedAt:     u.CreatedAt,
+		UpdatedAt:     u.UpdatedAt,
+		Image:         u.Image,
+		CountryUUID:   u.CountryUUID,
+		ProvinceUUID:  u.ProvinceUUID,
+		TerritoryUUID: u.TerritoryUUID,
+		ManagerUUID:   u.ManagerUUID,
 	}
 }
 
+// ToUserResponses converts every user of users to a UserResponse
+func ToUserResponses(users []User) []UserResponse {
+	responses := make([]UserResponse, 0, len(users))
+	for i := range users {
+		responses = append(responses, users[i].ToUserResponse())
+	}
+	return responses
+}
+
+// UserPaginate is the row of a user in the paginated lists, naming its
+// country and province
 type UserPaginate struct {
 	UUID       string    `json:"uuid"`
 	Fullname   string    `json:"fullname"`
@@ -91,6 +120,52 @@ type UserPaginate struct {
 	Signature  string    `json:"signature"`
 	CreatedAt  time.Time `json:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at"`
+
+	// The references and picture of the user
+	Country       string  `json:"country"`
+	Image         string  `json:"profile_image"`
+	CountryUUID   *string `json:"country_uuid"`
+	ProvinceUUID  *string `json:"province_uuid"`
+	TerritoryUUID *string `json:"territory_uuid"`
+	ManagerUUID   *string `json:"manager_uuid"`
+}
+
+// ToUserPaginate converts User to the row of the paginated lists
+func (u *User) ToUserPaginate() UserPaginate {
+	row := UserPaginate{
+		UUID:          u.UUID,
+		Fullname:      u.Fullname,
+		Email:         u.Email,
+		Phone:         u.Phone,
+		Title:         u.Title,
+		Role:          u.Role,
+		Permission:    u.Permission,
+		Status:        u.Status,
+		Signature:     u.Signature,
+		CreatedAt:     u.CreatedAt,
+		UpdatedAt:     u.UpdatedAt,
+		Image:         u.Image,
+		CountryUUID:   u.CountryUUID,
+		ProvinceUUID:  u.ProvinceUUID,
+		TerritoryUUID: u.TerritoryUUID,
+		ManagerUUID:   u.ManagerUUID,
+	}
+	if u.Country != nil {
+		row.Country = u.Country.Name
+	}
+	if u.Province != nil {
+		row.Province = u.Province.Name
+	}
+	return row
+}
+
+// ToUserPaginates converts every user of users to a UserPaginate
+func ToUserPaginates(users []User) []UserPaginate {
+	rows := make([]UserPaginate, 0, len(users))
+	for i := range users {
+		rows = append(rows, users[i].ToUserPaginate())
+	}
+	return rows
 }
 
 // ...existing code...
@@ -101,16 +176,6 @@ type Login struct {
 	Password string `json:"password" validate:"required"`
 }
 
-func (u *User) SetPassword(p string) {
-	hp, _ := bcrypt.GenerateFromPassword([]byte(p), 14)
-	u.Password = string(hp)
-}
-
-func (u *User) ComparePassword(p string) error {
-	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(p))
-	return err
-}
-
 func (u *User) Count(db *gorm.DB) int64 {
 	var total int64
 	db.Model(&User{}).Count(&total)
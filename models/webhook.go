@@ -0,0 +1,211 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Webhook event types
+const (
+	EventSaleCreated   = "sale.created"
+	EventSaleUpdated   = "sale.updated"
+	EventSaleDeleted   = "sale.deleted"
+	EventTargetUpdated = "target.updated"
+	EventSlotMissed    = "slot.missed"
+	EventUserCreated   = "user.created"
+)
+
+// WebhookEventTypes lists the event types a subscription may ask for
+var WebhookEventTypes = []string{
+	EventSaleCreated,
+	EventSaleUpdated,
+	EventSaleDeleted,
+	EventTargetUpdated,
+	EventSlotMissed,
+	EventUserCreated,
+}
+
+// WebhookSubscription is an external endpoint the events of its types are posted to
+type WebhookSubscription struct {
+	UUID      string    `json:"uuid" gorm:"primaryKey;unique;not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Name string `json:"name" gorm:"not null"`
+	URL  string `json:"url" gorm:"not null"`
+	// Secret signs every delivery, it is only shown when the subscription is created
+	Secret string `json:"-" gorm:"not null"`
+	// EventTypes is the comma separated list of the event types delivered
+	EventTypes string `json:"event_types" gorm:"not null"`
+	Active     bool   `json:"active"`
+}
+
+// Types returns the event types of the subscription
+func (s *WebhookSubscription) Types() []string {
+	var types []string
+	for _, t := range strings.Split(s.EventTypes, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// Wants reports whether events of eventType are delivered to the subscription
+func (s *WebhookSubscription) Wants(eventType string) bool {
+	for _, t := range s.Types() {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate reports the first setting that prevents deliveries
+func (s *WebhookSubscription) Validate() error {
+	if s.Name == "" {
+		return errors.New("name is required")
+	}
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	types := s.Types()
+	if len(types) == 0 {
+		return errors.New("event_types must list at least one event type")
+	}
+	for _, t := range types {
+		known := false
+		for _, eventType := range WebhookEventTypes {
+			known = known || t == eventType
+		}
+		if !known {
+			return fmt.Errorf("unknown event type %q", t)
+		}
+	}
+	return nil
+}
+
+// OutboxEvent is a change written in the same transaction as the change
+// itself, kept until the webhook dispatcher turns it into deliveries
+type OutboxEvent struct {
+	ID        uint64          `json:"id" gorm:"primaryKey;autoIncrement"`
+	UUID      string          `json:"uuid" gorm:"type:varchar(255);uniqueIndex;not null"`
+	CreatedAt time.Time       `json:"created_at"`
+	Type      string          `json:"type" gorm:"type:varchar(50);not null"`
+	Payload   json.RawMessage `json:"payload" gorm:"type:jsonb;not null"`
+	// DispatchedAt is set once the deliveries of the event are queued
+	DispatchedAt *time.Time `json:"dispatched_at" gorm:"index"`
+}
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is an event posted to a subscription, with the outcome of
+// its latest attempt. Together they make the delivery log.
+type WebhookDelivery struct {
+	UUID      string    `json:"uuid" gorm:"primaryKey;unique;not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	SubscriptionUUID string `json:"subscription_uuid" gorm:"type:varchar(255);not null;index"`
+	EventUUID        string `json:"event_uuid" gorm:"type:varchar(255);not null;index"`
+	EventType        string `json:"event_type" gorm:"type:varchar(50);not null"`
+	// Payload is the exact body posted, replays send it again
+	Payload json.RawMessage `json:"payload" gorm:"type:jsonb;not null"`
+
+	// Status is "pending" until the endpoint accepts the delivery or the attempts run out
+	Status        string    `json:"status" gorm:"type:varchar(20);not null;index:idx_webhook_deliveries_due,priority:1"`
+	Attempts      int       `json:"attempts"`
+	NextAttemptAt time.Time `json:"next_attempt_at" gorm:"index:idx_webhook_deliveries_due,priority:2"`
+	// ResponseStatus is the HTTP status of the latest attempt, 0 when no answer came
+	ResponseStatus int        `json:"response_status"`
+	LastError      string     `json:"last_error"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+	// ReplayOf is the delivery this one replays
+	ReplayOf *string `json:"replay_of" gorm:"type:varchar(255)"`
+}
+
+// SaleEvent is the payload of the sale events
+type SaleEvent struct {
+	UUID         string    `json:"uuid"`
+	ProvinceUUID string    `json:"province_uuid"`
+	ProductUUID  string    `json:"product_uuid"`
+	UserUUID     string    `json:"user_uuid"`
+	YearUUID     string    `json:"year_uuid"`
+	MonthUUID    string    `json:"month_uuid"`
+	WeekUUID     string    `json:"week_uuid"`
+	Quantity     int64     `json:"quantity"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// NewSaleEvent returns the payload describing sale
+func NewSaleEvent(sale *Sale) SaleEvent {
+	return SaleEvent{
+		UUID:         sale.UUID,
+		ProvinceUUID: sale.ProvinceUUID,
+		ProductUUID:  sale.ProductUUID,
+		UserUUID:     sale.UserUUID,
+		YearUUID:     sale.YearUUID,
+		MonthUUID:    sale.MonthUUID,
+		WeekUUID:     sale.WeekUUID,
+		Quantity:     sale.Quantity,
+		CreatedAt:    sale.CreatedAt,
+		UpdatedAt:    sale.UpdatedAt,
+	}
+}
+
+// TargetEvent is the payload of target.updated
+type TargetEvent struct {
+	// Level is "year", "month" or "week"
+	Level string `json:"level"`
+	// Action is "created", "updated" or "deleted"
+	Action string `json:"action"`
+	UUID   string `json:"uuid"`
+	// Label is the year, month name or week number of the target
+	Label        string `json:"label"`
+	Quantity     string `json:"quantity"`
+	CountryUUID  string `json:"country_uuid,omitempty"`
+	ProvinceUUID string `json:"province_uuid,omitempty"`
+	ProductUUID  string `json:"product_uuid,omitempty"`
+	YearUUID     string `json:"year_uuid,omitempty"`
+}
+
+// UserEvent is the payload of user.created, it never carries credentials
+type UserEvent struct {
+	UUID         string    `json:"uuid"`
+	Fullname     string    `json:"fullname"`
+	Email        string    `json:"email"`
+	Phone        string    `json:"phone"`
+	Title        string    `json:"title"`
+	Role         string    `json:"role"`
+	Status       bool      `json:"status"`
+	CountryUUID  *string   `json:"country_uuid"`
+	ProvinceUUID *string   `json:"province_uuid"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// NewUserEvent returns the payload describing user
+func NewUserEvent(user *User) UserEvent {
+	return UserEvent{
+		UUID:         user.UUID,
+		Fullname:     user.Fullname,
+		Email:        user.Email,
+		Phone:        user.Phone,
+		Title:        user.Title,
+		Role:         user.Role,
+		Status:       user.Status,
+		CountryUUID:  user.CountryUUID,
+		ProvinceUUID: user.ProvinceUUID,
+		CreatedAt:    user.CreatedAt,
+	}
+}
@@ -20,5 +20,9 @@ type Week struct {
 	MonthUUID    string   `json:"month_uuid" gorm:"type:varchar(255)"`
 	YearUUID     string   `json:"year_uuid" gorm:"type:varchar(255)"`
 
+	// TerritoryUUID attaches the target to a node of the territory tree
+	// other than a province
+	TerritoryUUID *string `json:"territory_uuid" gorm:"type:varchar(255)"`
+
 	Signature string `json:"signature"`
 }
@@ -0,0 +1,147 @@
+package report
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny record an unrestricted day field: when both day fields
+	// are restricted a day matching either one is due, as in cron
+	domAny, dowAny bool
+}
+
+// cronField is the range of a cron field
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// cronDescriptors are the shorthands accepted in place of five fields
+var cronDescriptors = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// ParseSchedule parses a cron expression of five fields (minute, hour, day
+// of month, month, day of week, Sunday is 0 or 7) or a descriptor such as
+// @daily. Fields accept *, numbers, ranges, lists and steps like */15.
+func ParseSchedule(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if descriptor, ok := cronDescriptors[expr]; ok {
+		expr = descriptor
+	}
+	parts := strings.Fields(expr)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields", expr)
+	}
+
+	var bits [5]uint64
+	for i, part := range parts {
+		var err error
+		if bits[i], err = parseCronField(part, cronFields[i]); err != nil {
+			return nil, err
+		}
+	}
+	// Sunday is both 0 and 7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+
+	return &Schedule{
+		minute: bits[0], hour: bits[1], dom: bits[2], month: bits[3], dow: bits[4],
+		domAny: parts[2] == "*", dowAny: parts[4] == "*",
+	}, nil
+}
+
+func parseCronField(part string, field cronField) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(part, ",") {
+		rng, stepText, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepText); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q in %s field", stepText, field.name)
+			}
+		}
+
+		low, high := field.min, field.max
+		if rng != "*" {
+			lowText, highText, isRange := strings.Cut(rng, "-")
+			var err error
+			if low, err = strconv.Atoi(lowText); err != nil {
+				return 0, fmt.Errorf("invalid value %q in %s field", lowText, field.name)
+			}
+			high = low
+			if isRange {
+				if high, err = strconv.Atoi(highText); err != nil {
+					return 0, fmt.Errorf("invalid value %q in %s field", highText, field.name)
+				}
+			} else if hasStep {
+				high = field.max
+			}
+		}
+		if low < field.min || high > field.max || low > high {
+			return 0, fmt.Errorf("%s field %q is out of range %d-%d", field.name, item, field.min, field.max)
+		}
+
+		for v := low; v <= high; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// dayMatches reports whether the day of t is due
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first due minute strictly after after, in its location.
+// It returns the zero time when nothing is due within five years, e.g. on
+// February 30th.
+func (s *Schedule) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
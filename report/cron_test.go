@@ -0,0 +1,79 @@
+package report
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// Wednesday 2024-03-06 10:30
+	from := time.Date(2024, 3, 6, 10, 30, 0, 0, time.UTC)
+
+	cases := []struct {
+		expr string
+		want time.Time
+	}{
+		{"*/15 * * * *", time.Date(2024, 3, 6, 10, 45, 0, 0, time.UTC)},
+		{"0 7 * * 1", time.Date(2024, 3, 11, 7, 0, 0, 0, time.UTC)},
+		{"5 22 * * *", time.Date(2024, 3, 6, 22, 5, 0, 0, time.UTC)},
+		{"30 10 * * *", time.Date(2024, 3, 7, 10, 30, 0, 0, time.UTC)},
+		{"0 8 1 * *", time.Date(2024, 4, 1, 8, 0, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2024, 3, 7, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 7", time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: the 15th or any Friday
+		{"0 6 15 * 5", time.Date(2024, 3, 8, 6, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 3, 7, 0, 0, 0, 0, time.UTC)},
+		{"0 12 30 2 *", time.Time{}},
+	}
+	for _, c := range cases {
+		schedule, err := ParseSchedule(c.expr)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q): %v", c.expr, err)
+			continue
+		}
+		if got := schedule.Next(from); !got.Equal(c.want) {
+			t.Errorf("%q: Next = %s, want %s", c.expr, got, c.want)
+		}
+	}
+}
+
+func TestParseScheduleRejectsInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := ParseSchedule(expr); err == nil {
+			t.Errorf("ParseSchedule(%q) should fail", expr)
+		}
+	}
+}
+
+func TestPeriodRange(t *testing.T) {
+	// Wednesday 2024-03-06 20:15
+	now := time.Date(2024, 3, 6, 20, 15, 0, 0, time.UTC)
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC) }
+	endOf := func(t time.Time) time.Time { return t.Add(-time.Nanosecond) }
+
+	cases := []struct {
+		period   string
+		from, to time.Time
+	}{
+		{PeriodToday, day(6), now},
+		{PeriodYesterday, day(5), endOf(day(6))},
+		{PeriodLast7Days, time.Date(2024, 2, 28, 0, 0, 0, 0, time.UTC), endOf(day(6))},
+		{PeriodWeekToDate, day(4), now},
+		{PeriodPreviousWeek, time.Date(2024, 2, 26, 0, 0, 0, 0, time.UTC), endOf(day(4))},
+		{PeriodMonthToDate, day(1), now},
+		{PeriodPreviousMonth, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), endOf(day(1))},
+	}
+	for _, c := range cases {
+		from, to, err := PeriodRange(c.period, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !from.Equal(c.from) || !to.Equal(c.to) {
+			t.Errorf("%s: got %s - %s, want %s - %s", c.period, from, to, c.from, c.to)
+		}
+	}
+	if _, _, err := PeriodRange("fortnight", now); err == nil {
+		t.Error("an unknown period should fail")
+	}
+}
@@ -0,0 +1,70 @@
+// Package report lays dashboard data out as documents and renders them as PDF
+// or XLSX files, streams tables as CSV, XLSX or JSON Lines exports, and
+// computes the schedules and periods of the report subscriptions.
+package report
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Output formats
+const (
+	FormatPDF  = "pdf"
+	FormatXLSX = "xlsx"
+)
+
+// Document is a report made of titled tables
+type Document struct {
+	Title string
+	// Subtitle usually states the period covered
+	Subtitle string
+	Sections []Section
+}
+
+// Section is a titled table. Cells hold strings or numbers (int, int64 and
+// float64), numbers stay numeric in spreadsheets.
+type Section struct {
+	Title   string
+	Columns []string
+	Rows    [][]interface{}
+}
+
+// Render renders doc in format and returns the file with its content type
+func Render(doc *Document, format string) ([]byte, string, error) {
+	switch format {
+	case FormatPDF:
+		data, err := PDF(doc)
+		return data, ContentType(format), err
+	case FormatXLSX:
+		data, err := XLSX(doc)
+		return data, ContentType(format), err
+	}
+	return nil, "", fmt.Errorf("unknown report format %q", format)
+}
+
+// formatCell returns the text of a cell, floats keep one decimal
+func formatCell(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', 1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// isNumber reports whether a cell holds a number
+func isNumber(v interface{}) bool {
+	switch v.(type) {
+	case int, int64, float64:
+		return true
+	}
+	return false
+}
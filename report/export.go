@@ -0,0 +1,165 @@
+package report
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Export formats besides FormatXLSX
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// ExportFormats lists the formats a table is exported in
+var ExportFormats = []string{FormatCSV, FormatXLSX, FormatJSONL}
+
+// ContentType returns the media type of the files in format
+func ContentType(format string) string {
+	switch format {
+	case FormatPDF:
+		return "application/pdf"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatJSONL:
+		return "application/x-ndjson"
+	}
+	return "application/octet-stream"
+}
+
+// TableWriter streams the rows of a table into a file, the file is complete
+// once Close returns
+type TableWriter interface {
+	WriteRow(cells []interface{}) error
+	Close() error
+}
+
+// NewTableWriter starts a table of columns in format on w. Rows are written
+// as they come so exports of any size run in constant memory. name is the
+// sheet name of XLSX files.
+func NewTableWriter(w io.Writer, format, name string, columns []string) (TableWriter, error) {
+	switch format {
+	case FormatCSV:
+		t := &csvTable{w: csv.NewWriter(w)}
+		if err := t.w.Write(columns); err != nil {
+			return nil, err
+		}
+		return t, nil
+	case FormatJSONL:
+		return &jsonlTable{w: w, columns: columns}, nil
+	case FormatXLSX:
+		return newXLSXTable(w, name, columns)
+	}
+	return nil, fmt.Errorf("format must be one of %s", strings.Join(ExportFormats, ", "))
+}
+
+type csvTable struct {
+	w *csv.Writer
+}
+
+func (t *csvTable) WriteRow(cells []interface{}) error {
+	record := make([]string, len(cells))
+	for i, cell := range cells {
+		record[i] = exportText(cell)
+		if !isNumber(cell) && record[i] != "" && strings.ContainsRune("=+-@", rune(record[i][0])) {
+			// Spreadsheets would run the text as a formula
+			record[i] = "'" + record[i]
+		}
+	}
+	return t.w.Write(record)
+}
+
+func (t *csvTable) Close() error {
+	t.w.Flush()
+	return t.w.Error()
+}
+
+// jsonlTable writes every row as a JSON object keyed by the column names, in
+// the column order
+type jsonlTable struct {
+	w       io.Writer
+	columns []string
+}
+
+func (t *jsonlTable) WriteRow(cells []interface{}) error {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, column := range t.columns {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(column)
+		var cell interface{}
+		if i < len(cells) {
+			cell = cells[i]
+		}
+		value, err := json.Marshal(cell)
+		if err != nil {
+			return err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteString("}\n")
+	_, err := t.w.Write(b.Bytes())
+	return err
+}
+
+func (t *jsonlTable) Close() error {
+	return nil
+}
+
+// xlsxTable writes a workbook of one sheet, the sheet is the last part of the
+// archive so its rows go straight to the output
+type xlsxTable struct {
+	zw    *zip.Writer
+	sheet *sheetWriter
+}
+
+func newXLSXTable(w io.Writer, name string, columns []string) (*xlsxTable, error) {
+	zw := zip.NewWriter(w)
+	if err := writeWorkbook(zw, sheetNames([]Section{{Title: name}})); err != nil {
+		return nil, err
+	}
+	part, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(part, worksheetStart); err != nil {
+		return nil, err
+	}
+
+	t := &xlsxTable{zw: zw, sheet: &sheetWriter{w: part}}
+	if err := t.sheet.header(columns); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *xlsxTable) WriteRow(cells []interface{}) error {
+	return t.sheet.write(cells, 0)
+}
+
+func (t *xlsxTable) Close() error {
+	if _, err := io.WriteString(t.sheet.w, worksheetEnd); err != nil {
+		return err
+	}
+	return t.zw.Close()
+}
+
+// exportText returns the text of a cell in a CSV file, floats keep their
+// full precision
+func exportText(v interface{}) string {
+	if f, ok := v.(float64); ok {
+		return numberText(f)
+	}
+	return formatCell(v)
+}
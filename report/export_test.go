@@ -0,0 +1,80 @@
+package report
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+func exportTable(t *testing.T, format string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewTableWriter(&buf, format, "Sales", []string{"province", "quantity", "share"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range [][]interface{}{{"Kinshasa, \"Nord\"", int64(12), 0.125}, {"=SUM(A1)", int64(-3), nil}} {
+		if err := w.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCSVExport(t *testing.T) {
+	got := string(exportTable(t, FormatCSV))
+	want := "province,quantity,share\n\"Kinshasa, \"\"Nord\"\"\",12,0.125\n'=SUM(A1),-3,\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestJSONLExport(t *testing.T) {
+	got := string(exportTable(t, FormatJSONL))
+	want := `{"province":"Kinshasa, \"Nord\"","quantity":12,"share":0.125}` + "\n" +
+		`{"province":"=SUM(A1)","quantity":-3,"share":null}` + "\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestXLSXExport(t *testing.T) {
+	data := exportTable(t, FormatXLSX)
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("not a zip archive: %v", err)
+	}
+
+	var sheet string
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(rc)
+		rc.Close()
+		if err := xml.Unmarshal(body, new(interface{})); err != nil {
+			t.Errorf("%s is not well-formed: %v", f.Name, err)
+		}
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			sheet = string(body)
+		}
+	}
+	for _, want := range []string{`<c r="A1" s="1" t="inlineStr">`, `<c r="B2" s="0"><v>12</v></c>`, `<c r="C2" s="2"><v>0.125</v></c>`, `<c r="B3" s="0"><v>-3</v></c>`} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("sheet lacks %s:\n%s", want, sheet)
+		}
+	}
+}
+
+func TestUnknownExportFormat(t *testing.T) {
+	if _, err := NewTableWriter(io.Discard, "pdf", "Sales", nil); err == nil {
+		t.Error("exporting a table as pdf succeeded")
+	}
+}
@@ -0,0 +1,268 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A4 portrait in points, with the margins of every page
+const (
+	pageWidth    = 595.0
+	pageHeight   = 842.0
+	pageMargin   = 40.0
+	contentWidth = pageWidth - 2*pageMargin
+)
+
+// Font sizes and line heights of the PDF layout
+const (
+	titleSize   = 16.0
+	sectionSize = 12.0
+	cellSize    = 9.0
+	rowHeight   = 14.0
+	cellPadding = 4.0
+)
+
+// textWidth estimates the width of s in Helvetica at size, from the average
+// glyph widths of digits, capitals, lowercase letters and spaces
+func textWidth(s string, size float64) float64 {
+	var units float64
+	for _, r := range s {
+		switch {
+		case r == ' ' || r == '.' || r == ',' || r == 'i' || r == 'l' || r == 'I':
+			units += 278
+		case r >= '0' && r <= '9':
+			units += 556
+		case r >= 'A' && r <= 'Z':
+			units += 667
+		case r == 'm' || r == 'w' || r == 'M' || r == 'W':
+			units += 833
+		default:
+			units += 500
+		}
+	}
+	return units * size / 1000
+}
+
+// fitText shortens s with an ellipsis until it fits width at size
+func fitText(s string, width, size float64) string {
+	if textWidth(s, size) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && textWidth(string(runes)+"...", size) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
+
+// pdfString escapes s as a PDF literal string in WinAnsi encoding, the
+// characters outside Latin-1 become question marks
+func pdfString(s string) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 32 && r < 127:
+			b.WriteRune(r)
+		case r >= 160 && r < 256:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// pdfLayout writes the content streams of the pages of a document
+type pdfLayout struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+func (l *pdfLayout) page() *bytes.Buffer {
+	return l.pages[len(l.pages)-1]
+}
+
+func (l *pdfLayout) newPage() {
+	l.pages = append(l.pages, &bytes.Buffer{})
+	l.y = pageHeight - pageMargin
+}
+
+// reserve starts a new page unless height fits above the bottom margin
+func (l *pdfLayout) reserve(height float64) {
+	if len(l.pages) == 0 || l.y-height < pageMargin {
+		l.newPage()
+	}
+}
+
+// text writes s with its baseline at x and the current line, in the bold font when bold
+func (l *pdfLayout) text(x float64, s string, size float64, bold bool) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(l.page(), "BT /%s %.1f Tf %.2f %.2f Td %s Tj ET\n", font, size, x, l.y, pdfString(s))
+}
+
+// rule draws a horizontal line across the content width at the current line
+func (l *pdfLayout) rule(offset float64) {
+	fmt.Fprintf(l.page(), "0.6 G %.2f %.2f m %.2f %.2f l S 0 G\n", pageMargin, l.y+offset, pageMargin+contentWidth, l.y+offset)
+}
+
+// columnWidths shares the content width between the columns in proportion
+// to their widest cell
+func columnWidths(section Section) []float64 {
+	count := len(section.Columns)
+	for _, row := range section.Rows {
+		if len(row) > count {
+			count = len(row)
+		}
+	}
+	if count == 0 {
+		return nil
+	}
+
+	widths := make([]float64, count)
+	measure := func(i int, s string, bold bool) {
+		w := textWidth(s, cellSize) + 2*cellPadding
+		if bold {
+			w *= 1.1
+		}
+		if w > widths[i] {
+			widths[i] = w
+		}
+	}
+	for i, column := range section.Columns {
+		measure(i, column, true)
+	}
+	for _, row := range section.Rows {
+		for i, cell := range row {
+			measure(i, formatCell(cell), false)
+		}
+	}
+
+	var total float64
+	for _, w := range widths {
+		total += w
+	}
+	for i := range widths {
+		widths[i] = widths[i] / total * contentWidth
+	}
+	return widths
+}
+
+// row writes one table row, numbers aligned right
+func (l *pdfLayout) row(cells []interface{}, widths []float64, bold bool) {
+	x := pageMargin
+	for i, width := range widths {
+		var cell interface{}
+		if i < len(cells) {
+			cell = cells[i]
+		}
+		s := fitText(formatCell(cell), width-2*cellPadding, cellSize)
+		if isNumber(cell) {
+			l.text(x+width-cellPadding-textWidth(s, cellSize), s, cellSize, bold)
+		} else if s != "" {
+			l.text(x+cellPadding, s, cellSize, bold)
+		}
+		x += width
+	}
+}
+
+// PDF renders doc as an A4 document, the table headers repeat on every page
+// a table spans
+func PDF(doc *Document) ([]byte, error) {
+	l := &pdfLayout{}
+	l.newPage()
+
+	l.y -= titleSize
+	l.text(pageMargin, doc.Title, titleSize, true)
+	if doc.Subtitle != "" {
+		l.y -= rowHeight + 2
+		l.text(pageMargin, doc.Subtitle, cellSize+1, false)
+	}
+	l.y -= rowHeight
+
+	for _, section := range doc.Sections {
+		widths := columnWidths(section)
+		header := make([]interface{}, len(section.Columns))
+		for i, column := range section.Columns {
+			header[i] = column
+		}
+		writeHeader := func() {
+			if len(header) == 0 {
+				return
+			}
+			l.y -= rowHeight
+			l.row(header, widths, true)
+			l.rule(-4)
+		}
+
+		// Keep the section title with its header and first row
+		l.reserve(sectionSize + 4*rowHeight)
+		l.y -= sectionSize + rowHeight/2
+		l.text(pageMargin, section.Title, sectionSize, true)
+		writeHeader()
+
+		for _, cells := range section.Rows {
+			if l.y-rowHeight < pageMargin {
+				l.newPage()
+				writeHeader()
+			}
+			l.y -= rowHeight
+			l.row(cells, widths, false)
+		}
+		if len(section.Rows) == 0 {
+			l.y -= rowHeight
+			l.text(pageMargin+cellPadding, "No data for this period", cellSize, false)
+		}
+		l.y -= rowHeight / 2
+	}
+
+	return l.bytes(doc.Title), nil
+}
+
+// bytes assembles the pages into a PDF file
+func (l *pdfLayout) bytes(title string) []byte {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1 to 5 are the catalog, the page tree, the two fonts and the
+	// document information, then every page is followed by its content stream
+	const firstPage = 6
+	kids := make([]string, len(l.pages))
+	for i := range l.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(l.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	object(fmt.Sprintf("<< /Title %s /Producer (sr-api) /CreationDate (D:%s) >>", pdfString(title), time.Now().UTC().Format("20060102150405Z")))
+
+	for i, content := range l.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, firstPage+2*i+1))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
@@ -0,0 +1,60 @@
+package report
+
+import (
+	"fmt"
+	"time"
+)
+
+// Periods a report may cover, relative to the time it runs
+const (
+	PeriodToday         = "today"
+	PeriodYesterday     = "yesterday"
+	PeriodLast7Days     = "last_7_days"
+	PeriodLast30Days    = "last_30_days"
+	PeriodWeekToDate    = "week_to_date"
+	PeriodPreviousWeek  = "previous_week"
+	PeriodMonthToDate   = "month_to_date"
+	PeriodPreviousMonth = "previous_month"
+)
+
+// Periods lists the periods a report may cover
+var Periods = []string{
+	PeriodToday,
+	PeriodYesterday,
+	PeriodLast7Days,
+	PeriodLast30Days,
+	PeriodWeekToDate,
+	PeriodPreviousWeek,
+	PeriodMonthToDate,
+	PeriodPreviousMonth,
+}
+
+// PeriodRange returns the first and last instants of period for a report
+// running at now. Periods ending "to date" end at now, the others at the end
+// of their last day. Weeks start on Monday.
+func PeriodRange(period string, now time.Time) (time.Time, time.Time, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	monday := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+	firstOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	endOf := func(next time.Time) time.Time { return next.Add(-time.Nanosecond) }
+
+	switch period {
+	case PeriodToday:
+		return today, now, nil
+	case PeriodYesterday:
+		return today.AddDate(0, 0, -1), endOf(today), nil
+	case PeriodLast7Days:
+		return today.AddDate(0, 0, -7), endOf(today), nil
+	case PeriodLast30Days:
+		return today.AddDate(0, 0, -30), endOf(today), nil
+	case PeriodWeekToDate:
+		return monday, now, nil
+	case PeriodPreviousWeek:
+		return monday.AddDate(0, 0, -7), endOf(monday), nil
+	case PeriodMonthToDate:
+		return firstOfMonth, now, nil
+	case PeriodPreviousMonth:
+		return firstOfMonth.AddDate(0, -1, 0), endOf(firstOfMonth), nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("unknown report period %q", period)
+}
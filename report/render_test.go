@@ -0,0 +1,99 @@
+package report
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func sampleDocument(rows int) *Document {
+	section := Section{Title: "Provincial sales", Columns: []string{"Province", "Sales", "Achievement %"}}
+	for i := 0; i < rows; i++ {
+		section.Rows = append(section.Rows, []interface{}{"Kinshasa & <Nord>", int64(1200 + i), 85.25})
+	}
+	return &Document{
+		Title:    "Global overview",
+		Subtitle: "2024-03-01 to 2024-03-07",
+		Sections: []Section{{Title: "Summary", Columns: []string{"Metric", "Value"}, Rows: [][]interface{}{{"Total sales", int64(42)}}}, section},
+	}
+}
+
+func TestXLSX(t *testing.T) {
+	data, err := XLSX(sampleDocument(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("not a zip archive: %v", err)
+	}
+
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(body)
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml", "xl/worksheets/sheet2.xml"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("missing part %s", name)
+		}
+	}
+	if !strings.Contains(files["xl/workbook.xml"], `<sheet name="Provincial sales" sheetId="2" r:id="rId2"/>`) {
+		t.Errorf("unexpected workbook %s", files["xl/workbook.xml"])
+	}
+	sheet := files["xl/worksheets/sheet2.xml"]
+	for _, want := range []string{"Kinshasa &amp; &lt;Nord&gt;", `<c r="B6" s="0"><v>1200</v></c>`, `<c r="C6" s="2"><v>85.25</v></c>`} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("sheet lacks %s:\n%s", want, sheet)
+		}
+	}
+}
+
+func TestPDF(t *testing.T) {
+	data, err := PDF(sampleDocument(150))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF-1.4")) || !bytes.HasSuffix(data, []byte("%%EOF\n")) {
+		t.Fatal("missing PDF header or trailer")
+	}
+
+	// The rows overflow onto further pages
+	count := regexp.MustCompile(`/Count (\d+)`).FindSubmatch(data)
+	if pages, _ := strconv.Atoi(string(count[1])); pages < 2 {
+		t.Errorf("got %d pages, want at least 2", pages)
+	}
+
+	// Every xref entry points at its object
+	startxref := regexp.MustCompile(`startxref\n(\d+)`).FindSubmatch(data)
+	offset, _ := strconv.Atoi(string(startxref[1]))
+	if !bytes.HasPrefix(data[offset:], []byte("xref")) {
+		t.Fatal("startxref does not point at the xref table")
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(data[offset:], -1)
+	for i, entry := range entries {
+		at, _ := strconv.Atoi(string(entry[1]))
+		if want := strconv.Itoa(i+1) + " 0 obj"; !bytes.HasPrefix(data[at:], []byte(want)) {
+			t.Errorf("xref entry %d points at %q", i+1, data[at:at+10])
+		}
+	}
+	if !bytes.Contains(data, []byte(`(Kinshasa & <Nord>) Tj`)) {
+		t.Error("cell text is missing")
+	}
+}
+
+func TestPDFString(t *testing.T) {
+	if got := pdfString(`a(b)\ é €`); got != `(a\(b\)\\ \351 ?)` {
+		t.Errorf("pdfString = %s", got)
+	}
+}
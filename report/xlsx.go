@@ -0,0 +1,241 @@
+package report
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+%s</Types>`
+
+const xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+
+// xlsxStyles defines style 1 as bold for the titles and headers and style 2
+// with one decimal for the fractional numbers
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="1"><numFmt numFmtId="164" formatCode="0.0"/></numFmts>
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="3"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/><xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>
+</styleSheet>`
+
+// XLSX renders doc as a workbook with one sheet per section, the sheet
+// starts with the document title and subtitle above the table
+func XLSX(doc *Document) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	sections := doc.Sections
+	if len(sections) == 0 {
+		sections = []Section{{Title: doc.Title}}
+	}
+	if err := writeWorkbook(zw, sheetNames(sections)); err != nil {
+		return nil, err
+	}
+
+	for i, section := range sections {
+		w, err := zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1))
+		if err != nil {
+			return nil, err
+		}
+		if err := worksheet(w, doc, section); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeWorkbook writes the parts of a workbook besides its sheets, which go
+// to xl/worksheets/sheet1.xml, sheet2.xml and so on
+func writeWorkbook(zw *zip.Writer, names []string) error {
+	var overrides, sheets, rels strings.Builder
+	for i, name := range names {
+		fmt.Fprintf(&overrides, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`+"\n", i+1)
+		fmt.Fprintf(&sheets, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escapeXML(name), i+1, i+1)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`+"\n", i+1, i+1)
+	}
+	fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`+"\n", len(names)+1)
+
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", fmt.Sprintf(xlsxContentTypes, overrides.String())},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>` + sheets.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+` + rels.String() + `</Relationships>`},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, part := range parts {
+		w, err := zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, part.body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const (
+	worksheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	worksheetEnd = `</sheetData></worksheet>`
+)
+
+// sheetWriter writes the rows of a worksheet one at a time
+type sheetWriter struct {
+	w   io.Writer
+	row int
+}
+
+// skip leaves a blank row
+func (s *sheetWriter) skip() {
+	s.row++
+}
+
+// write writes cells as the next row, style 1 makes them bold
+func (s *sheetWriter) write(cells []interface{}, style int) error {
+	s.row++
+	var b strings.Builder
+	fmt.Fprintf(&b, `<row r="%d">`, s.row)
+	for i, cell := range cells {
+		ref := fmt.Sprintf("%s%d", columnName(i), s.row)
+		switch {
+		case isNumber(cell):
+			cellStyle := style
+			if _, ok := cell.(float64); ok && style == 0 {
+				cellStyle = 2
+			}
+			fmt.Fprintf(&b, `<c r="%s" s="%d"><v>%s</v></c>`, ref, cellStyle, numberText(cell))
+		case formatCell(cell) != "":
+			fmt.Fprintf(&b, `<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, style, escapeXML(formatCell(cell)))
+		}
+	}
+	b.WriteString(`</row>`)
+	_, err := io.WriteString(s.w, b.String())
+	return err
+}
+
+// header writes the column names as a bold row
+func (s *sheetWriter) header(columns []string) error {
+	if len(columns) == 0 {
+		return nil
+	}
+	cells := make([]interface{}, len(columns))
+	for i, column := range columns {
+		cells[i] = column
+	}
+	return s.write(cells, 1)
+}
+
+// worksheet writes the sheet XML of section to w
+func worksheet(w io.Writer, doc *Document, section Section) error {
+	if _, err := io.WriteString(w, worksheetStart); err != nil {
+		return err
+	}
+
+	s := &sheetWriter{w: w}
+	if err := s.write([]interface{}{doc.Title}, 1); err != nil {
+		return err
+	}
+	if doc.Subtitle != "" {
+		if err := s.write([]interface{}{doc.Subtitle}, 0); err != nil {
+			return err
+		}
+	}
+	if section.Title != doc.Title {
+		if err := s.write([]interface{}{section.Title}, 1); err != nil {
+			return err
+		}
+	}
+	s.skip() // Blank line above the table
+
+	if err := s.header(section.Columns); err != nil {
+		return err
+	}
+	for _, cells := range section.Rows {
+		if err := s.write(cells, 0); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, worksheetEnd)
+	return err
+}
+
+// numberText writes a number cell value with full precision
+func numberText(v interface{}) string {
+	if f, ok := v.(float64); ok {
+		return fmt.Sprintf("%g", f)
+	}
+	return formatCell(v)
+}
+
+// columnName returns the letters of the zero-based column i: A, B, ..., Z, AA
+func columnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// sheetNames derives unique sheet names of at most 31 characters from the
+// section titles, without the characters spreadsheets forbid
+func sheetNames(sections []Section) []string {
+	names := make([]string, len(sections))
+	used := make(map[string]bool)
+	for i, section := range sections {
+		name := strings.Map(func(r rune) rune {
+			if strings.ContainsRune(`[]:*?/\`, r) {
+				return ' '
+			}
+			return r
+		}, strings.TrimSpace(section.Title))
+		if name == "" {
+			name = fmt.Sprintf("Sheet%d", i+1)
+		}
+		if len([]rune(name)) > 31 {
+			name = string([]rune(name)[:31])
+		}
+
+		base := name
+		for n := 2; used[strings.ToLower(name)]; n++ {
+			suffix := fmt.Sprintf(" (%d)", n)
+			runes := []rune(base)
+			if len(runes)+len(suffix) > 31 {
+				runes = runes[:31-len(suffix)]
+			}
+			name = string(runes) + suffix
+		}
+		used[strings.ToLower(name)] = true
+		names[i] = name
+	}
+	return names
+}
+
+func escapeXML(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,150 @@
+package reporting_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Danny19977/sr-api/apptest"
+	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/reporting"
+	"github.com/google/uuid"
+)
+
+func TestScheduledReportIsMailedAndKept(t *testing.T) {
+	env := apptest.New(t)
+	country := &models.Country{UUID: uuid.New().String(), Name: "Country"}
+	if err := env.App.Geography.CreateCountry(country); err != nil {
+		t.Fatal(err)
+	}
+	north := &models.Province{UUID: uuid.New().String(), Name: "North", CountryUUID: country.UUID}
+	if err := env.App.Geography.CreateProvince(north); err != nil {
+		t.Fatal(err)
+	}
+	province := north.UUID
+	asm := env.CreateUser("ASM", &province)
+	other := env.CreateUser("ASM", nil)
+
+	body := map[string]interface{}{
+		"name":           "Weekly North",
+		"dashboard":      models.ReportGlobalOverview,
+		"period":         "previous_week",
+		"province_uuids": []string{"p-south"},
+		"recipients":     []string{"north@example.com", "boss@example.com"},
+		"schedule":       "0 7 * * 1",
+		"format":         "pdf",
+	}
+	res := env.Do("POST", "/api/reports/create", env.Token(asm), body)
+	if res.Status != 200 {
+		t.Fatalf("creating report: %d %s", res.Status, res.Body)
+	}
+	var created struct {
+		Data models.ReportSubscription `json:"data"`
+	}
+	if err := res.JSON(&created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Data.ProvinceUUIDs != province {
+		t.Errorf("ASM report covers %q, want their province %q", created.Data.ProvinceUUIDs, province)
+	}
+	if created.Data.NextRunAt == nil || created.Data.NextRunAt.Weekday() != time.Monday || created.Data.NextRunAt.Hour() != 7 {
+		t.Fatalf("next run = %v, want a Monday at 7am", created.Data.NextRunAt)
+	}
+	if res := env.Do("GET", "/api/reports/get/"+created.Data.UUID, env.Token(other), nil); res.Status != 404 {
+		t.Errorf("another user reading the report: got %d, want 404", res.Status)
+	}
+
+	// The scheduler runs it once it is due
+	due := *created.Data.NextRunAt
+	if err := reporting.New(env.App).Tick(due.Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(env.Mailer.Messages()); n != 0 {
+		t.Fatalf("%d messages sent before the report was due", n)
+	}
+	if err := reporting.New(env.App).Tick(due.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := env.Mailer.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(messages))
+	}
+	msg := messages[0]
+	if strings.Join(msg.To, ",") != "north@example.com,boss@example.com" {
+		t.Errorf("report sent to %v", msg.To)
+	}
+	if len(msg.Attachments) != 1 || !bytes.HasPrefix(msg.Attachments[0].Data, []byte("%PDF")) {
+		t.Fatalf("report attachment is not a PDF: %+v", msg.Attachments)
+	}
+
+	subscription, err := env.App.Reports.Find(created.Data.UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !subscription.NextRunAt.After(due) {
+		t.Errorf("next run %v did not move past %v", subscription.NextRunAt, due)
+	}
+
+	// A second tick at the same time does not send it again
+	if err := reporting.New(env.App).Tick(due.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(env.Mailer.Messages()); n != 1 {
+		t.Errorf("got %d messages after a second tick, want 1", n)
+	}
+
+	res = env.Do("GET", "/api/reports/get/"+created.Data.UUID+"/runs", env.Token(asm), nil)
+	var runs struct {
+		Data []models.ReportRun `json:"data"`
+	}
+	if err := res.JSON(&runs); err != nil {
+		t.Fatal(err)
+	}
+	if len(runs.Data) != 1 || runs.Data[0].Status != models.ReportSucceeded || runs.Data[0].Manual {
+		t.Fatalf("runs = %+v, want one succeeded scheduled run", runs.Data)
+	}
+
+	res = env.Do("GET", "/api/reports/runs/"+runs.Data[0].UUID+"/download", env.Token(asm), nil)
+	if res.Status != 200 || !strings.HasPrefix(string(res.Body), "%PDF") {
+		t.Fatalf("downloading the run: %d", res.Status)
+	}
+	if res := env.Do("GET", "/api/reports/runs/"+runs.Data[0].UUID+"/download", env.Token(other), nil); res.Status != 404 {
+		t.Errorf("another user downloading the run: got %d, want 404", res.Status)
+	}
+}
+
+func TestManualXLSXRun(t *testing.T) {
+	env := apptest.New(t)
+	admin := env.CreateUser("Admin", nil)
+
+	body := map[string]interface{}{
+		"name":       "Provinces",
+		"dashboard":  models.ReportProvincialAnalysis,
+		"period":     "month_to_date",
+		"recipients": []string{"ops@example.com"},
+		"schedule":   "@monthly",
+		"format":     "xlsx",
+	}
+	res := env.Do("POST", "/api/reports/create", env.Token(admin), body)
+	var created struct {
+		Data models.ReportSubscription `json:"data"`
+	}
+	if err := res.JSON(&created); err != nil || res.Status != 200 {
+		t.Fatalf("creating report: %d %s", res.Status, res.Body)
+	}
+
+	res = env.Do("POST", "/api/reports/run/"+created.Data.UUID, env.Token(admin), nil)
+	if res.Status != 200 {
+		t.Fatalf("running report: %d %s", res.Status, res.Body)
+	}
+	messages := env.Mailer.Messages()
+	if len(messages) != 1 || len(messages[0].Attachments) != 1 {
+		t.Fatalf("got %d messages, want 1 with the file", len(messages))
+	}
+	attachment := messages[0].Attachments[0]
+	if !strings.HasSuffix(attachment.Filename, ".xlsx") || !bytes.HasPrefix(attachment.Data, []byte("PK")) {
+		t.Errorf("attachment %q is not an XLSX file", attachment.Filename)
+	}
+}
@@ -0,0 +1,168 @@
+// Package reporting runs the report subscriptions on their schedule: it
+// renders their dashboard as a PDF or XLSX file, mails it to the recipients
+// and keeps every run with its file.
+package reporting
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/Danny19977/sr-api/app"
+	"github.com/Danny19977/sr-api/controller/dashboard"
+	"github.com/Danny19977/sr-api/mailer"
+	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/report"
+	"github.com/google/uuid"
+)
+
+// Scheduler runs the due report subscriptions
+type Scheduler struct {
+	app        *app.App
+	dashboards *dashboard.Controller
+}
+
+// New creates a scheduler rendering the dashboards of a
+func New(a *app.App) *Scheduler {
+	return &Scheduler{app: a, dashboards: dashboard.New(a)}
+}
+
+// Run checks for due subscriptions every check interval until ctx is done
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.app.Config.Reports.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Tick(time.Now()); err != nil {
+			s.app.Logger.Printf("reporting: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Tick runs every subscription due at now once, even when several runs were
+// missed while the scheduler was down
+func (s *Scheduler) Tick(now time.Time) error {
+	due, err := s.app.Reports.Due(now)
+	if err != nil {
+		return fmt.Errorf("listing due reports: %w", err)
+	}
+
+	for i := range due {
+		subscription := &due[i]
+		next := *subscription
+		next.ScheduleNext(now)
+
+		won, err := s.app.Reports.Claim(subscription, next.NextRunAt, now)
+		if err != nil {
+			s.app.Logger.Printf("reporting: claiming %q: %v", subscription.Name, err)
+			continue
+		}
+		if !won {
+			// Another instance runs it
+			continue
+		}
+		if _, err := s.Execute(subscription, now, false); err != nil {
+			s.app.Logger.Printf("reporting: running %q: %v", subscription.Name, err)
+		}
+	}
+	return nil
+}
+
+// Execute renders subscription for a run at now, mails it and records the
+// run. A failed run is recorded too, with its error.
+func (s *Scheduler) Execute(subscription *models.ReportSubscription, now time.Time, manual bool) (*models.ReportRun, error) {
+	run := &models.ReportRun{
+		UUID:             uuid.New().String(),
+		SubscriptionUUID: subscription.UUID,
+		StartedAt:        now,
+		Status:           models.ReportRunning,
+		Recipients:       subscription.Recipients,
+		Manual:           manual,
+		Format:           subscription.Format,
+	}
+	if err := s.app.Reports.CreateRun(run); err != nil {
+		return nil, err
+	}
+
+	runErr := s.render(subscription, run, now)
+	if runErr == nil {
+		runErr = s.mail(subscription, run)
+	}
+
+	finished := time.Now()
+	run.FinishedAt = &finished
+	run.Status = models.ReportSucceeded
+	if runErr != nil {
+		run.Status = models.ReportFailed
+		run.Error = runErr.Error()
+	}
+	if err := s.app.Reports.SaveRun(run); err != nil {
+		return run, err
+	}
+	return run, runErr
+}
+
+// render fills the period and the file of run
+func (s *Scheduler) render(subscription *models.ReportSubscription, run *models.ReportRun, now time.Time) error {
+	from, to, err := report.PeriodRange(subscription.Period, now)
+	if err != nil {
+		return err
+	}
+	run.PeriodStart, run.PeriodEnd = from, to
+
+	doc, err := s.dashboards.Report(subscription.Dashboard, dashboard.DateRange{StartDate: from, EndDate: to}, subscription.Provinces())
+	if err != nil {
+		return fmt.Errorf("reading the %s dashboard: %w", subscription.Dashboard, err)
+	}
+	doc.Title = fmt.Sprintf("%s - %s", subscription.Name, doc.Title)
+
+	output, contentType, err := report.Render(doc, subscription.Format)
+	if err != nil {
+		return fmt.Errorf("rendering: %w", err)
+	}
+	run.Output = output
+	run.Size = len(output)
+	run.ContentType = contentType
+	run.FileName = fmt.Sprintf("%s-%s.%s", fileSlug(subscription.Name), from.Format("2006-01-02"), subscription.Format)
+	return nil
+}
+
+// mail sends the file of run to the recipients of subscription
+func (s *Scheduler) mail(subscription *models.ReportSubscription, run *models.ReportRun) error {
+	period := fmt.Sprintf("%s to %s", run.PeriodStart.Format("2006-01-02 15:04"), run.PeriodEnd.Format("2006-01-02 15:04"))
+	return s.app.Mailer.Send(mailer.Message{
+		To:      subscription.RecipientList(),
+		Subject: fmt.Sprintf("%s: %s", subscription.Name, period),
+		HTML: fmt.Sprintf("<p>Please find attached the <strong>%s</strong> report for %s.</p>",
+			html.EscapeString(subscription.Name), html.EscapeString(period)),
+		Attachments: []mailer.Attachment{{Filename: run.FileName, ContentType: run.ContentType, Data: run.Output}},
+	})
+}
+
+// fileSlug turns a report name into a file name
+func fileSlug(name string) string {
+	slug := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '-'
+	}, name)
+	for strings.Contains(slug, "--") {
+		slug = strings.ReplaceAll(slug, "--", "-")
+	}
+	if slug = strings.Trim(slug, "-"); slug == "" {
+		return "report"
+	}
+	return slug
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/Danny19977/sr-api/models"
+	"gorm.io/gorm"
+)
+
+// AlertRuleRepository stores the threshold alert rules and their firings
+type AlertRuleRepository interface {
+	List(opts ListOptions) ([]models.AlertRule, int64, error)
+	// Active returns the rules the alerting engine checks
+	Active() ([]models.AlertRule, error)
+	Find(uuid string) (*models.AlertRule, error)
+	Create(rule *models.AlertRule) error
+	Save(rule *models.AlertRule) error
+	// Delete removes a rule with its firings
+	Delete(rule *models.AlertRule) error
+
+	// LastFirings returns when rule last fired for each province since since
+	LastFirings(ruleUUID string, since time.Time) (map[string]time.Time, error)
+	RecordFiring(firing *models.AlertRuleFiring) error
+	// Firings lists the firings of a rule, latest first
+	Firings(ruleUUID string, opts ListOptions) ([]models.AlertRuleFiring, int64, error)
+}
+
+type alertRuleRepository struct {
+	db *gorm.DB
+}
+
+// NewAlertRuleRepository creates an AlertRuleRepository backed by db
+func NewAlertRuleRepository(db *gorm.DB) AlertRuleRepository {
+	return &alertRuleRepository{db: db}
+}
+
+func (r *alertRuleRepository) List(opts ListOptions) ([]models.AlertRule, int64, error) {
+	var rules []models.AlertRule
+	var totalRecords int64
+
+	query := r.db.Model(&models.AlertRule{})
+	if opts.ProvinceUUID != nil {
+		query = query.Where("province_uuid = ?", *opts.ProvinceUUID)
+	}
+	if opts.Search != "" {
+		query = query.Where("name ILIKE ?", "%"+opts.Search+"%")
+	}
+	if err := query.Count(&totalRecords).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := opts.paginate(query).Order("updated_at DESC").Find(&rules).Error
+	return rules, totalRecords, err
+}
+
+func (r *alertRuleRepository) Active() ([]models.AlertRule, error) {
+	var rules []models.AlertRule
+	err := r.db.Where("active = ?", true).Order("created_at").Find(&rules).Error
+	return rules, err
+}
+
+func (r *alertRuleRepository) Find(uuid string) (*models.AlertRule, error) {
+	rule := &models.AlertRule{}
+	if err := first(r.db.Where("uuid = ?", uuid), rule); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+func (r *alertRuleRepository) Create(rule *models.AlertRule) error {
+	return r.db.Create(rule).Error
+}
+
+func (r *alertRuleRepository) Save(rule *models.AlertRule) error {
+	return r.db.Save(rule).Error
+}
+
+func (r *alertRuleRepository) Delete(rule *models.AlertRule) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("rule_uuid = ?", rule.UUID).Delete(&models.AlertRuleFiring{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(rule).Error
+	})
+}
+
+func (r *alertRuleRepository) LastFirings(ruleUUID string, since time.Time) (map[string]time.Time, error) {
+	var rows []struct {
+		ProvinceUUID string
+		FiredAt      time.Time
+	}
+	err := r.db.Model(&models.AlertRuleFiring{}).
+		Select("province_uuid, MAX(fired_at) as fired_at").
+		Where("rule_uuid = ? AND fired_at >= ?", ruleUUID, since).
+		Group("province_uuid").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	last := make(map[string]time.Time, len(rows))
+	for _, row := range rows {
+		last[row.ProvinceUUID] = row.FiredAt
+	}
+	return last, nil
+}
+
+func (r *alertRuleRepository) RecordFiring(firing *models.AlertRuleFiring) error {
+	return r.db.Create(firing).Error
+}
+
+func (r *alertRuleRepository) Firings(ruleUUID string, opts ListOptions) ([]models.AlertRuleFiring, int64, error) {
+	var firings []models.AlertRuleFiring
+	var totalRecords int64
+
+	query := r.db.Model(&models.AlertRuleFiring{}).Where("rule_uuid = ?", ruleUUID)
+	if opts.ProvinceUUID != nil {
+		query = query.Where("province_uuid = ?", *opts.ProvinceUUID)
+	}
+	if err := query.Count(&totalRecords).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := opts.paginate(query).Order("fired_at DESC").Find(&firings).Error
+	return firings, totalRecords, err
+}
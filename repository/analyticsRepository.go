@@ -0,0 +1,510 @@
+package repository
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Danny19977/sr-api/fiscal"
+	"gorm.io/gorm"
+)
+
+// MaxAnalyticsRows caps the rows an analytics query returns
+const MaxAnalyticsRows = 5000
+
+// maxAnalyticsDays bounds the range an analytics query reads
+const maxAnalyticsDays = 5 * 366
+
+// maxAnalyticsDimensions bounds the dimensions an analytics query groups by
+const maxAnalyticsDimensions = 4
+
+// AnalyticsMeasure aggregates a field of the sales
+type AnalyticsMeasure struct {
+	// Func is "sum", "avg" or "count"
+	Func string `json:"func"`
+	// Field is "quantity" or "value", the quantity times the unit price of
+	// the product. Count counts the entries and ignores it.
+	Field string `json:"field"`
+}
+
+// Name returns the column of the measure in the result, e.g. "sum_quantity"
+func (m AnalyticsMeasure) Name() string {
+	if m.Func == "count" {
+		return "count"
+	}
+	return m.Func + "_" + m.Field
+}
+
+// AnalyticsFilter restricts the sales to those whose Field compares to Value
+// with Op
+type AnalyticsFilter struct {
+	// Field is "province", "country", "product" or "user" with an UUID,
+	// "slot" with a slot name, "quantity" with a number or "flagged" with a
+	// boolean
+	Field string `json:"field"`
+	// Op is "eq", "neq", "in" or "not_in", quantities also take "gt",
+	// "gte", "lt" and "lte"
+	Op    string      `json:"op"`
+	Value interface{} `json:"value"`
+}
+
+// AnalyticsSort orders the result by a dimension or a measure column
+type AnalyticsSort struct {
+	Field string `json:"field"`
+	Desc  bool   `json:"desc"`
+}
+
+// AnalyticsSpec describes an aggregation of the sales. Dimensions are
+// "province", "country", "product", "user", "day", "week", "month",
+// "quarter", "year" and "slot", the periods following the fiscal calendar.
+type AnalyticsSpec struct {
+	Measures   []AnalyticsMeasure `json:"measures"`
+	Dimensions []string           `json:"dimensions"`
+	Filters    []AnalyticsFilter  `json:"filters"`
+	// Sort defaults to the dimensions in order
+	Sort []AnalyticsSort `json:"sort"`
+	// Limit defaults to MaxAnalyticsRows, which it cannot exceed
+	Limit int `json:"limit"`
+}
+
+// AnalyticsColumn describes a column of an analytics result
+type AnalyticsColumn struct {
+	Name string `json:"name"`
+	// Kind is "dimension" or "measure"
+	Kind string `json:"kind"`
+}
+
+// AnalyticsResult holds the rows of an analytics query, keyed by column name
+type AnalyticsResult struct {
+	Columns []AnalyticsColumn        `json:"columns"`
+	Rows    []map[string]interface{} `json:"rows"`
+	// Truncated is set when more rows matched than the limit
+	Truncated bool `json:"truncated"`
+}
+
+// AnalyticsRepository runs ad-hoc aggregations of the sales
+type AnalyticsRepository interface {
+	// Query aggregates the sales of provinceUUIDs (every province when
+	// empty) made from from until to excluded
+	Query(spec AnalyticsSpec, cal fiscal.Calendar, from, to time.Time, provinceUUIDs []string) (*AnalyticsResult, error)
+}
+
+type analyticsRepository struct {
+	db *gorm.DB
+}
+
+// NewAnalyticsRepository creates an AnalyticsRepository backed by db
+func NewAnalyticsRepository(db *gorm.DB) AnalyticsRepository {
+	return &analyticsRepository{db: db}
+}
+
+// analyticsJoins are the tables a column may need, in join order
+var analyticsJoins = []struct{ table, on string }{
+	{"provinces", "provinces.uuid = sales.province_uuid"},
+	{"countries", "countries.uuid = provinces.country_uuid"},
+	{"products", "products.uuid = sales.product_uuid"},
+	{"users", "users.uuid = sales.user_uuid"},
+}
+
+// analyticsEntities are the dimensions and filters naming a row of another
+// table: the key column, the label column and the tables they need
+var analyticsEntities = map[string]struct {
+	key, label string
+	joins      []string
+}{
+	"province": {"sales.province_uuid", "provinces.name", []string{"provinces"}},
+	"country":  {"provinces.country_uuid", "countries.name", []string{"provinces", "countries"}},
+	"product":  {"sales.product_uuid", "products.name", []string{"products"}},
+	"user":     {"sales.user_uuid", "users.fullname", []string{"users"}},
+}
+
+var analyticsMeasureFields = map[string]string{
+	"quantity": "sales.quantity",
+	"value":    "sales.quantity * products.price",
+}
+
+// analyticsSlot is the slot index expression of a sale
+var analyticsSlot = slotCase("EXTRACT(HOUR FROM sales.created_at)", 1)
+
+// slotLabel names the slot index of a sale
+func slotLabel(slot int) string {
+	switch {
+	case slot == SlotBefore:
+		return "before " + TimeSlots[0].Name
+	case slot >= len(TimeSlots):
+		return "after " + TimeSlots[len(TimeSlots)-1].Name
+	}
+	return TimeSlots[slot].Name
+}
+
+// analyticsColumn is a column of the compiled statement
+type analyticsColumn struct {
+	AnalyticsColumn
+	// scan returns a destination for the column and the value read into it
+	scan func() (interface{}, func() interface{})
+}
+
+func stringColumn(name, kind string) analyticsColumn {
+	return analyticsColumn{AnalyticsColumn{name, kind}, func() (interface{}, func() interface{}) {
+		var s string
+		return &s, func() interface{} { return s }
+	}}
+}
+
+func intColumn(name, kind string, label func(int) interface{}) analyticsColumn {
+	return analyticsColumn{AnalyticsColumn{name, kind}, func() (interface{}, func() interface{}) {
+		var n int64
+		return &n, func() interface{} { return label(int(n)) }
+	}}
+}
+
+func floatColumn(name string) analyticsColumn {
+	return analyticsColumn{AnalyticsColumn{name, "measure"}, func() (interface{}, func() interface{}) {
+		var f float64
+		return &f, func() interface{} { return f }
+	}}
+}
+
+// analyticsQuery is a compiled AnalyticsSpec
+type analyticsQuery struct {
+	sql     string
+	args    []interface{}
+	columns []analyticsColumn
+	limit   int
+}
+
+// analyticsPeriods returns the fiscal periods of unit overlapping [from, to)
+func analyticsPeriods(cal fiscal.Calendar, unit string, from, to time.Time) []fiscal.Period {
+	switch unit {
+	case "week":
+		return cal.Weeks(from, to)
+	case "month":
+		return cal.MonthsBetween(from, to)
+	}
+
+	var periods []fiscal.Period
+	for year := cal.YearOf(from); year <= cal.YearOf(to); year++ {
+		candidates := []fiscal.Period{cal.Year(year, from.Location())}
+		if unit == "quarter" {
+			candidates = cal.Quarters(year, from.Location())
+		}
+		for _, p := range candidates {
+			if p.Overlaps(from, to) {
+				periods = append(periods, p)
+			}
+		}
+	}
+	return periods
+}
+
+// periodLabel names a fiscal period in an analytics result
+func periodLabel(unit string, p fiscal.Period) string {
+	if unit == "year" {
+		return strconv.Itoa(p.Year)
+	}
+	return fmt.Sprintf("%d %s", p.Year, p.Name)
+}
+
+// stringValues reads the UUID or name list of a filter
+func stringValues(filter AnalyticsFilter) ([]string, error) {
+	switch value := filter.Value.(type) {
+	case string:
+		if filter.Op == "eq" || filter.Op == "neq" {
+			return []string{value}, nil
+		}
+	case []interface{}:
+		if filter.Op == "in" || filter.Op == "not_in" {
+			values := make([]string, len(value))
+			for i, v := range value {
+				s, ok := v.(string)
+				if !ok {
+					return nil, fmt.Errorf("filter %s: values must be strings", filter.Field)
+				}
+				values[i] = s
+			}
+			return values, nil
+		}
+	}
+	return nil, fmt.Errorf("filter %s: eq and neq take a string, in and not_in a list of strings", filter.Field)
+}
+
+// listCondition compares expr to a list with the eq, neq, in or not_in op
+func listCondition(expr, op string) string {
+	switch op {
+	case "neq", "not_in":
+		return expr + " NOT IN ?"
+	}
+	return expr + " IN ?"
+}
+
+var analyticsComparisons = map[string]string{
+	"eq": "=", "neq": "<>", "gt": ">", "gte": ">=", "lt": "<", "lte": "<=",
+}
+
+// compileFilter returns the condition of a filter, its arguments and the
+// tables it needs
+func compileFilter(filter AnalyticsFilter) (string, []interface{}, []string, error) {
+	if entity, ok := analyticsEntities[filter.Field]; ok {
+		values, err := stringValues(filter)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		return listCondition(entity.key, filter.Op), []interface{}{values}, entity.joins, nil
+	}
+
+	switch filter.Field {
+	case "slot":
+		names, err := stringValues(filter)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		slots := make([]int, len(names))
+		for i, name := range names {
+			slots[i] = -2
+			for slot := SlotBefore; slot <= len(TimeSlots); slot++ {
+				if slotLabel(slot) == name {
+					slots[i] = slot
+				}
+			}
+			if slots[i] == -2 {
+				return "", nil, nil, fmt.Errorf("filter slot: unknown slot %q", name)
+			}
+		}
+		return listCondition(analyticsSlot, filter.Op), []interface{}{slots}, nil, nil
+	case "quantity":
+		op, ok := analyticsComparisons[filter.Op]
+		value, isNumber := filter.Value.(float64)
+		if !ok || !isNumber {
+			return "", nil, nil, fmt.Errorf("filter quantity: op must be eq, neq, gt, gte, lt or lte with a number")
+		}
+		return "sales.quantity " + op + " ?", []interface{}{value}, nil, nil
+	case "flagged":
+		value, ok := filter.Value.(bool)
+		if filter.Op != "eq" || !ok {
+			return "", nil, nil, fmt.Errorf("filter flagged: op must be eq with a boolean")
+		}
+		return "sales.flagged = ?", []interface{}{value}, nil, nil
+	}
+	return "", nil, nil, fmt.Errorf("unknown filter field %q", filter.Field)
+}
+
+// Validate checks the spec and the range [from, to) it runs on
+func (s AnalyticsSpec) Validate(from, to time.Time) error {
+	_, err := compileAnalytics(s, fiscal.Gregorian, from, to, nil)
+	return err
+}
+
+// compileAnalytics turns a spec into a single grouped statement over the
+// sales of provinceUUIDs made in [from, to). Every identifier comes from the
+// tables above, every value of the spec is a bound argument.
+func compileAnalytics(spec AnalyticsSpec, cal fiscal.Calendar, from, to time.Time, provinceUUIDs []string) (*analyticsQuery, error) {
+	if len(spec.Measures) == 0 {
+		return nil, fmt.Errorf("at least one measure is required")
+	}
+	if len(spec.Dimensions) > maxAnalyticsDimensions {
+		return nil, fmt.Errorf("at most %d dimensions are allowed", maxAnalyticsDimensions)
+	}
+	if !from.Before(to) || to.Sub(from) > maxAnalyticsDays*24*time.Hour {
+		return nil, fmt.Errorf("the range must span between 1 and %d days", maxAnalyticsDays)
+	}
+	limit := spec.Limit
+	if limit < 0 || limit > MaxAnalyticsRows {
+		return nil, fmt.Errorf("limit must be between 1 and %d", MaxAnalyticsRows)
+	}
+	if limit == 0 {
+		limit = MaxAnalyticsRows
+	}
+
+	q := &analyticsQuery{limit: limit}
+	var selects []string
+	// groups counts the dimension columns, selected first
+	groups := 0
+	var selectArgs []interface{}
+	joins := map[string]bool{}
+	// orderBy maps the sortable columns to the column the rows sort on
+	orderBy := map[string]string{}
+	seen := map[string]bool{}
+
+	for _, dim := range spec.Dimensions {
+		if seen[dim] {
+			return nil, fmt.Errorf("dimension %q is repeated", dim)
+		}
+		seen[dim] = true
+
+		if entity, ok := analyticsEntities[dim]; ok {
+			for _, table := range entity.joins {
+				joins[table] = true
+			}
+			selects = append(selects, entity.key+` AS "`+dim+`_uuid"`, entity.label+` AS "`+dim+`"`)
+			groups += 2
+			q.columns = append(q.columns, stringColumn(dim+"_uuid", "dimension"), stringColumn(dim, "dimension"))
+			orderBy[dim] = dim
+			continue
+		}
+
+		switch dim {
+		case "day":
+			expr := "TO_CHAR(DATE(sales.created_at), 'YYYY-MM-DD')"
+			selects = append(selects, expr+` AS "day"`)
+			groups++
+			q.columns = append(q.columns, stringColumn(dim, "dimension"))
+		case "week", "month", "quarter", "year":
+			periods := analyticsPeriods(cal, dim, from, to)
+			bounds := make([]time.Time, 0, len(periods)+1)
+			for _, p := range periods {
+				bounds = append(bounds, p.From)
+			}
+			bounds = append(bounds, periods[len(periods)-1].To)
+
+			unit := dim
+			expr := "width_bucket(sales.created_at, ARRAY[?]::timestamptz[])"
+			selects = append(selects, expr+` AS "`+dim+`"`)
+			selectArgs = append(selectArgs, bounds)
+			groups++
+			q.columns = append(q.columns, intColumn(dim, "dimension", func(bucket int) interface{} {
+				if bucket < 1 || bucket > len(periods) {
+					return ""
+				}
+				return periodLabel(unit, periods[bucket-1])
+			}))
+		case "slot":
+			selects = append(selects, analyticsSlot+` AS "slot"`)
+			groups++
+			q.columns = append(q.columns, intColumn(dim, "dimension", func(slot int) interface{} {
+				return slotLabel(slot)
+			}))
+		default:
+			return nil, fmt.Errorf("unknown dimension %q", dim)
+		}
+		orderBy[dim] = dim
+	}
+
+	for _, measure := range spec.Measures {
+		name := measure.Name()
+		if orderBy[name] != "" {
+			return nil, fmt.Errorf("measure %q is repeated", name)
+		}
+
+		var expr string
+		switch measure.Func {
+		case "count":
+			expr = "COUNT(*)::float8"
+		case "sum", "avg":
+			field, ok := analyticsMeasureFields[measure.Field]
+			if !ok {
+				return nil, fmt.Errorf("measure %s: field must be quantity or value", measure.Func)
+			}
+			if measure.Field == "value" {
+				joins["products"] = true
+			}
+			expr = "COALESCE(" + strings.ToUpper(measure.Func) + "(" + field + "), 0)::float8"
+		default:
+			return nil, fmt.Errorf("measure function must be sum, avg or count")
+		}
+		selects = append(selects, expr+` AS "`+name+`"`)
+		q.columns = append(q.columns, floatColumn(name))
+		orderBy[name] = name
+	}
+
+	where := []string{"sales.created_at >= ?", "sales.created_at < ?"}
+	whereArgs := []interface{}{from, to}
+	if len(provinceUUIDs) > 0 {
+		where = append(where, "sales.province_uuid IN ?")
+		whereArgs = append(whereArgs, provinceUUIDs)
+	}
+	for _, filter := range spec.Filters {
+		condition, args, tables, err := compileFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, table := range tables {
+			joins[table] = true
+		}
+		where = append(where, condition)
+		whereArgs = append(whereArgs, args...)
+	}
+
+	sorts := spec.Sort
+	if len(sorts) == 0 {
+		for _, dim := range spec.Dimensions {
+			sorts = append(sorts, AnalyticsSort{Field: dim})
+		}
+	}
+	var orders []string
+	for _, sort := range sorts {
+		column, ok := orderBy[sort.Field]
+		if !ok {
+			return nil, fmt.Errorf("cannot sort by %q, which is not a dimension or a measure", sort.Field)
+		}
+		order := `"` + column + `"`
+		if sort.Desc {
+			order += " DESC"
+		}
+		orders = append(orders, order)
+	}
+
+	var b strings.Builder
+	b.WriteString("SELECT " + strings.Join(selects, ", ") + " FROM sales")
+	for _, join := range analyticsJoins {
+		if joins[join.table] {
+			b.WriteString(" JOIN " + join.table + " ON " + join.on)
+		}
+	}
+	b.WriteString(" WHERE " + strings.Join(where, " AND "))
+	if groups > 0 {
+		positions := make([]string, groups)
+		for i := range positions {
+			positions[i] = strconv.Itoa(i + 1)
+		}
+		b.WriteString(" GROUP BY " + strings.Join(positions, ", "))
+	}
+	if len(orders) > 0 {
+		b.WriteString(" ORDER BY " + strings.Join(orders, ", "))
+	}
+	b.WriteString(" LIMIT " + strconv.Itoa(limit+1))
+
+	q.sql = b.String()
+	q.args = append(selectArgs, whereArgs...)
+	return q, nil
+}
+
+func (r *analyticsRepository) Query(spec AnalyticsSpec, cal fiscal.Calendar, from, to time.Time, provinceUUIDs []string) (*AnalyticsResult, error) {
+	q, err := compileAnalytics(spec, cal, from, to, provinceUUIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Raw(q.sql, q.args...).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := &AnalyticsResult{Rows: []map[string]interface{}{}}
+	for _, column := range q.columns {
+		result.Columns = append(result.Columns, column.AnalyticsColumn)
+	}
+	for rows.Next() {
+		if len(result.Rows) == q.limit {
+			result.Truncated = true
+			break
+		}
+
+		dest := make([]interface{}, len(q.columns))
+		values := make([]func() interface{}, len(q.columns))
+		for i, column := range q.columns {
+			dest[i], values[i] = column.scan()
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		row := make(map[string]interface{}, len(q.columns))
+		for i, column := range q.columns {
+			row[column.Name] = values[i]()
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Danny19977/sr-api/fiscal"
+)
+
+func TestCompileAnalytics(t *testing.T) {
+	from := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 3, 0)
+	cal := fiscal.Calendar{StartMonth: time.July, WeekStart: time.Monday}
+
+	spec := AnalyticsSpec{
+		Measures:   []AnalyticsMeasure{{Func: "sum", Field: "value"}, {Func: "count"}},
+		Dimensions: []string{"country", "quarter"},
+		Filters: []AnalyticsFilter{
+			{Field: "product", Op: "in", Value: []interface{}{"p1", "p2'; DROP TABLE sales; --"}},
+			{Field: "quantity", Op: "gte", Value: float64(5)},
+		},
+		Sort:  []AnalyticsSort{{Field: "sum_value", Desc: true}},
+		Limit: 10,
+	}
+	q, err := compileAnalytics(spec, cal, from, to, []string{"asm-province"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, part := range []string{
+		"JOIN provinces ON", "JOIN countries ON", "JOIN products ON",
+		"sales.province_uuid IN ?", "sales.product_uuid IN ?", "sales.quantity >= ?",
+		"GROUP BY 1, 2, 3", `ORDER BY "sum_value" DESC`, "LIMIT 11",
+	} {
+		if !strings.Contains(q.sql, part) {
+			t.Errorf("%q is missing from %s", part, q.sql)
+		}
+	}
+	if strings.Contains(q.sql, "DROP") || strings.Contains(q.sql, "JOIN users") {
+		t.Errorf("a filter value or an unused table made it into %s", q.sql)
+	}
+
+	// June falls in the last quarter of fiscal year 2024, July in the first of 2025
+	label := q.columns[2].scan
+	dest, value := label()
+	*dest.(*int64) = 2
+	if got := value(); got != "2025 Q1" {
+		t.Errorf("got quarter %v, want 2025 Q1", got)
+	}
+
+	for _, tc := range []struct {
+		name string
+		spec AnalyticsSpec
+	}{
+		{"no measure", AnalyticsSpec{Dimensions: []string{"day"}}},
+		{"unknown dimension", AnalyticsSpec{Measures: spec.Measures, Dimensions: []string{"sales.quantity"}}},
+		{"repeated dimension", AnalyticsSpec{Measures: spec.Measures, Dimensions: []string{"day", "day"}}},
+		{"unknown field", AnalyticsSpec{Measures: []AnalyticsMeasure{{Func: "sum", Field: "signature"}}}},
+		{"unknown filter", AnalyticsSpec{Measures: spec.Measures, Filters: []AnalyticsFilter{{Field: "signature", Op: "eq", Value: "x"}}}},
+		{"list with eq", AnalyticsSpec{Measures: spec.Measures, Filters: []AnalyticsFilter{{Field: "province", Op: "eq", Value: []interface{}{"a"}}}}},
+		{"sort by a column not selected", AnalyticsSpec{Measures: spec.Measures, Sort: []AnalyticsSort{{Field: "created_at"}}}},
+		{"limit over the cap", AnalyticsSpec{Measures: spec.Measures, Limit: MaxAnalyticsRows + 1}},
+	} {
+		if err := tc.spec.Validate(from, to); err == nil {
+			t.Errorf("%s: the spec was accepted", tc.name)
+		}
+	}
+	if err := spec.Validate(to, from); err == nil {
+		t.Error("a range ending before it starts was accepted")
+	}
+}
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/Danny19977/sr-api/models"
+	"gorm.io/gorm"
+)
+
+// ComplianceListOptions filters the slot compliance history
+type ComplianceListOptions struct {
+	ListOptions
+
+	// From and To bound the days listed, both included, when set
+	From time.Time
+	To   time.Time
+	// Status keeps the records of one status when set
+	Status string
+}
+
+// ComplianceSummary counts the slots of a province by outcome
+type ComplianceSummary struct {
+	ProvinceUUID string
+	ProvinceName string
+	OnTime       int64
+	Late         int64
+	Missing      int64
+	Escalated    int64
+}
+
+// ComplianceRepository stores the slot compliance history
+type ComplianceRepository interface {
+	// Between returns the records of the days in [from, to)
+	Between(from, to time.Time) ([]models.SlotCompliance, error)
+	// Create stores a record and queues slot.missed when the slot is missing
+	Create(record *models.SlotCompliance) error
+	Save(record *models.SlotCompliance) error
+	// History lists the records matching opts, latest slot first
+	History(opts ComplianceListOptions) ([]models.SlotCompliance, int64, error)
+	// Summary counts the records of the days from to to of each province by status
+	Summary(from, to time.Time, provinceUUIDs []string) ([]ComplianceSummary, error)
+}
+
+type complianceRepository struct {
+	db *gorm.DB
+}
+
+// NewComplianceRepository creates a ComplianceRepository backed by db
+func NewComplianceRepository(db *gorm.DB) ComplianceRepository {
+	return &complianceRepository{db: db}
+}
+
+func (r *complianceRepository) Between(from, to time.Time) ([]models.SlotCompliance, error) {
+	var records []models.SlotCompliance
+	err := r.db.Where("day >= ? AND day < ?", dateParam(from), dateParam(to)).Find(&records).Error
+	return records, err
+}
+
+func (r *complianceRepository) Create(record *models.SlotCompliance) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(record).Error; err != nil {
+			return err
+		}
+		if record.Status != models.ComplianceMissing {
+			return nil
+		}
+		return enqueue(tx, models.EventSlotMissed, record)
+	})
+}
+
+func (r *complianceRepository) Save(record *models.SlotCompliance) error {
+	return r.db.Omit("Province").Save(record).Error
+}
+
+func (r *complianceRepository) History(opts ComplianceListOptions) ([]models.SlotCompliance, int64, error) {
+	var records []models.SlotCompliance
+	var totalRecords int64
+
+	query := r.db.Model(&models.SlotCompliance{})
+	if opts.ProvinceUUID != nil {
+		query = query.Where("province_uuid = ?", *opts.ProvinceUUID)
+	}
+	if opts.ProvinceUUIDs != nil {
+		query = query.Where("province_uuid IN ?", opts.ProvinceUUIDs)
+	}
+	if !opts.From.IsZero() {
+		query = query.Where("day >= ?", dateParam(opts.From))
+	}
+	if !opts.To.IsZero() {
+		query = query.Where("day <= ?", dateParam(opts.To))
+	}
+	if opts.Status != "" {
+		query = query.Where("status = ?", opts.Status)
+	}
+	if err := query.Count(&totalRecords).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := opts.paginate(query).Preload("Province").
+		Order("day DESC, slot DESC").
+		Find(&records).Error
+	return records, totalRecords, err
+}
+
+func (r *complianceRepository) Summary(from, to time.Time, provinceUUIDs []string) ([]ComplianceSummary, error) {
+	filter, filterArgs := provinceFilter("c.province_uuid", provinceUUIDs)
+	query := `
+		SELECT
+			c.province_uuid,
+			COALESCE(MAX(p.name), '') as province_name,
+			COUNT(*) FILTER (WHERE c.status = ?) as on_time,
+			COUNT(*) FILTER (WHERE c.status = ?) as late,
+			COUNT(*) FILTER (WHERE c.status = ?) as missing,
+			COUNT(c.escalated_at) as escalated
+		FROM slot_compliances c
+		LEFT JOIN provinces p ON p.uuid = c.province_uuid
+		WHERE c.day >= ? AND c.day <= ?` + filter + `
+		GROUP BY c.province_uuid
+		ORDER BY 2
+	`
+
+	args := []interface{}{models.ComplianceOnTime, models.ComplianceLate, models.ComplianceMissing, dateParam(from), dateParam(to)}
+	var summaries []ComplianceSummary
+	err := r.db.Raw(query, append(args, filterArgs...)...).Scan(&summaries).Error
+	return summaries, err
+}
+
+// dateParam formats the calendar day of t for comparisons with date columns,
+// which a timestamp parameter would shift by the session time zone
+func dateParam(t time.Time) string {
+	return t.Format("2006-01-02")
+}
@@ -0,0 +1,752 @@
+package repository
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Danny19977/sr-api/fiscal"
+	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/workdays"
+	"gorm.io/gorm"
+)
+
+// TimeSlot is one of the daily reporting windows, from StartHour included to
+// EndHour excluded
+type TimeSlot struct {
+	Name      string
+	StartHour int
+	EndHour   int
+}
+
+// TimeSlots are the reporting windows of a day, in order and without gaps
+var TimeSlots = []TimeSlot{
+	{"8am", 6, 10},
+	{"12pm", 10, 14},
+	{"3pm", 14, 18},
+	{"8pm", 18, 22},
+}
+
+// SlotBefore is the slot index of sales made before the first time slot.
+// Sales made after the last slot get the index len(TimeSlots).
+const SlotBefore = -1
+
+// SlotOf returns the slot index of a sale made at t, in the location of t
+func SlotOf(t time.Time) int {
+	if t.Hour() < TimeSlots[0].StartHour {
+		return SlotBefore
+	}
+	for i, slot := range TimeSlots {
+		if t.Hour() < slot.EndHour {
+			return i
+		}
+	}
+	return len(TimeSlots)
+}
+
+// ProvinceRef identifies a province on the dashboards
+type ProvinceRef struct {
+	UUID string
+	Name string
+}
+
+// ProvinceTotal is the quantity sold by a province
+type ProvinceTotal struct {
+	UUID  string
+	Name  string
+	Total int64
+}
+
+// TimeRange is a period with both bounds included
+type TimeRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// LabelTotal is the quantity sold in a labelled period
+type LabelTotal struct {
+	Label string
+	Total int64
+}
+
+// BucketTotal is the quantity sold by a province in the period starting at Bucket
+type BucketTotal struct {
+	ProvinceUUID string
+	Bucket       time.Time
+	Total        int64
+}
+
+// PeriodTotal is the quantity sold by a province in a period of a query,
+// Period being the index of the bound it starts at
+type PeriodTotal struct {
+	ProvinceUUID string
+	Period       int
+	Total        int64
+}
+
+// SlotTotal is the activity of a province in a time slot of a day. Day is the
+// number of days since the origin of the query.
+type SlotTotal struct {
+	Day          int
+	ProvinceUUID string
+	Slot         int
+	Total        int64
+	Entries      int64
+	// Flagged counts the entries flagged as anomalies
+	Flagged     int64
+	LastEntryAt time.Time
+}
+
+// SlotCumulative is the quantity sold from the start of a day to the end of a slot
+type SlotCumulative struct {
+	Day        int
+	Slot       int
+	Cumulative int64
+}
+
+// SlotAverage is the average quantity of the sales of a province in a slot
+type SlotAverage struct {
+	ProvinceUUID string
+	Slot         int
+	Average      float64
+}
+
+// DayTotal is the quantity sold by a province or a product on a day, Day
+// being the number of days since the origin of the query
+type DayTotal struct {
+	Day   int
+	Key   string
+	Total int64
+}
+
+// UserActivity is what a user entered in a period. Slots counts the time
+// slots of the days the user entered in, MinutesAfterOpen the average delay
+// of their first entry in such a slot after it opened.
+type UserActivity struct {
+	UserUUID         string
+	Fullname         string
+	Role             string
+	ProvinceUUID     string
+	Total            int64
+	Entries          int64
+	Slots            int64
+	MinutesAfterOpen float64
+}
+
+// ProductRef identifies a product on the dashboards
+type ProductRef struct {
+	UUID string
+	Name string
+}
+
+// TargetRow is the target of a province for a numbered period of a fiscal
+// year: the calendar month (1-12) a month target is named after, or the
+// week. Year is 0 when the target is not linked to a year.
+type TargetRow struct {
+	ProvinceUUID string
+	Year         int
+	Period       int
+	Target       int64
+}
+
+// DashboardRepository runs the aggregations behind the dashboards. Every
+// method issues a single grouped statement whatever the number of provinces.
+type DashboardRepository interface {
+	// Provinces returns the provinces in provinceUUIDs, every province when empty
+	Provinces(provinceUUIDs []string) ([]ProvinceRef, error)
+	// RangeTotals returns the quantity sold in each of ranges
+	RangeTotals(provinceUUIDs []string, ranges ...TimeRange) ([]int64, error)
+	// ProvinceTotals returns the provinces that sold in r, best seller first
+	ProvinceTotals(r TimeRange, provinceUUIDs []string) ([]ProvinceTotal, error)
+	// SalesTrend returns the labelled totals of r by "daily", "weekly" or "monthly" period
+	SalesTrend(granularity string, r TimeRange, provinceUUIDs []string) ([]LabelTotal, error)
+	// BucketTotals groups the sales of r by province and date_trunc unit ("day", "week" or "month")
+	BucketTotals(unit string, r TimeRange, provinceUUIDs []string) ([]BucketTotal, error)
+	// PeriodTotals groups the sales by province and by the period between
+	// consecutive bounds, the bounds being in order
+	PeriodTotals(bounds []time.Time, provinceUUIDs []string) ([]PeriodTotal, error)
+	// RollupPeriodTotals does the same from the UTC rollups, the bounds being
+	// dates. Bounds starting months read the monthly rollups.
+	RollupPeriodTotals(bounds []time.Time, provinceUUIDs []string) ([]PeriodTotal, error)
+	// SlotTotals groups the sales of the days days starting at origin by day, province and slot
+	SlotTotals(origin time.Time, days int, provinceUUIDs []string) ([]SlotTotal, error)
+	// CumulativeSlots returns the running total of each day starting at origin at the end of each slot
+	CumulativeSlots(origin time.Time, days int, provinceUUIDs []string) ([]SlotCumulative, error)
+	// SlotAverages returns the average sale of each province by slot over r
+	SlotAverages(r TimeRange, provinceUUIDs []string) ([]SlotAverage, error)
+	// Calendar returns the fiscal calendar shared by the countries of
+	// provinceUUIDs (every province when empty), the Gregorian calendar when
+	// they differ
+	Calendar(provinceUUIDs []string) (fiscal.Calendar, error)
+	// Workdays returns the working days and holidays of the countries of
+	// provinceUUIDs (every province when empty), a day being worked when
+	// any of them works it
+	Workdays(provinceUUIDs []string) (workdays.Calendar, error)
+	// MonthlyTargets returns the month targets of years (all years when empty)
+	MonthlyTargets(years []int, provinceUUIDs []string) ([]TargetRow, error)
+	// WeeklyTargets returns the week targets of years (all years when empty)
+	WeeklyTargets(years []int, provinceUUIDs []string) ([]TargetRow, error)
+	// YearTargets returns the global target of each of years that has one
+	YearTargets(years []int) (map[int]int64, error)
+	// DayTotals groups the sales from origin until until excluded by day and
+	// by "province" or "product"
+	DayTotals(by string, origin, until time.Time, provinceUUIDs []string) ([]DayTotal, error)
+	// Products returns the products in productUUIDs
+	Products(productUUIDs []string) ([]ProductRef, error)
+	// UserActivity returns the activity from from until to excluded of the
+	// active users assigned to provinceUUIDs (to any province when empty)
+	// and of the users who entered sales there
+	UserActivity(from, to time.Time, provinceUUIDs []string) ([]UserActivity, error)
+}
+
+type dashboardRepository struct {
+	db *gorm.DB
+}
+
+// NewDashboardRepository creates a DashboardRepository backed by db
+func NewDashboardRepository(db *gorm.DB) DashboardRepository {
+	return &dashboardRepository{db: db}
+}
+
+// provinceFilter restricts column to provinceUUIDs when the list is not empty
+func provinceFilter(column string, provinceUUIDs []string) (string, []interface{}) {
+	if len(provinceUUIDs) == 0 {
+		return "", nil
+	}
+	return " AND " + column + " IN ?", []interface{}{provinceUUIDs}
+}
+
+// slotCase maps expr, a time of day counted in units per hour, to its slot index
+func slotCase(expr string, unitsPerHour int) string {
+	var b strings.Builder
+	b.WriteString("CASE")
+	fmt.Fprintf(&b, " WHEN %s < %d THEN %d", expr, TimeSlots[0].StartHour*unitsPerHour, SlotBefore)
+	for i, slot := range TimeSlots {
+		fmt.Fprintf(&b, " WHEN %s < %d THEN %d", expr, slot.EndHour*unitsPerHour, i)
+	}
+	fmt.Fprintf(&b, " ELSE %d END", len(TimeSlots))
+	return b.String()
+}
+
+// yearBounds restricts the sales to the UTC calendar years listed
+func yearBounds(years []int) (string, []interface{}) {
+	low, high := years[0], years[0]
+	for _, y := range years {
+		if y < low {
+			low = y
+		}
+		if y > high {
+			high = y
+		}
+	}
+	return "created_at >= ? AND created_at < ? AND EXTRACT(YEAR FROM created_at AT TIME ZONE 'UTC') IN ?",
+		[]interface{}{
+			time.Date(low, 1, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(high+1, 1, 1, 0, 0, 0, 0, time.UTC),
+			years,
+		}
+}
+
+func yearLabels(years []int) []string {
+	labels := make([]string, len(years))
+	for i, y := range years {
+		labels[i] = strconv.Itoa(y)
+	}
+	return labels
+}
+
+func (r *dashboardRepository) Provinces(provinceUUIDs []string) ([]ProvinceRef, error) {
+	query := r.db.Model(&models.Province{}).Select("uuid, name").Order("name")
+	if len(provinceUUIDs) > 0 {
+		query = query.Where("uuid IN ?", provinceUUIDs)
+	}
+
+	var provinces []ProvinceRef
+	err := query.Scan(&provinces).Error
+	return provinces, err
+}
+
+func (r *dashboardRepository) RangeTotals(provinceUUIDs []string, ranges ...TimeRange) ([]int64, error) {
+	if len(ranges) == 0 {
+		return nil, nil
+	}
+
+	columns := make([]string, len(ranges))
+	var args []interface{}
+	from, to := ranges[0].From, ranges[0].To
+	for i, rg := range ranges {
+		columns[i] = "COALESCE(SUM(quantity) FILTER (WHERE created_at BETWEEN ? AND ?), 0)::bigint"
+		args = append(args, rg.From, rg.To)
+		if rg.From.Before(from) {
+			from = rg.From
+		}
+		if rg.To.After(to) {
+			to = rg.To
+		}
+	}
+
+	filter, filterArgs := provinceFilter("province_uuid", provinceUUIDs)
+	query := "SELECT " + strings.Join(columns, ", ") + " FROM sales WHERE created_at BETWEEN ? AND ?" + filter
+	args = append(append(args, from, to), filterArgs...)
+
+	totals := make([]int64, len(ranges))
+	dest := make([]interface{}, len(ranges))
+	for i := range totals {
+		dest[i] = &totals[i]
+	}
+	if err := r.db.Raw(query, args...).Row().Scan(dest...); err != nil {
+		return nil, err
+	}
+	return totals, nil
+}
+
+func (r *dashboardRepository) ProvinceTotals(rg TimeRange, provinceUUIDs []string) ([]ProvinceTotal, error) {
+	query := r.db.Model(&models.Sale{}).
+		Select("provinces.uuid, provinces.name, COALESCE(SUM(sales.quantity), 0) as total").
+		Joins("JOIN provinces ON provinces.uuid = sales.province_uuid").
+		Where("sales.created_at BETWEEN ? AND ?", rg.From, rg.To)
+	if len(provinceUUIDs) > 0 {
+		query = query.Where("sales.province_uuid IN ?", provinceUUIDs)
+	}
+
+	var totals []ProvinceTotal
+	err := query.Group("provinces.uuid, provinces.name").Order("total DESC").Scan(&totals).Error
+	return totals, err
+}
+
+func (r *dashboardRepository) SalesTrend(granularity string, rg TimeRange, provinceUUIDs []string) ([]LabelTotal, error) {
+	filter, filterArgs := provinceFilter("province_uuid", provinceUUIDs)
+
+	var query string
+	switch granularity {
+	case "daily":
+		query = `
+			SELECT
+				TO_CHAR(DATE(created_at), 'YYYY-MM-DD') as label,
+				COALESCE(SUM(quantity), 0) as total
+			FROM sales
+			WHERE created_at BETWEEN ? AND ?` + filter + `
+			GROUP BY DATE(created_at)
+			ORDER BY DATE(created_at)
+		`
+	case "weekly":
+		query = `
+			SELECT
+				CONCAT('Week ', EXTRACT(WEEK FROM created_at)) as label,
+				COALESCE(SUM(quantity), 0) as total
+			FROM sales
+			WHERE created_at BETWEEN ? AND ?` + filter + `
+			GROUP BY EXTRACT(WEEK FROM created_at)
+			ORDER BY EXTRACT(WEEK FROM created_at)
+		`
+	case "monthly":
+		query = `
+			SELECT
+				TO_CHAR(created_at, 'Month YYYY') as label,
+				COALESCE(SUM(quantity), 0) as total
+			FROM sales
+			WHERE created_at BETWEEN ? AND ?` + filter + `
+			GROUP BY TO_CHAR(created_at, 'Month YYYY'), EXTRACT(YEAR FROM created_at), EXTRACT(MONTH FROM created_at)
+			ORDER BY EXTRACT(YEAR FROM created_at), EXTRACT(MONTH FROM created_at)
+		`
+	default:
+		return nil, fmt.Errorf("unknown granularity %q", granularity)
+	}
+
+	var totals []LabelTotal
+	err := r.db.Raw(query, append([]interface{}{rg.From, rg.To}, filterArgs...)...).Scan(&totals).Error
+	return totals, err
+}
+
+func (r *dashboardRepository) BucketTotals(unit string, rg TimeRange, provinceUUIDs []string) ([]BucketTotal, error) {
+	switch unit {
+	case "day", "week", "month":
+	default:
+		return nil, fmt.Errorf("unknown bucket unit %q", unit)
+	}
+
+	filter, filterArgs := provinceFilter("province_uuid", provinceUUIDs)
+	query := `
+		SELECT
+			DATE_TRUNC('` + unit + `', created_at) as bucket,
+			province_uuid,
+			COALESCE(SUM(quantity), 0) as total
+		FROM sales
+		WHERE created_at BETWEEN ? AND ?` + filter + `
+		GROUP BY 1, 2
+		ORDER BY 1, 2
+	`
+
+	var totals []BucketTotal
+	err := r.db.Raw(query, append([]interface{}{rg.From, rg.To}, filterArgs...)...).Scan(&totals).Error
+	return totals, err
+}
+
+func (r *dashboardRepository) PeriodTotals(bounds []time.Time, provinceUUIDs []string) ([]PeriodTotal, error) {
+	if len(bounds) < 2 {
+		return nil, nil
+	}
+
+	filter, filterArgs := provinceFilter("province_uuid", provinceUUIDs)
+	query := `
+		SELECT
+			province_uuid,
+			width_bucket(created_at, ARRAY[?]::timestamptz[]) - 1 as period,
+			COALESCE(SUM(quantity), 0) as total
+		FROM sales
+		WHERE created_at >= ? AND created_at < ?` + filter + `
+		GROUP BY 1, 2
+		ORDER BY 1, 2
+	`
+
+	args := []interface{}{bounds, bounds[0], bounds[len(bounds)-1]}
+	var totals []PeriodTotal
+	err := r.db.Raw(query, append(args, filterArgs...)...).Scan(&totals).Error
+	return totals, err
+}
+
+func (r *dashboardRepository) RollupPeriodTotals(bounds []time.Time, provinceUUIDs []string) ([]PeriodTotal, error) {
+	if len(bounds) < 2 {
+		return nil, nil
+	}
+
+	dates := make([]string, len(bounds))
+	months := true
+	for i, bound := range bounds {
+		dates[i] = dateParam(bound)
+		months = months && bound.Day() == 1
+	}
+
+	day, table := "day", "sales_daily_rollups"
+	if months {
+		day, table = "make_date(year, month, 1)", "sales_monthly_rollups"
+	}
+	filter, filterArgs := provinceFilter("province_uuid", provinceUUIDs)
+	query := `
+		SELECT
+			province_uuid,
+			width_bucket(` + day + `, ARRAY[?]::date[]) - 1 as period,
+			COALESCE(SUM(quantity), 0) as total
+		FROM ` + table + `
+		WHERE ` + day + ` >= ?::date AND ` + day + ` < ?::date` + filter + `
+		GROUP BY 1, 2
+		ORDER BY 1, 2
+	`
+
+	args := []interface{}{dates, dates[0], dates[len(dates)-1]}
+	var totals []PeriodTotal
+	err := r.db.Raw(query, append(args, filterArgs...)...).Scan(&totals).Error
+	return totals, err
+}
+
+// slotSales selects the sales of the days days starting at origin with their
+// day number and their offset in seconds from the start of that day
+func slotSales(origin time.Time, days int, provinceUUIDs []string) (string, []interface{}) {
+	filter, filterArgs := provinceFilter("province_uuid", provinceUUIDs)
+	query := `
+		SELECT
+			province_uuid,
+			quantity,
+			flagged,
+			created_at,
+			FLOOR(EXTRACT(EPOCH FROM created_at - ?::timestamptz) / 86400)::int as day,
+			FLOOR(EXTRACT(EPOCH FROM created_at - ?::timestamptz))::bigint % 86400 as secs
+		FROM sales
+		WHERE created_at >= ? AND created_at < ?` + filter
+
+	args := []interface{}{origin, origin, origin, origin.AddDate(0, 0, days)}
+	return query, append(args, filterArgs...)
+}
+
+func (r *dashboardRepository) DayTotals(by string, origin, until time.Time, provinceUUIDs []string) ([]DayTotal, error) {
+	column := map[string]string{"province": "province_uuid", "product": "product_uuid"}[by]
+	if column == "" {
+		return nil, fmt.Errorf("unknown grouping %q", by)
+	}
+
+	filter, filterArgs := provinceFilter("province_uuid", provinceUUIDs)
+	query := `
+		SELECT
+			FLOOR(EXTRACT(EPOCH FROM created_at - ?::timestamptz) / 86400)::int as day,
+			` + column + ` as key,
+			COALESCE(SUM(quantity), 0) as total
+		FROM sales
+		WHERE created_at >= ? AND created_at < ?` + filter + `
+		GROUP BY 1, 2
+		ORDER BY 1, 2
+	`
+
+	var totals []DayTotal
+	err := r.db.Raw(query, append([]interface{}{origin, origin, until}, filterArgs...)...).Scan(&totals).Error
+	return totals, err
+}
+
+func (r *dashboardRepository) Products(productUUIDs []string) ([]ProductRef, error) {
+	var products []ProductRef
+	if len(productUUIDs) == 0 {
+		return products, nil
+	}
+	err := r.db.Model(&models.Product{}).Select("uuid, name").Where("uuid IN ?", productUUIDs).Order("name").Scan(&products).Error
+	return products, err
+}
+
+func (r *dashboardRepository) SlotTotals(origin time.Time, days int, provinceUUIDs []string) ([]SlotTotal, error) {
+	sales, args := slotSales(origin, days, provinceUUIDs)
+	query := `
+		SELECT
+			day,
+			province_uuid,
+			` + slotCase("secs", 3600) + ` as slot,
+			COALESCE(SUM(quantity), 0) as total,
+			COUNT(*) as entries,
+			COUNT(*) FILTER (WHERE flagged) as flagged,
+			MAX(created_at) as last_entry_at
+		FROM (` + sales + `) as day_sales
+		GROUP BY 1, 2, 3
+		ORDER BY 1, 2, 3
+	`
+
+	var totals []SlotTotal
+	err := r.db.Raw(query, args...).Scan(&totals).Error
+	return totals, err
+}
+
+func (r *dashboardRepository) CumulativeSlots(origin time.Time, days int, provinceUUIDs []string) ([]SlotCumulative, error) {
+	sales, args := slotSales(origin, days, provinceUUIDs)
+	query := `
+		SELECT
+			day,
+			slot,
+			CAST(SUM(SUM(quantity)) OVER (PARTITION BY day ORDER BY slot) AS bigint) as cumulative
+		FROM (
+			SELECT day, ` + slotCase("secs", 3600) + ` as slot, quantity
+			FROM (` + sales + `) as day_sales
+		) as slot_sales
+		GROUP BY day, slot
+		ORDER BY day, slot
+	`
+
+	var totals []SlotCumulative
+	err := r.db.Raw(query, args...).Scan(&totals).Error
+	return totals, err
+}
+
+func (r *dashboardRepository) SlotAverages(rg TimeRange, provinceUUIDs []string) ([]SlotAverage, error) {
+	filter, filterArgs := provinceFilter("province_uuid", provinceUUIDs)
+	query := `
+		SELECT
+			province_uuid,
+			` + slotCase("EXTRACT(HOUR FROM created_at)", 1) + ` as slot,
+			COALESCE(AVG(quantity), 0)::float8 as average
+		FROM sales
+		WHERE created_at BETWEEN ? AND ?` + filter + `
+		GROUP BY 1, 2
+	`
+
+	var averages []SlotAverage
+	err := r.db.Raw(query, append([]interface{}{rg.From, rg.To}, filterArgs...)...).Scan(&averages).Error
+	return averages, err
+}
+
+// targetRecord is a month or week target joined with the label of its year
+type targetRecord struct {
+	ProvinceUUID string
+	Year         string
+	Period       string
+	Quantity     string
+}
+
+func (r *dashboardRepository) targets(table, column string, years []int, provinceUUIDs []string) ([]targetRecord, error) {
+	query := r.db.Table(table).
+		Select(table + ".province_uuid, COALESCE(years.year, '') as year, " + table + "." + column + " as period, " + table + ".quantity").
+		Joins("LEFT JOIN years ON years.uuid = " + table + ".year_uuid").
+		// Targets of other territories break those of the provinces down
+		Where(table + ".territory_uuid IS NULL")
+	if len(years) > 0 {
+		query = query.Where("years.year IN ?", yearLabels(years))
+	}
+	if len(provinceUUIDs) > 0 {
+		query = query.Where(table+".province_uuid IN ?", provinceUUIDs)
+	}
+
+	var records []targetRecord
+	err := query.Scan(&records).Error
+	return records, err
+}
+
+func (r *dashboardRepository) Calendar(provinceUUIDs []string) (fiscal.Calendar, error) {
+	query := r.db.Model(&models.Country{}).
+		Distinct("countries.fiscal_year_start", "countries.fiscal_pattern", "countries.fiscal_week_start").
+		Joins("JOIN provinces ON provinces.country_uuid = countries.uuid")
+	if len(provinceUUIDs) > 0 {
+		query = query.Where("provinces.uuid IN ?", provinceUUIDs)
+	}
+
+	var countries []models.Country
+	if err := query.Scan(&countries).Error; err != nil {
+		return fiscal.Gregorian, err
+	}
+
+	calendars := make(map[fiscal.Calendar]bool)
+	for i := range countries {
+		calendars[countries[i].Calendar()] = true
+	}
+	if len(calendars) != 1 {
+		return fiscal.Gregorian, nil
+	}
+	return countries[0].Calendar(), nil
+}
+
+func (r *dashboardRepository) Workdays(provinceUUIDs []string) (workdays.Calendar, error) {
+	query := r.db.Model(&models.Country{}).Preload("Holidays")
+	if len(provinceUUIDs) > 0 {
+		query = query.Where("uuid IN (?)", r.db.Model(&models.Province{}).Select("country_uuid").Where("uuid IN ?", provinceUUIDs))
+	}
+
+	var countries []models.Country
+	if err := query.Find(&countries).Error; err != nil {
+		return workdays.Default, err
+	}
+
+	calendars := make([]workdays.Calendar, len(countries))
+	for i := range countries {
+		calendars[i] = countries[i].Workdays(countries[i].Holidays)
+	}
+	return workdays.Merge(calendars...), nil
+}
+
+func (r *dashboardRepository) MonthlyTargets(years []int, provinceUUIDs []string) ([]TargetRow, error) {
+	records, err := r.targets("months", "month", years, provinceUUIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	monthIndex := make(map[string]int, len(MonthNames))
+	for i, name := range MonthNames {
+		monthIndex[name] = i + 1
+	}
+
+	rows := make([]TargetRow, 0, len(records))
+	for _, record := range records {
+		month, ok := monthIndex[record.Period]
+		if !ok {
+			continue
+		}
+		// Invalid quantities count as no target
+		target, err := strconv.ParseInt(record.Quantity, 10, 64)
+		if err != nil {
+			continue
+		}
+		year, _ := strconv.Atoi(record.Year)
+		rows = append(rows, TargetRow{ProvinceUUID: record.ProvinceUUID, Year: year, Period: month, Target: target})
+	}
+	return rows, nil
+}
+
+func (r *dashboardRepository) WeeklyTargets(years []int, provinceUUIDs []string) ([]TargetRow, error) {
+	records, err := r.targets("weeks", "week", years, provinceUUIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]TargetRow, 0, len(records))
+	for _, record := range records {
+		target, err := strconv.ParseInt(record.Quantity, 10, 64)
+		if err != nil {
+			continue
+		}
+		year, _ := strconv.Atoi(record.Year)
+		week, _ := strconv.Atoi(record.Period)
+		rows = append(rows, TargetRow{ProvinceUUID: record.ProvinceUUID, Year: year, Period: week, Target: target})
+	}
+	return rows, nil
+}
+
+func (r *dashboardRepository) YearTargets(years []int) (map[int]int64, error) {
+	targets := make(map[int]int64)
+	if len(years) == 0 {
+		return targets, nil
+	}
+
+	var records []models.Year
+	if err := r.db.Where("year IN ?", yearLabels(years)).Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	for _, record := range records {
+		year, err := strconv.Atoi(record.Year)
+		if err != nil {
+			continue
+		}
+		target, err := strconv.ParseInt(record.Quantity, 10, 64)
+		if err != nil {
+			continue
+		}
+		targets[year] = target
+	}
+	return targets, nil
+}
+
+// slotStartCase maps a slot index expression to the minute of the day the
+// slot opens
+func slotStartCase(expr string) string {
+	var b strings.Builder
+	b.WriteString("CASE " + expr)
+	for i, slot := range TimeSlots {
+		fmt.Fprintf(&b, " WHEN %d THEN %d", i, slot.StartHour*60)
+	}
+	b.WriteString(" END")
+	return b.String()
+}
+
+func (r *dashboardRepository) UserActivity(from, to time.Time, provinceUUIDs []string) ([]UserActivity, error) {
+	salesFilter, salesArgs := provinceFilter("province_uuid", provinceUUIDs)
+	userFilter, userArgs := provinceFilter("u.province_uuid", provinceUUIDs)
+	query := `
+		WITH entries AS (
+			SELECT
+				user_uuid,
+				quantity,
+				DATE(created_at) as day,
+				` + slotCase("EXTRACT(HOUR FROM created_at)", 1) + ` as slot,
+				EXTRACT(HOUR FROM created_at) * 60 + EXTRACT(MINUTE FROM created_at) as minute
+			FROM sales
+			WHERE created_at >= ? AND created_at < ?` + salesFilter + `
+		), totals AS (
+			SELECT user_uuid, SUM(quantity) as total, COUNT(*) as entries
+			FROM entries
+			GROUP BY 1
+		), slots AS (
+			SELECT user_uuid, COUNT(*) as slots, AVG(first_minute - ` + slotStartCase("slot") + `)::float8 as minutes_after_open
+			FROM (
+				SELECT user_uuid, day, slot, MIN(minute) as first_minute
+				FROM entries
+				WHERE slot >= 0 AND slot < ?
+				GROUP BY 1, 2, 3
+			) as first_entries
+			GROUP BY 1
+		)
+		SELECT
+			u.uuid as user_uuid,
+			u.fullname,
+			u.role,
+			COALESCE(u.province_uuid, '') as province_uuid,
+			COALESCE(t.total, 0) as total,
+			COALESCE(t.entries, 0) as entries,
+			COALESCE(s.slots, 0) as slots,
+			COALESCE(s.minutes_after_open, 0) as minutes_after_open
+		FROM users u
+		LEFT JOIN totals t ON t.user_uuid = u.uuid
+		LEFT JOIN slots s ON s.user_uuid = u.uuid
+		WHERE t.user_uuid IS NOT NULL OR (u.status AND u.province_uuid IS NOT NULL` + userFilter + `)
+		ORDER BY u.fullname
+	`
+
+	args := append([]interface{}{from, to}, salesArgs...)
+	args = append(args, len(TimeSlots))
+	args = append(args, userArgs...)
+	var activity []UserActivity
+	err := r.db.Raw(query, args...).Scan(&activity).Error
+	return activity, err
+}
@@ -0,0 +1,273 @@
+package repository
+
+import (
+	"github.com/Danny19977/sr-api/events"
+	"github.com/Danny19977/sr-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GeographyRepository gives access to countries and provinces
+type GeographyRepository interface {
+	ListCountries(opts ListOptions, userUUID string) ([]models.Country, int64, error)
+	AllCountries() ([]models.Country, error)
+	FindCountry(uuid string) (*models.Country, error)
+	CreateCountry(country *models.Country) error
+	SaveCountry(country *models.Country) error
+	// SaveCalendar stores the fiscal calendar and the working days of
+	// country and publishes the change
+	SaveCalendar(country *models.Country) error
+	// Holidays returns the holidays of a country in year, every year when 0
+	Holidays(countryUUID string, year int) ([]models.Holiday, error)
+	FindHoliday(uuid string) (*models.Holiday, error)
+	// CreateHoliday and DeleteHoliday publish the change of the calendar
+	CreateHoliday(holiday *models.Holiday) error
+	DeleteHoliday(holiday *models.Holiday) error
+	DeleteCountry(country *models.Country) error
+
+	ListProvinces(opts ListOptions) ([]models.Province, int64, error)
+	AllProvinces() ([]models.Province, error)
+	ProvincesByCountry(countryUUID string) ([]models.Province, error)
+	// Provinces returns the provinces in uuids, or every province when uuids is empty
+	Provinces(uuids []string) ([]models.Province, error)
+	FindProvince(uuid string) (*models.Province, error)
+	FindProvinceByName(name string) (*models.Province, error)
+	CreateProvince(province *models.Province) error
+	SaveProvince(province *models.Province) error
+	DeleteProvince(province *models.Province) error
+	// SetProvinceBoundaries stores the GeoJSON outlines of provinces by UUID
+	// at once, clearing those set to an empty string
+	SetProvinceBoundaries(boundaries map[string]string) error
+}
+
+type geographyRepository struct {
+	db  *gorm.DB
+	bus *events.Bus
+}
+
+// NewGeographyRepository creates a GeographyRepository backed by db that
+// publishes calendar changes on bus
+func NewGeographyRepository(db *gorm.DB, bus *events.Bus) GeographyRepository {
+	return &geographyRepository{db: db, bus: bus}
+}
+
+// ListCountries pages through countries. When opts.ProvinceUUID is set the
+// caller is province-scoped and only sees the country of userUUID.
+func (r *geographyRepository) ListCountries(opts ListOptions, userUUID string) ([]models.Country, int64, error) {
+	var countries []models.Country
+	var totalRecords int64
+
+	query := r.db.Model(&models.Country{})
+	if opts.ProvinceUUID != nil {
+		query = query.Where("uuid IN (SELECT country_uuid FROM users WHERE uuid = ?)", userUUID)
+	}
+	query = query.Where("name ILIKE ?", "%"+opts.Search+"%")
+	if err := query.Count(&totalRecords).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := opts.paginate(query).Order("updated_at DESC").Find(&countries).Error
+	return countries, totalRecords, err
+}
+
+func (r *geographyRepository) AllCountries() ([]models.Country, error) {
+	var data []models.Country
+	err := r.db.Find(&data).Error
+	return data, err
+}
+
+func (r *geographyRepository) FindCountry(uuid string) (*models.Country, error) {
+	country := &models.Country{}
+	if err := first(r.db.Where("uuid = ?", uuid), country); err != nil {
+		return nil, err
+	}
+	return country, nil
+}
+
+// countryNode is the node mirroring country, a root of the tree
+func countryNode(country *models.Country) models.Territory {
+	return models.Territory{UUID: country.UUID, Level: models.TerritoryCountry, Name: country.Name}
+}
+
+// provinceNode is the node mirroring province, below its country
+func provinceNode(province *models.Province) models.Territory {
+	return models.Territory{UUID: province.UUID, ParentUUID: &province.CountryUUID, Level: models.TerritoryProvince, Name: province.Name}
+}
+
+func (r *geographyRepository) CreateCountry(country *models.Country) error {
+	return mirror(r.db, r.bus, func(tx *gorm.DB) error {
+		if err := tx.Create(country).Error; err != nil {
+			return err
+		}
+		return placeNode(tx, countryNode(country))
+	})
+}
+
+func (r *geographyRepository) SaveCountry(country *models.Country) error {
+	return mirror(r.db, r.bus, func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Save(country).Error; err != nil {
+			return err
+		}
+		return placeNode(tx, countryNode(country))
+	})
+}
+
+func (r *geographyRepository) SaveCalendar(country *models.Country) error {
+	err := r.db.Model(country).Select("fiscal_year_start", "fiscal_pattern", "fiscal_week_start", "working_days").Updates(country).Error
+	if err != nil {
+		return err
+	}
+
+	r.calendarChanged()
+	return nil
+}
+
+// calendarChanged publishes a change of the calendar of a country. Every
+// period and comparison may have moved, and dashboards mixing countries
+// merge their calendars, so nothing cached is left.
+func (r *geographyRepository) calendarChanged() {
+	r.bus.Publish(events.Event{Kind: events.CalendarChanged, Scopes: []events.Scope{{}}})
+}
+
+func (r *geographyRepository) Holidays(countryUUID string, year int) ([]models.Holiday, error) {
+	query := r.db.Where("country_uuid = ?", countryUUID)
+	if year != 0 {
+		query = query.Where("EXTRACT(YEAR FROM date) = ?", year)
+	}
+
+	var holidays []models.Holiday
+	err := query.Order("date").Find(&holidays).Error
+	return holidays, err
+}
+
+func (r *geographyRepository) FindHoliday(uuid string) (*models.Holiday, error) {
+	var holiday models.Holiday
+	if err := r.db.Where("uuid = ?", uuid).First(&holiday).Error; err != nil {
+		return nil, err
+	}
+	return &holiday, nil
+}
+
+func (r *geographyRepository) CreateHoliday(holiday *models.Holiday) error {
+	if err := r.db.Create(holiday).Error; err != nil {
+		return err
+	}
+	r.calendarChanged()
+	return nil
+}
+
+func (r *geographyRepository) DeleteHoliday(holiday *models.Holiday) error {
+	if err := r.db.Delete(holiday).Error; err != nil {
+		return err
+	}
+	r.calendarChanged()
+	return nil
+}
+
+func (r *geographyRepository) DeleteCountry(country *models.Country) error {
+	return mirror(r.db, r.bus, func(tx *gorm.DB) error {
+		if err := tx.Delete(country).Error; err != nil {
+			return err
+		}
+		return removeNode(tx, country.UUID)
+	})
+}
+
+// ListProvinces pages through provinces, restricted to opts.ProvinceUUID when set
+func (r *geographyRepository) ListProvinces(opts ListOptions) ([]models.Province, int64, error) {
+	var dataList []models.Province
+	var totalRecords int64
+
+	query := r.db.Model(&models.Province{})
+	if opts.ProvinceUUID != nil {
+		query = query.Where("uuid = ?", *opts.ProvinceUUID)
+	}
+	query = query.Where("name ILIKE ?", "%"+opts.Search+"%")
+	if err := query.Count(&totalRecords).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := opts.paginate(query).Order("updated_at DESC").Preload("Country").Preload("Users").Find(&dataList).Error
+	return dataList, totalRecords, err
+}
+
+func (r *geographyRepository) AllProvinces() ([]models.Province, error) {
+	var data []models.Province
+	err := r.db.Preload("Country").Preload("Users").Find(&data).Error
+	return data, err
+}
+
+func (r *geographyRepository) ProvincesByCountry(countryUUID string) ([]models.Province, error) {
+	var data []models.Province
+	err := r.db.Preload("Country").Preload("Users").Where("country_uuid = ?", countryUUID).Find(&data).Error
+	return data, err
+}
+
+func (r *geographyRepository) Provinces(uuids []string) ([]models.Province, error) {
+	var provinces []models.Province
+	query := r.db.Model(&models.Province{})
+	if len(uuids) > 0 {
+		query = query.Where("uuid IN ?", uuids)
+	}
+	err := query.Find(&provinces).Error
+	return provinces, err
+}
+
+func (r *geographyRepository) FindProvince(uuid string) (*models.Province, error) {
+	province := &models.Province{}
+	if err := first(r.db.Preload("Country").Preload("Users").Where("uuid = ?", uuid), province); err != nil {
+		return nil, err
+	}
+	return province, nil
+}
+
+func (r *geographyRepository) FindProvinceByName(name string) (*models.Province, error) {
+	province := &models.Province{}
+	if err := first(r.db.Preload("Country").Preload("Users").Where("name = ?", name), province); err != nil {
+		return nil, err
+	}
+	return province, nil
+}
+
+func (r *geographyRepository) CreateProvince(province *models.Province) error {
+	return mirror(r.db, r.bus, func(tx *gorm.DB) error {
+		if err := tx.Create(province).Error; err != nil {
+			return err
+		}
+		return placeNode(tx, provinceNode(province))
+	})
+}
+
+func (r *geographyRepository) SaveProvince(province *models.Province) error {
+	return mirror(r.db, r.bus, func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Save(province).Error; err != nil {
+			return err
+		}
+		return placeNode(tx, provinceNode(province))
+	})
+}
+
+func (r *geographyRepository) DeleteProvince(province *models.Province) error {
+	return mirror(r.db, r.bus, func(tx *gorm.DB) error {
+		if err := tx.Delete(province).Error; err != nil {
+			return err
+		}
+		return removeNode(tx, province.UUID)
+	})
+}
+
+func (r *geographyRepository) SetProvinceBoundaries(boundaries map[string]string) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		for uuid, boundary := range boundaries {
+			if err := tx.Model(&models.Province{}).Where("uuid = ?", uuid).Update("boundary", boundary).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	r.bus.Publish(events.Event{Kind: events.BoundaryChanged, Scopes: []events.Scope{{}}})
+	return nil
+}
@@ -0,0 +1,237 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/Danny19977/sr-api/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// NotificationListOptions filters an inbox
+type NotificationListOptions struct {
+	ListOptions
+
+	// UserUUID keeps the notifications of one recipient when set
+	UserUUID string
+	// Status keeps "read" or "unread" notifications when set
+	Status string
+	// Title keeps the notifications named exactly so when set
+	Title string
+	// Now hides the notifications expired at that time when set
+	Now time.Time
+}
+
+// Audience selects the active users a broadcast reaches. Empty fields do not
+// filter, so the zero Audience reaches everybody.
+type Audience struct {
+	Role         string `json:"role"`
+	ProvinceUUID string `json:"province_uuid"`
+	CountryUUID  string `json:"country_uuid"`
+}
+
+// NotificationRepository gives access to the inboxes and the notification preferences
+type NotificationRepository interface {
+	List(opts NotificationListOptions) ([]models.Notification, int64, error)
+	// UnreadCount counts the unread notifications of a user not expired at now
+	UnreadCount(userUUID string, now time.Time) (int64, error)
+	Find(uuid string) (*models.Notification, error)
+	// Create stores notifications, those without expiry expire after the configured TTL
+	Create(notifications ...*models.Notification) error
+	Save(notification *models.Notification) error
+	Delete(notification *models.Notification) error
+	// MarkRead marks the listed notifications of a user as read, all of them
+	// when uuids is empty, and returns how many changed
+	MarkRead(userUUID string, uuids []string, now time.Time) (int64, error)
+	// Broadcast copies notification to every user of audience who did not
+	// mute the inbox and returns the number of copies
+	Broadcast(notification models.Notification, audience Audience) (int64, error)
+	// Purge deletes the notifications expired at now
+	Purge(now time.Time) (int64, error)
+
+	// Preference returns the preferences of a user, the defaults when none were saved
+	Preference(userUUID string) (*models.NotificationPreference, error)
+	// Preferences returns the saved preferences of users by user UUID
+	Preferences(userUUIDs []string) (map[string]models.NotificationPreference, error)
+	SavePreference(preference *models.NotificationPreference) error
+}
+
+type notificationRepository struct {
+	db  *gorm.DB
+	ttl time.Duration
+}
+
+// NewNotificationRepository creates a NotificationRepository backed by db.
+// Notifications expire ttl after creation, never when ttl is 0.
+func NewNotificationRepository(db *gorm.DB, ttl time.Duration) NotificationRepository {
+	return &notificationRepository{db: db, ttl: ttl}
+}
+
+func (r *notificationRepository) List(opts NotificationListOptions) ([]models.Notification, int64, error) {
+	var notifications []models.Notification
+	var totalRecords int64
+
+	query := r.db.Model(&models.Notification{})
+	if opts.UserUUID != "" {
+		query = query.Where("user_uuid = ?", opts.UserUUID)
+	}
+	if opts.Status != "" {
+		query = query.Where("status = ?", opts.Status)
+	}
+	if !opts.Now.IsZero() {
+		query = query.Where("(expires_at IS NULL OR expires_at > ?)", opts.Now)
+	}
+	if opts.Title != "" {
+		query = query.Where("name = ?", opts.Title)
+	}
+	if opts.Search != "" {
+		query = query.Where("name ILIKE ?", "%"+opts.Search+"%")
+	}
+	if err := query.Count(&totalRecords).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := opts.paginate(query).Order("created_at DESC").Find(&notifications).Error
+	return notifications, totalRecords, err
+}
+
+func (r *notificationRepository) UnreadCount(userUUID string, now time.Time) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Notification{}).
+		Where("user_uuid = ? AND status = ?", userUUID, "unread").
+		Where("(expires_at IS NULL OR expires_at > ?)", now).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *notificationRepository) Find(uuid string) (*models.Notification, error) {
+	notification := &models.Notification{}
+	if err := first(r.db.Where("uuid = ?", uuid), notification); err != nil {
+		return nil, err
+	}
+	return notification, nil
+}
+
+func (r *notificationRepository) Create(notifications ...*models.Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+	for _, n := range notifications {
+		r.prepare(n)
+	}
+	return r.db.CreateInBatches(notifications, 500).Error
+}
+
+// prepare fills the defaults of a new notification
+func (r *notificationRepository) prepare(n *models.Notification) {
+	if n.UUID == "" {
+		n.UUID = uuid.New().String()
+	}
+	if n.Status == "" {
+		n.Status = "unread"
+	}
+	if n.ExpiresAt == nil && r.ttl > 0 {
+		expiresAt := time.Now().Add(r.ttl)
+		n.ExpiresAt = &expiresAt
+	}
+}
+
+func (r *notificationRepository) Save(notification *models.Notification) error {
+	return r.db.Save(notification).Error
+}
+
+func (r *notificationRepository) Delete(notification *models.Notification) error {
+	return r.db.Delete(notification).Error
+}
+
+func (r *notificationRepository) MarkRead(userUUID string, uuids []string, now time.Time) (int64, error) {
+	query := r.db.Model(&models.Notification{}).Where("user_uuid = ? AND status = ?", userUUID, "unread")
+	if len(uuids) > 0 {
+		query = query.Where("uuid IN ?", uuids)
+	}
+	result := query.Updates(map[string]interface{}{"status": "read", "read_at": now, "updated_at": now})
+	return result.RowsAffected, result.Error
+}
+
+func (r *notificationRepository) Broadcast(notification models.Notification, audience Audience) (int64, error) {
+	query := r.db.Model(&models.User{}).
+		Joins("LEFT JOIN notification_preferences ON notification_preferences.user_uuid = users.uuid").
+		Where("users.status = ?", true).
+		Where("notification_preferences.mute_in_app IS NOT TRUE")
+	if audience.Role != "" {
+		query = query.Where("users.role = ?", audience.Role)
+	}
+	if audience.ProvinceUUID != "" {
+		query = query.Where("users.province_uuid = ?", audience.ProvinceUUID)
+	}
+	if audience.CountryUUID != "" {
+		// Users of a province of the country belong to it as well
+		query = query.Where("(users.country_uuid = ? OR users.province_uuid IN (?))",
+			audience.CountryUUID, r.db.Model(&models.Province{}).Select("uuid").Where("country_uuid = ?", audience.CountryUUID))
+	}
+
+	var userUUIDs []string
+	if err := query.Pluck("users.uuid", &userUUIDs).Error; err != nil {
+		return 0, err
+	}
+	if len(userUUIDs) == 0 {
+		return 0, nil
+	}
+
+	broadcastUUID := uuid.New().String()
+	copies := make([]*models.Notification, len(userUUIDs))
+	for i, userUUID := range userUUIDs {
+		n := notification
+		n.UUID = ""
+		n.UserUUID = userUUID
+		n.BroadcastUUID = &broadcastUUID
+		r.prepare(&n)
+		copies[i] = &n
+	}
+
+	if err := r.db.CreateInBatches(copies, 500).Error; err != nil {
+		return 0, err
+	}
+	return int64(len(copies)), nil
+}
+
+func (r *notificationRepository) Purge(now time.Time) (int64, error) {
+	result := r.db.Where("expires_at <= ?", now).Delete(&models.Notification{})
+	return result.RowsAffected, result.Error
+}
+
+func (r *notificationRepository) Preference(userUUID string) (*models.NotificationPreference, error) {
+	preference := &models.NotificationPreference{}
+	err := first(r.db.Where("user_uuid = ?", userUUID), preference)
+	if err == ErrNotFound {
+		return &models.NotificationPreference{UserUUID: userUUID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return preference, nil
+}
+
+func (r *notificationRepository) Preferences(userUUIDs []string) (map[string]models.NotificationPreference, error) {
+	preferences := make(map[string]models.NotificationPreference)
+	if len(userUUIDs) == 0 {
+		return preferences, nil
+	}
+
+	var rows []models.NotificationPreference
+	if err := r.db.Where("user_uuid IN ?", userUUIDs).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		preferences[row.UserUUID] = row
+	}
+	return preferences, nil
+}
+
+func (r *notificationRepository) SavePreference(preference *models.NotificationPreference) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_uuid"}},
+		DoUpdates: clause.AssignmentColumns([]string{"mute_in_app", "mute_email", "updated_at"}),
+	}).Create(preference).Error
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"encoding/json"
+
+	"github.com/Danny19977/sr-api/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// enqueue writes one outbox event of eventType per payload within tx, so the
+// events are delivered if and only if the change that raised them commits
+func enqueue(tx *gorm.DB, eventType string, payloads ...interface{}) error {
+	if len(payloads) == 0 {
+		return nil
+	}
+
+	rows := make([]models.OutboxEvent, len(payloads))
+	for i, payload := range payloads {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		rows[i] = models.OutboxEvent{UUID: uuid.New().String(), Type: eventType, Payload: data}
+	}
+	return tx.CreateInBatches(rows, 500).Error
+}
+
+// targetEvent is the target.updated payload of a year, month or week target
+func targetEvent(action string, target interface{}) models.TargetEvent {
+	switch t := target.(type) {
+	case *models.Year:
+		return models.TargetEvent{Level: "year", Action: action, UUID: t.UUID, Label: t.Year, Quantity: t.Quantity}
+	case *models.Month:
+		return models.TargetEvent{Level: "month", Action: action, UUID: t.UUID, Label: t.Month, Quantity: t.Quantity,
+			CountryUUID: t.CountryUUID, ProvinceUUID: t.ProvinceUUID, ProductUUID: t.ProductUUID, YearUUID: t.YearUUID}
+	case *models.Week:
+		return models.TargetEvent{Level: "week", Action: action, UUID: t.UUID, Label: t.Week, Quantity: t.Quantity,
+			CountryUUID: t.CountryUUID, ProvinceUUID: t.ProvinceUUID, ProductUUID: t.ProductUUID, YearUUID: t.YearUUID}
+	}
+	return models.TargetEvent{Action: action}
+}
@@ -0,0 +1,206 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/Danny19977/sr-api/events"
+	"github.com/Danny19977/sr-api/geo"
+	"github.com/Danny19977/sr-api/models"
+	"gorm.io/gorm"
+)
+
+// ErrOutletInUse is returned when deleting an outlet sales were made at
+var ErrOutletInUse = errors.New("an outlet with sales cannot be deleted")
+
+// OutletFilter narrows an outlet search
+type OutletFilter struct {
+	ListOptions
+	// ProvinceUUIDs restricts the outlets to these provinces when set
+	ProvinceUUIDs []string
+	Type          string
+	// Near and RadiusKm keep the outlets within RadiusKm of Near, the
+	// closest first
+	Near     *geo.Point
+	RadiusKm float64
+	// Box keeps the outlets inside it when set
+	Box *geo.Box
+}
+
+// OutletSales is what an outlet sold over a period
+type OutletSales struct {
+	models.Outlet
+	Total   int64 `json:"total"`
+	Entries int64 `json:"entries"`
+}
+
+// OutletRepository gives access to the points of sale. Writes mirror the
+// outlets into the territory tree.
+type OutletRepository interface {
+	List(filter OutletFilter) ([]models.Outlet, int64, error)
+	Find(uuid string) (*models.Outlet, error)
+	Create(outlet *models.Outlet) error
+	Save(outlet *models.Outlet) error
+	Delete(outlet *models.Outlet) error
+	// Sales returns the outlets matching filter, paging aside, with what
+	// they sold from rg.From to rg.To. Outlets without sales are kept.
+	Sales(rg TimeRange, filter OutletFilter) ([]OutletSales, error)
+}
+
+type outletRepository struct {
+	db  *gorm.DB
+	bus *events.Bus
+}
+
+// NewOutletRepository creates an OutletRepository backed by db that publishes
+// the changes of the territory tree on bus
+func NewOutletRepository(db *gorm.DB, bus *events.Bus) OutletRepository {
+	return &outletRepository{db: db, bus: bus}
+}
+
+// distanceSQL is the great circle distance in kilometres from a point, bound
+// as its latitude twice then its longitude, to the position of an outlet
+const distanceSQL = "(2 * 6371 * ASIN(LEAST(1, SQRT(POWER(SIN(RADIANS(outlets.latitude - ?) / 2), 2) + " +
+	"COS(RADIANS(?)) * COS(RADIANS(outlets.latitude)) * POWER(SIN(RADIANS(outlets.longitude - ?) / 2), 2)))))"
+
+// where applies filter, paging aside, to a query on outlets
+func (f OutletFilter) where(query *gorm.DB) *gorm.DB {
+	if len(f.ProvinceUUIDs) > 0 {
+		query = query.Where("outlets.province_uuid IN ?", f.ProvinceUUIDs)
+	}
+	if f.Search != "" {
+		query = query.Where("(outlets.name ILIKE ? OR outlets.owner_name ILIKE ?)", "%"+f.Search+"%", "%"+f.Search+"%")
+	}
+	if f.Type != "" {
+		query = query.Where("outlets.type = ?", f.Type)
+	}
+	if f.Box != nil {
+		query = query.Where("outlets.latitude BETWEEN ? AND ? AND outlets.longitude BETWEEN ? AND ?",
+			f.Box.MinLatitude, f.Box.MaxLatitude, f.Box.MinLongitude, f.Box.MaxLongitude)
+	}
+	if f.Near != nil {
+		// The box around the circle narrows the search on the position index
+		box := geo.Around(*f.Near, f.RadiusKm)
+		query = query.Where("outlets.latitude BETWEEN ? AND ? AND outlets.longitude BETWEEN ? AND ?",
+			box.MinLatitude, box.MaxLatitude, box.MinLongitude, box.MaxLongitude).
+			Where(distanceSQL+" <= ?", f.Near.Latitude, f.Near.Latitude, f.Near.Longitude, f.RadiusKm)
+	}
+	return query
+}
+
+// order sorts the closest outlets first around Near, the latest otherwise
+func (f OutletFilter) order(query *gorm.DB) *gorm.DB {
+	if f.Near != nil {
+		return query.Order(gorm.Expr(distanceSQL, f.Near.Latitude, f.Near.Latitude, f.Near.Longitude))
+	}
+	return query.Order("outlets.updated_at DESC")
+}
+
+func (r *outletRepository) List(filter OutletFilter) ([]models.Outlet, int64, error) {
+	var outlets []models.Outlet
+	var totalRecords int64
+
+	query := filter.where(r.db.Model(&models.Outlet{}))
+	if err := query.Count(&totalRecords).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := filter.paginate(filter.order(query)).Preload("Province").Find(&outlets).Error
+	return outlets, totalRecords, err
+}
+
+func (r *outletRepository) Find(uuid string) (*models.Outlet, error) {
+	outlet := &models.Outlet{}
+	if err := first(r.db.Preload("Province").Where("uuid = ?", uuid), outlet); err != nil {
+		return nil, err
+	}
+	return outlet, nil
+}
+
+// placeOutlet mirrors outlet into the tree below its district while it
+// exists, otherwise below its province
+func placeOutlet(tx *gorm.DB, outlet *models.Outlet) error {
+	parent := outlet.ProvinceUUID
+	if outlet.TerritoryUUID != nil {
+		var districts int64
+		err := tx.Model(&models.Territory{}).
+			Where("uuid = ? AND level = ?", *outlet.TerritoryUUID, models.TerritoryDistrict).
+			Count(&districts).Error
+		if err != nil {
+			return err
+		}
+		if districts > 0 {
+			parent = *outlet.TerritoryUUID
+		}
+	}
+	return placeNode(tx, models.Territory{UUID: outlet.UUID, ParentUUID: &parent, Level: models.TerritoryOutlet, Name: outlet.Name})
+}
+
+func (r *outletRepository) Create(outlet *models.Outlet) error {
+	return mirror(r.db, r.bus, func(tx *gorm.DB) error {
+		if err := tx.Omit("Province").Create(outlet).Error; err != nil {
+			return err
+		}
+		return placeOutlet(tx, outlet)
+	})
+}
+
+func (r *outletRepository) Save(outlet *models.Outlet) error {
+	return mirror(r.db, r.bus, func(tx *gorm.DB) error {
+		if err := tx.Omit("Province").Save(outlet).Error; err != nil {
+			return err
+		}
+		return placeOutlet(tx, outlet)
+	})
+}
+
+func (r *outletRepository) Delete(outlet *models.Outlet) error {
+	var sales int64
+	if err := r.db.Model(&models.Sale{}).Where("outlet_uuid = ?", outlet.UUID).Count(&sales).Error; err != nil {
+		return err
+	}
+	if sales > 0 {
+		return ErrOutletInUse
+	}
+	return mirror(r.db, r.bus, func(tx *gorm.DB) error {
+		if err := tx.Delete(outlet).Error; err != nil {
+			return err
+		}
+		return removeNode(tx, outlet.UUID)
+	})
+}
+
+func (r *outletRepository) Sales(rg TimeRange, filter OutletFilter) ([]OutletSales, error) {
+	type outletTotal struct {
+		OutletUUID string
+		Total      int64
+		Entries    int64
+	}
+
+	var outlets []models.Outlet
+	if err := filter.where(r.db.Model(&models.Outlet{})).Find(&outlets).Error; err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string]outletTotal)
+	if len(outlets) > 0 {
+		var rows []outletTotal
+		err := filter.where(r.db.Model(&models.Sale{}).
+			Select("sales.outlet_uuid, COALESCE(SUM(sales.quantity), 0) AS total, COUNT(*) AS entries").
+			Joins("JOIN outlets ON outlets.uuid = sales.outlet_uuid").
+			Where("sales.created_at BETWEEN ? AND ?", rg.From, rg.To)).
+			Group("sales.outlet_uuid").
+			Scan(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			totals[row.OutletUUID] = row
+		}
+	}
+
+	result := make([]OutletSales, len(outlets))
+	for i, outlet := range outlets {
+		result[i] = OutletSales{Outlet: outlet, Total: totals[outlet.UUID].Total, Entries: totals[outlet.UUID].Entries}
+	}
+	return result, nil
+}
@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/Danny19977/sr-api/models"
+	"gorm.io/gorm"
+)
+
+// ReportListOptions filters the report subscriptions
+type ReportListOptions struct {
+	ListOptions
+
+	// OwnerUUID keeps the subscriptions of one user when set
+	OwnerUUID string
+}
+
+// ReportRepository stores the report subscriptions and their runs
+type ReportRepository interface {
+	List(opts ReportListOptions) ([]models.ReportSubscription, int64, error)
+	Find(uuid string) (*models.ReportSubscription, error)
+	Create(subscription *models.ReportSubscription) error
+	Save(subscription *models.ReportSubscription) error
+	// Delete removes a subscription with its runs
+	Delete(subscription *models.ReportSubscription) error
+
+	// Due returns the active subscriptions whose next run is at or before now
+	Due(now time.Time) ([]models.ReportSubscription, error)
+	// Claim moves the next run of subscription to next and reports whether
+	// this caller won the run, concurrent schedulers lose it
+	Claim(subscription *models.ReportSubscription, next *time.Time, now time.Time) (bool, error)
+
+	CreateRun(run *models.ReportRun) error
+	SaveRun(run *models.ReportRun) error
+	// Runs lists the runs of a subscription without their file, latest first
+	Runs(subscriptionUUID string, opts ListOptions) ([]models.ReportRun, int64, error)
+	// FindRun returns a run with its file
+	FindRun(uuid string) (*models.ReportRun, error)
+}
+
+type reportRepository struct {
+	db *gorm.DB
+}
+
+// NewReportRepository creates a ReportRepository backed by db
+func NewReportRepository(db *gorm.DB) ReportRepository {
+	return &reportRepository{db: db}
+}
+
+func (r *reportRepository) List(opts ReportListOptions) ([]models.ReportSubscription, int64, error) {
+	var subscriptions []models.ReportSubscription
+	var totalRecords int64
+
+	query := r.db.Model(&models.ReportSubscription{})
+	if opts.OwnerUUID != "" {
+		query = query.Where("owner_uuid = ?", opts.OwnerUUID)
+	}
+	if opts.Search != "" {
+		query = query.Where("name ILIKE ?", "%"+opts.Search+"%")
+	}
+	if err := query.Count(&totalRecords).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := opts.paginate(query).Order("updated_at DESC").Find(&subscriptions).Error
+	return subscriptions, totalRecords, err
+}
+
+func (r *reportRepository) Find(uuid string) (*models.ReportSubscription, error) {
+	subscription := &models.ReportSubscription{}
+	if err := first(r.db.Where("uuid = ?", uuid), subscription); err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+func (r *reportRepository) Create(subscription *models.ReportSubscription) error {
+	return r.db.Create(subscription).Error
+}
+
+func (r *reportRepository) Save(subscription *models.ReportSubscription) error {
+	return r.db.Save(subscription).Error
+}
+
+func (r *reportRepository) Delete(subscription *models.ReportSubscription) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("subscription_uuid = ?", subscription.UUID).Delete(&models.ReportRun{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(subscription).Error
+	})
+}
+
+func (r *reportRepository) Due(now time.Time) ([]models.ReportSubscription, error) {
+	var subscriptions []models.ReportSubscription
+	err := r.db.Where("active = ? AND next_run_at <= ?", true, now).Order("next_run_at").Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+func (r *reportRepository) Claim(subscription *models.ReportSubscription, next *time.Time, now time.Time) (bool, error) {
+	result := r.db.Model(&models.ReportSubscription{}).
+		Where("uuid = ? AND next_run_at = ?", subscription.UUID, subscription.NextRunAt).
+		Updates(map[string]interface{}{"next_run_at": next, "last_run_at": now})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	subscription.NextRunAt, subscription.LastRunAt = next, &now
+	return true, nil
+}
+
+func (r *reportRepository) CreateRun(run *models.ReportRun) error {
+	return r.db.Create(run).Error
+}
+
+func (r *reportRepository) SaveRun(run *models.ReportRun) error {
+	return r.db.Save(run).Error
+}
+
+func (r *reportRepository) Runs(subscriptionUUID string, opts ListOptions) ([]models.ReportRun, int64, error) {
+	var runs []models.ReportRun
+	var totalRecords int64
+
+	query := r.db.Model(&models.ReportRun{}).Where("subscription_uuid = ?", subscriptionUUID)
+	if err := query.Count(&totalRecords).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := opts.paginate(query).Omit("output").Order("started_at DESC").Find(&runs).Error
+	return runs, totalRecords, err
+}
+
+func (r *reportRepository) FindRun(uuid string) (*models.ReportRun, error) {
+	run := &models.ReportRun{}
+	if err := first(r.db.Where("uuid = ?", uuid), run); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
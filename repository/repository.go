@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// ErrNotFound is returned when a lookup by key matches no row
+var ErrNotFound = errors.New("record not found")
+
+// ListOptions holds the search, paging and scope parameters of list queries
+type ListOptions struct {
+	Search string
+	Offset int
+	Limit  int
+
+	// ProvinceUUID restricts the result to one province when set
+	ProvinceUUID *string
+	// ProvinceUUIDs restricts the result to these provinces when not nil
+	ProvinceUUIDs []string
+	// UserUUIDs restricts the result to these users, or to their sales, when
+	// not nil
+	UserUUIDs []string
+}
+
+func (o ListOptions) paginate(query *gorm.DB) *gorm.DB {
+	if o.Offset > 0 {
+		query = query.Offset(o.Offset)
+	}
+	if o.Limit > 0 {
+		query = query.Limit(o.Limit)
+	}
+	return query
+}
+
+// first runs query into dest and maps a missing row to ErrNotFound
+func first(query *gorm.DB, dest interface{}) error {
+	result := query.Limit(1).Find(dest)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
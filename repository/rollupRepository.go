@@ -0,0 +1,98 @@
+package repository
+
+import "gorm.io/gorm"
+
+// RollupRepository maintains the pre-aggregated sales tables read by the
+// historical dashboards. Sales written through the SaleRepository update
+// the rollups in the same transaction; Rebuild recomputes them from scratch.
+type RollupRepository interface {
+	// Rebuild recomputes the rollups of the UTC years listed, or of every year when empty
+	Rebuild(years []int) error
+}
+
+type rollupRepository struct {
+	db *gorm.DB
+}
+
+// NewRollupRepository creates a RollupRepository backed by db
+func NewRollupRepository(db *gorm.DB) RollupRepository {
+	return &rollupRepository{db: db}
+}
+
+// rollup describes how a rollup table aggregates the sales
+type rollup struct {
+	table string
+	// keys are the primary key columns of the table
+	keys string
+	// columns compute the keys from a row of the sales table
+	columns string
+	// year is the UTC year of a row of the table
+	year string
+}
+
+func rollups() []rollup {
+	return []rollup{
+		{
+			table: "sales_daily_rollups",
+			keys:  "day, province_uuid, product_uuid, slot",
+			columns: "(created_at AT TIME ZONE 'UTC')::date, province_uuid, product_uuid, " +
+				slotCase("EXTRACT(HOUR FROM created_at AT TIME ZONE 'UTC')", 1),
+			year: "EXTRACT(YEAR FROM day)::int",
+		},
+		{
+			table: "sales_monthly_rollups",
+			keys:  "year, month, province_uuid, product_uuid",
+			columns: "EXTRACT(YEAR FROM created_at AT TIME ZONE 'UTC')::int, " +
+				"EXTRACT(MONTH FROM created_at AT TIME ZONE 'UTC')::int, province_uuid, product_uuid",
+			year: "year",
+		},
+	}
+}
+
+// applySales adds the sales matching where, multiplied by sign, to every
+// rollup. Keys whose sales are all removed keep a zero row until the next
+// rebuild.
+func applySales(tx *gorm.DB, sign int64, where string, args ...interface{}) error {
+	for _, r := range rollups() {
+		query := `
+			INSERT INTO ` + r.table + ` (` + r.keys + `, quantity, entries)
+			SELECT ` + r.columns + `, CAST(? * SUM(quantity) AS bigint), CAST(? * COUNT(*) AS bigint)
+			FROM sales
+			WHERE ` + where + `
+			GROUP BY 1, 2, 3, 4
+			ON CONFLICT (` + r.keys + `) DO UPDATE SET
+				quantity = ` + r.table + `.quantity + EXCLUDED.quantity,
+				entries = ` + r.table + `.entries + EXCLUDED.entries
+		`
+		if err := tx.Exec(query, append([]interface{}{sign, sign}, args...)...).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *rollupRepository) Rebuild(years []int) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// Hold off sale writes so no delta lands between the delete and the insert
+		if err := tx.Exec("LOCK TABLE sales IN SHARE MODE").Error; err != nil {
+			return err
+		}
+
+		where, args := "TRUE", []interface{}(nil)
+		if len(years) > 0 {
+			where, args = yearBounds(years)
+		}
+
+		for _, r := range rollups() {
+			query, deleteArgs := "DELETE FROM "+r.table, []interface{}(nil)
+			if len(years) > 0 {
+				query, deleteArgs = query+" WHERE "+r.year+" IN ?", []interface{}{years}
+			}
+			if err := tx.Exec(query, deleteArgs...).Error; err != nil {
+				return err
+			}
+		}
+
+		return applySales(tx, 1, where, args...)
+	})
+}
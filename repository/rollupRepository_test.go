@@ -0,0 +1,79 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Danny19977/sr-api/apptest"
+	"github.com/Danny19977/sr-api/models"
+	"github.com/google/uuid"
+)
+
+// monthlyRollups returns the non-empty monthly rollup rows ordered by key
+func monthlyRollups(t *testing.T, env *apptest.Env) []models.SalesMonthlyRollup {
+	t.Helper()
+
+	var rows []models.SalesMonthlyRollup
+	err := env.App.DB.Where("entries > 0").
+		Order("year, month, province_uuid, product_uuid").
+		Find(&rows).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func TestRollupsFollowSaleWrites(t *testing.T) {
+	env := apptest.New(t)
+	sales := env.App.Sales
+
+	province, product := uuid.New().String(), uuid.New().String()
+	newSale := func(createdAt time.Time, quantity int64) *models.Sale {
+		sale := &models.Sale{
+			UUID:         uuid.New().String(),
+			CreatedAt:    createdAt,
+			ProvinceUUID: province,
+			ProductUUID:  product,
+			UserUUID:     uuid.New().String(),
+			Quantity:     quantity,
+		}
+		if err := sales.Create(sale); err != nil {
+			t.Fatal(err)
+		}
+		return sale
+	}
+
+	january := time.Date(2024, time.January, 15, 9, 0, 0, 0, time.UTC)
+	kept := newSale(january, 10)
+	newSale(january.AddDate(0, 0, 1), 5)
+	deleted := newSale(january.AddDate(0, 1, 0), 7)
+
+	kept.Quantity = 12
+	if err := sales.Save(kept); err != nil {
+		t.Fatal(err)
+	}
+	if err := sales.Delete(deleted); err != nil {
+		t.Fatal(err)
+	}
+
+	incremental := monthlyRollups(t, env)
+	if len(incremental) != 1 || incremental[0].Quantity != 17 || incremental[0].Entries != 2 {
+		t.Fatalf("incremental rollups = %+v, want one January row of 17 over 2 sales", incremental)
+	}
+
+	var daily []models.SalesDailyRollup
+	if err := env.App.DB.Where("entries > 0").Find(&daily).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(daily) != 2 {
+		t.Errorf("got %d daily rollups, want 2", len(daily))
+	}
+
+	if err := env.App.Rollups.Rebuild(nil); err != nil {
+		t.Fatal(err)
+	}
+	rebuilt := monthlyRollups(t, env)
+	if len(rebuilt) != len(incremental) || rebuilt[0] != incremental[0] {
+		t.Errorf("rebuilt rollups = %+v, want %+v", rebuilt, incremental)
+	}
+}
@@ -0,0 +1,268 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/Danny19977/sr-api/events"
+	"github.com/Danny19977/sr-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SaleRepository gives access to the sales aggregate
+type SaleRepository interface {
+	List(opts ListOptions) ([]models.Sale, int64, error)
+	// Each passes every sale matching opts to fn in batches of batchSize,
+	// ignoring the offset and limit, so exports never hold them all
+	Each(opts ListOptions, batchSize int, fn func(sales []models.Sale) error) error
+	All() ([]models.Sale, error)
+	ByProvince(provinceUUID string) ([]models.Sale, error)
+	FindByUUID(uuid string) (*models.Sale, error)
+	// Recent returns the time and quantity of the unflagged sales of a
+	// province and product in [from, to), the baseline of the anomaly checks
+	Recent(provinceUUID, productUUID string, from, to time.Time) ([]models.Sale, error)
+	// Flagged returns the flagged sales made in [from, to) in provinceUUIDs
+	// (all provinces when empty), oldest first
+	Flagged(from, to time.Time, provinceUUIDs []string) ([]models.Sale, error)
+	// GeofenceFailures returns the sales made in [from, to) in provinceUUIDs
+	// (all provinces when empty) whose geofence status is one of statuses,
+	// oldest first
+	GeofenceFailures(from, to time.Time, statuses, provinceUUIDs []string) ([]models.Sale, error)
+	Create(sale *models.Sale) error
+	CreateBatch(sales []models.Sale, batchSize int) error
+	Save(sale *models.Sale) error
+	Delete(sale *models.Sale) error
+}
+
+type saleRepository struct {
+	db  *gorm.DB
+	bus *events.Bus
+}
+
+// NewSaleRepository creates a SaleRepository backed by db that publishes
+// committed writes on bus
+func NewSaleRepository(db *gorm.DB, bus *events.Bus) SaleRepository {
+	return &saleRepository{db: db, bus: bus}
+}
+
+func (r *saleRepository) withRelations(query *gorm.DB) *gorm.DB {
+	return query.Preload("Province").Preload("Product").Preload("User.Country").Preload("User.Province").Preload("Year").Preload("Month").Preload("Week")
+}
+
+// filter applies the search and the province scope of opts
+func (r *saleRepository) filter(opts ListOptions) *gorm.DB {
+	query := r.db.Model(&models.Sale{})
+	if opts.ProvinceUUID != nil {
+		query = query.Where("province_uuid = ?", *opts.ProvinceUUID)
+	}
+	if opts.ProvinceUUIDs != nil {
+		query = query.Where("province_uuid IN ?", opts.ProvinceUUIDs)
+	}
+	if opts.UserUUIDs != nil {
+		query = query.Where("user_uuid IN ?", opts.UserUUIDs)
+	}
+	return query.Where("user_uuid ILIKE ?", "%"+opts.Search+"%")
+}
+
+func (r *saleRepository) List(opts ListOptions) ([]models.Sale, int64, error) {
+	var dataList []models.Sale
+	var totalRecords int64
+
+	query := r.filter(opts)
+	if err := query.Count(&totalRecords).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := r.withRelations(opts.paginate(query)).Order("updated_at DESC").Find(&dataList).Error
+	return dataList, totalRecords, err
+}
+
+func (r *saleRepository) Each(opts ListOptions, batchSize int, fn func(sales []models.Sale) error) error {
+	var batch []models.Sale
+	return r.withRelations(r.filter(opts)).FindInBatches(&batch, batchSize, func(tx *gorm.DB, _ int) error {
+		return fn(batch)
+	}).Error
+}
+
+func (r *saleRepository) All() ([]models.Sale, error) {
+	var data []models.Sale
+	err := r.withRelations(r.db).Find(&data).Error
+	return data, err
+}
+
+func (r *saleRepository) ByProvince(provinceUUID string) ([]models.Sale, error) {
+	var data []models.Sale
+	err := r.withRelations(r.db).Where("province_uuid = ?", provinceUUID).Find(&data).Error
+	return data, err
+}
+
+func (r *saleRepository) FindByUUID(uuid string) (*models.Sale, error) {
+	sale := &models.Sale{}
+	if err := first(r.withRelations(r.db).Where("uuid = ?", uuid), sale); err != nil {
+		return nil, err
+	}
+	return sale, nil
+}
+
+func (r *saleRepository) Recent(provinceUUID, productUUID string, from, to time.Time) ([]models.Sale, error) {
+	var data []models.Sale
+	err := r.db.Select("uuid", "created_at", "quantity").
+		Where("province_uuid = ? AND product_uuid = ? AND NOT flagged", provinceUUID, productUUID).
+		Where("created_at >= ? AND created_at < ?", from, to).
+		Find(&data).Error
+	return data, err
+}
+
+func (r *saleRepository) Flagged(from, to time.Time, provinceUUIDs []string) ([]models.Sale, error) {
+	var data []models.Sale
+	query := r.withRelations(r.db).Where("flagged AND created_at >= ? AND created_at < ?", from, to)
+	if len(provinceUUIDs) > 0 {
+		query = query.Where("province_uuid IN ?", provinceUUIDs)
+	}
+	err := query.Order("created_at").Find(&data).Error
+	return data, err
+}
+
+func (r *saleRepository) GeofenceFailures(from, to time.Time, statuses, provinceUUIDs []string) ([]models.Sale, error) {
+	var data []models.Sale
+	query := r.withRelations(r.db).Preload("Outlet").
+		Where("geofence_status IN ? AND created_at >= ? AND created_at < ?", statuses, from, to)
+	if len(provinceUUIDs) > 0 {
+		query = query.Where("province_uuid IN ?", provinceUUIDs)
+	}
+	err := query.Order("created_at").Find(&data).Error
+	return data, err
+}
+
+// The writes below keep the rollup tables in step and queue their webhook
+// event within the same transaction, and publish an event once it is committed
+
+func (r *saleRepository) Create(sale *models.Sale) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(sale).Error; err != nil {
+			return err
+		}
+		if err := applySales(tx, 1, "uuid = ?", sale.UUID); err != nil {
+			return err
+		}
+		return enqueue(tx, models.EventSaleCreated, models.NewSaleEvent(sale))
+	})
+	if err != nil {
+		return err
+	}
+
+	r.bus.Publish(events.Event{Kind: events.SaleCreated, Scopes: []events.Scope{events.SaleScope(sale)}, Sale: sale})
+	return nil
+}
+
+func (r *saleRepository) CreateBatch(sales []models.Sale, batchSize int) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		for start := 0; start < len(sales); start += batchSize {
+			batch := sales[start:min(start+batchSize, len(sales))]
+			if err := tx.Create(&batch).Error; err != nil {
+				return err
+			}
+
+			uuids := make([]string, len(batch))
+			payloads := make([]interface{}, len(batch))
+			for i := range batch {
+				uuids[i] = batch[i].UUID
+				payloads[i] = models.NewSaleEvent(&batch[i])
+			}
+			if err := applySales(tx, 1, "uuid IN ?", uuids); err != nil {
+				return err
+			}
+			if err := enqueue(tx, models.EventSaleCreated, payloads...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// One scope per province spanning its imported sales
+	index := make(map[string]int)
+	var scopes []events.Scope
+	for i := range sales {
+		scope := events.SaleScope(&sales[i])
+		j, ok := index[scope.ProvinceUUID]
+		if !ok {
+			index[scope.ProvinceUUID] = len(scopes)
+			scopes = append(scopes, scope)
+			continue
+		}
+		if scope.From.Before(scopes[j].From) {
+			scopes[j].From = scope.From
+		}
+		if scope.To.After(scopes[j].To) {
+			scopes[j].To = scope.To
+		}
+	}
+	r.bus.Publish(events.Event{Kind: events.SalesImported, Scopes: scopes})
+	return nil
+}
+
+// lockStored loads and locks the stored row of sale
+func lockStored(tx *gorm.DB, sale *models.Sale) (*models.Sale, error) {
+	stored := &models.Sale{}
+	if err := first(tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("uuid = ?", sale.UUID), stored); err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+func (r *saleRepository) Save(sale *models.Sale) error {
+	var previous *models.Sale
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the stored row so its previous values are removed exactly once
+		var err error
+		if previous, err = lockStored(tx, sale); err != nil {
+			return err
+		}
+		if err := applySales(tx, -1, "uuid = ?", sale.UUID); err != nil {
+			return err
+		}
+		if err := tx.Omit(clause.Associations).Save(sale).Error; err != nil {
+			return err
+		}
+		if err := applySales(tx, 1, "uuid = ?", sale.UUID); err != nil {
+			return err
+		}
+		return enqueue(tx, models.EventSaleUpdated, models.NewSaleEvent(sale))
+	})
+	if err != nil {
+		return err
+	}
+
+	r.bus.Publish(events.Event{
+		Kind:   events.SaleUpdated,
+		Scopes: []events.Scope{events.SaleScope(previous), events.SaleScope(sale)},
+		Sale:   sale,
+	})
+	return nil
+}
+
+func (r *saleRepository) Delete(sale *models.Sale) error {
+	var stored *models.Sale
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if stored, err = lockStored(tx, sale); err != nil {
+			return err
+		}
+		if err := applySales(tx, -1, "uuid = ?", sale.UUID); err != nil {
+			return err
+		}
+		if err := tx.Delete(stored).Error; err != nil {
+			return err
+		}
+		return enqueue(tx, models.EventSaleDeleted, models.NewSaleEvent(stored))
+	})
+	if err != nil {
+		return err
+	}
+
+	r.bus.Publish(events.Event{Kind: events.SaleDeleted, Scopes: []events.Scope{events.SaleScope(stored)}, Sale: stored})
+	return nil
+}
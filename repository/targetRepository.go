@@ -0,0 +1,342 @@
+package repository
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Danny19977/sr-api/events"
+	"github.com/Danny19977/sr-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MonthNames are the month labels stored in models.Month
+var MonthNames = []string{"January", "February", "March", "April", "May", "June",
+	"July", "August", "September", "October", "November", "December"}
+
+// TargetRepository gives access to the yearly, monthly and weekly targets
+type TargetRepository interface {
+	ListYears(opts ListOptions) ([]models.Year, int64, error)
+	AllYears() ([]models.Year, error)
+	FindYear(uuid string) (*models.Year, error)
+	// FindYearByNumber returns the target year labelled year, e.g. "2025"
+	FindYearByNumber(year string) (*models.Year, error)
+	CreateYear(year *models.Year) error
+	SaveYear(year *models.Year) error
+	DeleteYear(year *models.Year) error
+
+	ListMonths(opts ListOptions) ([]models.Month, int64, error)
+	AllMonths() ([]models.Month, error)
+	FindMonth(uuid string) (*models.Month, error)
+	FindMonthByName(month string) (*models.Month, error)
+	CreateMonth(month *models.Month) error
+	SaveMonth(month *models.Month) error
+	DeleteMonth(month *models.Month) error
+
+	ListWeeks(opts ListOptions) ([]models.Week, int64, error)
+	AllWeeks() ([]models.Week, error)
+	FindWeek(uuid string) (*models.Week, error)
+	FindWeekByNumber(week string) (*models.Week, error)
+	CreateWeek(week *models.Week) error
+	SaveWeek(week *models.Week) error
+	DeleteWeek(week *models.Week) error
+
+	// MonthlyTarget returns the target of a province for a month (1-12), 0 when none is set
+	MonthlyTarget(provinceUUID string, year int, month int) (int64, error)
+	// WeeklyTarget returns the target of a province for an ISO week, 0 when none is set
+	WeeklyTarget(provinceUUID string, year int, week int) (int64, error)
+	// WeeklyTargets returns the week rows of every province in provinceUUIDs
+	// (all provinces when empty) for an ISO week
+	WeeklyTargets(year int, week int, provinceUUIDs []string) ([]models.Week, error)
+}
+
+type targetRepository struct {
+	db  *gorm.DB
+	bus *events.Bus
+}
+
+// NewTargetRepository creates a TargetRepository backed by db that publishes
+// committed writes on bus
+func NewTargetRepository(db *gorm.DB, bus *events.Bus) TargetRepository {
+	return &targetRepository{db: db, bus: bus}
+}
+
+// yearScope is the scope of a target of provinceUUID (every province when
+// empty) for the year labelled label, all time when the label is no year.
+// Fiscal years are named after the year they end in, so the scope runs from
+// the previous January to the first days of the next year, past the end of
+// retail years.
+func yearScope(provinceUUID, label string) events.Scope {
+	scope := events.Scope{ProvinceUUID: provinceUUID}
+	if year, err := strconv.Atoi(label); err == nil {
+		scope.From = time.Date(year-1, 1, 1, 0, 0, 0, 0, time.UTC)
+		scope.To = time.Date(year+1, 1, 8, 0, 0, 0, 0, time.UTC).Add(-time.Nanosecond)
+	}
+	return scope
+}
+
+// targetScope is the scope of a month or week target of provinceUUID in the
+// target year yearUUID
+func (r *targetRepository) targetScope(provinceUUID, yearUUID string) events.Scope {
+	var label string
+	r.db.Model(&models.Year{}).Select("year").Where("uuid = ?", yearUUID).Limit(1).Scan(&label)
+	return yearScope(provinceUUID, label)
+}
+
+// changed runs a target write and queues its webhook event in one
+// transaction, then publishes the change once it is committed
+func (r *targetRepository) changed(event models.TargetEvent, write func(tx *gorm.DB) error, scopes ...events.Scope) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := write(tx); err != nil {
+			return err
+		}
+		return enqueue(tx, models.EventTargetUpdated, event)
+	})
+	if err != nil {
+		return err
+	}
+	r.bus.Publish(events.Event{Kind: events.TargetChanged, Scopes: scopes})
+	return nil
+}
+
+func (r *targetRepository) ListYears(opts ListOptions) ([]models.Year, int64, error) {
+	var dataList []models.Year
+	var totalRecords int64
+
+	query := r.db.Model(&models.Year{}).Where("year ILIKE ?", "%"+opts.Search+"%")
+	if err := query.Count(&totalRecords).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := opts.paginate(query).Order("updated_at DESC").Find(&dataList).Error
+	return dataList, totalRecords, err
+}
+
+func (r *targetRepository) AllYears() ([]models.Year, error) {
+	var data []models.Year
+	err := r.db.Find(&data).Error
+	return data, err
+}
+
+func (r *targetRepository) FindYear(uuid string) (*models.Year, error) {
+	year := &models.Year{}
+	if err := first(r.db.Where("uuid = ?", uuid), year); err != nil {
+		return nil, err
+	}
+	return year, nil
+}
+
+func (r *targetRepository) FindYearByNumber(year string) (*models.Year, error) {
+	record := &models.Year{}
+	if err := first(r.db.Where("year = ?", year), record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func (r *targetRepository) CreateYear(year *models.Year) error {
+	write := func(tx *gorm.DB) error { return tx.Create(year).Error }
+	return r.changed(targetEvent("created", year), write, yearScope("", year.Year))
+}
+
+func (r *targetRepository) SaveYear(year *models.Year) error {
+	scopes := []events.Scope{yearScope("", year.Year)}
+	if previous, err := r.FindYear(year.UUID); err == nil && previous.Year != year.Year {
+		scopes = append(scopes, yearScope("", previous.Year))
+	}
+	write := func(tx *gorm.DB) error { return tx.Omit(clause.Associations).Save(year).Error }
+	return r.changed(targetEvent("updated", year), write, scopes...)
+}
+
+func (r *targetRepository) DeleteYear(year *models.Year) error {
+	write := func(tx *gorm.DB) error { return tx.Delete(year).Error }
+	return r.changed(targetEvent("deleted", year), write, yearScope("", year.Year))
+}
+
+func (r *targetRepository) ListMonths(opts ListOptions) ([]models.Month, int64, error) {
+	var dataList []models.Month
+	var totalRecords int64
+
+	query := r.db.Model(&models.Month{})
+	if opts.ProvinceUUID != nil {
+		query = query.Where("province_uuid = ?", *opts.ProvinceUUID)
+	}
+	query = query.Where("month ILIKE ?", "%"+opts.Search+"%")
+	if err := query.Count(&totalRecords).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := opts.paginate(query).Order("updated_at DESC").Preload("Country").Preload("Province").Find(&dataList).Error
+	return dataList, totalRecords, err
+}
+
+func (r *targetRepository) AllMonths() ([]models.Month, error) {
+	var data []models.Month
+	err := r.db.Preload("Country").Preload("Province").Find(&data).Error
+	return data, err
+}
+
+func (r *targetRepository) FindMonth(uuid string) (*models.Month, error) {
+	month := &models.Month{}
+	if err := first(r.db.Preload("Country").Preload("Province").Where("uuid = ?", uuid), month); err != nil {
+		return nil, err
+	}
+	return month, nil
+}
+
+func (r *targetRepository) FindMonthByName(month string) (*models.Month, error) {
+	record := &models.Month{}
+	if err := first(r.db.Preload("Country").Preload("Province").Where("month = ?", month), record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func (r *targetRepository) CreateMonth(month *models.Month) error {
+	write := func(tx *gorm.DB) error { return tx.Create(month).Error }
+	return r.changed(targetEvent("created", month), write, r.targetScope(month.ProvinceUUID, month.YearUUID))
+}
+
+func (r *targetRepository) SaveMonth(month *models.Month) error {
+	scopes := []events.Scope{r.targetScope(month.ProvinceUUID, month.YearUUID)}
+	if previous, err := r.FindMonth(month.UUID); err == nil {
+		scopes = append(scopes, r.targetScope(previous.ProvinceUUID, previous.YearUUID))
+	}
+	write := func(tx *gorm.DB) error { return tx.Omit(clause.Associations).Save(month).Error }
+	return r.changed(targetEvent("updated", month), write, scopes...)
+}
+
+func (r *targetRepository) DeleteMonth(month *models.Month) error {
+	write := func(tx *gorm.DB) error { return tx.Delete(month).Error }
+	return r.changed(targetEvent("deleted", month), write, r.targetScope(month.ProvinceUUID, month.YearUUID))
+}
+
+func (r *targetRepository) ListWeeks(opts ListOptions) ([]models.Week, int64, error) {
+	var dataList []models.Week
+	var totalRecords int64
+
+	query := r.db.Model(&models.Week{})
+	if opts.ProvinceUUID != nil {
+		query = query.Where("province_uuid = ?", *opts.ProvinceUUID)
+	}
+	query = query.Where("week ILIKE ?", "%"+opts.Search+"%")
+	if err := query.Count(&totalRecords).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := opts.paginate(query).Order("updated_at DESC").Preload("Country").Preload("Province").Find(&dataList).Error
+	return dataList, totalRecords, err
+}
+
+func (r *targetRepository) AllWeeks() ([]models.Week, error) {
+	var data []models.Week
+	err := r.db.Preload("Country").Preload("Province").Find(&data).Error
+	return data, err
+}
+
+func (r *targetRepository) FindWeek(uuid string) (*models.Week, error) {
+	week := &models.Week{}
+	if err := first(r.db.Preload("Country").Preload("Province").Where("uuid = ?", uuid), week); err != nil {
+		return nil, err
+	}
+	return week, nil
+}
+
+func (r *targetRepository) FindWeekByNumber(week string) (*models.Week, error) {
+	record := &models.Week{}
+	if err := first(r.db.Preload("Country").Preload("Province").Where("week = ?", week), record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func (r *targetRepository) CreateWeek(week *models.Week) error {
+	write := func(tx *gorm.DB) error { return tx.Create(week).Error }
+	return r.changed(targetEvent("created", week), write, r.targetScope(week.ProvinceUUID, week.YearUUID))
+}
+
+func (r *targetRepository) SaveWeek(week *models.Week) error {
+	scopes := []events.Scope{r.targetScope(week.ProvinceUUID, week.YearUUID)}
+	if previous, err := r.FindWeek(week.UUID); err == nil {
+		scopes = append(scopes, r.targetScope(previous.ProvinceUUID, previous.YearUUID))
+	}
+	write := func(tx *gorm.DB) error { return tx.Omit(clause.Associations).Save(week).Error }
+	return r.changed(targetEvent("updated", week), write, scopes...)
+}
+
+func (r *targetRepository) DeleteWeek(week *models.Week) error {
+	write := func(tx *gorm.DB) error { return tx.Delete(week).Error }
+	return r.changed(targetEvent("deleted", week), write, r.targetScope(week.ProvinceUUID, week.YearUUID))
+}
+
+func (r *targetRepository) MonthlyTarget(provinceUUID string, year int, month int) (int64, error) {
+	if month < 1 || month > 12 {
+		return 0, nil
+	}
+
+	yearRecord, err := r.FindYearByNumber(strconv.Itoa(year))
+	if err == ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var monthRecord models.Month
+	err = first(r.db.Model(&models.Month{}).
+		Where("province_uuid = ? AND month = ? AND year_uuid = ? AND territory_uuid IS NULL", provinceUUID, MonthNames[month-1], yearRecord.UUID), &monthRecord)
+	if err == ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// Invalid quantities count as no target
+	target, _ := strconv.ParseInt(monthRecord.Quantity, 10, 64)
+	return target, nil
+}
+
+func (r *targetRepository) WeeklyTarget(provinceUUID string, year int, week int) (int64, error) {
+	yearRecord, err := r.FindYearByNumber(strconv.Itoa(year))
+	if err == ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var weekRecord models.Week
+	err = first(r.db.Model(&models.Week{}).
+		Where("province_uuid = ? AND week = ? AND year_uuid = ? AND territory_uuid IS NULL", provinceUUID, strconv.Itoa(week), yearRecord.UUID), &weekRecord)
+	if err == ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// Invalid quantities count as no target
+	target, _ := strconv.ParseInt(weekRecord.Quantity, 10, 64)
+	return target, nil
+}
+
+func (r *targetRepository) WeeklyTargets(year int, week int, provinceUUIDs []string) ([]models.Week, error) {
+	yearRecord, err := r.FindYearByNumber(strconv.Itoa(year))
+	if err == ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	query := r.db.Model(&models.Week{}).
+		Where("week = ? AND year_uuid = ? AND territory_uuid IS NULL", strconv.Itoa(week), yearRecord.UUID)
+	if len(provinceUUIDs) > 0 {
+		query = query.Where("province_uuid IN ?", provinceUUIDs)
+	}
+
+	var weeks []models.Week
+	err = query.Find(&weeks).Error
+	return weeks, err
+}
@@ -0,0 +1,444 @@
+package repository
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/Danny19977/sr-api/events"
+	"github.com/Danny19977/sr-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrTerritoryCycle is returned when a node would be moved below itself
+var ErrTerritoryCycle = errors.New("a territory cannot be moved below itself")
+
+// ErrTerritoryNotLeaf is returned when deleting a node that has children
+var ErrTerritoryNotLeaf = errors.New("a territory with children cannot be deleted")
+
+// TerritoryTotal is the quantity sold in a node of the territory tree and
+// the nodes below it
+type TerritoryTotal struct {
+	TerritoryUUID string
+	Total         int64
+}
+
+// TerritoryRepository gives access to the territory tree. Countries,
+// provinces and outlets are mirrored into it by their own writes; regions
+// and districts are managed here.
+type TerritoryRepository interface {
+	// Sync rebuilds the tree from the countries, provinces and outlets: their
+	// nodes are created, renamed, moved to their parent and removed with
+	// their subtree. It can be run any number of times, and brings back in
+	// step a database written to without the repositories.
+	Sync() error
+	Find(uuid string) (*models.Territory, error)
+	// Children returns the nodes right below uuid, the countries when empty
+	Children(uuid string) ([]models.Territory, error)
+	// Ancestors returns the nodes above uuid, the root first
+	Ancestors(uuid string) ([]models.Territory, error)
+	// Create adds t below t.ParentUUID
+	Create(t *models.Territory) error
+	// Save renames t
+	Save(t *models.Territory) error
+	// Move places t and its subtree below parentUUID
+	Move(t *models.Territory, parentUUID string) error
+	// Delete removes t, which must be a leaf
+	Delete(t *models.Territory) error
+	// Provinces returns the provinces at or below uuid, or the province
+	// above it for districts and outlets
+	Provinces(uuid string) ([]string, error)
+	// Totals returns the quantity sold from rg.From to rg.To in each of
+	// uuids, the sales of the nodes below them included
+	Totals(rg TimeRange, uuids []string) ([]TerritoryTotal, error)
+	// MonthlyTargets returns the month targets of each of uuids, keyed by
+	// node in ProvinceUUID. A node without targets of its own adds up those
+	// of the provinces below it.
+	MonthlyTargets(uuids []string) ([]TargetRow, error)
+}
+
+type territoryRepository struct {
+	db  *gorm.DB
+	bus *events.Bus
+}
+
+// NewTerritoryRepository creates a TerritoryRepository backed by db that
+// publishes tree changes on bus
+func NewTerritoryRepository(db *gorm.DB, bus *events.Bus) TerritoryRepository {
+	return &territoryRepository{db: db, bus: bus}
+}
+
+// territoryChanged publishes a change of the tree. Nodes roll up any number
+// of provinces, so nothing cached is left.
+func (r *territoryRepository) territoryChanged() {
+	r.bus.Publish(events.Event{Kind: events.TerritoryChanged, Scopes: []events.Scope{{}}})
+}
+
+func (r *territoryRepository) Sync() error {
+	if err := syncTerritories(r.db); err != nil {
+		return err
+	}
+	r.territoryChanged()
+	return nil
+}
+
+// syncTerritories mirrors the countries, provinces and outlets into the tree
+// and rebuilds its closure table
+func syncTerritories(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		statements := []string{
+			`INSERT INTO territories (uuid, created_at, updated_at, parent_uuid, level, name)
+			SELECT uuid, NOW(), NOW(), NULL, 'country', name FROM countries
+			ON CONFLICT (uuid) DO UPDATE SET name = EXCLUDED.name, updated_at = NOW()
+			WHERE territories.name <> EXCLUDED.name`,
+			// The subtrees of removed countries, provinces and outlets go with them
+			`DELETE FROM territories WHERE uuid IN (
+				SELECT territory_paths.descendant_uuid FROM territory_paths
+				JOIN territories removed ON removed.uuid = territory_paths.ancestor_uuid
+				WHERE (removed.level = 'country' AND removed.uuid NOT IN (SELECT uuid FROM countries))
+				OR (removed.level = 'province' AND removed.uuid NOT IN (SELECT uuid FROM provinces))
+				OR (removed.level = 'outlet' AND removed.uuid NOT IN (SELECT uuid FROM outlets)))`,
+			`INSERT INTO territories (uuid, created_at, updated_at, parent_uuid, level, name)
+			SELECT uuid, NOW(), NOW(), country_uuid, 'province', name FROM provinces
+			ON CONFLICT (uuid) DO UPDATE SET name = EXCLUDED.name, updated_at = NOW()
+			WHERE territories.name <> EXCLUDED.name`,
+			// A province stays below a region of its country, otherwise it
+			// goes right below the country
+			`UPDATE territories SET parent_uuid = provinces.country_uuid, updated_at = NOW()
+			FROM provinces
+			WHERE territories.uuid = provinces.uuid
+			AND territories.parent_uuid IS DISTINCT FROM provinces.country_uuid
+			AND NOT EXISTS (SELECT 1 FROM territory_paths
+				WHERE territory_paths.descendant_uuid = territories.parent_uuid
+				AND territory_paths.ancestor_uuid = provinces.country_uuid)`,
+			// An outlet goes below its district while it exists, otherwise
+			// below its province
+			`INSERT INTO territories (uuid, created_at, updated_at, parent_uuid, level, name)
+			SELECT outlets.uuid, NOW(), NOW(), COALESCE(districts.uuid, outlets.province_uuid), 'outlet', outlets.name
+			FROM outlets
+			LEFT JOIN territories districts ON districts.uuid = outlets.territory_uuid AND districts.level = 'district'
+			WHERE outlets.province_uuid IN (SELECT uuid FROM provinces)
+			ON CONFLICT (uuid) DO UPDATE SET name = EXCLUDED.name, parent_uuid = EXCLUDED.parent_uuid, updated_at = NOW()
+			WHERE territories.name <> EXCLUDED.name OR territories.parent_uuid IS DISTINCT FROM EXCLUDED.parent_uuid`,
+			`DELETE FROM territory_paths`,
+			`INSERT INTO territory_paths (ancestor_uuid, descendant_uuid, depth)
+			WITH RECURSIVE tree AS (
+				SELECT uuid AS ancestor_uuid, uuid AS descendant_uuid, 0 AS depth FROM territories
+				UNION ALL
+				SELECT tree.ancestor_uuid, territories.uuid, tree.depth + 1
+				FROM tree JOIN territories ON territories.parent_uuid = tree.descendant_uuid
+			)
+			SELECT ancestor_uuid, descendant_uuid, depth FROM tree`,
+		}
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return clearTerritoryReferences(tx)
+	})
+}
+
+// clearTerritoryReferences detaches the users, sales, targets and outlets of
+// removed nodes
+func clearTerritoryReferences(tx *gorm.DB) error {
+	for _, table := range []string{"users", "sales", "months", "weeks", "outlets"} {
+		err := tx.Exec("UPDATE " + table + " SET territory_uuid = NULL WHERE territory_uuid IS NOT NULL AND territory_uuid NOT IN (SELECT uuid FROM territories)").Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *territoryRepository) Find(uuid string) (*models.Territory, error) {
+	territory := &models.Territory{}
+	if err := first(r.db.Where("uuid = ?", uuid), territory); err != nil {
+		return nil, err
+	}
+	return territory, nil
+}
+
+func (r *territoryRepository) Children(uuid string) ([]models.Territory, error) {
+	query := r.db.Where("parent_uuid IS NULL")
+	if uuid != "" {
+		query = r.db.Where("parent_uuid = ?", uuid)
+	}
+
+	var children []models.Territory
+	err := query.Order("name").Find(&children).Error
+	return children, err
+}
+
+func (r *territoryRepository) Ancestors(uuid string) ([]models.Territory, error) {
+	var ancestors []models.Territory
+	err := r.db.Model(&models.Territory{}).
+		Joins("JOIN territory_paths ON territory_paths.ancestor_uuid = territories.uuid").
+		Where("territory_paths.descendant_uuid = ? AND territory_paths.depth > 0", uuid).
+		Order("territory_paths.depth DESC").
+		Find(&ancestors).Error
+	return ancestors, err
+}
+
+// mirror runs write, which changes the tree along with what it mirrors, in
+// one transaction, and publishes the change once it is committed
+func mirror(db *gorm.DB, bus *events.Bus, write func(tx *gorm.DB) error) error {
+	if err := db.Transaction(write); err != nil {
+		return err
+	}
+	bus.Publish(events.Event{Kind: events.TerritoryChanged, Scopes: []events.Scope{{}}})
+	return nil
+}
+
+// insertPaths adds the closure rows of the new leaf uuid below parentUUID,
+// nil for a root
+func insertPaths(tx *gorm.DB, uuid string, parentUUID *string) error {
+	// The node is its own ancestor and one level further from those of its parent
+	return tx.Exec(`INSERT INTO territory_paths (ancestor_uuid, descendant_uuid, depth)
+		SELECT ancestor_uuid, ?, depth + 1 FROM territory_paths WHERE descendant_uuid = ?
+		UNION ALL SELECT ?, ?, 0`, uuid, parentUUID, uuid, uuid).Error
+}
+
+// movePaths hangs the subtree of uuid below parentUUID in the closure table,
+// nil making it a root
+func movePaths(tx *gorm.DB, uuid string, parentUUID *string) error {
+	// Detach the subtree from the ancestors of uuid, then hang it below
+	// every ancestor of the new parent
+	err := tx.Exec(`DELETE FROM territory_paths
+		WHERE descendant_uuid IN (SELECT descendant_uuid FROM territory_paths WHERE ancestor_uuid = ?)
+		AND ancestor_uuid NOT IN (SELECT descendant_uuid FROM territory_paths WHERE ancestor_uuid = ?)`,
+		uuid, uuid).Error
+	if err != nil {
+		return err
+	}
+	return tx.Exec(`INSERT INTO territory_paths (ancestor_uuid, descendant_uuid, depth)
+		SELECT above.ancestor_uuid, below.descendant_uuid, above.depth + below.depth + 1
+		FROM territory_paths above CROSS JOIN territory_paths below
+		WHERE above.descendant_uuid = ? AND below.ancestor_uuid = ?`,
+		parentUUID, uuid).Error
+}
+
+// placeNode creates or updates the node mirroring a country, a province or
+// an outlet, with its closure rows. A province already filed under a region
+// of its country stays there.
+func placeNode(tx *gorm.DB, node models.Territory) error {
+	existing := models.Territory{}
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("uuid = ?", node.UUID).Limit(1).Find(&existing).Error
+	if err != nil {
+		return err
+	}
+	if existing.UUID == "" {
+		if err := tx.Create(&node).Error; err != nil {
+			return err
+		}
+		return insertPaths(tx, node.UUID, node.ParentUUID)
+	}
+
+	if existing.Name != node.Name {
+		if err := tx.Model(&existing).Update("name", node.Name).Error; err != nil {
+			return err
+		}
+	}
+	if deref(existing.ParentUUID) == deref(node.ParentUUID) {
+		return nil
+	}
+	if node.Level == models.TerritoryProvince && existing.ParentUUID != nil && node.ParentUUID != nil {
+		var below int64
+		err := tx.Model(&models.TerritoryPath{}).
+			Where("ancestor_uuid = ? AND descendant_uuid = ?", *node.ParentUUID, *existing.ParentUUID).
+			Count(&below).Error
+		if err != nil || below > 0 {
+			return err
+		}
+	}
+	if err := tx.Model(&existing).Update("parent_uuid", node.ParentUUID).Error; err != nil {
+		return err
+	}
+	return movePaths(tx, node.UUID, node.ParentUUID)
+}
+
+// removeNode removes the node of uuid with its subtree and detaches what
+// referred to them
+func removeNode(tx *gorm.DB, uuid string) error {
+	var subtree []string
+	err := tx.Model(&models.TerritoryPath{}).Where("ancestor_uuid = ? AND depth > 0", uuid).
+		Pluck("descendant_uuid", &subtree).Error
+	if err != nil {
+		return err
+	}
+	subtree = append(subtree, uuid)
+	if err := tx.Where("descendant_uuid IN ?", subtree).Delete(&models.TerritoryPath{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("uuid IN ?", subtree).Delete(&models.Territory{}).Error; err != nil {
+		return err
+	}
+	return clearTerritoryReferences(tx)
+}
+
+// deref returns the string s points to, empty when nil
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func (r *territoryRepository) Create(t *models.Territory) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(t).Error; err != nil {
+			return err
+		}
+		return insertPaths(tx, t.UUID, t.ParentUUID)
+	})
+	if err != nil {
+		return err
+	}
+	r.territoryChanged()
+	return nil
+}
+
+func (r *territoryRepository) Save(t *models.Territory) error {
+	if err := r.db.Model(t).Select("name").Updates(t).Error; err != nil {
+		return err
+	}
+	r.territoryChanged()
+	return nil
+}
+
+func (r *territoryRepository) Move(t *models.Territory, parentUUID string) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var below int64
+		err := tx.Model(&models.TerritoryPath{}).
+			Where("ancestor_uuid = ? AND descendant_uuid = ?", t.UUID, parentUUID).
+			Count(&below).Error
+		if err != nil {
+			return err
+		}
+		if below > 0 {
+			return ErrTerritoryCycle
+		}
+
+		if err := tx.Model(t).Update("parent_uuid", parentUUID).Error; err != nil {
+			return err
+		}
+		return movePaths(tx, t.UUID, &parentUUID)
+	})
+	if err != nil {
+		return err
+	}
+	r.territoryChanged()
+	return nil
+}
+
+func (r *territoryRepository) Delete(t *models.Territory) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var children int64
+		if err := tx.Model(&models.Territory{}).Where("parent_uuid = ?", t.UUID).Count(&children).Error; err != nil {
+			return err
+		}
+		if children > 0 {
+			return ErrTerritoryNotLeaf
+		}
+		if err := tx.Where("descendant_uuid = ?", t.UUID).Delete(&models.TerritoryPath{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(t).Error; err != nil {
+			return err
+		}
+		return clearTerritoryReferences(tx)
+	})
+	if err != nil {
+		return err
+	}
+	r.territoryChanged()
+	return nil
+}
+
+func (r *territoryRepository) Provinces(uuid string) ([]string, error) {
+	var provinces []string
+	err := r.db.Raw(`SELECT territories.uuid FROM territories
+		JOIN territory_paths ON territory_paths.descendant_uuid = territories.uuid
+		WHERE territory_paths.ancestor_uuid = ? AND territories.level = 'province'
+		UNION
+		SELECT territories.uuid FROM territories
+		JOIN territory_paths ON territory_paths.ancestor_uuid = territories.uuid
+		WHERE territory_paths.descendant_uuid = ? AND territories.level = 'province'`,
+		uuid, uuid).Scan(&provinces).Error
+	return provinces, err
+}
+
+// Totals places each sale on its district or outlet when it has one, on its
+// province otherwise, and adds it up in every ancestor of that node
+func (r *territoryRepository) Totals(rg TimeRange, uuids []string) ([]TerritoryTotal, error) {
+	var totals []TerritoryTotal
+	if len(uuids) == 0 {
+		return totals, nil
+	}
+	err := r.db.Raw(`SELECT territory_paths.ancestor_uuid AS territory_uuid, COALESCE(SUM(sales.quantity), 0) AS total
+		FROM sales
+		JOIN territory_paths ON territory_paths.descendant_uuid = COALESCE(sales.territory_uuid, sales.province_uuid)
+		WHERE sales.created_at BETWEEN ? AND ? AND territory_paths.ancestor_uuid IN ?
+		GROUP BY territory_paths.ancestor_uuid`,
+		rg.From, rg.To, uuids).Scan(&totals).Error
+	return totals, err
+}
+
+// territoryTarget is a month target of a node below one of the requested nodes
+type territoryTarget struct {
+	AncestorUUID string
+	Depth        int
+	// Province is set for the targets of provinces, which carry no territory
+	Province bool
+	Year     string
+	Period   string
+	Quantity string
+}
+
+func (r *territoryRepository) MonthlyTargets(uuids []string) ([]TargetRow, error) {
+	if len(uuids) == 0 {
+		return nil, nil
+	}
+	var records []territoryTarget
+	err := r.db.Raw(`SELECT territory_paths.ancestor_uuid, territory_paths.depth,
+			months.territory_uuid IS NULL AS province,
+			COALESCE(years.year, '') AS year, months.month AS period, months.quantity
+		FROM months
+		JOIN territory_paths ON territory_paths.descendant_uuid = COALESCE(months.territory_uuid, months.province_uuid)
+		LEFT JOIN years ON years.uuid = months.year_uuid
+		WHERE territory_paths.ancestor_uuid IN ?`, uuids).Scan(&records).Error
+	if err != nil {
+		return nil, err
+	}
+
+	own := make(map[string]bool)
+	for _, record := range records {
+		if record.Depth == 0 {
+			own[record.AncestorUUID] = true
+		}
+	}
+
+	monthIndex := make(map[string]int, len(MonthNames))
+	for i, name := range MonthNames {
+		monthIndex[name] = i + 1
+	}
+
+	rows := make([]TargetRow, 0, len(records))
+	for _, record := range records {
+		if own[record.AncestorUUID] && record.Depth > 0 || !own[record.AncestorUUID] && !record.Province {
+			continue
+		}
+		month, ok := monthIndex[record.Period]
+		if !ok {
+			continue
+		}
+		// Invalid quantities count as no target
+		target, err := strconv.ParseInt(record.Quantity, 10, 64)
+		if err != nil {
+			continue
+		}
+		year, _ := strconv.Atoi(record.Year)
+		rows = append(rows, TargetRow{ProvinceUUID: record.AncestorUUID, Year: year, Period: month, Target: target})
+	}
+	return rows, nil
+}
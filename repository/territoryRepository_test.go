@@ -0,0 +1,114 @@
+package repository_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/Danny19977/sr-api/apptest"
+	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/repository"
+	"github.com/google/uuid"
+)
+
+// ancestors returns the names of the nodes above uuid, the root first
+func ancestors(t *testing.T, env *apptest.Env, uuid string) []string {
+	t.Helper()
+
+	nodes, err := env.App.Territories.Ancestors(uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, len(nodes))
+	for i, node := range nodes {
+		names[i] = node.Name
+	}
+	return names
+}
+
+// paths returns the closure table
+func paths(t *testing.T, env *apptest.Env) []models.TerritoryPath {
+	t.Helper()
+
+	var rows []models.TerritoryPath
+	if err := env.App.DB.Order("ancestor_uuid, descendant_uuid").Find(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func TestWritesMirrorIntoTheTree(t *testing.T) {
+	env := apptest.New(t)
+	geography := env.App.Geography
+
+	east := &models.Country{UUID: uuid.New().String(), Name: "East"}
+	west := &models.Country{UUID: uuid.New().String(), Name: "West"}
+	for _, country := range []*models.Country{east, west} {
+		if err := geography.CreateCountry(country); err != nil {
+			t.Fatal(err)
+		}
+	}
+	province := &models.Province{UUID: uuid.New().String(), Name: "Harbour", CountryUUID: east.UUID}
+	if err := geography.CreateProvince(province); err != nil {
+		t.Fatal(err)
+	}
+	region := &models.Territory{UUID: uuid.New().String(), ParentUUID: &east.UUID, Level: models.TerritoryRegion, Name: "Coast"}
+	if err := env.App.Territories.Create(region); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.App.Territories.Move(&models.Territory{UUID: province.UUID}, region.UUID); err != nil {
+		t.Fatal(err)
+	}
+
+	// A renamed province stays in the region of its country
+	province.Name = "Old Harbour"
+	if err := geography.SaveProvince(province); err != nil {
+		t.Fatal(err)
+	}
+	if got := ancestors(t, env, province.UUID); !slices.Equal(got, []string{"East", "Coast"}) {
+		t.Errorf("got ancestors %v, want East and Coast", got)
+	}
+	node, err := env.App.Territories.Find(province.UUID)
+	if err != nil || node.Name != "Old Harbour" {
+		t.Errorf("got node %v, want it renamed", node)
+	}
+
+	// Its outlets move along when it changes country
+	outlet := &models.Outlet{UUID: uuid.New().String(), Name: "Quay", ProvinceUUID: province.UUID}
+	if err := env.App.Outlets.Create(outlet); err != nil {
+		t.Fatal(err)
+	}
+	province.CountryUUID = west.UUID
+	if err := geography.SaveProvince(province); err != nil {
+		t.Fatal(err)
+	}
+	if got := ancestors(t, env, outlet.UUID); !slices.Equal(got, []string{"West", "Old Harbour"}) {
+		t.Errorf("got ancestors %v, want West and Old Harbour", got)
+	}
+
+	// The incremental rows match a full rebuild
+	before := paths(t, env)
+	if err := env.App.Territories.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if after := paths(t, env); !slices.Equal(before, after) {
+		t.Errorf("got closure %v, a rebuild gives %v", before, after)
+	}
+
+	// A deleted province takes its subtree along
+	if err := geography.DeleteProvince(province); err != nil {
+		t.Fatal(err)
+	}
+	for _, uuid := range []string{province.UUID, outlet.UUID} {
+		if _, err := env.App.Territories.Find(uuid); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("got %v finding %s, want it removed", err, uuid)
+		}
+	}
+	var orphans int64
+	err = env.App.DB.Model(&models.TerritoryPath{}).
+		Where("ancestor_uuid IN ? OR descendant_uuid IN ?", []string{province.UUID}, []string{province.UUID, outlet.UUID}).
+		Count(&orphans).Error
+	if err != nil || orphans != 0 {
+		t.Errorf("got %d closure rows of removed nodes (%v), want none", orphans, err)
+	}
+}
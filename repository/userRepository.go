@@ -0,0 +1,264 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/Danny19977/sr-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrManagerCycle is returned when a user would report to themselves or to
+// one of the users below them
+var ErrManagerCycle = errors.New("a user cannot report to themselves or to someone reporting to them")
+
+// ErrManagerNotFound is returned when the manager of a user does not exist
+var ErrManagerNotFound = errors.New("the manager does not exist")
+
+// ErrWrongPassword is returned when a password does not match the credential
+// of a user, or the user has none
+var ErrWrongPassword = errors.New("the password is not correct")
+
+// UserRepository gives access to the users aggregate
+type UserRepository interface {
+	List(opts ListOptions) ([]models.User, int64, error)
+	All() ([]models.User, error)
+	FindByUUID(uuid string) (*models.User, error)
+	FindByIdentifier(identifier string) (*models.User, error)
+	FindByEmail(email string) (*models.User, error)
+	// ActiveByRole returns the active users holding one of roles. A province
+	// keeps its users only, those of a territory holding it or below it
+	// included; a country keeps its users and the users attached to no
+	// country.
+	ActiveByRole(roles []string, provinceUUID, countryUUID string) ([]models.User, error)
+	// Team returns the UUIDs of the users reporting to managerUUID, directly
+	// or through other managers
+	Team(managerUUID string) ([]string, error)
+	// ActiveManagers returns the active direct managers of the users in uuids
+	ActiveManagers(uuids []string) ([]models.User, error)
+	// Create and Save refuse a manager that does not exist or that would
+	// close a reporting cycle. Create stores the credential of the user
+	// along with it.
+	Create(user *models.User, password string) error
+	Save(user *models.User) error
+	Delete(user *models.User) error
+	// SetPassword replaces the credential of the user of userUUID
+	SetPassword(userUUID, password string) error
+	// CheckPassword returns ErrWrongPassword unless password matches the
+	// credential of the user of userUUID
+	CheckPassword(userUUID, password string) error
+}
+
+type userRepository struct {
+	db *gorm.DB
+}
+
+// NewUserRepository creates a UserRepository backed by db
+func NewUserRepository(db *gorm.DB) UserRepository {
+	return &userRepository{db: db}
+}
+
+func (r *userRepository) List(opts ListOptions) ([]models.User, int64, error) {
+	var users []models.User
+	var totalRecords int64
+
+	query := r.db.Model(&models.User{})
+	if opts.ProvinceUUID != nil {
+		query = query.Where("province_uuid = ?", *opts.ProvinceUUID)
+	}
+	if opts.UserUUIDs != nil {
+		query = query.Where("users.uuid IN ?", opts.UserUUIDs)
+	}
+	if opts.Search != "" {
+		query = query.Where("fullname ILIKE ? OR title ILIKE ?", "%"+opts.Search+"%", "%"+opts.Search+"%")
+	}
+	if err := query.Count(&totalRecords).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := opts.paginate(query).Preload("Country").Preload("Province").
+		Order("users.updated_at DESC").
+		Find(&users).Error
+	return users, totalRecords, err
+}
+
+func (r *userRepository) All() ([]models.User, error) {
+	var users []models.User
+	err := r.db.Preload("Country").Preload("Province").Find(&users).Error
+	return users, err
+}
+
+func (r *userRepository) FindByUUID(uuid string) (*models.User, error) {
+	user := &models.User{}
+	if err := first(r.db.Preload("Country").Preload("Province").Where("users.uuid = ?", uuid), user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// FindByIdentifier looks a user up by email, or by email or phone when the
+// identifier is numeric
+func (r *userRepository) FindByIdentifier(identifier string) (*models.User, error) {
+	user := &models.User{}
+	if err := first(r.db.Where("email = ? OR phone = ?", identifier, identifier), user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *userRepository) FindByEmail(email string) (*models.User, error) {
+	user := &models.User{}
+	if err := first(r.db.Where("email = ?", email), user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *userRepository) ActiveByRole(roles []string, provinceUUID, countryUUID string) ([]models.User, error) {
+	var users []models.User
+	if len(roles) == 0 {
+		return users, nil
+	}
+
+	query := r.db.Where("status = ? AND role IN ?", true, roles)
+	if provinceUUID != "" {
+		// The territory of a user takes precedence over their province, as
+		// in the scope of their data
+		query = query.Where(`((territory_uuid IS NULL AND province_uuid = ?) OR territory_uuid IN (
+			SELECT ancestor_uuid FROM territory_paths WHERE descendant_uuid = ?
+			UNION
+			SELECT descendant_uuid FROM territory_paths WHERE ancestor_uuid = ?))`,
+			provinceUUID, provinceUUID, provinceUUID)
+	}
+	if countryUUID != "" {
+		query = query.Where("(country_uuid = ? OR country_uuid IS NULL)", countryUUID)
+	}
+	err := query.Order("fullname").Find(&users).Error
+	return users, err
+}
+
+func (r *userRepository) Team(managerUUID string) ([]string, error) {
+	uuids := []string{}
+	err := r.db.Raw(`
+		WITH RECURSIVE team AS (
+			SELECT uuid FROM users WHERE manager_uuid = ?
+			UNION
+			SELECT u.uuid FROM users u JOIN team t ON u.manager_uuid = t.uuid
+		)
+		SELECT uuid FROM team WHERE uuid <> ?`, managerUUID, managerUUID).
+		Scan(&uuids).Error
+	return uuids, err
+}
+
+func (r *userRepository) ActiveManagers(uuids []string) ([]models.User, error) {
+	var managers []models.User
+	if len(uuids) == 0 {
+		return managers, nil
+	}
+	err := r.db.Where("status = ? AND uuid IN (?)", true,
+		r.db.Model(&models.User{}).Select("manager_uuid").Where("uuid IN ? AND manager_uuid IS NOT NULL", uuids)).
+		Order("fullname").Find(&managers).Error
+	return managers, err
+}
+
+// checkManager refuses a manager of user that does not exist or that
+// reports, directly or not, to user
+func checkManager(tx *gorm.DB, user *models.User) error {
+	if user.ManagerUUID == nil {
+		return nil
+	}
+	if *user.ManagerUUID == user.UUID {
+		return ErrManagerCycle
+	}
+
+	var chain []string
+	err := tx.Raw(`
+		WITH RECURSIVE chain AS (
+			SELECT uuid, manager_uuid FROM users WHERE uuid = ?
+			UNION
+			SELECT u.uuid, u.manager_uuid FROM users u JOIN chain c ON u.uuid = c.manager_uuid
+		)
+		SELECT uuid FROM chain`, *user.ManagerUUID).
+		Scan(&chain).Error
+	if err != nil {
+		return err
+	}
+	if len(chain) == 0 {
+		return ErrManagerNotFound
+	}
+	for _, uuid := range chain {
+		if uuid == user.UUID {
+			return ErrManagerCycle
+		}
+	}
+	return nil
+}
+
+func (r *userRepository) Create(user *models.User, password string) error {
+	credential, err := models.NewCredential(user.UUID, password)
+	if err != nil {
+		return err
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkManager(tx, user); err != nil {
+			return err
+		}
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(credential).Error; err != nil {
+			return err
+		}
+		return enqueue(tx, models.EventUserCreated, models.NewUserEvent(user))
+	})
+}
+
+func (r *userRepository) Save(user *models.User) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkManager(tx, user); err != nil {
+			return err
+		}
+		return tx.Omit(clause.Associations).Save(user).Error
+	})
+}
+
+// Delete hands the reports of user over to the manager of user
+func (r *userRepository) Delete(user *models.User) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.User{}).Where("manager_uuid = ?", user.UUID).
+			Update("manager_uuid", user.ManagerUUID).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.Credential{}, "user_uuid = ?", user.UUID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(user).Error
+	})
+}
+
+func (r *userRepository) SetPassword(userUUID, password string) error {
+	credential, err := models.NewCredential(userUUID, password)
+	if err != nil {
+		return err
+	}
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_uuid"}},
+		DoUpdates: clause.AssignmentColumns([]string{"password_hash", "updated_at"}),
+	}).Create(credential).Error
+}
+
+func (r *userRepository) CheckPassword(userUUID, password string) error {
+	credential := &models.Credential{}
+	err := first(r.db.Where("user_uuid = ?", userUUID), credential)
+	if errors.Is(err, ErrNotFound) {
+		return ErrWrongPassword
+	}
+	if err != nil {
+		return err
+	}
+	if credential.Compare(password) != nil {
+		return ErrWrongPassword
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package repository
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Danny19977/sr-api/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DeliveryListOptions filters the delivery log of a subscription
+type DeliveryListOptions struct {
+	ListOptions
+
+	// Status keeps the deliveries of one status when set
+	Status string
+	// EventType keeps the deliveries of one event type when set
+	EventType string
+}
+
+// WebhookEnvelope is the body posted for every event
+type WebhookEnvelope struct {
+	// ID identifies the event, replays and retries keep it
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// WebhookRepository stores the webhook subscriptions, the outbox and the delivery log
+type WebhookRepository interface {
+	ListSubscriptions(opts ListOptions) ([]models.WebhookSubscription, int64, error)
+	FindSubscription(uuid string) (*models.WebhookSubscription, error)
+	CreateSubscription(subscription *models.WebhookSubscription) error
+	SaveSubscription(subscription *models.WebhookSubscription) error
+	// DeleteSubscription removes a subscription with its delivery log
+	DeleteSubscription(subscription *models.WebhookSubscription) error
+
+	// Deliveries lists the delivery log of a subscription, latest first
+	Deliveries(subscriptionUUID string, opts DeliveryListOptions) ([]models.WebhookDelivery, int64, error)
+	FindDelivery(uuid string) (*models.WebhookDelivery, error)
+	// Replay queues a new delivery of the payload of delivery, due at now
+	Replay(delivery *models.WebhookDelivery, now time.Time) (*models.WebhookDelivery, error)
+
+	// FanOut queues the deliveries of up to limit undispatched outbox events
+	// to the active subscriptions wanting them and returns how many events it took
+	FanOut(limit int, now time.Time) (int, error)
+	// ClaimDue returns up to limit pending deliveries due at now and holds
+	// them back from other dispatchers for lease
+	ClaimDue(now time.Time, limit int, lease time.Duration) ([]models.WebhookDelivery, error)
+	// RecordAttempt stores the outcome of the latest attempt of delivery
+	RecordAttempt(delivery *models.WebhookDelivery) error
+	// Purge deletes the dispatched outbox events and the finished deliveries
+	// older than before
+	Purge(before time.Time) (int64, error)
+}
+
+type webhookRepository struct {
+	db *gorm.DB
+}
+
+// NewWebhookRepository creates a WebhookRepository backed by db
+func NewWebhookRepository(db *gorm.DB) WebhookRepository {
+	return &webhookRepository{db: db}
+}
+
+func (r *webhookRepository) ListSubscriptions(opts ListOptions) ([]models.WebhookSubscription, int64, error) {
+	var subscriptions []models.WebhookSubscription
+	var totalRecords int64
+
+	query := r.db.Model(&models.WebhookSubscription{})
+	if opts.Search != "" {
+		query = query.Where("name ILIKE ? OR url ILIKE ?", "%"+opts.Search+"%", "%"+opts.Search+"%")
+	}
+	if err := query.Count(&totalRecords).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := opts.paginate(query).Order("updated_at DESC").Find(&subscriptions).Error
+	return subscriptions, totalRecords, err
+}
+
+func (r *webhookRepository) FindSubscription(uuid string) (*models.WebhookSubscription, error) {
+	subscription := &models.WebhookSubscription{}
+	if err := first(r.db.Where("uuid = ?", uuid), subscription); err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+func (r *webhookRepository) CreateSubscription(subscription *models.WebhookSubscription) error {
+	return r.db.Create(subscription).Error
+}
+
+func (r *webhookRepository) SaveSubscription(subscription *models.WebhookSubscription) error {
+	return r.db.Save(subscription).Error
+}
+
+func (r *webhookRepository) DeleteSubscription(subscription *models.WebhookSubscription) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("subscription_uuid = ?", subscription.UUID).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(subscription).Error
+	})
+}
+
+func (r *webhookRepository) Deliveries(subscriptionUUID string, opts DeliveryListOptions) ([]models.WebhookDelivery, int64, error) {
+	var deliveries []models.WebhookDelivery
+	var totalRecords int64
+
+	query := r.db.Model(&models.WebhookDelivery{}).Where("subscription_uuid = ?", subscriptionUUID)
+	if opts.Status != "" {
+		query = query.Where("status = ?", opts.Status)
+	}
+	if opts.EventType != "" {
+		query = query.Where("event_type = ?", opts.EventType)
+	}
+	if err := query.Count(&totalRecords).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := opts.paginate(query).Order("created_at DESC").Find(&deliveries).Error
+	return deliveries, totalRecords, err
+}
+
+func (r *webhookRepository) FindDelivery(uuid string) (*models.WebhookDelivery, error) {
+	delivery := &models.WebhookDelivery{}
+	if err := first(r.db.Where("uuid = ?", uuid), delivery); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+func (r *webhookRepository) Replay(delivery *models.WebhookDelivery, now time.Time) (*models.WebhookDelivery, error) {
+	replay := &models.WebhookDelivery{
+		UUID:             uuid.New().String(),
+		SubscriptionUUID: delivery.SubscriptionUUID,
+		EventUUID:        delivery.EventUUID,
+		EventType:        delivery.EventType,
+		Payload:          delivery.Payload,
+		Status:           models.DeliveryPending,
+		NextAttemptAt:    now,
+		ReplayOf:         &delivery.UUID,
+	}
+	if err := r.db.Create(replay).Error; err != nil {
+		return nil, err
+	}
+	return replay, nil
+}
+
+func (r *webhookRepository) FanOut(limit int, now time.Time) (int, error) {
+	var taken int
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// Concurrent dispatchers skip the events another one is fanning out
+		var events []models.OutboxEvent
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("dispatched_at IS NULL").Order("id").Limit(limit).Find(&events).Error
+		if err != nil || len(events) == 0 {
+			return err
+		}
+
+		var subscriptions []models.WebhookSubscription
+		if err := tx.Where("active = ?", true).Find(&subscriptions).Error; err != nil {
+			return err
+		}
+
+		var deliveries []models.WebhookDelivery
+		ids := make([]uint64, len(events))
+		for i, event := range events {
+			ids[i] = event.ID
+
+			body, err := json.Marshal(WebhookEnvelope{ID: event.UUID, Type: event.Type, CreatedAt: event.CreatedAt, Data: event.Payload})
+			if err != nil {
+				return err
+			}
+			for _, subscription := range subscriptions {
+				if !subscription.Wants(event.Type) {
+					continue
+				}
+				deliveries = append(deliveries, models.WebhookDelivery{
+					UUID:             uuid.New().String(),
+					SubscriptionUUID: subscription.UUID,
+					EventUUID:        event.UUID,
+					EventType:        event.Type,
+					Payload:          body,
+					Status:           models.DeliveryPending,
+					NextAttemptAt:    now,
+				})
+			}
+		}
+
+		if len(deliveries) > 0 {
+			if err := tx.CreateInBatches(deliveries, 500).Error; err != nil {
+				return err
+			}
+		}
+		taken = len(events)
+		return tx.Model(&models.OutboxEvent{}).Where("id IN ?", ids).Update("dispatched_at", now).Error
+	})
+	return taken, err
+}
+
+func (r *webhookRepository) ClaimDue(now time.Time, limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	err := r.db.Raw(`
+		UPDATE webhook_deliveries SET next_attempt_at = ?, updated_at = ?
+		WHERE uuid IN (
+			SELECT uuid FROM webhook_deliveries
+			WHERE status = ? AND next_attempt_at <= ?
+			ORDER BY next_attempt_at
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		now.Add(lease), now, models.DeliveryPending, now, limit).Scan(&deliveries).Error
+	return deliveries, err
+}
+
+func (r *webhookRepository) RecordAttempt(delivery *models.WebhookDelivery) error {
+	return r.db.Model(delivery).Select("status", "attempts", "next_attempt_at", "response_status", "last_error", "delivered_at", "updated_at").
+		Updates(delivery).Error
+}
+
+func (r *webhookRepository) Purge(before time.Time) (int64, error) {
+	var purged int64
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("dispatched_at < ?", before).Delete(&models.OutboxEvent{})
+		if result.Error != nil {
+			return result.Error
+		}
+		purged = result.RowsAffected
+
+		result = tx.Where("status <> ? AND updated_at < ?", models.DeliveryPending, before).Delete(&models.WebhookDelivery{})
+		purged += result.RowsAffected
+		return result.Error
+	})
+	return purged, err
+}
@@ -0,0 +1,185 @@
+package routes_test
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Danny19977/sr-api/apptest"
+	"github.com/Danny19977/sr-api/models"
+	"github.com/google/uuid"
+)
+
+// leaks returns the password material found in body: a password key, or a
+// bcrypt hash, any of hashes in particular
+func leaks(body []byte, hashes []string) []string {
+	var found []string
+	for _, key := range []string{`"password`, `"confirm_password"`, `"conform_password"`, `"PasswordHash"`, `$2a$`, `$2b$`} {
+		if bytes.Contains(body, []byte(key)) {
+			found = append(found, key)
+		}
+	}
+	for _, hash := range hashes {
+		if bytes.Contains(body, []byte(hash)) {
+			found = append(found, "a stored hash")
+		}
+	}
+	return found
+}
+
+// TestNoEndpointEmitsPasswordMaterial calls every GET route and the writes
+// returning a user, and fails on any body carrying a password or its hash
+func TestNoEndpointEmitsPasswordMaterial(t *testing.T) {
+	env := apptest.New(t)
+
+	country := &models.Country{UUID: uuid.New().String(), Name: "Country"}
+	if err := env.App.Geography.CreateCountry(country); err != nil {
+		t.Fatal(err)
+	}
+	province := &models.Province{UUID: uuid.New().String(), Name: "North", CountryUUID: country.UUID}
+	if err := env.App.Geography.CreateProvince(province); err != nil {
+		t.Fatal(err)
+	}
+	admin := env.CreateUser("Admin", nil)
+	asm := env.CreateUser("ASM", &province.UUID)
+	asm.CountryUUID = &country.UUID
+	asm.ManagerUUID = &admin.UUID
+	if err := env.App.Users.Save(asm); err != nil {
+		t.Fatal(err)
+	}
+	sale := &models.Sale{UUID: uuid.New().String(), ProvinceUUID: province.UUID, ProductUUID: uuid.New().String(), UserUUID: asm.UUID, Quantity: 5}
+	if err := env.App.Sales.Create(sale); err != nil {
+		t.Fatal(err)
+	}
+	token := env.Token(admin)
+
+	check := func(method, path string, resp *apptest.Response) {
+		t.Helper()
+		var hashes []string
+		if err := env.App.DB.Model(&models.Credential{}).Pluck("password_hash", &hashes).Error; err != nil {
+			t.Fatal(err)
+		}
+		if found := leaks(resp.Body, hashes); len(found) > 0 {
+			t.Errorf("%s %s emits %s: %s", method, path, strings.Join(found, ", "), resp.Body)
+		}
+	}
+
+	writes := []struct {
+		method, path string
+		body         map[string]any
+	}{
+		{http.MethodPost, "/api/auth/register", map[string]any{
+			"fullname": "Registered", "email": "registered@example.com", "phone": "100",
+			"password": "secret", "password_confirm": "secret",
+		}},
+		{http.MethodPost, "/api/users/create", map[string]any{
+			"fullname": "Created", "email": "created@example.com", "Phone": "200",
+			"password": "secret", "confirm_password": "secret", "role": "ASM",
+			"province_uuid": province.UUID, "manager_uuid": admin.UUID,
+		}},
+		{http.MethodPut, "/api/users/update/" + asm.UUID, map[string]any{
+			"fullname": asm.Fullname, "email": asm.Email, "Phone": asm.Phone, "role": "ASM", "status": true,
+			"province_uuid": province.UUID, "country_uuid": country.UUID, "manager_uuid": admin.UUID,
+		}},
+		{http.MethodPut, "/api/auth/profil/info", map[string]any{
+			"fullname": admin.Fullname, "email": admin.Email, "phone": admin.Phone,
+		}},
+		{http.MethodPut, "/api/auth/change-password", map[string]any{
+			"old_password": "secret", "password": "secret", "password_confirm": "secret",
+		}},
+	}
+	for _, w := range writes {
+		resp := env.Do(w.method, w.path, token, w.body)
+		if resp.Status != http.StatusOK {
+			t.Fatalf("%s %s: got status %d: %s", w.method, w.path, resp.Status, resp.Body)
+		}
+		check(w.method, w.path, resp)
+	}
+
+	// Each parameter takes every seeded value it may name
+	values := map[string][]string{
+		"uuid":          {asm.UUID, sale.UUID, province.UUID, country.UUID},
+		"user_uuid":     {asm.UUID},
+		"province_uuid": {province.UUID},
+		"country_uuid":  {country.UUID},
+	}
+	called := 0
+	for _, route := range env.Server.GetRoutes(true) {
+		// The stream never ends
+		if route.Method != http.MethodGet || strings.HasSuffix(route.Path, "/stream") {
+			continue
+		}
+		paths := []string{route.Path}
+		for _, param := range route.Params {
+			candidates, ok := values[param]
+			if !ok {
+				candidates = []string{"1"}
+			}
+			var expanded []string
+			for _, path := range paths {
+				for _, value := range candidates {
+					expanded = append(expanded, strings.Replace(path, ":"+param, value, 1))
+				}
+			}
+			paths = expanded
+		}
+		for _, path := range paths {
+			check(http.MethodGet, path, env.Do(http.MethodGet, path, token, nil))
+			called++
+		}
+	}
+	if called == 0 {
+		t.Fatal("no GET route was called")
+	}
+}
+
+func TestPasswordChangeAndReset(t *testing.T) {
+	env := apptest.New(t)
+	user := env.CreateUser("Admin", nil)
+
+	login := func(password string) int {
+		t.Helper()
+		return env.Do(http.MethodPost, "/api/auth/login", "", map[string]string{
+			"identifier": user.Email,
+			"password":   password,
+		}).Status
+	}
+
+	resp := env.Do(http.MethodPut, "/api/auth/change-password", env.Token(user), map[string]string{
+		"old_password": "wrong", "password": "changed", "password_confirm": "changed",
+	})
+	if resp.Status != http.StatusBadRequest {
+		t.Fatalf("wrong old password: got status %d: %s", resp.Status, resp.Body)
+	}
+	resp = env.Do(http.MethodPut, "/api/auth/change-password", env.Token(user), map[string]string{
+		"old_password": "secret", "password": "changed", "password_confirm": "changed",
+	})
+	if resp.Status != http.StatusOK {
+		t.Fatalf("change password: got status %d: %s", resp.Status, resp.Body)
+	}
+	if got := login("secret"); got != http.StatusBadRequest {
+		t.Errorf("old password: got status %d, want %d", got, http.StatusBadRequest)
+	}
+	if got := login("changed"); got != http.StatusOK {
+		t.Errorf("new password: got status %d, want %d", got, http.StatusOK)
+	}
+
+	resp = env.Do(http.MethodPost, "/api/auth/forgot-password", "", map[string]string{"email": user.Email})
+	if resp.Status != http.StatusOK {
+		t.Fatalf("forgot password: got status %d: %s", resp.Status, resp.Body)
+	}
+	var reset models.PasswordReset
+	if err := env.App.DB.Where("email = ?", user.Email).Last(&reset).Error; err != nil {
+		t.Fatal(err)
+	}
+	resp = env.Do(http.MethodPost, "/api/auth/reset/"+reset.Token, "", map[string]string{
+		"password": "reset", "password_confirm": "reset",
+	})
+	if resp.Status != http.StatusOK {
+		t.Fatalf("reset password: got status %d: %s", resp.Status, resp.Body)
+	}
+	if got := login("reset"); got != http.StatusOK {
+		t.Errorf("reset password: got status %d, want %d", got, http.StatusOK)
+	}
+}
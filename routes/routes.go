@@ -1,159 +1,281 @@
 package routes
 
 import (
+	"github.com/Danny19977/sr-api/app"
 	notificationController "github.com/Danny19977/sr-api/controller/Notification"
+	"github.com/Danny19977/sr-api/controller/alertrule"
+	"github.com/Danny19977/sr-api/controller/analytics"
 	"github.com/Danny19977/sr-api/controller/auth"
+	"github.com/Danny19977/sr-api/controller/compliance"
 	"github.com/Danny19977/sr-api/controller/country"
 	"github.com/Danny19977/sr-api/controller/dashboard"
 	monthController "github.com/Danny19977/sr-api/controller/month"
+	"github.com/Danny19977/sr-api/controller/outlet"
 	"github.com/Danny19977/sr-api/controller/product"
 	"github.com/Danny19977/sr-api/controller/province"
+	reportController "github.com/Danny19977/sr-api/controller/report"
 	Sale "github.com/Danny19977/sr-api/controller/sale"
+	"github.com/Danny19977/sr-api/controller/territory"
 	"github.com/Danny19977/sr-api/controller/user"
 	"github.com/Danny19977/sr-api/controller/userlog"
+	"github.com/Danny19977/sr-api/controller/webhook"
 	weekController "github.com/Danny19977/sr-api/controller/week"
 	yearController "github.com/Danny19977/sr-api/controller/year"
 	"github.com/Danny19977/sr-api/middlewares"
 	"github.com/gofiber/fiber/v2"
 )
 
-func Setup(app *fiber.App) {
+func Setup(server *fiber.App, container *app.App) {
 
-	api := app.Group("/api")
+	authCtl := auth.New(container)
+	userCtl := user.New(container)
+	userlogCtl := userlog.New(container)
+	countryCtl := country.New(container)
+	provinceCtl := province.New(container)
+	productCtl := product.New(container)
+	dashboardCtl := dashboard.New(container)
+	saleCtl := Sale.New(container)
+	yearCtl := yearController.New(container)
+	monthCtl := monthController.New(container)
+	notificationCtl := notificationController.New(container)
+	weekCtl := weekController.New(container)
+	complianceCtl := compliance.New(container)
+	alertRuleCtl := alertrule.New(container)
+	webhookCtl := webhook.New(container)
+	reportCtl := reportController.New(container)
+	analyticsCtl := analytics.New(container)
+	territoryCtl := territory.New(container)
+	outletCtl := outlet.New(container)
+
+	// Settings shared by every province are changed by admins only
+	requireAdmin := middlewares.RequireAdmin(container.Users)
+
+	api := server.Group("/api")
 
 	// Authentification controller - Public routes (no authentication required)
 	a := api.Group("/auth")
-	a.Post("/register", auth.Register)
-	a.Post("/login", auth.Login)
-	a.Post("/forgot-password", auth.Forgot)
-	a.Post("/reset/:token", auth.ResetPassword)
+	a.Post("/register", authCtl.Register)
+	a.Post("/login", authCtl.Login)
+	a.Post("/forgot-password", authCtl.Forgot)
+	a.Post("/reset/:token", authCtl.ResetPassword)
 
 	// Protected routes (authentication required)
 	protected := api.Group("/auth")
 	protected.Use(middlewares.IsAuthenticated)
-	protected.Get("/user", auth.AuthUser)
-	protected.Put("/profil/info", auth.UpdateInfo)
-	protected.Put("/change-password", auth.ChangePassword)
-	protected.Post("/logout", auth.Logout)
+	protected.Get("/user", authCtl.AuthUser)
+	protected.Put("/profil/info", authCtl.UpdateInfo)
+	protected.Put("/change-password", authCtl.ChangePassword)
+	protected.Post("/logout", authCtl.Logout)
 
 	// Users controller - Protected routes
 	u := api.Group("/users")
 	u.Use(middlewares.IsAuthenticated)
-	u.Get("/all", user.GetAllUsers)
-	u.Get("/all/paginate", user.GetPaginatedUsers)
-	u.Get("/all/paginate/nosearch", user.GetPaginatedNoSerach)
+	u.Get("/all", userCtl.GetAllUsers)
+	u.Get("/all/paginate", userCtl.GetPaginatedUsers)
+	u.Get("/all/paginate/nosearch", userCtl.GetPaginatedNoSerach)
+	u.Get("/org-chart", userCtl.GetOrgChart)
 
-	u.Get("/get/:uuid", user.GetUser)
-	u.Post("/create", user.CreateUser)
-	u.Put("/update/:uuid", user.UpdateUser)
-	u.Delete("/delete/:uuid", user.DeleteUser)
+	u.Get("/get/:uuid", userCtl.GetUser)
+	u.Post("/create", userCtl.CreateUser)
+	u.Put("/update/:uuid", userCtl.UpdateUser)
+	u.Delete("/delete/:uuid", userCtl.DeleteUser)
 
 	// UserLogs controller - Protected routes
 	log := api.Group("/users-logs")
 	log.Use(middlewares.IsAuthenticated)
-	log.Get("/all", userlog.GetUserLogs)
-	log.Get("/all/paginate", userlog.GetPaginatedUserLogs)
-	log.Get("/all/paginate/:user_uuid", userlog.GetUserLogByID)
-	log.Get("/get/:uuid", userlog.GetUserLog)
-	log.Post("/create", userlog.CreateUserLog)
-	log.Put("/update/:uuid", userlog.UpdateUserLog)
-	log.Delete("/delete/:uuid", userlog.DeleteUserLog)
+	log.Get("/all", userlogCtl.GetUserLogs)
+	log.Get("/all/paginate", userlogCtl.GetPaginatedUserLogs)
+	log.Get("/all/paginate/:user_uuid", userlogCtl.GetUserLogByID)
+	log.Get("/get/:uuid", userlogCtl.GetUserLog)
+	log.Post("/create", userlogCtl.CreateUserLog)
+	log.Put("/update/:uuid", userlogCtl.UpdateUserLog)
+	log.Delete("/delete/:uuid", userlogCtl.DeleteUserLog)
 
 	// Countries controller - Protected routes
 	co := api.Group("/countries")
 	co.Use(middlewares.IsAuthenticated)
-	co.Get("/all", country.GetAllCountry)
-	co.Get("/all/paginate", country.GetPaginatedCountry)
-	co.Get("/get/:uuid", country.GetCountry)
-	co.Post("/create", country.CreateCountry)
-	co.Put("/update/:uuid", country.UpdateCountry)
-	co.Delete("/delete/:uuid", country.DeleteCountry)
+	co.Get("/all", countryCtl.GetAllCountry)
+	co.Get("/all/paginate", countryCtl.GetPaginatedCountry)
+	co.Get("/get/:uuid", countryCtl.GetCountry)
+	co.Post("/create", countryCtl.CreateCountry)
+	co.Put("/update/:uuid", countryCtl.UpdateCountry)
+	co.Get("/calendar/:uuid", countryCtl.GetCountryCalendar)
+	co.Put("/calendar/:uuid", requireAdmin, countryCtl.UpdateCountryCalendar)
+	co.Get("/holidays/:uuid", countryCtl.GetCountryHolidays)
+	co.Post("/holidays/:uuid", requireAdmin, countryCtl.CreateCountryHoliday)
+	co.Delete("/holidays/delete/:uuid", requireAdmin, countryCtl.DeleteCountryHoliday)
+	co.Delete("/delete/:uuid", countryCtl.DeleteCountry)
 
 	// Province controller - Protected routes
 	prov := api.Group("/provinces")
 	prov.Use(middlewares.IsAuthenticated)
-	prov.Get("/all", province.GetAllProvinces)
-	prov.Get("/all/paginate", province.GetPaginatedProvince)
-	prov.Get("/all/paginate/:province_uuid", province.GetPaginatedASM)
-	prov.Get("/all/country/:country_uuid", province.GetAllProvinceByCountry)
-	prov.Get("/get/:uuid", province.GetProvince)
-	prov.Post("/create", province.CreateProvince)
-	prov.Put("/update/:uuid", province.UpdateProvince)
-	prov.Delete("/delete/:uuid", province.DeleteProvince)
+	prov.Get("/all", provinceCtl.GetAllProvinces)
+	prov.Get("/all/paginate", provinceCtl.GetPaginatedProvince)
+	prov.Get("/all/paginate/:province_uuid", provinceCtl.GetPaginatedASM)
+	prov.Get("/all/country/:country_uuid", provinceCtl.GetAllProvinceByCountry)
+	prov.Get("/get/:uuid", provinceCtl.GetProvince)
+	prov.Post("/create", provinceCtl.CreateProvince)
+	prov.Put("/update/:uuid", provinceCtl.UpdateProvince)
+	prov.Delete("/delete/:uuid", provinceCtl.DeleteProvince)
+	prov.Get("/boundary/:uuid", provinceCtl.GetProvinceBoundary)
+	prov.Put("/boundary/:uuid", requireAdmin, provinceCtl.SetProvinceBoundary)
+	prov.Post("/boundaries", requireAdmin, provinceCtl.UploadProvinceBoundaries)
+
+	// Territory controller - Protected routes - Regions, districts and outlets around the mirrored countries and provinces
+	terr := api.Group("/territories")
+	terr.Use(middlewares.IsAuthenticated)
+	terr.Get("/children", territoryCtl.GetChildren)
+	terr.Get("/get/:uuid", territoryCtl.GetTerritory)
+	terr.Post("/create", requireAdmin, territoryCtl.CreateTerritory)
+	terr.Put("/update/:uuid", requireAdmin, territoryCtl.UpdateTerritory)
+	terr.Put("/move/:uuid", requireAdmin, territoryCtl.MoveTerritory)
+	terr.Delete("/delete/:uuid", requireAdmin, territoryCtl.DeleteTerritory)
+
+	// Outlet controller - Protected routes - Points of sale with their GPS coordinates
+	out := api.Group("/outlets")
+	out.Use(middlewares.IsAuthenticated)
+	out.Get("/all/paginate", outletCtl.GetPaginatedOutlets)
+	out.Get("/get/:uuid", outletCtl.GetOutlet)
+	out.Post("/create", requireAdmin, outletCtl.CreateOutlet)
+	out.Put("/update/:uuid", requireAdmin, outletCtl.UpdateOutlet)
+	out.Delete("/delete/:uuid", requireAdmin, outletCtl.DeleteOutlet)
 
 	// Products controller - Protected routes
 	prod := api.Group("/products")
 	prod.Use(middlewares.IsAuthenticated)
-	prod.Get("/all", product.GetAllProducts)
-	prod.Get("/all/paginate", product.GetPaginatedProducts)
-	prod.Get("/get/:uuid", product.GetProduct)
-	prod.Get("/get/name/:name", product.GetProductByName)
-	prod.Post("/create", product.CreateProduct)
-	prod.Put("/update/:uuid", product.UpdateProduct)
-	prod.Delete("/delete/:uuid", product.DeleteProduct)
+	prod.Get("/all", productCtl.GetAllProducts)
+	prod.Get("/all/paginate", productCtl.GetPaginatedProducts)
+	prod.Get("/get/:uuid", productCtl.GetProduct)
+	prod.Get("/get/name/:name", productCtl.GetProductByName)
+	prod.Post("/create", productCtl.CreateProduct)
+	prod.Put("/update/:uuid", productCtl.UpdateProduct)
+	prod.Delete("/delete/:uuid", productCtl.DeleteProduct)
 
 	// Dashboard controller - Protected routes - Sales area dashboard and year objectives
 	dash := api.Group("/dashboard")
 	dash.Use(middlewares.IsAuthenticated)
-	dash.Get("/global-overview", dashboard.GetGlobalOverview)
-	dash.Get("/provincial-analysis", dashboard.GetProvincialAnalysis)
-	dash.Get("/daily-monitor", dashboard.GetDailyMonitor)
-	dash.Get("/historical-trends", dashboard.GetHistoricalTrends)
-	// dash.Get("/overall-summary", dashboard.GetOverallSummaryDashboard)
-	// dash.Get("/comparison-summary", dashboard.GetComparisonSummary)
+	dash.Get("/global-overview", dashboardCtl.GetGlobalOverview)
+	dash.Get("/provincial-analysis", dashboardCtl.GetProvincialAnalysis)
+	dash.Get("/daily-monitor", dashboardCtl.GetDailyMonitor)
+	dash.Get("/daily-monitor/stream", dashboardCtl.StreamDailyMonitor)
+	dash.Get("/historical-trends", dashboardCtl.GetHistoricalTrends)
+	dash.Get("/forecast", dashboardCtl.GetForecast)
+	dash.Get("/leaderboard", dashboardCtl.GetLeaderboard)
+	dash.Get("/scorecard", dashboardCtl.GetScorecard)
+	dash.Get("/territory", dashboardCtl.GetTerritoryRollup)
+	dash.Get("/outlet-map", dashboardCtl.GetOutletMap)
+	dash.Get("/choropleth", dashboardCtl.GetChoropleth)
+	// dash.Get("/overall-summary", dashboardCtl.GetOverallSummaryDashboard)
+	// dash.Get("/comparison-summary", dashboardCtl.GetComparisonSummary)
+
+	// Analytics controller - Protected routes - Ad-hoc aggregations of the sales
+	an := api.Group("/analytics")
+	an.Use(middlewares.IsAuthenticated)
+	an.Post("/query", analyticsCtl.Query)
+
+	// Compliance controller - Protected routes - Time slot entries checked by the alerting engine
+	comp := api.Group("/compliance")
+	comp.Use(middlewares.IsAuthenticated)
+	comp.Get("/history", complianceCtl.GetPaginatedHistory)
+	comp.Get("/summary", complianceCtl.GetSummary)
+
+	// Alert rule controller - Protected routes - Target and pace thresholds checked in the background
+	rules := api.Group("/alert-rules")
+	rules.Use(middlewares.IsAuthenticated)
+	rules.Get("/all/paginate", alertRuleCtl.GetPaginatedAlertRules)
+	rules.Get("/get/:uuid", alertRuleCtl.GetAlertRule)
+	rules.Get("/get/:uuid/firings", alertRuleCtl.GetAlertRuleFirings)
+	rules.Post("/create", requireAdmin, alertRuleCtl.CreateAlertRule)
+	rules.Put("/update/:uuid", requireAdmin, alertRuleCtl.UpdateAlertRule)
+	rules.Delete("/delete/:uuid", requireAdmin, alertRuleCtl.DeleteAlertRule)
+
+	// Webhook controller - Admin routes - Subscriptions to sale, target, slot and user events
+	hooks := api.Group("/webhooks")
+	hooks.Use(middlewares.IsAuthenticated, requireAdmin)
+	hooks.Get("/event-types", webhookCtl.GetEventTypes)
+	hooks.Get("/all/paginate", webhookCtl.GetPaginatedWebhooks)
+	hooks.Get("/get/:uuid", webhookCtl.GetWebhook)
+	hooks.Get("/get/:uuid/deliveries", webhookCtl.GetWebhookDeliveries)
+	hooks.Post("/create", webhookCtl.CreateWebhook)
+	hooks.Put("/update/:uuid", webhookCtl.UpdateWebhook)
+	hooks.Post("/rotate-secret/:uuid", webhookCtl.RotateSecret)
+	hooks.Delete("/delete/:uuid", webhookCtl.DeleteWebhook)
+	hooks.Post("/deliveries/:uuid/replay", webhookCtl.ReplayDelivery)
+
+	// Report controller - Protected routes - Dashboards mailed as PDF or XLSX on a schedule
+	reports := api.Group("/reports")
+	reports.Use(middlewares.IsAuthenticated)
+	reports.Get("/options", reportCtl.GetOptions)
+	reports.Get("/all/paginate", reportCtl.GetPaginatedReports)
+	reports.Get("/get/:uuid", reportCtl.GetReport)
+	reports.Get("/get/:uuid/runs", reportCtl.GetReportRuns)
+	reports.Post("/create", reportCtl.CreateReport)
+	reports.Put("/update/:uuid", reportCtl.UpdateReport)
+	reports.Delete("/delete/:uuid", reportCtl.DeleteReport)
+	reports.Post("/run/:uuid", reportCtl.RunReport)
+	reports.Get("/runs/:uuid/download", reportCtl.DownloadRun)
 
 	// Sale controller - Protected routes
 	sale := api.Group("/sales")
 	sale.Use(middlewares.IsAuthenticated)
-	sale.Get("/all", Sale.GetAllSale)
-	sale.Get("/all/paginate", Sale.GetPaginatedSale)
-	sale.Get("/all/province/:province_uuid", Sale.GetSaleByProvince)
-	sale.Get("/get/:uuid", Sale.GetSale)
-	sale.Post("/create", Sale.CreateSale)
-	sale.Put("/update/:uuid", Sale.UpdateSale)
-	sale.Delete("/delete/:uuid", Sale.DeleteSale)
+	sale.Get("/all", saleCtl.GetAllSale)
+	sale.Get("/all/paginate", saleCtl.GetPaginatedSale)
+	sale.Get("/all/province/:province_uuid", saleCtl.GetSaleByProvince)
+	sale.Get("/get/:uuid", saleCtl.GetSale)
+	sale.Get("/anomalies", saleCtl.GetAnomalies)
+	sale.Get("/geofence", saleCtl.GetGeofenceFailures)
+	sale.Post("/create", saleCtl.CreateSale)
+	sale.Put("/update/:uuid", saleCtl.UpdateSale)
+	sale.Delete("/delete/:uuid", saleCtl.DeleteSale)
 
 	// Year controller - Protected routes
 	yearGroup := api.Group("/years")
 	yearGroup.Use(middlewares.IsAuthenticated)
-	yearGroup.Get("/all", yearController.GetAllYears)
-	yearGroup.Get("/all/paginate", yearController.GetPaginatedYear)
-	yearGroup.Get("/get/:uuid", yearController.GetYear)
-	yearGroup.Get("/get/year/:year", yearController.GetYearByYearString)
-	yearGroup.Post("/create", yearController.CreateYear)
-	yearGroup.Put("/update/:uuid", yearController.UpdateYear)
-	yearGroup.Delete("/delete/:uuid", yearController.DeleteYear)
+	yearGroup.Get("/all", yearCtl.GetAllYears)
+	yearGroup.Get("/all/paginate", yearCtl.GetPaginatedYear)
+	yearGroup.Get("/get/:uuid", yearCtl.GetYear)
+	yearGroup.Get("/get/year/:year", yearCtl.GetYearByYearString)
+	yearGroup.Post("/create", yearCtl.CreateYear)
+	yearGroup.Put("/update/:uuid", yearCtl.UpdateYear)
+	yearGroup.Delete("/delete/:uuid", yearCtl.DeleteYear)
 
 	// Month controller - Protected routes
 	monthGroup := api.Group("/months")
 	monthGroup.Use(middlewares.IsAuthenticated)
-	monthGroup.Get("/all", monthController.GetAllMonths)
-	monthGroup.Get("/all/paginate", monthController.GetPaginatedMonth)
-	monthGroup.Get("/get/:uuid", monthController.GetMonth)
-	monthGroup.Get("/get/month/:month", monthController.GetMonthByMonthString)
-	monthGroup.Post("/create", monthController.CreateMonth)
-	monthGroup.Put("/update/:uuid", monthController.UpdateMonth)
-	monthGroup.Delete("/delete/:uuid", monthController.DeleteMonth)
+	monthGroup.Get("/all", monthCtl.GetAllMonths)
+	monthGroup.Get("/all/paginate", monthCtl.GetPaginatedMonth)
+	monthGroup.Get("/get/:uuid", monthCtl.GetMonth)
+	monthGroup.Get("/get/month/:month", monthCtl.GetMonthByMonthString)
+	monthGroup.Post("/create", monthCtl.CreateMonth)
+	monthGroup.Put("/update/:uuid", monthCtl.UpdateMonth)
+	monthGroup.Delete("/delete/:uuid", monthCtl.DeleteMonth)
 
 	// Notification controller - Protected routes
 	notificationGroup := api.Group("/notifications")
 	notificationGroup.Use(middlewares.IsAuthenticated)
-	notificationGroup.Get("/all", notificationController.GetAllNotifications)
-	notificationGroup.Get("/all/paginate", notificationController.GetPaginatedNotification)
-	notificationGroup.Get("/get/:uuid", notificationController.GetNotification)
-	notificationGroup.Get("/get/title/:title", notificationController.GetNotificationByTitleString)
-	notificationGroup.Post("/create", notificationController.CreateNotification)
-	notificationGroup.Put("/update/:uuid", notificationController.UpdateNotification)
-	notificationGroup.Delete("/delete/:uuid", notificationController.DeleteNotification)
+	notificationGroup.Get("/me", notificationCtl.GetMyNotifications)
+	notificationGroup.Get("/me/unread-count", notificationCtl.GetUnreadCount)
+	notificationGroup.Put("/me/read-all", notificationCtl.MarkAllRead)
+	notificationGroup.Put("/me/read/:uuid", notificationCtl.MarkRead)
+	notificationGroup.Get("/me/preferences", notificationCtl.GetPreferences)
+	notificationGroup.Put("/me/preferences", notificationCtl.UpdatePreferences)
+	notificationGroup.Post("/broadcast", notificationCtl.Broadcast)
+	notificationGroup.Get("/all", notificationCtl.GetAllNotifications)
+	notificationGroup.Get("/all/paginate", notificationCtl.GetPaginatedNotification)
+	notificationGroup.Get("/get/:uuid", notificationCtl.GetNotification)
+	notificationGroup.Get("/get/title/:title", notificationCtl.GetNotificationByTitleString)
+	notificationGroup.Post("/create", notificationCtl.CreateNotification)
+	notificationGroup.Put("/update/:uuid", notificationCtl.UpdateNotification)
+	notificationGroup.Delete("/delete/:uuid", notificationCtl.DeleteNotification)
 
 	// Week controller - Protected routes
 	weekGroup := api.Group("/weeks")
 	weekGroup.Use(middlewares.IsAuthenticated)
-	weekGroup.Get("/all", weekController.GetAllWeeks)
-	weekGroup.Get("/all/paginate", weekController.GetPaginatedWeek)
-	weekGroup.Get("/get/:uuid", weekController.GetWeek)
-	weekGroup.Get("/get/week/:week", weekController.GetWeekByWeekString)
-	weekGroup.Post("/create", weekController.CreateWeek)
-	weekGroup.Put("/update/:uuid", weekController.UpdateWeek)
-	weekGroup.Delete("/delete/:uuid", weekController.DeleteWeek)
+	weekGroup.Get("/all", weekCtl.GetAllWeeks)
+	weekGroup.Get("/all/paginate", weekCtl.GetPaginatedWeek)
+	weekGroup.Get("/get/:uuid", weekCtl.GetWeek)
+	weekGroup.Get("/get/week/:week", weekCtl.GetWeekByWeekString)
+	weekGroup.Post("/create", weekCtl.CreateWeek)
+	weekGroup.Put("/update/:uuid", weekCtl.UpdateWeek)
+	weekGroup.Delete("/delete/:uuid", weekCtl.DeleteWeek)
 }
@@ -0,0 +1,282 @@
+package routes_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Danny19977/sr-api/apptest"
+	"github.com/Danny19977/sr-api/models"
+	"github.com/google/uuid"
+)
+
+type envelope struct {
+	Status string           `json:"status"`
+	Data   []map[string]any `json:"data"`
+}
+
+func TestLoginAndAuthUser(t *testing.T) {
+	env := apptest.New(t)
+	user := env.CreateUser("Admin", nil)
+
+	resp := env.Do(http.MethodPost, "/api/auth/login", "", map[string]string{
+		"identifier": user.Email,
+		"password":   "secret",
+	})
+	if resp.Status != http.StatusOK {
+		t.Fatalf("login: got status %d: %s", resp.Status, resp.Body)
+	}
+
+	var login struct {
+		Data string `json:"data"`
+	}
+	if err := resp.JSON(&login); err != nil || login.Data == "" {
+		t.Fatalf("login: no token in %s", resp.Body)
+	}
+
+	resp = env.Do(http.MethodGet, "/api/auth/user", login.Data, nil)
+	if resp.Status != http.StatusOK {
+		t.Fatalf("auth user: got status %d: %s", resp.Status, resp.Body)
+	}
+}
+
+func TestProtectedRoutesRequireToken(t *testing.T) {
+	env := apptest.New(t)
+
+	resp := env.Do(http.MethodGet, "/api/sales/all/paginate", "", nil)
+	if resp.Status != http.StatusUnauthorized {
+		t.Fatalf("got status %d, want %d", resp.Status, http.StatusUnauthorized)
+	}
+}
+
+func TestASMOnlySeesOwnProvinceSales(t *testing.T) {
+	env := apptest.New(t)
+
+	country := &models.Country{UUID: uuid.New().String(), Name: "Country"}
+	if err := env.App.Geography.CreateCountry(country); err != nil {
+		t.Fatal(err)
+	}
+	north := &models.Province{UUID: uuid.New().String(), Name: "North", CountryUUID: country.UUID}
+	south := &models.Province{UUID: uuid.New().String(), Name: "South", CountryUUID: country.UUID}
+	for _, p := range []*models.Province{north, south} {
+		if err := env.App.Geography.CreateProvince(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	admin := env.CreateUser("Admin", nil)
+	asm := env.CreateUser("ASM", &north.UUID)
+	adminToken := env.Token(admin)
+
+	for _, p := range []*models.Province{north, south} {
+		resp := env.Do(http.MethodPost, "/api/sales/create", adminToken, map[string]any{
+			"province_uuid": p.UUID,
+			"product_uuid":  uuid.New().String(),
+			"user_uuid":     admin.UUID,
+			"quantity":      10,
+		})
+		if resp.Status != http.StatusOK {
+			t.Fatalf("create sale: got status %d: %s", resp.Status, resp.Body)
+		}
+	}
+
+	var all envelope
+	if err := env.Do(http.MethodGet, "/api/sales/all/paginate", adminToken, nil).JSON(&all); err != nil {
+		t.Fatal(err)
+	}
+	if len(all.Data) != 2 {
+		t.Fatalf("admin sees %d sales, want 2", len(all.Data))
+	}
+
+	var scoped envelope
+	if err := env.Do(http.MethodGet, "/api/sales/all/paginate", env.Token(asm), nil).JSON(&scoped); err != nil {
+		t.Fatal(err)
+	}
+	if len(scoped.Data) != 1 || scoped.Data[0]["province_uuid"] != north.UUID {
+		t.Fatalf("ASM sees %v, want only the sale of %s", scoped.Data, north.UUID)
+	}
+}
+
+func TestASMWithTerritorySeesItsProvinces(t *testing.T) {
+	env := apptest.New(t)
+
+	country := &models.Country{UUID: uuid.New().String(), Name: "Country"}
+	if err := env.App.Geography.CreateCountry(country); err != nil {
+		t.Fatal(err)
+	}
+	region := &models.Territory{UUID: uuid.New().String(), ParentUUID: &country.UUID, Level: models.TerritoryRegion, Name: "Coast"}
+	if err := env.App.Territories.Create(region); err != nil {
+		t.Fatal(err)
+	}
+	var provinces []*models.Province
+	for _, name := range []string{"North", "East", "South"} {
+		p := &models.Province{UUID: uuid.New().String(), Name: name, CountryUUID: country.UUID}
+		if err := env.App.Geography.CreateProvince(p); err != nil {
+			t.Fatal(err)
+		}
+		provinces = append(provinces, p)
+	}
+	// North and East make up the region, South stays outside
+	for _, p := range provinces[:2] {
+		if err := env.App.Territories.Move(&models.Territory{UUID: p.UUID}, region.UUID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	admin := env.CreateUser("Admin", nil)
+	asm := env.CreateUser("ASM", &provinces[0].UUID)
+	asm.TerritoryUUID = &region.UUID
+	if err := env.App.Users.Save(asm); err != nil {
+		t.Fatal(err)
+	}
+	adminToken := env.Token(admin)
+
+	for _, p := range provinces {
+		resp := env.Do(http.MethodPost, "/api/sales/create", adminToken, map[string]any{
+			"province_uuid": p.UUID,
+			"product_uuid":  uuid.New().String(),
+			"user_uuid":     admin.UUID,
+			"quantity":      10,
+		})
+		if resp.Status != http.StatusOK {
+			t.Fatalf("create sale: got status %d: %s", resp.Status, resp.Body)
+		}
+	}
+
+	var scoped envelope
+	if err := env.Do(http.MethodGet, "/api/sales/all/paginate", env.Token(asm), nil).JSON(&scoped); err != nil {
+		t.Fatal(err)
+	}
+	seen := map[any]bool{}
+	for _, sale := range scoped.Data {
+		seen[sale["province_uuid"]] = true
+	}
+	if len(scoped.Data) != 2 || !seen[provinces[0].UUID] || !seen[provinces[1].UUID] {
+		t.Fatalf("ASM sees %v, want the sales of North and East", scoped.Data)
+	}
+}
+
+func TestMovedSaleIsPlacedAgain(t *testing.T) {
+	env := apptest.New(t)
+
+	country := &models.Country{UUID: uuid.New().String(), Name: "Country"}
+	if err := env.App.Geography.CreateCountry(country); err != nil {
+		t.Fatal(err)
+	}
+	north := &models.Province{UUID: uuid.New().String(), Name: "North", CountryUUID: country.UUID}
+	south := &models.Province{UUID: uuid.New().String(), Name: "South", CountryUUID: country.UUID}
+	for _, p := range []*models.Province{north, south} {
+		if err := env.App.Geography.CreateProvince(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	quay := &models.Outlet{UUID: uuid.New().String(), Name: "Quay", ProvinceUUID: north.UUID}
+	market := &models.Outlet{UUID: uuid.New().String(), Name: "Market", ProvinceUUID: south.UUID}
+	for _, o := range []*models.Outlet{quay, market} {
+		if err := env.App.Outlets.Create(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	admin := env.CreateUser("Admin", nil)
+	token := env.Token(admin)
+	var created struct {
+		Data models.Sale `json:"data"`
+	}
+	err := env.Do(http.MethodPost, "/api/sales/create", token, map[string]any{
+		"outlet_uuid":  quay.UUID,
+		"product_uuid": uuid.New().String(),
+		"user_uuid":    admin.UUID,
+		"quantity":     10,
+	}).JSON(&created)
+	if err != nil || created.Data.ProvinceUUID != north.UUID {
+		t.Fatalf("got sale %+v (%v), want it in North", created.Data, err)
+	}
+	update := func(body map[string]any) *apptest.Response {
+		body["product_uuid"] = created.Data.ProductUUID
+		body["user_uuid"] = admin.UUID
+		body["quantity"] = 10
+		return env.Do(http.MethodPut, "/api/sales/update/"+created.Data.UUID, token, body)
+	}
+
+	// The outlet of the sale stays in North
+	if resp := update(map[string]any{"province_uuid": south.UUID}); resp.Status != http.StatusBadRequest {
+		t.Errorf("moving the province alone: got status %d, want 400: %s", resp.Status, resp.Body)
+	}
+
+	// The territory follows a new outlet
+	resp := update(map[string]any{"province_uuid": south.UUID, "outlet_uuid": market.UUID})
+	if resp.Status != http.StatusOK {
+		t.Fatalf("moving the outlet: got status %d: %s", resp.Status, resp.Body)
+	}
+	sale, err := env.App.Sales.FindByUUID(created.Data.UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sale.ProvinceUUID != south.UUID || sale.TerritoryUUID == nil || *sale.TerritoryUUID != market.UUID {
+		t.Errorf("got province %s territory %v, want South and Market", sale.ProvinceUUID, sale.TerritoryUUID)
+	}
+}
+
+func TestSettingsRequireAdmin(t *testing.T) {
+	env := apptest.New(t)
+	asm := env.Token(env.CreateUser("ASM", nil))
+	id := uuid.New().String()
+
+	for _, route := range []struct{ method, path string }{
+		{http.MethodPost, "/api/alert-rules/create"},
+		{http.MethodPut, "/api/alert-rules/update/" + id},
+		{http.MethodDelete, "/api/alert-rules/delete/" + id},
+		{http.MethodPut, "/api/countries/calendar/" + id},
+		{http.MethodPost, "/api/countries/holidays/" + id},
+		{http.MethodDelete, "/api/countries/holidays/delete/" + id},
+		{http.MethodPost, "/api/territories/create"},
+		{http.MethodPut, "/api/territories/update/" + id},
+		{http.MethodPut, "/api/territories/move/" + id},
+		{http.MethodDelete, "/api/territories/delete/" + id},
+		{http.MethodPost, "/api/outlets/create"},
+		{http.MethodPut, "/api/outlets/update/" + id},
+		{http.MethodDelete, "/api/outlets/delete/" + id},
+		{http.MethodPost, "/api/webhooks/create"},
+		{http.MethodPut, "/api/provinces/boundary/" + id},
+		{http.MethodPost, "/api/provinces/boundaries"},
+	} {
+		if resp := env.Do(route.method, route.path, asm, map[string]any{}); resp.Status != http.StatusForbidden {
+			t.Errorf("%s %s: got status %d for an ASM, want %d", route.method, route.path, resp.Status, http.StatusForbidden)
+		}
+	}
+}
+
+func TestOnlyAdminsGrantTheAdminRole(t *testing.T) {
+	env := apptest.New(t)
+
+	resp := env.Do(http.MethodPost, "/api/auth/register", "", map[string]any{
+		"fullname": "Intruder", "email": "intruder@example.com", "phone": "300",
+		"password": "secret", "password_confirm": "secret", "role": "Admin",
+	})
+	if resp.Status != http.StatusOK {
+		t.Fatalf("register: got status %d: %s", resp.Status, resp.Body)
+	}
+	registered, err := env.App.Users.FindByEmail("intruder@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if registered.Role == "Admin" {
+		t.Errorf("a self-registered account got the Admin role")
+	}
+
+	asm := env.CreateUser("ASM", nil)
+	token := env.Token(asm)
+	resp = env.Do(http.MethodPost, "/api/users/create", token, map[string]any{
+		"fullname": "Created", "email": "created@example.com", "Phone": "400",
+		"password": "secret", "confirm_password": "secret", "role": "Admin",
+	})
+	if resp.Status != http.StatusForbidden {
+		t.Errorf("ASM creating an admin: got status %d, want %d", resp.Status, http.StatusForbidden)
+	}
+	resp = env.Do(http.MethodPut, "/api/users/update/"+asm.UUID, token, map[string]any{
+		"fullname": asm.Fullname, "email": asm.Email, "Phone": asm.Phone, "role": "Admin", "status": true,
+	})
+	if resp.Status != http.StatusForbidden {
+		t.Errorf("ASM promoting itself: got status %d, want %d", resp.Status, http.StatusForbidden)
+	}
+}
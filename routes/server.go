@@ -0,0 +1,38 @@
+package routes
+
+import (
+	"strings"
+
+	"github.com/Danny19977/sr-api/app"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/logger"
+)
+
+// NewServer builds the Fiber application with its middleware and every route
+func NewServer(container *app.App) *fiber.App {
+	server := fiber.New()
+
+	// Initialize default config
+	server.Use(logger.New())
+
+	// Middleware
+	server.Use(cors.New(cors.Config{
+		AllowOrigins:     strings.Join(container.Config.Server.CORSOrigins, ","),
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization",
+		AllowCredentials: true,
+		AllowMethods: strings.Join([]string{
+			fiber.MethodGet,
+			fiber.MethodPost,
+			fiber.MethodHead,
+			fiber.MethodPut,
+			fiber.MethodDelete,
+			fiber.MethodPatch,
+			fiber.MethodOptions,
+		}, ","),
+	}))
+
+	Setup(server, container)
+
+	return server
+}
@@ -133,6 +133,17 @@ func (al *ActivityLogger) LogView(c *fiber.Ctx, entityType, entityName, entityID
 		})
 }
 
+// LogExport logs a data export with the filters it applied
+func (al *ActivityLogger) LogExport(c *fiber.Ctx, entityType, format string, filters map[string]interface{}) error {
+	return al.LogUserActivity(c, "EXPORT", fmt.Sprintf("export_%s", entityType),
+		fmt.Sprintf("Exported %s as %s", entityType, format),
+		map[string]interface{}{
+			"entity_type": entityType,
+			"format":      format,
+			"filters":     filters,
+		})
+}
+
 // LogAPICall logs API endpoint access
 func (al *ActivityLogger) LogAPICall(c *fiber.Ctx, endpoint, method string, responseStatus int) error {
 	return al.LogUserActivity(c, "API_CALL", fmt.Sprintf("api_%s", strings.ToLower(method)),
@@ -234,6 +245,11 @@ func LogViewWithDB(db *gorm.DB, c *fiber.Ctx, entityType, entityName, entityID s
 	return logger.LogView(c, entityType, entityName, entityID)
 }
 
+func LogExportWithDB(db *gorm.DB, c *fiber.Ctx, entityType, format string, filters map[string]interface{}) error {
+	logger := NewActivityLogger(db)
+	return logger.LogExport(c, entityType, format, filters)
+}
+
 func LogAPICallWithDB(db *gorm.DB, c *fiber.Ctx, endpoint, method string, responseStatus int) error {
 	logger := NewActivityLogger(db)
 	return logger.LogAPICall(c, endpoint, method, responseStatus)
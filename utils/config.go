@@ -3,16 +3,21 @@ package utils
 import (
 	"fmt"
 	"os"
+	"sync"
 
 	"github.com/joho/godotenv"
 )
 
-// Config func to get env value
+var loadEnvOnce sync.Once
+
+// Env returns an environment value, loading .env the first time it is called.
+//
+// Deprecated: use the typed configuration from the config package instead.
 func Env(key string) string {
-	// load .env file
-	err := godotenv.Load(".env")
-	if err != nil {
-		fmt.Print("Error loading .env file")
-	}
+	loadEnvOnce.Do(func() {
+		if err := godotenv.Load(".env"); err != nil {
+			fmt.Println("Error loading .env file")
+		}
+	})
 	return os.Getenv(key)
-}
\ No newline at end of file
+}
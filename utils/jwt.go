@@ -2,7 +2,6 @@ package utils
 
 import (
 	"errors"
-	"os"
 	"strings"
 	"time"
 
@@ -10,13 +9,24 @@ import (
 	"github.com/golang-jwt/jwt/v4"
 )
 
-var SECRET_KEY string = os.Getenv("SECRET_KEY")
+var (
+	SECRET_KEY string
+	tokenTTL   = 72 * time.Hour // 3 days
+)
+
+// ConfigureJWT sets the signing key and lifetime of issued tokens
+func ConfigureJWT(secretKey string, ttl time.Duration) {
+	SECRET_KEY = secretKey
+	if ttl > 0 {
+		tokenTTL = ttl
+	}
+}
 
 func GenerateJwt(issuer string) (string, error) {
 
 	claims := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwt.StandardClaims{
 		Issuer:    issuer,
-		ExpiresAt: time.Now().Add(time.Hour * 72).Unix(), // 3 days
+		ExpiresAt: time.Now().Add(tokenTTL).Unix(),
 	})
 
 	token, err := claims.SignedString([]byte(SECRET_KEY))
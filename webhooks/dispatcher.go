@@ -0,0 +1,204 @@
+// Package webhooks delivers the events of the outbox to the webhook
+// subscriptions. Every request is signed with the secret of its subscription,
+// and failed deliveries are retried with exponential backoff.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Danny19977/sr-api/app"
+	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/repository"
+)
+
+// Request headers of every delivery
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	// HeaderSignature is "sha256=" followed by the hex HMAC-SHA256 of
+	// "<timestamp>.<body>" keyed with the subscription secret
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+const (
+	// batchSize is the number of events fanned out or deliveries sent per query
+	batchSize = 100
+	// firstRetry is the wait after the first failed attempt, doubled after each
+	// further failure up to maxRetry
+	firstRetry = 30 * time.Second
+	maxRetry   = 6 * time.Hour
+	// purgeInterval is how often the history past the retention is purged
+	purgeInterval = time.Hour
+)
+
+// Sign returns the signature of body sent at timestamp with secret
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff returns the wait before the attempt that follows attempts failed ones
+func Backoff(attempts int) time.Duration {
+	wait := firstRetry
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+		if wait >= maxRetry {
+			return maxRetry
+		}
+	}
+	return wait
+}
+
+// Dispatcher turns the outbox events into deliveries and sends them
+type Dispatcher struct {
+	app    *app.App
+	client *http.Client
+}
+
+// New creates a dispatcher using the webhook settings of a
+func New(a *app.App) *Dispatcher {
+	return &Dispatcher{app: a, client: &http.Client{Timeout: a.Config.Webhooks.Timeout}}
+}
+
+// Run dispatches every poll interval and purges the expired history every
+// hour until ctx is done
+func (d *Dispatcher) Run(ctx context.Context) {
+	poll := time.NewTicker(d.app.Config.Webhooks.PollInterval)
+	defer poll.Stop()
+	purge := time.NewTicker(purgeInterval)
+	defer purge.Stop()
+
+	for {
+		if err := d.Tick(time.Now()); err != nil {
+			d.app.Logger.Printf("webhooks: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-poll.C:
+		case <-purge.C:
+			d.purge(time.Now())
+		}
+	}
+}
+
+// Tick fans out the pending outbox events, then sends the deliveries due at now
+func (d *Dispatcher) Tick(now time.Time) error {
+	for {
+		taken, err := d.app.Webhooks.FanOut(batchSize, now)
+		if err != nil {
+			return fmt.Errorf("fanning out the outbox: %w", err)
+		}
+		if taken < batchSize {
+			break
+		}
+	}
+
+	// A claimed delivery is held back for longer than its request may take
+	lease := 2 * d.app.Config.Webhooks.Timeout
+	deliveries, err := d.app.Webhooks.ClaimDue(now, batchSize, lease)
+	if err != nil {
+		return fmt.Errorf("claiming due deliveries: %w", err)
+	}
+
+	subscriptions := make(map[string]*models.WebhookSubscription)
+	for i := range deliveries {
+		delivery := &deliveries[i]
+		subscription, ok := subscriptions[delivery.SubscriptionUUID]
+		if !ok {
+			var err error
+			subscription, err = d.app.Webhooks.FindSubscription(delivery.SubscriptionUUID)
+			if err != nil && !errors.Is(err, repository.ErrNotFound) {
+				// Left claimed, the delivery is retried once its lease runs out
+				d.app.Logger.Printf("webhooks: reading subscription %s: %v", delivery.SubscriptionUUID, err)
+				continue
+			}
+			subscriptions[delivery.SubscriptionUUID] = subscription
+		}
+
+		d.attempt(delivery, subscription, now)
+		if err := d.app.Webhooks.RecordAttempt(delivery); err != nil {
+			d.app.Logger.Printf("webhooks: recording delivery %s: %v", delivery.UUID, err)
+		}
+	}
+	return nil
+}
+
+// attempt sends delivery to subscription and updates it with the outcome
+func (d *Dispatcher) attempt(delivery *models.WebhookDelivery, subscription *models.WebhookSubscription, now time.Time) {
+	if subscription == nil || !subscription.Active {
+		delivery.Status = models.DeliveryFailed
+		delivery.LastError = "subscription is deleted or inactive"
+		return
+	}
+
+	delivery.Attempts++
+	status, err := d.post(delivery, subscription, now)
+	delivery.ResponseStatus = status
+	if err == nil {
+		delivery.Status = models.DeliveryDelivered
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= d.app.Config.Webhooks.MaxAttempts {
+		delivery.Status = models.DeliveryFailed
+		return
+	}
+	delivery.NextAttemptAt = now.Add(Backoff(delivery.Attempts))
+}
+
+// post sends the payload of delivery to subscription and returns the HTTP
+// status, any answer outside 2xx is an error
+func (d *Dispatcher) post(delivery *models.WebhookDelivery, subscription *models.WebhookSubscription, now time.Time) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "sr-api-webhooks")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, delivery.UUID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(subscription.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// purge deletes the history older than the retention
+func (d *Dispatcher) purge(now time.Time) {
+	if d.app.Config.Webhooks.Retention <= 0 {
+		return
+	}
+	if _, err := d.app.Webhooks.Purge(now.Add(-d.app.Config.Webhooks.Retention)); err != nil {
+		d.app.Logger.Printf("webhooks: purging history: %v", err)
+	}
+}
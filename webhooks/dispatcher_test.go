@@ -0,0 +1,37 @@
+package webhooks
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	// echo -n '1700000000.{"id":"e1"}' | openssl dgst -sha256 -hmac secret
+	const want = "sha256=46fc0b60e09563a94dea2fa3b7b63d83458dd87b30fac860dcbabac0df9bdbde"
+	if got := Sign("secret", 1700000000, []byte(`{"id":"e1"}`)); got != want {
+		t.Errorf("Sign = %s, want %s", got, want)
+	}
+	if Sign("secret", 1700000001, []byte(`{"id":"e1"}`)) == want {
+		t.Error("signature ignores the timestamp")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	cases := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{6, 16 * time.Minute},
+		{10, 4*time.Hour + 16*time.Minute},
+		{11, 6 * time.Hour},
+		{50, 6 * time.Hour},
+	}
+	for _, c := range cases {
+		if got := Backoff(c.attempts); got != c.want {
+			t.Errorf("Backoff(%d) = %s, want %s", c.attempts, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package webhooks_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Danny19977/sr-api/apptest"
+	"github.com/Danny19977/sr-api/models"
+	"github.com/Danny19977/sr-api/repository"
+	"github.com/Danny19977/sr-api/webhooks"
+	"github.com/google/uuid"
+)
+
+// receiver records the requests of the webhook endpoint and answers with status
+type receiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+	w.WriteHeader(r.status)
+}
+
+func (r *receiver) answer(status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status = status
+}
+
+func TestSaleEventIsSignedRetriedAndReplayed(t *testing.T) {
+	env := apptest.New(t)
+	rec := &receiver{status: http.StatusInternalServerError}
+	endpoint := httptest.NewServer(rec)
+	defer endpoint.Close()
+
+	admin := env.CreateUser("Admin", nil)
+	asm := env.CreateUser("ASM", nil)
+
+	body := map[string]interface{}{"name": "ERP", "url": endpoint.URL, "event_types": []string{models.EventSaleCreated}}
+	if res := env.Do("POST", "/api/webhooks/create", env.Token(asm), body); res.Status != 403 {
+		t.Fatalf("ASM creating a webhook: got %d, want 403", res.Status)
+	}
+	res := env.Do("POST", "/api/webhooks/create", env.Token(admin), body)
+	if res.Status != 200 {
+		t.Fatalf("creating webhook: %d %s", res.Status, res.Body)
+	}
+	var created struct {
+		Data   models.WebhookSubscription `json:"data"`
+		Secret string                     `json:"secret"`
+	}
+	if err := res.JSON(&created); err != nil {
+		t.Fatal(err)
+	}
+
+	sale := &models.Sale{
+		UUID:         uuid.New().String(),
+		ProvinceUUID: uuid.New().String(),
+		ProductUUID:  uuid.New().String(),
+		UserUUID:     admin.UUID,
+		Quantity:     7,
+	}
+	if err := env.App.Sales.Create(sale); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first attempt fails and is retried after the backoff
+	dispatcher := webhooks.New(env.App)
+	now := time.Now()
+	if err := dispatcher.Tick(now); err != nil {
+		t.Fatal(err)
+	}
+	deliveries, _, err := env.App.Webhooks.Deliveries(created.Data.UUID, repository.DeliveryListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("got %d deliveries, want 1 (the user.created events are not subscribed)", len(deliveries))
+	}
+	first := deliveries[0]
+	if first.Status != models.DeliveryPending || first.Attempts != 1 || first.ResponseStatus != 500 {
+		t.Errorf("after a failed attempt got %+v", first)
+	}
+
+	rec.answer(http.StatusNoContent)
+	if err := dispatcher.Tick(now.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.requests) != 1 {
+		t.Fatalf("retried before the backoff: %d requests", len(rec.requests))
+	}
+	if err := dispatcher.Tick(now.Add(webhooks.Backoff(1) + time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	delivered, err := env.App.Webhooks.FindDelivery(first.UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivered.Status != models.DeliveryDelivered || delivered.Attempts != 2 || delivered.DeliveredAt == nil {
+		t.Errorf("after a successful attempt got %+v", delivered)
+	}
+
+	// The receiver can verify the request with the secret
+	last := rec.requests[len(rec.requests)-1]
+	lastBody := rec.bodies[len(rec.bodies)-1]
+	timestamp, _ := strconv.ParseInt(last.Header.Get(webhooks.HeaderTimestamp), 10, 64)
+	if got := last.Header.Get(webhooks.HeaderSignature); got != webhooks.Sign(created.Secret, timestamp, lastBody) {
+		t.Errorf("signature %q does not match the body", got)
+	}
+	var envelope struct {
+		ID   string           `json:"id"`
+		Type string           `json:"type"`
+		Data models.SaleEvent `json:"data"`
+	}
+	if err := json.Unmarshal(lastBody, &envelope); err != nil {
+		t.Fatal(err)
+	}
+	if envelope.Type != models.EventSaleCreated || envelope.Data.UUID != sale.UUID || envelope.Data.Quantity != 7 {
+		t.Errorf("unexpected envelope %+v", envelope)
+	}
+
+	// A replay posts the same event as a new delivery
+	res = env.Do("POST", "/api/webhooks/deliveries/"+first.UUID+"/replay", env.Token(admin), nil)
+	if res.Status != 200 {
+		t.Fatalf("replaying: %d %s", res.Status, res.Body)
+	}
+	if err := dispatcher.Tick(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.requests) != 3 {
+		t.Fatalf("got %d requests after the replay, want 3", len(rec.requests))
+	}
+	var replayed struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(rec.bodies[2], &replayed)
+	if replayed.ID != envelope.ID || rec.requests[2].Header.Get(webhooks.HeaderDelivery) == first.UUID {
+		t.Errorf("the replay should keep the event id %s under a new delivery id", envelope.ID)
+	}
+}
+
+func TestFailedWriteQueuesNoEvent(t *testing.T) {
+	env := apptest.New(t)
+	user := env.CreateUser("ASM", nil)
+
+	count := func() int64 {
+		var n int64
+		if err := env.App.DB.Model(&models.OutboxEvent{}).Where("type = ?", models.EventUserCreated).Count(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if got := count(); got != 1 {
+		t.Fatalf("got %d user.created events, want 1", got)
+	}
+
+	// A duplicate key rolls the event back with the user
+	duplicate := *user
+	if err := env.App.Users.Create(&duplicate, "secret"); err == nil {
+		t.Fatal("creating a duplicate user should fail")
+	}
+	if got := count(); got != 1 {
+		t.Errorf("got %d user.created events after a failed write, want 1", got)
+	}
+}
+
+// unreadable fails every subscription lookup, as a database outage would
+type unreadable struct {
+	repository.WebhookRepository
+}
+
+func (unreadable) FindSubscription(string) (*models.WebhookSubscription, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestUnreadableSubscriptionIsRetried(t *testing.T) {
+	env := apptest.New(t)
+	rec := &receiver{status: http.StatusOK}
+	endpoint := httptest.NewServer(rec)
+	defer endpoint.Close()
+
+	subscription := &models.WebhookSubscription{
+		UUID:       uuid.New().String(),
+		Name:       "ERP",
+		URL:        endpoint.URL,
+		Secret:     "whsec_test",
+		EventTypes: models.EventSaleCreated,
+		Active:     true,
+	}
+	if err := env.App.Webhooks.CreateSubscription(subscription); err != nil {
+		t.Fatal(err)
+	}
+	sale := &models.Sale{
+		UUID:         uuid.New().String(),
+		ProvinceUUID: uuid.New().String(),
+		ProductUUID:  uuid.New().String(),
+		UserUUID:     uuid.New().String(),
+		Quantity:     7,
+	}
+	if err := env.App.Sales.Create(sale); err != nil {
+		t.Fatal(err)
+	}
+
+	webhooksRepo := env.App.Webhooks
+	env.App.Webhooks = unreadable{webhooksRepo}
+	dispatcher := webhooks.New(env.App)
+	now := time.Now()
+	if err := dispatcher.Tick(now); err != nil {
+		t.Fatal(err)
+	}
+	env.App.Webhooks = webhooksRepo
+
+	deliveries, _, err := webhooksRepo.Deliveries(subscription.UUID, repository.DeliveryListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Status != models.DeliveryPending || deliveries[0].Attempts != 0 {
+		t.Fatalf("got deliveries %+v, want one pending and not attempted", deliveries)
+	}
+
+	// Once the lease runs out the delivery goes through
+	if err := dispatcher.Tick(now.Add(2*env.App.Config.Webhooks.Timeout + time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	delivered, err := webhooksRepo.FindDelivery(deliveries[0].UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivered.Status != models.DeliveryDelivered || len(rec.requests) != 1 {
+		t.Errorf("got status %s after %d requests, want delivered after 1", delivered.Status, len(rec.requests))
+	}
+}
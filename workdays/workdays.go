@@ -0,0 +1,219 @@
+// Package workdays tells working days from weekends and public holidays, and
+// finds the period a range of days is compared against so both hold the
+// same number of working days.
+package workdays
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Comparison modes
+const (
+	// PreviousPeriod is the working days just before the range
+	PreviousPeriod = "previous_period"
+	// LastYear is the same weekdays 52 weeks earlier
+	LastYear = "last_year"
+	// SameWeekday is the same weekdays in the previous week or weeks
+	SameWeekday = "same_weekday"
+)
+
+// Modes lists the comparison modes
+var Modes = []string{PreviousPeriod, LastYear, SameWeekday}
+
+// DefaultWeekdays are the ISO days worked when a country sets none, Monday
+// to Saturday
+const DefaultWeekdays = "1,2,3,4,5,6"
+
+// maxSearchDays bounds the walk through days without work
+const maxSearchDays = 366
+
+// Calendar holds the weekdays worked and the holidays of a country
+type Calendar struct {
+	// Weekdays is indexed by time.Weekday
+	Weekdays [7]bool
+	// Holidays maps the dates of public holidays, as 2006-01-02, to their names
+	Holidays map[string]string
+}
+
+// Default works Monday to Saturday without holidays
+var Default = Calendar{Weekdays: [7]bool{false, true, true, true, true, true, true}}
+
+// ParseWeekdays reads a comma separated list of ISO days, 1 being Monday and
+// 7 Sunday
+func ParseWeekdays(value string) ([7]bool, error) {
+	var weekdays [7]bool
+	if strings.TrimSpace(value) == "" {
+		value = DefaultWeekdays
+	}
+	for _, part := range strings.Split(value, ",") {
+		day, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || day < 1 || day > 7 {
+			return weekdays, fmt.Errorf("working days must list days between 1 (Monday) and 7 (Sunday)")
+		}
+		weekdays[day%7] = true
+	}
+	return weekdays, nil
+}
+
+// New creates the calendar of a country working on weekdays, an ISO day
+// list, with holidays mapping dates to names
+func New(weekdays string, holidays map[string]string) (Calendar, error) {
+	days, err := ParseWeekdays(weekdays)
+	if err != nil {
+		return Default, err
+	}
+	return Calendar{Weekdays: days, Holidays: holidays}, nil
+}
+
+// Merge combines the calendars of several countries: a day is worked when any
+// of them works it
+func Merge(calendars ...Calendar) Calendar {
+	if len(calendars) == 0 {
+		return Default
+	}
+	merged := Calendar{Holidays: map[string]string{}}
+	for date, name := range calendars[0].Holidays {
+		merged.Holidays[date] = name
+	}
+	for _, cal := range calendars {
+		for day, worked := range cal.Weekdays {
+			merged.Weekdays[day] = merged.Weekdays[day] || worked
+		}
+		for date := range merged.Holidays {
+			if _, ok := cal.Holidays[date]; !ok {
+				delete(merged.Holidays, date)
+			}
+		}
+	}
+	return merged
+}
+
+// ValidMode reports whether mode is one of Modes
+func ValidMode(mode string) bool {
+	return slices.Contains(Modes, mode)
+}
+
+// startOfDay returns the midnight before t
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// Holiday returns the name of the holiday on the day of t, if any
+func (c Calendar) Holiday(t time.Time) (string, bool) {
+	name, ok := c.Holidays[t.Format("2006-01-02")]
+	return name, ok
+}
+
+// IsWorkingDay reports whether the day of t is worked
+func (c Calendar) IsWorkingDay(t time.Time) bool {
+	if _, ok := c.Holiday(t); ok {
+		return false
+	}
+	return c.Weekdays[t.Weekday()]
+}
+
+// Count returns the number of working days from the day of from to the day
+// before to
+func (c Calendar) Count(from, to time.Time) int {
+	n := 0
+	for day := startOfDay(from); day.Before(to); day = day.AddDate(0, 0, 1) {
+		if c.IsWorkingDay(day) {
+			n++
+		}
+	}
+	return n
+}
+
+// Previous returns the n working days before the day of t, the closest first
+func (c Calendar) Previous(t time.Time, n int) []time.Time {
+	var days []time.Time
+	day := startOfDay(t)
+	for i := 0; len(days) < n && i < maxSearchDays+n; i++ {
+		day = day.AddDate(0, 0, -1)
+		if c.IsWorkingDay(day) {
+			days = append(days, day)
+		}
+	}
+	return days
+}
+
+// forward returns the day after the nth working day from the day of from
+func (c Calendar) forward(from time.Time, n int) time.Time {
+	day := startOfDay(from)
+	for i := 0; n > 0 && i < maxSearchDays+n; i++ {
+		if c.IsWorkingDay(day) {
+			n--
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return day
+}
+
+// backward returns the nth working day before the day of to
+func (c Calendar) backward(to time.Time, n int) time.Time {
+	days := c.Previous(to, n)
+	if len(days) == 0 {
+		return startOfDay(to)
+	}
+	return days[len(days)-1]
+}
+
+// weeksBack steps the day of t back by whole weeks, at least weeks of them,
+// until it is a working day
+func (c Calendar) weeksBack(t time.Time, weeks int) time.Time {
+	day := startOfDay(t).AddDate(0, 0, -7*weeks)
+	for i := 0; !c.IsWorkingDay(day) && i < maxSearchDays/7; i++ {
+		day = day.AddDate(0, 0, -7)
+	}
+	return day
+}
+
+// Comparable returns the days [From, To) the days [from, to) are compared
+// against in mode. Both hold the same number of working days; ranges without
+// any are compared day for day.
+func (c Calendar) Comparable(mode string, from, to time.Time) (time.Time, time.Time, error) {
+	from, end := startOfDay(from), startOfDay(to)
+	if end.Before(to) {
+		end = end.AddDate(0, 0, 1)
+	}
+	days := int(math.Round(end.Sub(from).Hours() / 24))
+	weeks := max(1, (days+6)/7)
+	n := c.Count(from, end)
+
+	switch mode {
+	case PreviousPeriod:
+		if n == 0 {
+			return from.AddDate(0, 0, -days), from, nil
+		}
+		return c.backward(from, n), from, nil
+	case LastYear:
+		start := from.AddDate(0, 0, -364)
+		if n == 0 {
+			return start, start.AddDate(0, 0, days), nil
+		}
+		start = c.firstWorkingDay(start)
+		return start, c.forward(start, n), nil
+	case SameWeekday:
+		if n == 0 {
+			start := from.AddDate(0, 0, -7*weeks)
+			return start, start.AddDate(0, 0, days), nil
+		}
+		start := c.weeksBack(c.firstWorkingDay(from), weeks)
+		return start, c.forward(start, n), nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("comparison must be %s", strings.Join(Modes, ", "))
+}
+
+// firstWorkingDay returns the first working day from the day of t
+func (c Calendar) firstWorkingDay(t time.Time) time.Time {
+	day := startOfDay(t)
+	for i := 0; !c.IsWorkingDay(day) && i < maxSearchDays; i++ {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day
+}
@@ -0,0 +1,87 @@
+package workdays
+
+import (
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestWorkingDays(t *testing.T) {
+	cal, err := New("1,2,3,4,5", map[string]string{"2024-06-30": "Independence Day", "2024-07-01": "Bridge"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cal.IsWorkingDay(date("2024-06-29")) || cal.IsWorkingDay(date("2024-07-01")) || !cal.IsWorkingDay(date("2024-07-02")) {
+		t.Error("a Saturday or a holiday was worked, or a Tuesday was not")
+	}
+	// June 24th to July 7th 2024: two weeks less the Monday holiday
+	if n := cal.Count(date("2024-06-24"), date("2024-07-08")); n != 9 {
+		t.Errorf("got %d working days, want 9", n)
+	}
+	if days := cal.Previous(date("2024-07-02"), 2); len(days) != 2 || !days[0].Equal(date("2024-06-28")) || !days[1].Equal(date("2024-06-27")) {
+		t.Errorf("got %v, want the Friday and Thursday before the holidays", days)
+	}
+
+	if _, err := ParseWeekdays("1,8"); err == nil {
+		t.Error("day 8 was accepted")
+	}
+	if days, _ := ParseWeekdays(""); days != Default.Weekdays {
+		t.Errorf("got %v, want Monday to Saturday by default", days)
+	}
+}
+
+func TestComparable(t *testing.T) {
+	cal, _ := New("1,2,3,4,5,6", map[string]string{"2024-06-30": "Independence Day", "2024-06-24": "Holiday"})
+
+	for _, tc := range []struct {
+		mode     string
+		from, to string
+		want     [2]string
+	}{
+		// Monday July 1st follows a holiday Sunday and a Saturday
+		{PreviousPeriod, "2024-07-01", "2024-07-02", [2]string{"2024-06-29", "2024-07-01"}},
+		// Six working days before July 1st skip the Sunday and the Monday holiday
+		{PreviousPeriod, "2024-07-01", "2024-07-07", [2]string{"2024-06-22", "2024-07-01"}},
+		// The same Monday a week earlier was a holiday, so two weeks earlier
+		{SameWeekday, "2024-07-01", "2024-07-02", [2]string{"2024-06-17", "2024-06-18"}},
+		// 52 weeks earlier is Monday July 3rd 2023
+		{LastYear, "2024-07-01", "2024-07-03", [2]string{"2023-07-03", "2023-07-05"}},
+		// A Sunday alone is compared day for day
+		{PreviousPeriod, "2024-07-07", "2024-07-08", [2]string{"2024-07-06", "2024-07-07"}},
+	} {
+		from, to, err := cal.Comparable(tc.mode, date(tc.from), date(tc.to))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := [2]string{from.Format("2006-01-02"), to.Format("2006-01-02")}; got != tc.want {
+			t.Errorf("%s of %s to %s: got %v, want %v", tc.mode, tc.from, tc.to, got, tc.want)
+		}
+	}
+
+	if _, _, err := cal.Comparable("yesterday", date("2024-07-01"), date("2024-07-02")); err == nil {
+		t.Error("an unknown mode was accepted")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	weekdays, _ := New("1,2,3,4,5", map[string]string{"2024-06-30": "A", "2024-12-25": "Christmas"})
+	saturdays, _ := New("6", map[string]string{"2024-12-25": "Christmas"})
+
+	merged := Merge(weekdays, saturdays)
+	if !merged.IsWorkingDay(date("2024-06-29")) || merged.IsWorkingDay(date("2024-06-30")) {
+		t.Error("the Saturday of one country was not worked, or a Sunday was")
+	}
+	if merged.IsWorkingDay(date("2024-12-25")) {
+		t.Error("a holiday of every country was worked")
+	}
+	if _, ok := merged.Holiday(date("2024-06-30")); ok {
+		t.Error("the holiday of a single country was kept")
+	}
+}